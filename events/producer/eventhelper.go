@@ -27,3 +27,8 @@ import (
 func CreateBlockEvent(te *ehpb.Block) *ehpb.OpenchainEvent {
 	return &ehpb.OpenchainEvent{&ehpb.OpenchainEvent_Block{Block: te}}
 }
+
+//CreateStateTransferEvent creates a OpenchainEvent from the progress of a state transfer
+func CreateStateTransferEvent(status *ehpb.StateTransferStatus) *ehpb.OpenchainEvent {
+	return &ehpb.OpenchainEvent{Event: &ehpb.OpenchainEvent_StateTransfer{StateTransfer: status}}
+}
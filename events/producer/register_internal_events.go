@@ -30,8 +30,9 @@ import (
 
 //----Event Types -----
 const (
-	RegisterType = "register"
-	BlockType    = "block"
+	RegisterType      = "register"
+	BlockType         = "block"
+	StateTransferType = "statetransfer"
 )
 
 func getMessageType(e *pb.OpenchainEvent) string {
@@ -42,6 +43,8 @@ func getMessageType(e *pb.OpenchainEvent) string {
 		return "block"
 	case *pb.OpenchainEvent_Generic:
 		return "generic"
+	case *pb.OpenchainEvent_StateTransfer:
+		return "statetransfer"
 	default:
 		return ""
 	}
@@ -50,5 +53,6 @@ func getMessageType(e *pb.OpenchainEvent) string {
 //should be called at init time to register supported internal events
 func addInternalEventTypes() {
 	AddEventType(BlockType)
+	AddEventType(StateTransferType)
 	AddEventType(RegisterType)
 }
@@ -46,7 +46,10 @@ import (
 	"github.com/hyperledger-incubator/obc-peer/events/producer"
 	"github.com/hyperledger-incubator/obc-peer/openchain"
 	"github.com/hyperledger-incubator/obc-peer/openchain/chaincode"
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus/controller"
 	"github.com/hyperledger-incubator/obc-peer/openchain/consensus/helper"
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus/obcpbft"
 	"github.com/hyperledger-incubator/obc-peer/openchain/crypto"
 	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/genesis"
 	"github.com/hyperledger-incubator/obc-peer/openchain/peer"
@@ -103,6 +106,30 @@ var stopCmd = &cobra.Command{
 	},
 }
 
+var byzantineCmd = &cobra.Command{
+	Use:   "byzantine [behavior...]",
+	Short: "Show or set byzantine behaviors of the openchain peer.",
+	Long:  `Outputs the byzantine behaviors of the currently running validating peer. If behaviors are given, they replace the current ones; pass "none" to restore correct behavior. Only meant for test networks.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		openchain.LoggingInit("byzantine")
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return byzantine(args)
+	},
+}
+
+var stateTransferCmd = &cobra.Command{
+	Use:   "statetransfer [pause|resume|cancel|pin [peer...]]",
+	Short: "Show or control the state transfer of the openchain peer.",
+	Long:  `Outputs the progress of the state transfer of the currently running validating peer. It can be paused, resumed or cancelled, or pinned to the named peers; pin without peers lets it use any peer again.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		openchain.LoggingInit("statetransfer")
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return stateTransfer(args)
+	},
+}
+
 var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Login user on CLI.",
@@ -230,6 +257,8 @@ func main() {
 	mainCmd.AddCommand(peerCmd)
 	mainCmd.AddCommand(statusCmd)
 	mainCmd.AddCommand(stopCmd)
+	mainCmd.AddCommand(byzantineCmd)
+	mainCmd.AddCommand(stateTransferCmd)
 	mainCmd.AddCommand(loginCmd)
 
 	vmCmd.AddCommand(vmPrimeCmd)
@@ -307,6 +336,7 @@ func serve(args []string) error {
 	if err != nil {
 		grpclog.Fatalf("Failed to listen: %v", err)
 	}
+	lis = peer.NewKeepAliveListener(lis)
 
 	ehubLis, ehubGrpcServer, err := createEventHubServer()
 	if err != nil {
@@ -349,6 +379,9 @@ func serve(args []string) error {
 		peerServer, err = peer.NewPeerWithHandler(helper.NewConsensusHandler)
 	} else {
 		logger.Debug("Running as non-validating peer")
+		// In light mode, the block headers are anchored to the checkpoint
+		// certificates of obcpbft
+		peer.SetCheckpointVerifier(obcpbft.VerifyCheckpointCertificate)
 		peerServer, err = peer.NewPeerWithHandler(peer.NewPeerHandler)
 	}
 
@@ -363,7 +396,22 @@ func serve(args []string) error {
 	pb.RegisterPeerServer(grpcServer, peerServer)
 
 	// Register the Admin server
-	pb.RegisterAdminServer(grpcServer, openchain.NewAdminServer())
+	adminServer := openchain.NewAdminServer()
+	adminServer.SetPeer(peerServer)
+	if viper.GetBool("peer.validator.enabled") {
+		// The consenter is shared with the consensus handlers, whichever
+		// needs it first creates it
+		stack := helper.NewHelper(peerServer)
+		adminServer.SetConsenter(func() consensus.Consenter {
+			consenter, err := controller.GetConsenter(stack)
+			if err != nil {
+				logger.Error("Could not create the consenter: %s", err)
+				return nil
+			}
+			return consenter
+		})
+	}
+	pb.RegisterAdminServer(grpcServer, adminServer)
 
 	// Register ChaincodeSupport server...
 	// TODO : not the "DefaultChain" ... we have to revisit when we do multichain
@@ -392,7 +440,7 @@ func serve(args []string) error {
 
 	// Create and register the REST service if configured
 	if viper.GetBool("rest.enabled") {
-		go rest.StartOpenchainRESTServer(serverOpenchain, serverDevops)
+		go rest.StartOpenchainRESTServer(serverOpenchain, serverDevops, adminServer)
 	}
 
 	rootNode, err := openchain.GetRootNode()
@@ -469,6 +517,67 @@ func stop() (err error) {
 	return nil
 }
 
+func byzantine(args []string) (err error) {
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return
+	}
+
+	serverClient := pb.NewAdminClient(clientConn)
+
+	var behaviors *pb.ByzantineBehaviors
+	if len(args) == 0 {
+		behaviors, err = serverClient.GetByzantine(context.Background(), &google_protobuf.Empty{})
+	} else {
+		behaviors, err = serverClient.SetByzantine(context.Background(), &pb.ByzantineBehaviors{Behaviors: args})
+	}
+	if err != nil {
+		return
+	}
+	fmt.Println(behaviors)
+	return nil
+}
+
+func stateTransfer(args []string) (err error) {
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return
+	}
+
+	serverClient := pb.NewAdminClient(clientConn)
+
+	var status *pb.StateTransferStatus
+	action := ""
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "":
+		status, err = serverClient.GetStateTransferStatus(context.Background(), &google_protobuf.Empty{})
+	case "pause":
+		status, err = serverClient.PauseStateTransfer(context.Background(), &google_protobuf.Empty{})
+	case "resume":
+		status, err = serverClient.ResumeStateTransfer(context.Background(), &google_protobuf.Empty{})
+	case "cancel":
+		status, err = serverClient.CancelStateTransfer(context.Background(), &google_protobuf.Empty{})
+	case "pin":
+		peers := &pb.StateTransferPeers{}
+		for _, name := range args[1:] {
+			peers.Peers = append(peers.Peers, &pb.PeerID{Name: name})
+		}
+		status, err = serverClient.PinStateTransferPeers(context.Background(), peers)
+	default:
+		return fmt.Errorf("Unknown state transfer action %s", action)
+	}
+	if err != nil {
+		return
+	}
+	fmt.Println(status)
+	return nil
+}
+
 // login confirms the enrollmentID and secret password of the client with the
 // CA and stores the enrollment certificate and key in the Devops server.
 func login(args []string) (err error) {
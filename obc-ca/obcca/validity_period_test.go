@@ -318,7 +318,8 @@ func startOpenchain(t *testing.T) error {
 	pb.RegisterPeerServer(grpcServer, peerServer)
 
 	// Register the Admin server
-	pb.RegisterAdminServer(grpcServer, openchain.NewAdminServer())
+	adminServer := openchain.NewAdminServer()
+	pb.RegisterAdminServer(grpcServer, adminServer)
 
 	// Register ChaincodeSupport server...
 	// TODO : not the "DefaultChain" ... we have to revisit when we do multichain
@@ -345,7 +346,7 @@ func startOpenchain(t *testing.T) error {
 	pb.RegisterOpenchainServer(grpcServer, serverOpenchain)
 
 	// Create and register the REST service
-	go rest.StartOpenchainRESTServer(serverOpenchain, serverDevops)
+	go rest.StartOpenchainRESTServer(serverOpenchain, serverDevops, adminServer)
 
 	rootNode, err := openchain.GetRootNode()
 	if err != nil {
@@ -20,6 +20,7 @@ under the License.
 package openchain
 
 import (
+	"fmt"
 	"runtime"
 	"time"
 
@@ -29,6 +30,8 @@ import (
 
 	google_protobuf "google/protobuf"
 
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/openchain/peer"
 	pb "github.com/hyperledger-incubator/obc-peer/protos"
 )
 
@@ -42,6 +45,29 @@ func NewAdminServer() *ServerAdmin {
 
 // ServerAdmin implementation of the Admin service for the Peer
 type ServerAdmin struct {
+	consenter func() consensus.Consenter
+	peer      *peer.PeerImpl
+}
+
+// SetConsenter hands the Admin service how to get the consenter of a
+// validating peer, so that it can be inspected and its byzantine behaviors
+// changed. The consenter is only got when the Admin service needs it.
+func (s *ServerAdmin) SetConsenter(consenter func() consensus.Consenter) {
+	s.consenter = consenter
+}
+
+// getConsenter returns the consenter of the peer, nil if it has none
+func (s *ServerAdmin) getConsenter() consensus.Consenter {
+	if s.consenter == nil {
+		return nil
+	}
+	return s.consenter()
+}
+
+// SetPeer hands the peer to the Admin service, so that it can report how
+// forwarding transactions to the validators goes
+func (s *ServerAdmin) SetPeer(peer *peer.PeerImpl) {
+	s.peer = peer
 }
 
 func worker(id int, die chan struct{}) {
@@ -85,3 +111,104 @@ func (*ServerAdmin) StopServer(context.Context, *google_protobuf.Empty) (*pb.Ser
 	log.Debug("returning status: %s", status)
 	return status, nil
 }
+
+// GetConsensusStatus reports the internal state of the consenter
+func (s *ServerAdmin) GetConsensusStatus(context.Context, *google_protobuf.Empty) (*pb.ConsensusStatus, error) {
+	inspector, ok := s.getConsenter().(consensus.Inspector)
+	if !ok {
+		return nil, fmt.Errorf("Consenter does not report its status")
+	}
+	return inspector.GetStatus()
+}
+
+// GetForwardingStatus reports the health of the validators the peer
+// forwards transactions to
+func (s *ServerAdmin) GetForwardingStatus(context.Context, *google_protobuf.Empty) (*pb.ForwardingStatus, error) {
+	if s.peer == nil {
+		return nil, fmt.Errorf("Peer does not forward transactions")
+	}
+	return s.peer.GetForwardingStatus(), nil
+}
+
+// GetByzantine reports the byzantine behaviors of the consenter
+func (s *ServerAdmin) GetByzantine(context.Context, *google_protobuf.Empty) (*pb.ByzantineBehaviors, error) {
+	byzantine, ok := s.getConsenter().(consensus.ByzantineTester)
+	if !ok {
+		return nil, fmt.Errorf("Consenter does not support byzantine behaviors")
+	}
+	return &pb.ByzantineBehaviors{Behaviors: byzantine.GetByzantine()}, nil
+}
+
+// SetByzantine replaces the byzantine behaviors of the consenter
+func (s *ServerAdmin) SetByzantine(ctx context.Context, behaviors *pb.ByzantineBehaviors) (*pb.ByzantineBehaviors, error) {
+	byzantine, ok := s.getConsenter().(consensus.ByzantineTester)
+	if !ok {
+		return nil, fmt.Errorf("Consenter does not support byzantine behaviors")
+	}
+	if err := byzantine.SetByzantine(behaviors.Behaviors); err != nil {
+		return nil, err
+	}
+	log.Warning("Byzantine behaviors set to %v", behaviors.Behaviors)
+	return s.GetByzantine(ctx, &google_protobuf.Empty{})
+}
+
+// GetStateTransferStatus reports the progress of the state transfer of the consenter
+func (s *ServerAdmin) GetStateTransferStatus(context.Context, *google_protobuf.Empty) (*pb.StateTransferStatus, error) {
+	controller, err := s.stateTransfer()
+	if err != nil {
+		return nil, err
+	}
+	return controller.GetStateTransferStatus(), nil
+}
+
+// PauseStateTransfer stops the state transfer of the consenter from making requests
+func (s *ServerAdmin) PauseStateTransfer(context.Context, *google_protobuf.Empty) (*pb.StateTransferStatus, error) {
+	controller, err := s.stateTransfer()
+	if err != nil {
+		return nil, err
+	}
+	controller.PauseStateTransfer()
+	return controller.GetStateTransferStatus(), nil
+}
+
+// ResumeStateTransfer lets a paused state transfer of the consenter continue
+func (s *ServerAdmin) ResumeStateTransfer(context.Context, *google_protobuf.Empty) (*pb.StateTransferStatus, error) {
+	controller, err := s.stateTransfer()
+	if err != nil {
+		return nil, err
+	}
+	controller.ResumeStateTransfer()
+	return controller.GetStateTransferStatus(), nil
+}
+
+// CancelStateTransfer gives up on the target of the state transfer of the consenter
+func (s *ServerAdmin) CancelStateTransfer(context.Context, *google_protobuf.Empty) (*pb.StateTransferStatus, error) {
+	controller, err := s.stateTransfer()
+	if err != nil {
+		return nil, err
+	}
+	if err := controller.CancelStateTransfer(); err != nil {
+		return nil, err
+	}
+	log.Warning("State transfer cancelled")
+	return controller.GetStateTransferStatus(), nil
+}
+
+// PinStateTransferPeers restricts the state transfer of the consenter to the given peers
+func (s *ServerAdmin) PinStateTransferPeers(ctx context.Context, peers *pb.StateTransferPeers) (*pb.StateTransferStatus, error) {
+	controller, err := s.stateTransfer()
+	if err != nil {
+		return nil, err
+	}
+	controller.PinStateTransferPeers(peers.Peers)
+	log.Warning("State transfer pinned to peers %v", peers.Peers)
+	return controller.GetStateTransferStatus(), nil
+}
+
+func (s *ServerAdmin) stateTransfer() (consensus.StateTransferController, error) {
+	transferrer, ok := s.getConsenter().(consensus.StateTransferrer)
+	if !ok {
+		return nil, fmt.Errorf("Consenter does not transfer state")
+	}
+	return transferrer.StateTransfer(), nil
+}
@@ -35,6 +35,9 @@ import (
 var (
 	// ErrNotFound is returned if a requested resource does not exist
 	ErrNotFound = errors.New("openchain: resource not found")
+	// ErrLightMode is returned for requests which need the full chain or
+	// state, when the peer runs in light mode
+	ErrLightMode = errors.New("openchain: not available in light mode")
 )
 
 // PeerInfo
@@ -42,6 +45,31 @@ type PeerInfo interface {
 	GetPeers() (*pb.PeersMessage, error)
 }
 
+// DiscoveryInfo is implemented by peers which remember the peers they
+// discovered
+type DiscoveryInfo interface {
+	GetDiscoveredPeers() []*pb.DiscoveredPeer
+}
+
+// ReplyInfo is implemented by peers which collect the replies of validators
+// to the transactions they forward
+type ReplyInfo interface {
+	GetReplyCertificate(txUUID string) *pb.TransactionReplyCertificate
+}
+
+// LightInfo is implemented by peers which can run in light mode. A light
+// peer holds only the block headers, anchored to checkpoint certificates,
+// and answers with blocks, transactions and state fetched from full peers
+// and verified against the headers.
+type LightInfo interface {
+	LightMode() bool
+	GetVerifiedCheckpointCertificate() (*pb.CheckpointCertificate, error)
+	GetVerifiedBlockchainInfo() (*pb.BlockchainInfo, error)
+	GetVerifiedBlockByNumber(blockNumber uint64) (*pb.Block, error)
+	GetVerifiedTransactionByUUID(txUUID string) (*pb.Transaction, error)
+	GetVerifiedState(chaincodeID string, key string) ([]byte, error)
+}
+
 // ServerOpenchain defines the Openchain server object, which holds the
 // Ledger data structure and the pointer to the peerServer.
 type ServerOpenchain struct {
@@ -75,10 +103,27 @@ func NewOpenchainServerWithPeerInfo(peerServer PeerInfo) (*ServerOpenchain, erro
 	return s, nil
 }
 
+// light returns the peer if it runs in light mode, nil otherwise
+func (s *ServerOpenchain) light() LightInfo {
+	if light, ok := s.peerInfo.(LightInfo); ok && light.LightMode() {
+		return light
+	}
+	return nil
+}
+
 // GetBlockchainInfo returns information about the blockchain ledger such as
 // height, current block hash, and previous block hash.
 func (s *ServerOpenchain) GetBlockchainInfo(ctx context.Context, e *google_protobuf1.Empty) (*pb.BlockchainInfo, error) {
-	blockchainInfo, err := s.ledger.GetBlockchainInfo()
+	var blockchainInfo *pb.BlockchainInfo
+	var err error
+	if light := s.light(); light != nil {
+		blockchainInfo, err = light.GetVerifiedBlockchainInfo()
+	} else {
+		blockchainInfo, err = s.ledger.GetBlockchainInfo()
+	}
+	if err != nil {
+		return nil, err
+	}
 	if blockchainInfo.Height == 0 {
 		return nil, fmt.Errorf("No blocks in blockchain.")
 	}
@@ -88,7 +133,13 @@ func (s *ServerOpenchain) GetBlockchainInfo(ctx context.Context, e *google_proto
 // GetBlockByNumber returns the data contained within a specific block in the
 // blockchain. The genesis block is block zero.
 func (s *ServerOpenchain) GetBlockByNumber(ctx context.Context, num *pb.BlockNumber) (*pb.Block, error) {
-	block, err := s.ledger.GetBlockByNumber(num.Number)
+	var block *pb.Block
+	var err error
+	if light := s.light(); light != nil {
+		block, err = light.GetVerifiedBlockByNumber(num.Number)
+	} else {
+		block, err = s.ledger.GetBlockByNumber(num.Number)
+	}
 	if err != nil {
 		switch err {
 		case ledger.ErrOutOfBounds:
@@ -127,6 +178,13 @@ func (s *ServerOpenchain) GetBlockByNumber(ctx context.Context, num *pb.BlockNum
 func (s *ServerOpenchain) GetBlockCount(ctx context.Context, e *google_protobuf1.Empty) (*pb.BlockCount, error) {
 	// Total number of blocks in the blockchain.
 	size := s.ledger.GetBlockchainSize()
+	if light := s.light(); light != nil {
+		blockchainInfo, err := light.GetVerifiedBlockchainInfo()
+		if err != nil {
+			return nil, err
+		}
+		size = blockchainInfo.Height
+	}
 
 	// Check the number of blocks in the blockchain. If the blockchain is empty,
 	// return error. There will always be at least one block in the blockchain,
@@ -139,14 +197,46 @@ func (s *ServerOpenchain) GetBlockCount(ctx context.Context, e *google_protobuf1
 	return nil, fmt.Errorf("No blocks in blockchain.")
 }
 
-// GetState returns the value for a particular chaincode ID and key
+// GetLatestCheckpointCertificate returns the most recent stable checkpoint
+// certificate, which light clients use to verify the chain head. In light
+// mode, it is the certificate the synced headers are anchored to.
+func (s *ServerOpenchain) GetLatestCheckpointCertificate(ctx context.Context, e *google_protobuf1.Empty) (*pb.CheckpointCertificate, error) {
+	var cert *pb.CheckpointCertificate
+	var err error
+	if light := s.light(); light != nil {
+		cert, err = light.GetVerifiedCheckpointCertificate()
+	} else {
+		cert, err = s.ledger.GetLatestCheckpointCertificate()
+	}
+	if err != nil {
+		switch err {
+		case ledger.ErrResourceNotFound:
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("Error retrieving checkpoint certificate from ledger: %s", err)
+		}
+	}
+	return cert, nil
+}
+
+// GetState returns the value for a particular chaincode ID and key. In
+// light mode, the value is the one in the state of the last synced header.
 func (s *ServerOpenchain) GetState(ctx context.Context, chaincodeID, key string) ([]byte, error) {
+	if light := s.light(); light != nil {
+		return light.GetVerifiedState(chaincodeID, key)
+	}
 	return s.ledger.GetState(chaincodeID, key, true)
 }
 
 // GetTransactionByUUID returns a transaction matching the specified UUID
 func (s *ServerOpenchain) GetTransactionByUUID(ctx context.Context, txUUID string) (*pb.Transaction, error) {
-	transaction, err := s.ledger.GetTransactionByUUID(txUUID)
+	var transaction *pb.Transaction
+	var err error
+	if light := s.light(); light != nil {
+		transaction, err = light.GetVerifiedTransactionByUUID(txUUID)
+	} else {
+		transaction, err = s.ledger.GetTransactionByUUID(txUUID)
+	}
 	if err != nil {
 		switch err {
 		case ledger.ErrResourceNotFound:
@@ -158,7 +248,55 @@ func (s *ServerOpenchain) GetTransactionByUUID(ctx context.Context, txUUID strin
 	return transaction, nil
 }
 
-// GetPeers returns a list of all peer nodes currently connected to the target peer.
+// GetTransactionResult returns the outcome of the transaction matching the
+// specified UUID. A transaction which failed to execute or was rejected has
+// an error result recorded, and may not be part of any block; a committed
+// transaction without such a result succeeded. The block hash commits to
+// the error code of a result, not to its error string, which is the one of
+// this peer.
+func (s *ServerOpenchain) GetTransactionResult(ctx context.Context, txUUID string) (*pb.TransactionResult, error) {
+	if s.light() != nil {
+		return nil, ErrLightMode
+	}
+	// a committed transaction succeeded, even if a duplicate was rejected
+	if _, err := s.ledger.GetTransactionByUUID(txUUID); err == nil {
+		return &pb.TransactionResult{Uuid: txUUID}, nil
+	}
+	result, err := s.ledger.GetTransactionResultByUUID(txUUID)
+	if err != nil {
+		switch err {
+		case ledger.ErrResourceNotFound:
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("Error retrieving transaction result from blockchain: %s", err)
+		}
+	}
+	return result, nil
+}
+
+// GetTransactionReplies returns the f+1 matching replies of validators which
+// confirmed the outcome of a transaction this peer forwarded recently
+func (s *ServerOpenchain) GetTransactionReplies(ctx context.Context, txUUID string) (*pb.TransactionReplyCertificate, error) {
+	replies, ok := s.peerInfo.(ReplyInfo)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cert := replies.GetReplyCertificate(txUUID)
+	if cert == nil {
+		return nil, ErrNotFound
+	}
+	return cert, nil
+}
+
+// GetPeers returns a list of all peer nodes currently connected to the target
+// peer, and what the target peer knows about the peers it discovered.
 func (s *ServerOpenchain) GetPeers(ctx context.Context, e *google_protobuf1.Empty) (*pb.PeersMessage, error) {
-	return s.peerInfo.GetPeers()
+	peers, err := s.peerInfo.GetPeers()
+	if err != nil {
+		return nil, err
+	}
+	if discovery, ok := s.peerInfo.(DiscoveryInfo); ok {
+		peers.Discovered = discovery.GetDiscoveredPeers()
+	}
+	return peers, nil
 }
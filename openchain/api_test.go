@@ -438,3 +438,37 @@ func buildTestLedger2(ledger *ledger.Ledger, t *testing.T) {
 func generateUUID(t *testing.T) string {
 	return util.GenerateUUID()
 }
+
+// lightPeerInfo runs in light mode, its headers anchored to cert
+type lightPeerInfo struct {
+	peerInfo
+	LightInfo
+	cert *protos.CheckpointCertificate
+}
+
+func (p *lightPeerInfo) LightMode() bool {
+	return true
+}
+
+func (p *lightPeerInfo) GetVerifiedCheckpointCertificate() (*protos.CheckpointCertificate, error) {
+	if p.cert == nil {
+		return nil, ledger.ErrResourceNotFound
+	}
+	return p.cert, nil
+}
+
+func TestServerOpenchain_API_GetLatestCheckpointCertificate_LightMode(t *testing.T) {
+	light := &lightPeerInfo{}
+	server, err := NewOpenchainServerWithPeerInfo(light)
+	if err != nil {
+		t.Fatalf("Error creating the Openchain server: %s", err)
+	}
+	if _, err := server.GetLatestCheckpointCertificate(context.Background(), &google_protobuf.Empty{}); err != ErrNotFound {
+		t.Fatalf("Expected no certificate before the headers are anchored, got %v", err)
+	}
+	light.cert = &protos.CheckpointCertificate{BlockNumber: 4, BlockHash: []byte("hash")}
+	cert, err := server.GetLatestCheckpointCertificate(context.Background(), &google_protobuf.Empty{})
+	if err != nil || cert != light.cert {
+		t.Fatalf("Expected the certificate the headers are anchored to, got %v: %v", cert, err)
+	}
+}
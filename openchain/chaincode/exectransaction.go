@@ -130,17 +130,19 @@ func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) (
 }
 
 //ExecuteTransactions - will execute transactions on the array one by one
-//will return an array of errors one for each transaction. If the execution
-//succeeded, array element will be nil. returns state hash
-func ExecuteTransactions(ctxt context.Context, cname ChainName, xacts []*pb.Transaction) ([]byte, []error) {
+//will return an array of results and an array of errors one for each
+//transaction. If the execution succeeded, the error element will be nil.
+//returns state hash
+func ExecuteTransactions(ctxt context.Context, cname ChainName, xacts []*pb.Transaction) ([]byte, [][]byte, []error) {
 	var chain = GetChain(cname)
 	if chain == nil {
 		// TODO: We should never get here, but otherwise a good reminder to better handle
 		panic(fmt.Sprintf("[ExecuteTransactions]Chain %s not found\n", cname))
 	}
+	results := make([][]byte, len(xacts))
 	errs := make([]error, len(xacts)+1)
 	for i, t := range xacts {
-		_, errs[i] = Execute(ctxt, chain, t)
+		results[i], errs[i] = Execute(ctxt, chain, t)
 	}
 	ledger, hasherr := ledger.GetLedger()
 	var statehash []byte
@@ -148,7 +150,7 @@ func ExecuteTransactions(ctxt context.Context, cname ChainName, xacts []*pb.Tran
 		statehash, hasherr = ledger.GetTempStateHash()
 	}
 	errs[len(errs)-1] = hasherr
-	return statehash, errs
+	return statehash, results, errs
 }
 
 // GetSecureContext returns the security context from the context object or error
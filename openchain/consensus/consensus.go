@@ -30,6 +30,63 @@ type Consenter interface {
 	RecvMsg(msg *pb.OpenchainMessage, senderHandle *pb.PeerID) error
 }
 
+// Inspector is implemented by consenters which can report their internal
+// state, e.g. to diagnose a stalled network
+type Inspector interface {
+	GetStatus() (*pb.ConsensusStatus, error)
+}
+
+// ByzantineTester is implemented by consenters which can be told to
+// intentionally misbehave, so that fault handling can be exercised on test networks
+type ByzantineTester interface {
+	SetByzantine(behaviors []string) error
+	GetByzantine() []string
+}
+
+// StateTransferController reports and steers the state transfer of a
+// validating peer. While paused, a transfer makes no requests. Cancelling
+// gives up on the current target, the transfer continues once consensus
+// supplies a new one. Pinned peers are the only ones asked for blocks and
+// state, until unpinned with an empty list
+type StateTransferController interface {
+	GetStateTransferStatus() *pb.StateTransferStatus
+	PauseStateTransfer()
+	ResumeStateTransfer()
+	CancelStateTransfer() error
+	PinStateTransferPeers(peerIDs []*pb.PeerID)
+}
+
+// StateTransferrer is implemented by consenters which can hand out the
+// controller of their state transfer
+type StateTransferrer interface {
+	StateTransfer() StateTransferController
+}
+
+// StatePersistor is implemented by stacks which can store consenter state
+// in the local DB of the peer, so that it survives a restart. Keys are
+// namespaced by the consenter, e.g. "noops.tx.1"
+type StatePersistor interface {
+	StoreState(key string, value []byte) error
+	ReadState(key string) ([]byte, error)
+	ReadStateSet(prefix string) (map[string][]byte, error)
+	DelState(key string) error
+}
+
+// TransactionFinder is implemented by stacks which can look up the
+// transactions and results committed to the blockchain, so that consenters
+// do not order a transaction again once it has been committed
+type TransactionFinder interface {
+	GetTransactionByUUID(uuid string) (*pb.Transaction, error)
+	GetTransactionResultByUUID(uuid string) (*pb.TransactionResult, error)
+}
+
+// CheckpointCertificateStore is implemented by stacks which can keep the
+// stable checkpoint certificates of the consenter in the ledger, from where
+// light clients fetch them to verify the chain head
+type CheckpointCertificateStore interface {
+	PutCheckpointCertificate(cert *pb.CheckpointCertificate) error
+}
+
 // Inquirer is used to retrieve info about the validating network
 type Inquirer interface {
 	GetNetworkInfo() (self *pb.PeerEndpoint, network []*pb.PeerEndpoint, err error)
@@ -53,6 +110,7 @@ type ReadOnlyLedger interface {
 	GetBlock(id uint64) (block *pb.Block, err error)
 	GetCurrentStateHash() (stateHash []byte, err error)
 	GetBlockchainSize() (uint64, error)
+	GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error)
 }
 
 // UtilLedger contains additional useful utility functions for interrogating the blockchain
@@ -77,10 +135,25 @@ type Ledger interface {
 	WritableLedger
 }
 
-// Executor is used to invoke transactions, potentially modifying the backing ledger
+// Error codes set in the TransactionResult of transactions which did not
+// complete successfully
+const (
+	TxErrorExecution uint32 = iota + 1 // the transaction failed during execution
+	TxErrorRejected                    // the transaction was excluded from the batch
+)
+
+// Executor is used to invoke transactions, potentially modifying the backing ledger.
+// A transaction which fails to execute has its state changes discarded, and
+// is left out of the committed block and recorded with an error result
+// instead. Execution is deterministic, so all replicas exclude the same
+// transactions. ExecTxs only returns an error if the transactions could not
+// be executed at all. RejectTxs records the results of transactions which the
+// consenter excluded from the batch without executing them. Results are not
+// aligned with the transactions of the block, they are keyed by UUID.
 type Executor interface {
 	BeginTxBatch(id interface{}) error
 	ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error)
+	RejectTxs(id interface{}, results []*pb.TransactionResult) error
 	CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error)
 	RollbackTxBatch(id interface{}) error
 	PreviewCommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error)
@@ -93,6 +166,18 @@ type RemoteLedgers interface {
 	GetRemoteStateDeltas(replicaID *pb.PeerID, start, finish uint64) (<-chan *pb.SyncStateDeltas, error)
 }
 
+// StateChunker is implemented by stacks whose state can be transferred in
+// chunks, each of which is verified on its own against the hash of the whole
+// state. GetRemoteStateChunk only returns the chunk if the state of the remote
+// replica has stateHash, unless stateHash is nil; otherwise the response has
+// no delta, and tells which block and state hash the replica has moved on to.
+// VerifyStateChunk returns the delta of a verified chunk, to be applied with
+// ApplyStateDelta
+type StateChunker interface {
+	GetRemoteStateChunk(replicaID *pb.PeerID, chunk uint64, stateHash []byte) (<-chan *pb.SyncStateChunk, error)
+	VerifyStateChunk(stateChunk *pb.SyncStateChunk, stateHash []byte) (*statemgmt.StateDelta, error)
+}
+
 // LedgerStack serves as interface to the blockchain-oriented activities, such as executing transactions, querying, and updating the ledger
 type LedgerStack interface {
 	Executor
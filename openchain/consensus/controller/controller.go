@@ -20,11 +20,14 @@ under the License.
 package controller
 
 import (
+	"strings"
+	"sync"
+
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
-	"strings"
 
 	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus/external"
 	"github.com/hyperledger-incubator/obc-peer/openchain/consensus/noops"
 	"github.com/hyperledger-incubator/obc-peer/openchain/consensus/obcpbft"
 )
@@ -35,12 +38,38 @@ func init() {
 	logger = logging.MustGetLogger("consensus/controller")
 }
 
-// NewConsenter constructs a Consenter object
-func NewConsenter(stack consensus.Stack) (consenter consensus.Consenter) {
+// The consenter of the peer, shared by the consensus handlers and the Admin
+// service
+var (
+	consenterLock sync.Mutex
+	consenter     consensus.Consenter
+)
+
+// GetConsenter returns the Consenter of the peer, which the first caller
+// creates on top of stack. If it cannot be created, the error is returned
+// and the next caller tries again.
+func GetConsenter(stack consensus.Stack) (consensus.Consenter, error) {
+	consenterLock.Lock()
+	defer consenterLock.Unlock()
+	if consenter == nil {
+		c, err := newConsenter(stack)
+		if err != nil {
+			return nil, err
+		}
+		consenter = c
+	}
+	return consenter, nil
+}
+
+// newConsenter constructs a Consenter object
+func newConsenter(stack consensus.Stack) (consenter consensus.Consenter, err error) {
 	plugin := strings.ToLower(viper.GetString("peer.validator.consensus"))
 	if plugin == "obcpbft" {
 		//logger.Info("Running with consensus plugin %s", plugin)
 		consenter = obcpbft.GetPlugin(stack)
+	} else if plugin == "external" {
+		//logger.Info("Running with external consensus plugin")
+		consenter, err = external.GetExternal(stack)
 	} else {
 		//logger.Info("Running with default consensus plugin (noops)")
 		consenter = noops.GetNoops(stack)
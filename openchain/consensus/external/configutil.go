@@ -17,51 +17,32 @@ specific language governing permissions and limitations
 under the License.
 */
 
-package noops
+package external
 
 import (
-	pb "github.com/hyperledger-incubator/obc-peer/protos"
-)
+	"fmt"
+	"strings"
 
-type txq struct {
-	i int
-	q []*pb.Transaction
-}
+	"github.com/spf13/viper"
+)
 
-func newTXQ(size int) *txq {
-	o := &txq{}
-	o.i = 0
-	if size < 1 {
-		size = 1
-	}
-	o.q = make([]*pb.Transaction, size)
-	return o
-}
+const configPrefix = "OPENCHAIN_EXTERNAL"
 
-func (o *txq) append(tx *pb.Transaction) {
-	if cap(o.q) > o.i {
-		o.q[o.i] = tx
-		o.i++
-	}
-}
+func loadConfig() (config *viper.Viper) {
+	config = viper.New()
 
-func (o *txq) getTXs() []*pb.Transaction {
-	length := o.i
-	o.i = 0
-	return o.q[:length]
-}
+	// for environment variables
+	config.SetEnvPrefix(configPrefix)
+	config.AutomaticEnv()
+	replacer := strings.NewReplacer(".", "_")
+	config.SetEnvKeyReplacer(replacer)
 
-func (o *txq) isFull() bool {
-	if cap(o.q) == o.i {
-		return true
+	config.SetConfigName("config")
+	config.AddConfigPath("./")
+	config.AddConfigPath("./openchain/consensus/external/")
+	err := config.ReadInConfig()
+	if err != nil {
+		panic(fmt.Errorf("Error reading %s plugin config: %s", configPrefix, err))
 	}
-	return false
-}
-
-func (o *txq) size() int {
-	return o.i
-}
-
-func (o *txq) reset() {
-	o.i = 0
+	return config
 }
@@ -0,0 +1,133 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package external
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/op/go-logging"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+var logger *logging.Logger // package-level logger
+
+func init() {
+	logger = logging.MustGetLogger("consensus/external")
+}
+
+// External is a plugin object implementing the consensus.Consenter interface
+// by forwarding every message to a consensus plugin running in another
+// process. The plugin reaches back into the peer through the ConsensusStack
+// service, which External serves on its own listener.
+type External struct {
+	stack     consensus.Stack
+	server    *grpc.Server
+	consenter pb.ExternalConsenterClient
+	timeout   time.Duration // for each call to the plugin, 0 for none
+}
+
+// Setting up a singleton EXTERNAL consenter
+var iExternal consensus.Consenter
+
+// GetExternal returns a singleton of EXTERNAL, or an error if it cannot be
+// created, in which case the next call tries again
+func GetExternal(c consensus.Stack) (consensus.Consenter, error) {
+	if iExternal == nil {
+		consenter, err := newExternal(c)
+		if err != nil {
+			return nil, err
+		}
+		iExternal = consenter
+	}
+	return iExternal, nil
+}
+
+// newExternal is a constructor returning a consensus.Consenter object.
+func newExternal(c consensus.Stack) (consensus.Consenter, error) {
+	if logger.IsEnabledFor(logging.DEBUG) {
+		logger.Debug("Creating an EXTERNAL object")
+	}
+	config := loadConfig()
+	consenterAddress := config.GetString("consenter.address")
+	stackAddress := config.GetString("stack.address")
+
+	i := &External{stack: c, timeout: config.GetDuration("consenter.timeout")}
+
+	lis, err := net.Listen("tcp", stackAddress)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen on consensus stack address %s: %s", stackAddress, err)
+	}
+
+	// The plugin may start after the peer, so do not block waiting for it
+	conn, err := grpc.Dial(consenterAddress, grpc.WithInsecure())
+	if err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("Failed to dial external consenter at %s: %s", consenterAddress, err)
+	}
+	i.server = grpc.NewServer()
+	pb.RegisterConsensusStackServer(i.server, newStackServer(c))
+	go i.server.Serve(lis)
+	i.consenter = pb.NewExternalConsenterClient(conn)
+
+	logger.Info("EXTERNAL consensus type = %T", i)
+	logger.Info("EXTERNAL consenter address = %v", consenterAddress)
+	logger.Info("EXTERNAL stack address = %v", stackAddress)
+	return i, nil
+}
+
+// RecvMsg is called for OpenchainMessage_CHAIN_TRANSACTION and OpenchainMessage_CONSENSUS messages.
+func (i *External) RecvMsg(msg *pb.OpenchainMessage, senderHandle *pb.PeerID) error {
+	if logger.IsEnabledFor(logging.DEBUG) {
+		logger.Debug("Forwarding OpenchainMessage of type %s to external consenter", msg.Type)
+	}
+	req := &pb.ConsensusRecvMsgRequest{Msg: msg, SenderHandle: senderHandle}
+	ctx, cancel := i.callContext()
+	defer cancel()
+	if _, err := i.consenter.RecvMsg(ctx, req); err != nil {
+		return fmt.Errorf("External consenter failed to receive message: %v", err)
+	}
+	return nil
+}
+
+// GetStatus asks the external consenter to report its state
+func (i *External) GetStatus() (*pb.ConsensusStatus, error) {
+	ctx, cancel := i.callContext()
+	defer cancel()
+	status, err := i.consenter.GetStatus(ctx, empty)
+	if err != nil {
+		return nil, fmt.Errorf("External consenter failed to report its status: %v", err)
+	}
+	return status, nil
+}
+
+// callContext returns the context of a call to the plugin, which a hung
+// plugin cannot block past the configured timeout
+func (i *External) callContext() (context.Context, context.CancelFunc) {
+	if i.timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), i.timeout)
+}
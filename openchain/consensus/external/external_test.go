@@ -0,0 +1,225 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package external
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// serve serves on a local port what register registers, and returns a
+// connection to it
+func serve(t *testing.T, register func(*grpc.Server)) (*grpc.ClientConn, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	server := grpc.NewServer()
+	register(server)
+	go server.Serve(lis)
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("Error dialing: %s", err)
+	}
+	return conn, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+// testStack serves the state deltas it holds, and records broadcasts
+type testStack struct {
+	consensus.Stack
+	deltas    map[uint64]*statemgmt.StateDelta
+	broadcast []*pb.OpenchainMessage
+}
+
+func (s *testStack) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
+	return s.deltas[blockNumber], nil
+}
+
+func (s *testStack) Broadcast(msg *pb.OpenchainMessage, peerType pb.PeerEndpoint_Type) error {
+	s.broadcast = append(s.broadcast, msg)
+	return nil
+}
+
+// testPersistor is a testStack which keeps consenter state in memory
+type testPersistor struct {
+	testStack
+	state map[string][]byte
+}
+
+func (s *testPersistor) StoreState(key string, value []byte) error {
+	s.state[key] = value
+	return nil
+}
+
+func (s *testPersistor) ReadState(key string) ([]byte, error) {
+	return s.state[key], nil
+}
+
+func (s *testPersistor) ReadStateSet(prefix string) (map[string][]byte, error) {
+	set := make(map[string][]byte)
+	for key, value := range s.state {
+		if len(key) >= len(prefix) && key[:len(prefix)] == prefix {
+			set[key] = value
+		}
+	}
+	return set, nil
+}
+
+func (s *testPersistor) DelState(key string) error {
+	delete(s.state, key)
+	return nil
+}
+
+// testConsenter records the messages it receives, after waiting for delay
+type testConsenter struct {
+	delay    time.Duration
+	received chan *pb.OpenchainMessage
+}
+
+func (c *testConsenter) RecvMsg(msg *pb.OpenchainMessage, senderHandle *pb.PeerID) error {
+	time.Sleep(c.delay)
+	c.received <- msg
+	return nil
+}
+
+func TestRemoteStack(t *testing.T) {
+	delta := statemgmt.NewStateDelta()
+	delta.Set("chaincode", "key", []byte("value"), nil)
+	stack := &testStack{deltas: map[uint64]*statemgmt.StateDelta{1: delta}}
+	conn, stop := serve(t, func(server *grpc.Server) {
+		pb.RegisterConsensusStackServer(server, newStackServer(stack))
+	})
+	defer stop()
+	remote := NewRemoteStack(conn)
+
+	got, err := remote.GetStateDelta(1)
+	if err != nil || got == nil || string(got.Get("chaincode", "key").GetValue()) != "value" {
+		t.Fatalf("Expected the state delta of block 1, got %v, %v", got, err)
+	}
+	got, err = remote.GetStateDelta(0)
+	if err != nil || got == nil || !got.IsEmpty() {
+		t.Fatalf("Expected an empty state delta for block 0, got %v, %v", got, err)
+	}
+
+	msg := &pb.OpenchainMessage{Type: pb.OpenchainMessage_CONSENSUS, Payload: []byte("payload")}
+	if err := remote.Broadcast(msg, pb.PeerEndpoint_VALIDATOR); err != nil {
+		t.Fatalf("Error broadcasting: %s", err)
+	}
+	if len(stack.broadcast) != 1 || string(stack.broadcast[0].Payload) != "payload" {
+		t.Fatalf("Expected the message to be broadcast by the stack, got %v", stack.broadcast)
+	}
+}
+
+func TestExternalRecvMsg(t *testing.T) {
+	consenter := &testConsenter{received: make(chan *pb.OpenchainMessage, 1)}
+	conn, stop := serve(t, func(server *grpc.Server) {
+		pb.RegisterExternalConsenterServer(server, &consenterServer{consenter: consenter})
+	})
+	defer stop()
+	i := &External{consenter: pb.NewExternalConsenterClient(conn), timeout: 100 * time.Millisecond}
+
+	msg := &pb.OpenchainMessage{Type: pb.OpenchainMessage_CONSENSUS, Payload: []byte("payload")}
+	if err := i.RecvMsg(msg, &pb.PeerID{Name: "vp1"}); err != nil {
+		t.Fatalf("Error forwarding the message: %s", err)
+	}
+	if received := <-consenter.received; string(received.Payload) != "payload" {
+		t.Fatalf("Expected the plugin to receive the message, got %v", received)
+	}
+
+	// A hung plugin does not block the peer past the timeout
+	consenter.delay = time.Second
+	start := time.Now()
+	if err := i.RecvMsg(msg, &pb.PeerID{Name: "vp1"}); err == nil {
+		t.Fatalf("Expected forwarding to a hung plugin to time out")
+	}
+	if elapsed := time.Since(start); elapsed >= consenter.delay {
+		t.Fatalf("Expected RecvMsg to return after the timeout, took %s", elapsed)
+	}
+
+	if _, err := i.GetStatus(); err == nil {
+		t.Fatalf("Expected a plugin which does not report its status to fail")
+	}
+}
+
+func TestRemoteStackPersistor(t *testing.T) {
+	stack := &testPersistor{state: make(map[string][]byte)}
+	conn, stop := serve(t, func(server *grpc.Server) {
+		pb.RegisterConsensusStackServer(server, newStackServer(stack))
+	})
+	defer stop()
+	persistor, ok := NewRemoteStack(conn).(consensus.StatePersistor)
+	if !ok {
+		t.Fatalf("Expected the remote stack to persist state")
+	}
+
+	for _, key := range []string{"noops.tx.1", "noops.tx.2", "pbft.view"} {
+		if err := persistor.StoreState(key, []byte(key)); err != nil {
+			t.Fatalf("Error storing %s: %s", key, err)
+		}
+	}
+	if value, err := persistor.ReadState("pbft.view"); err != nil || string(value) != "pbft.view" {
+		t.Fatalf("Expected to read back pbft.view, got %q, %v", value, err)
+	}
+	if value, err := persistor.ReadState("missing"); err != nil || value != nil {
+		t.Fatalf("Expected nothing for a missing key, got %q, %v", value, err)
+	}
+	if err := persistor.DelState("noops.tx.2"); err != nil {
+		t.Fatalf("Error deleting noops.tx.2: %s", err)
+	}
+	set, err := persistor.ReadStateSet("noops.tx.")
+	if expected := map[string][]byte{"noops.tx.1": []byte("noops.tx.1")}; err != nil || !reflect.DeepEqual(set, expected) {
+		t.Fatalf("Expected %v, got %v, %v", expected, set, err)
+	}
+
+	// A stack which cannot persist state reports so to the plugin
+	conn, stop = serve(t, func(server *grpc.Server) {
+		pb.RegisterConsensusStackServer(server, newStackServer(&testStack{}))
+	})
+	defer stop()
+	if err := NewRemoteStack(conn).(consensus.StatePersistor).StoreState("noops.tx.1", nil); err == nil {
+		t.Fatalf("Expected storing state through a stack which cannot persist it to fail")
+	}
+}
+
+func TestNewExternalListenError(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	defer lis.Close()
+	os.Setenv("OPENCHAIN_EXTERNAL_STACK_ADDRESS", lis.Addr().String())
+	defer os.Unsetenv("OPENCHAIN_EXTERNAL_STACK_ADDRESS")
+
+	if consenter, err := newExternal(&testStack{}); err == nil {
+		t.Fatalf("Expected an error when the stack address is taken, got %v", consenter)
+	}
+}
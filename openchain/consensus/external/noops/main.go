@@ -0,0 +1,38 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Command noops is a reference external consensus plugin. It runs the NOOPS
+// consenter in its own process, talking to a validating peer configured with
+// peer.validator.consensus set to "external".
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus/external"
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus/noops"
+)
+
+func main() {
+	if err := external.ServeConsenter(noops.GetNoops); err != nil {
+		fmt.Fprintf(os.Stderr, "Error running external NOOPS consenter: %s\n", err)
+		os.Exit(1)
+	}
+}
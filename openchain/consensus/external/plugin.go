@@ -0,0 +1,381 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package external
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	google_protobuf "google/protobuf"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// ServeConsenter is the entry point of an external consensus plugin. It dials
+// the ConsensusStack of the validating peer, builds the plugin's consenter on
+// top of it, and serves the ExternalConsenter service until the listener fails
+func ServeConsenter(newConsenter func(consensus.Stack) consensus.Consenter) error {
+	config := loadConfig()
+	consenterAddress := config.GetString("consenter.address")
+	stackAddress := config.GetString("stack.address")
+	dialTimeout := config.GetDuration("stack.dialTimeout")
+
+	conn, err := grpc.Dial(stackAddress, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(dialTimeout))
+	if err != nil {
+		return fmt.Errorf("Failed to dial consensus stack at %s: %s", stackAddress, err)
+	}
+	defer conn.Close()
+
+	lis, err := net.Listen("tcp", consenterAddress)
+	if err != nil {
+		return fmt.Errorf("Failed to listen on consenter address %s: %s", consenterAddress, err)
+	}
+
+	server := grpc.NewServer()
+	pb.RegisterExternalConsenterServer(server, &consenterServer{consenter: newConsenter(NewRemoteStack(conn))})
+	logger.Info("Serving external consenter on %s using consensus stack at %s", consenterAddress, stackAddress)
+	return server.Serve(lis)
+}
+
+// consenterServer exposes a consensus.Consenter as an ExternalConsenter gRPC service
+type consenterServer struct {
+	consenter consensus.Consenter
+}
+
+// RecvMsg implements the ExternalConsenter service
+func (s *consenterServer) RecvMsg(ctx context.Context, req *pb.ConsensusRecvMsgRequest) (*google_protobuf.Empty, error) {
+	return empty, s.consenter.RecvMsg(req.Msg, req.SenderHandle)
+}
+
+// GetStatus implements the ExternalConsenter service
+func (s *consenterServer) GetStatus(ctx context.Context, req *google_protobuf.Empty) (*pb.ConsensusStatus, error) {
+	inspector, ok := s.consenter.(consensus.Inspector)
+	if !ok {
+		return nil, fmt.Errorf("Consenter %T does not report its status", s.consenter)
+	}
+	return inspector.GetStatus()
+}
+
+// remoteStack implements consensus.Stack and consensus.StatePersistor on top
+// of a ConsensusStack client
+type remoteStack struct {
+	client pb.ConsensusStackClient
+}
+
+var _ consensus.StatePersistor = (*remoteStack)(nil)
+
+// NewRemoteStack returns a consensus.Stack which forwards every call to the
+// ConsensusStack service reachable through conn
+func NewRemoteStack(conn *grpc.ClientConn) consensus.Stack {
+	return &remoteStack{client: pb.NewConsensusStackClient(conn)}
+}
+
+// batchID converts the opaque ids handed out by consensus plugins into the
+// string form carried on the wire
+func batchID(id interface{}) *pb.ConsensusBatchID {
+	return &pb.ConsensusBatchID{Id: fmt.Sprintf("%v", id)}
+}
+
+// GetNetworkInfo returns the PeerEndpoints of the current validator and the entire validating network
+func (r *remoteStack) GetNetworkInfo() (self *pb.PeerEndpoint, network []*pb.PeerEndpoint, err error) {
+	info, err := r.client.GetNetworkInfo(context.Background(), empty)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info.Self, info.Network, nil
+}
+
+// GetNetworkHandles returns the PeerIDs of the current validator and the entire validating network
+func (r *remoteStack) GetNetworkHandles() (self *pb.PeerID, network []*pb.PeerID, err error) {
+	handles, err := r.client.GetNetworkHandles(context.Background(), empty)
+	if err != nil {
+		return nil, nil, err
+	}
+	return handles.Self, handles.Network, nil
+}
+
+// Broadcast sends a message to all peers of the given type
+func (r *remoteStack) Broadcast(msg *pb.OpenchainMessage, peerType pb.PeerEndpoint_Type) error {
+	_, err := r.client.Broadcast(context.Background(), &pb.ConsensusBroadcastRequest{Msg: msg, PeerType: peerType})
+	return err
+}
+
+// Unicast sends a message to a specified receiver
+func (r *remoteStack) Unicast(msg *pb.OpenchainMessage, receiverHandle *pb.PeerID) error {
+	_, err := r.client.Unicast(context.Background(), &pb.ConsensusUnicastRequest{Msg: msg, ReceiverHandle: receiverHandle})
+	return err
+}
+
+// Sign a message with the validator's signing key
+func (r *remoteStack) Sign(msg []byte) ([]byte, error) {
+	sig, err := r.client.Sign(context.Background(), &pb.ConsensusSignRequest{Msg: msg})
+	if err != nil {
+		return nil, err
+	}
+	return sig.Signature, nil
+}
+
+// Verify that the given signature is valid under the given replicaID's verification key
+func (r *remoteStack) Verify(peerID *pb.PeerID, signature []byte, message []byte) error {
+	_, err := r.client.Verify(context.Background(), &pb.ConsensusVerifyRequest{PeerID: peerID, Signature: signature, Message: message})
+	return err
+}
+
+// BeginTxBatch starts a new transaction batch on the validator
+func (r *remoteStack) BeginTxBatch(id interface{}) error {
+	_, err := r.client.BeginTxBatch(context.Background(), batchID(id))
+	return err
+}
+
+// ExecTxs executes the transactions and returns the candidate state hash
+func (r *remoteStack) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error) {
+	hash, err := r.client.ExecTxs(context.Background(), &pb.ConsensusExecTxsRequest{Id: batchID(id).Id, Transactions: txs})
+	if err != nil {
+		return nil, err
+	}
+	return hash.Hash, nil
+}
+
+// RejectTxs records the results of transactions excluded from the batch
+func (r *remoteStack) RejectTxs(id interface{}, results []*pb.TransactionResult) error {
+	_, err := r.client.RejectTxs(context.Background(), &pb.ConsensusRejectTxsRequest{Id: batchID(id).Id, Results: results})
+	return err
+}
+
+// CommitTxBatch commits the current transaction batch
+func (r *remoteStack) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error) {
+	return r.client.CommitTxBatch(context.Background(), &pb.ConsensusCommitRequest{Id: batchID(id).Id, Metadata: metadata})
+}
+
+// RollbackTxBatch discards the current transaction batch
+func (r *remoteStack) RollbackTxBatch(id interface{}) error {
+	_, err := r.client.RollbackTxBatch(context.Background(), batchID(id))
+	return err
+}
+
+// PreviewCommitTxBatch retrieves a preview copy of the block that CommitTxBatch would produce
+func (r *remoteStack) PreviewCommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error) {
+	return r.client.PreviewCommitTxBatch(context.Background(), &pb.ConsensusCommitRequest{Id: batchID(id).Id, Metadata: metadata})
+}
+
+// GetBlock returns a block from the chain
+func (r *remoteStack) GetBlock(id uint64) (*pb.Block, error) {
+	return r.client.GetBlock(context.Background(), &pb.BlockNumber{Number: id})
+}
+
+// GetCurrentStateHash returns the current/temporary state hash
+func (r *remoteStack) GetCurrentStateHash() ([]byte, error) {
+	hash, err := r.client.GetCurrentStateHash(context.Background(), empty)
+	if err != nil {
+		return nil, err
+	}
+	return hash.Hash, nil
+}
+
+// GetBlockchainSize returns the current size of the blockchain
+func (r *remoteStack) GetBlockchainSize() (uint64, error) {
+	count, err := r.client.GetBlockchainSize(context.Background(), empty)
+	if err != nil {
+		return 0, err
+	}
+	return count.Count, nil
+}
+
+// GetStateDelta returns the state delta of the given block
+func (r *remoteStack) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
+	res, err := r.client.GetStateDelta(context.Background(), &pb.BlockNumber{Number: blockNumber})
+	if err != nil {
+		return nil, err
+	}
+	delta := statemgmt.NewStateDelta()
+	if res.Delta == nil {
+		return delta, nil
+	}
+	if err := delta.Unmarshal(res.Delta); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal state delta: %v", err)
+	}
+	return delta, nil
+}
+
+// HashBlock returns the hash of the included block
+func (r *remoteStack) HashBlock(block *pb.Block) ([]byte, error) {
+	hash, err := r.client.HashBlock(context.Background(), block)
+	if err != nil {
+		return nil, err
+	}
+	return hash.Hash, nil
+}
+
+// VerifyBlockchain checks the integrity of the blockchain between indices start and finish
+func (r *remoteStack) VerifyBlockchain(start, finish uint64) (uint64, error) {
+	res, err := r.client.VerifyBlockchain(context.Background(), &pb.SyncBlockRange{Start: start, End: finish})
+	if err != nil {
+		return finish, err
+	}
+	return res.Number, nil
+}
+
+// PutBlock inserts a raw block into the blockchain at the specified index
+func (r *remoteStack) PutBlock(blockNumber uint64, block *pb.Block) error {
+	_, err := r.client.PutBlock(context.Background(), &pb.ConsensusPutBlockRequest{BlockNumber: blockNumber, Block: block})
+	return err
+}
+
+// ApplyStateDelta applies a state delta to the current state
+func (r *remoteStack) ApplyStateDelta(id interface{}, delta *statemgmt.StateDelta) error {
+	_, err := r.client.ApplyStateDelta(context.Background(), &pb.ConsensusStateDelta{Id: batchID(id).Id, Delta: delta.Marshal()})
+	return err
+}
+
+// CommitStateDelta makes the result of ApplyStateDelta permanent
+func (r *remoteStack) CommitStateDelta(id interface{}) error {
+	_, err := r.client.CommitStateDelta(context.Background(), batchID(id))
+	return err
+}
+
+// RollbackStateDelta undoes the results of ApplyStateDelta
+func (r *remoteStack) RollbackStateDelta(id interface{}) error {
+	_, err := r.client.RollbackStateDelta(context.Background(), batchID(id))
+	return err
+}
+
+// EmptyState completely empties the state
+func (r *remoteStack) EmptyState() error {
+	_, err := r.client.EmptyState(context.Background(), empty)
+	return err
+}
+
+// StoreState stores a key,value pair in the local DB of the peer
+func (r *remoteStack) StoreState(key string, value []byte) error {
+	_, err := r.client.StoreState(context.Background(), &pb.ConsensusStateEntry{Key: key, Value: value})
+	return err
+}
+
+// ReadState retrieves a value from the local DB of the peer, nil if the key
+// is not present
+func (r *remoteStack) ReadState(key string) ([]byte, error) {
+	entry, err := r.client.ReadState(context.Background(), &pb.ConsensusStateKey{Key: key})
+	if err != nil {
+		return nil, err
+	}
+	if len(entry.Value) == 0 {
+		return nil, nil
+	}
+	return entry.Value, nil
+}
+
+// ReadStateSet retrieves all key,value pairs whose key starts with prefix
+func (r *remoteStack) ReadStateSet(prefix string) (map[string][]byte, error) {
+	set, err := r.client.ReadStateSet(context.Background(), &pb.ConsensusStateKey{Key: prefix})
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(set.Entries))
+	for _, entry := range set.Entries {
+		values[entry.Key] = entry.Value
+	}
+	return values, nil
+}
+
+// DelState removes a key from the local DB of the peer
+func (r *remoteStack) DelState(key string) error {
+	_, err := r.client.DelState(context.Background(), &pb.ConsensusStateKey{Key: key})
+	return err
+}
+
+// GetRemoteBlocks will return a channel to stream blocks from the desired replicaID
+func (r *remoteStack) GetRemoteBlocks(replicaID *pb.PeerID, start, finish uint64) (<-chan *pb.SyncBlocks, error) {
+	stream, err := r.client.GetRemoteBlocks(context.Background(), &pb.ConsensusRemoteRequest{
+		ReplicaID: replicaID,
+		Range:     &pb.SyncBlockRange{Start: start, End: finish},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *pb.SyncBlocks)
+	go func() {
+		defer close(c)
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF {
+					logger.Warning("Stream of remote blocks from %v ended: %v", replicaID, err)
+				}
+				return
+			}
+			c <- msg
+		}
+	}()
+	return c, nil
+}
+
+// GetRemoteStateSnapshot will return a channel to stream a state snapshot from the desired replicaID
+func (r *remoteStack) GetRemoteStateSnapshot(replicaID *pb.PeerID) (<-chan *pb.SyncStateSnapshot, error) {
+	stream, err := r.client.GetRemoteStateSnapshot(context.Background(), &pb.ConsensusRemoteRequest{ReplicaID: replicaID})
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *pb.SyncStateSnapshot)
+	go func() {
+		defer close(c)
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF {
+					logger.Warning("Stream of remote state snapshot from %v ended: %v", replicaID, err)
+				}
+				return
+			}
+			c <- msg
+		}
+	}()
+	return c, nil
+}
+
+// GetRemoteStateDeltas will return a channel to stream state deltas from the desired replicaID
+func (r *remoteStack) GetRemoteStateDeltas(replicaID *pb.PeerID, start, finish uint64) (<-chan *pb.SyncStateDeltas, error) {
+	stream, err := r.client.GetRemoteStateDeltas(context.Background(), &pb.ConsensusRemoteRequest{
+		ReplicaID: replicaID,
+		Range:     &pb.SyncBlockRange{Start: start, End: finish},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *pb.SyncStateDeltas)
+	go func() {
+		defer close(c)
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF {
+					logger.Warning("Stream of remote state deltas from %v ended: %v", replicaID, err)
+				}
+				return
+			}
+			c <- msg
+		}
+	}()
+	return c, nil
+}
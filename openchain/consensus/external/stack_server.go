@@ -0,0 +1,333 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package external
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+	google_protobuf "google/protobuf"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// stackServer exposes a consensus.Stack as a ConsensusStack gRPC service
+type stackServer struct {
+	stack consensus.Stack
+}
+
+func newStackServer(stack consensus.Stack) pb.ConsensusStackServer {
+	return &stackServer{stack: stack}
+}
+
+var empty = &google_protobuf.Empty{}
+
+// GetNetworkInfo implements the ConsensusStack service
+func (s *stackServer) GetNetworkInfo(ctx context.Context, e *google_protobuf.Empty) (*pb.ConsensusNetworkInfo, error) {
+	self, network, err := s.stack.GetNetworkInfo()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ConsensusNetworkInfo{Self: self, Network: network}, nil
+}
+
+// GetNetworkHandles implements the ConsensusStack service
+func (s *stackServer) GetNetworkHandles(ctx context.Context, e *google_protobuf.Empty) (*pb.ConsensusNetworkHandles, error) {
+	self, network, err := s.stack.GetNetworkHandles()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ConsensusNetworkHandles{Self: self, Network: network}, nil
+}
+
+// Broadcast implements the ConsensusStack service
+func (s *stackServer) Broadcast(ctx context.Context, req *pb.ConsensusBroadcastRequest) (*google_protobuf.Empty, error) {
+	return empty, s.stack.Broadcast(req.Msg, req.PeerType)
+}
+
+// Unicast implements the ConsensusStack service
+func (s *stackServer) Unicast(ctx context.Context, req *pb.ConsensusUnicastRequest) (*google_protobuf.Empty, error) {
+	return empty, s.stack.Unicast(req.Msg, req.ReceiverHandle)
+}
+
+// Sign implements the ConsensusStack service
+func (s *stackServer) Sign(ctx context.Context, req *pb.ConsensusSignRequest) (*pb.ConsensusSignature, error) {
+	signature, err := s.stack.Sign(req.Msg)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ConsensusSignature{Signature: signature}, nil
+}
+
+// Verify implements the ConsensusStack service
+func (s *stackServer) Verify(ctx context.Context, req *pb.ConsensusVerifyRequest) (*google_protobuf.Empty, error) {
+	return empty, s.stack.Verify(req.PeerID, req.Signature, req.Message)
+}
+
+// BeginTxBatch implements the ConsensusStack service
+func (s *stackServer) BeginTxBatch(ctx context.Context, req *pb.ConsensusBatchID) (*google_protobuf.Empty, error) {
+	return empty, s.stack.BeginTxBatch(req.Id)
+}
+
+// ExecTxs implements the ConsensusStack service
+func (s *stackServer) ExecTxs(ctx context.Context, req *pb.ConsensusExecTxsRequest) (*pb.ConsensusStateHash, error) {
+	hash, err := s.stack.ExecTxs(req.Id, req.Transactions)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ConsensusStateHash{Hash: hash}, nil
+}
+
+// RejectTxs implements the ConsensusStack service
+func (s *stackServer) RejectTxs(ctx context.Context, req *pb.ConsensusRejectTxsRequest) (*google_protobuf.Empty, error) {
+	return empty, s.stack.RejectTxs(req.Id, req.Results)
+}
+
+// CommitTxBatch implements the ConsensusStack service
+func (s *stackServer) CommitTxBatch(ctx context.Context, req *pb.ConsensusCommitRequest) (*pb.Block, error) {
+	return s.stack.CommitTxBatch(req.Id, req.Metadata)
+}
+
+// RollbackTxBatch implements the ConsensusStack service
+func (s *stackServer) RollbackTxBatch(ctx context.Context, req *pb.ConsensusBatchID) (*google_protobuf.Empty, error) {
+	return empty, s.stack.RollbackTxBatch(req.Id)
+}
+
+// PreviewCommitTxBatch implements the ConsensusStack service
+func (s *stackServer) PreviewCommitTxBatch(ctx context.Context, req *pb.ConsensusCommitRequest) (*pb.Block, error) {
+	return s.stack.PreviewCommitTxBatch(req.Id, req.Metadata)
+}
+
+// GetBlock implements the ConsensusStack service
+func (s *stackServer) GetBlock(ctx context.Context, req *pb.BlockNumber) (*pb.Block, error) {
+	return s.stack.GetBlock(req.Number)
+}
+
+// GetCurrentStateHash implements the ConsensusStack service
+func (s *stackServer) GetCurrentStateHash(ctx context.Context, e *google_protobuf.Empty) (*pb.ConsensusStateHash, error) {
+	hash, err := s.stack.GetCurrentStateHash()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ConsensusStateHash{Hash: hash}, nil
+}
+
+// GetBlockchainSize implements the ConsensusStack service
+func (s *stackServer) GetBlockchainSize(ctx context.Context, e *google_protobuf.Empty) (*pb.BlockCount, error) {
+	size, err := s.stack.GetBlockchainSize()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.BlockCount{Count: size}, nil
+}
+
+// GetStateDelta implements the ConsensusStack service
+func (s *stackServer) GetStateDelta(ctx context.Context, req *pb.BlockNumber) (*pb.ConsensusStateDelta, error) {
+	delta, err := s.stack.GetStateDelta(req.Number)
+	if err != nil {
+		return nil, err
+	}
+	if delta == nil {
+		return &pb.ConsensusStateDelta{}, nil
+	}
+	return &pb.ConsensusStateDelta{Delta: delta.Marshal()}, nil
+}
+
+// HashBlock implements the ConsensusStack service
+func (s *stackServer) HashBlock(ctx context.Context, block *pb.Block) (*pb.ConsensusStateHash, error) {
+	hash, err := s.stack.HashBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ConsensusStateHash{Hash: hash}, nil
+}
+
+// VerifyBlockchain implements the ConsensusStack service
+func (s *stackServer) VerifyBlockchain(ctx context.Context, req *pb.SyncBlockRange) (*pb.BlockNumber, error) {
+	number, err := s.stack.VerifyBlockchain(req.Start, req.End)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.BlockNumber{Number: number}, nil
+}
+
+// PutBlock implements the ConsensusStack service
+func (s *stackServer) PutBlock(ctx context.Context, req *pb.ConsensusPutBlockRequest) (*google_protobuf.Empty, error) {
+	return empty, s.stack.PutBlock(req.BlockNumber, req.Block)
+}
+
+// ApplyStateDelta implements the ConsensusStack service
+func (s *stackServer) ApplyStateDelta(ctx context.Context, req *pb.ConsensusStateDelta) (*google_protobuf.Empty, error) {
+	delta := statemgmt.NewStateDelta()
+	if err := delta.Unmarshal(req.Delta); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal state delta: %v", err)
+	}
+	return empty, s.stack.ApplyStateDelta(req.Id, delta)
+}
+
+// CommitStateDelta implements the ConsensusStack service
+func (s *stackServer) CommitStateDelta(ctx context.Context, req *pb.ConsensusBatchID) (*google_protobuf.Empty, error) {
+	return empty, s.stack.CommitStateDelta(req.Id)
+}
+
+// RollbackStateDelta implements the ConsensusStack service
+func (s *stackServer) RollbackStateDelta(ctx context.Context, req *pb.ConsensusBatchID) (*google_protobuf.Empty, error) {
+	return empty, s.stack.RollbackStateDelta(req.Id)
+}
+
+// EmptyState implements the ConsensusStack service
+func (s *stackServer) EmptyState(ctx context.Context, e *google_protobuf.Empty) (*google_protobuf.Empty, error) {
+	return empty, s.stack.EmptyState()
+}
+
+func remoteRange(req *pb.ConsensusRemoteRequest) (start, finish uint64) {
+	if req.Range == nil {
+		return 0, 0
+	}
+	return req.Range.Start, req.Range.End
+}
+
+// GetRemoteBlocks implements the ConsensusStack service, streaming until the
+// stack closes the channel or the plugin goes away
+func (s *stackServer) GetRemoteBlocks(req *pb.ConsensusRemoteRequest, stream pb.ConsensusStack_GetRemoteBlocksServer) error {
+	start, finish := remoteRange(req)
+	blocks, err := s.stack.GetRemoteBlocks(req.ReplicaID, start, finish)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case msg, ok := <-blocks:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// GetRemoteStateSnapshot implements the ConsensusStack service, streaming until the
+// stack closes the channel or the plugin goes away
+func (s *stackServer) GetRemoteStateSnapshot(req *pb.ConsensusRemoteRequest, stream pb.ConsensusStack_GetRemoteStateSnapshotServer) error {
+	pieces, err := s.stack.GetRemoteStateSnapshot(req.ReplicaID)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case msg, ok := <-pieces:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// GetRemoteStateDeltas implements the ConsensusStack service, streaming until the
+// stack closes the channel or the plugin goes away
+func (s *stackServer) GetRemoteStateDeltas(req *pb.ConsensusRemoteRequest, stream pb.ConsensusStack_GetRemoteStateDeltasServer) error {
+	start, finish := remoteRange(req)
+	deltas, err := s.stack.GetRemoteStateDeltas(req.ReplicaID, start, finish)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case msg, ok := <-deltas:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// persistor returns the stack as a consensus.StatePersistor, or an error if
+// it cannot persist state
+func (s *stackServer) persistor() (consensus.StatePersistor, error) {
+	persistor, ok := s.stack.(consensus.StatePersistor)
+	if !ok {
+		return nil, fmt.Errorf("Stack %T cannot persist state", s.stack)
+	}
+	return persistor, nil
+}
+
+// StoreState implements the ConsensusStack service
+func (s *stackServer) StoreState(ctx context.Context, req *pb.ConsensusStateEntry) (*google_protobuf.Empty, error) {
+	persistor, err := s.persistor()
+	if err != nil {
+		return nil, err
+	}
+	return empty, persistor.StoreState(req.Key, req.Value)
+}
+
+// ReadState implements the ConsensusStack service
+func (s *stackServer) ReadState(ctx context.Context, req *pb.ConsensusStateKey) (*pb.ConsensusStateEntry, error) {
+	persistor, err := s.persistor()
+	if err != nil {
+		return nil, err
+	}
+	value, err := persistor.ReadState(req.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ConsensusStateEntry{Key: req.Key, Value: value}, nil
+}
+
+// ReadStateSet implements the ConsensusStack service
+func (s *stackServer) ReadStateSet(ctx context.Context, req *pb.ConsensusStateKey) (*pb.ConsensusStateSet, error) {
+	persistor, err := s.persistor()
+	if err != nil {
+		return nil, err
+	}
+	values, err := persistor.ReadStateSet(req.Key)
+	if err != nil {
+		return nil, err
+	}
+	set := &pb.ConsensusStateSet{}
+	for key, value := range values {
+		set.Entries = append(set.Entries, &pb.ConsensusStateEntry{Key: key, Value: value})
+	}
+	return set, nil
+}
+
+// DelState implements the ConsensusStack service
+func (s *stackServer) DelState(ctx context.Context, req *pb.ConsensusStateKey) (*google_protobuf.Empty, error) {
+	persistor, err := s.persistor()
+	if err != nil {
+		return nil, err
+	}
+	return empty, persistor.DelState(req.Key)
+}
@@ -62,15 +62,38 @@ func NewConsensusHandler(coord peer.MessageHandlerCoordinator,
 		return nil, fmt.Errorf("Error creating PeerHandler: %s", err)
 	}
 
-	handler.consenter = controller.NewConsenter(NewHelper(coord))
+	handler.consenter, err = controller.GetConsenter(NewHelper(coord))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating consenter: %s", err)
+	}
 
 	return handler, nil
 }
 
 // HandleMessage handles the incoming Openchain messages for the Peer
 func (handler *ConsensusHandler) HandleMessage(msg *pb.OpenchainMessage) error {
+	switch msg.Type {
+	case pb.OpenchainMessage_CONSENSUS, pb.OpenchainMessage_CHAIN_TRANSACTION, pb.OpenchainMessage_CHAIN_QUERY, pb.OpenchainMessage_CHAIN_REPLY_REQUEST:
+		// The peerHandler only verifies the messages it handles itself
+		if verifier, ok := handler.peerHandler.(interface {
+			VerifyMessage(*pb.OpenchainMessage) error
+		}); ok {
+			if err := verifier.VerifyMessage(msg); err != nil {
+				return err
+			}
+		}
+	}
 	if msg.Type == pb.OpenchainMessage_CONSENSUS {
+		if auth, ok := handler.peerHandler.(interface {
+			Authenticated() bool
+		}); ok && !auth.Authenticated() {
+			return fmt.Errorf("Peer is not authenticated, cannot handle message (%s)", msg.Type)
+		}
 		senderPE, _ := handler.peerHandler.To()
+		if senderPE.Type != pb.PeerEndpoint_VALIDATOR {
+			logger.Warning("Ignoring %s from peer %s, which is not a validator", msg.Type, senderPE.ID)
+			return nil
+		}
 		return handler.consenter.RecvMsg(msg, senderPE.ID)
 	}
 	if msg.Type == pb.OpenchainMessage_CHAIN_TRANSACTION {
@@ -79,6 +102,9 @@ func (handler *ConsensusHandler) HandleMessage(msg *pb.OpenchainMessage) error {
 	if msg.Type == pb.OpenchainMessage_CHAIN_QUERY {
 		return handler.doChainQuery(msg)
 	}
+	if msg.Type == pb.OpenchainMessage_CHAIN_REPLY_REQUEST {
+		return handler.doReplyRequest(msg)
+	}
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debug("Did not handle message of type %s, passing on to next MessageHandler", msg.Type)
 	}
@@ -162,6 +188,15 @@ func (handler *ConsensusHandler) doChainQuery(msg *pb.OpenchainMessage) error {
 	return nil
 }
 
+func (handler *ConsensusHandler) doReplyRequest(msg *pb.OpenchainMessage) error {
+	request := &pb.TransactionReplyRequest{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		return fmt.Errorf("Error unmarshalling payload of received OpenchainMessage:%s.", msg.Type)
+	}
+	getReplyManager(handler.coordinator).request(request.Uuid, handler)
+	return nil
+}
+
 // SendMessage sends a message to the remote Peer through the stream
 func (handler *ConsensusHandler) SendMessage(msg *pb.OpenchainMessage) error {
 	logger.Debug("Sending to stream a message of type: %s", msg.Type)
@@ -175,6 +210,7 @@ func (handler *ConsensusHandler) SendMessage(msg *pb.OpenchainMessage) error {
 
 // Stop stops this MessageHandler, which then delegates to the contained PeerHandler to stop (and thus deregister this Peer)
 func (handler *ConsensusHandler) Stop() error {
+	getReplyManager(handler.coordinator).forget(handler)
 	err := handler.peerHandler.Stop() // deregister the handler
 	if err != nil {
 		return fmt.Errorf("Error stopping ConsensusHandler: %s", err)
@@ -197,7 +233,61 @@ func (handler *ConsensusHandler) RequestStateSnapshot() (<-chan *pb.SyncStateSna
 	return handler.peerHandler.RequestStateSnapshot()
 }
 
+// RequestStateChunk returns a chunk of the current state
+func (handler *ConsensusHandler) RequestStateChunk(chunk uint64, stateHash []byte) (<-chan *pb.SyncStateChunk, error) {
+	return handler.peerHandler.RequestStateChunk(chunk, stateHash)
+}
+
 // RequestStateDeltas returns state deltas for a block range
 func (handler *ConsensusHandler) RequestStateDeltas(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.SyncStateDeltas, error) {
 	return handler.peerHandler.RequestStateDeltas(syncBlockRange)
 }
+
+// Closed returns a channel which is closed when the chat with the peer has
+// to end, if the peerHandler closes chats
+func (handler *ConsensusHandler) Closed() <-chan struct{} {
+	if closer, ok := handler.peerHandler.(interface {
+		Closed() <-chan struct{}
+	}); ok {
+		return closer.Closed()
+	}
+	return nil
+}
+
+// DecodeMessage returns msg as the peer sent it before it was encoded for
+// the stream, or nil if msg is a chunk of a message still being received, if
+// the peerHandler encodes messages
+func (handler *ConsensusHandler) DecodeMessage(msg *pb.OpenchainMessage) (*pb.OpenchainMessage, error) {
+	if decoder, ok := handler.peerHandler.(interface {
+		DecodeMessage(*pb.OpenchainMessage) (*pb.OpenchainMessage, error)
+	}); ok {
+		return decoder.DecodeMessage(msg)
+	}
+	return msg, nil
+}
+
+// RequestBlockHeaders returns the headers of the blocks in a block range
+func (handler *ConsensusHandler) RequestBlockHeaders(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.SyncBlockHeaders, error) {
+	return handler.peerHandler.RequestBlockHeaders(syncBlockRange)
+}
+
+// RequestTransactionProof returns a transaction and the proof it is in its block
+func (handler *ConsensusHandler) RequestTransactionProof(uuid string) (<-chan *pb.TransactionProof, error) {
+	return handler.peerHandler.RequestTransactionProof(uuid)
+}
+
+// RequestCheckpointCertificate returns the latest stable checkpoint certificate
+func (handler *ConsensusHandler) RequestCheckpointCertificate() (<-chan *pb.SyncCheckpointCertificate, error) {
+	return handler.peerHandler.RequestCheckpointCertificate()
+}
+
+// Identity returns the identity under which the reputation of the peer is
+// kept, "" if it has none
+func (handler *ConsensusHandler) Identity() string {
+	if identified, ok := handler.peerHandler.(interface {
+		Identity() string
+	}); ok {
+		return identified.Identity()
+	}
+	return ""
+}
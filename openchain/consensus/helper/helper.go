@@ -40,6 +40,8 @@ type Helper struct {
 	secOn       bool
 	secHelper   crypto.Peer
 	curBatch    []*pb.Transaction // TODO, remove after issue 579
+	curResults  []*pb.TransactionResult
+	curReplies  []*pb.TransactionResult // outcome of every transaction, for the replies to clients
 }
 
 // NewHelper constructs the consensus helper object
@@ -150,23 +152,121 @@ func (h *Helper) BeginTxBatch(id interface{}) error {
 		return fmt.Errorf("Failed to begin transaction with the ledger: %v", err)
 	}
 	h.curBatch = nil // TODO, remove after issue 579
+	h.curResults = nil
+	h.curReplies = nil
 	return nil
 }
 
 // ExecTxs executes all the transactions listed in the txs array
-// one-by-one. If all the executions are successful, it returns
-// the candidate global state hash, and nil error array.
+// one-by-one. Transactions which fail have their state changes discarded,
+// and are left out of the block and recorded with an error result instead.
+// Transactions which were committed before are rejected. It returns the
+// candidate global state hash.
 func (h *Helper) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error) {
 	// TODO id is currently ignored, fix once the underlying implementation accepts id
 
+	// A non-validating peer may submit a transaction to several validators,
+	// only its first occurrence is executed
+	txs, rejected := rejectDuplicates(txs, h.isDuplicate)
+	h.curResults = append(h.curResults, rejected...)
+
 	// The secHelper is set during creat ChaincodeSupport, so we don't need this step
 	// cxt := context.WithValue(context.Background(), "security", h.coordinator.GetSecHelper())
-	// TODO return directly once underlying implementation no longer returns []error
-	res, _ := chaincode.ExecuteTransactions(context.Background(), chaincode.DefaultChain, txs)
-	h.curBatch = append(h.curBatch, txs...) // TODO, remove after issue 579
+	res, results, errs := chaincode.ExecuteTransactions(context.Background(), chaincode.DefaultChain, txs)
+	for i, tx := range txs {
+		if errs[i] != nil {
+			logger.Warning("Transaction %s failed to execute, rejecting it: %v", tx.Uuid, errs[i])
+			result := &pb.TransactionResult{
+				Uuid:      tx.Uuid,
+				ErrorCode: consensus.TxErrorExecution,
+				Error:     errs[i].Error(),
+			}
+			h.curResults = append(h.curResults, result)
+			h.curReplies = append(h.curReplies, result)
+			continue
+		}
+		h.curBatch = append(h.curBatch, tx) // TODO, remove after issue 579
+		h.curReplies = append(h.curReplies, &pb.TransactionResult{Uuid: tx.Uuid, Result: results[i]})
+	}
+	if err := errs[len(txs)]; err != nil {
+		return nil, fmt.Errorf("Failed to compute the state hash: %v", err)
+	}
 	return res, nil
 }
 
+// rejectDuplicates returns the transactions of txs which are not known
+// already and occur in txs for the first time, and the results of the others
+func rejectDuplicates(txs []*pb.Transaction, known func(uuid string) bool) ([]*pb.Transaction, []*pb.TransactionResult) {
+	var fresh []*pb.Transaction
+	var rejected []*pb.TransactionResult
+	seen := make(map[string]bool)
+	for _, tx := range txs {
+		if seen[tx.Uuid] || known(tx.Uuid) {
+			logger.Warning("Rejecting duplicate transaction %s", tx.Uuid)
+			rejected = append(rejected, &pb.TransactionResult{
+				Uuid:      tx.Uuid,
+				ErrorCode: consensus.TxErrorRejected,
+				Error:     "duplicate transaction",
+			})
+			continue
+		}
+		seen[tx.Uuid] = true
+		fresh = append(fresh, tx)
+	}
+	return fresh, rejected
+}
+
+// isDuplicate returns whether a transaction with the given uuid is part of
+// the current batch already, failed in it, or was committed before
+func (h *Helper) isDuplicate(uuid string) bool {
+	for _, tx := range h.curBatch {
+		if tx.Uuid == uuid {
+			return true
+		}
+	}
+	for _, result := range h.curResults {
+		if result.Uuid == uuid {
+			return true
+		}
+	}
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		logger.Error("Failed to get the ledger: %v", err)
+		return false
+	}
+	_, err = ledger.GetTransactionByUUID(uuid)
+	return err == nil
+}
+
+// GetTransactionByUUID returns the committed transaction with the given uuid
+func (h *Helper) GetTransactionByUUID(uuid string) (*pb.Transaction, error) {
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the ledger: %v", err)
+	}
+	return ledger.GetTransactionByUUID(uuid)
+}
+
+// GetTransactionResultByUUID returns the result committed for the
+// transaction with the given uuid
+func (h *Helper) GetTransactionResultByUUID(uuid string) (*pb.TransactionResult, error) {
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the ledger: %v", err)
+	}
+	return ledger.GetTransactionResultByUUID(uuid)
+}
+
+var _ consensus.TransactionFinder = (*Helper)(nil)
+
+// RejectTxs records the results of transactions which were excluded
+// from the current transaction-batch without being executed
+func (h *Helper) RejectTxs(id interface{}, results []*pb.TransactionResult) error {
+	h.curResults = append(h.curResults, results...)
+	h.curReplies = append(h.curReplies, results...)
+	return nil
+}
+
 // CommitTxBatch gets invoked when the current transaction-batch needs
 // to be committed. This function returns successfully iff the
 // transactions details and state changes (that may have happened
@@ -178,12 +278,15 @@ func (h *Helper) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, erro
 		return nil, fmt.Errorf("Failed to get the ledger: %v", err)
 	}
 	// TODO fix this one the ledger has been fixed to implement
-	if err := ledger.CommitTxBatch(id, h.curBatch, nil, metadata); err != nil {
+	if err := ledger.CommitTxBatch(id, h.curBatch, h.curResults, metadata); err != nil {
 		return nil, fmt.Errorf("Failed to commit transaction to the ledger: %v", err)
 	}
 
 	size := ledger.GetBlockchainSize()
+	getReplyManager(h.coordinator).committed(size-1, h.curReplies)
 	h.curBatch = nil // TODO, remove after issue 579
+	h.curResults = nil
+	h.curReplies = nil
 
 	block, err := ledger.GetBlockByNumber(size - 1)
 	if err != nil {
@@ -204,6 +307,8 @@ func (h *Helper) RollbackTxBatch(id interface{}) error {
 		return fmt.Errorf("Failed to rollback transaction with the ledger: %v", err)
 	}
 	h.curBatch = nil // TODO, remove after issue 579
+	h.curResults = nil
+	h.curReplies = nil
 	return nil
 }
 
@@ -217,7 +322,7 @@ func (h *Helper) PreviewCommitTxBatch(id interface{}, metadata []byte) (*pb.Bloc
 		return nil, fmt.Errorf("Failed to get the ledger: %v", err)
 	}
 	// TODO fix this once the underlying API is fixed
-	block, err := ledger.GetTXBatchPreviewBlock(id, h.curBatch, metadata)
+	block, err := ledger.GetTXBatchPreviewBlock(id, h.curBatch, h.curResults, metadata)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to commit transaction to the ledger: %v", err)
 	}
@@ -251,6 +356,15 @@ func (h *Helper) GetBlockchainSize() (uint64, error) {
 	return ledger.GetBlockchainSize(), nil
 }
 
+// GetStateDelta returns the state delta produced by the given block
+func (h *Helper) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the ledger :%v", err)
+	}
+	return ledger.GetStateDelta(blockNumber)
+}
+
 // HashBlock returns the hash of the included block, useful for mocking
 func (h *Helper) HashBlock(block *pb.Block) ([]byte, error) {
 	return block.GetHash()
@@ -346,6 +460,50 @@ func (h *Helper) GetRemoteStateSnapshot(replicaID *pb.PeerID) (<-chan *pb.SyncSt
 	return remoteLedger.RequestStateSnapshot()
 }
 
+// GetRemoteStateChunk will return a channel to receive a chunk of the state from the desired replicaID
+func (h *Helper) GetRemoteStateChunk(replicaID *pb.PeerID, chunk uint64, stateHash []byte) (<-chan *pb.SyncStateChunk, error) {
+	remoteLedger, err := h.getRemoteLedger(replicaID)
+	if nil != err {
+		return nil, err
+	}
+	return remoteLedger.RequestStateChunk(chunk, stateHash)
+}
+
+// VerifyStateChunk checks a state chunk received from another replica against the given state hash
+func (h *Helper) VerifyStateChunk(stateChunk *pb.SyncStateChunk, stateHash []byte) (*statemgmt.StateDelta, error) {
+	if nil == stateChunk.Request {
+		return nil, fmt.Errorf("State chunk does not say which chunk it is")
+	}
+	delta := &statemgmt.StateDelta{}
+	if err := delta.Unmarshal(stateChunk.Delta); nil != err {
+		return nil, fmt.Errorf("Could not unmarshal the delta of state chunk %d: %s", stateChunk.Request.Chunk, err)
+	}
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the ledger :%v", err)
+	}
+	numChunks, err := ledger.GetNumStateChunks()
+	if err != nil {
+		return nil, err
+	}
+	if stateChunk.NumChunks != numChunks {
+		return nil, fmt.Errorf("State chunk %d claims the state has %d chunks, but it has %d", stateChunk.Request.Chunk, stateChunk.NumChunks, numChunks)
+	}
+	if err := ledger.VerifyStateChunk(stateChunk.Request.Chunk, delta, stateChunk.Proof, stateHash); nil != err {
+		return nil, err
+	}
+	return delta, nil
+}
+
+// PutCheckpointCertificate stores a stable checkpoint certificate in the ledger
+func (h *Helper) PutCheckpointCertificate(cert *pb.CheckpointCertificate) error {
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return fmt.Errorf("Failed to get the ledger :%v", err)
+	}
+	return ledger.PutCheckpointCertificate(cert)
+}
+
 // GetRemoteStateDeltas will return a channel to stream a state snapshot deltas from the desired replicaID
 func (h *Helper) GetRemoteStateDeltas(replicaID *pb.PeerID, start, finish uint64) (<-chan *pb.SyncStateDeltas, error) {
 	remoteLedger, err := h.getRemoteLedger(replicaID)
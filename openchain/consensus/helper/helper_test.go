@@ -0,0 +1,49 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package helper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+func TestRejectDuplicates(t *testing.T) {
+	txs := []*pb.Transaction{{Uuid: "a"}, {Uuid: "b"}, {Uuid: "a"}, {Uuid: "c"}, {Uuid: "b"}}
+	committed := func(uuid string) bool { return uuid == "c" }
+
+	fresh, rejected := rejectDuplicates(txs, committed)
+	if len(fresh) != 2 || fresh[0] != txs[0] || fresh[1] != txs[1] {
+		t.Fatalf("Expected the first occurrences of a and b to be executed, got %v", fresh)
+	}
+	var uuids []string
+	for _, result := range rejected {
+		if result.ErrorCode != consensus.TxErrorRejected {
+			t.Fatalf("Expected duplicate %s to be rejected, got error code %d", result.Uuid, result.ErrorCode)
+		}
+		uuids = append(uuids, result.Uuid)
+	}
+	if expected := []string{"a", "c", "b"}; !reflect.DeepEqual(uuids, expected) {
+		t.Fatalf("Expected rejections of %v, got %v", expected, uuids)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package helper
+
+import (
+	"bytes"
+
+	"github.com/tecbot/gorocksdb"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/openchain/db"
+)
+
+// StoreState stores a key,value pair in the consensus part of the local DB
+func (h *Helper) StoreState(key string, value []byte) error {
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	return openchainDB.DB.PutCF(opt, openchainDB.PersistCF, []byte(key), value)
+}
+
+// DelState removes a key from the consensus part of the local DB
+func (h *Helper) DelState(key string) error {
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	return openchainDB.DB.DeleteCF(opt, openchainDB.PersistCF, []byte(key))
+}
+
+// ReadState retrieves a value from the consensus part of the local DB, nil
+// if the key is not present
+func (h *Helper) ReadState(key string) ([]byte, error) {
+	return db.GetDBHandle().GetFromPersistCF([]byte(key))
+}
+
+// ReadStateSet retrieves all key,value pairs whose key starts with prefix
+func (h *Helper) ReadStateSet(prefix string) (map[string][]byte, error) {
+	it := db.GetDBHandle().GetPersistCFIterator()
+	defer it.Close()
+
+	ret := make(map[string][]byte)
+	p := []byte(prefix)
+	for it.Seek(p); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key.Data(), p) {
+			key.Free()
+			break
+		}
+		value := it.Value()
+		ret[string(key.Data())] = append([]byte(nil), value.Data()...)
+		key.Free()
+		value.Free()
+	}
+	return ret, it.Err()
+}
+
+var _ consensus.StatePersistor = (*Helper)(nil)
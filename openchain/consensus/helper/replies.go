@@ -0,0 +1,194 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package helper
+
+import (
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/peer"
+	"github.com/hyperledger-incubator/obc-peer/openchain/util"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// replyManager sends signed TransactionReplies to the peers which asked for
+// them with a CHAIN_REPLY_REQUEST. The replies to recently committed
+// transactions are kept, as a request may well arrive after the commit.
+type replyManager struct {
+	sync.Mutex
+	coordinator peer.MessageHandlerCoordinator
+	size        int                              // number of replies and of requests kept
+	waiting     map[string][]peer.MessageHandler // handlers waiting for the reply to a transaction
+	pending     []string                         // uuids in waiting, oldest first
+	recent      map[string]*pb.TransactionReply  // replies to recently committed transactions
+	order       []string                         // uuids in recent, oldest first
+}
+
+var replies struct {
+	once    sync.Once
+	manager *replyManager
+}
+
+// getReplyManager returns the reply manager shared by all handlers
+func getReplyManager(coord peer.MessageHandlerCoordinator) *replyManager {
+	replies.once.Do(func() {
+		replies.manager = newReplyManager(coord, viper.GetInt("peer.validator.replies.cachesize"))
+	})
+	return replies.manager
+}
+
+func newReplyManager(coord peer.MessageHandlerCoordinator, size int) *replyManager {
+	return &replyManager{
+		coordinator: coord,
+		size:        size,
+		waiting:     make(map[string][]peer.MessageHandler),
+		recent:      make(map[string]*pb.TransactionReply),
+	}
+}
+
+// committed creates the replies to the transactions committed in block
+// blockNumber, and sends those which were asked for
+func (rm *replyManager) committed(blockNumber uint64, results []*pb.TransactionResult) {
+	self, err := rm.coordinator.GetPeerEndpoint()
+	if err != nil {
+		logger.Error("Cannot create transaction replies: %s", err)
+		return
+	}
+
+	type delivery struct {
+		reply    *pb.TransactionReply
+		handlers []peer.MessageHandler
+	}
+	var deliveries []delivery
+
+	rm.Lock()
+	for _, result := range results {
+		reply, err := pb.NewTransactionReply(result, blockNumber, self.ID)
+		if err != nil {
+			logger.Error("Cannot create reply to transaction %s: %s", result.Uuid, err)
+			continue
+		}
+		rm.recent[reply.Uuid] = reply
+		rm.order = append(rm.order, reply.Uuid)
+		if handlers, ok := rm.waiting[reply.Uuid]; ok {
+			rm.unwait(reply.Uuid)
+			if rm.sign(reply) {
+				deliveries = append(deliveries, delivery{reply, handlers})
+			}
+		}
+	}
+	for len(rm.order) > rm.size {
+		delete(rm.recent, rm.order[0])
+		rm.order = rm.order[1:]
+	}
+	rm.Unlock()
+
+	for _, d := range deliveries {
+		rm.send(d.reply, d.handlers...)
+	}
+}
+
+// request registers handler to receive the reply to transaction uuid,
+// sending it right away if the transaction was committed recently
+func (rm *replyManager) request(uuid string, handler peer.MessageHandler) {
+	rm.Lock()
+	if reply, ok := rm.recent[uuid]; ok {
+		ok = rm.sign(reply)
+		rm.Unlock()
+		if ok {
+			rm.send(reply, handler)
+		}
+		return
+	}
+	if _, ok := rm.waiting[uuid]; !ok {
+		rm.pending = append(rm.pending, uuid)
+	}
+	rm.waiting[uuid] = append(rm.waiting[uuid], handler)
+	for len(rm.pending) > rm.size {
+		delete(rm.waiting, rm.pending[0])
+		rm.pending = rm.pending[1:]
+	}
+	rm.Unlock()
+}
+
+// unwait removes the requests for the reply to transaction uuid. It must be
+// called with the lock held.
+func (rm *replyManager) unwait(uuid string) {
+	delete(rm.waiting, uuid)
+	for i, pending := range rm.pending {
+		if pending == uuid {
+			rm.pending = append(rm.pending[:i], rm.pending[i+1:]...)
+			break
+		}
+	}
+}
+
+// forget drops the requests of a handler which stopped
+func (rm *replyManager) forget(handler peer.MessageHandler) {
+	rm.Lock()
+	defer rm.Unlock()
+	for uuid, handlers := range rm.waiting {
+		kept := handlers[:0]
+		for _, h := range handlers {
+			if h != handler {
+				kept = append(kept, h)
+			}
+		}
+		if len(kept) == 0 {
+			rm.unwait(uuid)
+		} else {
+			rm.waiting[uuid] = kept
+		}
+	}
+}
+
+// sign signs reply unless it is signed already, or security is disabled.
+// It must be called with the lock held.
+func (rm *replyManager) sign(reply *pb.TransactionReply) bool {
+	secHelper := rm.coordinator.GetSecHelper()
+	if secHelper == nil || reply.Signature != nil {
+		return true
+	}
+	data, err := reply.SignedBytes()
+	if err == nil {
+		reply.Signature, err = secHelper.Sign(data)
+	}
+	if err != nil {
+		logger.Error("Cannot sign reply to transaction %s: %s", reply.Uuid, err)
+		return false
+	}
+	return true
+}
+
+func (rm *replyManager) send(reply *pb.TransactionReply, handlers ...peer.MessageHandler) {
+	payload, err := proto.Marshal(reply)
+	if err != nil {
+		logger.Error("Cannot marshal reply to transaction %s: %s", reply.Uuid, err)
+		return
+	}
+	msg := &pb.OpenchainMessage{Type: pb.OpenchainMessage_CHAIN_REPLY, Payload: payload, Timestamp: util.CreateUtcTimestamp()}
+	for _, handler := range handlers {
+		if err := handler.SendMessage(msg); err != nil {
+			logger.Warning("Cannot send reply to transaction %s: %s", reply.Uuid, err)
+		}
+	}
+}
@@ -28,7 +28,6 @@ import (
 	"github.com/op/go-logging"
 
 	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
-	"github.com/hyperledger-incubator/obc-peer/openchain/ledger"
 	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
 	"github.com/hyperledger-incubator/obc-peer/openchain/util"
 	pb "github.com/hyperledger-incubator/obc-peer/protos"
@@ -42,11 +41,14 @@ func init() {
 
 // Noops is a plugin object implementing the consensus.Consenter interface.
 type Noops struct {
-	stack    consensus.Stack
-	txQ      *txq
-	timer    *time.Timer
-	duration time.Duration
-	channel  chan *pb.Transaction
+	stack       consensus.Stack
+	pool        *txPool
+	blockSize   int
+	blockBytes  int // maximum size of a block in bytes; 0 means unbounded
+	timer       *time.Timer
+	timerActive bool
+	duration    time.Duration
+	channel     chan *pb.Transaction
 }
 
 // Setting up a singleton NOOPS consenter
@@ -69,29 +71,57 @@ func newNoops(c consensus.Stack) consensus.Consenter {
 	i := &Noops{}
 	i.stack = c
 	config := loadConfig()
-	blockSize := config.GetInt("block.size")
-	blockTimeout := config.GetString("block.timeout")
-	if _, err = strconv.Atoi(blockTimeout); err == nil {
-		blockTimeout = blockTimeout + "s" //if string does not have unit of measure, default to seconds
+	i.blockSize = config.GetInt("block.size")
+	if i.blockSize < 1 {
+		i.blockSize = 1
 	}
-	i.duration, err = time.ParseDuration(blockTimeout)
+	i.blockBytes = config.GetInt("block.bytes")
+	i.duration, err = parseDuration(config.GetString("block.timeout"))
 	if err != nil || i.duration == 0 {
 		panic(fmt.Errorf("Cannot parse block timeout: %s", err))
 	}
+	poolSize := config.GetInt("pool.size")
+	expiry, err := parseDuration(config.GetString("pool.expiry"))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse pool expiry: %s", err))
+	}
 
 	logger.Info("NOOPS consensus type = %T", i)
-	logger.Info("NOOPS block size = %v", blockSize)
+	logger.Info("NOOPS block size = %v", i.blockSize)
+	logger.Info("NOOPS block bytes = %v", i.blockBytes)
 	logger.Info("NOOPS block timeout = %v", i.duration)
+	logger.Info("NOOPS pool size = %v", poolSize)
+	logger.Info("NOOPS pool expiry = %v", expiry)
 
-	i.txQ = newTXQ(blockSize)
+	persistor, ok := c.(consensus.StatePersistor)
+	if !ok {
+		logger.Warning("Stack cannot persist state, pending transactions will be lost on restart")
+	}
+	finder, ok := c.(consensus.TransactionFinder)
+	if !ok {
+		logger.Warning("Stack cannot look up committed transactions, resubmitted transactions will be ordered again")
+	}
+	i.pool = newTxPool(persistor, finder, poolSize, expiry)
 
 	i.channel = make(chan *pb.Transaction, 100)
 	i.timer = time.NewTimer(i.duration) // start timer now so we can just reset it
 	i.timer.Stop()
+	if i.pool.size() > 0 {
+		i.startTimer()
+	}
 	go i.handleChannels()
 	return i
 }
 
+// parseDuration parses a duration, defaulting to seconds if the string
+// does not have a unit of measure
+func parseDuration(s string) (time.Duration, error) {
+	if _, err := strconv.Atoi(s); err == nil {
+		s = s + "s"
+	}
+	return time.ParseDuration(s)
+}
+
 // RecvMsg is called for OpenchainMessage_CHAIN_TRANSACTION and OpenchainMessage_CONSENSUS messages.
 func (i *Noops) RecvMsg(msg *pb.OpenchainMessage, senderHandle *pb.PeerID) error {
 	if logger.IsEnabledFor(logging.DEBUG) {
@@ -115,6 +145,11 @@ func (i *Noops) RecvMsg(msg *pb.OpenchainMessage, senderHandle *pb.PeerID) error
 	return nil
 }
 
+// GetStatus reports the state of the transaction pool
+func (i *Noops) GetStatus() (*pb.ConsensusStatus, error) {
+	return &pb.ConsensusStatus{Plugin: "noops", Noops: i.pool.status()}, nil
+}
+
 func (i *Noops) broadcastConsensusMsg(msg *pb.OpenchainMessage) error {
 	t := &pb.Transaction{}
 	if err := proto.Unmarshal(msg.Payload, t); err != nil {
@@ -146,13 +181,25 @@ func (i *Noops) canProcessBlock(tx *pb.Transaction) bool {
 
 	// TODO: Ask coordinator if we need to start sync
 
-	i.txQ.append(tx)
+	i.pool.add(tx)
 
-	// start timer if we get a tx
-	if i.txQ.size() == 1 {
+	// start timer if we get a tx, or a rejection to record
+	if i.pool.size() > 0 {
+		i.startTimer()
+	}
+	return i.pool.isFull(i.blockSize, i.blockBytes)
+}
+
+func (i *Noops) startTimer() {
+	if !i.timerActive {
 		i.timer.Reset(i.duration)
+		i.timerActive = true
 	}
-	return i.txQ.isFull()
+}
+
+func (i *Noops) stopTimer() {
+	i.timer.Stop()
+	i.timerActive = false
 }
 
 func (i *Noops) handleChannels() {
@@ -161,15 +208,17 @@ func (i *Noops) handleChannels() {
 	for {
 		select {
 		case tx := <-i.channel:
-			if i.canProcessBlock(tx) {
+			for full := i.canProcessBlock(tx); full; full = i.pool.isFull(i.blockSize, i.blockBytes) {
 				if logger.IsEnabledFor(logging.DEBUG) {
 					logger.Debug("Process block due to size")
 				}
 				if err := i.processBlock(); nil != err {
 					logger.Error(err.Error())
+					break
 				}
 			}
 		case <-i.timer.C:
+			i.timerActive = false
 			if logger.IsEnabledFor(logging.DEBUG) {
 				logger.Debug("Process block due to time")
 			}
@@ -181,29 +230,40 @@ func (i *Noops) handleChannels() {
 }
 
 func (i *Noops) processBlock() error {
-	i.timer.Stop()
+	i.stopTimer()
+	// transactions stay in the pool until their block is committed, retry
+	// them later if processing fails
+	defer func() {
+		if i.pool.size() > 0 {
+			i.startTimer()
+		}
+	}()
 
-	if i.txQ.size() < 1 {
+	i.pool.expire(time.Now())
+	txarr, rejected := i.pool.next(i.blockSize, i.blockBytes)
+	if len(txarr) == 0 && len(rejected) == 0 {
 		if logger.IsEnabledFor(logging.DEBUG) {
-			logger.Debug("processBlock() called but transaction Q is empty")
+			logger.Debug("processBlock() called but transaction pool is empty")
 		}
 		return nil
 	}
+	var blockNumber uint64
 	var data *pb.Block
 	var delta *statemgmt.StateDelta
 	var err error
 
-	if err = i.processTransactions(); nil != err {
+	if err = i.processTransactions(txarr, rejected); nil != err {
 		return err
 	}
-	if data, delta, err = i.getBlockData(); nil != err {
+	i.pool.committed(txarr, rejected)
+	if blockNumber, data, delta, err = i.getBlockData(); nil != err {
 		return err
 	}
-	go i.notifyBlockAdded(data, delta)
+	go i.notifyBlockAdded(blockNumber, data, delta)
 	return nil
 }
 
-func (i *Noops) processTransactions() error {
+func (i *Noops) processTransactions(txarr []*pb.Transaction, rejected []*pb.TransactionResult) error {
 	timestamp := util.CreateUtcTimestamp()
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debug("Starting TX batch with timestamp: %v", timestamp)
@@ -212,8 +272,16 @@ func (i *Noops) processTransactions() error {
 		return err
 	}
 
-	// Grab all transactions from the FIFO queue and run them in order
-	txarr := i.txQ.getTXs()
+	// Record the rejected transactions, then run the others in arrival order
+	if len(rejected) > 0 {
+		if logger.IsEnabledFor(logging.DEBUG) {
+			logger.Debug("Recording %d rejected transactions with timestamp %v", len(rejected), timestamp)
+		}
+		if err := i.stack.RejectTxs(timestamp, rejected); err != nil {
+			i.stack.RollbackTxBatch(timestamp)
+			return fmt.Errorf("Fail to record rejected transactions: %v", err)
+		}
+	}
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debug("Executing batch of %d transactions with timestamp %v", len(txarr), timestamp)
 	}
@@ -245,39 +313,41 @@ func (i *Noops) getTxFromMsg(msg *pb.OpenchainMessage) (*pb.Transaction, error)
 	return txs.GetTransactions()[0], nil
 }
 
-func (i *Noops) getBlockData() (*pb.Block, *statemgmt.StateDelta, error) {
-	ledger, err := ledger.GetLedger()
-	if err != nil {
-		return nil, nil, fmt.Errorf("Fail to get the ledger: %v", err)
+func (i *Noops) getBlockData() (uint64, *pb.Block, *statemgmt.StateDelta, error) {
+	blockHeight, err := i.stack.GetBlockchainSize()
+	if nil != err {
+		return 0, nil, nil, fmt.Errorf("Fail to get the blockchain size: %v", err)
 	}
-
-	blockHeight := ledger.GetBlockchainSize()
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debug("Preparing to broadcast with block number %v", blockHeight)
 	}
-	block, err := ledger.GetBlockByNumber(blockHeight - 1)
+	block, err := i.stack.GetBlock(blockHeight - 1)
 	if nil != err {
-		return nil, nil, err
+		return 0, nil, nil, err
 	}
-	//delta, err := ledger.GetStateDeltaBytes(blockHeight)
-	delta, err := ledger.GetStateDelta(blockHeight - 1)
+	delta, err := i.stack.GetStateDelta(blockHeight - 1)
 	if nil != err {
-		return nil, nil, err
+		return 0, nil, nil, err
 	}
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debug("Got the delta state of block number %v", blockHeight)
 	}
 
-	return block, delta, nil
+	return blockHeight - 1, block, delta, nil
 }
 
-func (i *Noops) notifyBlockAdded(block *pb.Block, delta *statemgmt.StateDelta) error {
+func (i *Noops) notifyBlockAdded(blockNumber uint64, block *pb.Block, delta *statemgmt.StateDelta) error {
+	// The hash of the full block lets the NVPs check the blocks they pull
+	blockHash, err := block.GetHash()
+	if err != nil {
+		return fmt.Errorf("Fail to hash block %d: %v", blockNumber, err)
+	}
 	//make Payload nil to reduce block size..
 	//anything else to remove .. do we need StateDelta ?
 	for _, tx := range block.Transactions {
 		tx.Payload = nil
 	}
-	data, err := proto.Marshal(&pb.BlockState{Block: block, StateDelta: delta.Marshal()})
+	data, err := proto.Marshal(&pb.BlockState{Block: block, StateDelta: delta.Marshal(), BlockNumber: blockNumber, BlockHash: blockHash})
 	if err != nil {
 		return fmt.Errorf("Fail to marshall BlockState structure: %v", err)
 	}
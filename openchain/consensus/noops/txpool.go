@@ -0,0 +1,338 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package noops
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+const (
+	txKeyPrefix       = "noops.tx."
+	rejectedKeyPrefix = "noops.rejected."
+)
+
+type poolEntry struct {
+	tx      *pb.Transaction
+	key     string
+	size    int
+	arrived time.Time
+}
+
+// txPool holds the transactions waiting to be cut into a block, in
+// arrival order and at most once per uuid. Transactions which cannot be
+// included are recorded as rejected, so that their results are committed
+// with the next block. If the stack can persist state, the pool is stored
+// in the local DB and restored on restart. If the stack can look up
+// committed transactions, those are not queued again, whether resubmitted
+// or restored after a crash between committing a block and removing its
+// transactions from the DB.
+type txPool struct {
+	sync.Mutex
+	persistor consensus.StatePersistor    // nil if the pool is only kept in memory
+	finder    consensus.TransactionFinder // nil if committed transactions cannot be looked up
+	maxSize   int                         // maximum number of pending transactions
+	expiry    time.Duration               // 0 means transactions never expire
+
+	seq      uint64
+	pending  []*poolEntry
+	byUUID   map[string]*poolEntry
+	bytes    int
+	rejected []*pb.TransactionResult
+}
+
+func newTxPool(persistor consensus.StatePersistor, finder consensus.TransactionFinder, maxSize int, expiry time.Duration) *txPool {
+	p := &txPool{
+		persistor: persistor,
+		finder:    finder,
+		maxSize:   maxSize,
+		expiry:    expiry,
+		byUUID:    make(map[string]*poolEntry),
+	}
+	if persistor != nil {
+		p.restore()
+	}
+	return p
+}
+
+// txKey returns the DB key of a pending transaction, which also records
+// its arrival time so that expiry survives restarts
+func txKey(seq uint64, arrived time.Time) string {
+	// zero-padded so that keys sort in arrival order
+	return fmt.Sprintf("%s%020d.%d", txKeyPrefix, seq, arrived.UnixNano())
+}
+
+// parseTxKey returns the sequence number and arrival time stored in a key
+func parseTxKey(key string) (uint64, time.Time, error) {
+	fields := strings.Split(strings.TrimPrefix(key, txKeyPrefix), ".")
+	if len(fields) != 2 {
+		return 0, time.Time{}, fmt.Errorf("malformed key %s", key)
+	}
+	seq, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	nanos, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return seq, time.Unix(0, nanos), nil
+}
+
+// restore reloads the transactions and rejections stored by a previous run
+func (p *txPool) restore() {
+	stored, err := p.persistor.ReadStateSet(txKeyPrefix)
+	if err != nil {
+		logger.Error("Could not restore the transaction pool: %v", err)
+		return
+	}
+	keys := make([]string, 0, len(stored))
+	for key := range stored {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		tx := &pb.Transaction{}
+		err := proto.Unmarshal(stored[key], tx)
+		seq, arrived, keyErr := parseTxKey(key)
+		if err == nil {
+			err = keyErr
+		}
+		if err != nil {
+			logger.Error("Dropping corrupt pool entry %s: %v", key, err)
+			p.persistor.DelState(key)
+			continue
+		}
+		if seq >= p.seq {
+			p.seq = seq + 1
+		}
+		if p.isCommitted(tx.Uuid) {
+			logger.Info("Dropping pool entry %s, transaction %s was committed already", key, tx.Uuid)
+			p.persistor.DelState(key)
+			continue
+		}
+		p.push(&poolEntry{tx: tx, key: key, size: len(stored[key]), arrived: arrived})
+	}
+
+	stored, err = p.persistor.ReadStateSet(rejectedKeyPrefix)
+	if err != nil {
+		logger.Error("Could not restore the rejected transactions: %v", err)
+		return
+	}
+	for key, raw := range stored {
+		result := &pb.TransactionResult{}
+		if err := proto.Unmarshal(raw, result); err != nil {
+			logger.Error("Dropping corrupt rejection %s: %v", key, err)
+			p.persistor.DelState(key)
+			continue
+		}
+		if p.isRecorded(result.Uuid) {
+			logger.Info("Dropping rejection %s, a result for transaction %s was committed already", key, result.Uuid)
+			p.persistor.DelState(key)
+			continue
+		}
+		p.rejected = append(p.rejected, result)
+	}
+	logger.Info("Restored %d pending and %d rejected transactions", len(p.pending), len(p.rejected))
+}
+
+// isCommitted returns whether the transaction is part of a committed block
+func (p *txPool) isCommitted(uuid string) bool {
+	if p.finder == nil {
+		return false
+	}
+	_, err := p.finder.GetTransactionByUUID(uuid)
+	return err == nil
+}
+
+// isRecorded returns whether a result for the transaction was committed
+func (p *txPool) isRecorded(uuid string) bool {
+	if p.finder == nil {
+		return false
+	}
+	_, err := p.finder.GetTransactionResultByUUID(uuid)
+	return err == nil
+}
+
+func (p *txPool) push(e *poolEntry) {
+	p.pending = append(p.pending, e)
+	p.byUUID[e.tx.Uuid] = e
+	p.bytes += e.size
+}
+
+// add appends a transaction to the pool. It returns false if the
+// transaction is already pending or committed, or if the pool is full, in
+// which case the transaction is rejected.
+func (p *txPool) add(tx *pb.Transaction) bool {
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.byUUID[tx.Uuid]; ok {
+		logger.Debug("Transaction %s is already pending, ignoring it", tx.Uuid)
+		return false
+	}
+	if p.isCommitted(tx.Uuid) {
+		logger.Warning("Transaction %s was committed already, ignoring it", tx.Uuid)
+		return false
+	}
+	if p.maxSize > 0 && len(p.pending) >= p.maxSize {
+		logger.Warning("Transaction pool is full, rejecting transaction %s", tx.Uuid)
+		p.reject(tx.Uuid, "transaction pool is full")
+		return false
+	}
+	raw, err := proto.Marshal(tx)
+	if err != nil {
+		logger.Error("Could not marshal transaction %s: %v", tx.Uuid, err)
+		return false
+	}
+	now := time.Now()
+	e := &poolEntry{tx: tx, key: txKey(p.seq, now), size: len(raw), arrived: now}
+	p.seq++
+	if p.persistor != nil {
+		if err := p.persistor.StoreState(e.key, raw); err != nil {
+			logger.Error("Could not persist transaction %s: %v", tx.Uuid, err)
+		}
+	}
+	p.push(e)
+	return true
+}
+
+// reject records a result for a transaction which will not be executed
+func (p *txPool) reject(uuid, reason string) {
+	result := &pb.TransactionResult{
+		Uuid:      uuid,
+		ErrorCode: consensus.TxErrorRejected,
+		Error:     reason,
+	}
+	p.rejected = append(p.rejected, result)
+	if p.persistor == nil {
+		return
+	}
+	raw, err := proto.Marshal(result)
+	if err == nil {
+		err = p.persistor.StoreState(rejectedKeyPrefix+uuid, raw)
+	}
+	if err != nil {
+		logger.Error("Could not persist rejection of transaction %s: %v", uuid, err)
+	}
+}
+
+// expire rejects the transactions which have been pending for too long
+func (p *txPool) expire(now time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	if p.expiry == 0 {
+		return
+	}
+	var keep []*poolEntry
+	for _, e := range p.pending {
+		if now.Sub(e.arrived) < p.expiry {
+			keep = append(keep, e)
+			continue
+		}
+		logger.Warning("Transaction %s expired after %v", e.tx.Uuid, now.Sub(e.arrived))
+		p.drop(e)
+		p.reject(e.tx.Uuid, "transaction expired")
+	}
+	p.pending = keep
+}
+
+// drop forgets an entry, the caller updates pending
+func (p *txPool) drop(e *poolEntry) {
+	delete(p.byUUID, e.tx.Uuid)
+	p.bytes -= e.size
+	if p.persistor != nil {
+		if err := p.persistor.DelState(e.key); err != nil {
+			logger.Error("Could not remove transaction %s from the DB: %v", e.tx.Uuid, err)
+		}
+	}
+}
+
+// next returns the oldest transactions fitting into one block, and the
+// rejections to commit with it. A transaction larger than maxBytes is
+// returned in a block of its own; maxBytes 0 means unbounded.
+func (p *txPool) next(maxCount, maxBytes int) ([]*pb.Transaction, []*pb.TransactionResult) {
+	p.Lock()
+	defer p.Unlock()
+	var txs []*pb.Transaction
+	bytes := 0
+	for _, e := range p.pending {
+		if len(txs) >= maxCount {
+			break
+		}
+		if maxBytes > 0 && len(txs) > 0 && bytes+e.size > maxBytes {
+			break
+		}
+		txs = append(txs, e.tx)
+		bytes += e.size
+	}
+	return txs, append([]*pb.TransactionResult(nil), p.rejected...)
+}
+
+// committed removes the transactions and rejections returned by next once
+// their block has been committed
+func (p *txPool) committed(txs []*pb.Transaction, rejected []*pb.TransactionResult) {
+	p.Lock()
+	defer p.Unlock()
+	for _, e := range p.pending[:len(txs)] {
+		p.drop(e)
+	}
+	p.pending = p.pending[len(txs):]
+	for _, result := range rejected {
+		if p.persistor != nil {
+			if err := p.persistor.DelState(rejectedKeyPrefix + result.Uuid); err != nil {
+				logger.Error("Could not remove rejection of transaction %s from the DB: %v", result.Uuid, err)
+			}
+		}
+	}
+	p.rejected = p.rejected[len(rejected):]
+}
+
+// size returns the number of pending transactions and rejections
+func (p *txPool) size() int {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.pending) + len(p.rejected)
+}
+
+// isFull returns whether a block can be cut without waiting for the timeout
+func (p *txPool) isFull(maxCount, maxBytes int) bool {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.pending) >= maxCount || (maxBytes > 0 && p.bytes >= maxBytes)
+}
+
+func (p *txPool) status() *pb.NoopsStatus {
+	p.Lock()
+	defer p.Unlock()
+	return &pb.NoopsStatus{
+		PendingTransactions:  uint64(len(p.pending)),
+		PendingBytes:         uint64(p.bytes),
+		RejectedTransactions: uint64(len(p.rejected)),
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package noops
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// mockPersistor keeps state in memory as the DB of a peer would
+type mockPersistor map[string][]byte
+
+func (mock mockPersistor) StoreState(key string, value []byte) error {
+	mock[key] = value
+	return nil
+}
+
+func (mock mockPersistor) ReadState(key string) ([]byte, error) {
+	return mock[key], nil
+}
+
+func (mock mockPersistor) ReadStateSet(prefix string) (map[string][]byte, error) {
+	set := make(map[string][]byte)
+	for key, value := range mock {
+		if strings.HasPrefix(key, prefix) {
+			set[key] = value
+		}
+	}
+	return set, nil
+}
+
+func (mock mockPersistor) DelState(key string) error {
+	delete(mock, key)
+	return nil
+}
+
+// mockFinder holds the uuids of committed transactions and results
+type mockFinder struct {
+	txs     map[string]bool
+	results map[string]bool
+}
+
+func (mock *mockFinder) GetTransactionByUUID(uuid string) (*pb.Transaction, error) {
+	if !mock.txs[uuid] {
+		return nil, fmt.Errorf("transaction %s not found", uuid)
+	}
+	return &pb.Transaction{Uuid: uuid}, nil
+}
+
+func (mock *mockFinder) GetTransactionResultByUUID(uuid string) (*pb.TransactionResult, error) {
+	if !mock.results[uuid] {
+		return nil, fmt.Errorf("result of transaction %s not found", uuid)
+	}
+	return &pb.TransactionResult{Uuid: uuid}, nil
+}
+
+func uuids(txs []*pb.Transaction) []string {
+	var ids []string
+	for _, tx := range txs {
+		ids = append(ids, tx.Uuid)
+	}
+	return ids
+}
+
+func TestTxPoolDedup(t *testing.T) {
+	p := newTxPool(nil, nil, 0, 0)
+	if !p.add(&pb.Transaction{Uuid: "a"}) {
+		t.Fatalf("Expected the first transaction a to be added")
+	}
+	if p.add(&pb.Transaction{Uuid: "a"}) {
+		t.Fatalf("Expected the duplicate transaction a to be ignored")
+	}
+	p.add(&pb.Transaction{Uuid: "b"})
+	txs, rejected := p.next(10, 0)
+	if ids := uuids(txs); len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Fatalf("Expected transactions [a b], got %v", ids)
+	}
+	if len(rejected) != 0 {
+		t.Fatalf("Expected a duplicate not to be rejected, got %v", rejected)
+	}
+	p.committed(txs, rejected)
+	if p.size() != 0 {
+		t.Fatalf("Expected an empty pool after the commit, got %d entries", p.size())
+	}
+}
+
+func TestTxPoolFull(t *testing.T) {
+	p := newTxPool(nil, nil, 1, 0)
+	p.add(&pb.Transaction{Uuid: "a"})
+	if p.add(&pb.Transaction{Uuid: "b"}) {
+		t.Fatalf("Expected transaction b to be rejected by a full pool")
+	}
+	txs, rejected := p.next(10, 0)
+	if len(txs) != 1 || len(rejected) != 1 || rejected[0].Uuid != "b" || rejected[0].ErrorCode != consensus.TxErrorRejected {
+		t.Fatalf("Expected a to be cut and b to be rejected, got %v and %v", uuids(txs), rejected)
+	}
+}
+
+func TestTxPoolCut(t *testing.T) {
+	p := newTxPool(nil, nil, 0, 0)
+	for _, uuid := range []string{"a", "b", "c"} {
+		p.add(&pb.Transaction{Uuid: uuid, Payload: make([]byte, 100)})
+	}
+	large := &pb.Transaction{Uuid: "d", Payload: make([]byte, 1000)}
+	p.add(large)
+
+	if !p.isFull(3, 0) || p.isFull(5, 0) {
+		t.Fatalf("Expected the pool of 4 transactions to be full for blocks of 3 but not 5")
+	}
+	if !p.isFull(5, 1000) || p.isFull(5, 10000) {
+		t.Fatalf("Expected the pool to be full by bytes for blocks of 1000 but not 10000 bytes")
+	}
+
+	txs, _ := p.next(2, 0)
+	if ids := uuids(txs); len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Fatalf("Expected a block cut by count of [a b], got %v", ids)
+	}
+	txs, _ = p.next(10, 250)
+	if ids := uuids(txs); len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Fatalf("Expected a block cut by bytes of [a b], got %v", ids)
+	}
+	p.committed(txs, nil)
+
+	txs, _ = p.next(10, 250)
+	if ids := uuids(txs); len(ids) != 1 || ids[0] != "c" {
+		t.Fatalf("Expected a block of [c], got %v", ids)
+	}
+	p.committed(txs, nil)
+
+	// a transaction larger than a block gets a block of its own
+	txs, _ = p.next(10, 250)
+	if len(txs) != 1 || txs[0] != large {
+		t.Fatalf("Expected a block of the large transaction d, got %v", uuids(txs))
+	}
+}
+
+func TestTxPoolExpiry(t *testing.T) {
+	p := newTxPool(nil, nil, 0, time.Minute)
+	p.add(&pb.Transaction{Uuid: "a"})
+	p.expire(time.Now())
+	if txs, rejected := p.next(10, 0); len(txs) != 1 || len(rejected) != 0 {
+		t.Fatalf("Expected transaction a not to expire yet, got %v and %v", uuids(txs), rejected)
+	}
+	p.expire(time.Now().Add(2 * time.Minute))
+	txs, rejected := p.next(10, 0)
+	if len(txs) != 0 || len(rejected) != 1 || rejected[0].Uuid != "a" || rejected[0].Error != "transaction expired" {
+		t.Fatalf("Expected transaction a to be rejected as expired, got %v and %v", uuids(txs), rejected)
+	}
+}
+
+func TestTxPoolRestore(t *testing.T) {
+	db := make(mockPersistor)
+	p := newTxPool(db, nil, 1, time.Minute)
+	p.add(&pb.Transaction{Uuid: "a"})
+	p.add(&pb.Transaction{Uuid: "b"})
+	arrived := p.pending[0].arrived
+
+	// a restarted pool continues where the previous one stopped, with the
+	// original arrival times
+	p = newTxPool(db, nil, 2, time.Minute)
+	txs, rejected := p.next(10, 0)
+	if len(txs) != 1 || txs[0].Uuid != "a" || len(rejected) != 1 || rejected[0].Uuid != "b" {
+		t.Fatalf("Expected a pending and b rejected after the restart, got %v and %v", uuids(txs), rejected)
+	}
+	if !p.pending[0].arrived.Equal(arrived) {
+		t.Fatalf("Expected the arrival time %v to be restored, got %v", arrived, p.pending[0].arrived)
+	}
+	p.add(&pb.Transaction{Uuid: "c"})
+	if len(p.pending) != 2 || p.pending[1].key <= p.pending[0].key {
+		t.Fatalf("Expected c to be stored after a, got keys %s and %s", p.pending[0].key, p.pending[1].key)
+	}
+
+	p.expire(arrived.Add(2 * time.Minute))
+	p.committed(p.next(10, 0))
+	if len(db) != 0 {
+		t.Fatalf("Expected the DB to be empty once everything is committed, got %d keys", len(db))
+	}
+	if p = newTxPool(db, nil, 2, time.Minute); p.size() != 0 {
+		t.Fatalf("Expected an empty pool after the restart, got %d entries", p.size())
+	}
+}
+
+func TestTxPoolCommitted(t *testing.T) {
+	db := make(mockPersistor)
+	finder := &mockFinder{txs: make(map[string]bool), results: make(map[string]bool)}
+	p := newTxPool(db, finder, 2, 0)
+	p.add(&pb.Transaction{Uuid: "a"})
+	p.add(&pb.Transaction{Uuid: "b"})
+	p.add(&pb.Transaction{Uuid: "c"})
+
+	// the block of a and the rejection of c was committed, but the peer
+	// crashed before they were removed from the DB
+	finder.txs["a"] = true
+	finder.results["c"] = true
+	p = newTxPool(db, finder, 2, 0)
+	txs, rejected := p.next(10, 0)
+	if ids := uuids(txs); len(ids) != 1 || ids[0] != "b" || len(rejected) != 0 {
+		t.Fatalf("Expected only b to be restored, got %v and %v", ids, rejected)
+	}
+	if len(db) != 1 {
+		t.Fatalf("Expected the committed entries to be removed from the DB, got %d keys", len(db))
+	}
+
+	// a committed transaction which is submitted again is not queued
+	if p.add(&pb.Transaction{Uuid: "a"}) {
+		t.Fatalf("Expected the committed transaction a to be ignored")
+	}
+	if p.size() != 1 {
+		t.Fatalf("Expected only b in the pool, got %d entries", p.size())
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package obcpbft
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/util"
+)
+
+// authMode selects how replicas authenticate protocol messages to each
+// other, see general.authentication in config.yaml
+type authMode int
+
+const (
+	authNone       authMode = iota // only view-change and checkpoint messages are signed
+	authSignatures                 // protocol messages are signed with the enrollment key
+	authMACs                       // normal-case messages carry MAC authenticators
+)
+
+func parseAuthMode(name string) (authMode, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return authNone, nil
+	case "signatures":
+		return authSignatures, nil
+	case "macs":
+		return authMACs, nil
+	}
+	return authNone, fmt.Errorf("unknown authentication mode %q", name)
+}
+
+func (mode authMode) String() string {
+	switch mode {
+	case authSignatures:
+		return "signatures"
+	case authMACs:
+		return "macs"
+	}
+	return "none"
+}
+
+// sessionKeys holds the ephemeral Diffie-Hellman key pair of this replica,
+// and the MAC keys derived from it for each peer
+type sessionKeys struct {
+	priv      []byte
+	pub       []byte
+	send      map[uint64][]byte    // MAC key for messages to each peer
+	recv      map[uint64][]byte    // MAC key for messages from each peer
+	requested map[uint64]time.Time // when we last asked each peer for its key
+}
+
+func newSessionKeys() (*sessionKeys, error) {
+	priv, x, y, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &sessionKeys{
+		priv:      priv,
+		pub:       elliptic.Marshal(elliptic.P256(), x, y),
+		send:      make(map[uint64][]byte),
+		recv:      make(map[uint64][]byte),
+		requested: make(map[uint64]time.Time),
+	}, nil
+}
+
+// derive computes the MAC keys shared between replicas self and peer from
+// the public key of peer
+func (keys *sessionKeys) derive(self uint64, peer uint64, pub []byte) error {
+	curve := elliptic.P256()
+	x, y := elliptic.Unmarshal(curve, pub)
+	if x == nil {
+		return fmt.Errorf("invalid public key")
+	}
+	secret, _ := curve.ScalarMult(x, y, keys.priv)
+	keys.send[peer] = macKey(secret.Bytes(), self, peer)
+	keys.recv[peer] = macKey(secret.Bytes(), peer, self)
+	delete(keys.requested, peer)
+	return nil
+}
+
+// macKey derives a key for one direction, so that a message can not be
+// reflected back to its sender
+func macKey(secret []byte, from uint64, to uint64) []byte {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "pbft session key %d->%d", from, to)
+	return mac.Sum(nil)
+}
+
+func computeMAC(key []byte, digest []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(digest)
+	return mac.Sum(nil)
+}
+
+// authFor returns how a message has to be authenticated
+func (instance *pbftCore) authFor(msg *Message) authMode {
+	switch msg.Payload.(type) {
+	case *Message_PrePrepare, *Message_Prepare, *Message_Commit:
+		return instance.auth
+	case *Message_NewView:
+		if instance.auth != authNone {
+			return authSignatures
+		}
+	case *Message_Checkpoint, *Message_SessionKey:
+		// checkpoint signatures make up the stable checkpoint certificates
+		return authSignatures
+	}
+	// view-changes carry their own signature, requests are checked
+	// against the digests the replicas agreed on
+	return authNone
+}
+
+// payloadBytes returns what signatures and authenticators cover
+func payloadBytes(msg *Message) ([]byte, error) {
+	return proto.Marshal(&Message{Payload: msg.Payload})
+}
+
+// authenticate sets the signature or the authenticator of an outgoing
+// message. A message which needs an authenticator is signed as well if we
+// do not share a session key with every replica yet.
+func (instance *pbftCore) authenticate(msg *Message) error {
+	msg.Signature = nil
+	msg.Authenticator = nil
+
+	mode := instance.authFor(msg)
+	if mode == authNone {
+		return nil
+	}
+	raw, err := payloadBytes(msg)
+	if err != nil {
+		return err
+	}
+
+	if mode == authMACs {
+		digest := util.ComputeCryptoHash(raw)
+		complete := true
+		msg.Authenticator = make([][]byte, instance.replicaCount)
+		for i := range msg.Authenticator {
+			replicaID := uint64(i)
+			if replicaID == instance.id {
+				continue
+			}
+			if key, ok := instance.keys.send[replicaID]; ok {
+				msg.Authenticator[i] = computeMAC(key, digest)
+			} else {
+				complete = false
+				instance.requestSessionKey(replicaID)
+			}
+		}
+		if complete {
+			return nil
+		}
+	}
+
+	msg.Signature, err = instance.consumer.sign(raw)
+	return err
+}
+
+// checkAuth verifies the signature or the authenticator of an incoming
+// message
+func (instance *pbftCore) checkAuth(msg *Message, senderID uint64) error {
+	mode := instance.authFor(msg)
+	if mode == authNone {
+		return nil
+	}
+	raw, err := payloadBytes(msg)
+	if err != nil {
+		return err
+	}
+
+	if mode == authMACs {
+		key, ok := instance.keys.recv[senderID]
+		if ok && uint64(len(msg.Authenticator)) > instance.id && msg.Authenticator[instance.id] != nil {
+			if hmac.Equal(msg.Authenticator[instance.id], computeMAC(key, util.ComputeCryptoHash(raw))) {
+				return nil
+			}
+			// the sender may have restarted with a new session key
+			ok = false
+		}
+		if !ok {
+			instance.requestSessionKey(senderID)
+		}
+		if msg.Signature == nil {
+			return fmt.Errorf("no valid authenticator from replica %d", senderID)
+		}
+	}
+
+	if msg.Signature == nil {
+		return fmt.Errorf("no signature from replica %d", senderID)
+	}
+	return instance.consumer.verify(senderID, msg.Signature, raw)
+}
+
+// requestSessionKey sends our session key to a replica, asking for its key
+// in return. Repeated requests are held back for the request timeout.
+func (instance *pbftCore) requestSessionKey(replicaID uint64) {
+	if last, ok := instance.keys.requested[replicaID]; ok && time.Since(last) < instance.requestTimeout {
+		return
+	}
+	instance.keys.requested[replicaID] = time.Now()
+	instance.sendSessionKey(replicaID, true)
+}
+
+func (instance *pbftCore) sendSessionKey(replicaID uint64, reply bool) {
+	msg := &Message{Payload: &Message_SessionKey{&SessionKey{
+		ReplicaId: instance.id,
+		PublicKey: instance.keys.pub,
+		Reply:     reply,
+	}}}
+	if err := instance.authenticate(msg); err != nil {
+		logger.Error("Replica %d cannot sign its session key: %s", instance.id, err)
+		return
+	}
+	msgRaw, err := proto.Marshal(msg)
+	if err != nil {
+		logger.Error("Replica %d cannot marshal its session key: %s", instance.id, err)
+		return
+	}
+	logger.Debug("Replica %d sending session key to replica %d", instance.id, replicaID)
+	instance.consumer.unicast(msgRaw, replicaID)
+}
+
+func (instance *pbftCore) recvSessionKey(sk *SessionKey) error {
+	if instance.keys == nil {
+		logger.Warning("Replica %d ignoring session key from replica %d, authentication is %s", instance.id, sk.ReplicaId, instance.auth)
+		return nil
+	}
+	if sk.ReplicaId == instance.id || sk.ReplicaId >= uint64(instance.replicaCount) {
+		return fmt.Errorf("Session key from invalid replica %d", sk.ReplicaId)
+	}
+	if err := instance.keys.derive(instance.id, sk.ReplicaId, sk.PublicKey); err != nil {
+		return fmt.Errorf("Session key from replica %d: %s", sk.ReplicaId, err)
+	}
+	logger.Debug("Replica %d established session keys with replica %d", instance.id, sk.ReplicaId)
+
+	if sk.Reply {
+		instance.sendSessionKey(sk.ReplicaId, false)
+	}
+	return nil
+}
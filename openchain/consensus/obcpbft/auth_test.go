@@ -0,0 +1,244 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package obcpbft
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/op/go-logging"
+)
+
+func TestParseAuthMode(t *testing.T) {
+	for name, expected := range map[string]authMode{
+		"":           authNone,
+		"none":       authNone,
+		"Signatures": authSignatures,
+		"macs":       authMACs,
+	} {
+		mode, err := parseAuthMode(name)
+		if err != nil {
+			t.Errorf("Failed to parse authentication mode %q: %s", name, err)
+		} else if mode != expected {
+			t.Errorf("Expected %q to parse as %s, got %s", name, expected, mode)
+		}
+	}
+	if _, err := parseAuthMode("bogus"); err == nil {
+		t.Errorf("Expected unknown authentication mode to be rejected")
+	}
+}
+
+// ecdsaStack signs with a real enrollment key per replica
+type ecdsaStack struct {
+	*mockStack
+	id   uint64
+	keys map[uint64]*ecdsa.PrivateKey
+}
+
+func (stack *ecdsaStack) sign(msg []byte) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	r, s, err := ecdsa.Sign(rand.Reader, stack.keys[stack.id], digest[:])
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 64)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(signature[32-len(rb):32], rb)
+	copy(signature[64-len(sb):], sb)
+	return signature, nil
+}
+
+func (stack *ecdsaStack) verify(senderID uint64, signature []byte, message []byte) error {
+	digest := sha256.Sum256(message)
+	half := len(signature) / 2
+	r := new(big.Int).SetBytes(signature[:half])
+	s := new(big.Int).SetBytes(signature[half:])
+	if !ecdsa.Verify(&stack.keys[senderID].PublicKey, digest[:], r, s) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+func (stack *ecdsaStack) unicast(msg []byte, receiverID uint64) error {
+	return nil
+}
+
+// makeAuthPair returns replicas 0 and 1 using the given authentication
+// mode, with session keys established if the mode uses MACs
+func makeAuthPair(t testing.TB, mode authMode) (*pbftCore, *pbftCore) {
+	keys := make(map[uint64]*ecdsa.PrivateKey)
+	var cores []*pbftCore
+	for id := uint64(0); id < 2; id++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("Failed to generate enrollment key: %s", err)
+		}
+		keys[id] = key
+		stack := &ecdsaStack{newMock(), id, keys}
+		instance := newPbftCore(id, loadConfig(), stack, stack)
+		instance.auth = mode
+		if mode == authMACs {
+			if instance.keys, err = newSessionKeys(); err != nil {
+				t.Fatalf("Failed to generate session keys: %s", err)
+			}
+		}
+		cores = append(cores, instance)
+	}
+	if mode == authMACs {
+		cores[0].keys.derive(0, 1, cores[1].keys.pub)
+		cores[1].keys.derive(1, 0, cores[0].keys.pub)
+	}
+	return cores[0], cores[1]
+}
+
+func TestAuthMACs(t *testing.T) {
+	sender, receiver := makeAuthPair(t, authMACs)
+	defer sender.close()
+	defer receiver.close()
+
+	msg := &Message{Payload: &Message_Commit{&Commit{View: 0, SequenceNumber: 1, RequestDigest: "foo", ReplicaId: 0}}}
+	if err := sender.authenticate(msg); err != nil {
+		t.Fatalf("Failed to authenticate commit: %s", err)
+	}
+	if msg.Authenticator[1] == nil {
+		t.Fatalf("Expected commit to carry a MAC for replica 1")
+	}
+	// replicas 2 and 3 have no session key yet, so the commit is signed too
+	if msg.Signature == nil {
+		t.Fatalf("Expected commit to be signed while session keys are missing")
+	}
+	msg.Signature = nil
+	if err := receiver.checkAuth(msg, 0); err != nil {
+		t.Fatalf("Failed to check valid authenticator: %s", err)
+	}
+
+	msg.Authenticator[1][0] ^= 1
+	if err := receiver.checkAuth(msg, 0); err == nil {
+		t.Errorf("Expected tampered authenticator to be rejected")
+	}
+
+	msg.Authenticator[1][0] ^= 1
+	msg.GetCommit().SequenceNumber = 2
+	if err := receiver.checkAuth(msg, 0); err == nil {
+		t.Errorf("Expected authenticator of a modified commit to be rejected")
+	}
+
+	// checkpoints are always signed
+	chkpt := &Message{Payload: &Message_Checkpoint{&Checkpoint{SequenceNumber: 10, ReplicaId: 0, BlockHash: "bar"}}}
+	if err := sender.authenticate(chkpt); err != nil {
+		t.Fatalf("Failed to authenticate checkpoint: %s", err)
+	}
+	if chkpt.Signature == nil || chkpt.Authenticator != nil {
+		t.Fatalf("Expected checkpoint to be signed only")
+	}
+	if err := receiver.checkAuth(chkpt, 0); err != nil {
+		t.Fatalf("Failed to check signed checkpoint: %s", err)
+	}
+	if err := receiver.checkAuth(chkpt, 1); err == nil {
+		t.Errorf("Expected checkpoint signed by another replica to be rejected")
+	}
+}
+
+func TestAuthSessionKeyExchange(t *testing.T) {
+	validatorCount := 4
+	net := makeTestnet(validatorCount, makeTestnetPbftCore, func(inst *instance) {
+		var err error
+		inst.pbft.auth = authMACs
+		if inst.pbft.keys, err = newSessionKeys(); err != nil {
+			panic(err)
+		}
+	})
+	defer net.close()
+
+	signed := 0
+	net.filterFn = func(src int, dst int, payload []byte) []byte {
+		msg := &Message{}
+		proto.Unmarshal(payload, msg)
+		if msg.GetCommit() != nil && msg.Signature != nil {
+			signed++
+		}
+		return payload
+	}
+
+	for i := int64(1); i <= 2; i++ {
+		if i == 2 {
+			signed = 0
+		}
+		msg := createOcMsgWithChainTx(i)
+		if err := net.replicas[0].pbft.request(msg.Payload, uint64(generateBroadcaster(validatorCount))); err != nil {
+			t.Fatalf("Request failed: %s", err)
+		}
+		if err := net.process(); err != nil {
+			t.Fatalf("Processing failed: %s", err)
+		}
+	}
+
+	for _, inst := range net.replicas {
+		if blockHeight, _ := inst.ledger.GetBlockchainSize(); blockHeight != 3 {
+			t.Errorf("Instance %d executed %d requests, expected 2", inst.id, blockHeight-1)
+		}
+		if len(inst.pbft.keys.send) != validatorCount-1 {
+			t.Errorf("Instance %d shares session keys with %d replicas, expected %d", inst.id, len(inst.pbft.keys.send), validatorCount-1)
+		}
+	}
+	if signed != 0 {
+		t.Errorf("Expected commits to carry only MACs once session keys are established, %d were signed", signed)
+	}
+}
+
+func benchmarkAuth(b *testing.B, mode authMode) {
+	logging.SetLevel(logging.WARNING, "")
+	defer logging.SetLevel(logging.DEBUG, "")
+
+	sender, receiver := makeAuthPair(b, mode)
+	defer sender.close()
+	defer receiver.close()
+	// pretend the sender shares keys with all replicas
+	if mode == authMACs {
+		for id := uint64(2); id < uint64(sender.replicaCount); id++ {
+			sender.keys.send[id] = sender.keys.send[1]
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := &Message{Payload: &Message_Commit{&Commit{View: 0, SequenceNumber: uint64(i), RequestDigest: "foo", ReplicaId: 0}}}
+		if err := sender.authenticate(msg); err != nil {
+			b.Fatalf("Failed to authenticate commit: %s", err)
+		}
+		if err := receiver.checkAuth(msg, 0); err != nil {
+			b.Fatalf("Failed to check commit: %s", err)
+		}
+	}
+}
+
+func BenchmarkAuthSignatures(b *testing.B) {
+	benchmarkAuth(b, authSignatures)
+}
+
+func BenchmarkAuthMACs(b *testing.B) {
+	benchmarkAuth(b, authMACs)
+}
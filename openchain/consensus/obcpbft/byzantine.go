@@ -0,0 +1,222 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package obcpbft
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	gp "google/protobuf"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/util"
+)
+
+// byzantineBehavior is a set of intentional faults a replica can be
+// configured with, so that adversarial scenarios can be reproduced on
+// test networks. Behaviors can be combined freely.
+type byzantineBehavior uint
+
+const (
+	byzantineOmit            byzantineBehavior = 1 << iota // about 1/3 of the time, skip a random replica when broadcasting
+	byzantineEquivocate                                    // as primary, send a conflicting pre-prepare to odd-numbered replicas
+	byzantineDropCommits                                   // never send commit messages to other replicas
+	byzantineBadCheckpoint                                 // send checkpoints carrying a wrong block hash
+	byzantineDelay                                         // hold every outgoing message back for byzantineDelay
+	byzantineForgeViewChange                               // send view-changes for a later view, with empty P and Q sets
+)
+
+var byzantineNames = map[string]byzantineBehavior{
+	"omit":            byzantineOmit,
+	"equivocate":      byzantineEquivocate,
+	"dropcommits":     byzantineDropCommits,
+	"badcheckpoint":   byzantineBadCheckpoint,
+	"delay":           byzantineDelay,
+	"forgeviewchange": byzantineForgeViewChange,
+}
+
+// parseByzantine converts a list of behavior names into a behavior set.
+// For backwards compatibility "true" selects the omit behavior, while
+// "false", "none" and empty names are ignored.
+func parseByzantine(names []string) (byzantineBehavior, error) {
+	var behaviors byzantineBehavior
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "", "false", "none":
+			continue
+		case "true":
+			behaviors |= byzantineOmit
+			continue
+		}
+		b, ok := byzantineNames[name]
+		if !ok {
+			return 0, fmt.Errorf("Unknown byzantine behavior: %s", name)
+		}
+		behaviors |= b
+	}
+	return behaviors, nil
+}
+
+// splitByzantine splits a configuration value such as
+// "equivocate, dropcommits" into behavior names.
+func splitByzantine(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+func (b byzantineBehavior) has(behavior byzantineBehavior) bool {
+	return b&behavior != 0
+}
+
+// names returns the sorted names of the behaviors in the set
+func (b byzantineBehavior) names() []string {
+	names := []string{}
+	for name, behavior := range byzantineNames {
+		if b.has(behavior) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (b byzantineBehavior) String() string {
+	if b == 0 {
+		return "none"
+	}
+	return strings.Join(b.names(), ",")
+}
+
+// setByzantine replaces the set of byzantine behaviors of this replica
+func (instance *pbftCore) setByzantine(names []string) error {
+	behaviors, err := parseByzantine(names)
+	if err != nil {
+		return err
+	}
+
+	instance.lock()
+	defer instance.unlock()
+	logger.Warning("Replica %d byzantine behaviors changed from %s to %s", instance.id, instance.byzantine, behaviors)
+	instance.byzantine = behaviors
+	return nil
+}
+
+// getByzantine returns the names of the active byzantine behaviors
+func (instance *pbftCore) getByzantine() []string {
+	instance.lock()
+	defer instance.unlock()
+	return instance.byzantine.names()
+}
+
+// byzantineBroadcast sends msg to every other replica individually,
+// tampering with it according to the configured byzantine behaviors.
+func (instance *pbftCore) byzantineBroadcast(msg *Message) {
+	omit := -1
+	if instance.byzantine.has(byzantineOmit) && rand.Intn(3) == 1 {
+		omit = rand.Intn(instance.N)
+	}
+
+	for i := 0; i < instance.N; i++ {
+		receiverID := uint64(i)
+		if receiverID == instance.id {
+			continue
+		}
+		if i == omit {
+			logger.Debug("PBFT byzantine: not broadcasting to replica %v", i)
+			continue
+		}
+
+		out := instance.byzantineMessage(msg, receiverID)
+		if out == nil {
+			logger.Debug("PBFT byzantine: dropping message to replica %v", i)
+			continue
+		}
+		if out != msg {
+			// a byzantine replica authenticates its forgeries too
+			if err := instance.authenticate(out); err != nil {
+				logger.Error("PBFT byzantine: cannot authenticate message: %s", err)
+				continue
+			}
+		}
+		msgRaw, err := proto.Marshal(out)
+		if err != nil {
+			logger.Error("PBFT byzantine: cannot marshal message: %s", err)
+			continue
+		}
+
+		if instance.byzantine.has(byzantineDelay) {
+			time.AfterFunc(instance.byzantineDelay, func() {
+				instance.consumer.unicast(msgRaw, receiverID)
+			})
+		} else {
+			instance.consumer.unicast(msgRaw, receiverID)
+		}
+	}
+}
+
+// byzantineMessage returns the message to be sent to replica receiverID
+// in place of msg, or nil if nothing should be sent at all
+func (instance *pbftCore) byzantineMessage(msg *Message, receiverID uint64) *Message {
+	if preprep := msg.GetPrePrepare(); preprep != nil && instance.byzantine.has(byzantineEquivocate) && receiverID%2 == 1 {
+		req := *preprep.Request
+		ts := &gp.Timestamp{}
+		if req.Timestamp != nil {
+			*ts = *req.Timestamp
+		}
+		ts.Nanos++
+		req.Timestamp = ts
+		forged := *preprep
+		forged.Request = &req
+		forged.RequestDigest = hashReq(&req)
+		logger.Debug("PBFT byzantine: equivocating pre-prepare for seqNo=%d to replica %d", preprep.SequenceNumber, receiverID)
+		return &Message{Payload: &Message_PrePrepare{&forged}}
+	}
+
+	if msg.GetCommit() != nil && instance.byzantine.has(byzantineDropCommits) {
+		return nil
+	}
+
+	if chkpt := msg.GetCheckpoint(); chkpt != nil && instance.byzantine.has(byzantineBadCheckpoint) {
+		forged := *chkpt
+		forged.BlockHash = base64.StdEncoding.EncodeToString(util.ComputeCryptoHash([]byte(chkpt.BlockHash)))
+		return &Message{Payload: &Message_Checkpoint{&forged}}
+	}
+
+	if vc := msg.GetViewChange(); vc != nil && instance.byzantine.has(byzantineForgeViewChange) {
+		forged := *vc
+		forged.View++
+		forged.Pset = nil
+		forged.Qset = nil
+		if err := instance.sign(&forged); err != nil {
+			logger.Error("PBFT byzantine: cannot sign forged view-change: %s", err)
+			return msg
+		}
+		return &Message{Payload: &Message_ViewChange{&forged}}
+	}
+
+	return msg
+}
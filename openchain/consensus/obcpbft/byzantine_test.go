@@ -0,0 +1,261 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package obcpbft
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestParseByzantine(t *testing.T) {
+	behaviors, err := parseByzantine(splitByzantine("equivocate, DropCommits,delay"))
+	if err != nil {
+		t.Fatalf("Failed to parse byzantine behaviors: %s", err)
+	}
+	if behaviors != byzantineEquivocate|byzantineDropCommits|byzantineDelay {
+		t.Errorf("Parsed wrong byzantine behaviors: %s", behaviors)
+	}
+
+	if behaviors, _ = parseByzantine(splitByzantine("true")); behaviors != byzantineOmit {
+		t.Errorf("Expected \"true\" to select the omit behavior, got %s", behaviors)
+	}
+	if behaviors, _ = parseByzantine(splitByzantine("false")); behaviors != 0 {
+		t.Errorf("Expected \"false\" to select no behavior, got %s", behaviors)
+	}
+	if _, err = parseByzantine([]string{"bogus"}); err == nil {
+		t.Errorf("Expected unknown byzantine behavior to be rejected")
+	}
+}
+
+func TestSetByzantine(t *testing.T) {
+	mock := newMock()
+	instance := newPbftCore(1, loadConfig(), mock, mock)
+	defer instance.close()
+
+	if err := instance.setByzantine([]string{"forgeviewchange", "badcheckpoint"}); err != nil {
+		t.Fatalf("Failed to set byzantine behaviors: %s", err)
+	}
+	expected := []string{"badcheckpoint", "forgeviewchange"}
+	if behaviors := instance.getByzantine(); !reflect.DeepEqual(behaviors, expected) {
+		t.Errorf("Expected byzantine behaviors %v, got %v", expected, behaviors)
+	}
+
+	if err := instance.setByzantine([]string{"omit", "bogus"}); err == nil {
+		t.Errorf("Expected unknown byzantine behavior to be rejected")
+	}
+	if behaviors := instance.getByzantine(); !reflect.DeepEqual(behaviors, expected) {
+		t.Errorf("Expected failed update to keep behaviors %v, got %v", expected, behaviors)
+	}
+
+	if err := instance.setByzantine([]string{"none"}); err != nil {
+		t.Fatalf("Failed to reset byzantine behaviors: %s", err)
+	}
+	if behaviors := instance.getByzantine(); len(behaviors) != 0 {
+		t.Errorf("Expected no byzantine behaviors, got %v", behaviors)
+	}
+}
+
+func runByzantineTestnet(t *testing.T, behaviors map[int]byzantineBehavior) []bool {
+	validatorCount := 4
+	net := makeTestnet(validatorCount, makeTestnetPbftCore)
+	defer net.close()
+
+	for id, b := range behaviors {
+		net.replicas[id].pbft.byzantine = b
+	}
+
+	msg := createOcMsgWithChainTx(1)
+	err := net.replicas[0].pbft.request(msg.Payload, uint64(generateBroadcaster(validatorCount)))
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+
+	err = net.process()
+	if err != nil {
+		t.Fatalf("Processing failed: %s", err)
+	}
+
+	executed := make([]bool, validatorCount)
+	for i, inst := range net.replicas {
+		blockHeight, _ := inst.ledger.GetBlockchainSize()
+		executed[i] = blockHeight > 1
+	}
+	return executed
+}
+
+func TestByzantineDropCommitsTolerated(t *testing.T) {
+	executed := runByzantineTestnet(t, map[int]byzantineBehavior{1: byzantineDropCommits})
+	for id, ok := range executed {
+		if !ok {
+			t.Errorf("Instance %d did not execute transaction despite a single faulty replica", id)
+		}
+	}
+}
+
+func TestByzantineDropCommits(t *testing.T) {
+	executed := runByzantineTestnet(t, map[int]byzantineBehavior{
+		1: byzantineDropCommits,
+		2: byzantineDropCommits,
+	})
+	// the faulty replicas still count their own commits, the correct ones must not execute
+	for _, id := range []int{0, 3} {
+		if executed[id] {
+			t.Errorf("Instance %d executed transaction without a commit quorum", id)
+		}
+	}
+}
+
+func TestByzantineEquivocate(t *testing.T) {
+	executed := runByzantineTestnet(t, map[int]byzantineBehavior{0: byzantineEquivocate})
+	for id, ok := range executed {
+		if ok {
+			t.Errorf("Instance %d executed transaction of an equivocating primary", id)
+		}
+	}
+}
+
+// byzantineRecorder records the messages a replica unicasts, by receiver
+type byzantineRecorder struct {
+	*mockStack
+	sync.Mutex
+	sent map[uint64][]*Message
+}
+
+func newByzantineRecorder() *byzantineRecorder {
+	return &byzantineRecorder{mockStack: newMock(), sent: make(map[uint64][]*Message)}
+}
+
+func (rec *byzantineRecorder) unicast(msgRaw []byte, receiverID uint64) error {
+	msg := &Message{}
+	if err := proto.Unmarshal(msgRaw, msg); err != nil {
+		return err
+	}
+	rec.Lock()
+	defer rec.Unlock()
+	rec.sent[receiverID] = append(rec.sent[receiverID], msg)
+	return nil
+}
+
+// take returns the number of messages sent to each replica, and forgets them
+func (rec *byzantineRecorder) take() map[uint64]int {
+	rec.Lock()
+	defer rec.Unlock()
+	counts := make(map[uint64]int)
+	for id, msgs := range rec.sent {
+		counts[id] = len(msgs)
+	}
+	rec.sent = make(map[uint64][]*Message)
+	return counts
+}
+
+func newByzantineInstance(t *testing.T, behaviors byzantineBehavior) (*pbftCore, *byzantineRecorder) {
+	rec := newByzantineRecorder()
+	instance := newPbftCore(0, loadConfig(), rec, rec.mockStack)
+	instance.byzantine = behaviors
+	return instance, rec
+}
+
+func TestByzantineOmit(t *testing.T) {
+	instance, rec := newByzantineInstance(t, byzantineOmit)
+	defer instance.close()
+
+	prepare := &Message{Payload: &Message_Prepare{&Prepare{SequenceNumber: 1, RequestDigest: "digest"}}}
+	omitted := 0
+	for i := 0; i < 60; i++ {
+		instance.byzantineBroadcast(prepare)
+		counts := rec.take()
+		if counts[0] != 0 {
+			t.Fatalf("Expected the replica not to send to itself")
+		}
+		if len(counts) < instance.N-2 {
+			t.Fatalf("Expected at most one replica to be skipped, reached %d", len(counts))
+		}
+		if len(counts) == instance.N-2 {
+			omitted++
+		}
+	}
+	if omitted == 0 {
+		t.Fatalf("Expected some broadcasts to skip a replica")
+	}
+}
+
+func TestByzantineDelay(t *testing.T) {
+	instance, rec := newByzantineInstance(t, byzantineDelay)
+	defer instance.close()
+	instance.byzantineDelay = 50 * time.Millisecond
+
+	instance.byzantineBroadcast(&Message{Payload: &Message_Prepare{&Prepare{SequenceNumber: 1, RequestDigest: "digest"}}})
+	if counts := rec.take(); len(counts) != 0 {
+		t.Fatalf("Expected the messages to be held back, sent %v", counts)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if counts := rec.take(); len(counts) != instance.N-1 {
+		t.Fatalf("Expected the messages to be sent after the delay, sent %v", counts)
+	}
+}
+
+func TestByzantineBadCheckpoint(t *testing.T) {
+	instance, _ := newByzantineInstance(t, byzantineBadCheckpoint)
+	defer instance.close()
+
+	chkpt := &Checkpoint{SequenceNumber: 10, BlockNumber: 3, BlockHash: "hash"}
+	out := instance.byzantineMessage(&Message{Payload: &Message_Checkpoint{chkpt}}, 1)
+	forged := out.GetCheckpoint()
+	if forged == nil || forged.BlockHash == chkpt.BlockHash || forged.SequenceNumber != chkpt.SequenceNumber {
+		t.Fatalf("Expected a checkpoint with a wrong block hash, got %v", out)
+	}
+	if chkpt.BlockHash != "hash" {
+		t.Fatalf("Expected the original checkpoint to be left alone")
+	}
+	prepare := &Message{Payload: &Message_Prepare{&Prepare{SequenceNumber: 1}}}
+	if instance.byzantineMessage(prepare, 1) != prepare {
+		t.Fatalf("Expected other messages to be sent as they are")
+	}
+}
+
+func TestByzantineForgeViewChange(t *testing.T) {
+	instance, _ := newByzantineInstance(t, byzantineForgeViewChange)
+	defer instance.close()
+
+	vc := &ViewChange{View: 1, H: 10, Pset: []*ViewChange_PQ{{SequenceNumber: 11, Digest: "digest"}}, Qset: []*ViewChange_PQ{{SequenceNumber: 11, Digest: "digest"}}}
+	forged := instance.byzantineMessage(&Message{Payload: &Message_ViewChange{vc}}, 1).GetViewChange()
+	if forged == nil || forged.View != 2 || forged.Pset != nil || forged.Qset != nil {
+		t.Fatalf("Expected a view-change for the next view with empty P and Q sets, got %v", forged)
+	}
+	if forged.Signature == nil {
+		t.Fatalf("Expected the forged view-change to be signed")
+	}
+	if vc.View != 1 || len(vc.Pset) != 1 {
+		t.Fatalf("Expected the original view-change to be left alone")
+	}
+}
+
+func TestByzantineOmitTolerated(t *testing.T) {
+	executed := runByzantineTestnet(t, map[int]byzantineBehavior{1: byzantineOmit})
+	for id, ok := range executed {
+		if !ok {
+			t.Errorf("Instance %d did not execute transaction despite a single omitting replica", id)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package obcpbft
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// persistCheckpointCertificate hands the stable checkpoint certificate for
+// chkpt to the stack, if it can store certificates. The certificate is made
+// of the signed checkpoints which match chkpt, and the state hash of our own
+// block at that checkpoint.
+func (instance *pbftCore) persistCheckpointCertificate(chkpt *Checkpoint) {
+	store, ok := instance.ledger.(consensus.CheckpointCertificateStore)
+	if !ok {
+		return
+	}
+
+	blockHash, err := base64.StdEncoding.DecodeString(chkpt.BlockHash)
+	if err != nil {
+		logger.Error("Replica %d cannot decode the block hash of stable checkpoint %d: %s", instance.id, chkpt.SequenceNumber, err)
+		return
+	}
+	block, err := instance.ledger.GetBlock(chkpt.BlockNumber)
+	if err != nil {
+		logger.Warning("Replica %d cannot retrieve block %d of stable checkpoint %d: %s", instance.id, chkpt.BlockNumber, chkpt.SequenceNumber, err)
+		return
+	}
+	if ourHash, err := instance.ledger.HashBlock(block); err != nil || !bytes.Equal(ourHash, blockHash) {
+		logger.Warning("Replica %d does not have the block %d of stable checkpoint %d, not storing its certificate", instance.id, chkpt.BlockNumber, chkpt.SequenceNumber)
+		return
+	}
+
+	cert := &protos.CheckpointCertificate{
+		BlockNumber:    chkpt.BlockNumber,
+		BlockHash:      blockHash,
+		StateHash:      block.StateHash,
+		SequenceNumber: chkpt.SequenceNumber,
+	}
+	for testChkpt, signature := range instance.checkpointSigs {
+		if testChkpt.SequenceNumber != chkpt.SequenceNumber || testChkpt.BlockHash != chkpt.BlockHash || testChkpt.BlockNumber != chkpt.BlockNumber {
+			continue
+		}
+		payload, err := payloadBytes(&Message{Payload: &Message_Checkpoint{&testChkpt}})
+		if err != nil {
+			logger.Error("Replica %d cannot marshal the checkpoint of replica %d: %s", instance.id, testChkpt.ReplicaId, err)
+			continue
+		}
+		validator, _ := getValidatorHandle(testChkpt.ReplicaId)
+		cert.Checkpoints = append(cert.Checkpoints, &protos.SignedCheckpoint{
+			ReplicaID: testChkpt.ReplicaId,
+			Validator: validator,
+			Payload:   payload,
+			Signature: signature,
+		})
+	}
+	if len(cert.Checkpoints) < instance.intersectionQuorum() {
+		logger.Debug("Replica %d has only %d signed checkpoints for seqNo %d, not storing a certificate",
+			instance.id, len(cert.Checkpoints), chkpt.SequenceNumber)
+		return
+	}
+	sort.Sort(signedCheckpointsByReplica(cert.Checkpoints))
+
+	if err := store.PutCheckpointCertificate(cert); err != nil {
+		logger.Error("Replica %d could not store the certificate of stable checkpoint %d: %s", instance.id, chkpt.SequenceNumber, err)
+		return
+	}
+	logger.Debug("Replica %d stored certificate of stable checkpoint %d for block %d", instance.id, chkpt.SequenceNumber, chkpt.BlockNumber)
+}
+
+type signedCheckpointsByReplica []*protos.SignedCheckpoint
+
+func (a signedCheckpointsByReplica) Len() int           { return len(a) }
+func (a signedCheckpointsByReplica) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a signedCheckpointsByReplica) Less(i, j int) bool { return a[i].ReplicaID < a[j].ReplicaID }
+
+// VerifyCheckpointCertificate checks that a stable checkpoint certificate
+// carries at least quorum checkpoints for its block, each from a distinct
+// replica and with a signature accepted by verify. Light clients pass
+// 2f+1 as quorum, and a verify which checks the signature against the
+// enrollment key of the validator with the given replica ID. The state hash
+// is covered through the block: check that the block hashes to BlockHash
+// before trusting its StateHash.
+func VerifyCheckpointCertificate(cert *protos.CheckpointCertificate, quorum int, verify func(replicaID uint64, signature []byte, payload []byte) error) error {
+	blockHash := base64.StdEncoding.EncodeToString(cert.BlockHash)
+	seen := make(map[uint64]bool)
+	for _, signed := range cert.Checkpoints {
+		if seen[signed.ReplicaID] {
+			return fmt.Errorf("Certificate holds several checkpoints from replica %d", signed.ReplicaID)
+		}
+		msg := &Message{}
+		if err := proto.Unmarshal(signed.Payload, msg); err != nil {
+			return fmt.Errorf("Checkpoint of replica %d cannot be unmarshaled: %s", signed.ReplicaID, err)
+		}
+		chkpt := msg.GetCheckpoint()
+		if chkpt == nil {
+			return fmt.Errorf("Payload of replica %d is not a checkpoint", signed.ReplicaID)
+		}
+		if chkpt.ReplicaId != signed.ReplicaID || chkpt.SequenceNumber != cert.SequenceNumber ||
+			chkpt.BlockNumber != cert.BlockNumber || chkpt.BlockHash != blockHash {
+			return fmt.Errorf("Checkpoint of replica %d does not match the certificate", signed.ReplicaID)
+		}
+		if err := verify(signed.ReplicaID, signed.Signature, signed.Payload); err != nil {
+			return fmt.Errorf("Checkpoint of replica %d has an invalid signature: %s", signed.ReplicaID, err)
+		}
+		seen[signed.ReplicaID] = true
+	}
+	if len(seen) < quorum {
+		return fmt.Errorf("Certificate holds %d checkpoints, needs %d", len(seen), quorum)
+	}
+	return nil
+}
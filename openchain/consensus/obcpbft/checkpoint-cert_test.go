@@ -0,0 +1,120 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package obcpbft
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	gp "google/protobuf"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// mock signatures are the signed payload itself
+func verifyMockSignature(replicaID uint64, signature []byte, payload []byte) error {
+	if !bytes.Equal(signature, payload) {
+		return fmt.Errorf("signature does not match")
+	}
+	return nil
+}
+
+func TestCheckpointCertificate(t *testing.T) {
+	validatorCount := 4
+	net := makeTestnet(validatorCount, func(inst *instance) {
+		makeTestnetPbftCore(inst)
+		inst.pbft.K = 2
+		inst.pbft.L = 4
+	})
+	defer net.close()
+
+	for i := int64(1); i <= 2; i++ {
+		tx := &pb.Transaction{Type: pb.Transaction_CHAINCODE_NEW, Timestamp: &gp.Timestamp{Seconds: i}}
+		txPacked, err := proto.Marshal(tx)
+		if err != nil {
+			t.Fatalf("Failed to marshal TX block: %s", err)
+		}
+		msg := &Message{Payload: &Message_Request{&Request{Payload: txPacked, ReplicaId: uint64(generateBroadcaster(validatorCount))}}}
+		net.replicas[0].pbft.recvMsgSync(msg, msg.GetRequest().ReplicaId)
+		net.process()
+	}
+
+	quorum := net.replicas[0].pbft.intersectionQuorum()
+	for _, inst := range net.replicas {
+		if len(inst.certs) != 1 {
+			t.Fatalf("Replica %d expected to store 1 checkpoint certificate, stored %d", inst.id, len(inst.certs))
+		}
+		cert := inst.certs[0]
+		if cert.SequenceNumber != 2 || cert.BlockNumber != 2 {
+			t.Errorf("Replica %d stored certificate for seqNo %d, block %d, expected seqNo 2, block 2", inst.id, cert.SequenceNumber, cert.BlockNumber)
+		}
+		block, _ := inst.GetBlock(cert.BlockNumber)
+		if !bytes.Equal(cert.StateHash, block.StateHash) {
+			t.Errorf("Replica %d stored certificate with state hash %x, expected %x", inst.id, cert.StateHash, block.StateHash)
+		}
+		if len(cert.Checkpoints) < quorum {
+			t.Errorf("Replica %d stored certificate with %d checkpoints, expected at least %d", inst.id, len(cert.Checkpoints), quorum)
+		}
+		if err := VerifyCheckpointCertificate(cert, quorum, verifyMockSignature); err != nil {
+			t.Errorf("Replica %d stored certificate which does not verify: %s", inst.id, err)
+		}
+		if len(inst.pbft.checkpointSigs) != 0 {
+			t.Errorf("Replica %d expected to clean up checkpoint signatures, has %d", inst.id, len(inst.pbft.checkpointSigs))
+		}
+	}
+}
+
+func TestVerifyCheckpointCertificate(t *testing.T) {
+	cert := &pb.CheckpointCertificate{BlockNumber: 3, BlockHash: []byte("hash"), SequenceNumber: 10}
+	for replicaID := uint64(0); replicaID < 3; replicaID++ {
+		payload, _ := payloadBytes(&Message{Payload: &Message_Checkpoint{&Checkpoint{
+			SequenceNumber: 10,
+			ReplicaId:      replicaID,
+			BlockNumber:    3,
+			BlockHash:      "aGFzaA==",
+		}}})
+		cert.Checkpoints = append(cert.Checkpoints, &pb.SignedCheckpoint{ReplicaID: replicaID, Payload: payload, Signature: payload})
+	}
+
+	if err := VerifyCheckpointCertificate(cert, 3, verifyMockSignature); err != nil {
+		t.Fatalf("Expected certificate to verify: %s", err)
+	}
+	if err := VerifyCheckpointCertificate(cert, 4, verifyMockSignature); err == nil {
+		t.Errorf("Expected certificate without quorum to be rejected")
+	}
+
+	cert.Checkpoints[2].Signature = []byte("forged")
+	if err := VerifyCheckpointCertificate(cert, 3, verifyMockSignature); err == nil {
+		t.Errorf("Expected certificate with a forged signature to be rejected")
+	}
+
+	cert.Checkpoints[2] = cert.Checkpoints[1]
+	if err := VerifyCheckpointCertificate(cert, 3, verifyMockSignature); err == nil {
+		t.Errorf("Expected certificate with a duplicate checkpoint to be rejected")
+	}
+
+	cert.Checkpoints = cert.Checkpoints[:2]
+	cert.BlockNumber = 4
+	if err := VerifyCheckpointCertificate(cert, 2, verifyMockSignature); err == nil {
+		t.Errorf("Expected checkpoints for another block to be rejected")
+	}
+}
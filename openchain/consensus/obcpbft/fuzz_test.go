@@ -142,7 +142,7 @@ func TestMinimalFuzz(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to marshal TX block: %s", err)
 		}
-		msg := &Message{&Message_Request{&Request{Payload: txPacked, ReplicaId: uint64(generateBroadcaster(validatorCount))}}}
+		msg := &Message{Payload: &Message_Request{&Request{Payload: txPacked, ReplicaId: uint64(generateBroadcaster(validatorCount))}}}
 		for _, inst := range net.replicas {
 			inst.pbft.recvMsgSync(msg, msg.GetRequest().ReplicaId)
 		}
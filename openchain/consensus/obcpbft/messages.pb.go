@@ -18,6 +18,7 @@ It has these top-level messages:
 	ViewChange
 	NewView
 	FetchRequest
+	SessionKey
 	BatchMessage
 	SieveMessage
 	Execute
@@ -50,7 +51,10 @@ type Message struct {
 	//	*Message_NewView
 	//	*Message_FetchRequest
 	//	*Message_ReturnRequest
-	Payload isMessage_Payload `protobuf_oneof:"payload"`
+	//	*Message_SessionKey
+	Payload       isMessage_Payload `protobuf_oneof:"payload"`
+	Signature     []byte            `protobuf:"bytes,11,opt,name=signature,proto3" json:"signature,omitempty"`
+	Authenticator [][]byte          `protobuf:"bytes,12,rep,name=authenticator,proto3" json:"authenticator,omitempty"`
 }
 
 func (m *Message) Reset()         { *m = Message{} }
@@ -88,6 +92,9 @@ type Message_FetchRequest struct {
 type Message_ReturnRequest struct {
 	ReturnRequest *Request `protobuf:"bytes,9,opt,name=return_request,oneof"`
 }
+type Message_SessionKey struct {
+	SessionKey *SessionKey `protobuf:"bytes,10,opt,name=session_key,oneof"`
+}
 
 func (*Message_Request) isMessage_Payload()       {}
 func (*Message_PrePrepare) isMessage_Payload()    {}
@@ -98,6 +105,7 @@ func (*Message_ViewChange) isMessage_Payload()    {}
 func (*Message_NewView) isMessage_Payload()       {}
 func (*Message_FetchRequest) isMessage_Payload()  {}
 func (*Message_ReturnRequest) isMessage_Payload() {}
+func (*Message_SessionKey) isMessage_Payload()    {}
 
 func (m *Message) GetPayload() isMessage_Payload {
 	if m != nil {
@@ -169,6 +177,13 @@ func (m *Message) GetReturnRequest() *Request {
 	return nil
 }
 
+func (m *Message) GetSessionKey() *SessionKey {
+	if x, ok := m.GetPayload().(*Message_SessionKey); ok {
+		return x.SessionKey
+	}
+	return nil
+}
+
 // XXX_OneofFuncs is for the internal use of the proto package.
 func (*Message) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
 	return _Message_OneofMarshaler, _Message_OneofUnmarshaler, []interface{}{
@@ -181,6 +196,7 @@ func (*Message) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error
 		(*Message_NewView)(nil),
 		(*Message_FetchRequest)(nil),
 		(*Message_ReturnRequest)(nil),
+		(*Message_SessionKey)(nil),
 	}
 }
 
@@ -233,6 +249,11 @@ func _Message_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
 		if err := b.EncodeMessage(x.ReturnRequest); err != nil {
 			return err
 		}
+	case *Message_SessionKey:
+		b.EncodeVarint(10<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.SessionKey); err != nil {
+			return err
+		}
 	case nil:
 	default:
 		return fmt.Errorf("Message.Payload has unexpected type %T", x)
@@ -315,6 +336,14 @@ func _Message_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer
 		err := b.DecodeMessage(msg)
 		m.Payload = &Message_ReturnRequest{msg}
 		return true, err
+	case 10: // payload.session_key
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(SessionKey)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_SessionKey{msg}
+		return true, err
 	default:
 		return false, nil
 	}
@@ -479,6 +508,16 @@ func (m *FetchRequest) Reset()         { *m = FetchRequest{} }
 func (m *FetchRequest) String() string { return proto.CompactTextString(m) }
 func (*FetchRequest) ProtoMessage()    {}
 
+type SessionKey struct {
+	ReplicaId uint64 `protobuf:"varint,1,opt,name=replica_id" json:"replica_id,omitempty"`
+	PublicKey []byte `protobuf:"bytes,2,opt,name=public_key,proto3" json:"public_key,omitempty"`
+	Reply     bool   `protobuf:"varint,3,opt,name=reply" json:"reply,omitempty"`
+}
+
+func (m *SessionKey) Reset()         { *m = SessionKey{} }
+func (m *SessionKey) String() string { return proto.CompactTextString(m) }
+func (*SessionKey) ProtoMessage()    {}
+
 type BatchMessage struct {
 	// Types that are valid to be assigned to Payload:
 	//	*BatchMessage_Request
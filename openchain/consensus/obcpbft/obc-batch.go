@@ -37,18 +37,58 @@ type obcBatch struct {
 	pbft  *pbftCore
 
 	batchSize        int
+	batchBytes       int // maximum size of a batch in bytes; 0 means unbounded
+	batchMin         int // preferred minimum number of requests per batch
 	batchStore       [][]byte
+	batchStoreBytes  int
+	batchStart       time.Time // when the first request of the current batch arrived
 	batchTimer       *time.Timer
 	batchTimerActive bool
 	batchTimeout     time.Duration
+
+	lastArrival  time.Time     // when the primary last received a request
+	arrivals     uint64        // how many requests the primary received
+	interArrival time.Duration // moving average of the time between requests
+
+	batchCuts map[batchCutReason]uint64 // how many batches were cut for each reason
+}
+
+// batchCutReason records why the primary sent a batch
+type batchCutReason int
+
+const (
+	batchCutSize    batchCutReason = iota // batchsize requests were collected
+	batchCutBytes                         // the next request would exceed batchbytes
+	batchCutTimeout                       // timeout.batch expired
+	batchCutRate                          // the next request is not expected in time
+)
+
+func (r batchCutReason) String() string {
+	switch r {
+	case batchCutSize:
+		return "size"
+	case batchCutBytes:
+		return "bytes"
+	case batchCutTimeout:
+		return "timeout"
+	case batchCutRate:
+		return "arrival rate"
+	}
+	return "unknown"
 }
 
 func newObcBatch(id uint64, config *viper.Viper, stack consensus.Stack) *obcBatch {
 	var err error
 	op := &obcBatch{stack: stack}
 	op.pbft = newPbftCore(id, config, op, stack)
-	op.batchSize = config.GetInt("general.batchSize")
+	op.batchSize = config.GetInt("general.batchsize")
+	op.batchBytes = config.GetInt("general.batchbytes")
+	op.batchMin = config.GetInt("general.batchmin")
+	if op.batchMin < 0 || op.batchMin > op.batchSize {
+		panic(fmt.Errorf("Preferred minimum batch size %d must be between 0 and the batch size %d", op.batchMin, op.batchSize))
+	}
 	op.batchStore = nil
+	op.batchCuts = make(map[batchCutReason]uint64)
 	op.batchTimeout, err = time.ParseDuration(config.GetString("general.timeout.batch"))
 	if err != nil {
 		panic(fmt.Errorf("Cannot parse batch timeout: %s", err))
@@ -125,10 +165,45 @@ func (op *obcBatch) Close() {
 	op.batchTimer.Reset(0)
 }
 
+// GetStatus reports the state of the replica
+func (op *obcBatch) GetStatus() (*pb.ConsensusStatus, error) {
+	status := newPbftStatus("batch", op.pbft)
+
+	op.pbft.lock()
+	defer op.pbft.unlock()
+	status.Pbft.Batch = &pb.PbftBatchStatus{
+		PendingRequests:   uint64(len(op.batchStore)),
+		PendingBytes:      uint64(op.batchStoreBytes),
+		InterArrivalNanos: uint64(op.interArrival),
+		SizeCuts:          op.batchCuts[batchCutSize],
+		ByteCuts:          op.batchCuts[batchCutBytes],
+		TimeoutCuts:       op.batchCuts[batchCutTimeout],
+		RateCuts:          op.batchCuts[batchCutRate],
+	}
+	return status, nil
+}
+
+// SetByzantine replaces the byzantine behaviors of the replica
+func (op *obcBatch) SetByzantine(behaviors []string) error {
+	return op.pbft.setByzantine(behaviors)
+}
+
+// GetByzantine returns the active byzantine behaviors of the replica
+func (op *obcBatch) GetByzantine() []string {
+	return op.pbft.getByzantine()
+}
+
+// StateTransfer returns the controller of the state transfer of the replica
+func (op *obcBatch) StateTransfer() consensus.StateTransferController {
+	return op.pbft.sts
+}
+
 // Drain will block until all remaining execution has been handled
 func (op *obcBatch) Drain() {
 	op.pbft.lock()
-	op.sendBatch()
+	if err := op.sendBatch(batchCutTimeout); err != nil { // flush as if the batch timer expired
+		logger.Error("Replica %d could not flush its batch: %v", op.pbft.id, err)
+	}
 	op.pbft.unlock()
 	op.pbft.drain()
 }
@@ -171,6 +246,9 @@ func (op *obcBatch) validate(txRaw []byte) error {
 }
 
 // execute an opaque request which corresponds to an OBC Transaction
+// block. Transactions which do not validate or fail to execute are
+// excluded from the batch and recorded with an error result, so that one
+// bad transaction cannot prevent the rest of the block from committing.
 func (op *obcBatch) execute(tbRaw []byte) {
 	tb := &pb.TransactionBlock{}
 	err := proto.Unmarshal(tbRaw, tb)
@@ -178,16 +256,22 @@ func (op *obcBatch) execute(tbRaw []byte) {
 		return
 	}
 
-	txs := tb.Transactions
 	txBatchID := base64.StdEncoding.EncodeToString(util.ComputeCryptoHash(tbRaw))
 
-	for i, tx := range txs {
+	var txs []*pb.Transaction
+	var rejected []*pb.TransactionResult
+	for i, tx := range tb.Transactions {
 		txRaw, _ := proto.Marshal(tx)
 		if err = op.validate(txRaw); err != nil {
-			err = fmt.Errorf("Request in transaction %d from batch %s did not verify: %s", i, txBatchID, err)
-			logger.Error(err.Error())
-			return
+			logger.Warning("Request in transaction %d from batch %s did not verify, rejecting it: %s", i, txBatchID, err)
+			rejected = append(rejected, &pb.TransactionResult{
+				Uuid:      tx.Uuid,
+				ErrorCode: consensus.TxErrorRejected,
+				Error:     err.Error(),
+			})
+			continue
 		}
+		txs = append(txs, tx)
 	}
 
 	if err := op.stack.BeginTxBatch(txBatchID); err != nil {
@@ -196,6 +280,7 @@ func (op *obcBatch) execute(tbRaw []byte) {
 		return
 	}
 
+	// the stack isolates transactions which fail to execute itself
 	if _, err := op.stack.ExecTxs(txBatchID, txs); nil != err {
 		err = fmt.Errorf("Fail to execute transaction batch %s: %v", txBatchID, err)
 		logger.Error(err.Error())
@@ -205,6 +290,17 @@ func (op *obcBatch) execute(tbRaw []byte) {
 		return
 	}
 
+	if len(rejected) > 0 {
+		if err = op.stack.RejectTxs(txBatchID, rejected); err != nil {
+			err = fmt.Errorf("Failed to record rejected transactions of batch %s: %v", txBatchID, err)
+			logger.Error(err.Error())
+			if err = op.stack.RollbackTxBatch(txBatchID); err != nil {
+				panic(fmt.Errorf("Unable to rollback transaction batch %s: %v", txBatchID, err))
+			}
+			return
+		}
+	}
+
 	if _, err = op.stack.CommitTxBatch(txBatchID, nil); err != nil {
 		err = fmt.Errorf("Failed to commit transaction batch %s to the ledger: %v", txBatchID, err)
 		logger.Error(err.Error())
@@ -227,26 +323,84 @@ func (op *obcBatch) viewChange(curView uint64) {
 // =============================================================================
 
 func (op *obcBatch) leaderProcReq(req []byte) error {
-	op.batchStore = append(op.batchStore, req)
+	now := time.Now()
+	op.observeArrival(now)
 
-	if !op.batchTimerActive {
-		op.startBatchTimer()
+	if op.batchBytes > 0 && len(op.batchStore) > 0 && op.batchStoreBytes+len(req) > op.batchBytes {
+		if err := op.sendBatch(batchCutBytes); err != nil {
+			return err
+		}
+	}
+
+	op.batchStore = append(op.batchStore, req)
+	op.batchStoreBytes += len(req)
+	if len(op.batchStore) == 1 {
+		op.batchStart = now
 	}
 
 	if len(op.batchStore) >= op.batchSize {
-		op.sendBatch()
+		return op.sendBatch(batchCutSize)
+	}
+	if op.batchBytes > 0 && op.batchStoreBytes >= op.batchBytes {
+		return op.sendBatch(batchCutBytes)
 	}
 
+	op.scheduleBatch(now)
 	return nil
 }
 
-func (op *obcBatch) sendBatch() error {
+// observeArrival updates the moving average of the time between requests
+func (op *obcBatch) observeArrival(now time.Time) {
+	if op.arrivals > 0 {
+		sample := now.Sub(op.lastArrival)
+		if op.arrivals == 1 {
+			op.interArrival = sample
+		} else {
+			op.interArrival = (7*op.interArrival + sample) / 8
+		}
+	}
+	op.arrivals++
+	op.lastArrival = now
+}
+
+// scheduleBatch decides how long the primary waits for more requests.
+// Below the preferred minimum it waits until timeout.batch expires. Once
+// the minimum is reached, waiting only pays off if the next request is
+// expected before the timeout; otherwise the batch is sent right away, so
+// that a light load does not suffer the full timeout. A preferred minimum
+// of 0 disables this, and the primary always waits for the timeout.
+func (op *obcBatch) scheduleBatch(now time.Time) {
+	wait := op.batchTimeout - now.Sub(op.batchStart)
+	if op.batchMin > 0 && len(op.batchStore) >= op.batchMin && op.arrivals > 1 {
+		if op.interArrival >= wait {
+			if err := op.sendBatch(batchCutRate); err != nil {
+				logger.Error("Replica %d could not send batch: %v", op.pbft.id, err)
+			}
+			return
+		}
+		// leave some slack for jitter before concluding the rate dropped
+		if 2*op.interArrival < wait {
+			wait = 2 * op.interArrival
+		}
+	}
+
+	if op.batchTimerActive {
+		op.stopBatchTimer()
+	}
+	op.startBatchTimer(wait)
+}
+
+func (op *obcBatch) sendBatch(reason batchCutReason) error {
 	op.stopBatchTimer()
+	op.batchCuts[reason]++
+	logger.Debug("Replica %d sending batch of %d requests (%d bytes), cut by %s",
+		op.pbft.id, len(op.batchStore), op.batchStoreBytes, reason)
 
 	// assemble new Request message
 	var txs []*pb.Transaction
 	store := op.batchStore
 	op.batchStore = nil
+	op.batchStoreBytes = 0
 	for _, req := range store {
 		tx := &pb.Transaction{}
 		err := proto.Unmarshal(req, tx)
@@ -284,15 +438,21 @@ func (op *obcBatch) batchTimerHander() {
 			op.pbft.lock()
 			logger.Info("Replica %d batch timer expired", op.pbft.id)
 			if op.pbft.activeView && (len(op.batchStore) > 0) {
-				op.sendBatch()
+				reason := batchCutRate
+				if time.Since(op.batchStart) >= op.batchTimeout {
+					reason = batchCutTimeout
+				}
+				if err := op.sendBatch(reason); err != nil {
+					logger.Error("Replica %d could not send batch: %v", op.pbft.id, err)
+				}
 			}
 			op.pbft.unlock()
 		}
 	}
 }
 
-func (op *obcBatch) startBatchTimer() {
-	op.batchTimer.Reset(op.batchTimeout)
+func (op *obcBatch) startBatchTimer(timeout time.Duration) {
+	op.batchTimer.Reset(timeout)
 	logger.Debug("Replica %d started the batch timer", op.pbft.id)
 	op.batchTimerActive = true
 }
@@ -22,8 +22,11 @@ package obcpbft
 import (
 	"fmt"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
 	pb "github.com/hyperledger-incubator/obc-peer/protos"
 )
 
@@ -81,3 +84,247 @@ func TestNetworkBatch(t *testing.T) {
 		}
 	}
 }
+
+func TestBatchFailedTx(t *testing.T) {
+	validatorCount := 4
+	net := makeTestnet(validatorCount, func(inst *instance) {
+		makeTestnetBatch(inst, 3)
+		inst.execTxFail = func(tx *pb.Transaction) error {
+			if string(tx.Payload) == "2" {
+				return fmt.Errorf("transaction %s is poisoned", tx.Payload)
+			}
+			return nil
+		}
+	})
+	defer net.close()
+
+	broadcaster := net.handles[generateBroadcaster(validatorCount)]
+	for i := int64(1); i <= 3; i++ {
+		if err := net.replicas[0].consenter.RecvMsg(createOcMsgWithChainTx(i), broadcaster); err != nil {
+			t.Fatalf("External request was not processed by primary: %v", err)
+		}
+	}
+	net.process()
+
+	var blockHash []byte
+	for _, inst := range net.replicas {
+		block, err := inst.GetBlock(1)
+		if err != nil {
+			t.Fatalf("Replica %d expected a new block on the chain, but could not retrieve it: %s", inst.id, err)
+		}
+		if len(block.Transactions) != 2 {
+			t.Fatalf("Replica %d committed %d transactions, expected the 2 which did not fail", inst.id, len(block.Transactions))
+		}
+		for _, tx := range block.Transactions {
+			if string(tx.Payload) == "2" {
+				t.Fatalf("Replica %d committed the failing transaction", inst.id)
+			}
+		}
+		var failed []*pb.TransactionResult
+		for _, result := range block.NonHashData.TransactionResults {
+			if result.ErrorCode != 0 {
+				failed = append(failed, result)
+			}
+		}
+		if len(failed) != 1 || failed[0].ErrorCode != consensus.TxErrorExecution || failed[0].Error == "" {
+			t.Fatalf("Replica %d expected one execution error result, found %v", inst.id, failed)
+		}
+		hash, _ := inst.ledger.HashBlock(block)
+		if blockHash != nil && string(hash) != string(blockHash) {
+			t.Fatalf("Replica %d committed a different block", inst.id)
+		}
+		blockHash = hash
+	}
+}
+
+func TestBatchBytes(t *testing.T) {
+	validatorCount := 4
+	net := makeTestnet(validatorCount, func(inst *instance) {
+		makeTestnetBatch(inst, 10)
+	})
+	defer net.close()
+
+	primary := net.replicas[0].consenter.(*obcBatch)
+	small := createOcMsgWithChainTx(1)
+	primary.batchBytes = 2*len(small.Payload) + 1
+
+	for i := int64(1); i <= 3; i++ {
+		if err := primary.RecvMsg(createOcMsgWithChainTx(i), net.handles[0]); err != nil {
+			t.Fatalf("Request was not processed by primary: %v", err)
+		}
+	}
+
+	primary.pbft.lock()
+	pending, cuts := len(primary.batchStore), primary.batchCuts[batchCutBytes]
+	primary.pbft.unlock()
+	if cuts != 1 || pending != 1 {
+		t.Fatalf("Expected one batch cut by size in bytes and one pending request, got %d cuts and %d pending", cuts, pending)
+	}
+
+	net.process()
+	block, err := net.replicas[1].GetBlock(1)
+	if err != nil {
+		t.Fatalf("Expected a new block on the chain, but could not retrieve it: %s", err)
+	}
+	if len(block.Transactions) != 2 {
+		t.Fatalf("Expected the first batch to hold 2 requests, found %d", len(block.Transactions))
+	}
+}
+
+func TestBatchAdaptiveTimeout(t *testing.T) {
+	validatorCount := 4
+	net := makeTestnet(validatorCount, func(inst *instance) {
+		makeTestnetBatch(inst, 10)
+		inst.consenter.(*obcBatch).batchMin = 1
+		inst.consenter.(*obcBatch).batchTimeout = 50 * time.Millisecond
+	})
+	defer net.close()
+
+	primary := net.replicas[0].consenter.(*obcBatch)
+
+	// without an arrival rate estimate, the primary waits for the timeout
+	primary.RecvMsg(createOcMsgWithChainTx(1), net.handles[0])
+	time.Sleep(100 * time.Millisecond)
+
+	// the next request arrives after more than the timeout, so the
+	// primary does not expect another one in time and sends it right away
+	primary.RecvMsg(createOcMsgWithChainTx(2), net.handles[0])
+
+	primary.pbft.lock()
+	defer primary.pbft.unlock()
+	if len(primary.batchStore) != 0 {
+		t.Errorf("Expected no pending requests, found %d", len(primary.batchStore))
+	}
+	if primary.batchCuts[batchCutTimeout] != 1 || primary.batchCuts[batchCutRate] != 1 {
+		t.Errorf("Expected one batch cut by timeout and one by arrival rate, got %v", primary.batchCuts)
+	}
+}
+
+// TestBatchArrivalRate feeds the primary requests with made-up arrival
+// times: it only cuts a batch early once the preferred minimum is reached
+// and the next request is not expected before the batch timeout, and never
+// when the adaptation is disabled.
+func TestBatchArrivalRate(t *testing.T) {
+	validatorCount := 4
+	net := makeTestnet(validatorCount, func(inst *instance) {
+		makeTestnetBatch(inst, 10)
+	})
+	defer net.close()
+
+	primary := net.replicas[0].consenter.(*obcBatch)
+	primary.batchTimeout = time.Hour // the batch timer must not interfere
+
+	loads := []struct {
+		name     string
+		batchMin int
+		interval time.Duration
+		cut      bool
+	}{
+		{"light", 1, 2 * time.Hour, true},
+		{"light below minimum", 3, 2 * time.Hour, false},
+		{"heavy", 1, time.Second, false},
+		{"light, adaptation disabled", 0, 2 * time.Hour, false},
+	}
+
+	now := time.Now()
+	primary.pbft.lock()
+	defer primary.pbft.unlock()
+	for i, load := range loads {
+		primary.batchMin = load.batchMin
+		primary.batchStore = nil
+		primary.arrivals = 0
+		primary.batchCuts = make(map[batchCutReason]uint64)
+
+		for j := 0; j < 2; j++ {
+			now = now.Add(load.interval)
+			primary.observeArrival(now)
+		}
+		primary.batchStore = [][]byte{createOcMsgWithChainTx(int64(i + 1)).Payload}
+		primary.batchStart = now
+		primary.scheduleBatch(now)
+
+		if cut := primary.batchCuts[batchCutRate] == 1; cut != load.cut {
+			t.Errorf("%s load: expected a batch cut by arrival rate to be %v, got cuts %v", load.name, load.cut, primary.batchCuts)
+		}
+		if !load.cut && !primary.batchTimerActive {
+			t.Errorf("%s load: expected the primary to wait for more requests", load.name)
+		}
+	}
+}
+
+// benchmarkBatch submits b.N requests to the primary, one every interval,
+// and waits until the primary executed them all, so that the time per
+// operation is the inverse of the throughput. The mean latency from
+// submission to execution, and how the batches were cut, are logged.
+func benchmarkBatch(b *testing.B, batchMin int, interval time.Duration) {
+	validatorCount := 4
+	net := makeTestnet(validatorCount, func(inst *instance) {
+		makeTestnetBatch(inst, 10)
+		batch := inst.consenter.(*obcBatch)
+		batch.batchMin = batchMin
+		batch.batchTimeout = 50 * time.Millisecond
+	})
+	defer net.close()
+
+	var lock sync.Mutex
+	submitted := make(map[string]time.Time)
+	executed := make(map[string]time.Time)
+	net.replicas[0].execTxResult = func(txs []*pb.Transaction) ([]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, tx := range txs {
+			executed[string(tx.Payload)] = time.Now()
+		}
+		return nil, nil
+	}
+	go net.processContinually()
+
+	primary := net.replicas[0].consenter.(*obcBatch)
+	b.ResetTimer()
+	for i := 1; i <= b.N; i++ {
+		msg := createOcMsgWithChainTx(int64(i))
+		lock.Lock()
+		submitted[fmt.Sprint(i)] = time.Now()
+		lock.Unlock()
+		primary.RecvMsg(msg, net.handles[0])
+		time.Sleep(interval)
+	}
+	for done := 0; done < b.N; time.Sleep(time.Millisecond) {
+		lock.Lock()
+		done = len(executed)
+		lock.Unlock()
+	}
+	b.StopTimer()
+
+	lock.Lock()
+	var latency time.Duration
+	for id, exec := range executed {
+		latency += exec.Sub(submitted[id])
+	}
+	lock.Unlock()
+	primary.pbft.lock()
+	cuts := fmt.Sprint(primary.batchCuts)
+	primary.pbft.unlock()
+	b.Logf("%d requests: mean latency %v, batch cuts %s", b.N, latency/time.Duration(b.N), cuts)
+}
+
+// Under a light load, requests arrive further apart than the batch timeout.
+// A fixed timeout holds each request for the full timeout, while the
+// adaptive one sends it as soon as no further request is expected in time.
+func BenchmarkBatchFixedLight(b *testing.B) {
+	benchmarkBatch(b, 0, 80*time.Millisecond)
+}
+
+func BenchmarkBatchAdaptiveLight(b *testing.B) {
+	benchmarkBatch(b, 1, 80*time.Millisecond)
+}
+
+// Under a heavy load both fill up batches, the adaptive timeout must not
+// cost throughput
+func BenchmarkBatchFixedHeavy(b *testing.B) {
+	benchmarkBatch(b, 0, 0)
+}
+
+func BenchmarkBatchAdaptiveHeavy(b *testing.B) {
+	benchmarkBatch(b, 1, 0)
+}
@@ -50,7 +50,7 @@ func (op *obcClassic) RecvMsg(ocMsg *pb.OpenchainMessage, senderHandle *pb.PeerI
 		logger.Info("New consensus request received")
 
 		req := &Request{Payload: ocMsg.Payload, ReplicaId: op.pbft.id}
-		pbftMsg := &Message{&Message_Request{req}}
+		pbftMsg := &Message{Payload: &Message_Request{req}}
 		packedPbftMsg, _ := proto.Marshal(pbftMsg)
 		op.broadcast(packedPbftMsg)
 		op.pbft.request(ocMsg.Payload, op.pbft.id)
@@ -77,6 +77,26 @@ func (op *obcClassic) Close() {
 	op.pbft.close()
 }
 
+// GetStatus reports the state of the replica
+func (op *obcClassic) GetStatus() (*pb.ConsensusStatus, error) {
+	return newPbftStatus("classic", op.pbft), nil
+}
+
+// SetByzantine replaces the byzantine behaviors of the replica
+func (op *obcClassic) SetByzantine(behaviors []string) error {
+	return op.pbft.setByzantine(behaviors)
+}
+
+// GetByzantine returns the active byzantine behaviors of the replica
+func (op *obcClassic) GetByzantine() []string {
+	return op.pbft.getByzantine()
+}
+
+// StateTransfer returns the controller of the state transfer of the replica
+func (op *obcClassic) StateTransfer() consensus.StateTransferController {
+	return op.pbft.sts
+}
+
 // =============================================================================
 // innerStack interface (functions called by pbft-core)
 // =============================================================================
@@ -65,6 +65,13 @@ func New(stack consensus.Stack) consensus.Consenter {
 	}
 }
 
+// newPbftStatus reports the state of a replica running PBFT in the given mode
+func newPbftStatus(mode string, pbft *pbftCore) *pb.ConsensusStatus {
+	status := pbft.getStatus()
+	status.Mode = mode
+	return &pb.ConsensusStatus{Plugin: "obcpbft", Pbft: status}
+}
+
 func loadConfig() (config *viper.Viper) {
 	config = viper.New()
 
@@ -78,6 +85,7 @@ func loadConfig() (config *viper.Viper) {
 	config.AddConfigPath("./")
 	config.AddConfigPath("./openchain/consensus/obcpbft/")
 	config.AddConfigPath("../../openchain/consensus/obcpbft")
+	config.AddConfigPath("../../../openchain/consensus/obcpbft")
 	err := config.ReadInConfig()
 	if err != nil {
 		panic(fmt.Errorf("Error reading %s plugin config: %s", configPrefix, err))
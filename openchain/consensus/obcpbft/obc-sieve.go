@@ -123,6 +123,26 @@ func (op *obcSieve) Close() {
 	op.pbft.close()
 }
 
+// GetStatus reports the state of the replica
+func (op *obcSieve) GetStatus() (*pb.ConsensusStatus, error) {
+	return newPbftStatus("sieve", op.pbft), nil
+}
+
+// SetByzantine replaces the byzantine behaviors of the replica
+func (op *obcSieve) SetByzantine(behaviors []string) error {
+	return op.pbft.setByzantine(behaviors)
+}
+
+// GetByzantine returns the active byzantine behaviors of the replica
+func (op *obcSieve) GetByzantine() []string {
+	return op.pbft.getByzantine()
+}
+
+// StateTransfer returns the controller of the state transfer of the replica
+func (op *obcSieve) StateTransfer() consensus.StateTransferController {
+	return op.pbft.sts
+}
+
 // Drain will block until all remaining execution has been handled
 func (op *obcSieve) Drain() {
 	op.pbft.drain()
@@ -22,7 +22,6 @@ package obcpbft
 import (
 	"encoding/base64"
 	"fmt"
-	"math/rand"
 	"sort"
 	"sync"
 	"time"
@@ -69,12 +68,15 @@ type pbftCore struct {
 	executing    bool // signals that application is executing
 	closed       chan bool
 	consumer     innerStack
-	notifyCommit chan bool
-	notifyExec   *sync.Cond
+	notifyCommit chan bool       // signals the executor that committed requests are queued
+	notifyExec   *sync.Cond      // signals that the executor made progress
+	execQueue    []*committedReq // committed requests waiting for execution, in sequence number order
 
 	// PBFT data
 	activeView    bool                   // view change happening
-	byzantine     bool                   // whether this node is intentionally acting as Byzantine; useful for debugging on the testnet
+	auth          authMode               // how protocol messages are authenticated
+	keys          *sessionKeys           // MAC session keys, if auth is authMACs
+	byzantine     byzantineBehavior      // faults this node intentionally exhibits; useful for debugging on the testnet
 	f             int                    // max. number of faults we can tolerate
 	N             int                    // max.number of validators in the network
 	h             uint64                 // low watermark
@@ -83,6 +85,7 @@ type pbftCore struct {
 	logMultiplier uint64                 // use this value to calculate log size : k*logMultiplier
 	L             uint64                 // log size
 	lastExec      uint64                 // last request we executed
+	lastCommitted uint64                 // last request we handed to the executor
 	replicaCount  int                    // number of replicas; PBFT `|R|`
 	seqNo         uint64                 // PBFT "n", strictly monotonic increasing sequence number
 	view          uint64                 // current view
@@ -99,6 +102,7 @@ type pbftCore struct {
 	requestTimeout     time.Duration       // progress timeout for requests
 	newViewTimeout     time.Duration       // progress timeout for new views
 	lastNewViewTimeout time.Duration       // last timeout we used during this view change
+	byzantineDelay     time.Duration       // how long outgoing messages are held back by the delay behavior
 	outstandingReqs    map[string]*Request // track whether we are waiting for requests to execute
 	timerExpiredCount  uint64              // How many times the newViewTimer has expired, used in conjuection with timerResetCount to prevent racing
 	timerResetCount    uint64              // How many times the newViewTimer has been reset, used in conjuection with timerExpiredCount to prevent racing
@@ -109,6 +113,7 @@ type pbftCore struct {
 	reqStore        map[string]*Request   // track requests
 	certStore       map[msgID]*msgCert    // track quorum certificates for requests
 	checkpointStore map[Checkpoint]bool   // track checkpoints as set
+	checkpointSigs  map[Checkpoint][]byte // signatures of the checkpoints, for stable checkpoint certificates
 	viewChangeStore map[vcidx]*ViewChange // track view-change messages
 	newViewStore    map[uint64]*NewView   // track last new-view we received or sent
 }
@@ -123,6 +128,13 @@ type msgID struct { // our index through certStore
 	n uint64
 }
 
+type committedReq struct { // an entry of the execution queue
+	v      uint64
+	n      uint64
+	digest string
+	req    *Request
+}
+
 type msgCert struct {
 	prePrepare  *PrePrepare
 	sentPrepare bool
@@ -157,6 +169,33 @@ func (a sortableUint64Slice) Less(i, j int) bool {
 	return a[i] < a[j]
 }
 
+type sortableCheckpointCerts []*protos.PbftCheckpointCertificate
+
+func (a sortableCheckpointCerts) Len() int {
+	return len(a)
+}
+func (a sortableCheckpointCerts) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+func (a sortableCheckpointCerts) Less(i, j int) bool {
+	if a[i].SequenceNumber != a[j].SequenceNumber {
+		return a[i].SequenceNumber < a[j].SequenceNumber
+	}
+	return a[i].BlockHash < a[j].BlockHash
+}
+
+type sortableViewChangeCerts []*protos.PbftViewChangeCertificate
+
+func (a sortableViewChangeCerts) Len() int {
+	return len(a)
+}
+func (a sortableViewChangeCerts) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+func (a sortableViewChangeCerts) Less(i, j int) bool {
+	return a[i].View < a[j].View
+}
+
 // =============================================================================
 // constructors
 // =============================================================================
@@ -180,7 +219,14 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, ledger con
 	instance.K = uint64(config.GetInt("general.K"))
 	instance.logMultiplier = uint64(config.GetInt("general.logmultiplier"))
 
-	instance.byzantine = config.GetBool("general.byzantine")
+	instance.byzantine, err = parseByzantine(splitByzantine(config.GetString("general.byzantine")))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse byzantine behaviors: %s", err))
+	}
+	instance.byzantineDelay, err = time.ParseDuration(config.GetString("general.timeout.byzantinedelay"))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse byzantine delay: %s", err))
+	}
 
 	instance.requestTimeout, err = time.ParseDuration(config.GetString("general.timeout.request"))
 	if err != nil {
@@ -191,6 +237,17 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, ledger con
 		panic(fmt.Errorf("Cannot parse new view timeout: %s", err))
 	}
 
+	instance.auth, err = parseAuthMode(config.GetString("general.authentication"))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse authentication mode: %s", err))
+	}
+	if instance.auth == authMACs {
+		instance.keys, err = newSessionKeys()
+		if err != nil {
+			panic(fmt.Errorf("Cannot generate session keys: %s", err))
+		}
+	}
+
 	instance.activeView = true
 	instance.L = instance.logMultiplier * instance.K // log size
 	instance.replicaCount = instance.N
@@ -198,7 +255,8 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, ledger con
 	logger.Info("PBFT type = %T", instance.consumer)
 	logger.Info("PBFT Max number of validating peers (N) = %v", instance.N)
 	logger.Info("PBFT Max number of failing peers (f) = %v", instance.f)
-	logger.Info("PBFT byzantine flag = %v", instance.byzantine)
+	logger.Info("PBFT byzantine behaviors = %v", instance.byzantine)
+	logger.Info("PBFT authentication = %v", instance.auth)
 	logger.Info("PBFT request timeout = %v", instance.requestTimeout)
 	logger.Info("PBFT view change timeout = %v", instance.newViewTimeout)
 	logger.Info("PBFT Checkpoint period (K) = %v", instance.K)
@@ -209,6 +267,7 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, ledger con
 	instance.certStore = make(map[msgID]*msgCert)
 	instance.reqStore = make(map[string]*Request)
 	instance.checkpointStore = make(map[Checkpoint]bool)
+	instance.checkpointSigs = make(map[Checkpoint][]byte)
 	instance.chkpts = make(map[uint64]*blockState)
 	instance.viewChangeStore = make(map[vcidx]*ViewChange)
 	instance.pset = make(map[uint64]*ViewChange_PQ)
@@ -301,13 +360,14 @@ func (instance *pbftCore) close() {
 	instance.unlock()
 }
 
-// drain remaining requests
+// drain blocks until the executor has executed all committed requests
 func (instance *pbftCore) drain() {
 	instance.lock()
-	for instance.executing {
+	instance.commitOutstanding()
+	for instance.executing || (len(instance.execQueue) > 0 && !instance.sts.InProgress()) {
+		instance.notifyExecutor()
 		instance.notifyExec.Wait()
 	}
-	instance.executeOutstanding()
 	instance.unlock()
 }
 
@@ -467,8 +527,15 @@ func (instance *pbftCore) stateTransferCompleted(blockNumber uint64, blockHash [
 		defer instance.unlock()
 
 		instance.lastExec = md.sequenceNumber
+		if instance.lastCommitted < instance.lastExec {
+			instance.lastCommitted = instance.lastExec
+		}
+		// the transferred state already reflects these requests
+		for len(instance.execQueue) > 0 && instance.execQueue[0].n <= instance.lastExec {
+			instance.execQueue = instance.execQueue[1:]
+		}
 		logger.Debug("Replica %d completed state transfer to sequence number %d, about to execute outstanding requests", instance.id, instance.lastExec)
-		instance.executeOutstanding()
+		instance.commitOutstanding()
 	}
 }
 
@@ -478,7 +545,7 @@ func (instance *pbftCore) stateTransferCompleted(blockNumber uint64, blockHash [
 
 // handle new consensus requests
 func (instance *pbftCore) request(msgPayload []byte, senderID uint64) error {
-	msg := &Message{&Message_Request{&Request{Payload: msgPayload,
+	msg := &Message{Payload: &Message_Request{&Request{Payload: msgPayload,
 		ReplicaId: senderID}}}
 	instance.lock()
 	defer instance.unlock()
@@ -497,6 +564,10 @@ func (instance *pbftCore) receive(msgPayload []byte, senderID uint64) error {
 
 	instance.lock()
 	defer instance.unlock()
+	if err := instance.checkAuth(msg, senderID); err != nil {
+		logger.Warning("Replica %d dropping message from replica %d: %s", instance.id, senderID, err)
+		return nil
+	}
 	instance.recvMsgSync(msg, senderID)
 
 	return nil
@@ -538,6 +609,9 @@ func (instance *pbftCore) recvMsgSync(msg *Message, senderID uint64) (err error)
 			logger.Warning(err.Error())
 			return
 		}
+		if msg.Signature != nil && instance.inW(chkpt.SequenceNumber) {
+			instance.checkpointSigs[*chkpt] = msg.Signature
+		}
 		err = instance.recvCheckpoint(chkpt)
 	} else if vc := msg.GetViewChange(); vc != nil {
 		if senderID != vc.ReplicaId {
@@ -560,6 +634,13 @@ func (instance *pbftCore) recvMsgSync(msg *Message, senderID uint64) (err error)
 			return
 		}
 		err = instance.recvFetchRequest(fr)
+	} else if sk := msg.GetSessionKey(); sk != nil {
+		if senderID != sk.ReplicaId {
+			err = fmt.Errorf("Sender ID included in session-key message (%v) doesn't match ID corresponding to the receiving stream (%v)", sk.ReplicaId, senderID)
+			logger.Warning(err.Error())
+			return
+		}
+		err = instance.recvSessionKey(sk)
 	} else if req := msg.GetReturnRequest(); req != nil {
 		// it's ok for sender ID and replica ID to differ; we're sending the original request message
 		err = instance.recvReturnRequest(req)
@@ -614,7 +695,7 @@ func (instance *pbftCore) recvRequest(req *Request) error {
 			cert := instance.getCert(instance.view, n)
 			cert.prePrepare = preprep
 
-			instance.innerBroadcast(&Message{&Message_PrePrepare{preprep}}, false)
+			instance.innerBroadcast(&Message{Payload: &Message_PrePrepare{preprep}}, false)
 			return instance.maybeSendCommit(digest, instance.view, n)
 		}
 	}
@@ -699,7 +780,7 @@ func (instance *pbftCore) recvPrePrepare(preprep *PrePrepare) error {
 		}
 
 		cert.sentPrepare = true
-		return instance.innerBroadcast(&Message{&Message_Prepare{prep}}, true)
+		return instance.innerBroadcast(&Message{Payload: &Message_Prepare{prep}}, true)
 	}
 
 	return nil
@@ -743,7 +824,7 @@ func (instance *pbftCore) maybeSendCommit(digest string, v uint64, n uint64) err
 
 		cert.sentCommit = true
 
-		return instance.innerBroadcast(&Message{&Message_Commit{commit}}, true)
+		return instance.innerBroadcast(&Message{Payload: &Message_Commit{commit}}, true)
 	}
 
 	return nil
@@ -765,10 +846,7 @@ func (instance *pbftCore) recvCommit(commit *Commit) error {
 
 		// note that we can reach this point without
 		// broadcasting a commit ourselves
-		select { // non-blocking channel send
-		case instance.notifyCommit <- true:
-		default:
-		}
+		instance.commitOutstanding()
 	} else {
 		logger.Warning("Replica %d ignoring commit for view=%d/seqNo=%d: not in-wv",
 			instance.id, commit.View, commit.SequenceNumber)
@@ -777,6 +855,8 @@ func (instance *pbftCore) recvCommit(commit *Commit) error {
 	return nil
 }
 
+// executeRoutine is the executor: it executes committed requests in
+// sequence number order, while ordering of later requests continues
 func (instance *pbftCore) executeRoutine() {
 	for {
 		select {
@@ -791,8 +871,18 @@ func (instance *pbftCore) executeRoutine() {
 	}
 }
 
-func (instance *pbftCore) executeOutstanding() {
-	// Do not attempt to execute requests while we know we are in a bad state
+// notifyExecutor wakes up the executor
+func (instance *pbftCore) notifyExecutor() {
+	select { // non-blocking channel send
+	case instance.notifyCommit <- true:
+	default:
+	}
+}
+
+// commitOutstanding hands the requests which have a commit certificate to
+// the executor, without creating holes in the sequence numbers
+func (instance *pbftCore) commitOutstanding() {
+	// Do not attempt to commit requests while we know we are in a bad state
 	if instance.sts.InProgress() {
 		return
 	}
@@ -800,7 +890,7 @@ func (instance *pbftCore) executeOutstanding() {
 	for retry := true; retry; {
 		retry = false
 		for idx := range instance.certStore {
-			if instance.executeOne(idx) {
+			if instance.commitOne(idx) {
 				// range over the certStore again
 				retry = true
 				break
@@ -808,54 +898,84 @@ func (instance *pbftCore) executeOutstanding() {
 		}
 	}
 
-	return
-}
-
-func (instance *pbftCore) executeOne(idx msgID) bool {
-	if instance.executing {
-		return false
+	if len(instance.execQueue) > 0 {
+		instance.notifyExecutor()
 	}
+}
 
+func (instance *pbftCore) commitOne(idx msgID) bool {
 	cert := instance.certStore[idx]
 
-	if idx.n != instance.lastExec+1 || cert == nil || cert.prePrepare == nil {
+	if idx.n != instance.lastCommitted+1 || cert == nil || cert.prePrepare == nil {
 		return false
 	}
 
 	// we now have the right sequence number that doesn't create holes
 
 	digest := cert.prePrepare.RequestDigest
-	req := instance.reqStore[digest]
 
 	if !instance.committed(digest, idx.v, idx.n) {
 		return false
 	}
 
 	// we have a commit certificate for this request
-	instance.lastExec = idx.n
+	instance.lastCommitted = idx.n
 	instance.stopTimer()
 	instance.lastNewViewTimeout = instance.newViewTimeout
 
+	logger.Debug("Replica %d queueing committed request for view=%d/seqNo=%d and digest %s",
+		instance.id, idx.v, idx.n, digest)
+	instance.execQueue = append(instance.execQueue, &committedReq{
+		v:      idx.v,
+		n:      idx.n,
+		digest: digest,
+		req:    instance.reqStore[digest],
+	})
+	if digest != "" {
+		delete(instance.outstandingReqs, digest)
+	}
+
+	if len(instance.outstandingReqs) > 0 {
+		instance.startTimer(instance.requestTimeout)
+	}
+
+	return true
+}
+
+// executeOutstanding executes the queued requests; the lock is released
+// while the application executes a request
+func (instance *pbftCore) executeOutstanding() {
+	// Do not attempt to execute requests while we know we are in a bad state
+	for !instance.executing && len(instance.execQueue) > 0 && !instance.sts.InProgress() {
+		creq := instance.execQueue[0]
+		instance.execQueue = instance.execQueue[1:]
+		instance.executeOne(creq)
+	}
+	instance.notifyExec.Broadcast()
+}
+
+func (instance *pbftCore) executeOne(creq *committedReq) {
 	// null request
-	if digest == "" {
+	if creq.digest == "" {
 		logger.Info("Replica %d executing/committing null request for view=%d/seqNo=%d",
-			instance.id, idx.v, idx.n)
+			instance.id, creq.v, creq.n)
 	} else {
 		logger.Info("Replica %d executing/committing request for view=%d/seqNo=%d and digest %s",
-			instance.id, idx.v, idx.n, digest)
-		delete(instance.outstandingReqs, digest)
+			instance.id, creq.v, creq.n, creq.digest)
 
 		instance.executing = true
 		instance.unlock()
-		instance.consumer.execute(req.Payload)
+		instance.consumer.execute(creq.req.Payload)
 		instance.lock()
 		instance.executing = false
-		instance.notifyExec.Broadcast()
 	}
 
-	if len(instance.outstandingReqs) > 0 {
-		instance.startTimer(instance.requestTimeout)
+	if creq.n <= instance.lastExec {
+		// a state transfer moved us past this request while it executed
+		return
 	}
+	instance.lastExec = creq.n
+	instance.notifyExec.Broadcast()
 
 	if instance.lastExec%instance.K == 0 {
 		blockHeight, err := instance.ledger.GetBlockchainSize()
@@ -891,10 +1011,8 @@ func (instance *pbftCore) executeOne(idx msgID) bool {
 			blockNumber: chkpt.BlockNumber,
 			blockHash:   chkpt.BlockHash,
 		}
-		instance.innerBroadcast(&Message{&Message_Checkpoint{chkpt}}, true)
+		instance.innerBroadcast(&Message{Payload: &Message_Checkpoint{chkpt}}, true)
 	}
-
-	return true
 }
 
 func (instance *pbftCore) moveWatermarks(h uint64) {
@@ -918,6 +1036,12 @@ func (instance *pbftCore) moveWatermarks(h uint64) {
 		}
 	}
 
+	for testChkpt := range instance.checkpointSigs {
+		if testChkpt.SequenceNumber <= h {
+			delete(instance.checkpointSigs, testChkpt)
+		}
+	}
+
 	for n := range instance.pset {
 		if n <= h {
 			delete(instance.pset, n)
@@ -1080,6 +1204,7 @@ func (instance *pbftCore) recvCheckpoint(chkpt *Checkpoint) error {
 	logger.Debug("Replica %d found checkpoint quorum for seqNo %d, digest %s",
 		instance.id, chkpt.SequenceNumber, chkpt.BlockHash)
 
+	instance.persistCheckpointCertificate(chkpt)
 	instance.moveWatermarks(chkpt.SequenceNumber)
 
 	return instance.processNewView()
@@ -1089,7 +1214,7 @@ func (instance *pbftCore) recvCheckpoint(chkpt *Checkpoint) error {
 func (instance *pbftCore) fetchRequests() (err error) {
 	var msg *Message
 	for digest := range instance.missingReqs {
-		msg = &Message{&Message_FetchRequest{&FetchRequest{
+		msg = &Message{Payload: &Message_FetchRequest{&FetchRequest{
 			RequestDigest: digest,
 			ReplicaId:     instance.id,
 		}}}
@@ -1106,7 +1231,7 @@ func (instance *pbftCore) recvFetchRequest(fr *FetchRequest) (err error) {
 	}
 
 	req := instance.reqStore[digest]
-	msg := &Message{&Message_ReturnRequest{ReturnRequest: req}}
+	msg := &Message{Payload: &Message_ReturnRequest{ReturnRequest: req}}
 	msgPacked, err := proto.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("Error marshalling return-request message: %v", err)
@@ -1137,31 +1262,16 @@ func (instance *pbftCore) recvReturnRequest(req *Request) (err error) {
 // Marshals a Message and hands it to the Stack. If toSelf is true,
 // the message is also dispatched to the local instance's RecvMsgSync.
 func (instance *pbftCore) innerBroadcast(msg *Message, toSelf bool) error {
+	if err := instance.authenticate(msg); err != nil {
+		return fmt.Errorf("[innerBroadcast] Cannot authenticate message: %s", err)
+	}
 	msgRaw, err := proto.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("[innerBroadcast] Cannot marshal message: %s", err)
 	}
 
-	doByzantine := false
-	if instance.byzantine {
-		rand1 := rand.New(rand.NewSource(time.Now().UnixNano()))
-		doIt := rand1.Intn(3) // go byzantine about 1/3 of the time
-		if doIt == 1 {
-			doByzantine = true
-		}
-	}
-
-	// testing byzantine fault.
-	if doByzantine {
-		rand2 := rand.New(rand.NewSource(time.Now().UnixNano()))
-		ignoreidx := rand2.Intn(instance.N)
-		for i := 0; i < instance.N; i++ {
-			if i != ignoreidx && uint64(i) != instance.id { //Pick a random replica and do not send message
-				instance.consumer.unicast(msgRaw, uint64(i))
-			} else {
-				logger.Debug("PBFT byzantine: not broadcasting to replica %v", i)
-			}
-		}
+	if instance.byzantine != 0 {
+		instance.byzantineBroadcast(msg)
 	} else {
 		instance.consumer.broadcast(msgRaw)
 	}
@@ -1207,3 +1317,70 @@ func hashReq(req *Request) (digest string) {
 	reqRaw, _ := proto.Marshal(req)
 	return base64.StdEncoding.EncodeToString(util.ComputeCryptoHash(reqRaw))
 }
+
+// getStatus returns a snapshot of the protocol state, used to diagnose
+// stalled networks
+func (instance *pbftCore) getStatus() *protos.PbftStatus {
+	instance.lock()
+	defer instance.unlock()
+
+	status := &protos.PbftStatus{
+		ReplicaID:           instance.id,
+		N:                   uint64(instance.N),
+		F:                   uint64(instance.f),
+		View:                instance.view,
+		Primary:             instance.primary(instance.view),
+		ActiveView:          instance.activeView,
+		SeqNo:               instance.seqNo,
+		LowWatermark:        instance.h,
+		HighWatermark:       instance.h + instance.L,
+		LastExec:            instance.lastExec,
+		LastCommitted:       instance.lastCommitted,
+		OutstandingRequests: uint64(len(instance.outstandingReqs)),
+		NewViewTimerActive:  instance.timerActive,
+		Byzantine:           instance.byzantine.names(),
+	}
+
+	// group the checkpoints we received into certificates
+	chkptCerts := make(map[Checkpoint]*protos.PbftCheckpointCertificate)
+	for chkpt := range instance.checkpointStore {
+		replicaID := chkpt.ReplicaId
+		chkpt.ReplicaId = 0
+		cert, ok := chkptCerts[chkpt]
+		if !ok {
+			cert = &protos.PbftCheckpointCertificate{
+				SequenceNumber: chkpt.SequenceNumber,
+				BlockNumber:    chkpt.BlockNumber,
+				BlockHash:      chkpt.BlockHash,
+			}
+			chkptCerts[chkpt] = cert
+			status.Checkpoints = append(status.Checkpoints, cert)
+		}
+		cert.Replicas = append(cert.Replicas, replicaID)
+	}
+	for _, cert := range status.Checkpoints {
+		sort.Sort(sortableUint64Slice(cert.Replicas))
+	}
+	sort.Sort(sortableCheckpointCerts(status.Checkpoints))
+
+	// and the view-changes we received, per view
+	vcCerts := make(map[uint64]*protos.PbftViewChangeCertificate)
+	for idx := range instance.viewChangeStore {
+		cert, ok := vcCerts[idx.v]
+		if !ok {
+			cert = &protos.PbftViewChangeCertificate{
+				View:    idx.v,
+				NewView: instance.newViewStore[idx.v] != nil,
+			}
+			vcCerts[idx.v] = cert
+			status.ViewChanges = append(status.ViewChanges, cert)
+		}
+		cert.Replicas = append(cert.Replicas, idx.id)
+	}
+	for _, cert := range status.ViewChanges {
+		sort.Sort(sortableUint64Slice(cert.Replicas))
+	}
+	sort.Sort(sortableViewChangeCerts(status.ViewChanges))
+
+	return status
+}
@@ -99,6 +99,8 @@ type instance struct {
 
 	deliver      func([]byte, *pb.PeerID)
 	execTxResult func([]*pb.Transaction) ([]byte, error)
+	execTxFail   func(*pb.Transaction) error // fails single transactions, as chaincode execution does
+	certs        []*pb.CheckpointCertificate
 }
 
 func (inst *instance) Sign(msg []byte) ([]byte, error) {
@@ -216,6 +218,10 @@ func (inst *instance) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, er
 	return inst.ledger.ExecTxs(id, txs)
 }
 
+func (inst *instance) RejectTxs(id interface{}, results []*pb.TransactionResult) error {
+	return inst.ledger.RejectTxs(id, results)
+}
+
 func (inst *instance) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error) {
 	return inst.ledger.CommitTxBatch(id, metadata)
 }
@@ -228,6 +234,11 @@ func (inst *instance) RollbackTxBatch(id interface{}) error {
 	return inst.ledger.RollbackTxBatch(id)
 }
 
+func (inst *instance) PutCheckpointCertificate(cert *pb.CheckpointCertificate) error {
+	inst.certs = append(inst.certs, cert)
+	return nil
+}
+
 func (inst *instance) GetBlock(id uint64) (block *pb.Block, err error) {
 	return inst.ledger.GetBlock(id)
 }
@@ -237,6 +248,9 @@ func (inst *instance) GetCurrentStateHash() (stateHash []byte, err error) {
 func (inst *instance) GetBlockchainSize() (uint64, error) {
 	return inst.ledger.GetBlockchainSize()
 }
+func (inst *instance) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
+	return inst.ledger.GetStateDelta(blockNumber)
+}
 func (inst *instance) HashBlock(block *pb.Block) ([]byte, error) {
 	return inst.ledger.HashBlock(block)
 }
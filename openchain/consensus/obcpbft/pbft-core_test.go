@@ -96,7 +96,7 @@ func TestMaliciousPrePrepare(t *testing.T) {
 	digest1 := "hi there"
 	request2 := &Request{Payload: []byte("other"), ReplicaId: uint64(generateBroadcaster(instance.replicaCount))}
 
-	pbftMsg := &Message{&Message_PrePrepare{&PrePrepare{
+	pbftMsg := &Message{Payload: &Message_PrePrepare{&PrePrepare{
 		View:           0,
 		SequenceNumber: 1,
 		RequestDigest:  digest1,
@@ -124,7 +124,7 @@ func TestWrongReplicaID(t *testing.T) {
 		Payload:   chainTxMsg.Payload,
 		ReplicaId: 1,
 	}
-	pbftMsg := &Message{&Message_Request{req}}
+	pbftMsg := &Message{Payload: &Message_Request{req}}
 	err := net.replicas[0].pbft.recvMsgSync(pbftMsg, 0)
 
 	if err == nil {
@@ -155,9 +155,9 @@ func TestIncompletePayload(t *testing.T) {
 	}
 
 	checkMsg(&Message{}, "Expected to reject empty message")
-	checkMsg(&Message{&Message_Request{&Request{ReplicaId: broadcaster}}}, "Expected to reject empty request")
-	checkMsg(&Message{&Message_PrePrepare{&PrePrepare{ReplicaId: broadcaster}}}, "Expected to reject empty pre-prepare")
-	checkMsg(&Message{&Message_PrePrepare{&PrePrepare{SequenceNumber: 1, ReplicaId: broadcaster}}}, "Expected to reject incomplete pre-prepare")
+	checkMsg(&Message{Payload: &Message_Request{&Request{ReplicaId: broadcaster}}}, "Expected to reject empty request")
+	checkMsg(&Message{Payload: &Message_PrePrepare{&PrePrepare{ReplicaId: broadcaster}}}, "Expected to reject empty pre-prepare")
+	checkMsg(&Message{Payload: &Message_PrePrepare{&PrePrepare{SequenceNumber: 1, ReplicaId: broadcaster}}}, "Expected to reject incomplete pre-prepare")
 }
 
 func TestNetwork(t *testing.T) {
@@ -216,7 +216,7 @@ func TestCheckpoint(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to marshal TX block: %s", err)
 		}
-		msg := &Message{&Message_Request{&Request{Payload: txPacked, ReplicaId: uint64(generateBroadcaster(validatorCount))}}}
+		msg := &Message{Payload: &Message_Request{&Request{Payload: txPacked, ReplicaId: uint64(generateBroadcaster(validatorCount))}}}
 		net.replicas[0].pbft.recvMsgSync(msg, msg.GetRequest().ReplicaId)
 
 		if drain {
@@ -391,7 +391,7 @@ func TestViewChange(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to marshal TX block: %s", err)
 		}
-		msg := &Message{&Message_Request{&Request{Payload: txPacked, ReplicaId: uint64(generateBroadcaster(validatorCount))}}}
+		msg := &Message{Payload: &Message_Request{&Request{Payload: txPacked, ReplicaId: uint64(generateBroadcaster(validatorCount))}}}
 		err = net.replicas[0].pbft.recvMsgSync(msg, msg.GetRequest().ReplicaId)
 		if err != nil {
 			t.Fatalf("Request failed: %s", err)
@@ -634,7 +634,7 @@ func TestNewViewTimeout(t *testing.T) {
 	txTime := &gp.Timestamp{Seconds: 1, Nanos: 0}
 	tx := &pb.Transaction{Type: pb.Transaction_CHAINCODE_NEW, Timestamp: txTime}
 	txPacked, _ := proto.Marshal(tx)
-	msg := &Message{&Message_Request{&Request{Payload: txPacked, ReplicaId: broadcaster}}}
+	msg := &Message{Payload: &Message_Request{&Request{Payload: txPacked, ReplicaId: broadcaster}}}
 	msgPacked, _ := proto.Marshal(msg)
 
 	go net.processContinually()
@@ -688,6 +688,7 @@ func TestViewChangeUpdateSeqNo(t *testing.T) {
 		inst.pbft.requestTimeout = inst.pbft.newViewTimeout
 		inst.pbft.lastNewViewTimeout = inst.pbft.newViewTimeout
 		inst.pbft.lastExec = 99
+		inst.pbft.lastCommitted = 99
 		inst.pbft.h = 99 / inst.pbft.K * inst.pbft.K
 	})
 	net.replicas[0].pbft.seqNo = 99
@@ -784,7 +785,7 @@ func TestFallBehind(t *testing.T) {
 			t.Fatalf("Failed to marshal TX block: %s", err)
 		}
 
-		msg := &Message{&Message_Request{&Request{Payload: txPacked, ReplicaId: uint64(generateBroadcaster(validatorCount))}}}
+		msg := &Message{Payload: &Message_Request{&Request{Payload: txPacked, ReplicaId: uint64(generateBroadcaster(validatorCount))}}}
 
 		err = net.replicas[0].pbft.recvMsgSync(msg, msg.GetRequest().ReplicaId)
 		if err != nil {
@@ -1020,3 +1021,143 @@ func TestPbftF0(t *testing.T) {
 		}
 	}
 }
+
+func TestGetStatus(t *testing.T) {
+	mock := newMock()
+	instance := newPbftCore(1, loadConfig(), mock, mock)
+	defer instance.close()
+	instance.replicaCount = 4
+
+	instance.lock()
+	instance.view = 1
+	instance.lastExec = 12
+	instance.lastCommitted = 15
+	instance.h = 10
+	instance.checkpointStore[Checkpoint{SequenceNumber: 20, ReplicaId: 3, BlockNumber: 4, BlockHash: "a"}] = true
+	instance.checkpointStore[Checkpoint{SequenceNumber: 20, ReplicaId: 0, BlockNumber: 4, BlockHash: "a"}] = true
+	instance.checkpointStore[Checkpoint{SequenceNumber: 20, ReplicaId: 2, BlockNumber: 4, BlockHash: "b"}] = true
+	instance.checkpointStore[Checkpoint{SequenceNumber: 10, ReplicaId: 2, BlockNumber: 2, BlockHash: "c"}] = true
+	instance.viewChangeStore[vcidx{2, 3}] = &ViewChange{View: 2, ReplicaId: 3}
+	instance.viewChangeStore[vcidx{2, 0}] = &ViewChange{View: 2, ReplicaId: 0}
+	instance.unlock()
+
+	status := instance.getStatus()
+	if status.View != 1 || status.Primary != 1 || status.LastExec != 12 || status.LastCommitted != 15 {
+		t.Errorf("Wrong view, primary, last executed or last committed request reported: %v", status)
+	}
+	if status.LowWatermark != 10 || status.HighWatermark != 10+instance.L {
+		t.Errorf("Wrong watermarks reported: %d-%d", status.LowWatermark, status.HighWatermark)
+	}
+
+	expectedChkpts := []*pb.PbftCheckpointCertificate{
+		{SequenceNumber: 10, BlockNumber: 2, BlockHash: "c", Replicas: []uint64{2}},
+		{SequenceNumber: 20, BlockNumber: 4, BlockHash: "a", Replicas: []uint64{0, 3}},
+		{SequenceNumber: 20, BlockNumber: 4, BlockHash: "b", Replicas: []uint64{2}},
+	}
+	if !reflect.DeepEqual(status.Checkpoints, expectedChkpts) {
+		t.Errorf("Expected checkpoint certificates %v, got %v", expectedChkpts, status.Checkpoints)
+	}
+
+	expectedVCs := []*pb.PbftViewChangeCertificate{{View: 2, Replicas: []uint64{0, 3}}}
+	if !reflect.DeepEqual(status.ViewChanges, expectedVCs) {
+		t.Errorf("Expected view-change certificates %v, got %v", expectedVCs, status.ViewChanges)
+	}
+}
+
+// benchmarkSlowChaincode orders b.N requests on a 4 replica network whose
+// chaincode takes delay to execute each request, and waits until a quorum
+// of replicas executed all of them. A non-zero timeout replaces the request
+// timeout.
+func benchmarkSlowChaincode(b *testing.B, delay time.Duration, timeout time.Duration) {
+	benchmarkSlowChaincodePipeline(b, delay, timeout, true)
+}
+
+// unpipelinedStack holds the pbftCore lock while the wrapped stack
+// executes a request, so that no request is ordered during execution, as
+// was the case before ordering and execution were pipelined
+type unpipelinedStack struct {
+	innerStack
+	pbft *pbftCore
+}
+
+func (us *unpipelinedStack) execute(txRaw []byte) {
+	us.pbft.lock()
+	defer us.pbft.unlock()
+	us.innerStack.execute(txRaw)
+}
+
+// benchmarkSlowChaincodePipeline is benchmarkSlowChaincode, with the
+// pipelining of ordering and execution enabled or disabled
+func benchmarkSlowChaincodePipeline(b *testing.B, delay time.Duration, timeout time.Duration, pipeline bool) {
+	logging.SetLevel(logging.WARNING, "")
+	defer logging.SetLevel(logging.DEBUG, "")
+
+	validatorCount := 4
+	net := makeTestnet(validatorCount, func(inst *instance) {
+		makeTestnetPbftCore(inst)
+		if !pipeline {
+			inst.pbft.consumer = &unpipelinedStack{inst.pbft.consumer, inst.pbft}
+		}
+		if timeout != 0 {
+			inst.pbft.requestTimeout = timeout
+		}
+		inst.execTxResult = func(txs []*pb.Transaction) ([]byte, error) {
+			time.Sleep(delay)
+			return nil, nil
+		}
+	})
+	defer net.close()
+	go net.processContinually()
+
+	primary := net.replicas[0].pbft
+	b.ResetTimer()
+	for i := 1; i <= b.N; i++ {
+		// keep the requests within the primary's watermarks
+		for {
+			primary.lock()
+			full := primary.seqNo >= primary.h+primary.L
+			primary.unlock()
+			if !full {
+				break
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+		primary.request(createOcMsgWithChainTx(int64(i)).Payload, primary.id)
+	}
+	// a replica which falls behind the watermarks only catches up through
+	// state transfer, so wait for a quorum rather than for every replica
+	for done := 0; done < validatorCount-net.f; {
+		time.Sleep(time.Millisecond)
+		done = 0
+		for _, inst := range net.replicas {
+			if height, _ := inst.ledger.GetBlockchainSize(); height > uint64(b.N) {
+				done++
+			}
+		}
+	}
+	b.StopTimer()
+}
+
+func BenchmarkSlowChaincode1ms(b *testing.B) {
+	benchmarkSlowChaincode(b, time.Millisecond, 0)
+}
+
+func BenchmarkSlowChaincode10ms(b *testing.B) {
+	benchmarkSlowChaincode(b, 10*time.Millisecond, 0)
+}
+
+// The baselines execute each request before committing the next one, as
+// pbftCore did before ordering and execution were pipelined
+func BenchmarkSlowChaincode1msNoPipeline(b *testing.B) {
+	benchmarkSlowChaincodePipeline(b, time.Millisecond, 0, false)
+}
+
+func BenchmarkSlowChaincode10msNoPipeline(b *testing.B) {
+	benchmarkSlowChaincodePipeline(b, 10*time.Millisecond, 0, false)
+}
+
+// Execution takes longer than the request timeout, which must not be
+// mistaken for a faulty primary
+func BenchmarkSlowChaincodeShortTimeout(b *testing.B) {
+	benchmarkSlowChaincode(b, 10*time.Millisecond, 5*time.Millisecond)
+}
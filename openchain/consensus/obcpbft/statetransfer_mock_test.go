@@ -38,6 +38,7 @@ const (
 	SyncDeltas mockRequest = iota
 	SyncBlocks
 	SyncSnapshot
+	SyncStateChunk
 )
 
 type mockResponse int
@@ -76,6 +77,7 @@ type MockLedger struct {
 	txID          interface{}
 	curBatch      []*protos.Transaction
 	curResults    []byte
+	rejected      []*protos.TransactionResult
 	preBatchState uint64
 
 	deltaID       interface{}
@@ -116,6 +118,7 @@ func (mock *MockLedger) BeginTxBatch(id interface{}) error {
 	mock.txID = id
 	mock.curBatch = nil
 	mock.curResults = nil
+	mock.rejected = nil
 	mock.preBatchState = mock.state
 	return nil
 }
@@ -125,6 +128,22 @@ func (mock *MockLedger) ExecTxs(id interface{}, txs []*protos.Transaction) ([]by
 		return nil, fmt.Errorf("Invalid batch ID")
 	}
 
+	if mock.inst.execTxFail != nil {
+		var executed []*protos.Transaction
+		for _, tx := range txs {
+			if err := mock.inst.execTxFail(tx); err != nil {
+				mock.rejected = append(mock.rejected, &protos.TransactionResult{
+					Uuid:      tx.Uuid,
+					ErrorCode: consensus.TxErrorExecution,
+					Error:     err.Error(),
+				})
+				continue
+			}
+			executed = append(executed, tx)
+		}
+		txs = executed
+	}
+
 	mock.curBatch = append(mock.curBatch, txs...)
 	var err error
 	var txResult []byte
@@ -159,12 +178,21 @@ func (mock *MockLedger) ExecTxs(id interface{}, txs []*protos.Transaction) ([]by
 	return txResult, err
 }
 
+func (mock *MockLedger) RejectTxs(id interface{}, results []*protos.TransactionResult) error {
+	if !reflect.DeepEqual(mock.txID, id) {
+		return fmt.Errorf("Invalid batch ID")
+	}
+	mock.rejected = append(mock.rejected, results...)
+	return nil
+}
+
 func (mock *MockLedger) CommitTxBatch(id interface{}, metadata []byte) (*protos.Block, error) {
 	block, err := mock.commonCommitTx(id, metadata, false)
 	if nil == err {
 		mock.txID = nil
 		mock.curBatch = nil
 		mock.curResults = nil
+		mock.rejected = nil
 	}
 	return block, err
 }
@@ -188,11 +216,11 @@ func (mock *MockLedger) commonCommitTx(id interface{}, metadata []byte, preview
 		StateHash:         stateHash,
 		Transactions:      mock.curBatch,
 		NonHashData: &protos.NonHashData{
-			TransactionResults: []*protos.TransactionResult{
+			TransactionResults: append([]*protos.TransactionResult{
 				&protos.TransactionResult{
 					Result: mock.curResults,
 				},
-			},
+			}, mock.rejected...),
 		},
 	}
 
@@ -217,6 +245,7 @@ func (mock *MockLedger) RollbackTxBatch(id interface{}) error {
 	}
 	mock.curBatch = nil
 	mock.curResults = nil
+	mock.rejected = nil
 	mock.txID = nil
 	mock.state = mock.preBatchState
 	return nil
@@ -230,6 +259,11 @@ func (mock *MockLedger) GetBlockchainSize() (uint64, error) {
 	return mock.blockHeight, nil
 }
 
+func (mock *MockLedger) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
+	// The mock ledger encodes its deltas in the transaction payloads
+	return statemgmt.NewStateDelta(), nil
+}
+
 func (mock *MockLedger) GetBlock(id uint64) (*protos.Block, error) {
 	mock.mutex.Lock()
 	defer func() {
@@ -574,6 +608,10 @@ func (mock *MockRemoteLedger) GetBlockchainSize() (uint64, error) {
 	return mock.blockHeight, nil
 }
 
+func (mock *MockRemoteLedger) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
+	return statemgmt.NewStateDelta(), nil
+}
+
 func (mock *MockRemoteLedger) GetCurrentStateHash() (stateHash []byte, err error) {
 	return SimpleEncodeUint64(SimpleGetState(mock.blockHeight - 1)), nil
 }
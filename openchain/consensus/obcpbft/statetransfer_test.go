@@ -21,6 +21,7 @@ package obcpbft
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -29,6 +30,7 @@ import (
 
 	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
 	. "github.com/hyperledger-incubator/obc-peer/openchain/consensus/statetransfer" // Bad form, but here until we can figure out how to share tests across packages
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
 	"github.com/hyperledger-incubator/obc-peer/protos"
 )
 
@@ -546,3 +548,740 @@ func TestRegisterUnregisterListener(t *testing.T) {
 	}
 
 }
+
+func TestCatchupParallelBlocks(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+
+	asked := make(map[protos.PeerID]bool)
+	lock := &sync.Mutex{}
+	filter := func(request mockRequest, peerID *protos.PeerID) mockResponse {
+		if request == SyncBlocks {
+			lock.Lock()
+			asked[*peerID] = true
+			lock.Unlock()
+		}
+		return Normal
+	}
+
+	ml := NewMockLedger(rols, filter)
+	ml.PutBlock(0, SimpleGetBlock(0))
+	sts := newTestStateTransfer(ml, dps)
+	defer sts.Stop()
+	if err := executeStateTransfer(sts, ml, 100, 10, mrls, dps); nil != err {
+		t.Fatalf("ParallelBlocks case: %s", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(asked) < 2 {
+		t.Fatalf("Blocks should have been fetched from several peers, but only %d were asked", len(asked))
+	}
+}
+
+// corruptRemoteLedger serves blocks which do not match the hash chain
+type corruptRemoteLedger struct {
+	*MockRemoteLedger
+}
+
+func (mock *corruptRemoteLedger) GetBlock(blockNumber uint64) (*protos.Block, error) {
+	block, err := mock.MockRemoteLedger.GetBlock(blockNumber)
+	if nil == err {
+		block.StateHash = []byte("GARBAGE_STATE_HASH")
+	}
+	return block, err
+}
+
+func TestCatchupBlameCorruptPeer(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+	corrupt := dps[0]
+	(*rols)[*corrupt] = &corruptRemoteLedger{(*mrls)[*corrupt]}
+
+	corruptRequests := 0
+	lock := &sync.Mutex{}
+	filter := func(request mockRequest, peerID *protos.PeerID) mockResponse {
+		if request == SyncBlocks && *peerID == *corrupt {
+			lock.Lock()
+			corruptRequests++
+			lock.Unlock()
+		}
+		return Normal
+	}
+
+	ml := NewMockLedger(rols, filter)
+	ml.PutBlock(0, SimpleGetBlock(0))
+	sts := newTestStateTransfer(ml, dps)
+	defer sts.Stop()
+	if err := executeStateTransfer(sts, ml, 100, 10, mrls, dps); nil != err {
+		t.Fatalf("BlameCorruptPeer case: %s", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if 1 != corruptRequests {
+		t.Fatalf("The corrupt peer should have been blamed after its first chunk, but was asked for %d chunks", corruptRequests)
+	}
+}
+
+// persistingMockLedger keeps state as the DB of a peer would, and can fail
+// block requests below a given block number
+type persistingMockLedger struct {
+	*MockLedger
+	lock      sync.Mutex
+	persisted map[string][]byte
+	failBelow uint64
+	requested [][2]uint64 // the block ranges requested from remote peers
+}
+
+func (mock *persistingMockLedger) StoreState(key string, value []byte) error {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.persisted[key] = value
+	return nil
+}
+
+func (mock *persistingMockLedger) ReadState(key string) ([]byte, error) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return mock.persisted[key], nil
+}
+
+func (mock *persistingMockLedger) ReadStateSet(prefix string) (map[string][]byte, error) {
+	return nil, fmt.Errorf("Unsupported")
+}
+
+func (mock *persistingMockLedger) DelState(key string) error {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	delete(mock.persisted, key)
+	return nil
+}
+
+func (mock *persistingMockLedger) GetRemoteBlocks(peerID *protos.PeerID, start, finish uint64) (<-chan *protos.SyncBlocks, error) {
+	mock.lock.Lock()
+	fail := finish < mock.failBelow
+	mock.requested = append(mock.requested, [2]uint64{start, finish})
+	mock.lock.Unlock()
+	if fail {
+		return nil, fmt.Errorf("Simulated failure for blocks %d to %d", start, finish)
+	}
+	return mock.MockLedger.GetRemoteBlocks(peerID, start, finish)
+}
+
+func TestCatchupBlockSyncProgress(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+	for _, remoteLedger := range *mrls {
+		remoteLedger.blockHeight = 51
+	}
+
+	// The first peer syncs the upper blocks, but cannot get the lower ones
+	ml := &persistingMockLedger{
+		MockLedger: NewMockLedger(rols, nil),
+		persisted:  make(map[string][]byte),
+		failBelow:  31,
+	}
+	ml.PutBlock(0, SimpleGetBlock(0))
+	rand.Seed(0)
+	sts := NewStateTransferState(&protos.PeerID{Name: "State Transfer Test"}, loadConfig(), ml, dps)
+	defer sts.Stop()
+
+	// The restarted peer has the blocks and the progress marker the first
+	// had when its sync failed
+	restarted := &persistingMockLedger{
+		MockLedger: NewMockLedger(rols, nil),
+		persisted:  make(map[string][]byte),
+	}
+	interrupted := make(chan struct{})
+	var once sync.Once
+	sts.RegisterListener(&ProtoListener{
+		ErroredImpl: func(uint64, []byte, []*protos.PeerID, interface{}, error) {
+			once.Do(func() {
+				ml.lock.Lock()
+				defer ml.lock.Unlock()
+				for key, value := range ml.persisted {
+					restarted.persisted[key] = value
+				}
+				for blockNumber := uint64(0); blockNumber <= 50; blockNumber++ {
+					if block, err := ml.GetBlock(blockNumber); nil == err {
+						restarted.PutBlock(blockNumber, block)
+					}
+				}
+				close(interrupted)
+			})
+		},
+	})
+	sts.Initiate(dps)
+	sts.AddTarget(50, SimpleGetBlockHash(50), dps, nil)
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the block sync to fail")
+	case <-interrupted:
+	}
+
+	marker := restarted.persisted["statetransfer.progress"]
+	if len(marker) < 16 {
+		t.Fatalf("The interrupted block sync should have persisted its progress")
+	}
+	markerHigh, markerLow := binary.BigEndian.Uint64(marker), binary.BigEndian.Uint64(marker[8:])
+	if 50 != markerHigh || markerLow > 31 {
+		t.Fatalf("Expected the progress to cover blocks 50 down to at most 31, got %d to %d", markerHigh, markerLow)
+	}
+
+	rand.Seed(0)
+	sts = NewStateTransferState(&protos.PeerID{Name: "State Transfer Test"}, loadConfig(), restarted, dps)
+	defer sts.Stop()
+	if err := executeStateTransfer(sts, restarted.MockLedger, 50, 10, mrls, dps); nil != err {
+		t.Fatalf("BlockSyncProgress case: %s", err)
+	}
+
+	restarted.lock.Lock()
+	defer restarted.lock.Unlock()
+	for _, r := range restarted.requested {
+		if r[0] >= markerLow {
+			t.Fatalf("The restarted block sync fetched blocks %d to %d again, which were synced down from block %d before", r[0], r[1], markerHigh)
+		}
+	}
+}
+
+const mockNumStateChunks = 4
+
+// chunkingMockLedger transfers the state of the remote ledgers in chunks,
+// each of which is a share of the state, with all of the shares as the proof
+type chunkingMockLedger struct {
+	*persistingMockLedger
+	requests   map[uint64]int // requests by chunk
+	failChunks uint64         // if nonzero, requests for chunks from this one on fail
+}
+
+func newChunkingMockLedger(rols *map[protos.PeerID]consensus.ReadOnlyLedger, filter func(mockRequest, *protos.PeerID) mockResponse) *chunkingMockLedger {
+	return &chunkingMockLedger{
+		persistingMockLedger: &persistingMockLedger{
+			MockLedger: NewMockLedger(rols, filter),
+			persisted:  make(map[string][]byte),
+		},
+		requests: make(map[uint64]int),
+	}
+}
+
+func mockStateChunks(state uint64) []uint64 {
+	chunks := make([]uint64, mockNumStateChunks)
+	for i := range chunks {
+		chunks[i] = state / mockNumStateChunks
+	}
+	chunks[mockNumStateChunks-1] += state % mockNumStateChunks
+	return chunks
+}
+
+func (mock *chunkingMockLedger) GetRemoteStateChunk(peerID *protos.PeerID, chunk uint64, stateHash []byte) (<-chan *protos.SyncStateChunk, error) {
+	remoteLedger, ok := (*mock.remoteLedgers)[*peerID]
+	if !ok {
+		return nil, fmt.Errorf("Bad peer ID")
+	}
+
+	mock.lock.Lock()
+	mock.requests[chunk]++
+	fail := 0 != mock.failChunks && chunk >= mock.failChunks
+	mock.lock.Unlock()
+	if fail {
+		return nil, fmt.Errorf("Simulated failure for state chunk %d", chunk)
+	}
+
+	ft := mock.filter(SyncStateChunk, peerID)
+	res := make(chan *protos.SyncStateChunk, 1)
+	if Timeout == ft {
+		return res, nil
+	}
+
+	remoteBlockHeight, _ := remoteLedger.GetBlockchainSize()
+	blockNumber := remoteBlockHeight - 1
+	response := &protos.SyncStateChunk{
+		Request:     &protos.SyncStateChunkRequest{Chunk: chunk, StateHash: stateHash},
+		BlockNumber: blockNumber,
+		StateHash:   SimpleGetStateHash(blockNumber),
+		NumChunks:   mockNumStateChunks,
+	}
+	if chunk < mockNumStateChunks && (nil == stateHash || bytes.Equal(stateHash, response.StateHash)) {
+		chunks := mockStateChunks(SimpleGetState(blockNumber))
+		value := chunks[chunk]
+		if Corrupt == ft {
+			value++
+		}
+		response.Delta = SimpleEncodeUint64(value)
+		for _, c := range chunks {
+			response.Proof = append(response.Proof, SimpleEncodeUint64(c)...)
+		}
+	}
+	res <- response
+	return res, nil
+}
+
+func (mock *chunkingMockLedger) VerifyStateChunk(stateChunk *protos.SyncStateChunk, stateHash []byte) (*statemgmt.StateDelta, error) {
+	if mockNumStateChunks != stateChunk.NumChunks || nil == stateChunk.Request || stateChunk.Request.Chunk >= mockNumStateChunks ||
+		len(stateChunk.Proof) != mockNumStateChunks*binary.MaxVarintLen64 {
+		return nil, fmt.Errorf("Malformed state chunk")
+	}
+
+	var sum uint64
+	shares := make([]uint64, mockNumStateChunks)
+	for i := range shares {
+		shares[i], _ = binary.Uvarint(stateChunk.Proof[i*binary.MaxVarintLen64:])
+		sum += shares[i]
+	}
+	if !bytes.Equal([]byte(fmt.Sprintf("%d", sum)), stateHash) {
+		return nil, fmt.Errorf("State chunk proof adds up to %d, not %s", sum, stateHash)
+	}
+	if value, r := binary.Uvarint(stateChunk.Delta); r <= 0 || value != shares[stateChunk.Request.Chunk] {
+		return nil, fmt.Errorf("State chunk %d does not match its proof", stateChunk.Request.Chunk)
+	}
+	return SimpleBytesToStateDelta(stateChunk.Delta), nil
+}
+
+func TestCatchupStateChunks(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+
+	asked := make(map[protos.PeerID]bool)
+	snapshots := 0
+	lock := &sync.Mutex{}
+	filter := func(request mockRequest, peerID *protos.PeerID) mockResponse {
+		lock.Lock()
+		defer lock.Unlock()
+		switch request {
+		case SyncStateChunk:
+			asked[*peerID] = true
+		case SyncSnapshot:
+			snapshots++
+		}
+		return Normal
+	}
+
+	ml := newChunkingMockLedger(rols, filter)
+	ml.PutBlock(4, SimpleGetBlock(4)) // Missing blocks 0-3, so the state must be transferred
+	rand.Seed(0)
+	sts := NewStateTransferState(&protos.PeerID{Name: "State Transfer Test"}, loadConfig(), ml, dps)
+	defer sts.Stop()
+	if err := executeStateTransfer(sts, ml.MockLedger, 100, 10, mrls, dps); nil != err {
+		t.Fatalf("StateChunks case: %s", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if 0 != snapshots {
+		t.Fatalf("The state should have been transferred in chunks, but %d snapshots were requested", snapshots)
+	}
+	if len(asked) < 2 {
+		t.Fatalf("State chunks should have been fetched from several peers, but only %d were asked", len(asked))
+	}
+}
+
+func TestCatchupStateChunksBlameCorruptPeer(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+	corrupt := dps[1]
+
+	corruptRequests := 0
+	lock := &sync.Mutex{}
+	filter := func(request mockRequest, peerID *protos.PeerID) mockResponse {
+		if request != SyncStateChunk || *peerID != *corrupt {
+			return Normal
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		corruptRequests++
+		return Corrupt
+	}
+
+	ml := newChunkingMockLedger(rols, filter)
+	ml.PutBlock(4, SimpleGetBlock(4)) // Missing blocks 0-3, so the state must be transferred
+	rand.Seed(0)
+	sts := NewStateTransferState(&protos.PeerID{Name: "State Transfer Test"}, loadConfig(), ml, dps)
+	defer sts.Stop()
+	if err := executeStateTransfer(sts, ml.MockLedger, 100, 10, mrls, dps); nil != err {
+		t.Fatalf("StateChunksBlameCorruptPeer case: %s", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if 1 != corruptRequests {
+		t.Fatalf("The corrupt peer should have been blamed after its first chunk, but was asked for %d chunks", corruptRequests)
+	}
+}
+
+func TestCatchupStateChunkProgress(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+
+	// While chunks fail, so does the fallback to a snapshot
+	var ml *chunkingMockLedger
+	ml = newChunkingMockLedger(rols, func(request mockRequest, peerID *protos.PeerID) mockResponse {
+		ml.lock.Lock()
+		defer ml.lock.Unlock()
+		if SyncSnapshot == request && 0 != ml.failChunks {
+			return Timeout
+		}
+		return Normal
+	})
+	ml.failChunks = 2
+	ml.PutBlock(4, SimpleGetBlock(4)) // Missing blocks 0-3, so the state must be transferred
+	rand.Seed(0)
+	sts := NewStateTransferState(&protos.PeerID{Name: "State Transfer Test"}, loadConfig(), ml, dps)
+	sts.StateSnapshotRequestTimeout = 10 * time.Millisecond
+	defer sts.Stop()
+
+	interrupted := false
+	sts.RegisterListener(&ProtoListener{
+		ErroredImpl: func(uint64, []byte, []*protos.PeerID, interface{}, error) {
+			ml.lock.Lock()
+			defer ml.lock.Unlock()
+			// The first error is for the invalid state, before any chunk is synced
+			if _, ok := ml.persisted["statetransfer.state"]; ok && 0 != ml.failChunks {
+				interrupted = true
+				ml.failChunks = 0
+			}
+		},
+	})
+
+	if err := executeStateTransfer(sts, ml.MockLedger, 50, 10, mrls, dps); nil != err {
+		t.Fatalf("StateChunkProgress case: %s", err)
+	}
+
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+	if !interrupted {
+		t.Fatalf("The interrupted state sync should have persisted its progress")
+	}
+	if _, ok := ml.persisted["statetransfer.state"]; ok {
+		t.Fatalf("The completed state sync should have removed its progress")
+	}
+	for chunk := uint64(0); chunk < 2; chunk++ {
+		if 1 != ml.requests[chunk] {
+			t.Fatalf("State chunk %d was applied before the interruption, but was requested %d times", chunk, ml.requests[chunk])
+		}
+	}
+}
+
+func TestCatchupStateChunksFallBack(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+
+	snapshots := 0
+	lock := &sync.Mutex{}
+	filter := func(request mockRequest, peerID *protos.PeerID) mockResponse {
+		lock.Lock()
+		defer lock.Unlock()
+		if SyncSnapshot == request {
+			snapshots++
+		}
+		return Normal
+	}
+
+	// No peer can serve the chunks after the first one
+	ml := newChunkingMockLedger(rols, filter)
+	ml.failChunks = 1
+	ml.PutBlock(4, SimpleGetBlock(4)) // Missing blocks 0-3, so the state must be transferred
+	rand.Seed(0)
+	sts := NewStateTransferState(&protos.PeerID{Name: "State Transfer Test"}, loadConfig(), ml, dps)
+	defer sts.Stop()
+	if err := executeStateTransfer(sts, ml.MockLedger, 50, 10, mrls, dps); nil != err {
+		t.Fatalf("StateChunksFallBack case: %s", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if 0 == snapshots {
+		t.Fatalf("The failed chunked state sync should have fallen back to a state snapshot")
+	}
+	if _, ok := ml.persisted["statetransfer.state"]; ok {
+		t.Fatalf("The state snapshot should have replaced the progress of the chunked state sync")
+	}
+}
+
+func TestCatchupStateKeptWithoutPeers(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+	for _, remoteLedger := range *mrls {
+		remoteLedger.blockHeight = 51
+	}
+
+	filter := func(request mockRequest, peerID *protos.PeerID) mockResponse {
+		if SyncStateChunk == request || SyncSnapshot == request {
+			return Timeout
+		}
+		return Normal
+	}
+
+	ml := newChunkingMockLedger(rols, filter)
+	ml.PutBlock(4, SimpleGetBlock(4)) // Missing blocks 0-3, so the state must be transferred
+	ml.state = 1234
+	rand.Seed(0)
+	sts := NewStateTransferState(&protos.PeerID{Name: "State Transfer Test"}, loadConfig(), ml, dps)
+	sts.StateChunkRequestTimeout = 10 * time.Millisecond
+	sts.StateSnapshotRequestTimeout = 10 * time.Millisecond
+	defer sts.Stop()
+
+	errored := make(chan struct{})
+	var once sync.Once
+	sts.RegisterListener(&ProtoListener{
+		ErroredImpl: func(uint64, []byte, []*protos.PeerID, interface{}, error) {
+			once.Do(func() { close(errored) })
+		},
+	})
+	sts.Initiate(dps)
+	sts.AddTarget(50, SimpleGetBlockHash(50), dps, nil)
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the state transfer to fail")
+	case <-errored:
+	}
+
+	if stateHash, _ := ml.GetCurrentStateHash(); "1234" != string(stateHash) {
+		t.Fatalf("No peer sent any state, so the state should have been kept, but its hash is %s", stateHash)
+	}
+}
+
+func TestStateTransferProgress(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+
+	ml := NewMockLedger(rols, nil)
+	ml.PutBlock(0, SimpleGetBlock(0))
+	sts := newTestStateTransfer(ml, dps)
+	defer sts.Stop()
+
+	var phases []protos.StateTransferStatus_Phase
+	lock := &sync.Mutex{}
+	sts.RegisterListener(&ProtoListener{
+		ProgressedImpl: func(status *protos.StateTransferStatus) {
+			lock.Lock()
+			defer lock.Unlock()
+			phases = append(phases, status.Phase)
+		},
+	})
+
+	if err := executeStateTransfer(sts, ml, 50, 10, mrls, dps); nil != err {
+		t.Fatalf("Progress case: %s", err)
+	}
+
+	status := sts.GetStateTransferStatus()
+	if protos.StateTransferStatus_IDLE != status.Phase || 50 != status.TargetBlock {
+		t.Fatalf("Completed state transfer should be idle with target block 50, but reported %v", status)
+	}
+	if 0 == status.BlocksToFetch || status.BlocksFetched != status.BlocksToFetch {
+		t.Fatalf("All blocks should have been fetched, but reported %d of %d", status.BlocksFetched, status.BlocksToFetch)
+	}
+	if status.DeltasApplied != status.DeltasToApply || nil == status.SourcePeer {
+		t.Fatalf("All deltas should have been applied from a source peer, but reported %v", status)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	seen := make(map[protos.StateTransferStatus_Phase]bool)
+	for _, phase := range phases {
+		seen[phase] = true
+	}
+	for _, phase := range []protos.StateTransferStatus_Phase{protos.StateTransferStatus_WAITING_FOR_TARGET, protos.StateTransferStatus_SYNCING_BLOCKS, protos.StateTransferStatus_PLAYING_DELTAS, protos.StateTransferStatus_IDLE} {
+		if !seen[phase] {
+			t.Fatalf("Progress should have been reported for phase %s, but was only for %v", phase, phases)
+		}
+	}
+}
+
+// waitForPhase polls the state transfer status until it reaches the phase
+func waitForPhase(sts *StateTransferState, phase protos.StateTransferStatus_Phase) error {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if sts.GetStateTransferStatus().Phase == phase {
+			return nil
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return fmt.Errorf("State transfer did not reach phase %s, it is in %s", phase, sts.GetStateTransferStatus().Phase)
+}
+
+func TestStateTransferPauseResume(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+	for _, remoteLedger := range *mrls {
+		remoteLedger.blockHeight = 51
+	}
+
+	requests := 0
+	lock := &sync.Mutex{}
+	filter := func(request mockRequest, peerID *protos.PeerID) mockResponse {
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		return Normal
+	}
+
+	ml := NewMockLedger(rols, filter)
+	ml.PutBlock(0, SimpleGetBlock(0))
+	sts := newTestStateTransfer(ml, dps)
+	defer sts.Stop()
+
+	sts.PauseStateTransfer()
+	sts.Initiate(dps)
+	result := sts.CompletionChannel()
+	sts.AddTarget(50, SimpleGetBlockHash(50), dps, nil)
+
+	if err := waitForPhase(sts, protos.StateTransferStatus_SYNCING_BLOCKS); nil != err {
+		t.Fatalf("%s", err)
+	}
+	select {
+	case <-result:
+		t.Fatalf("Paused state transfer should not have completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	lock.Lock()
+	if 0 != requests {
+		t.Fatalf("Paused state transfer should not have made requests, but made %d", requests)
+	}
+	lock.Unlock()
+	if !sts.GetStateTransferStatus().Paused {
+		t.Fatalf("State transfer should report being paused")
+	}
+
+	sts.ResumeStateTransfer()
+	select {
+	case <-result:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Resumed state transfer should have completed")
+	}
+}
+
+func TestStateTransferStopWhilePaused(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+	for _, remoteLedger := range *mrls {
+		remoteLedger.blockHeight = 51
+	}
+
+	ml := NewMockLedger(rols, nil)
+	ml.PutBlock(0, SimpleGetBlock(0))
+	sts := newTestStateTransfer(ml, dps)
+	defer sts.Stop()
+
+	errored := make(chan error, 1)
+	sts.RegisterListener(&ProtoListener{
+		ErroredImpl: func(bn uint64, bh []byte, pids []*protos.PeerID, md interface{}, err error) {
+			select {
+			case errored <- err:
+			default:
+			}
+		},
+	})
+
+	sts.PauseStateTransfer()
+	sts.Initiate(dps)
+	sts.AddTarget(50, SimpleGetBlockHash(50), dps, nil)
+	if err := waitForPhase(sts, protos.StateTransferStatus_SYNCING_BLOCKS); nil != err {
+		t.Fatalf("%s", err)
+	}
+
+	sts.Stop()
+	select {
+	case <-errored:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Stopping a paused state transfer should have woken it up")
+	}
+}
+
+func TestStateTransferControlSparesRepair(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+	for _, remoteLedger := range *mrls {
+		remoteLedger.blockHeight = 51
+	}
+
+	// Missing blocks 0-3, which are repaired in the background
+	ml := NewMockLedger(rols, nil)
+	ml.PutBlock(4, SimpleGetBlock(4))
+	sts := ThreadlessNewStateTransferState(&protos.PeerID{Name: "State Transfer Test"}, loadConfig(), ml, dps)
+	sts.PauseStateTransfer()
+	sts.PinStateTransferPeers([]*protos.PeerID{{Name: "Unknown Peer"}})
+
+	done := make(chan struct{})
+	go func() {
+		for !sts.VerifyAndRecoverBlockchain() {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		sts.Stop()
+		t.Fatalf("Repairing the blockchain should not have been paused nor pinned")
+	}
+
+	for i := uint64(0); i < 4; i++ {
+		if _, err := ml.GetBlock(i); nil != err {
+			t.Fatalf("Block %d should have been repaired: %s", i, err)
+		}
+	}
+}
+
+func TestStateTransferCancel(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+	for _, remoteLedger := range *mrls {
+		remoteLedger.blockHeight = 51
+	}
+
+	ml := NewMockLedger(rols, nil)
+	ml.PutBlock(0, SimpleGetBlock(0))
+	sts := newTestStateTransfer(ml, dps)
+	defer sts.Stop()
+
+	if err := sts.CancelStateTransfer(); nil == err {
+		t.Fatalf("Cancelling without a state transfer in progress should fail")
+	}
+
+	sts.PauseStateTransfer()
+	sts.Initiate(dps)
+	result := sts.CompletionChannel()
+	sts.AddTarget(50, SimpleGetBlockHash(50), dps, nil)
+	if err := waitForPhase(sts, protos.StateTransferStatus_SYNCING_BLOCKS); nil != err {
+		t.Fatalf("%s", err)
+	}
+
+	if err := sts.CancelStateTransfer(); nil != err {
+		t.Fatalf("Cancelling the state transfer failed: %s", err)
+	}
+	sts.ResumeStateTransfer()
+	if err := waitForPhase(sts, protos.StateTransferStatus_WAITING_FOR_TARGET); nil != err {
+		t.Fatalf("Cancelled state transfer should wait for a new target: %s", err)
+	}
+	select {
+	case <-result:
+		t.Fatalf("Cancelled state transfer should not have completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sts.AddTarget(50, SimpleGetBlockHash(50), dps, nil)
+	select {
+	case <-result:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("State transfer should have completed to the new target")
+	}
+}
+
+func TestStateTransferPinPeers(t *testing.T) {
+	rols, mrls, dps := createRemoteLedgers(1, 3)
+	pinned := dps[2]
+
+	asked := make(map[protos.PeerID]bool)
+	lock := &sync.Mutex{}
+	filter := func(request mockRequest, peerID *protos.PeerID) mockResponse {
+		lock.Lock()
+		defer lock.Unlock()
+		asked[*peerID] = true
+		return Normal
+	}
+
+	ml := NewMockLedger(rols, filter)
+	ml.PutBlock(0, SimpleGetBlock(0))
+	sts := newTestStateTransfer(ml, dps)
+	defer sts.Stop()
+	sts.PinStateTransferPeers([]*protos.PeerID{pinned})
+	if err := executeStateTransfer(sts, ml, 100, 10, mrls, dps); nil != err {
+		t.Fatalf("PinPeers case: %s", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if 1 != len(asked) || !asked[*pinned] {
+		t.Fatalf("Only the pinned peer should have been asked, but %v were", asked)
+	}
+	if status := sts.GetStateTransferStatus(); 1 != len(status.PinnedPeers) {
+		t.Fatalf("The pinned peer should be reported, but %v were", status.PinnedPeers)
+	}
+}
@@ -146,7 +146,7 @@ func (instance *pbftCore) sendViewChange() error {
 	logger.Info("Replica %d sending view-change, v:%d, h:%d, |C|:%d, |P|:%d, |Q|:%d",
 		instance.id, vc.View, vc.H, len(vc.Cset), len(vc.Pset), len(vc.Qset))
 
-	return instance.innerBroadcast(&Message{&Message_ViewChange{vc}}, true)
+	return instance.innerBroadcast(&Message{Payload: &Message_ViewChange{vc}}, true)
 }
 
 func (instance *pbftCore) recvViewChange(vc *ViewChange) error {
@@ -237,7 +237,7 @@ func (instance *pbftCore) sendNewView() (err error) {
 	logger.Info("Replica %d is new primary, sending new-view, v:%d, X:%+v",
 		instance.id, nv.View, nv.Xset)
 
-	err = instance.innerBroadcast(&Message{&Message_NewView{nv}}, false)
+	err = instance.innerBroadcast(&Message{Payload: &Message_NewView{nv}}, false)
 	if err != nil {
 		return err
 	}
@@ -380,7 +380,7 @@ func (instance *pbftCore) processNewView2(nv *NewView) error {
 			cert := instance.getCert(instance.view, n)
 			cert.prepare = append(cert.prepare, prep)
 			cert.sentPrepare = true
-			instance.innerBroadcast(&Message{&Message_Prepare{prep}}, true)
+			instance.innerBroadcast(&Message{Payload: &Message_Prepare{prep}}, true)
 		}
 	} else {
 		instance.resubmitRequests()
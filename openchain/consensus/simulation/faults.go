@@ -0,0 +1,114 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package simulation
+
+import (
+	"math/rand"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// Envelope is a message in flight between two replicas. A Src of -1 marks a
+// transaction submitted by a client.
+type Envelope struct {
+	Src   int
+	Dst   int
+	Msg   *pb.OpenchainMessage
+	Delay uint64 // additional ticks before the message may be delivered
+}
+
+func (env *Envelope) clone() *Envelope {
+	c := *env
+	c.Msg = proto.Clone(env.Msg).(*pb.OpenchainMessage)
+	return &c
+}
+
+// Fault inspects a message as it is sent and returns the envelopes to queue
+// in its place: none to drop it, several to duplicate it. Faults may change
+// the delay or the message itself. All randomness must come from rng so that
+// runs are reproducible from the network seed.
+type Fault interface {
+	Apply(rng *rand.Rand, env *Envelope) []*Envelope
+}
+
+// FaultFunc adapts a function to the Fault interface
+type FaultFunc func(rng *rand.Rand, env *Envelope) []*Envelope
+
+// Apply calls f(rng, env)
+func (f FaultFunc) Apply(rng *rand.Rand, env *Envelope) []*Envelope {
+	return f(rng, env)
+}
+
+// Drop discards each message with probability p
+func Drop(p float64) Fault {
+	return FaultFunc(func(rng *rand.Rand, env *Envelope) []*Envelope {
+		if rng.Float64() < p {
+			return nil
+		}
+		return []*Envelope{env}
+	})
+}
+
+// Delay holds back each message with probability p by up to maxTicks ticks
+func Delay(p float64, maxTicks uint64) Fault {
+	return FaultFunc(func(rng *rand.Rand, env *Envelope) []*Envelope {
+		if maxTicks > 0 && rng.Float64() < p {
+			env.Delay += uint64(rng.Int63n(int64(maxTicks))) + 1
+		}
+		return []*Envelope{env}
+	})
+}
+
+// Duplicate delivers each message twice with probability p
+func Duplicate(p float64) Fault {
+	return FaultFunc(func(rng *rand.Rand, env *Envelope) []*Envelope {
+		if rng.Float64() < p {
+			return []*Envelope{env, env.clone()}
+		}
+		return []*Envelope{env}
+	})
+}
+
+// Reorder delays every message by a random number of ticks in [0, window],
+// so that messages sent close together may overtake each other
+func Reorder(window uint64) Fault {
+	return FaultFunc(func(rng *rand.Rand, env *Envelope) []*Envelope {
+		env.Delay += uint64(rng.Int63n(int64(window) + 1))
+		return []*Envelope{env}
+	})
+}
+
+// Rewrite passes every message sent by replica src through fn, which may
+// return a different message per destination, or nil to drop it
+func Rewrite(src int, fn func(msg *pb.OpenchainMessage, dst int) *pb.OpenchainMessage) Fault {
+	return FaultFunc(func(rng *rand.Rand, env *Envelope) []*Envelope {
+		if env.Src != src {
+			return []*Envelope{env}
+		}
+		msg := fn(env.Msg, env.Dst)
+		if msg == nil {
+			return nil
+		}
+		env.Msg = msg
+		return []*Envelope{env}
+	})
+}
@@ -0,0 +1,376 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	"github.com/hyperledger-incubator/obc-peer/openchain/util"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// chaincodeID is the chaincode under which executed transactions are recorded
+const chaincodeID = "simulation"
+
+// Ledger is an in-memory implementation of consensus.Executor and
+// consensus.Ledger. Executing a transaction stores its payload under its
+// uuid, so the state hash is a deterministic function of the executed
+// transactions and their order.
+type Ledger struct {
+	mutex sync.Mutex
+
+	blocks map[uint64]*pb.Block
+	deltas map[uint64]*statemgmt.StateDelta
+	height uint64
+	state  map[string][]byte
+
+	txID       interface{}
+	curBatch   []*pb.Transaction
+	curResults []*pb.TransactionResult
+	curDelta   *statemgmt.StateDelta
+	preBatch   map[string][]byte
+
+	deltaID  interface{}
+	preDelta map[string][]byte
+
+	onBlock func(blockNumber uint64, block *pb.Block)
+}
+
+// NewLedger returns a ledger holding only the genesis block
+func NewLedger() *Ledger {
+	l := &Ledger{
+		blocks: make(map[uint64]*pb.Block),
+		deltas: make(map[uint64]*statemgmt.StateDelta),
+		state:  make(map[string][]byte),
+	}
+	l.putBlock(0, &pb.Block{StateHash: l.stateHash()}, statemgmt.NewStateDelta())
+	return l
+}
+
+func stateKey(chaincodeID, key string) string {
+	return chaincodeID + "\x00" + key
+}
+
+func splitStateKey(k string) (chaincodeID, key string) {
+	i := strings.IndexByte(k, 0)
+	return k[:i], k[i+1:]
+}
+
+func copyState(state map[string][]byte) map[string][]byte {
+	c := make(map[string][]byte, len(state))
+	for k, v := range state {
+		c[k] = v
+	}
+	return c
+}
+
+func (l *Ledger) stateHash() []byte {
+	keys := make([]string, 0, len(l.state))
+	for k := range l.state {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buffer bytes.Buffer
+	for _, k := range keys {
+		buffer.WriteString(k)
+		buffer.WriteByte(0)
+		buffer.Write(l.state[k])
+		buffer.WriteByte(0)
+	}
+	return util.ComputeCryptoHash(buffer.Bytes())
+}
+
+func (l *Ledger) putBlock(blockNumber uint64, block *pb.Block, delta *statemgmt.StateDelta) {
+	l.blocks[blockNumber] = block
+	if delta != nil {
+		l.deltas[blockNumber] = delta
+	}
+	if blockNumber >= l.height {
+		l.height = blockNumber + 1
+	}
+	if l.onBlock != nil {
+		l.onBlock(blockNumber, block)
+	}
+}
+
+// BeginTxBatch starts a new transaction batch
+func (l *Ledger) BeginTxBatch(id interface{}) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.txID != nil {
+		return fmt.Errorf("Transaction batch %v is already in progress", l.txID)
+	}
+	l.txID = id
+	l.curBatch = nil
+	l.curResults = nil
+	l.curDelta = statemgmt.NewStateDelta()
+	l.preBatch = copyState(l.state)
+	return nil
+}
+
+// ExecTxs executes the transactions and returns the resulting state hash
+func (l *Ledger) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !reflect.DeepEqual(l.txID, id) {
+		return nil, fmt.Errorf("Invalid batch ID %v, current batch is %v", id, l.txID)
+	}
+	for _, tx := range txs {
+		k := stateKey(chaincodeID, tx.Uuid)
+		l.curDelta.Set(chaincodeID, tx.Uuid, tx.Payload, l.state[k])
+		l.state[k] = tx.Payload
+	}
+	l.curBatch = append(l.curBatch, txs...)
+	return l.stateHash(), nil
+}
+
+// RejectTxs records the results of transactions excluded from the batch
+func (l *Ledger) RejectTxs(id interface{}, results []*pb.TransactionResult) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !reflect.DeepEqual(l.txID, id) {
+		return fmt.Errorf("Invalid batch ID %v, current batch is %v", id, l.txID)
+	}
+	l.curResults = append(l.curResults, results...)
+	return nil
+}
+
+func (l *Ledger) previewBlock(metadata []byte) (*pb.Block, error) {
+	previousBlockHash, err := l.blocks[l.height-1].GetHash()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Block{
+		Transactions:      l.curBatch,
+		StateHash:         l.stateHash(),
+		PreviousBlockHash: previousBlockHash,
+		ConsensusMetadata: metadata,
+	}, nil
+}
+
+// CommitTxBatch appends the current transaction batch to the chain as a new block
+func (l *Ledger) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !reflect.DeepEqual(l.txID, id) {
+		return nil, fmt.Errorf("Invalid batch ID %v, current batch is %v", id, l.txID)
+	}
+	block, err := l.previewBlock(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if len(l.curResults) > 0 {
+		block.NonHashData = &pb.NonHashData{TransactionResults: l.curResults}
+	}
+	l.putBlock(l.height, block, l.curDelta)
+	l.txID = nil
+	l.curBatch = nil
+	l.curResults = nil
+	l.curDelta = nil
+	l.preBatch = nil
+	return block, nil
+}
+
+// RollbackTxBatch discards the current transaction batch
+func (l *Ledger) RollbackTxBatch(id interface{}) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !reflect.DeepEqual(l.txID, id) {
+		return fmt.Errorf("Invalid batch ID %v, current batch is %v", id, l.txID)
+	}
+	l.state = l.preBatch
+	l.txID = nil
+	l.curBatch = nil
+	l.curResults = nil
+	l.curDelta = nil
+	l.preBatch = nil
+	return nil
+}
+
+// PreviewCommitTxBatch returns the block CommitTxBatch would append
+func (l *Ledger) PreviewCommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !reflect.DeepEqual(l.txID, id) {
+		return nil, fmt.Errorf("Invalid batch ID %v, current batch is %v", id, l.txID)
+	}
+	return l.previewBlock(metadata)
+}
+
+// GetBlock returns the block at the given height
+func (l *Ledger) GetBlock(id uint64) (*pb.Block, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	block, ok := l.blocks[id]
+	if !ok {
+		return nil, fmt.Errorf("Block %d does not exist", id)
+	}
+	return block, nil
+}
+
+// GetCurrentStateHash returns the hash of the current state
+func (l *Ledger) GetCurrentStateHash() ([]byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.stateHash(), nil
+}
+
+// GetBlockchainSize returns the number of blocks in the chain
+func (l *Ledger) GetBlockchainSize() (uint64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.height, nil
+}
+
+// GetStateDelta returns the state delta produced by the given block
+func (l *Ledger) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delta, ok := l.deltas[blockNumber]
+	if !ok {
+		return nil, fmt.Errorf("No state delta for block %d", blockNumber)
+	}
+	return delta, nil
+}
+
+// HashBlock returns the hash of the given block
+func (l *Ledger) HashBlock(block *pb.Block) ([]byte, error) {
+	return block.GetHash()
+}
+
+// VerifyBlockchain checks the hash chain between highBlock and lowBlock,
+// returning the first block whose PreviousBlockHash does not match
+func (l *Ledger) VerifyBlockchain(highBlock, lowBlock uint64) (uint64, error) {
+	for i := highBlock; i > lowBlock; i-- {
+		current, err := l.GetBlock(i)
+		if err != nil {
+			return i, err
+		}
+		previous, err := l.GetBlock(i - 1)
+		if err != nil {
+			return i - 1, err
+		}
+		previousHash, err := previous.GetHash()
+		if err != nil {
+			return i - 1, err
+		}
+		if !bytes.Equal(previousHash, current.PreviousBlockHash) {
+			return i, nil
+		}
+	}
+	return 0, nil
+}
+
+// PutBlock inserts a block at the given height without any validation
+func (l *Ledger) PutBlock(blockNumber uint64, block *pb.Block) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.putBlock(blockNumber, block, nil)
+	return nil
+}
+
+// ApplyStateDelta applies a delta to the current state
+func (l *Ledger) ApplyStateDelta(id interface{}, delta *statemgmt.StateDelta) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.deltaID != nil {
+		if !reflect.DeepEqual(l.deltaID, id) {
+			return fmt.Errorf("A different state delta is already being applied")
+		}
+	} else {
+		l.deltaID = id
+		l.preDelta = copyState(l.state)
+	}
+	for _, cc := range delta.GetUpdatedChaincodeIds(true) {
+		for key, value := range delta.GetUpdates(cc) {
+			v := value.GetValue()
+			if delta.RollBackwards {
+				v = value.GetPreviousValue()
+			}
+			if v == nil {
+				delete(l.state, stateKey(cc, key))
+			} else {
+				l.state[stateKey(cc, key)] = v
+			}
+		}
+	}
+	return nil
+}
+
+// CommitStateDelta makes the applied delta permanent
+func (l *Ledger) CommitStateDelta(id interface{}) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.deltaID = nil
+	l.preDelta = nil
+	return nil
+}
+
+// RollbackStateDelta reverts the applied delta
+func (l *Ledger) RollbackStateDelta(id interface{}) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.preDelta != nil {
+		l.state = l.preDelta
+	}
+	l.deltaID = nil
+	l.preDelta = nil
+	return nil
+}
+
+// EmptyState removes all keys from the state
+func (l *Ledger) EmptyState() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.state = make(map[string][]byte)
+	return nil
+}
+
+// snapshot returns the whole state as a single delta and the block it corresponds to
+func (l *Ledger) snapshot() (*statemgmt.StateDelta, uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delta := statemgmt.NewStateDelta()
+	for k, v := range l.state {
+		cc, key := splitStateKey(k)
+		delta.Set(cc, key, v, nil)
+	}
+	return delta, l.height - 1
+}
+
+// hasTransaction returns whether a committed block contains the transaction
+func (l *Ledger) hasTransaction(uuid string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, block := range l.blocks {
+		for _, tx := range block.Transactions {
+			if tx.Uuid == uuid {
+				return true
+			}
+		}
+	}
+	return false
+}
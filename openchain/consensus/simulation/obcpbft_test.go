@@ -0,0 +1,75 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus/obcpbft"
+)
+
+// newObcpbft runs the obcpbft plugin, in the mode of its config.yaml, as the
+// consenter of a replica
+func newObcpbft(id int, stack consensus.Stack) consensus.Consenter {
+	return obcpbft.New(stack)
+}
+
+// closeAll stops the timers and goroutines of the consenters of net
+func closeAll(net *Network) {
+	for _, r := range net.replicas {
+		if closer, ok := r.Consenter().(interface {
+			Close()
+		}); ok {
+			closer.Close()
+		}
+	}
+}
+
+func TestObcpbftReliableNetwork(t *testing.T) {
+	net := NewNetwork(Config{N: 4, Seed: 11, Settle: 200 * time.Millisecond}, newObcpbft)
+	defer closeAll(net)
+	submitAll(t, net, 5)
+	if err := net.Run(100000); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if err := net.Check(); err != nil {
+		t.Fatalf("Expected agreement and liveness: %s", err)
+	}
+}
+
+func TestObcpbftCrashedBackup(t *testing.T) {
+	net := NewNetwork(Config{N: 4, Seed: 12, Settle: 200 * time.Millisecond}, newObcpbft)
+	defer closeAll(net)
+	net.AddFault(Reorder(3))
+	net.Crash(3)
+	for i := 0; i < 5; i++ {
+		if err := net.Submit(i%3, makeTx(i)); err != nil {
+			t.Fatalf("Failed to submit transaction %d: %s", i, err)
+		}
+	}
+	if err := net.Run(100000); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if err := net.Check(); err != nil {
+		t.Fatalf("Expected the 3 surviving replicas to agree and be live with f=1: %s", err)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package simulation
+
+import (
+	"fmt"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// Replica is a simulated validating peer. It implements consensus.Stack on
+// top of the network and its embedded in-memory ledger.
+type Replica struct {
+	*Ledger
+
+	id        int
+	handle    *pb.PeerID
+	net       *Network
+	consenter consensus.Consenter
+	crashed   bool
+	byzantine bool
+}
+
+// ID returns the index of the replica in the network
+func (r *Replica) ID() int {
+	return r.id
+}
+
+// Handle returns the PeerID of the replica
+func (r *Replica) Handle() *pb.PeerID {
+	return r.handle
+}
+
+// Consenter returns the current consenter of the replica, nil while it is crashed
+func (r *Replica) Consenter() consensus.Consenter {
+	r.net.mutex.Lock()
+	defer r.net.mutex.Unlock()
+	return r.consenter
+}
+
+func (r *Replica) endpoint() *pb.PeerEndpoint {
+	return &pb.PeerEndpoint{ID: r.handle, Address: r.handle.Name, Type: pb.PeerEndpoint_VALIDATOR}
+}
+
+func (r *Replica) lookup(handle *pb.PeerID) (*Replica, error) {
+	for _, other := range r.net.replicas {
+		if *other.handle == *handle {
+			return other, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown replica %v", handle)
+}
+
+// GetNetworkInfo returns the endpoints of this replica and of the whole network
+func (r *Replica) GetNetworkInfo() (self *pb.PeerEndpoint, network []*pb.PeerEndpoint, err error) {
+	for _, other := range r.net.replicas {
+		network = append(network, other.endpoint())
+	}
+	return r.endpoint(), network, nil
+}
+
+// GetNetworkHandles returns the handles of this replica and of the whole network
+func (r *Replica) GetNetworkHandles() (self *pb.PeerID, network []*pb.PeerID, err error) {
+	for _, other := range r.net.replicas {
+		network = append(network, other.handle)
+	}
+	return r.handle, network, nil
+}
+
+// Broadcast sends a message to all other validators, also when it is for
+// peers of any type (PeerEndpoint_UNDEFINED). There are no non-validating
+// peers in the simulation, so messages only for them are discarded.
+func (r *Replica) Broadcast(msg *pb.OpenchainMessage, peerType pb.PeerEndpoint_Type) error {
+	if peerType == pb.PeerEndpoint_NON_VALIDATOR {
+		return nil
+	}
+	for _, other := range r.net.replicas {
+		if other.id != r.id {
+			r.net.send(r.id, other.id, msg)
+		}
+	}
+	return nil
+}
+
+// Unicast sends a message to a single validator
+func (r *Replica) Unicast(msg *pb.OpenchainMessage, receiverHandle *pb.PeerID) error {
+	other, err := r.lookup(receiverHandle)
+	if err != nil {
+		return err
+	}
+	r.net.send(r.id, other.id, msg)
+	return nil
+}
+
+// Sign returns the message itself, the simulation does not model signatures
+func (r *Replica) Sign(msg []byte) ([]byte, error) {
+	return msg, nil
+}
+
+// Verify accepts every signature, the simulation does not model signatures
+func (r *Replica) Verify(peerID *pb.PeerID, signature []byte, message []byte) error {
+	return nil
+}
+
+// GetRemoteBlocks streams blocks start through finish from another replica
+func (r *Replica) GetRemoteBlocks(replicaID *pb.PeerID, start, finish uint64) (<-chan *pb.SyncBlocks, error) {
+	other, err := r.remote(replicaID)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*pb.SyncBlocks
+	for _, n := range blockRange(start, finish) {
+		block, err := other.Ledger.GetBlock(n)
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, &pb.SyncBlocks{Range: &pb.SyncBlockRange{Start: n, End: n}, Blocks: []*pb.Block{block}})
+	}
+	c := make(chan *pb.SyncBlocks, len(msgs))
+	for _, msg := range msgs {
+		c <- msg
+	}
+	close(c)
+	return c, nil
+}
+
+// GetRemoteStateSnapshot streams the current state of another replica
+func (r *Replica) GetRemoteStateSnapshot(replicaID *pb.PeerID) (<-chan *pb.SyncStateSnapshot, error) {
+	other, err := r.remote(replicaID)
+	if err != nil {
+		return nil, err
+	}
+	delta, blockNumber := other.Ledger.snapshot()
+	c := make(chan *pb.SyncStateSnapshot, 2)
+	c <- &pb.SyncStateSnapshot{Delta: delta.Marshal(), Sequence: 0, BlockNumber: blockNumber}
+	c <- &pb.SyncStateSnapshot{Sequence: 1, BlockNumber: blockNumber}
+	close(c)
+	return c, nil
+}
+
+// GetRemoteStateDeltas streams the state deltas of blocks start through finish from another replica
+func (r *Replica) GetRemoteStateDeltas(replicaID *pb.PeerID, start, finish uint64) (<-chan *pb.SyncStateDeltas, error) {
+	other, err := r.remote(replicaID)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*pb.SyncStateDeltas
+	for _, n := range blockRange(start, finish) {
+		delta, err := other.Ledger.GetStateDelta(n)
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, &pb.SyncStateDeltas{Range: &pb.SyncBlockRange{Start: n, End: n}, Deltas: [][]byte{delta.Marshal()}})
+	}
+	c := make(chan *pb.SyncStateDeltas, len(msgs))
+	for _, msg := range msgs {
+		c <- msg
+	}
+	close(c)
+	return c, nil
+}
+
+// remote returns the replica behind handle if it can currently be reached
+func (r *Replica) remote(handle *pb.PeerID) (*Replica, error) {
+	other, err := r.lookup(handle)
+	if err != nil {
+		return nil, err
+	}
+	r.net.mutex.Lock()
+	defer r.net.mutex.Unlock()
+	if !r.net.reachable(r.id, other.id) {
+		return nil, fmt.Errorf("Replica %v is unreachable from %v", handle, r.handle)
+	}
+	return other, nil
+}
+
+// blockRange lists the block numbers from start to finish inclusively, in
+// descending order if start is above finish
+func blockRange(start, finish uint64) []uint64 {
+	var numbers []uint64
+	for n := start; ; {
+		numbers = append(numbers, n)
+		if n == finish {
+			return numbers
+		}
+		if start < finish {
+			n++
+		} else {
+			n--
+		}
+	}
+}
+
+var _ consensus.Stack = (*Replica)(nil)
@@ -0,0 +1,508 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package simulation runs several replicas of a consensus plugin against
+// in-memory ledgers inside a single process. Messages between replicas go
+// through a scheduler driven by a seeded random source and a logical clock,
+// so that a run can be reproduced from its seed, and through a chain of
+// faults which can drop, delay, duplicate, reorder or rewrite them. The
+// network can further be partitioned and replicas crashed and restarted.
+// Agreement between the correct replicas is checked on every block they
+// commit; liveness is checked on request.
+//
+// Runs are only fully reproducible for consenters which do all of their work
+// inside RecvMsg. Consenters with their own goroutines and timers can still be
+// simulated by giving the network a settle time, but their interleaving then
+// depends on the Go scheduler.
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/op/go-logging"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+var logger *logging.Logger // package-level logger
+
+func init() {
+	logger = logging.MustGetLogger("consensus/simulation")
+}
+
+// Config parameterizes a simulated network
+type Config struct {
+	N    int   // number of replicas
+	Seed int64 // seed of the scheduler and the faults
+
+	// Settle is how long the network waits for messages from consenters
+	// working asynchronously before it considers itself idle. Leave it zero
+	// for consenters which only send messages from within RecvMsg.
+	Settle time.Duration
+}
+
+// ConsenterFactory creates the consenter of replica id on top of its stack.
+// It is called again whenever a crashed replica is restarted.
+type ConsenterFactory func(id int, stack consensus.Stack) consensus.Consenter
+
+type scheduled struct {
+	env *Envelope
+	at  uint64
+	seq uint64
+}
+
+type event struct {
+	at  uint64
+	seq uint64
+	fn  func()
+}
+
+// Network is a simulated network of replicas
+type Network struct {
+	mutex  sync.Mutex
+	rng    *rand.Rand
+	tick   uint64
+	seq    uint64
+	queue  []*scheduled
+	events []*event
+	wakeup chan struct{}
+
+	replicas     []*Replica
+	faults       []Fault
+	partition    []int // partition group of every replica, nil when healed
+	newConsenter ConsenterFactory
+	settle       time.Duration
+
+	submitted []*pb.Transaction
+	chain     map[uint64][]byte // block hashes committed by correct replicas
+	violation error
+}
+
+// NewNetwork creates a network of config.N replicas, each with a fresh
+// ledger and a consenter created by newConsenter
+func NewNetwork(config Config, newConsenter ConsenterFactory) *Network {
+	net := &Network{
+		rng:          rand.New(rand.NewSource(config.Seed)),
+		wakeup:       make(chan struct{}, 1),
+		newConsenter: newConsenter,
+		settle:       config.Settle,
+		chain:        make(map[uint64][]byte),
+	}
+	for i := 0; i < config.N; i++ {
+		r := &Replica{
+			id:     i,
+			handle: &pb.PeerID{Name: "vp" + strconv.Itoa(i)},
+			net:    net,
+			Ledger: NewLedger(),
+		}
+		r.Ledger.onBlock = func(blockNumber uint64, block *pb.Block) {
+			net.recordBlock(r, blockNumber, block)
+		}
+		net.replicas = append(net.replicas, r)
+	}
+	for _, r := range net.replicas {
+		net.recordBlock(r, 0, r.Ledger.blocks[0])
+		r.consenter = newConsenter(r.id, r)
+	}
+	return net
+}
+
+// Replica returns replica id
+func (net *Network) Replica(id int) *Replica {
+	return net.replicas[id]
+}
+
+// Tick returns the current logical time
+func (net *Network) Tick() uint64 {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	return net.tick
+}
+
+// AddFault appends a fault to the chain every sent message goes through
+func (net *Network) AddFault(fault Fault) {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	net.faults = append(net.faults, fault)
+}
+
+// ClearFaults removes all faults, including Byzantine rewrites
+func (net *Network) ClearFaults() {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	net.faults = nil
+}
+
+// At schedules fn to run when the logical clock reaches tick, e.g. to
+// partition the network or crash a replica in the middle of a run
+func (net *Network) At(tick uint64, fn func()) {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	net.seq++
+	net.events = append(net.events, &event{at: tick, seq: net.seq, fn: fn})
+}
+
+// Partition splits the network into the given groups of replica ids.
+// Messages between replicas of different groups are lost; replicas not
+// listed form a group of their own.
+func (net *Network) Partition(groups ...[]int) {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	net.partition = make([]int, len(net.replicas))
+	for i := range net.partition {
+		net.partition[i] = -1 - i
+	}
+	for g, group := range groups {
+		for _, id := range group {
+			net.partition[id] = g
+		}
+	}
+}
+
+// Heal removes any partition
+func (net *Network) Heal() {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	net.partition = nil
+}
+
+// Crash stops replica id. Messages to and from it are lost until it is
+// restarted, including those already in flight. Its ledger is kept.
+func (net *Network) Crash(id int) {
+	net.mutex.Lock()
+	r := net.replicas[id]
+	r.crashed = true
+	consenter := r.consenter
+	r.consenter = nil
+	queue := net.queue[:0]
+	for _, s := range net.queue {
+		if s.env.Src != id && s.env.Dst != id {
+			queue = append(queue, s)
+		}
+	}
+	net.queue = queue
+	net.mutex.Unlock()
+
+	if closer, ok := consenter.(interface {
+		Close()
+	}); ok {
+		closer.Close()
+	}
+}
+
+// Restart brings a crashed replica back with a fresh consenter on top of its
+// existing ledger
+func (net *Network) Restart(id int) {
+	r := net.replicas[id]
+	consenter := net.newConsenter(id, r)
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	r.consenter = consenter
+	r.crashed = false
+}
+
+// Byzantine marks replica id as faulty and rewrites every message it sends
+// through fn. Faulty replicas are excluded from the agreement and liveness
+// checks.
+func (net *Network) Byzantine(id int, fn func(msg *pb.OpenchainMessage, dst int) *pb.OpenchainMessage) {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	net.replicas[id].byzantine = true
+	net.faults = append(net.faults, Rewrite(id, fn))
+}
+
+// Submit hands a transaction to replica id as a client would. Submitted
+// transactions are expected to be committed by the liveness check.
+func (net *Network) Submit(id int, tx *pb.Transaction) error {
+	payload, err := proto.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	msg := &pb.OpenchainMessage{Type: pb.OpenchainMessage_CHAIN_TRANSACTION, Payload: payload}
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	if net.replicas[id].crashed {
+		return fmt.Errorf("Replica %d is down", id)
+	}
+	net.submitted = append(net.submitted, tx)
+	net.enqueue(&Envelope{Src: -1, Dst: id, Msg: msg})
+	return nil
+}
+
+// send passes a message through the faults and queues the result
+func (net *Network) send(src, dst int, msg *pb.OpenchainMessage) {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	envs := []*Envelope{{Src: src, Dst: dst, Msg: proto.Clone(msg).(*pb.OpenchainMessage)}}
+	for _, fault := range net.faults {
+		var next []*Envelope
+		for _, env := range envs {
+			next = append(next, fault.Apply(net.rng, env)...)
+		}
+		envs = next
+	}
+	for _, env := range envs {
+		net.enqueue(env)
+	}
+}
+
+func (net *Network) enqueue(env *Envelope) {
+	net.seq++
+	net.queue = append(net.queue, &scheduled{env: env, at: net.tick + env.Delay, seq: net.seq})
+	select {
+	case net.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (net *Network) reachable(src, dst int) bool {
+	if src < 0 {
+		return !net.replicas[dst].crashed
+	}
+	if net.replicas[src].crashed || net.replicas[dst].crashed {
+		return false
+	}
+	return net.partition == nil || net.partition[src] == net.partition[dst]
+}
+
+// dueEvents removes and returns the events due at the current tick
+func (net *Network) dueEvents() []*event {
+	var due, rest []*event
+	for _, e := range net.events {
+		if e.at <= net.tick {
+			due = append(due, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	net.events = rest
+	sort.Sort(eventsBySeq(due))
+	return due
+}
+
+type eventsBySeq []*event
+
+func (e eventsBySeq) Len() int           { return len(e) }
+func (e eventsBySeq) Less(i, j int) bool { return e[i].seq < e[j].seq }
+func (e eventsBySeq) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// Step advances the logical clock and delivers the next message which is due,
+// running any events scheduled in between. It returns false when there was
+// neither a message nor an event left.
+func (net *Network) Step() bool {
+	net.mutex.Lock()
+	if len(net.queue) == 0 && len(net.events) == 0 {
+		net.mutex.Unlock()
+		return false
+	}
+	net.tick++
+
+	// Jump ahead if nothing is due yet
+	next := ^uint64(0)
+	for _, s := range net.queue {
+		if s.at < next {
+			next = s.at
+		}
+	}
+	for _, e := range net.events {
+		if e.at < next {
+			next = e.at
+		}
+	}
+	if next > net.tick {
+		net.tick = next
+	}
+
+	due := net.dueEvents()
+	if len(due) > 0 {
+		net.mutex.Unlock()
+		for _, e := range due {
+			e.fn()
+		}
+		return true
+	}
+
+	// Deliver the earliest due message, ties broken by send order
+	idx := -1
+	for i, s := range net.queue {
+		if s.at > net.tick {
+			continue
+		}
+		if idx < 0 || s.at < net.queue[idx].at || (s.at == net.queue[idx].at && s.seq < net.queue[idx].seq) {
+			idx = i
+		}
+	}
+	s := net.queue[idx]
+	net.queue = append(net.queue[:idx], net.queue[idx+1:]...)
+
+	env := s.env
+	if !net.reachable(env.Src, env.Dst) {
+		net.mutex.Unlock()
+		return true
+	}
+	dst := net.replicas[env.Dst]
+	consenter := dst.consenter
+	sender := dst.handle
+	if env.Src >= 0 {
+		sender = net.replicas[env.Src].handle
+	}
+	net.mutex.Unlock()
+
+	if err := consenter.RecvMsg(env.Msg, sender); err != nil {
+		logger.Warning("Replica %d failed to handle %s from %v: %s", env.Dst, env.Msg.Type, sender, err)
+	}
+	return true
+}
+
+// waitIdle waits up to the settle time for an asynchronous consenter to send
+// a message, returning whether one arrived
+func (net *Network) waitIdle() bool {
+	if net.settle == 0 {
+		return false
+	}
+	deadline := time.After(net.settle)
+	for {
+		net.mutex.Lock()
+		pending := len(net.queue) > 0
+		net.mutex.Unlock()
+		if pending {
+			return true
+		}
+		select {
+		case <-net.wakeup:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// Run steps the network until it is idle or maxSteps steps have been taken.
+// It stops early and returns an error as soon as the correct replicas
+// disagree.
+func (net *Network) Run(maxSteps int) error {
+	for i := 0; i < maxSteps; i++ {
+		if !net.Step() && !net.waitIdle() {
+			break
+		}
+		if err := net.Violation(); err != nil {
+			return err
+		}
+	}
+	return net.Violation()
+}
+
+// Violation returns the first agreement violation seen so far, if any
+func (net *Network) Violation() error {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	return net.violation
+}
+
+func (net *Network) recordBlock(r *Replica, blockNumber uint64, block *pb.Block) {
+	hash, err := block.GetHash()
+	if err != nil {
+		return
+	}
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	if r.byzantine || net.violation != nil {
+		return
+	}
+	if known, ok := net.chain[blockNumber]; !ok {
+		net.chain[blockNumber] = hash
+	} else if !bytes.Equal(known, hash) {
+		net.violation = fmt.Errorf("Agreement violated: replica %d committed block %d with hash %x, but another correct replica committed %x", r.id, blockNumber, hash, known)
+	}
+}
+
+// correct returns the replicas which are neither Byzantine nor crashed
+func (net *Network) correct() []*Replica {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	var replicas []*Replica
+	for _, r := range net.replicas {
+		if !r.byzantine && !r.crashed {
+			replicas = append(replicas, r)
+		}
+	}
+	return replicas
+}
+
+// CheckAgreement verifies that all correct replicas hold the same blocks at
+// every height they have in common
+func (net *Network) CheckAgreement() error {
+	if err := net.Violation(); err != nil {
+		return err
+	}
+	replicas := net.correct()
+	for i, a := range replicas {
+		for _, b := range replicas[i+1:] {
+			ha, _ := a.Ledger.GetBlockchainSize()
+			hb, _ := b.Ledger.GetBlockchainSize()
+			if hb < ha {
+				ha = hb
+			}
+			for n := uint64(0); n < ha; n++ {
+				ba, errA := a.Ledger.GetBlock(n)
+				bb, errB := b.Ledger.GetBlock(n)
+				if errA != nil || errB != nil {
+					continue
+				}
+				hashA, _ := ba.GetHash()
+				hashB, _ := bb.GetHash()
+				if !bytes.Equal(hashA, hashB) {
+					return fmt.Errorf("Agreement violated: replicas %d and %d hold different blocks at height %d", a.id, b.id, n)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckLiveness verifies that every submitted transaction has been committed
+// by every correct replica
+func (net *Network) CheckLiveness() error {
+	net.mutex.Lock()
+	submitted := append([]*pb.Transaction(nil), net.submitted...)
+	net.mutex.Unlock()
+	for _, r := range net.correct() {
+		for _, tx := range submitted {
+			if !r.Ledger.hasTransaction(tx.Uuid) {
+				return fmt.Errorf("Liveness violated: replica %d has not committed transaction %s", r.id, tx.Uuid)
+			}
+		}
+	}
+	return nil
+}
+
+// Check runs both the agreement and the liveness check
+func (net *Network) Check() error {
+	if err := net.CheckAgreement(); err != nil {
+		return err
+	}
+	return net.CheckLiveness()
+}
@@ -0,0 +1,230 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package simulation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// sequencer is a minimal consenter: replica 0 numbers the transactions it
+// receives and broadcasts them, every replica executes them in that order.
+// It does no retransmission, so it only stays live on a reliable network.
+type sequencer struct {
+	id      int
+	stack   consensus.Stack
+	nextSeq uint64
+	pending map[uint64]*pb.Transaction
+}
+
+func newSequencer(id int, stack consensus.Stack) consensus.Consenter {
+	size, _ := stack.GetBlockchainSize()
+	return &sequencer{id: id, stack: stack, nextSeq: size, pending: make(map[uint64]*pb.Transaction)}
+}
+
+func (s *sequencer) RecvMsg(msg *pb.OpenchainMessage, senderHandle *pb.PeerID) error {
+	switch msg.Type {
+	case pb.OpenchainMessage_CHAIN_TRANSACTION:
+		if s.id != 0 {
+			_, network, _ := s.stack.GetNetworkHandles()
+			return s.stack.Unicast(msg, network[0])
+		}
+		tx := &pb.Transaction{}
+		if err := proto.Unmarshal(msg.Payload, tx); err != nil {
+			return err
+		}
+		seq := s.nextSeq + uint64(len(s.pending))
+		metadata := make([]byte, 8)
+		binary.BigEndian.PutUint64(metadata, seq)
+		payload, _ := proto.Marshal(&pb.Block{Transactions: []*pb.Transaction{tx}, ConsensusMetadata: metadata})
+		s.stack.Broadcast(&pb.OpenchainMessage{Type: pb.OpenchainMessage_CONSENSUS, Payload: payload}, pb.PeerEndpoint_VALIDATOR)
+		s.pending[seq] = tx
+	case pb.OpenchainMessage_CONSENSUS:
+		block := &pb.Block{}
+		if err := proto.Unmarshal(msg.Payload, block); err != nil {
+			return err
+		}
+		seq := binary.BigEndian.Uint64(block.ConsensusMetadata)
+		if seq >= s.nextSeq {
+			s.pending[seq] = block.Transactions[0]
+		}
+	}
+	return s.executeInOrder()
+}
+
+func (s *sequencer) executeInOrder() error {
+	for {
+		tx, ok := s.pending[s.nextSeq]
+		if !ok {
+			return nil
+		}
+		delete(s.pending, s.nextSeq)
+		if err := s.stack.BeginTxBatch(s.nextSeq); err != nil {
+			return err
+		}
+		if _, err := s.stack.ExecTxs(s.nextSeq, []*pb.Transaction{tx}); err != nil {
+			return err
+		}
+		if _, err := s.stack.CommitTxBatch(s.nextSeq, nil); err != nil {
+			return err
+		}
+		s.nextSeq++
+	}
+}
+
+func makeTx(i int) *pb.Transaction {
+	return &pb.Transaction{Uuid: fmt.Sprintf("tx%d", i), Payload: []byte(fmt.Sprintf("payload%d", i))}
+}
+
+func submitAll(t *testing.T, net *Network, count int) {
+	for i := 0; i < count; i++ {
+		if err := net.Submit(i%len(net.replicas), makeTx(i)); err != nil {
+			t.Fatalf("Failed to submit transaction %d: %s", i, err)
+		}
+	}
+}
+
+func TestReliableNetwork(t *testing.T) {
+	net := NewNetwork(Config{N: 4, Seed: 1}, newSequencer)
+	submitAll(t, net, 20)
+	if err := net.Run(10000); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if err := net.Check(); err != nil {
+		t.Fatalf("Expected agreement and liveness: %s", err)
+	}
+	if size, _ := net.Replica(3).GetBlockchainSize(); size != 21 {
+		t.Errorf("Expected 21 blocks, got %d", size)
+	}
+}
+
+func TestReorderAndDuplicate(t *testing.T) {
+	net := NewNetwork(Config{N: 4, Seed: 2}, newSequencer)
+	net.AddFault(Reorder(5))
+	net.AddFault(Duplicate(0.3))
+	submitAll(t, net, 20)
+	if err := net.Run(10000); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if err := net.Check(); err != nil {
+		t.Fatalf("Expected agreement and liveness despite reordering: %s", err)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	run := func() [][]byte {
+		net := NewNetwork(Config{N: 4, Seed: 3}, newSequencer)
+		net.AddFault(Reorder(10))
+		net.AddFault(Delay(0.5, 20))
+		net.AddFault(Drop(0.1))
+		submitAll(t, net, 10)
+		net.Run(10000)
+		var hashes [][]byte
+		for _, r := range net.replicas {
+			hash, _ := r.GetCurrentStateHash()
+			hashes = append(hashes, hash)
+		}
+		return hashes
+	}
+	first, second := run(), run()
+	for i := range first {
+		if !bytes.Equal(first[i], second[i]) {
+			t.Errorf("Replica %d ended in different states for the same seed", i)
+		}
+	}
+}
+
+func TestDropViolatesLiveness(t *testing.T) {
+	net := NewNetwork(Config{N: 4, Seed: 4}, newSequencer)
+	net.AddFault(Drop(0.5))
+	submitAll(t, net, 20)
+	if err := net.Run(10000); err != nil {
+		t.Fatalf("Dropping messages should not violate agreement: %s", err)
+	}
+	if err := net.CheckLiveness(); err == nil {
+		t.Fatalf("Expected a liveness violation with lossy links and no retransmission")
+	}
+}
+
+func TestPartition(t *testing.T) {
+	net := NewNetwork(Config{N: 4, Seed: 5}, newSequencer)
+	net.Partition([]int{0, 1, 2})
+	submitAll(t, net, 3)
+	net.Run(10000)
+	if err := net.CheckLiveness(); err == nil {
+		t.Fatalf("Expected replica 3 to miss transactions while partitioned")
+	}
+	if size, _ := net.Replica(1).GetBlockchainSize(); size != 4 {
+		t.Errorf("Expected the majority side to commit all 3 transactions, has %d blocks", size)
+	}
+}
+
+func TestCrashRestart(t *testing.T) {
+	net := NewNetwork(Config{N: 4, Seed: 6}, newSequencer)
+	net.Crash(2)
+	if err := net.Submit(2, makeTx(0)); err == nil {
+		t.Fatalf("Expected submitting to a crashed replica to fail")
+	}
+	for i := 1; i <= 6; i++ {
+		net.Submit(i%2, makeTx(i))
+	}
+	if err := net.Run(10000); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	if err := net.Check(); err != nil {
+		t.Fatalf("Expected the surviving replicas to be live: %s", err)
+	}
+
+	net.Restart(2)
+	if net.Replica(2).Consenter() == nil {
+		t.Fatalf("Expected a fresh consenter after restart")
+	}
+	if err := net.CheckLiveness(); err == nil {
+		t.Fatalf("Expected the restarted replica to lag behind")
+	}
+	if err := net.CheckAgreement(); err != nil {
+		t.Fatalf("Restarted replica should agree on its prefix: %s", err)
+	}
+}
+
+func TestByzantineEquivocation(t *testing.T) {
+	net := NewNetwork(Config{N: 4, Seed: 7}, newSequencer)
+	net.Byzantine(0, func(msg *pb.OpenchainMessage, dst int) *pb.OpenchainMessage {
+		if msg.Type != pb.OpenchainMessage_CONSENSUS || dst%2 == 0 {
+			return msg
+		}
+		block := &pb.Block{}
+		proto.Unmarshal(msg.Payload, block)
+		block.Transactions[0].Payload = []byte("forged")
+		msg.Payload, _ = proto.Marshal(block)
+		return msg
+	})
+	submitAll(t, net, 4)
+	if err := net.Run(10000); err == nil {
+		t.Fatalf("Expected the correct replicas to disagree after the leader equivocated")
+	}
+}
@@ -0,0 +1,531 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package statetransfer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// =============================================================================
+// parallel block synchronization
+// =============================================================================
+
+// progressKey is where the range of blocks synced so far is persisted, so
+// that a restarted peer does not fetch them again
+const progressKey = "statetransfer.progress"
+
+// blockChunk is a range of blocks requested from a single peer, from
+// highBlock down to lowBlock
+type blockChunk struct {
+	highBlock uint64
+	lowBlock  uint64
+	peerID    *protos.PeerID
+	blocks    []*protos.Block // blocks[i] is block highBlock-i
+	err       error
+	invalid   bool // the peer sent blocks which do not hash correctly
+}
+
+// syncProgress is a range of blocks which was synced and verified against
+// the hash of its highest block
+type syncProgress struct {
+	blockRange
+	highHash []byte
+}
+
+// blamePeer records that a peer sent invalid blocks, it will only be asked
+// again once better peers have failed
+func (sts *StateTransferState) blamePeer(peerID *protos.PeerID, err error) {
+	sts.blameLock.Lock()
+	defer sts.blameLock.Unlock()
+	sts.blame[*peerID]++
+	logger.Warning("%v blaming %v (%d times) : %s", sts.id, peerID, sts.blame[*peerID], err)
+}
+
+func (sts *StateTransferState) peerBlame(peerID *protos.PeerID) int {
+	sts.blameLock.Lock()
+	defer sts.blameLock.Unlock()
+	return sts.blame[*peerID]
+}
+
+// orderPeers returns the peers with the least blamed first. Peers with the
+// same blame are rotated by a random offset, so that load is spread.
+func (sts *StateTransferState) orderPeers(peerIDs []*protos.PeerID) []*protos.PeerID {
+	ordered := make([]*protos.PeerID, len(peerIDs))
+	startIndex := rand.Int() % len(peerIDs)
+	for i := range peerIDs {
+		ordered[i] = peerIDs[(i+startIndex)%len(peerIDs)]
+	}
+
+	sts.blameLock.Lock()
+	defer sts.blameLock.Unlock()
+	sort.Stable(peersByBlame{ordered, sts.blame})
+	return ordered
+}
+
+type peersByBlame struct {
+	peerIDs []*protos.PeerID
+	blame   map[protos.PeerID]int
+}
+
+func (p peersByBlame) Len() int      { return len(p.peerIDs) }
+func (p peersByBlame) Swap(i, j int) { p.peerIDs[i], p.peerIDs[j] = p.peerIDs[j], p.peerIDs[i] }
+func (p peersByBlame) Less(i, j int) bool {
+	return p.blame[*p.peerIDs[i]] < p.blame[*p.peerIDs[j]]
+}
+
+// idlePeer returns the least blamed peer which has not been tried and is
+// not busy. It returns nil rather than a peer which was blamed more than a
+// busy one, so that the caller waits for the better peer instead.
+func (sts *StateTransferState) idlePeer(peerIDs []*protos.PeerID, tried, busy map[protos.PeerID]bool) *protos.PeerID {
+	minBlame := -1
+	for _, candidate := range sts.orderPeers(peerIDs) {
+		if tried[*candidate] {
+			continue
+		}
+		blame := sts.peerBlame(candidate)
+		if -1 != minBlame && blame > minBlame {
+			return nil
+		}
+		minBlame = blame
+		if !busy[*candidate] {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// fetchBlockChunk retrieves a chunk of blocks from a peer, checking as the
+// blocks arrive that each one is the predecessor of the previous one. Only
+// the sync to a target waits while the state transfer is paused.
+func (sts *StateTransferState) fetchBlockChunk(peerID *protos.PeerID, highBlock, lowBlock uint64, toTarget bool) *blockChunk {
+	chunk := &blockChunk{highBlock: highBlock, lowBlock: lowBlock, peerID: peerID}
+
+	if toTarget {
+		if chunk.err = sts.checkControl(); nil != chunk.err {
+			return chunk
+		}
+	}
+
+	blockChan, err := sts.ledger.GetRemoteBlocks(peerID, highBlock, lowBlock)
+	if nil != err {
+		chunk.err = fmt.Errorf("%v failed to get blocks from %d to %d from %v: %s", sts.id, highBlock, lowBlock, peerID, err)
+		return chunk
+	}
+
+	blockCursor := highBlock
+	for {
+		select {
+		case syncBlockMessage, ok := <-blockChan:
+			if !ok {
+				chunk.err = fmt.Errorf("Channel closed before we could finish reading")
+				return chunk
+			}
+
+			if syncBlockMessage.Range.Start < syncBlockMessage.Range.End {
+				// If the message is not replying with blocks backwards, we did not ask for it
+				continue
+			}
+
+			for i, block := range syncBlockMessage.Blocks {
+				// It is possible to get duplication or out of range blocks due to an implementation detail, we must check for them
+				if syncBlockMessage.Range.Start-uint64(i) != blockCursor {
+					continue
+				}
+
+				if 0 < len(chunk.blocks) {
+					testHash, err := sts.ledger.HashBlock(block)
+					if nil != err {
+						chunk.err = fmt.Errorf("%v got a block %d which could not hash from %v: %s", sts.id, blockCursor, peerID, err)
+						chunk.invalid = true
+						return chunk
+					}
+					if next := chunk.blocks[len(chunk.blocks)-1]; !bytes.Equal(testHash, next.PreviousBlockHash) {
+						chunk.err = fmt.Errorf("%v got block %d from %v with hash %x, was expecting hash %x",
+							sts.id, blockCursor, peerID, testHash, next.PreviousBlockHash)
+						chunk.invalid = true
+						return chunk
+					}
+				}
+
+				chunk.blocks = append(chunk.blocks, block)
+				if blockCursor == lowBlock {
+					return chunk
+				}
+				blockCursor--
+			}
+		case <-time.After(sts.BlockRequestTimeout):
+			chunk.err = fmt.Errorf("%v had block sync request to %v time out", sts.id, peerID)
+			return chunk
+		}
+	}
+}
+
+// putBlock stores a block whose hash has been verified
+func (sts *StateTransferState) putBlock(blockNumber uint64, block *protos.Block, blockHash []byte) {
+	logger.Debug("%v putting block %d to with PreviousBlockHash %x and StateHash %x", sts.id, blockNumber, block.PreviousBlockHash, block.StateHash)
+	if !sts.RecoverDamage {
+		// If we are not supposed to be destructive in our recovery, check to make sure this block doesn't already exist
+		if oldBlock, err := sts.ledger.GetBlock(blockNumber); err == nil && oldBlock != nil {
+			oldBlockHash, err := sts.ledger.HashBlock(oldBlock)
+			if nil == err {
+				if !bytes.Equal(oldBlockHash, blockHash) {
+					panic("The blockchain is corrupt and the configuration has specified that bad blocks should not be deleted/overridden")
+				}
+			} else {
+				logger.Error("%v could not compute the hash of block %d", sts.id, blockNumber)
+				panic("The blockchain is corrupt and the configuration has specified that bad blocks should not be deleted/overridden")
+			}
+			logger.Debug("%v not actually putting block %d to with PreviousBlockHash %x and StateHash %x, as it already exists", sts.id, blockNumber, block.PreviousBlockHash, block.StateHash)
+			return
+		}
+	}
+	sts.ledger.PutBlock(blockNumber, block)
+}
+
+// Attempts to complete a blockSyncReq using the supplied peers
+// Will return the last block number attempted to sync, and the last block successfully synced (or nil) and error on failure
+// This means on failure, the returned block corresponds to 1 higher than the returned block number
+//
+// The range is split into chunks of blocksperrequest blocks which are
+// fetched from several peers in parallel. Chunks are verified against the
+// hash chain from highHash downwards, and stored, in order; a chunk which
+// fails is retried with another peer. If toTarget, this is the sync to the
+// target of the state transfer: the progress is persisted so that a
+// restarted peer does not fetch the blocks again, and it is reported and
+// steered by the operator. The background repair of the chain is neither,
+// so as not to replace the progress of the sync to a target, nor be paused
+// or pinned along with it.
+func (sts *StateTransferState) syncBlocks(highBlock, lowBlock uint64, highHash []byte, passedPeerIDs []*protos.PeerID, toTarget bool) (uint64, *protos.Block, error) {
+	logger.Debug("%v syncing blocks from %d to %d", sts.id, highBlock, lowBlock)
+
+	peerIDs := passedPeerIDs
+	if toTarget {
+		peerIDs = sts.sourcePeers(passedPeerIDs)
+	} else if nil == peerIDs {
+		peerIDs = sts.defaultPeerIDs
+	}
+	if 0 == len(peerIDs) {
+		panic("Cannot syncBlocks with no peers specified")
+	}
+
+	validBlockHash := highHash
+	blockCursor := highBlock
+	var block *protos.Block
+	var err error
+
+	// Blocks synced by an earlier, interrupted, attempt need not be fetched again
+	var resume *syncProgress
+	if toTarget {
+		resume = sts.loadProgress(highBlock, lowBlock)
+	}
+	if nil != resume && resume.highBlock == highBlock && resume.lowBlock == lowBlock {
+		if block, err = sts.ledger.GetBlock(lowBlock); nil != err {
+			sts.clearProgress()
+			return blockCursor, nil, fmt.Errorf("%v could not retrieve block %d synced before: %s", sts.id, lowBlock, err)
+		}
+		logger.Debug("%v synced blocks %d to %d before, not fetching them again", sts.id, highBlock, lowBlock)
+		sts.blocksFetched(nil, highBlock-lowBlock+1)
+		return lowBlock, block, nil
+	}
+
+	nextHigh := highBlock // highest block not yet assigned to a chunk
+	moreChunks := true
+	if nil != resume && resume.highBlock == highBlock {
+		nextHigh = resume.lowBlock - 1
+	}
+	nextChunk := func() *blockChunk {
+		if !moreChunks {
+			return nil
+		}
+		chunk := &blockChunk{highBlock: nextHigh, lowBlock: lowBlock}
+		if nextHigh-lowBlock >= sts.blockVerifyChunkSize {
+			chunk.lowBlock = nextHigh - sts.blockVerifyChunkSize + 1
+		}
+		if nil != resume && chunk.lowBlock <= resume.highBlock && resume.highBlock < chunk.highBlock {
+			chunk.lowBlock = resume.highBlock + 1
+		}
+		return chunk
+	}
+	popChunk := func(chunk *blockChunk) {
+		switch {
+		case chunk.lowBlock == lowBlock:
+			moreChunks = false
+		case nil != resume && chunk.lowBlock == resume.highBlock+1:
+			nextHigh = resume.lowBlock - 1
+		default:
+			nextHigh = chunk.lowBlock - 1
+		}
+	}
+
+	// Chunks are only requested a bounded distance ahead of the cursor, so
+	// that a slow peer cannot cause an unbounded number of blocks to be buffered
+	window := 2 * uint64(len(peerIDs)) * sts.blockVerifyChunkSize
+
+	results := make(chan *blockChunk, len(peerIDs))
+	busy := make(map[protos.PeerID]bool)
+	tried := make(map[uint64]map[protos.PeerID]bool) // by chunk highBlock
+	ready := make(map[uint64]*blockChunk)            // by chunk highBlock
+	var retry []*blockChunk
+	inFlight := 0
+
+	assign := func() {
+		for {
+			chunk := nextChunk()
+			fromRetry := 0 < len(retry)
+			if fromRetry {
+				chunk = retry[0]
+			}
+			if nil == chunk || blockCursor-chunk.highBlock >= window {
+				return
+			}
+			if nil == tried[chunk.highBlock] {
+				tried[chunk.highBlock] = make(map[protos.PeerID]bool)
+			}
+			peerID := sts.idlePeer(peerIDs, tried[chunk.highBlock], busy)
+			if nil == peerID {
+				return
+			}
+
+			if fromRetry {
+				retry = retry[1:]
+			} else {
+				popChunk(chunk)
+			}
+			busy[*peerID] = true
+			tried[chunk.highBlock][*peerID] = true
+			inFlight++
+			go func(peerID *protos.PeerID, highBlock, lowBlock uint64) {
+				results <- sts.fetchBlockChunk(peerID, highBlock, lowBlock, toTarget)
+			}(peerID, chunk.highBlock, chunk.lowBlock)
+		}
+	}
+
+	failChunk := func(chunk *blockChunk) {
+		logger.Warning("%v in syncBlocks : %s", sts.id, chunk.err)
+		err = chunk.err
+		if toTarget {
+			sts.peerFailed(chunk.peerID, chunk.err)
+		}
+		if chunk.invalid {
+			sts.blamePeer(chunk.peerID, chunk.err)
+		}
+		retry = append(retry, &blockChunk{highBlock: chunk.highBlock, lowBlock: chunk.lowBlock})
+	}
+
+	for {
+		// Store the chunks which continue the verified chain
+		for {
+			if nil != resume && blockCursor == resume.highBlock {
+				if !bytes.Equal(validBlockHash, resume.highHash) {
+					sts.clearProgress()
+					return blockCursor, block, fmt.Errorf("%v synced block %d does not match the blocks synced before", sts.id, blockCursor+1)
+				}
+				logger.Debug("%v resuming block sync below block %d", sts.id, resume.lowBlock)
+				if block, err = sts.ledger.GetBlock(resume.lowBlock); nil != err {
+					sts.clearProgress()
+					return blockCursor, nil, fmt.Errorf("%v could not retrieve block %d synced before: %s", sts.id, resume.lowBlock, err)
+				}
+				sts.blocksFetched(nil, resume.highBlock-resume.lowBlock+1)
+				blockCursor = resume.lowBlock - 1
+				validBlockHash = resume.lowNextHash
+				resume = nil
+			}
+
+			chunk, ok := ready[blockCursor]
+			if !ok {
+				break
+			}
+			delete(ready, blockCursor)
+
+			for _, b := range chunk.blocks {
+				testHash, hashErr := sts.ledger.HashBlock(b)
+				if nil == hashErr && !bytes.Equal(testHash, validBlockHash) {
+					hashErr = fmt.Errorf("%v got block %d from %v with hash %x, was expecting hash %x",
+						sts.id, blockCursor, chunk.peerID, testHash, validBlockHash)
+				}
+				if nil != hashErr {
+					// Blocks already stored are fine, refetch the rest of the chunk
+					chunk.err = hashErr
+					chunk.invalid = true
+					tried[blockCursor] = tried[chunk.highBlock]
+					chunk.highBlock = blockCursor
+					failChunk(chunk)
+					break
+				}
+
+				sts.putBlock(blockCursor, b, testHash)
+				if toTarget {
+					sts.blocksFetched(chunk.peerID, 1)
+				}
+				block = b
+				validBlockHash = b.PreviousBlockHash
+				if blockCursor == lowBlock {
+					logger.Debug("%v successfully synced from block %d to block %d", sts.id, highBlock, lowBlock)
+					if toTarget {
+						// Kept, so that a later sync to the same block does not fetch the range again
+						sts.saveProgress(&syncProgress{
+							blockRange: blockRange{highBlock: highBlock, lowBlock: lowBlock, lowNextHash: validBlockHash},
+							highHash:   highHash,
+						})
+					}
+					return blockCursor, block, nil
+				}
+				blockCursor--
+			}
+			if toTarget && blockCursor < highBlock {
+				sts.saveProgress(&syncProgress{
+					blockRange: blockRange{highBlock: highBlock, lowBlock: blockCursor + 1, lowNextHash: validBlockHash},
+					highHash:   highHash,
+				})
+			}
+		}
+
+		assign()
+		if 0 == inFlight {
+			// Every peer failed to provide one of the chunks
+			if nil == err {
+				err = fmt.Errorf("%v could not find a peer to sync blocks from", sts.id)
+			}
+			break
+		}
+
+		chunk := <-results
+		inFlight--
+		busy[*chunk.peerID] = false
+		if nil != chunk.err {
+			failChunk(chunk)
+			continue
+		}
+		ready[chunk.highBlock] = chunk
+	}
+
+	if nil != block {
+		logger.Debug("%v returned from sync with block %d and state hash %x", sts.id, blockCursor, block.StateHash)
+	} else {
+		logger.Debug("%v returned from sync with no new blocks", sts.id)
+	}
+
+	return blockCursor, block, err
+}
+
+// =============================================================================
+// progress persistence
+// =============================================================================
+
+func (p *syncProgress) marshal() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, p.highBlock)
+	binary.Write(&buf, binary.BigEndian, p.lowBlock)
+	binary.Write(&buf, binary.BigEndian, uint32(len(p.highHash)))
+	buf.Write(p.highHash)
+	buf.Write(p.lowNextHash)
+	return buf.Bytes()
+}
+
+func unmarshalSyncProgress(raw []byte) (*syncProgress, error) {
+	p := &syncProgress{}
+	buf := bytes.NewReader(raw)
+	var hashLen uint32
+	for _, v := range []interface{}{&p.highBlock, &p.lowBlock, &hashLen} {
+		if err := binary.Read(buf, binary.BigEndian, v); nil != err {
+			return nil, err
+		}
+	}
+	if int(hashLen) > buf.Len() {
+		return nil, fmt.Errorf("Truncated progress marker")
+	}
+	p.highHash = make([]byte, hashLen)
+	buf.Read(p.highHash)
+	p.lowNextHash = make([]byte, buf.Len())
+	buf.Read(p.lowNextHash)
+	return p, nil
+}
+
+func (sts *StateTransferState) saveProgress(p *syncProgress) {
+	persistor, ok := sts.ledger.(consensus.StatePersistor)
+	if !ok {
+		return
+	}
+	if err := persistor.StoreState(progressKey, p.marshal()); nil != err {
+		logger.Warning("%v could not persist block sync progress : %s", sts.id, err)
+	}
+}
+
+func (sts *StateTransferState) clearProgress() {
+	if persistor, ok := sts.ledger.(consensus.StatePersistor); ok {
+		persistor.DelState(progressKey)
+	}
+}
+
+// loadProgress returns the blocks synced by an earlier attempt, if they
+// are part of the range from highBlock to lowBlock and still in the ledger
+func (sts *StateTransferState) loadProgress(highBlock, lowBlock uint64) *syncProgress {
+	persistor, ok := sts.ledger.(consensus.StatePersistor)
+	if !ok {
+		return nil
+	}
+	raw, err := persistor.ReadState(progressKey)
+	if nil != err || 0 == len(raw) {
+		return nil
+	}
+	p, err := unmarshalSyncProgress(raw)
+	if nil != err {
+		logger.Warning("%v discarding corrupt block sync progress : %s", sts.id, err)
+		sts.clearProgress()
+		return nil
+	}
+	if p.highBlock > highBlock || p.lowBlock > p.highBlock {
+		return nil
+	}
+	if p.lowBlock <= lowBlock {
+		if p.highBlock != highBlock {
+			return nil
+		}
+		// The whole range was synced before, only its lower end is of interest
+		p.lowBlock = lowBlock
+		if bottom, err := sts.ledger.GetBlock(lowBlock); nil == err && nil != bottom {
+			p.lowNextHash = bottom.PreviousBlockHash
+		}
+	}
+
+	// Check the ends of the range, the block thread verifies the rest of the chain
+	top, err := sts.ledger.GetBlock(p.highBlock)
+	if nil != err || nil == top {
+		return nil
+	}
+	if topHash, err := sts.ledger.HashBlock(top); nil != err || !bytes.Equal(topHash, p.highHash) {
+		return nil
+	}
+	bottom, err := sts.ledger.GetBlock(p.lowBlock)
+	if nil != err || nil == bottom || !bytes.Equal(bottom.PreviousBlockHash, p.lowNextHash) {
+		return nil
+	}
+
+	logger.Info("%v found blocks %d to %d synced before", sts.id, p.highBlock, p.lowBlock)
+	return p
+}
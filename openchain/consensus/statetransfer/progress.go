@@ -0,0 +1,337 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package statetransfer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	gp "google/protobuf"
+
+	"github.com/hyperledger-incubator/obc-peer/events/producer"
+	"github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// =============================================================================
+// progress reporting and control
+// =============================================================================
+
+// ProgressListener may be implemented by a Listener which also wishes to be
+// told how a state transfer progresses
+type ProgressListener interface {
+	Progressed(*protos.StateTransferStatus)
+}
+
+// progressInterval limits how often progress within a phase is reported
+const progressInterval = time.Second
+
+// transferProgress is what is known about the current state transfer
+type transferProgress struct {
+	phase         protos.StateTransferStatus_Phase
+	started       time.Time
+	targetBlock   uint64
+	blocksFetched uint64
+	blocksToFetch uint64
+	chunksApplied uint64
+	chunks        uint64
+	deltasApplied uint64
+	deltasToApply uint64
+	stateBytes    uint64
+	sourcePeer    *protos.PeerID
+	peerErrors    map[protos.PeerID]*protos.StateTransferPeerErrors
+	lastReport    time.Time
+}
+
+// transferControl is how operators steer the state transfer
+type transferControl struct {
+	lock          sync.Mutex
+	resumed       *sync.Cond // Signalled when the transfer is resumed, cancelled or stopped
+	paused        bool
+	cancelled     bool
+	stopped       bool
+	pinnedPeerIDs []*protos.PeerID
+	progress      transferProgress
+}
+
+func newTransferControl() *transferControl {
+	control := &transferControl{}
+	control.resumed = sync.NewCond(&control.lock)
+	control.progress.peerErrors = make(map[protos.PeerID]*protos.StateTransferPeerErrors)
+	return control
+}
+
+// GetStateTransferStatus reports the progress of the current state transfer
+func (sts *StateTransferState) GetStateTransferStatus() *protos.StateTransferStatus {
+	sts.control.lock.Lock()
+	defer sts.control.lock.Unlock()
+	return sts.statusLocked()
+}
+
+// PauseStateTransfer stops state transfer from making further requests until resumed,
+// requests already made are still processed
+func (sts *StateTransferState) PauseStateTransfer() {
+	sts.updateControl(func(control *transferControl) error {
+		control.paused = true
+		return nil
+	})
+	logger.Info("%v paused state transfer", sts.id)
+}
+
+// ResumeStateTransfer lets a paused state transfer continue
+func (sts *StateTransferState) ResumeStateTransfer() {
+	sts.updateControl(func(control *transferControl) error {
+		control.paused = false
+		return nil
+	})
+	logger.Info("%v resumed state transfer", sts.id)
+}
+
+// CancelStateTransfer gives up on the target of the current state transfer, the
+// transfer continues once consensus supplies a new target
+func (sts *StateTransferState) CancelStateTransfer() error {
+	err := sts.updateControl(func(control *transferControl) error {
+		if protos.StateTransferStatus_IDLE == control.progress.phase {
+			return fmt.Errorf("No state transfer in progress")
+		}
+		control.cancelled = true
+		return nil
+	})
+	if nil == err {
+		logger.Info("%v cancelled state transfer", sts.id)
+	}
+	return err
+}
+
+// PinStateTransferPeers restricts state transfer to the given peers, or lets it
+// use any peer again if peerIDs is empty
+func (sts *StateTransferState) PinStateTransferPeers(peerIDs []*protos.PeerID) {
+	sts.updateControl(func(control *transferControl) error {
+		if 0 == len(peerIDs) {
+			control.pinnedPeerIDs = nil
+		} else {
+			control.pinnedPeerIDs = peerIDs
+		}
+		return nil
+	})
+	logger.Info("%v pinned state transfer to peers %v", sts.id, peerIDs)
+}
+
+func (sts *StateTransferState) updateControl(update func(control *transferControl) error) error {
+	sts.control.lock.Lock()
+	if err := update(sts.control); nil != err {
+		sts.control.lock.Unlock()
+		return err
+	}
+	sts.control.resumed.Broadcast()
+	status := sts.statusLocked()
+	sts.control.lock.Unlock()
+
+	sts.informProgress(status)
+	return nil
+}
+
+// checkControl blocks while state transfer is paused, and returns an error
+// if it was cancelled or stopped, so that no further requests are made
+func (sts *StateTransferState) checkControl() error {
+	sts.control.lock.Lock()
+	defer sts.control.lock.Unlock()
+	for sts.control.paused && !sts.control.cancelled && !sts.control.stopped {
+		sts.control.resumed.Wait()
+	}
+	if sts.control.stopped {
+		return fmt.Errorf("%v state transfer was stopped", sts.id)
+	}
+	if sts.control.cancelled {
+		return fmt.Errorf("%v state transfer was cancelled", sts.id)
+	}
+	return nil
+}
+
+// stopControl wakes up the threads waiting while state transfer is paused,
+// and stops them from making further requests
+func (sts *StateTransferState) stopControl() {
+	sts.control.lock.Lock()
+	defer sts.control.lock.Unlock()
+	sts.control.stopped = true
+	sts.control.resumed.Broadcast()
+}
+
+// takeCancel reports whether the current state transfer was cancelled, and
+// resets it to wait for a new target if so
+func (sts *StateTransferState) takeCancel() bool {
+	sts.control.lock.Lock()
+	defer sts.control.lock.Unlock()
+	if !sts.control.cancelled {
+		return false
+	}
+	sts.control.cancelled = false
+	sts.control.progress.phase = protos.StateTransferStatus_WAITING_FOR_TARGET
+	sts.control.progress.targetBlock = 0
+	return true
+}
+
+// sourcePeers returns the peers to request blocks and state from, pinned
+// peers take precedence over the peers passed, which default to all peers
+func (sts *StateTransferState) sourcePeers(passedPeerIDs []*protos.PeerID) []*protos.PeerID {
+	sts.control.lock.Lock()
+	defer sts.control.lock.Unlock()
+	if nil != sts.control.pinnedPeerIDs {
+		return sts.control.pinnedPeerIDs
+	}
+	if nil == passedPeerIDs {
+		return sts.defaultPeerIDs
+	}
+	return passedPeerIDs
+}
+
+// updateProgress records progress of the state transfer, which is reported
+// to listeners and the event hub on phase changes, and otherwise at most
+// every progressInterval
+func (sts *StateTransferState) updateProgress(update func(progress *transferProgress)) {
+	sts.control.lock.Lock()
+	progress := &sts.control.progress
+	phase := progress.phase
+	update(progress)
+	if phase == progress.phase && time.Since(progress.lastReport) < progressInterval {
+		sts.control.lock.Unlock()
+		return
+	}
+	progress.lastReport = time.Now()
+	status := sts.statusLocked()
+	sts.control.lock.Unlock()
+
+	sts.informProgress(status)
+}
+
+// startProgress resets the progress for a new state transfer
+func (sts *StateTransferState) startProgress() {
+	sts.updateProgress(func(progress *transferProgress) {
+		*progress = transferProgress{
+			phase:      protos.StateTransferStatus_WAITING_FOR_TARGET,
+			started:    time.Now(),
+			peerErrors: make(map[protos.PeerID]*protos.StateTransferPeerErrors),
+		}
+	})
+}
+
+// finishProgress records that the state transfer completed
+func (sts *StateTransferState) finishProgress() {
+	sts.updateProgress(func(progress *transferProgress) {
+		progress.phase = protos.StateTransferStatus_IDLE
+	})
+	sts.control.lock.Lock()
+	sts.control.cancelled = false // Too late to cancel
+	sts.control.lock.Unlock()
+}
+
+// fetchedFrom records that a peer supplied part of the state transfer
+func (sts *StateTransferState) fetchedFrom(peerID *protos.PeerID, update func(progress *transferProgress)) {
+	sts.updateProgress(func(progress *transferProgress) {
+		progress.sourcePeer = peerID
+		update(progress)
+	})
+}
+
+// blocksFetched records blocks stored while syncing blocks to the target of
+// the state transfer
+func (sts *StateTransferState) blocksFetched(peerID *protos.PeerID, blocks uint64) {
+	sts.updateProgress(func(progress *transferProgress) {
+		if protos.StateTransferStatus_SYNCING_BLOCKS != progress.phase {
+			return
+		}
+		progress.blocksFetched += blocks
+		if nil != peerID {
+			progress.sourcePeer = peerID
+		}
+	})
+}
+
+// peerFailed records an error encountered requesting from a peer, unless it
+// was caused by cancelling or stopping the state transfer
+func (sts *StateTransferState) peerFailed(peerID *protos.PeerID, err error) {
+	sts.control.lock.Lock()
+	defer sts.control.lock.Unlock()
+	if sts.control.cancelled || sts.control.stopped {
+		return
+	}
+	peerErrors, ok := sts.control.progress.peerErrors[*peerID]
+	if !ok {
+		peerErrors = &protos.StateTransferPeerErrors{Peer: peerID}
+		sts.control.progress.peerErrors[*peerID] = peerErrors
+	}
+	peerErrors.Errors++
+	peerErrors.LastError = err.Error()
+}
+
+func (sts *StateTransferState) statusLocked() *protos.StateTransferStatus {
+	progress := &sts.control.progress
+	status := &protos.StateTransferStatus{
+		Phase:              progress.phase,
+		Paused:             sts.control.paused,
+		TargetBlock:        progress.targetBlock,
+		BlocksFetched:      progress.blocksFetched,
+		BlocksToFetch:      progress.blocksToFetch,
+		StateChunksApplied: progress.chunksApplied,
+		StateChunks:        progress.chunks,
+		DeltasApplied:      progress.deltasApplied,
+		DeltasToApply:      progress.deltasToApply,
+		StateBytesApplied:  progress.stateBytes,
+		SourcePeer:         progress.sourcePeer,
+		PinnedPeers:        sts.control.pinnedPeerIDs,
+	}
+	for _, peerErrors := range progress.peerErrors {
+		status.PeerErrors = append(status.PeerErrors, peerErrors)
+	}
+	sort.Sort(peerErrorsByName(status.PeerErrors))
+	if protos.StateTransferStatus_IDLE == progress.phase {
+		return status
+	}
+
+	status.Started = &gp.Timestamp{Seconds: progress.started.Unix(), Nanos: int32(progress.started.Nanosecond())}
+	done := progress.blocksFetched + progress.chunksApplied + progress.deltasApplied
+	total := progress.blocksToFetch + progress.chunks + progress.deltasToApply
+	if 0 < done && done < total {
+		elapsed := time.Since(progress.started)
+		status.EstimatedRemainingNanos = uint64(float64(elapsed) * float64(total-done) / float64(done))
+	}
+	return status
+}
+
+func (sts *StateTransferState) informProgress(status *protos.StateTransferStatus) {
+	sts.stateTransferListenersLock.Lock()
+	for _, listener := range sts.stateTransferListeners {
+		if progressListener, ok := listener.(ProgressListener); ok {
+			progressListener.Progressed(status)
+		}
+	}
+	sts.stateTransferListenersLock.Unlock()
+
+	if err := producer.Send(producer.CreateStateTransferEvent(status)); nil != err {
+		logger.Warning("%v could not send state transfer event : %s", sts.id, err)
+	}
+}
+
+type peerErrorsByName []*protos.StateTransferPeerErrors
+
+func (p peerErrorsByName) Len() int           { return len(p) }
+func (p peerErrorsByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p peerErrorsByName) Less(i, j int) bool { return p[i].Peer.Name < p[j].Peer.Name }
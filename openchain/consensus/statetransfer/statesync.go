@@ -0,0 +1,386 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package statetransfer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/consensus"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	"github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// =============================================================================
+// chunked state synchronization
+// =============================================================================
+
+// stateProgressKey is where the chunks of the state applied so far are
+// persisted, so that a restarted peer does not fetch them again
+const stateProgressKey = "statetransfer.state"
+
+// stateTarget is the state being synced, as pinned by the first chunk received
+type stateTarget struct {
+	blockNumber uint64
+	stateHash   []byte
+	numChunks   uint64
+}
+
+// stateSyncProgress records which chunks of the target state have been applied
+type stateSyncProgress struct {
+	stateTarget
+	done []bool
+}
+
+// stateChunkResult is the outcome of requesting a chunk of the state from a peer
+type stateChunkResult struct {
+	chunk    uint64
+	peerID   *protos.PeerID
+	response *protos.SyncStateChunk
+	delta    *statemgmt.StateDelta
+	err      error
+	invalid  bool // the peer sent a chunk which does not verify
+	moved    bool // the peer no longer has the target state
+}
+
+// fetchStateChunk retrieves a chunk of the target state from a peer and
+// verifies it. If target is nil, the peer may reply with any state, and the
+// chunk is verified against the state hash it advertises.
+func (sts *StateTransferState) fetchStateChunk(chunker consensus.StateChunker, peerID *protos.PeerID, chunk uint64, target *stateTarget) *stateChunkResult {
+	result := &stateChunkResult{chunk: chunk, peerID: peerID}
+
+	if result.err = sts.checkControl(); nil != result.err {
+		return result
+	}
+
+	var stateHash []byte
+	if nil != target {
+		stateHash = target.stateHash
+	}
+
+	chunkChan, err := chunker.GetRemoteStateChunk(peerID, chunk, stateHash)
+	if nil != err {
+		result.err = fmt.Errorf("%v failed to request state chunk %d from %v: %s", sts.id, chunk, peerID, err)
+		return result
+	}
+
+	select {
+	case response, ok := <-chunkChan:
+		if !ok || nil == response {
+			result.err = fmt.Errorf("%v had state chunk channel close before receiving chunk %d from %v", sts.id, chunk, peerID)
+			return result
+		}
+		result.response = response
+	case <-time.After(sts.StateChunkRequestTimeout):
+		result.err = fmt.Errorf("%v timed out waiting for state chunk %d from %v", sts.id, chunk, peerID)
+		return result
+	}
+
+	response := result.response
+	if nil == target {
+		target = &stateTarget{blockNumber: response.BlockNumber, stateHash: response.StateHash, numChunks: response.NumChunks}
+	}
+
+	if !bytes.Equal(response.StateHash, target.stateHash) || 0 == len(response.Delta) {
+		result.moved = true
+		result.err = fmt.Errorf("%v asked %v for state chunk %d of block %d, but it has the state of block %d", sts.id, peerID, chunk, target.blockNumber, response.BlockNumber)
+		return result
+	}
+
+	if response.NumChunks != target.numChunks || chunk >= target.numChunks || nil == response.Request || response.Request.Chunk != chunk {
+		result.invalid = true
+		result.err = fmt.Errorf("%v asked %v for state chunk %d of %d, but received a different chunk", sts.id, peerID, chunk, target.numChunks)
+		return result
+	}
+
+	if result.delta, err = chunker.VerifyStateChunk(response, target.stateHash); nil != err {
+		result.invalid = true
+		result.err = fmt.Errorf("%v received state chunk %d from %v which does not verify against state hash %x: %s", sts.id, chunk, peerID, target.stateHash, err)
+	}
+
+	return result
+}
+
+// applyStateChunk applies and commits a verified chunk to the current state
+func (sts *StateTransferState) applyStateChunk(result *stateChunkResult) error {
+	if result.delta.IsEmpty() {
+		return nil
+	}
+	if err := sts.ledger.ApplyStateDelta(result, result.delta); nil != err {
+		return fmt.Errorf("%v could not apply state chunk %d from %v: %s", sts.id, result.chunk, result.peerID, err)
+	}
+	if err := sts.ledger.CommitStateDelta(result); nil != err {
+		return fmt.Errorf("%v could not commit state chunk %d from %v: %s", sts.id, result.chunk, result.peerID, err)
+	}
+	return nil
+}
+
+// stateChunkApplied records progress for a chunk applied to the state
+func (sts *StateTransferState) stateChunkApplied(result *stateChunkResult, numChunks uint64) {
+	sts.fetchedFrom(result.peerID, func(progress *transferProgress) {
+		progress.chunks = numChunks
+		progress.chunksApplied++
+		progress.stateBytes += uint64(len(result.response.Delta))
+	})
+}
+
+// startStateChunks returns the progress of an interrupted chunked state
+// sync, or else pins the state of the first peer which returns a valid chunk
+// as the target, and only then empties the current state
+func (sts *StateTransferState) startStateChunks(chunker consensus.StateChunker, peerIDs []*protos.PeerID) (*stateSyncProgress, error) {
+	if progress := sts.loadStateProgress(); nil != progress {
+		logger.Info("%v resuming state sync to block %d with %d of %d chunks to go", sts.id, progress.blockNumber, progress.pending(), progress.numChunks)
+		sts.updateProgress(func(p *transferProgress) {
+			p.chunks = progress.numChunks
+			p.chunksApplied = progress.numChunks - uint64(progress.pending())
+		})
+		return progress, nil
+	}
+
+	var first *stateChunkResult
+	err := sts.tryOverPeers(peerIDs, func(peerID *protos.PeerID) error {
+		first = sts.fetchStateChunk(chunker, peerID, 0, nil)
+		if first.invalid {
+			sts.blamePeer(peerID, first.err)
+		}
+		return first.err
+	})
+	if nil != err {
+		return nil, err
+	}
+
+	response := first.response
+	progress := &stateSyncProgress{
+		stateTarget: stateTarget{blockNumber: response.BlockNumber, stateHash: response.StateHash, numChunks: response.NumChunks},
+		done:        make([]bool, response.NumChunks),
+	}
+	logger.Debug("%v syncing the state of block %d with hash %x in %d chunks", sts.id, progress.blockNumber, progress.stateHash, progress.numChunks)
+
+	if err := sts.ledger.EmptyState(); nil != err {
+		logger.Error("Could not empty the current state: %s", err)
+	}
+	if err := sts.applyStateChunk(first); nil != err {
+		return nil, err
+	}
+	sts.stateChunkApplied(first, progress.numChunks)
+	progress.done[0] = true
+	sts.saveStateProgress(progress)
+	return progress, nil
+}
+
+// syncStateChunks fetches the chunks of the target state which have not been
+// applied yet from several peers in parallel. Each chunk is verified against
+// the target state hash before it is applied, a chunk which does not verify is
+// blamed on its peer and fetched again from another one. On failure, the
+// progress is kept so that the next attempt only fetches the missing chunks,
+// unless the peers have moved on from the target state.
+func (sts *StateTransferState) syncStateChunks(chunker consensus.StateChunker, progress *stateSyncProgress, passedPeerIDs []*protos.PeerID) (uint64, error) {
+	peerIDs := sts.sourcePeers(passedPeerIDs)
+	if 0 == len(peerIDs) {
+		panic("Cannot syncStateChunks with no peers specified")
+	}
+
+	target := &progress.stateTarget
+	var pending []uint64
+	tried := make(map[uint64]map[protos.PeerID]bool)
+	for chunk, done := range progress.done {
+		if !done {
+			pending = append(pending, uint64(chunk))
+			tried[uint64(chunk)] = make(map[protos.PeerID]bool)
+		}
+	}
+
+	results := make(chan *stateChunkResult, len(peerIDs))
+	busy := make(map[protos.PeerID]bool)
+	moved := false
+	inFlight := 0
+	var err error
+
+	assign := func() {
+		for 0 < len(pending) {
+			chunk := pending[0]
+			peerID := sts.idlePeer(peerIDs, tried[chunk], busy)
+			if nil == peerID {
+				return
+			}
+			pending = pending[1:]
+			busy[*peerID] = true
+			tried[chunk][*peerID] = true
+			inFlight++
+			go func(peerID *protos.PeerID, chunk uint64) {
+				results <- sts.fetchStateChunk(chunker, peerID, chunk, target)
+			}(peerID, chunk)
+		}
+	}
+
+	for {
+		assign()
+		if 0 == inFlight {
+			break
+		}
+
+		result := <-results
+		inFlight--
+		busy[*result.peerID] = false
+		if nil != result.err {
+			logger.Warning("%v in syncStateChunks : %s", sts.id, result.err)
+			err = result.err
+			sts.peerFailed(result.peerID, result.err)
+			if result.invalid {
+				sts.blamePeer(result.peerID, result.err)
+			}
+			if result.moved {
+				// The peer cannot serve any other chunk of the target either
+				moved = true
+				for _, peers := range tried {
+					peers[*result.peerID] = true
+				}
+			}
+			pending = append(pending, result.chunk)
+			continue
+		}
+
+		if err := sts.applyStateChunk(result); nil != err {
+			sts.clearStateProgress()
+			return 0, err
+		}
+		sts.stateChunkApplied(result, target.numChunks)
+		progress.done[result.chunk] = true
+		delete(tried, result.chunk)
+		sts.saveStateProgress(progress)
+	}
+
+	if 0 < len(pending) {
+		// Every peer failed to provide one of the chunks
+		if moved {
+			sts.clearStateProgress()
+		}
+		if nil == err {
+			err = fmt.Errorf("%v could not find a peer to sync state chunks from", sts.id)
+		}
+		return 0, err
+	}
+
+	sts.clearStateProgress()
+
+	stateHash, err := sts.ledger.GetCurrentStateHash()
+	if nil != err {
+		return 0, fmt.Errorf("%v could not compute its current state hash: %s", sts.id, err)
+	}
+	if !bytes.Equal(stateHash, target.stateHash) {
+		return 0, fmt.Errorf("%v has state hash %x after applying all chunks, but the target state hash is %x", sts.id, stateHash, target.stateHash)
+	}
+
+	logger.Debug("%v synced the state of block %d in %d chunks", sts.id, target.blockNumber, target.numChunks)
+	return target.blockNumber, nil
+}
+
+// =============================================================================
+// state progress persistence
+// =============================================================================
+
+func (p *stateSyncProgress) pending() int {
+	count := 0
+	for _, done := range p.done {
+		if !done {
+			count++
+		}
+	}
+	return count
+}
+
+func (p *stateSyncProgress) marshal() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, p.blockNumber)
+	binary.Write(&buf, binary.BigEndian, p.numChunks)
+	binary.Write(&buf, binary.BigEndian, uint32(len(p.stateHash)))
+	buf.Write(p.stateHash)
+	bitmap := make([]byte, (len(p.done)+7)/8)
+	for i, done := range p.done {
+		if done {
+			bitmap[i/8] |= 1 << uint(i%8)
+		}
+	}
+	buf.Write(bitmap)
+	return buf.Bytes()
+}
+
+func unmarshalStateSyncProgress(raw []byte) (*stateSyncProgress, error) {
+	p := &stateSyncProgress{}
+	buf := bytes.NewReader(raw)
+	var hashLen uint32
+	for _, v := range []interface{}{&p.blockNumber, &p.numChunks, &hashLen} {
+		if err := binary.Read(buf, binary.BigEndian, v); nil != err {
+			return nil, err
+		}
+	}
+	if int(hashLen) > buf.Len() {
+		return nil, fmt.Errorf("Truncated state progress marker")
+	}
+	p.stateHash = make([]byte, hashLen)
+	buf.Read(p.stateHash)
+	if uint64(buf.Len()) != (p.numChunks+7)/8 {
+		return nil, fmt.Errorf("State progress marker has %d bytes of chunks, expected %d", buf.Len(), (p.numChunks+7)/8)
+	}
+	bitmap := make([]byte, buf.Len())
+	buf.Read(bitmap)
+	p.done = make([]bool, p.numChunks)
+	for i := range p.done {
+		p.done[i] = 0 != bitmap[i/8]&(1<<uint(i%8))
+	}
+	return p, nil
+}
+
+func (sts *StateTransferState) saveStateProgress(p *stateSyncProgress) {
+	persistor, ok := sts.ledger.(consensus.StatePersistor)
+	if !ok {
+		return
+	}
+	if err := persistor.StoreState(stateProgressKey, p.marshal()); nil != err {
+		logger.Warning("%v could not persist state sync progress : %s", sts.id, err)
+	}
+}
+
+func (sts *StateTransferState) clearStateProgress() {
+	if persistor, ok := sts.ledger.(consensus.StatePersistor); ok {
+		persistor.DelState(stateProgressKey)
+	}
+}
+
+// loadStateProgress returns the chunks applied by an earlier attempt, if any
+func (sts *StateTransferState) loadStateProgress() *stateSyncProgress {
+	persistor, ok := sts.ledger.(consensus.StatePersistor)
+	if !ok {
+		return nil
+	}
+	raw, err := persistor.ReadState(stateProgressKey)
+	if nil != err || 0 == len(raw) {
+		return nil
+	}
+	p, err := unmarshalStateSyncProgress(raw)
+	if nil != err {
+		logger.Warning("%v discarding corrupt state sync progress : %s", sts.id, err)
+		sts.clearStateProgress()
+		return nil
+	}
+	return p
+}
@@ -22,7 +22,6 @@ package statetransfer
 import (
 	"bytes"
 	"fmt"
-	"math/rand"
 	"sort"
 	"sync"
 	"time"
@@ -57,9 +56,10 @@ type Listener interface {
 // This provides a simple base implementation of a state transfer listener which implementors can extend anonymously
 // Unset fields result in no action for that event
 type ProtoListener struct {
-	InitiatedImpl func()
-	ErroredImpl   func(uint64, []byte, []*protos.PeerID, interface{}, error)
-	CompletedImpl func(uint64, []byte, []*protos.PeerID, interface{})
+	InitiatedImpl  func()
+	ErroredImpl    func(uint64, []byte, []*protos.PeerID, interface{}, error)
+	CompletedImpl  func(uint64, []byte, []*protos.PeerID, interface{})
+	ProgressedImpl func(*protos.StateTransferStatus)
 }
 
 func (pstl *ProtoListener) Initiated() {
@@ -80,6 +80,12 @@ func (pstl *ProtoListener) Completed(bn uint64, bh []byte, pids []*protos.PeerID
 	}
 }
 
+func (pstl *ProtoListener) Progressed(status *protos.StateTransferStatus) {
+	if nil != pstl.ProgressedImpl {
+		pstl.ProgressedImpl(status)
+	}
+}
+
 type StateTransferState struct {
 	ledger consensus.LedgerStack
 
@@ -105,9 +111,15 @@ type StateTransferState struct {
 	BlockRequestTimeout         time.Duration // How long to wait for a peer to respond to a block request
 	StateDeltaRequestTimeout    time.Duration // How long to wait for a peer to respond to a state delta request
 	StateSnapshotRequestTimeout time.Duration // How long to wait for a peer to respond to a state snapshot request
+	StateChunkRequestTimeout    time.Duration // How long to wait for a peer to respond to a state chunk request
 
 	stateTransferListeners     []Listener  // A list of listeners to call when state transfer is initiated/errored/completed
 	stateTransferListenersLock *sync.Mutex // Used to lock the above list when adding a listener
+
+	blame     map[protos.PeerID]int // How often each peer sent invalid blocks, blamed peers are tried last
+	blameLock sync.Mutex            // Used to lock the above map, which both the block and state threads use
+
+	control *transferControl // Progress of the current transfer, and how operators steer it
 }
 
 // Adds a target and blocks until that target's success or failure
@@ -257,6 +269,7 @@ func (sts *StateTransferState) InvalidateState() {
 // It will never block, and if called before threads start, they will exit at startup
 // Attempting to start threads after this call may fail once
 func (sts *StateTransferState) Stop() {
+	sts.stopControl()
 outer:
 	for {
 		select {
@@ -290,6 +303,8 @@ func ThreadlessNewStateTransferState(id *protos.PeerID, config *viper.Viper, led
 	sts.stateValid = true // Assume our starting state is correct unless told otherwise
 
 	sts.validBlockRanges = make([]*blockRange, 0)
+	sts.blame = make(map[protos.PeerID]int)
+	sts.control = newTransferControl()
 	sts.blockVerifyChunkSize = uint64(config.GetInt("statetransfer.blocksperrequest"))
 	if sts.blockVerifyChunkSize == 0 {
 		panic(fmt.Errorf("Must set statetransfer.blocksperrequest to be nonzero"))
@@ -316,6 +331,10 @@ func ThreadlessNewStateTransferState(id *protos.PeerID, config *viper.Viper, led
 	if err != nil {
 		panic(fmt.Errorf("Cannot parse statetransfer.timeout.fullstate timeout: %s", err))
 	}
+	sts.StateChunkRequestTimeout, err = time.ParseDuration(config.GetString("statetransfer.timeout.singlestatechunk"))
+	if err != nil {
+		panic(fmt.Errorf("Cannot parse statetransfer.timeout.singlestatechunk timeout: %s", err))
+	}
 
 	return sts
 }
@@ -385,16 +404,11 @@ func (a blockRangeSlice) Less(i, j int) bool {
 // helper functions for state transfer
 // =============================================================================
 
-// Executes a func trying each peer included in peerIDs until successful
+// Executes a func trying each peer included in peerIDs until successful, least blamed peers first
 // Attempts to execute over all peers if peerIDs is nil
 func (sts *StateTransferState) tryOverPeers(passedPeerIDs []*protos.PeerID, do func(peerID *protos.PeerID) error) (err error) {
 
-	peerIDs := passedPeerIDs
-
-	if nil == passedPeerIDs {
-		logger.Debug("tryOverPeers, no peerIDs given, using default")
-		peerIDs = sts.defaultPeerIDs
-	}
+	peerIDs := sts.sourcePeers(passedPeerIDs)
 
 	logger.Debug("%v in tryOverPeers, using peerIDs: %v", sts.id, peerIDs)
 
@@ -402,16 +416,16 @@ func (sts *StateTransferState) tryOverPeers(passedPeerIDs []*protos.PeerID, do f
 		panic("Cannot tryOverPeers with no peers specified")
 	}
 
-	numReplicas := len(peerIDs)
-	startIndex := rand.Int() % numReplicas
-
-	for i := 0; i < numReplicas; i++ {
-		index := (i + startIndex) % numReplicas
-		err = do(peerIDs[index])
+	for _, peerID := range sts.orderPeers(peerIDs) {
+		if err = sts.checkControl(); nil != err {
+			break
+		}
+		err = do(peerID)
 		if err == nil {
 			break
 		} else {
-			logger.Warning("%v in tryOverPeers loop trying %v : %s", sts.id, peerIDs[index], err)
+			logger.Warning("%v in tryOverPeers loop trying %v : %s", sts.id, peerID, err)
+			sts.peerFailed(peerID, err)
 		}
 	}
 
@@ -419,100 +433,6 @@ func (sts *StateTransferState) tryOverPeers(passedPeerIDs []*protos.PeerID, do f
 
 }
 
-// Attempts to complete a blockSyncReq using the supplied peers
-// Will return the last block number attempted to sync, and the last block successfully synced (or nil) and error on failure
-// This means on failure, the returned block corresponds to 1 higher than the returned block number
-func (sts *StateTransferState) syncBlocks(highBlock, lowBlock uint64, highHash []byte, peerIDs []*protos.PeerID) (uint64, *protos.Block, error) {
-	logger.Debug("%v syncing blocks from %d to %d", sts.id, highBlock, lowBlock)
-	validBlockHash := highHash
-	blockCursor := highBlock
-	var block *protos.Block
-
-	err := sts.tryOverPeers(peerIDs, func(peerID *protos.PeerID) error {
-		blockChan, err := sts.ledger.GetRemoteBlocks(peerID, blockCursor, lowBlock)
-		if nil != err {
-			logger.Warning("%v failed to get blocks from %d to %d from %v: %s",
-				sts.id, blockCursor, lowBlock, peerID, err)
-			return err
-		}
-		for {
-			select {
-			case syncBlockMessage, ok := <-blockChan:
-
-				if !ok {
-					return fmt.Errorf("Channel closed before we could finish reading")
-				}
-
-				if syncBlockMessage.Range.Start < syncBlockMessage.Range.End {
-					// If the message is not replying with blocks backwards, we did not ask for it
-					continue
-				}
-
-				var i int
-				for i, block = range syncBlockMessage.Blocks {
-					// It is possible to get duplication or out of range blocks due to an implementation detail, we must check for them
-					if syncBlockMessage.Range.Start-uint64(i) != blockCursor {
-						continue
-					}
-
-					testHash, err := sts.ledger.HashBlock(block)
-					if nil != err {
-						return fmt.Errorf("%v got a block %d which could not hash from %v: %s",
-							sts.id, blockCursor, peerID, err)
-					}
-
-					if !bytes.Equal(testHash, validBlockHash) {
-						return fmt.Errorf("%v got block %d from %v with hash %x, was expecting hash %x",
-							sts.id, blockCursor, peerID, testHash, validBlockHash)
-					}
-
-					logger.Debug("%v putting block %d to with PreviousBlockHash %x and StateHash %x", sts.id, blockCursor, block.PreviousBlockHash, block.StateHash)
-					if !sts.RecoverDamage {
-
-						// If we are not supposed to be destructive in our recovery, check to make sure this block doesn't already exist
-						if oldBlock, err := sts.ledger.GetBlock(blockCursor); err == nil && oldBlock != nil {
-							oldBlockHash, err := sts.ledger.HashBlock(oldBlock)
-							if nil == err {
-								if !bytes.Equal(oldBlockHash, validBlockHash) {
-									panic("The blockchain is corrupt and the configuration has specified that bad blocks should not be deleted/overridden")
-								}
-							} else {
-								logger.Error("%v could not compute the hash of block %d", sts.id, blockCursor)
-								panic("The blockchain is corrupt and the configuration has specified that bad blocks should not be deleted/overridden")
-							}
-							logger.Debug("%v not actually putting block %d to with PreviousBlockHash %x and StateHash %x, as it already exists", sts.id, blockCursor, block.PreviousBlockHash, block.StateHash)
-						} else {
-							sts.ledger.PutBlock(blockCursor, block)
-						}
-					} else {
-						sts.ledger.PutBlock(blockCursor, block)
-					}
-
-					validBlockHash = block.PreviousBlockHash
-
-					if blockCursor == lowBlock {
-						logger.Debug("%v successfully synced from block %d to block %d", sts.id, highBlock, lowBlock)
-						return nil
-					}
-					blockCursor--
-
-				}
-			case <-time.After(sts.BlockRequestTimeout):
-				return fmt.Errorf("%v had block sync request to %v time out", sts.id, peerID)
-			}
-		}
-	})
-
-	if nil != block {
-		logger.Debug("%v returned from sync with block %d and state hash %x", sts.id, blockCursor, block.StateHash)
-	} else {
-		logger.Debug("%v returned from sync with no new blocks", sts.id)
-	}
-
-	return blockCursor, block, err
-
-}
-
 func (sts *StateTransferState) syncBlockchainToCheckpoint(blockSyncReq *blockSyncReq) {
 
 	logger.Debug("%v is processing a blockSyncReq to block %d", sts.id, blockSyncReq.blockNumber)
@@ -532,7 +452,7 @@ func (sts *StateTransferState) syncBlockchainToCheckpoint(blockSyncReq *blockSyn
 		}
 	} else {
 
-		blockNumber, block, err := sts.syncBlocks(blockSyncReq.blockNumber, blockSyncReq.reportOnBlock, blockSyncReq.firstBlockHash, blockSyncReq.peerIDs)
+		blockNumber, block, err := sts.syncBlocks(blockSyncReq.blockNumber, blockSyncReq.reportOnBlock, blockSyncReq.firstBlockHash, blockSyncReq.peerIDs, true)
 
 		goodRange := &blockRange{
 			highBlock: blockSyncReq.blockNumber,
@@ -657,7 +577,12 @@ func (sts *StateTransferState) VerifyAndRecoverBlockchain() bool {
 		return false
 	}
 
-	blockNumber, block, err := sts.syncBlocks(badBlockNumber-1, targetBlock, lowNextHash, nil)
+	// The blocks from lowBlock down to badBlockNumber chain, so the block below must match the latter
+	if badBlock, err := sts.ledger.GetBlock(badBlockNumber); nil == err && nil != badBlock {
+		lowNextHash = badBlock.PreviousBlockHash
+	}
+
+	blockNumber, block, err := sts.syncBlocks(badBlockNumber-1, targetBlock, lowNextHash, nil, false)
 
 	if blockNumber == badBlockNumber-1 || nil == block {
 		logger.Warning("%v unable to recover any blocks : %s", sts.id, err)
@@ -762,9 +687,19 @@ func (sts *StateTransferState) attemptStateTransfer(currentStateBlockNumber *uin
 		*blocksValid = false // We retrieved a new hash, we will need to sync to a new block
 	}
 
+	sts.updateProgress(func(progress *transferProgress) {
+		progress.targetBlock = (*blockHReply).blockNumber
+	})
+
 	if !*blocksValid {
 		(*mark) = &((*blockHReply).syncMark) // We now know of a more recent block hash
 
+		sts.updateProgress(func(progress *transferProgress) {
+			progress.phase = protos.StateTransferStatus_SYNCING_BLOCKS
+			progress.blocksFetched = 0
+			progress.blocksToFetch = (*mark).blockNumber - *currentStateBlockNumber + 1
+		})
+
 		blockReplyChannel := make(chan error)
 
 		sts.blockSyncReq <- &blockSyncReq{
@@ -833,6 +768,7 @@ func (sts *StateTransferState) stateThread() {
 		case mark := <-sts.initiateStateSync:
 
 			sts.informListeners(0, nil, mark.peerIDs, nil, nil, Initiated)
+			sts.startProgress()
 
 			logger.Debug("%v is initiating state transfer", sts.id)
 
@@ -844,6 +780,14 @@ func (sts *StateTransferState) stateThread() {
 				if err := sts.attemptStateTransfer(&currentStateBlockNumber, &mark, &blockHReply, &blocksValid); err != nil {
 					logger.Error("%s", err)
 					sts.informListeners(0, nil, mark.peerIDs, nil, err, Errored)
+					if sts.takeCancel() {
+						// Give up on the target, and on what was fetched for it
+						logger.Info("%v abandoned its state transfer target, waiting for a new one", sts.id)
+						blockHReply = nil
+						blocksValid = false
+						sts.clearProgress()
+						sts.clearStateProgress()
+					}
 					select {
 					case <-sts.stateThreadExit:
 						logger.Debug("Received request for state thread to exit, aborting state transfer")
@@ -861,6 +805,7 @@ func (sts *StateTransferState) stateThread() {
 			logger.Debug("%v is completing state transfer", sts.id)
 
 			sts.asynchronousTransferInProgress = false
+			sts.finishProgress()
 
 			sts.informListeners(blockHReply.blockNumber, blockHReply.blockHash, blockHReply.peerIDs, blockHReply.metadata, nil, Completed)
 
@@ -892,6 +837,11 @@ func (sts *StateTransferState) informListeners(blockNumber uint64, blockHash []b
 func (sts *StateTransferState) playStateUpToBlockNumber(fromBlockNumber, toBlockNumber uint64, peerIDs []*protos.PeerID) (uint64, error) {
 	logger.Debug("%v attempting to play state forward from %v to block %d", sts.id, peerIDs, toBlockNumber)
 	currentBlock := fromBlockNumber
+	sts.updateProgress(func(progress *transferProgress) {
+		progress.phase = protos.StateTransferStatus_PLAYING_DELTAS
+		progress.deltasApplied = 0
+		progress.deltasToApply = toBlockNumber - fromBlockNumber + 1
+	})
 	err := sts.tryOverPeers(peerIDs, func(peerID *protos.PeerID) error {
 
 		deltaMessages, err := sts.ledger.GetRemoteStateDeltas(peerID, currentBlock, toBlockNumber)
@@ -910,7 +860,13 @@ func (sts *StateTransferState) playStateUpToBlockNumber(fromBlockNumber, toBlock
 					continue // this is an unfortunately normal case, as we can get duplicates, just ignore it
 				}
 
+				if err := sts.checkControl(); nil != err {
+					return err
+				}
+
+				deltaBytes := 0
 				for _, delta := range deltaMessage.Deltas {
+					deltaBytes += len(delta)
 					umDelta := &statemgmt.StateDelta{}
 					if err := umDelta.Unmarshal(delta); nil != err {
 						return fmt.Errorf("%v received a corrupt state delta from %v : %s", sts.id, peerID, err)
@@ -953,6 +909,11 @@ func (sts *StateTransferState) playStateUpToBlockNumber(fromBlockNumber, toBlock
 					return fmt.Errorf("%v played state forward according to %v, hashes matched, but failed to commit, invalidated state", sts.id, peerID)
 				}
 
+				sts.fetchedFrom(peerID, func(progress *transferProgress) {
+					progress.deltasApplied++
+					progress.stateBytes += uint64(deltaBytes)
+				})
+
 				if currentBlock == toBlockNumber {
 					return nil
 				}
@@ -971,8 +932,26 @@ func (sts *StateTransferState) playStateUpToBlockNumber(fromBlockNumber, toBlock
 // This function will retrieve the current state from a peer.
 // Note that no state verification can occur yet, we must wait for the next checkpoint, so it is important
 // not to consider this state as valid
+// If the stack supports it, the state is transferred in verifiable chunks from several peers, falling back
+// to streaming the whole snapshot from a single peer if the chunks cannot be synced
+// The current state is only emptied once a peer started sending the state
 func (sts *StateTransferState) syncStateSnapshot(minBlockNumber uint64, peerIDs []*protos.PeerID) (uint64, error) {
 
+	sts.updateProgress(func(progress *transferProgress) {
+		progress.phase = protos.StateTransferStatus_SYNCING_STATE
+	})
+
+	if chunker, ok := sts.ledger.(consensus.StateChunker); ok {
+		progress, err := sts.startStateChunks(chunker, peerIDs)
+		if nil == err {
+			var blockNumber uint64
+			if blockNumber, err = sts.syncStateChunks(chunker, progress, peerIDs); nil == err {
+				return blockNumber, nil
+			}
+		}
+		logger.Warning("%v could not retrieve the state in chunks, falling back to a state snapshot : %s", sts.id, err)
+	}
+
 	logger.Debug("%v attempting to retrieve state snapshot from recovery from %v", sts.id, peerIDs)
 
 	currentStateBlock := uint64(0)
@@ -980,10 +959,6 @@ func (sts *StateTransferState) syncStateSnapshot(minBlockNumber uint64, peerIDs
 	ok := sts.tryOverPeers(peerIDs, func(peerID *protos.PeerID) error {
 		logger.Debug("%v is initiating state recovery from %v", sts.id, peerID)
 
-		if err := sts.ledger.EmptyState(); nil != err {
-			logger.Error("Could not empty the current state: %s", err)
-		}
-
 		stateChan, err := sts.ledger.GetRemoteStateSnapshot(peerID)
 
 		if err != nil {
@@ -999,6 +974,13 @@ func (sts *StateTransferState) syncStateSnapshot(minBlockNumber uint64, peerIDs
 				if !ok {
 					return fmt.Errorf("%v had state snapshot channel close prematurely after %d deltas: %s", sts.id, counter, err)
 				}
+				if 0 == counter {
+					// The peer is sending its state, which replaces ours and any chunks applied so far
+					if err := sts.ledger.EmptyState(); nil != err {
+						logger.Error("Could not empty the current state: %s", err)
+					}
+					sts.clearStateProgress()
+				}
 				if 0 == len(piece.Delta) {
 					stateHash, err := sts.ledger.GetCurrentStateHash()
 					if nil != err {
@@ -1019,6 +1001,9 @@ func (sts *StateTransferState) syncStateSnapshot(minBlockNumber uint64, peerIDs
 				if err := sts.ledger.CommitStateDelta(piece); nil != err {
 					return fmt.Errorf("%v could not commit state delta from %v after %d deltas: %s", sts.id, counter, peerID, err)
 				}
+				sts.fetchedFrom(peerID, func(progress *transferProgress) {
+					progress.stateBytes += uint64(len(piece.Delta))
+				})
 				counter++
 			case <-timer.C:
 				return fmt.Errorf("%v timed out during state recovery from %v", sts.id, peerID)
@@ -85,6 +85,11 @@ type Peer interface {
 	// If vkID is nil, then the signature is verified against this validator's verification key.
 	Verify(vkID, signature, message []byte) error
 
+	// VerifyPeer checks that signature is a valid signature of message under the
+	// enrollment certificate identified by vkID, which may belong to any peer,
+	// validating or not. Verify only accepts the enrollment certificates of validators.
+	VerifyPeer(vkID, signature, message []byte) error
+
 	// GetStateEncryptor returns a StateEncryptor linked to pair defined by
 	// the deploy transaction and the execute transaction. Notice that,
 	// executeTx can also correspond to a deploy transaction.
@@ -549,16 +549,33 @@ func TestPeerStateEncryptor(t *testing.T) {
 func TestPeerSignVerify(t *testing.T) {
 	msg := []byte("Hello World!!!")
 	signature, err := peer.Sign(msg)
-	if err != utils.ErrNotImplemented {
-		t.Fatalf("Error must be ErrNotImplemented [%s].", err)
+	if err != nil {
+		t.Fatalf("TestSign: failed generating signature [%s].", err)
 	}
-	if signature != nil {
-		t.Fatalf("Result must be nil")
+
+	err = validator.VerifyPeer(peer.GetID(), signature, msg)
+	if err != nil {
+		t.Fatalf("TestSign: failed validating signature [%s].", err)
+	}
+
+	err = validator.VerifyPeer(peer.GetID(), signature, []byte("Hello World!!"))
+	if err == nil {
+		t.Fatalf("TestSign: validated a signature on another message.")
+	}
+
+	err = validator.Verify(peer.GetID(), signature, msg)
+	if err == nil {
+		t.Fatalf("TestSign: validated the signature of a non-validating peer as a validator's.")
+	}
+
+	signature, err = validator.Sign(msg)
+	if err != nil {
+		t.Fatalf("TestSign: failed generating signature [%s].", err)
 	}
 
 	err = peer.Verify(validator.GetID(), signature, msg)
-	if err != utils.ErrNotImplemented {
-		t.Fatalf("Error must be ErrNotImplemented [%s].", err)
+	if err != nil {
+		t.Fatalf("TestSign: failed validating signature [%s].", err)
 	}
 }
 
@@ -0,0 +1,162 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package crypto
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"strconv"
+
+	obcca "github.com/hyperledger-incubator/obc-peer/obc-ca/protos"
+	"github.com/hyperledger-incubator/obc-peer/openchain/crypto/utils"
+	"golang.org/x/net/context"
+)
+
+// verifyPeerSignature checks signature against the enrollment certificate
+// identified by vkID, which must belong to a validator if validatorOnly
+func (peer *peerImpl) verifyPeerSignature(vkID, signature, message []byte, validatorOnly bool) error {
+	if len(vkID) == 0 {
+		return fmt.Errorf("Invalid peer id. It is empty.")
+	}
+	if len(signature) == 0 {
+		return fmt.Errorf("Invalid signature. It is empty.")
+	}
+	if len(message) == 0 {
+		return fmt.Errorf("Invalid message. It is empty.")
+	}
+
+	cert, err := peer.getPeerEnrollmentCert(vkID)
+	if err != nil {
+		peer.error("Failed getting enrollment cert for [% x]: [%s]", vkID, err)
+
+		return err
+	}
+
+	if validatorOnly {
+		role, err := enrollmentCertRole(cert)
+		if err != nil {
+			peer.error("Failed parsing ECertSubjectRole in enrollment certificate for [% x]: [%s]", vkID, err)
+
+			return err
+		}
+		if role != obcca.Role_VALIDATOR {
+			peer.error("Invalid ECertSubjectRole in enrollment certificate for [% x]. Not a validator: [%d]", vkID, role)
+
+			return fmt.Errorf("Enrollment certificate does not belong to a validator")
+		}
+	}
+
+	ok, err := peer.verify(cert.PublicKey, message, signature)
+	if err != nil {
+		peer.error("Failed verifying signature for [% x]: [%s]", vkID, err)
+
+		return err
+	}
+
+	if !ok {
+		peer.error("Failed invalid signature for [% x]", vkID)
+
+		return utils.ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// getPeerEnrollmentCert returns the enrollment certificate identified by id,
+// which the ECA issued to a peer, validating or not
+func (peer *peerImpl) getPeerEnrollmentCert(id []byte) (*x509.Certificate, error) {
+	sid := utils.EncodeBase64(id)
+
+	peer.peerCertsMutex.Lock()
+	cert := peer.peerCerts[sid]
+	peer.peerCertsMutex.Unlock()
+	if cert != nil {
+		peer.debug("Enrollment certificate for [%s] already in memory.", sid)
+		return cert, nil
+	}
+
+	peer.debug("Reading certificate for hash [% x]", id)
+	responce, err := peer.callECAReadCertificateByHash(context.Background(), &obcca.Hash{Hash: id})
+	if err != nil {
+		peer.error("Failed requesting enrollment certificate [%s].", err.Error())
+
+		return nil, err
+	}
+
+	// Check that the certificate is the one identified by id
+	if !bytes.Equal(utils.Hash(responce.Sign), id) {
+		peer.error("Enrollment certificate for signing does not match hash [% x].", id)
+
+		return nil, fmt.Errorf("Enrollment certificate does not match hash [% x]", id)
+	}
+
+	cert, err = utils.DERToX509Certificate(responce.Sign)
+	if err != nil {
+		peer.error("Failed parsing signing enrollment certificate: [%s]", err)
+
+		return nil, err
+	}
+
+	// Check that the certificate was issued by the ECA
+	if _, err := utils.CheckCertAgainRoot(cert, peer.ecaCertPool); err != nil {
+		peer.error("Failed verifying enrollment certificate for signing against the ECA: [%s]", err)
+
+		return nil, err
+	}
+
+	// Check that the certificate belongs to a peer
+	role, err := enrollmentCertRole(cert)
+	if err != nil {
+		peer.error("Failed parsing ECertSubjectRole in enrollment certificate for signing: [%s]", err)
+
+		return nil, err
+	}
+	if role != obcca.Role_VALIDATOR && role != obcca.Role_PEER {
+		peer.error("Invalid ECertSubjectRole in enrollment certificate for signing. Not a peer: [%d]", role)
+
+		return nil, fmt.Errorf("Enrollment certificate does not belong to a peer")
+	}
+
+	peer.peerCertsMutex.Lock()
+	if peer.peerCerts == nil {
+		peer.peerCerts = make(map[string]*x509.Certificate)
+	}
+	peer.peerCerts[sid] = cert
+	peer.peerCertsMutex.Unlock()
+
+	return cert, nil
+}
+
+// enrollmentCertRole returns the role of the subject of an enrollment
+// certificate
+func enrollmentCertRole(cert *x509.Certificate) (obcca.Role, error) {
+	roleRaw, err := utils.GetCriticalExtension(cert, ECertSubjectRole)
+	if err != nil {
+		return 0, err
+	}
+
+	role, err := strconv.ParseInt(string(roleRaw), 10, len(roleRaw)*8)
+	if err != nil {
+		return 0, err
+	}
+
+	return obcca.Role(role), nil
+}
@@ -20,6 +20,9 @@ under the License.
 package crypto
 
 import (
+	"crypto/x509"
+	"sync"
+
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger-incubator/obc-peer/openchain/crypto/utils"
 	obc "github.com/hyperledger-incubator/obc-peer/protos"
@@ -29,6 +32,10 @@ type peerImpl struct {
 	*nodeImpl
 
 	isInitialized bool
+
+	// Enrollment certificates of other peers, by identifier
+	peerCertsMutex sync.Mutex
+	peerCerts      map[string]*x509.Certificate
 }
 
 // Public methods
@@ -106,17 +113,24 @@ func (peer *peerImpl) TransactionPreExecution(tx *obc.Transaction) (*obc.Transac
 	return nil, utils.ErrNotImplemented
 }
 
-// Sign signs msg with this validator's signing key and outputs
+// Sign signs msg with this peer's enrollment key and outputs
 // the signature if no error occurred.
 func (peer *peerImpl) Sign(msg []byte) ([]byte, error) {
-	return nil, utils.ErrNotImplemented
+	return peer.signWithEnrollmentKey(msg)
 }
 
-// Verify checks that signature if a valid signature of message under vkID's verification key.
+// Verify checks that signature if a valid signature of message under vkID's verification key,
+// which must belong to a validator.
 // If the verification succeeded, Verify returns nil meaning no error occurred.
-// If vkID is nil, then the signature is verified against this validator's verification key.
 func (peer *peerImpl) Verify(vkID, signature, message []byte) error {
-	return utils.ErrNotImplemented
+	return peer.verifyPeerSignature(vkID, signature, message, true)
+}
+
+// VerifyPeer checks that signature is a valid signature of message under the
+// enrollment certificate identified by vkID, which may belong to any peer.
+// If the verification succeeded, VerifyPeer returns nil meaning no error occurred.
+func (peer *peerImpl) VerifyPeer(vkID, signature, message []byte) error {
+	return peer.verifyPeerSignature(vkID, signature, message, false)
 }
 
 func (peer *peerImpl) GetStateEncryptor(deployTx, invokeTx *obc.Transaction) (StateEncryptor, error) {
@@ -131,7 +131,7 @@ func CloseAllValidators() (bool, []error) {
 // Private Methods
 
 func newValidator() *validatorImpl {
-	return &validatorImpl{&peerImpl{&nodeImpl{}, false}, false, nil, nil}
+	return &validatorImpl{&peerImpl{&nodeImpl{}, false, sync.Mutex{}, nil}, false, nil, nil}
 }
 
 func closeValidatorInternal(peer Peer, force bool) error {
@@ -20,6 +20,7 @@ under the License.
 package crypto
 
 import (
+	"bytes"
 	"crypto/x509"
 	"fmt"
 	obcca "github.com/hyperledger-incubator/obc-peer/obc-ca/protos"
@@ -87,6 +88,20 @@ func (validator *validatorImpl) getEnrollmentCertByHashFromECA(id []byte) ([]byt
 		return nil, nil, err
 	}
 
+	// Check that the certificate is the one identified by id
+	if !bytes.Equal(utils.Hash(responce.Sign), id) {
+		validator.error("Enrollment certificate for signing does not match hash [% x].", id)
+
+		return nil, nil, fmt.Errorf("Enrollment certificate does not match hash [% x]", id)
+	}
+
+	// Check that the certificate was issued by the ECA
+	if _, err := utils.CheckCertAgainRoot(x509Cert, validator.ecaCertPool); err != nil {
+		validator.error("Failed verifying enrollment certificate for signing against the ECA: [%s]", err)
+
+		return nil, nil, err
+	}
+
 	// Check role
 	roleRaw, err := utils.GetCriticalExtension(x509Cert, ECertSubjectRole)
 	if err != nil {
@@ -103,9 +118,9 @@ func (validator *validatorImpl) getEnrollmentCertByHashFromECA(id []byte) ([]byt
 	}
 
 	if obcca.Role(role) != obcca.Role_VALIDATOR {
-		validator.error("Invalid ECertSubjectRole in enrollment certificate for signing. Not a validator: [%s]", err)
+		validator.error("Invalid ECertSubjectRole in enrollment certificate for signing. Not a validator: [%d]", role)
 
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("Enrollment certificate does not belong to a validator")
 	}
 
 	return responce.Sign, responce.Enc, nil
@@ -37,8 +37,9 @@ const blockchainCF = "blockchainCF"
 const stateCF = "stateCF"
 const stateDeltaCF = "stateDeltaCF"
 const indexesCF = "indexesCF"
+const persistCF = "persistCF"
 
-var columnfamilies = []string{blockchainCF, stateCF, stateDeltaCF, indexesCF}
+var columnfamilies = []string{blockchainCF, stateCF, stateDeltaCF, indexesCF, persistCF}
 
 // OpenchainDB encapsulates rocksdb's structures
 type OpenchainDB struct {
@@ -47,6 +48,7 @@ type OpenchainDB struct {
 	StateCF      *gorocksdb.ColumnFamilyHandle
 	StateDeltaCF *gorocksdb.ColumnFamilyHandle
 	IndexesCF    *gorocksdb.ColumnFamilyHandle
+	PersistCF    *gorocksdb.ColumnFamilyHandle
 }
 
 var openchainDB *OpenchainDB
@@ -124,6 +126,11 @@ func (openchainDB *OpenchainDB) GetFromStateCF(key []byte) ([]byte, error) {
 	return openchainDB.get(openchainDB.StateCF, key)
 }
 
+// GetFromStateCFSnapshot get value for given key from column family in a DB snapshot - stateCF
+func (openchainDB *OpenchainDB) GetFromStateCFSnapshot(snapshot *gorocksdb.Snapshot, key []byte) ([]byte, error) {
+	return openchainDB.getFromSnapshot(snapshot, openchainDB.StateCF, key)
+}
+
 // GetFromStateDeltaCF get value for given key from column family - stateDeltaCF
 func (openchainDB *OpenchainDB) GetFromStateDeltaCF(key []byte) ([]byte, error) {
 	return openchainDB.get(openchainDB.StateDeltaCF, key)
@@ -134,6 +141,11 @@ func (openchainDB *OpenchainDB) GetFromIndexesCF(key []byte) ([]byte, error) {
 	return openchainDB.get(openchainDB.IndexesCF, key)
 }
 
+// GetFromPersistCF get value for given key from column family - persistCF
+func (openchainDB *OpenchainDB) GetFromPersistCF(key []byte) ([]byte, error) {
+	return openchainDB.get(openchainDB.PersistCF, key)
+}
+
 // GetBlockchainCFIterator get iterator for column family - blockchainCF
 func (openchainDB *OpenchainDB) GetBlockchainCFIterator() *gorocksdb.Iterator {
 	return openchainDB.getIterator(openchainDB.BlockchainCF)
@@ -156,6 +168,11 @@ func (openchainDB *OpenchainDB) GetStateDeltaCFIterator() *gorocksdb.Iterator {
 	return openchainDB.getIterator(openchainDB.StateDeltaCF)
 }
 
+// GetPersistCFIterator get iterator for column family - persistCF
+func (openchainDB *OpenchainDB) GetPersistCFIterator() *gorocksdb.Iterator {
+	return openchainDB.getIterator(openchainDB.PersistCF)
+}
+
 // GetSnapshot returns a point-in-time view of the DB. You MUST call snapshot.Release()
 // when you are done with the snapshot.
 func (openchainDB *OpenchainDB) GetSnapshot() *gorocksdb.Snapshot {
@@ -197,16 +214,18 @@ func openDB() (*OpenchainDB, error) {
 	opts := gorocksdb.NewDefaultOptions()
 	defer opts.Destroy()
 	opts.SetCreateIfMissing(false)
+	// column families added after a DB was created are created on open
+	opts.SetCreateIfMissingColumnFamilies(true)
 	db, cfHandlers, err := gorocksdb.OpenDbColumnFamilies(opts, dbPath,
-		[]string{"default", blockchainCF, stateCF, stateDeltaCF, indexesCF},
-		[]*gorocksdb.Options{opts, opts, opts, opts, opts})
+		[]string{"default", blockchainCF, stateCF, stateDeltaCF, indexesCF, persistCF},
+		[]*gorocksdb.Options{opts, opts, opts, opts, opts, opts})
 
 	if err != nil {
 		fmt.Println("Error opening DB", err)
 		return nil, err
 	}
 	isOpen = true
-	return &OpenchainDB{db, cfHandlers[1], cfHandlers[2], cfHandlers[3], cfHandlers[4]}, nil
+	return &OpenchainDB{db, cfHandlers[1], cfHandlers[2], cfHandlers[3], cfHandlers[4], cfHandlers[5]}, nil
 }
 
 // CloseDB releases all column family handles and closes rocksdb
@@ -214,6 +233,7 @@ func (openchainDB *OpenchainDB) CloseDB() {
 	openchainDB.BlockchainCF.Destroy()
 	openchainDB.StateCF.Destroy()
 	openchainDB.StateDeltaCF.Destroy()
+	openchainDB.PersistCF.Destroy()
 	openchainDB.DB.Close()
 	isOpen = false
 }
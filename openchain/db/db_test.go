@@ -51,6 +51,36 @@ func TestOpenDB_DirEmpty(t *testing.T) {
 	performBasicReadWrite(t)
 }
 
+func TestPersistCF(t *testing.T) {
+	createTestDB()
+	defer deleteTestDB()
+	openchainDB := GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	for _, key := range []string{"a.1", "a.2", "b.1"} {
+		if err := openchainDB.DB.PutCF(opt, openchainDB.PersistCF, []byte(key), []byte(key)); err != nil {
+			t.Fatalf("Error while writing to db: %s", err)
+		}
+	}
+	value, err := openchainDB.GetFromPersistCF([]byte("a.2"))
+	if err != nil || !bytes.Equal(value, []byte("a.2")) {
+		t.Fatalf("read error = [%s], value = [%s]", err, value)
+	}
+	if value, _ = openchainDB.GetFromBlockchainCF([]byte("a.2")); value != nil {
+		t.Fatal("Persisted key should not be visible in the blockchain CF")
+	}
+
+	it := openchainDB.GetPersistCFIterator()
+	defer it.Close()
+	var keys []string
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key().Data()))
+	}
+	if len(keys) != 3 || keys[0] != "a.1" || keys[2] != "b.1" {
+		t.Fatalf("Unexpected keys %v", keys)
+	}
+}
+
 // db helper functions
 func createTestDBPath() {
 	dbPath := viper.GetString("peer.fileSystemPath")
@@ -24,6 +24,7 @@ import (
 
 	"golang.org/x/net/context"
 
+	"github.com/hyperledger-incubator/obc-peer/openchain/peer"
 	pb "github.com/hyperledger-incubator/obc-peer/protos"
 )
 
@@ -95,3 +96,24 @@ func TestDevops_Spec_NoVersion(t *testing.T) {
 	t.Logf("Deploy result = %s, err = %s", buildResult, err)
 	//performHandshake(t, peerClientConn)
 }
+
+// lightCoordinator runs in light mode
+type lightCoordinator struct {
+	peer.MessageHandlerCoordinator
+	LightInfo
+}
+
+func (c *lightCoordinator) LightMode() bool {
+	return true
+}
+
+func TestDevops_LightMode(t *testing.T) {
+	devopsServer := NewDevopsServer(&lightCoordinator{})
+	spec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: "mycc"}}}
+	if _, err := devopsServer.Invoke(context.Background(), spec); err != ErrLightMode {
+		t.Fatalf("Expected an invocation to be refused in light mode, got %v", err)
+	}
+	if _, err := devopsServer.Query(context.Background(), spec); err != ErrLightMode {
+		t.Fatalf("Expected a query to be refused in light mode, got %v", err)
+	}
+}
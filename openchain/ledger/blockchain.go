@@ -27,6 +27,7 @@ import (
 	"github.com/hyperledger-incubator/obc-peer/openchain/db"
 	"github.com/hyperledger-incubator/obc-peer/openchain/util"
 	"github.com/hyperledger-incubator/obc-peer/protos"
+	"github.com/spf13/viper"
 	"github.com/tecbot/gorocksdb"
 	"golang.org/x/net/context"
 )
@@ -34,10 +35,11 @@ import (
 // Blockchain holds basic information in memory. Operations on Blockchain are not thread-safe
 // TODO synchronize access to in-memory variables
 type blockchain struct {
-	size               uint64
-	previousBlockHash  []byte
-	indexer            blockchainIndexer
-	lastProcessedBlock *lastProcessedBlock
+	size                uint64
+	previousBlockHash   []byte
+	indexer             blockchainIndexer
+	lastProcessedBlock  *lastProcessedBlock
+	headerHashingHeight uint64 // number of the first block hashed over its header
 }
 
 type lastProcessedBlock struct {
@@ -53,8 +55,11 @@ func newBlockchain() (*blockchain, error) {
 	if err != nil {
 		return nil, err
 	}
-	blockchain := &blockchain{0, nil, nil, nil}
+	blockchain := &blockchain{0, nil, nil, nil, 0}
 	blockchain.size = size
+	if height := viper.GetInt("ledger.blockchain.headerHashingHeight"); height > 0 {
+		blockchain.headerHashingHeight = uint64(height)
+	}
 	if size > 0 {
 		previousBlock, err := fetchBlockFromDB(size - 1)
 		if err != nil {
@@ -124,6 +129,18 @@ func (blockchain *blockchain) getTransactionByUUID(txUUID string) (*protos.Trans
 	return transaction, nil
 }
 
+func (blockchain *blockchain) getTransactionResultByUUID(txUUID string) (*protos.TransactionResult, error) {
+	blockNumber, resultIndex, err := blockchain.indexer.fetchTransactionResultIndexByUUID(txUUID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := blockchain.getBlock(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return block.GetNonHashData().GetTransactionResults()[resultIndex], nil
+}
+
 // getTransactions get all transactions in a block identified by block number
 func (blockchain *blockchain) getTransactions(blockNumber uint64) ([]*protos.Transaction, error) {
 	block, err := blockchain.getBlock(blockNumber)
@@ -178,7 +195,19 @@ func (blockchain *blockchain) getBlockchainInfo() (*protos.BlockchainInfo, error
 	return info, nil
 }
 
+// blockVersion returns the version of the block with the given number.
+// Blocks from ledger.blockchain.headerHashingHeight on are of
+// protos.BlockVersion and hashed over their header, the blocks before are of
+// version 0, as the blocks of peers which do not hash headers.
+func (blockchain *blockchain) blockVersion(blockNumber uint64) uint32 {
+	if blockNumber < blockchain.headerHashingHeight {
+		return 0
+	}
+	return protos.BlockVersion
+}
+
 func (blockchain *blockchain) buildBlock(block *protos.Block, stateHash []byte) *protos.Block {
+	block.Version = blockchain.blockVersion(blockchain.size)
 	block.SetPreviousBlockHash(blockchain.previousBlockHash)
 	block.StateHash = stateHash
 	return block
@@ -229,18 +258,18 @@ func (blockchain *blockchain) persistRawBlock(block *protos.Block, blockNumber u
 	}
 	writeBatch := gorocksdb.NewWriteBatch()
 	defer writeBatch.Destroy()
+	blockHash, err := block.GetHash()
+	if err != nil {
+		return err
+	}
 	writeBatch.PutCF(db.GetDBHandle().BlockchainCF, encodeBlockNumberDBKey(blockNumber), blockBytes)
 
 	// Need to check as we suport out of order blocks in cases such as block/state synchronization. This is
 	// really blockchain height, not size.
-	if blockchain.getSize() < blockNumber+1 {
+	extendsChain := blockchain.getSize() < blockNumber+1
+	if extendsChain {
 		sizeBytes := encodeUint64(blockNumber + 1)
 		writeBatch.PutCF(db.GetDBHandle().BlockchainCF, blockCountKey, sizeBytes)
-		blockchain.size = blockNumber + 1
-	}
-	blockHash, err := block.GetHash()
-	if err != nil {
-		return err
 	}
 
 	if blockchain.indexer.isSynchronous() {
@@ -253,6 +282,11 @@ func (blockchain *blockchain) persistRawBlock(block *protos.Block, blockNumber u
 	if err != nil {
 		return err
 	}
+	if extendsChain {
+		// The new top of the chain is the block the next one links to
+		blockchain.size = blockNumber + 1
+		blockchain.previousBlockHash = blockHash
+	}
 	return nil
 }
 
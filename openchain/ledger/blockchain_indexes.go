@@ -33,6 +33,7 @@ var indexLogger = logging.MustGetLogger("indexes")
 var prefixBlockHashKey = byte(1)
 var prefixTxUUIDKey = byte(2)
 var prefixAddressBlockNumCompositeKey = byte(3)
+var prefixTxResultUUIDKey = byte(4)
 
 type blockchainIndexer interface {
 	isSynchronous() bool
@@ -41,6 +42,7 @@ type blockchainIndexer interface {
 	createIndexesAsync(block *protos.Block, blockNumber uint64, blockHash []byte) error
 	fetchBlockNumberByBlockHash(blockHash []byte) (uint64, error)
 	fetchTransactionIndexByUUID(txUUID string) (uint64, uint64, error)
+	fetchTransactionResultIndexByUUID(txUUID string) (uint64, uint64, error)
 	stop()
 }
 
@@ -77,6 +79,10 @@ func (indexer *blockchainIndexerSync) fetchTransactionIndexByUUID(txUUID string)
 	return fetchTransactionIndexByUUIDFromDB(txUUID)
 }
 
+func (indexer *blockchainIndexerSync) fetchTransactionResultIndexByUUID(txUUID string) (uint64, uint64, error) {
+	return fetchTransactionResultIndexByUUIDFromDB(txUUID)
+}
+
 func (indexer *blockchainIndexerSync) stop() {
 	return
 }
@@ -109,6 +115,18 @@ func addIndexDataForPersistence(block *protos.Block, blockNumber uint64, blockHa
 			}
 		}
 	}
+	// results are not aligned with the transactions, a transaction which
+	// failed or was rejected may not be part of the block at all. Only the
+	// first result is kept, later ones are of duplicates
+	indexedResults := make(map[string]bool)
+	for resultIndex, result := range block.GetNonHashData().GetTransactionResults() {
+		if result.Uuid == "" || indexedResults[result.Uuid] {
+			continue
+		}
+		indexedResults[result.Uuid] = true
+		// add TxUUID -> (blockNumber,indexWithinResults)
+		writeBatch.PutCF(cf, encodeTxResultUUIDKey(result.Uuid), encodeBlockNumTxIndex(blockNumber, uint64(resultIndex)))
+	}
 	for address, txsIndexes := range addressToTxIndexesMap {
 		writeBatch.PutCF(cf, encodeAddressBlockNumCompositeKey(address, blockNumber), encodeListTxIndexes(txsIndexes))
 	}
@@ -135,6 +153,17 @@ func fetchTransactionIndexByUUIDFromDB(txUUID string) (uint64, uint64, error) {
 	return decodeBlockNumTxIndex(blockNumTxIndexBytes)
 }
 
+func fetchTransactionResultIndexByUUIDFromDB(txUUID string) (uint64, uint64, error) {
+	blockNumResultIndexBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeTxResultUUIDKey(txUUID))
+	if err != nil {
+		return 0, 0, err
+	}
+	if blockNumResultIndexBytes == nil {
+		return 0, 0, ErrResourceNotFound
+	}
+	return decodeBlockNumTxIndex(blockNumResultIndexBytes)
+}
+
 func getTxExecutingAddress(tx *protos.Transaction) string {
 	// TODO Fetch address form tx
 	return "address1"
@@ -194,6 +223,11 @@ func encodeTxUUIDKey(txUUID string) []byte {
 	return prependKeyPrefix(prefixTxUUIDKey, []byte(txUUID))
 }
 
+// encode TxResultUUIDKey
+func encodeTxResultUUIDKey(txUUID string) []byte {
+	return prependKeyPrefix(prefixTxResultUUIDKey, []byte(txUUID))
+}
+
 func encodeAddressBlockNumCompositeKey(address string, blockNumber uint64) []byte {
 	b := proto.NewBuffer([]byte{prefixAddressBlockNumCompositeKey})
 	b.EncodeRawBytes([]byte(address))
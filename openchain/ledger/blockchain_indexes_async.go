@@ -147,6 +147,15 @@ func (indexer *blockchainIndexerAsync) fetchTransactionIndexByUUID(txUUID string
 	return fetchTransactionIndexByUUIDFromDB(txUUID)
 }
 
+func (indexer *blockchainIndexerAsync) fetchTransactionResultIndexByUUID(txUUID string) (uint64, uint64, error) {
+	err := indexer.indexerState.checkError()
+	if err != nil {
+		return 0, 0, err
+	}
+	indexer.indexerState.waitForLastCommittedBlock()
+	return fetchTransactionResultIndexByUUIDFromDB(txUUID)
+}
+
 func (indexer *blockchainIndexerAsync) indexPendingBlocks() error {
 	blockchain := indexer.blockchain
 	if blockchain.getSize() == 0 {
@@ -26,6 +26,7 @@ import (
 	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/testutil"
 	"github.com/hyperledger-incubator/obc-peer/openchain/util"
 	"github.com/hyperledger-incubator/obc-peer/protos"
+	"github.com/spf13/viper"
 )
 
 func TestBlockChain_SingleBlock(t *testing.T) {
@@ -86,6 +87,27 @@ func TestBlockChain_SimpleChain(t *testing.T) {
 	}
 }
 
+func TestBlockChainHeaderHashingHeight(t *testing.T) {
+	defer viper.Set("ledger.blockchain.headerHashingHeight", viper.GetInt("ledger.blockchain.headerHashingHeight"))
+	viper.Set("ledger.blockchain.headerHashingHeight", 2)
+	testDBWrapper.CreateFreshDB(t)
+	blockchainTestWrapper := newTestBlockchainWrapper(t)
+	for i := 0; i < 4; i++ {
+		blockchainTestWrapper.addNewBlock(protos.NewBlock(nil, []byte{byte(i)}), []byte("stateHash"))
+	}
+
+	// blocks before the height keep the version of peers which hash the
+	// whole block, and the chain stays linked across the height
+	for i, version := range []uint32{0, 0, protos.BlockVersion, protos.BlockVersion} {
+		block := blockchainTestWrapper.getBlock(uint64(i))
+		testutil.AssertEquals(t, block.Version, version)
+		if i > 0 {
+			previousBlockHash, _ := blockchainTestWrapper.getBlock(uint64(i - 1)).GetHash()
+			testutil.AssertEquals(t, block.PreviousBlockHash, previousBlockHash)
+		}
+	}
+}
+
 func TestBlockChainEmptyChain(t *testing.T) {
 	testDBWrapper.CreateFreshDB(t)
 	blockchainTestWrapper := newTestBlockchainWrapper(t)
@@ -0,0 +1,92 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package ledger
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-incubator/obc-peer/openchain/db"
+	"github.com/hyperledger-incubator/obc-peer/protos"
+	"github.com/tecbot/gorocksdb"
+)
+
+var prefixCheckpointCertificateKey = byte(4)
+var latestCheckpointCertificateKey = []byte{byte(5)}
+
+// PutCheckpointCertificate stores a stable checkpoint certificate in the
+// indexes column family, keyed by its block number. If the certificate is
+// for a block at or above the latest stored one, it also becomes the latest.
+func (ledger *Ledger) PutCheckpointCertificate(cert *protos.CheckpointCertificate) error {
+	certBytes, err := proto.Marshal(cert)
+	if err != nil {
+		return err
+	}
+	openchainDB := db.GetDBHandle()
+	writeBatch := gorocksdb.NewWriteBatch()
+	defer writeBatch.Destroy()
+	writeBatch.PutCF(openchainDB.IndexesCF, encodeCheckpointCertificateKey(cert.BlockNumber), certBytes)
+
+	latestBytes, err := openchainDB.GetFromIndexesCF(latestCheckpointCertificateKey)
+	if err != nil {
+		return err
+	}
+	if latestBytes == nil || decodeBlockNumber(latestBytes) <= cert.BlockNumber {
+		writeBatch.PutCF(openchainDB.IndexesCF, latestCheckpointCertificateKey, encodeBlockNumber(cert.BlockNumber))
+	}
+
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	return openchainDB.DB.Write(opt, writeBatch)
+}
+
+// GetCheckpointCertificate returns the stable checkpoint certificate stored
+// for the given block number, or ErrResourceNotFound if there is none
+func (ledger *Ledger) GetCheckpointCertificate(blockNumber uint64) (*protos.CheckpointCertificate, error) {
+	certBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeCheckpointCertificateKey(blockNumber))
+	if err != nil {
+		return nil, err
+	}
+	if certBytes == nil {
+		return nil, ErrResourceNotFound
+	}
+	cert := &protos.CheckpointCertificate{}
+	err = proto.Unmarshal(certBytes, cert)
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// GetLatestCheckpointCertificate returns the stable checkpoint certificate
+// for the highest block number stored, or ErrResourceNotFound if no
+// certificate has been stored yet
+func (ledger *Ledger) GetLatestCheckpointCertificate() (*protos.CheckpointCertificate, error) {
+	latestBytes, err := db.GetDBHandle().GetFromIndexesCF(latestCheckpointCertificateKey)
+	if err != nil {
+		return nil, err
+	}
+	if latestBytes == nil {
+		return nil, ErrResourceNotFound
+	}
+	return ledger.GetCheckpointCertificate(decodeBlockNumber(latestBytes))
+}
+
+func encodeCheckpointCertificateKey(blockNumber uint64) []byte {
+	return prependKeyPrefix(prefixCheckpointCertificateKey, encodeBlockNumber(blockNumber))
+}
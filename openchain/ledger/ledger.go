@@ -96,7 +96,7 @@ func (ledger *Ledger) BeginTxBatch(id interface{}) error {
 // by a transaction between these two calls, the hash will be different. The
 // preview block does not include non-hashed data such as the local timestamp.
 func (ledger *Ledger) GetTXBatchPreviewBlock(id interface{},
-	transactions []*protos.Transaction, metadata []byte) (*protos.Block, error) {
+	transactions []*protos.Transaction, transactionResults []*protos.TransactionResult, metadata []byte) (*protos.Block, error) {
 	err := ledger.checkValidIDCommitORRollback(id)
 	if err != nil {
 		return nil, err
@@ -105,7 +105,9 @@ func (ledger *Ledger) GetTXBatchPreviewBlock(id interface{},
 	if err != nil {
 		return nil, err
 	}
-	return ledger.blockchain.buildBlock(protos.NewBlock(transactions, metadata), stateHash), nil
+	block := protos.NewBlock(transactions, metadata)
+	block.NonHashData = &protos.NonHashData{TransactionResults: transactionResults}
+	return ledger.blockchain.buildBlock(block, stateHash), nil
 }
 
 // CommitTxBatch - gets invoked when the current transaction-batch needs to be committed
@@ -233,6 +235,26 @@ func (ledger *Ledger) GetStateSnapshot() (*state.StateSnapshot, error) {
 	return ledger.state.GetSnapshot(blockHeight-1, dbSnapshot)
 }
 
+// VerifyStateChunk checks that a chunk of the global state, retrieved from
+// the state snapshot of another peer, belongs to the state with the given
+// hash. A verified chunk can be applied with ApplyStateDelta.
+func (ledger *Ledger) VerifyStateChunk(chunk uint64, delta *statemgmt.StateDelta, proof []byte, stateHash []byte) error {
+	return ledger.state.VerifyStateChunk(chunk, delta, proof, stateHash)
+}
+
+// GetNumStateChunks returns the number of chunks the global state is divided
+// into for state transfer
+func (ledger *Ledger) GetNumStateChunks() (uint64, error) {
+	return ledger.state.GetNumStateChunks()
+}
+
+// GetStateChunkForKey returns the chunk of the global state which holds
+// the key of the chaincode, for verifying a single key-value with
+// VerifyStateChunk
+func (ledger *Ledger) GetStateChunkForKey(chaincodeID string, key string) (uint64, error) {
+	return ledger.state.GetStateChunkForKey(chaincodeID, key)
+}
+
 // GetStateDelta will return the state delta for the specified block if
 // available.
 func (ledger *Ledger) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
@@ -327,6 +349,38 @@ func (ledger *Ledger) GetTransactionByUUID(txUUID string) (*protos.Transaction,
 	return ledger.blockchain.getTransactionByUUID(txUUID)
 }
 
+// GetTransactionResultByUUID returns the result recorded for the transaction
+// with the given uuid, which is only the case if it failed to execute or was
+// rejected. Such a transaction is not necessarily part of any block
+func (ledger *Ledger) GetTransactionResultByUUID(txUUID string) (*protos.TransactionResult, error) {
+	return ledger.blockchain.getTransactionResultByUUID(txUUID)
+}
+
+// GetTransactionProof returns a transaction by it's uuid, along with the
+// proof that it is in the block it was committed in, which can be verified
+// against the header of the block with protos.VerifyTransactionProof
+func (ledger *Ledger) GetTransactionProof(txUUID string) (*protos.TransactionProof, error) {
+	blockNumber, txIndex, err := ledger.blockchain.indexer.fetchTransactionIndexByUUID(txUUID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ledger.blockchain.getBlock(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	path, err := block.GetTransactionProof(txIndex)
+	if err != nil {
+		return nil, err
+	}
+	return &protos.TransactionProof{
+		BlockNumber: blockNumber,
+		Transaction: block.Transactions[txIndex],
+		Index:       txIndex,
+		Count:       uint64(len(block.Transactions)),
+		Path:        path,
+	}, nil
+}
+
 // PutRawBlock puts a raw block on the chain. This function should only be
 // used for synchronization between peers.
 func (ledger *Ledger) PutRawBlock(block *protos.Block, blockNumber uint64) error {
@@ -194,6 +194,16 @@ func TestLedgerPutRawBlock(t *testing.T) {
 	block.StateHash = []byte("bar")
 	ledger.PutRawBlock(block, 4)
 	testutil.AssertEquals(t, ledgerTestWrapper.GetBlockByNumber(4), block)
+
+	// A raw block on top of the chain becomes its head
+	top := ledger.GetBlockchainSize()
+	block = new(protos.Block)
+	block.PreviousBlockHash = []byte("baz")
+	ledger.PutRawBlock(block, top)
+	blockHash, _ := block.GetHash()
+	info, _ := ledger.GetBlockchainInfo()
+	testutil.AssertEquals(t, info.Height, top+1)
+	testutil.AssertEquals(t, info.CurrentBlockHash, blockHash)
 }
 
 func TestLedgerSetRawState(t *testing.T) {
@@ -665,10 +675,12 @@ func TestPreviewTXBatchBlock(t *testing.T) {
 	ledger.TxFinished("txUuid1", true)
 	transaction, _ := buildTestTx(t)
 
-	previewBlock, err := ledger.GetTXBatchPreviewBlock(0, []*protos.Transaction{transaction}, []byte("proof"))
+	results := []*protos.TransactionResult{&protos.TransactionResult{Uuid: "txUuid2", ErrorCode: 1, Error: "failed"}}
+
+	previewBlock, err := ledger.GetTXBatchPreviewBlock(0, []*protos.Transaction{transaction}, results, []byte("proof"))
 	testutil.AssertNoError(t, err, "Error fetching preview block.")
 
-	ledger.CommitTxBatch(0, []*protos.Transaction{transaction}, nil, []byte("proof"))
+	ledger.CommitTxBatch(0, []*protos.Transaction{transaction}, results, []byte("proof"))
 	commitedBlock := ledgerTestWrapper.GetBlockByNumber(0)
 
 	previewBlockHash, err := previewBlock.GetHash()
@@ -703,6 +715,33 @@ func TestGetTransactionByUUID(t *testing.T) {
 	testutil.AssertNil(t, ledgerTransaction)
 }
 
+func TestGetTransactionProof(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	ledger.BeginTxBatch(0)
+	ledger.TxBegin("txUuid1")
+	ledger.SetState("chaincode1", "key1", []byte("value1"))
+	ledger.TxFinished("txUuid1", true)
+	transaction1, _ := buildTestTx(t)
+	transaction2, uuid := buildTestTx(t)
+	transaction3, _ := buildTestTx(t)
+	ledger.CommitTxBatch(0, []*protos.Transaction{transaction1, transaction2, transaction3}, nil, []byte("proof"))
+
+	proof, err := ledger.GetTransactionProof(uuid)
+	testutil.AssertNoError(t, err, "Error fetching transaction proof.")
+	testutil.AssertEquals(t, proof.Transaction, transaction2)
+	testutil.AssertEquals(t, proof.Index, uint64(1))
+	testutil.AssertEquals(t, proof.Count, uint64(3))
+	header, err := ledgerTestWrapper.GetBlockByNumber(proof.BlockNumber).GetHeader()
+	testutil.AssertNoError(t, err, "Error getting block header.")
+	testutil.AssertNoError(t, protos.VerifyTransactionProof(header.TransactionsRoot, proof.Transaction, proof.Index, proof.Count, proof.Path), "Error verifying transaction proof.")
+
+	proof, err = ledger.GetTransactionProof("InvalidUUID")
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+	testutil.AssertNil(t, proof)
+}
+
 func TestTransactionResult(t *testing.T) {
 	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
 	ledger := ledgerTestWrapper.ledger
@@ -737,6 +776,32 @@ func TestTransactionResult(t *testing.T) {
 
 }
 
+func TestGetTransactionResultByUUID(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	// Block 0 holds one transaction, and the result of another one which
+	// was rejected and is not part of the block
+	ledger.BeginTxBatch(0)
+	transaction, uuid := buildTestTx(t)
+	_, rejectedUUID := buildTestTx(t)
+	results := []*protos.TransactionResult{
+		&protos.TransactionResult{Uuid: rejectedUUID, ErrorCode: 2, Error: "rejected"},
+	}
+	ledger.CommitTxBatch(0, []*protos.Transaction{transaction}, results, []byte("proof"))
+
+	result, err := ledger.GetTransactionResultByUUID(rejectedUUID)
+	testutil.AssertNoError(t, err, "Error fetching the result of the rejected transaction")
+	testutil.AssertEquals(t, result.Uuid, rejectedUUID)
+	testutil.AssertEquals(t, result.ErrorCode, uint32(2))
+
+	_, err = ledger.GetTransactionByUUID(rejectedUUID)
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+
+	_, err = ledger.GetTransactionResultByUUID(uuid)
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+}
+
 func TestRangeScanIterator(t *testing.T) {
 	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
 	ledger := ledgerTestWrapper.ledger
@@ -860,3 +925,31 @@ func TestRangeScanIterator(t *testing.T) {
 		})
 	itr.Close()
 }
+
+func TestCheckpointCertificates(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	cert, err := ledger.GetLatestCheckpointCertificate()
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+	testutil.AssertNil(t, cert)
+
+	cert4 := &protos.CheckpointCertificate{BlockNumber: 4, BlockHash: []byte("hash4"), StateHash: []byte("state4"), SequenceNumber: 10,
+		Checkpoints: []*protos.SignedCheckpoint{{ReplicaID: 1, Payload: []byte("payload"), Signature: []byte("signature")}}}
+	cert2 := &protos.CheckpointCertificate{BlockNumber: 2, BlockHash: []byte("hash2"), StateHash: []byte("state2"), SequenceNumber: 5}
+
+	testutil.AssertNoError(t, ledger.PutCheckpointCertificate(cert4), "Error storing checkpoint certificate")
+	testutil.AssertNoError(t, ledger.PutCheckpointCertificate(cert2), "Error storing checkpoint certificate")
+
+	cert, err = ledger.GetLatestCheckpointCertificate()
+	testutil.AssertNoError(t, err, "Error fetching latest checkpoint certificate")
+	testutil.AssertEquals(t, cert, cert4)
+
+	cert, err = ledger.GetCheckpointCertificate(2)
+	testutil.AssertNoError(t, err, "Error fetching checkpoint certificate")
+	testutil.AssertEquals(t, cert, cert2)
+
+	cert, err = ledger.GetCheckpointCertificate(3)
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+	testutil.AssertNil(t, cert)
+}
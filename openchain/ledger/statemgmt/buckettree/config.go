@@ -33,6 +33,9 @@ const ConfigMaxGroupingAtEachLevel = "maxGroupingAtEachLevel"
 // ConfigNumBuckets - config name 'hashFunction'. This is not exposed in yaml file. This configuration is used for testing with custom hash-function
 const ConfigHashFunction = "hashFunction"
 
+// ConfigMinStateChunks - config name 'minStateChunks' as it appears in yaml file
+const ConfigMinStateChunks = "minStateChunks"
+
 // DefaultNumBuckets - total buckets
 const DefaultNumBuckets = 10009
 
@@ -40,6 +43,10 @@ const DefaultNumBuckets = 10009
 // Grouping is started from left. The last group may have less buckets
 const DefaultMaxGroupingAtEachLevel = 10
 
+// DefaultMinStateChunks - For state transfer, the state is divided into chunks which are the
+// buckets at the first level (below the root) that has at least these many buckets
+const DefaultMinStateChunks = 100
+
 var conf *config
 
 type config struct {
@@ -47,6 +54,7 @@ type config struct {
 	lowestLevel            int
 	levelToNumBucketsMap   map[int]int
 	hashFunc               hashFunc
+	chunkLevel             int
 }
 
 func initConfig(configs map[string]interface{}) {
@@ -67,11 +75,16 @@ func initConfig(configs map[string]interface{}) {
 		hashFunction = fnvHash
 	}
 	conf = newConfig(numBuckets, maxGroupingAtEachLevel, hashFunction)
+
+	minStateChunks, ok := configs[ConfigMinStateChunks].(int)
+	if ok {
+		conf.chunkLevel = conf.computeChunkLevel(minStateChunks)
+	}
 	logger.Info("Initializing bucket tree state implemetation with configurations %+v", conf)
 }
 
 func newConfig(numBuckets int, maxGroupingAtEachLevel int, hashFunc hashFunc) *config {
-	conf := &config{maxGroupingAtEachLevel, -1, make(map[int]int), hashFunc}
+	conf := &config{maxGroupingAtEachLevel, -1, make(map[int]int), hashFunc, 0}
 	currentLevel := 0
 	numBucketAtCurrentLevel := numBuckets
 	levelInfoMap := make(map[int]int)
@@ -91,9 +104,21 @@ func newConfig(numBuckets int, maxGroupingAtEachLevel int, hashFunc hashFunc) *c
 	for k, v := range levelInfoMap {
 		conf.levelToNumBucketsMap[conf.lowestLevel-k] = v
 	}
+	conf.chunkLevel = conf.computeChunkLevel(DefaultMinStateChunks)
 	return conf
 }
 
+func (config *config) computeChunkLevel(minStateChunks int) int {
+	level := 0
+	if config.lowestLevel > 0 {
+		level = 1
+	}
+	for level < config.lowestLevel && config.levelToNumBucketsMap[level] < minStateChunks {
+		level++
+	}
+	return level
+}
+
 func (config *config) getNumBuckets(level int) int {
 	if level < 0 || level > config.lowestLevel {
 		panic(fmt.Errorf("level can only be between 0 and [%d]", config.lowestLevel))
@@ -113,6 +138,10 @@ func (config *config) getMaxGroupingAtEachLevel() int {
 	return config.maxGroupingAtEachLevel
 }
 
+func (config *config) getChunkLevel() int {
+	return config.chunkLevel
+}
+
 func (config *config) getNumBucketsAtLowestLevel() int {
 	return config.getNumBuckets(config.getLowestLevel())
 }
@@ -51,6 +51,10 @@ func TestConfig(t *testing.T) {
 	testutil.AssertEquals(t, testConf.computeParentBucketNumber(9), 5)
 	testutil.AssertEquals(t, testConf.computeParentBucketNumber(10), 5)
 
+	testutil.AssertEquals(t, testConf.getChunkLevel(), 5)
+	testutil.AssertEquals(t, testConf.computeChunkLevel(5), 3)
+	testutil.AssertEquals(t, testConf.computeChunkLevel(1), 1)
+
 	testConf = newConfig(26, 3, fnvHash)
 	t.Logf("conf.levelToNumBucketsMap: [%#v]", testConf.levelToNumBucketsMap)
 	testutil.AssertEquals(t, testConf.getLowestLevel(), 3)
@@ -23,6 +23,7 @@ import (
 	"github.com/hyperledger-incubator/obc-peer/openchain/db"
 	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
 	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/util"
+	"github.com/tecbot/gorocksdb"
 )
 
 func fetchDataNodeFromDB(dataKey *dataKey) (*dataNode, error) {
@@ -49,6 +50,18 @@ func fetchBucketNodeFromDB(bucketKey *bucketKey) (*bucketNode, error) {
 	return unmarshalBucketNode(bucketKey, nodeBytes), nil
 }
 
+func fetchBucketNodeFromSnapshot(snapshot *gorocksdb.Snapshot, bucketKey *bucketKey) (*bucketNode, error) {
+	openchainDB := db.GetDBHandle()
+	nodeBytes, err := openchainDB.GetFromStateCFSnapshot(snapshot, bucketKey.getEncodedBytes())
+	if err != nil {
+		return nil, err
+	}
+	if util.IsNil(nodeBytes) {
+		return nil, nil
+	}
+	return unmarshalBucketNode(bucketKey, nodeBytes), nil
+}
+
 type rawKey []byte
 
 func fetchDataNodesFromDBFor(bucketKey *bucketKey) (dataNodes, error) {
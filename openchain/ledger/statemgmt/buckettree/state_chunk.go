@@ -0,0 +1,258 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package buckettree
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-incubator/obc-peer/openchain/db"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/util"
+	"github.com/tecbot/gorocksdb"
+)
+
+// A state chunk is the subtree under one of the buckets at the chunk level (see config).
+// The proof for a chunk consists of all the bucket nodes at the level just above the chunk
+// level. These hold the crypto-hashes of all the chunks, and are enough to recompute the
+// crypto-hash of the root. For the default configuration this is 11 bucket nodes.
+
+// GetNumStateChunks - method implementation for interface 'statemgmt.ChunkedHashableState'
+func (stateImpl *StateImpl) GetNumStateChunks() uint64 {
+	return uint64(conf.getNumBuckets(conf.getChunkLevel()))
+}
+
+// GetStateCryptoHashFromSnapshot - method implementation for interface 'statemgmt.ChunkedHashableState'
+func (stateImpl *StateImpl) GetStateCryptoHashFromSnapshot(snapshot *gorocksdb.Snapshot) ([]byte, error) {
+	rootBucketNode, err := fetchBucketNodeFromSnapshot(snapshot, constructRootBucketKey())
+	if err != nil {
+		return nil, err
+	}
+	if rootBucketNode == nil {
+		return nil, nil
+	}
+	return rootBucketNode.computeCryptoHash(), nil
+}
+
+// GetStateChunk - method implementation for interface 'statemgmt.ChunkedHashableState'
+func (stateImpl *StateImpl) GetStateChunk(snapshot *gorocksdb.Snapshot, chunk uint64) (*statemgmt.StateDelta, []byte, error) {
+	chunkKey, err := getChunkBucketKey(chunk)
+	if err != nil {
+		return nil, nil, err
+	}
+	firstBucket, lastBucket := getLowestLevelBucketRange(chunkKey)
+	logger.Debug("Fetching state chunk [%d] which covers buckets [%d] to [%d]", chunk, firstBucket, lastBucket)
+
+	stateDelta := statemgmt.NewStateDelta()
+	itr := db.GetDBHandle().GetStateCFSnapshotIterator(snapshot)
+	defer itr.Close()
+	for itr.Seek(encodeBucketNumber(firstBucket)); itr.Valid(); itr.Next() {
+		// making a copy of key-value bytes because, underlying key bytes are reused by itr.
+		keyBytes := statemgmt.Copy(itr.Key().Data())
+		bucketNumber, l := decodeBucketNumber(keyBytes)
+		if bucketNumber > lastBucket {
+			break
+		}
+		chaincodeID, key := statemgmt.DecodeCompositeKey(keyBytes[l:])
+		stateDelta.Set(chaincodeID, key, statemgmt.Copy(itr.Value().Data()), nil)
+	}
+
+	if chunkKey.level == 0 {
+		return stateDelta, []byte{}, nil
+	}
+	proofLevel := chunkKey.level - 1
+	proof := []byte{}
+	for bucketNumber := 1; bucketNumber <= conf.getNumBuckets(proofLevel); bucketNumber++ {
+		bucketKey := newBucketKey(proofLevel, bucketNumber)
+		bucketNode, err := fetchBucketNodeFromSnapshot(snapshot, bucketKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bucketNode == nil {
+			bucketNode = newBucketNode(bucketKey)
+		}
+		proof = append(proof, bucketNode.marshal()...)
+	}
+	return stateDelta, proof, nil
+}
+
+// VerifyStateChunk - method implementation for interface 'statemgmt.ChunkedHashableState'
+func (stateImpl *StateImpl) VerifyStateChunk(chunk uint64, stateDelta *statemgmt.StateDelta, proof []byte, stateCryptoHash []byte) error {
+	chunkKey, err := getChunkBucketKey(chunk)
+	if err != nil {
+		return err
+	}
+	chunkCryptoHash, err := computeChunkCryptoHash(chunkKey, stateDelta)
+	if err != nil {
+		return err
+	}
+
+	if chunkKey.level == 0 {
+		if !bytes.Equal(chunkCryptoHash, stateCryptoHash) {
+			return fmt.Errorf("State chunk [%d] has crypto-hash [%x], expected [%x]", chunk, chunkCryptoHash, stateCryptoHash)
+		}
+		return nil
+	}
+
+	bucketNodes, err := unmarshalProofBucketNodes(chunkKey.level-1, proof)
+	if err != nil {
+		return fmt.Errorf("Invalid proof for state chunk [%d]: %s", chunk, err)
+	}
+	parentKey := chunkKey.getParentKey()
+	expectedCryptoHash := bucketNodes[parentKey.bucketNumber].childrenCryptoHash[parentKey.getChildIndex(chunkKey)]
+	if !bytes.Equal(chunkCryptoHash, expectedCryptoHash) {
+		return fmt.Errorf("State chunk [%d] has crypto-hash [%x], but the proof has [%x]", chunk, chunkCryptoHash, expectedCryptoHash)
+	}
+
+	for level := chunkKey.level - 1; level > 0; level-- {
+		parentBucketNodes := make(map[int]*bucketNode)
+		for _, bucketNode := range bucketNodes {
+			parentKey := bucketNode.bucketKey.getParentKey()
+			parentBucketNode, ok := parentBucketNodes[parentKey.bucketNumber]
+			if !ok {
+				parentBucketNode = newBucketNode(parentKey)
+				parentBucketNodes[parentKey.bucketNumber] = parentBucketNode
+			}
+			parentBucketNode.setChildCryptoHash(bucketNode.bucketKey, bucketNode.computeCryptoHash())
+		}
+		bucketNodes = parentBucketNodes
+	}
+	rootCryptoHash := bucketNodes[1].computeCryptoHash()
+	if !bytes.Equal(rootCryptoHash, stateCryptoHash) {
+		return fmt.Errorf("The proof for state chunk [%d] leads to state crypto-hash [%x], expected [%x]", chunk, rootCryptoHash, stateCryptoHash)
+	}
+	return nil
+}
+
+// GetStateChunkForKey - method implementation for interface 'statemgmt.ChunkedHashableState'
+func (stateImpl *StateImpl) GetStateChunkForKey(chaincodeID string, key string) uint64 {
+	bucketKey := newDataKey(chaincodeID, key).getBucketKey()
+	for bucketKey.level > conf.getChunkLevel() {
+		bucketKey = bucketKey.getParentKey()
+	}
+	return uint64(bucketKey.bucketNumber - 1)
+}
+
+func getChunkBucketKey(chunk uint64) (*bucketKey, error) {
+	chunkLevel := conf.getChunkLevel()
+	if chunk >= uint64(conf.getNumBuckets(chunkLevel)) {
+		return nil, fmt.Errorf("Invalid state chunk [%d]. State chunks can be between 0 and [%d]", chunk, conf.getNumBuckets(chunkLevel)-1)
+	}
+	return newBucketKey(chunkLevel, int(chunk)+1), nil
+}
+
+// getLowestLevelBucketRange returns the first and last bucket at the lowest level
+// in the subtree under the given bucket
+func getLowestLevelBucketRange(bucketKey *bucketKey) (int, int) {
+	firstBucket, lastBucket := bucketKey.bucketNumber, bucketKey.bucketNumber
+	for level := bucketKey.level; level < conf.getLowestLevel(); level++ {
+		firstBucket = (firstBucket-1)*conf.getMaxGroupingAtEachLevel() + 1
+		lastBucket = lastBucket * conf.getMaxGroupingAtEachLevel()
+	}
+	if lastBucket > conf.getNumBucketsAtLowestLevel() {
+		lastBucket = conf.getNumBucketsAtLowestLevel()
+	}
+	return firstBucket, lastBucket
+}
+
+// computeChunkCryptoHash computes the crypto-hash of the subtree under chunkKey the same way
+// as StateImpl.ComputeCryptoHash, from key-values which may have come from a remote peer
+func computeChunkCryptoHash(chunkKey *bucketKey, stateDelta *statemgmt.StateDelta) ([]byte, error) {
+	if stateDelta.RollBackwards {
+		return nil, fmt.Errorf("State chunk can not be a backwards delta")
+	}
+	firstBucket, lastBucket := getLowestLevelBucketRange(chunkKey)
+	nodesByBucket := make(map[int]dataNodes)
+	for _, chaincodeID := range stateDelta.GetUpdatedChaincodeIds(false) {
+		for key, updatedValue := range stateDelta.GetUpdates(chaincodeID) {
+			if util.IsNil(updatedValue.GetValue()) {
+				return nil, fmt.Errorf("State chunk contains a deleted key [%s] for chaincodeID [%s]", key, chaincodeID)
+			}
+			dataKey := newDataKey(chaincodeID, key)
+			bucketNumber := dataKey.getBucketKey().bucketNumber
+			if bucketNumber < firstBucket || bucketNumber > lastBucket {
+				return nil, fmt.Errorf("State chunk contains key [%s] for chaincodeID [%s] from bucket [%d], outside of the chunk", key, chaincodeID, bucketNumber)
+			}
+			nodesByBucket[bucketNumber] = append(nodesByBucket[bucketNumber], newDataNode(dataKey, updatedValue.GetValue()))
+		}
+	}
+
+	cryptoHashes := make(map[int][]byte)
+	for bucketNumber, nodes := range nodesByBucket {
+		sort.Sort(nodes)
+		bucketHashCalculator := newBucketHashCalculator(newBucketKeyAtLowestLevel(bucketNumber))
+		for _, dataNode := range nodes {
+			bucketHashCalculator.addNextNode(dataNode)
+		}
+		cryptoHashes[bucketNumber] = bucketHashCalculator.computeCryptoHash()
+	}
+
+	for level := conf.getLowestLevel() - 1; level >= chunkKey.level; level-- {
+		bucketNodes := make(map[int]*bucketNode)
+		for bucketNumber, cryptoHash := range cryptoHashes {
+			childKey := newBucketKey(level+1, bucketNumber)
+			parentKey := childKey.getParentKey()
+			parentBucketNode, ok := bucketNodes[parentKey.bucketNumber]
+			if !ok {
+				parentBucketNode = newBucketNode(parentKey)
+				bucketNodes[parentKey.bucketNumber] = parentBucketNode
+			}
+			parentBucketNode.setChildCryptoHash(childKey, cryptoHash)
+		}
+		cryptoHashes = make(map[int][]byte)
+		for bucketNumber, bucketNode := range bucketNodes {
+			cryptoHashes[bucketNumber] = bucketNode.computeCryptoHash()
+		}
+	}
+	return cryptoHashes[chunkKey.bucketNumber], nil
+}
+
+// unmarshalProofBucketNodes decodes all the bucket nodes at the given level from a proof.
+// Unlike unmarshalBucketNode, it returns an error for malformed input instead of panicking
+func unmarshalProofBucketNodes(level int, proof []byte) (map[int]*bucketNode, error) {
+	buffer := proto.NewBuffer(proof)
+	bucketNodes := make(map[int]*bucketNode)
+	remarshalled := []byte{}
+	for bucketNumber := 1; bucketNumber <= conf.getNumBuckets(level); bucketNumber++ {
+		bucketNode := newBucketNode(newBucketKey(level, bucketNumber))
+		firstChildNumber := (bucketNumber-1)*conf.getMaxGroupingAtEachLevel() + 1
+		for i := range bucketNode.childrenCryptoHash {
+			childCryptoHash, err := buffer.DecodeRawBytes(true)
+			if err != nil {
+				return nil, fmt.Errorf("could not decode bucket [%s]: %s", bucketNode.bucketKey, err)
+			}
+			if util.IsNil(childCryptoHash) {
+				continue
+			}
+			if firstChildNumber+i > conf.getNumBuckets(level+1) {
+				return nil, fmt.Errorf("bucket [%s] has a crypto-hash for child [%d] which does not exist", bucketNode.bucketKey, i)
+			}
+			bucketNode.childrenCryptoHash[i] = childCryptoHash
+		}
+		bucketNodes[bucketNumber] = bucketNode
+		remarshalled = append(remarshalled, bucketNode.marshal()...)
+	}
+	if len(remarshalled) != len(proof) {
+		return nil, fmt.Errorf("unexpected data after the last bucket")
+	}
+	return bucketNodes, nil
+}
@@ -0,0 +1,159 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package buckettree
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/db"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/testutil"
+)
+
+func createFreshDBAndInitTestStateImplWithChunks(t *testing.T, minStateChunks int) *stateImplTestWrapper {
+	// number of buckets at each level 26,9,3,1
+	configMap := map[string]interface{}{
+		ConfigNumBuckets:             26,
+		ConfigMaxGroupingAtEachLevel: 3,
+		ConfigMinStateChunks:         minStateChunks,
+	}
+	testDBWrapper.CreateFreshDB(t)
+	stateImpl := NewStateImpl()
+	stateImpl.Initialize(configMap)
+	return &stateImplTestWrapper{configMap, stateImpl, t}
+}
+
+func populateStateForChunkTest(stateImplTestWrapper *stateImplTestWrapper, numKeys int) []byte {
+	stateDelta := statemgmt.NewStateDelta()
+	for i := 0; i < numKeys; i++ {
+		stateDelta.Set(fmt.Sprintf("chaincodeID%d", i%3), fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)), nil)
+	}
+	cryptoHash := stateImplTestWrapper.prepareWorkingSetAndComputeCryptoHash(stateDelta)
+	stateImplTestWrapper.persistChangesAndResetInMemoryChanges()
+	return cryptoHash
+}
+
+func TestStateChunks_TransferState(t *testing.T) {
+	defer initConfig(nil)
+	for _, minStateChunks := range []int{1, 5, 100} {
+		stateImplTestWrapper := createFreshDBAndInitTestStateImplWithChunks(t, minStateChunks)
+		stateImpl := stateImplTestWrapper.stateImpl
+		cryptoHash := populateStateForChunkTest(stateImplTestWrapper, 60)
+
+		dbSnapshot := db.GetDBHandle().GetSnapshot()
+		snapshotCryptoHash, err := stateImpl.GetStateCryptoHashFromSnapshot(dbSnapshot)
+		testutil.AssertNoError(t, err, "Error while computing crypto-hash from snapshot")
+		testutil.AssertEquals(t, snapshotCryptoHash, cryptoHash)
+
+		numChunks := stateImpl.GetNumStateChunks()
+		testutil.AssertEquals(t, numChunks, uint64(conf.getNumBuckets(conf.getChunkLevel())))
+		var chunkDeltas []*statemgmt.StateDelta
+		for chunk := uint64(0); chunk < numChunks; chunk++ {
+			chunkDelta, proof, err := stateImpl.GetStateChunk(dbSnapshot, chunk)
+			testutil.AssertNoError(t, err, fmt.Sprintf("Error while getting state chunk %d", chunk))
+			err = stateImpl.VerifyStateChunk(chunk, chunkDelta, proof, cryptoHash)
+			testutil.AssertNoError(t, err, fmt.Sprintf("Error while verifying state chunk %d", chunk))
+			chunkDeltas = append(chunkDeltas, chunkDelta)
+		}
+		dbSnapshot.Release()
+
+		// rebuild the state from the chunks in a fresh db
+		testDBWrapper.CreateFreshDB(t)
+		stateImplTestWrapper.constructNewStateImpl()
+		numKeys := 0
+		for _, chunkDelta := range chunkDeltas {
+			for _, chaincodeID := range chunkDelta.GetUpdatedChaincodeIds(false) {
+				numKeys += len(chunkDelta.GetUpdates(chaincodeID))
+			}
+			stateImplTestWrapper.prepareWorkingSetAndComputeCryptoHash(chunkDelta)
+			stateImplTestWrapper.persistChangesAndResetInMemoryChanges()
+		}
+		testutil.AssertEquals(t, numKeys, 60)
+		testutil.AssertEquals(t, stateImplTestWrapper.computeCryptoHash(), cryptoHash)
+		testutil.AssertEquals(t, stateImplTestWrapper.get("chaincodeID1", "key10"), []byte("value10"))
+	}
+}
+
+func TestStateChunks_RejectBadChunks(t *testing.T) {
+	defer initConfig(nil)
+	stateImplTestWrapper := createFreshDBAndInitTestStateImplWithChunks(t, 5)
+	stateImpl := stateImplTestWrapper.stateImpl
+	cryptoHash := populateStateForChunkTest(stateImplTestWrapper, 60)
+	dbSnapshot := db.GetDBHandle().GetSnapshot()
+	defer dbSnapshot.Release()
+
+	chunkDelta, proof, err := stateImpl.GetStateChunk(dbSnapshot, 2)
+	testutil.AssertNoError(t, err, "Error while getting state chunk")
+	testutil.AssertNoError(t, stateImpl.VerifyStateChunk(2, chunkDelta, proof, cryptoHash), "Error while verifying state chunk")
+
+	// a chunk presented as a different chunk
+	testutil.AssertError(t, stateImpl.VerifyStateChunk(3, chunkDelta, proof, cryptoHash), "Chunk accepted as another chunk")
+	// a chunk which does not exist
+	testutil.AssertError(t, stateImpl.VerifyStateChunk(stateImpl.GetNumStateChunks(), chunkDelta, proof, cryptoHash), "Chunk accepted beyond the last chunk")
+	// a different state
+	testutil.AssertError(t, stateImpl.VerifyStateChunk(2, chunkDelta, proof, []byte("wrong hash")), "Chunk accepted for a different state")
+
+	// a modified value
+	chaincodeID := chunkDelta.GetUpdatedChaincodeIds(true)[0]
+	for key := range chunkDelta.GetUpdates(chaincodeID) {
+		modifiedDelta := statemgmt.NewStateDelta()
+		modifiedDelta.ApplyChanges(chunkDelta)
+		modifiedDelta.Set(chaincodeID, key, []byte("modified"), nil)
+		testutil.AssertError(t, stateImpl.VerifyStateChunk(2, modifiedDelta, proof, cryptoHash), "Chunk accepted with a modified value")
+		modifiedDelta.Delete(chaincodeID, key, nil)
+		testutil.AssertError(t, stateImpl.VerifyStateChunk(2, modifiedDelta, proof, cryptoHash), "Chunk accepted with a deleted key")
+		break
+	}
+
+	// a modified proof, which should neither be accepted nor panic
+	for i := range proof {
+		modifiedProof := append([]byte{}, proof...)
+		modifiedProof[i]++
+		testutil.AssertError(t, stateImpl.VerifyStateChunk(2, chunkDelta, modifiedProof, cryptoHash), fmt.Sprintf("Chunk accepted with proof modified at byte %d", i))
+	}
+	testutil.AssertError(t, stateImpl.VerifyStateChunk(2, chunkDelta, proof[:len(proof)-1], cryptoHash), "Chunk accepted with a truncated proof")
+	testutil.AssertError(t, stateImpl.VerifyStateChunk(2, chunkDelta, append(proof, 0), cryptoHash), "Chunk accepted with a trailing byte in the proof")
+}
+
+func TestStateChunks_ChunkForKey(t *testing.T) {
+	defer initConfig(nil)
+	stateImplTestWrapper := createFreshDBAndInitTestStateImplWithChunks(t, 5)
+	stateImpl := stateImplTestWrapper.stateImpl
+	cryptoHash := populateStateForChunkTest(stateImplTestWrapper, 60)
+	dbSnapshot := db.GetDBHandle().GetSnapshot()
+	defer dbSnapshot.Release()
+
+	for i := 0; i < 60; i++ {
+		chaincodeID, key := fmt.Sprintf("chaincodeID%d", i%3), fmt.Sprintf("key%d", i)
+		chunk := stateImpl.GetStateChunkForKey(chaincodeID, key)
+		chunkDelta, proof, err := stateImpl.GetStateChunk(dbSnapshot, chunk)
+		testutil.AssertNoError(t, err, "Error while getting state chunk")
+		testutil.AssertNoError(t, stateImpl.VerifyStateChunk(chunk, chunkDelta, proof, cryptoHash), "Error while verifying state chunk")
+		testutil.AssertEquals(t, chunkDelta.Get(chaincodeID, key).GetValue(), []byte(fmt.Sprintf("value%d", i)))
+	}
+
+	// the chunk of a key which is not set proves its absence
+	chunk := stateImpl.GetStateChunkForKey("chaincodeID0", "missing")
+	chunkDelta, proof, err := stateImpl.GetStateChunk(dbSnapshot, chunk)
+	testutil.AssertNoError(t, err, "Error while getting state chunk")
+	testutil.AssertNoError(t, stateImpl.VerifyStateChunk(chunk, chunkDelta, proof, cryptoHash), "Error while verifying state chunk")
+	testutil.AssertNil(t, chunkDelta.Get("chaincodeID0", "missing"))
+}
@@ -71,6 +71,34 @@ type HashableState interface {
 	PerfHintKeyChanged(chaincodeID string, key string)
 }
 
+// ChunkedHashableState - Interface that may additionally be implemented by state management
+// which can divide the state into chunks that can each be verified against the crypto-hash
+// of the whole state. This allows the state to be transferred from several peers, and a bad
+// chunk to be detected as soon as it is received rather than after the entire state
+type ChunkedHashableState interface {
+	HashableState
+
+	// GetNumStateChunks returns the number of chunks the state is divided into. This depends
+	// only on the configuration, so it is the same for all peers sharing the configuration
+	GetNumStateChunks() uint64
+
+	// GetStateCryptoHashFromSnapshot returns the crypto-hash of the state in the db snapshot
+	GetStateCryptoHashFromSnapshot(snapshot *gorocksdb.Snapshot) ([]byte, error)
+
+	// GetStateChunk returns the key-values of a chunk of the state in the db snapshot, along with
+	// a proof which links the chunk to the crypto-hash of the state in the same snapshot
+	GetStateChunk(snapshot *gorocksdb.Snapshot, chunk uint64) (*StateDelta, []byte, error)
+
+	// VerifyStateChunk checks that the key-values of a chunk, together with the proof, hash to
+	// the given crypto-hash of the state. The key-values and proof may come from a remote peer,
+	// so a bad chunk must result in an error rather than a panic
+	VerifyStateChunk(chunk uint64, stateDelta *StateDelta, proof []byte, stateCryptoHash []byte) error
+
+	// GetStateChunkForKey returns the chunk which holds the key of the chaincode, whether or not
+	// the key is set. A verified chunk without the key proves that the key is not set
+	GetStateChunkForKey(chaincodeID string, key string) uint64
+}
+
 // StateSnapshotIterator An interface that is to be implemented by the return value of
 // GetStateSnapshotIterator method in the implementation of HashableState interface
 type StateSnapshotIterator interface {
@@ -236,6 +236,42 @@ func (state *State) GetSnapshot(blockNumber uint64, dbSnapshot *gorocksdb.Snapsh
 	return newStateSnapshot(blockNumber, dbSnapshot)
 }
 
+// VerifyStateChunk checks that a chunk of the global state, retrieved from StateSnapshot.GetChunk
+// on another peer, belongs to the global state with the given hash
+func (state *State) VerifyStateChunk(chunk uint64, stateDelta *statemgmt.StateDelta, proof []byte, stateHash []byte) error {
+	chunkedStateImpl, err := getChunkedStateImpl()
+	if err != nil {
+		return err
+	}
+	return chunkedStateImpl.VerifyStateChunk(chunk, stateDelta, proof, stateHash)
+}
+
+// GetNumStateChunks returns the number of chunks the global state is divided into for state transfer
+func (state *State) GetNumStateChunks() (uint64, error) {
+	chunkedStateImpl, err := getChunkedStateImpl()
+	if err != nil {
+		return 0, err
+	}
+	return chunkedStateImpl.GetNumStateChunks(), nil
+}
+
+// GetStateChunkForKey returns the chunk of the global state which holds the key of the chaincode
+func (state *State) GetStateChunkForKey(chaincodeID string, key string) (uint64, error) {
+	chunkedStateImpl, err := getChunkedStateImpl()
+	if err != nil {
+		return 0, err
+	}
+	return chunkedStateImpl.GetStateChunkForKey(chaincodeID, key), nil
+}
+
+func getChunkedStateImpl() (statemgmt.ChunkedHashableState, error) {
+	chunkedStateImpl, ok := stateImpl.(statemgmt.ChunkedHashableState)
+	if !ok {
+		return nil, fmt.Errorf("The state implementation does not support state chunks")
+	}
+	return chunkedStateImpl, nil
+}
+
 // FetchStateDeltaFromDB fetches the StateDelta corrsponding to given blockNumber
 func (state *State) FetchStateDeltaFromDB(blockNumber uint64) (*statemgmt.StateDelta, error) {
 	stateDeltaBytes, err := db.GetDBHandle().GetFromStateDeltaCF(encodeStateDeltaKey(blockNumber))
@@ -61,3 +61,31 @@ func (ss *StateSnapshot) GetRawKeyValue() ([]byte, []byte) {
 func (ss *StateSnapshot) GetBlockNumber() uint64 {
 	return ss.blockNumber
 }
+
+// GetStateHash returns the crypto-hash of the global state in this snapshot
+func (ss *StateSnapshot) GetStateHash() ([]byte, error) {
+	chunkedStateImpl, err := getChunkedStateImpl()
+	if err != nil {
+		return nil, err
+	}
+	return chunkedStateImpl.GetStateCryptoHashFromSnapshot(ss.dbSnapshot)
+}
+
+// GetNumChunks returns the number of chunks the global state is divided into for state transfer
+func (ss *StateSnapshot) GetNumChunks() (uint64, error) {
+	chunkedStateImpl, err := getChunkedStateImpl()
+	if err != nil {
+		return 0, err
+	}
+	return chunkedStateImpl.GetNumStateChunks(), nil
+}
+
+// GetChunk returns the key-values of a chunk of the global state in this snapshot, along
+// with a proof which links them to the hash returned by GetStateHash
+func (ss *StateSnapshot) GetChunk(chunk uint64) (*statemgmt.StateDelta, []byte, error) {
+	chunkedStateImpl, err := getChunkedStateImpl()
+	if err != nil {
+		return nil, nil, err
+	}
+	return chunkedStateImpl.GetStateChunk(ss.dbSnapshot, chunk)
+}
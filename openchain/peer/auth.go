@@ -0,0 +1,246 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/looplab/fsm"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// authNonceSize is the size of the challenge a peer sends in its hello
+const authNonceSize = 32
+
+// authExporterLabel is the label of the TLS exporter the answer to a
+// challenge is bound to
+const authExporterLabel = "EXPORTER-obc-peer-auth"
+
+// authExporterSize is the size of the keying material taken from the TLS
+// exporter
+const authExporterSize = 32
+
+// Authenticated returns whether the peer proved its identity by answering our
+// challenge. Without security every peer counts as authenticated.
+func (d *Handler) Authenticated() bool {
+	return d.authenticated || !viper.GetBool("security.enabled")
+}
+
+// Identity returns the identity under which this Peer keeps the reputation
+// of the peer: its pkiID once it is authenticated, otherwise the address this
+// Peer dialed. A peer which dialed this Peer without authenticating has no
+// identity, as the address it claims proves nothing.
+func (d *Handler) Identity() string {
+	if d.authenticated && d.ToPeerEndpoint != nil && len(d.ToPeerEndpoint.PkiID) > 0 {
+		return pkiIDIdentity + hex.EncodeToString(d.ToPeerEndpoint.PkiID)
+	}
+	if stream, ok := d.ChatStream.(interface {
+		Context() context.Context
+	}); ok {
+		if address, ok := stream.Context().Value(dialedAddressKey{}).(string); ok && address != "" {
+			return addressIdentity + address
+		}
+	}
+	return ""
+}
+
+// authPayload returns what the peer with pkiID signs to answer nonce. Binding
+// the signature to the receiver and the TLS channel keeps it from being
+// replayed to another peer or over another connection.
+func (d *Handler) authPayload(nonce, pkiID []byte) ([]byte, error) {
+	binding, err := d.channelBinding()
+	if err != nil {
+		return nil, err
+	}
+	payload := append([]byte{}, nonce...)
+	payload = append(payload, pkiID...)
+	return append(payload, binding...), nil
+}
+
+// channelBinding returns keying material exported from the TLS session of
+// the chat stream (tls-exporter, which unlike tls-unique also exists under
+// TLS 1.3), or nil if the stream does not run over TLS. A TLS session that
+// cannot export any is an error, as the answer would not be bound to it.
+func (d *Handler) channelBinding() ([]byte, error) {
+	stream, ok := d.ChatStream.(interface {
+		Context() context.Context
+	})
+	if !ok {
+		return nil, nil
+	}
+	authInfo, ok := credentials.FromContext(stream.Context())
+	if !ok {
+		return nil, nil
+	}
+	tlsInfo, ok := authInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil, nil
+	}
+	binding, err := tlsInfo.State.ExportKeyingMaterial(authExporterLabel, nil, authExporterSize)
+	if err != nil {
+		return nil, fmt.Errorf("Error exporting the TLS channel binding: %s", err)
+	}
+	if len(binding) == 0 {
+		return nil, fmt.Errorf("Error exporting the TLS channel binding: none available")
+	}
+	return binding, nil
+}
+
+// verifyPeerSignature checks the signature of the peer on message. A peer
+// that says it is a validator must sign with a validator certificate, any
+// other peer with the enrollment certificate of a peer.
+func (d *Handler) verifyPeerSignature(signature, message []byte) error {
+	if d.ToPeerEndpoint == nil {
+		return fmt.Errorf("Unknown peer")
+	}
+	secHelper := d.Coordinator.GetSecHelper()
+	if d.ToPeerEndpoint.Type == pb.PeerEndpoint_VALIDATOR {
+		return secHelper.Verify(d.ToPeerEndpoint.PkiID, signature, message)
+	}
+	return secHelper.VerifyPeer(d.ToPeerEndpoint.PkiID, signature, message)
+}
+
+// sendAuth answers the challenge the peer sent in its hello
+func (d *Handler) sendAuth(nonce []byte) error {
+	payload, err := d.authPayload(nonce, d.ToPeerEndpoint.PkiID)
+	if err != nil {
+		return fmt.Errorf("Error answering the challenge of the peer: %s", err)
+	}
+	signature, err := d.Coordinator.GetSecHelper().Sign(payload)
+	if err != nil {
+		return fmt.Errorf("Error signing %s: %s", pb.OpenchainMessage_DISC_AUTH, err)
+	}
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_DISC_AUTH, Payload: nonce, Signature: signature}); err != nil {
+		return fmt.Errorf("Error sending %s: %s", pb.OpenchainMessage_DISC_AUTH, err)
+	}
+	return nil
+}
+
+// beforeAuth checks the answer of the peer to our challenge, and registers
+// the peer once it is authenticated
+func (d *Handler) beforeAuth(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	if !viper.GetBool("security.enabled") || d.authenticated {
+		e.Cancel(fmt.Errorf("Received unexpected %s", e.Event))
+		return
+	}
+	authFailed := func(detail string) {
+		e.Cancel(d.disconnect(&pb.DisconnectMessage{Reason: pb.DisconnectMessage_AUTHENTICATION_FAILED, Detail: detail}))
+	}
+	if len(d.nonce) == 0 || !bytes.Equal(msg.Payload, d.nonce) {
+		authFailed("peer answered another challenge")
+		return
+	}
+	payload, err := d.authPayload(d.nonce, d.Coordinator.GetSecHelper().GetID())
+	if err != nil {
+		authFailed(err.Error())
+		return
+	}
+	if err := d.verifyPeerSignature(msg.Signature, payload); err != nil {
+		authFailed(fmt.Sprintf("invalid answer to our challenge: %s", err))
+		return
+	}
+	d.authenticated = true
+	peerLogger.Debug("Authenticated peer %s", d.ToPeerEndpoint)
+	if err := d.register(); err != nil {
+		e.Cancel(err)
+	}
+}
+
+// messageNeedsSignature returns whether inbound messages of type msgType
+// must carry a valid signature of the sending peer, according to the policy
+// in security.messages. The handshake messages are checked by the handshake.
+func messageNeedsSignature(msgType pb.OpenchainMessage_Type) bool {
+	if !viper.GetBool("security.enabled") {
+		return false
+	}
+	switch msgType {
+	case pb.OpenchainMessage_DISC_HELLO, pb.OpenchainMessage_DISC_AUTH, pb.OpenchainMessage_DISC_DISCONNECT:
+		return false
+	}
+	policy := viper.GetString("security.messages." + msgType.String())
+	if policy == "" {
+		policy = viper.GetString("security.messages.default")
+	}
+	return policy != "" && policy != "none"
+}
+
+// messageSignaturePayload returns what the sender of msg signs. Binding the
+// signature to the challenge of the receiver keeps it from being replayed
+// over another stream.
+func messageSignaturePayload(msg *pb.OpenchainMessage, nonce []byte) ([]byte, error) {
+	unsigned := *msg
+	unsigned.Signature = nil
+	data, err := proto.Marshal(&unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling %s: %s", msg.Type, err)
+	}
+	return append(data, nonce...), nil
+}
+
+// signMessage returns msg signed for the peer if its type requires it. msg
+// itself is left alone, as it may be broadcast to other peers.
+func (d *Handler) signMessage(msg *pb.OpenchainMessage) (*pb.OpenchainMessage, error) {
+	if !messageNeedsSignature(msg.Type) {
+		return msg, nil
+	}
+	if len(d.remoteNonce) == 0 {
+		return nil, fmt.Errorf("Cannot sign %s before the hello of the peer", msg.Type)
+	}
+	data, err := messageSignaturePayload(msg, d.remoteNonce)
+	if err != nil {
+		return nil, err
+	}
+	signed := *msg
+	if signed.Signature, err = d.Coordinator.GetSecHelper().Sign(data); err != nil {
+		return nil, fmt.Errorf("Error signing %s: %s", msg.Type, err)
+	}
+	return &signed, nil
+}
+
+// VerifyMessage checks the signature of the peer on msg if its type requires
+// it
+func (d *Handler) VerifyMessage(msg *pb.OpenchainMessage) error {
+	if !messageNeedsSignature(msg.Type) {
+		return nil
+	}
+	if d.ToPeerEndpoint == nil || len(d.nonce) == 0 {
+		return fmt.Errorf("Received %s before the hello exchange", msg.Type)
+	}
+	data, err := messageSignaturePayload(msg, d.nonce)
+	if err != nil {
+		return err
+	}
+	if err := d.verifyPeerSignature(msg.Signature, data); err != nil {
+		return fmt.Errorf("Invalid signature of peer %s on %s: %s", d.ToPeerEndpoint.ID, msg.Type, err)
+	}
+	return nil
+}
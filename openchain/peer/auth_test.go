@@ -0,0 +1,256 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// deliver hands msgs to d and returns the first error
+func deliver(d *Handler, msgs []*pb.OpenchainMessage) error {
+	for _, msg := range msgs {
+		if err := d.HandleMessage(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestHandlerAuthentication(t *testing.T) {
+	defer viper.Set("security.enabled", viper.GetBool("security.enabled"))
+	viper.Set("security.enabled", true)
+
+	a, coordA, streamA := newTestHandler(t, "vp1", true)
+	b, coordB, streamB := newTestHandler(t, "vp2", false)
+	defer a.Stop()
+	defer b.Stop()
+
+	helloA := streamA.take()
+	if err := deliver(b, helloA); err != nil {
+		t.Fatalf("vp2 failed handling the hello of vp1: %s", err)
+	}
+	if len(coordB.registered) != 0 {
+		t.Fatalf("Expected vp2 to wait for the answer of vp1 before registering it")
+	}
+	if err := b.HandleMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_DISC_GET_PEERS}); err == nil {
+		t.Fatalf("Expected vp2 to refuse messages from the unauthenticated vp1")
+	}
+	if err := deliver(a, streamB.take()); err != nil {
+		t.Fatalf("vp1 failed handling the hello and answer of vp2: %s", err)
+	}
+	authA := streamA.take()
+	if err := deliver(b, authA); err != nil {
+		t.Fatalf("vp2 failed handling the answer of vp1: %s", err)
+	}
+	if !a.Authenticated() || !b.Authenticated() {
+		t.Fatalf("Expected both peers to be authenticated")
+	}
+	if len(coordA.registered) != 1 || len(coordB.registered) != 1 {
+		t.Fatalf("Expected both peers to be registered once authenticated")
+	}
+
+	// Replaying the hello and answer of vp1 on a new stream must fail, as the
+	// answer is for another challenge
+	c, coordC, streamC := newTestHandler(t, "vp2", false)
+	if err := deliver(c, helloA); err != nil {
+		t.Fatalf("vp2 failed handling the replayed hello of vp1: %s", err)
+	}
+	streamC.take()
+	err := deliver(c, authA)
+	if disconnect, ok := err.(*DisconnectError); !ok || disconnect.Reason.Reason != pb.DisconnectMessage_AUTHENTICATION_FAILED {
+		t.Fatalf("Expected replayed answer to fail authentication, got %v", err)
+	}
+	if c.Authenticated() || len(coordC.registered) != 0 {
+		t.Fatalf("Expected the replaying peer not to be authenticated")
+	}
+	if sent := streamC.take(); len(sent) != 1 || sent[0].Type != pb.OpenchainMessage_DISC_DISCONNECT {
+		t.Fatalf("Expected the replaying peer to be disconnected, sent %v", sent)
+	}
+}
+
+func TestHandlerAuthenticationNonValidator(t *testing.T) {
+	defer viper.Set("security.enabled", viper.GetBool("security.enabled"))
+	viper.Set("security.enabled", true)
+
+	a, coordA, streamA := newTestHandler(t, "nvp1", true)
+	b, coordB, streamB := newTestHandler(t, "vp1", false)
+	defer a.Stop()
+	defer b.Stop()
+	if err := deliver(b, streamA.take()); err != nil {
+		t.Fatalf("vp1 failed handling the hello of nvp1: %s", err)
+	}
+	if err := deliver(a, streamB.take()); err != nil {
+		t.Fatalf("nvp1 failed handling the hello and answer of vp1: %s", err)
+	}
+	if err := deliver(b, streamA.take()); err != nil {
+		t.Fatalf("vp1 failed handling the answer of nvp1: %s", err)
+	}
+	if !a.Authenticated() || !b.Authenticated() {
+		t.Fatalf("Expected the non-validator and the validator to authenticate each other")
+	}
+	if len(coordA.registered) != 1 || len(coordB.registered) != 1 {
+		t.Fatalf("Expected both peers to be registered once authenticated")
+	}
+
+	// A peer without a validator certificate cannot pass for a validator
+	impostor := newTestCoordinator("nvp2")
+	impostor.typ = pb.PeerEndpoint_VALIDATOR
+	c, _, streamC := newTestHandlerFor(t, impostor, true)
+	d, coordD, _ := newTestHandler(t, "vp2", false)
+	defer c.Stop()
+	defer d.Stop()
+	if err := deliver(d, streamC.take()); err == nil {
+		t.Fatalf("Expected the hello of a non-validator claiming to be a validator to be refused")
+	}
+	if d.Authenticated() || len(coordD.registered) != 0 {
+		t.Fatalf("Expected the impostor not to be authenticated")
+	}
+}
+
+func TestHandlerAuthPayload(t *testing.T) {
+	d := &Handler{ChatStream: &testStream{}}
+	nonce := []byte("nonce")
+	payload1, err := d.authPayload(nonce, []byte("vp1"))
+	if err != nil {
+		t.Fatalf("Error building the answer: %s", err)
+	}
+	if !bytes.Equal(payload1, []byte("noncevp1")) {
+		t.Fatalf("Expected the answer to be bound to the challenge and the receiver")
+	}
+	payload2, _ := d.authPayload(nonce, []byte("vp2"))
+	if bytes.Equal(payload1, payload2) {
+		t.Fatalf("Expected answers for different receivers to differ")
+	}
+}
+
+func TestMessageNeedsSignature(t *testing.T) {
+	defer viper.Set("security.enabled", viper.GetBool("security.enabled"))
+	viper.Set("security.enabled", true)
+
+	for msgType, expected := range map[pb.OpenchainMessage_Type]bool{
+		pb.OpenchainMessage_SYNC_BLOCKS:       true,
+		pb.OpenchainMessage_SYNC_STATE_DELTAS: true,
+		pb.OpenchainMessage_DISC_GET_PEERS:    false,
+		pb.OpenchainMessage_DISC_HELLO:        false,
+	} {
+		if messageNeedsSignature(msgType) != expected {
+			t.Errorf("Expected %s to need a signature: %v", msgType, expected)
+		}
+	}
+
+	viper.Set("security.enabled", false)
+	if messageNeedsSignature(pb.OpenchainMessage_SYNC_BLOCKS) {
+		t.Errorf("Expected no signatures without security")
+	}
+}
+
+func TestHandlerMessageSignatures(t *testing.T) {
+	defer viper.Set("security.enabled", viper.GetBool("security.enabled"))
+	viper.Set("security.enabled", true)
+
+	a, _, streamA := newTestHandler(t, "vp1", true)
+	b, _, streamB := newTestHandler(t, "vp2", false)
+	defer a.Stop()
+	defer b.Stop()
+	deliver(b, streamA.take())
+	deliver(a, streamB.take())
+	deliver(b, streamA.take())
+
+	msg := &pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_BLOCKS, Payload: []byte("blocks")}
+	if err := a.SendMessage(msg); err != nil {
+		t.Fatalf("Error sending %s: %s", msg.Type, err)
+	}
+	if msg.Signature != nil {
+		t.Fatalf("Expected the sent message to be left alone")
+	}
+	sent := streamA.take()
+	if len(sent) != 1 || sent[0].Signature == nil {
+		t.Fatalf("Expected a signed %s, sent %v", msg.Type, sent)
+	}
+	if err := b.VerifyMessage(sent[0]); err != nil {
+		t.Fatalf("Expected the signature of vp1 to verify: %s", err)
+	}
+
+	tampered := *sent[0]
+	tampered.Payload = []byte("other blocks")
+	if err := b.VerifyMessage(&tampered); err == nil {
+		t.Fatalf("Expected a tampered message to fail verification")
+	}
+	if err := b.VerifyMessage(msg); err == nil {
+		t.Fatalf("Expected an unsigned message to fail verification")
+	}
+
+	// The signature is bound to the stream it was sent over
+	c, _, streamC := newTestHandler(t, "vp2", false)
+	a2, _, streamA2 := newTestHandler(t, "vp1", true)
+	defer c.Stop()
+	defer a2.Stop()
+	deliver(c, streamA2.take())
+	deliver(a2, streamC.take())
+	deliver(c, streamA2.take())
+	if err := c.VerifyMessage(sent[0]); err == nil {
+		t.Fatalf("Expected a message replayed over another stream to fail verification")
+	}
+}
+
+func TestHandlerMessageSignaturePenalty(t *testing.T) {
+	defer viper.Set("security.enabled", viper.GetBool("security.enabled"))
+	viper.Set("security.enabled", true)
+
+	a, _, streamA := newTestHandler(t, "nvp1", true)
+	b, _, streamB := newTestHandler(t, "vp1", false)
+	defer a.Stop()
+	deliver(b, streamA.take())
+	deliver(a, streamB.take())
+	deliver(b, streamA.take())
+
+	msg := &pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_BLOCKS, Payload: []byte("blocks")}
+	if err := a.SendMessage(msg); err != nil {
+		t.Fatalf("Error sending %s: %s", msg.Type, err)
+	}
+	sent := streamA.take()
+	if len(sent) != 1 {
+		t.Fatalf("Expected a signed %s, sent %v", msg.Type, sent)
+	}
+	if err := b.VerifyMessage(sent[0]); err != nil {
+		t.Fatalf("Expected the signature of the non-validator to verify: %s", err)
+	}
+
+	// A message failing its signature check is a protocol error of the peer
+	tampered := *sent[0]
+	tampered.Payload = []byte("other blocks")
+	p := &PeerImpl{handlerMap: &handlerMap{m: make(map[pb.PeerID]MessageHandler)}, discovery: newDiscoveryStore(false)}
+	p.handlerFactory = func(MessageHandlerCoordinator, ChatStream, bool, MessageHandler) (MessageHandler, error) {
+		return b, nil
+	}
+	p.handleChat(context.Background(), &queueStream{queue: []*pb.OpenchainMessage{&tampered}}, false)
+	if b.Identity() == "" {
+		t.Fatalf("Expected the authenticated peer to be known by its pkiID")
+	}
+	if reputation := p.discovery.reputation(b.Identity()); reputation != reputationProtocolError {
+		t.Fatalf("Expected the peer to lose %d reputation for a bad signature, has %d", -reputationProtocolError, reputation)
+	}
+}
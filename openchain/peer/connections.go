@@ -0,0 +1,164 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// connectionQuota returns the maximum number of connections with peers of
+// type typ, in the direction given by outbound, 0 for no limit
+func connectionQuota(outbound bool, typ pb.PeerEndpoint_Type) int {
+	kind := "nonValidators"
+	if typ == pb.PeerEndpoint_VALIDATOR {
+		kind = "validators"
+	}
+	return viper.GetInt("peer.connections." + direction(outbound) + "." + kind)
+}
+
+// isOutbound reports whether this Peer dialed the peer of handler
+func isOutbound(handler MessageHandler) bool {
+	outbound, ok := handler.(interface {
+		Outbound() bool
+	})
+	return ok && outbound.Outbound()
+}
+
+// handlerIdentity returns the identity under which the reputation of the
+// peer of handler is kept, "" if the peer has none
+func handlerIdentity(handler MessageHandler) string {
+	identified, ok := handler.(interface {
+		Identity() string
+	})
+	if !ok {
+		return ""
+	}
+	return identified.Identity()
+}
+
+// dialedAddressKey is the context key of the address this Peer dialed to
+// start a chat
+type dialedAddressKey struct{}
+
+// withDialedAddress returns a context for the chat with the peer this Peer
+// dialed at address
+func withDialedAddress(ctx context.Context, address string) context.Context {
+	return context.WithValue(ctx, dialedAddressKey{}, address)
+}
+
+// evicter is implemented by handlers which can end the chat with their peer
+type evicter interface {
+	Evict(reason *pb.DisconnectMessage)
+}
+
+// connections returns the registered handlers in the quota of outbound and
+// typ. The caller must hold the lock of the handler map.
+func (p *PeerImpl) connections(outbound bool, typ pb.PeerEndpoint_Type) map[pb.PeerID]MessageHandler {
+	handlers := make(map[pb.PeerID]MessageHandler)
+	for id, handler := range p.handlerMap.m {
+		endpoint, err := handler.To()
+		if err == nil && endpoint.Type == typ && isOutbound(handler) == outbound {
+			handlers[id] = handler
+		}
+	}
+	return handlers
+}
+
+// hasRoom reports whether one more connection fits in the quota of outbound
+// and typ. The caller must hold the lock of the handler map.
+func (p *PeerImpl) hasRoom(outbound bool, typ pb.PeerEndpoint_Type) bool {
+	quota := connectionQuota(outbound, typ)
+	return quota <= 0 || len(p.connections(outbound, typ)) < quota
+}
+
+// makeRoom checks that the connection of handler fits in its quota. When
+// the quota is full, the connected peer of the quota with the worst
+// reputation is evicted if the peer of handler has a better one, otherwise
+// a ConnectionLimitError is returned. Reputations are those of the
+// identities of the peers, so a peer without identity cannot evict any, and
+// an evicted peer is refused for the eviction backoff. The caller must hold
+// the lock of the handler map.
+func (p *PeerImpl) makeRoom(handler MessageHandler) error {
+	endpoint, err := handler.To()
+	if err != nil {
+		return err
+	}
+	identity := handlerIdentity(handler)
+	if identity != "" && p.discovery.isEvicted(identity) {
+		return &ConnectionLimitError{Detail: fmt.Sprintf("peer %s was evicted recently", identity)}
+	}
+	outbound := isOutbound(handler)
+	quota := connectionQuota(outbound, endpoint.Type)
+	if quota <= 0 {
+		return nil
+	}
+	connected := p.connections(outbound, endpoint.Type)
+	if len(connected) < quota {
+		return nil
+	}
+	var victimID pb.PeerID
+	var victim MessageHandler
+	var victimReputation int64
+	for id, h := range connected {
+		if _, ok := h.(evicter); !ok {
+			continue
+		}
+		if reputation := p.discovery.reputation(handlerIdentity(h)); victim == nil || reputation < victimReputation {
+			victimID, victim, victimReputation = id, h, reputation
+		}
+	}
+	reputation := p.discovery.reputation(identity)
+	if victim == nil || identity == "" || reputation <= victimReputation {
+		return &ConnectionLimitError{Detail: fmt.Sprintf("%d %s connections with peers of type %s already", len(connected), direction(outbound), endpoint.Type)}
+	}
+	victimEndpoint, _ := victim.To()
+	peerLogger.Info("Evicting peer %s with reputation %d for peer %s with reputation %d", victimEndpoint.Address, victimReputation, identity, reputation)
+	p.discovery.evict(handlerIdentity(victim))
+	p.removeHandler(victimID, victim)
+	victim.(evicter).Evict(&pb.DisconnectMessage{
+		Reason: pb.DisconnectMessage_TOO_MANY_PEERS,
+		Detail: fmt.Sprintf("evicted for a peer with a better reputation, %d %s connections with peers of type %s", len(connected), direction(outbound), endpoint.Type),
+	})
+	return nil
+}
+
+func direction(outbound bool) string {
+	if outbound {
+		return "outbound"
+	}
+	return "inbound"
+}
+
+// canDial reports whether a connection to the peer at address would fit in
+// the outbound quota of its type, as far as its type is known
+func (p *PeerImpl) canDial(address string) bool {
+	typ := p.discovery.endpointType(address)
+	if typ == pb.PeerEndpoint_UNDEFINED {
+		return true
+	}
+	p.handlerMap.RLock()
+	defer p.handlerMap.RUnlock()
+	return p.hasRoom(true, typ)
+}
@@ -0,0 +1,215 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// connTestHandler records why it was evicted
+type connTestHandler struct {
+	MessageHandler
+	endpoint pb.PeerEndpoint
+	identity string
+	outbound bool
+	evicted  *pb.DisconnectMessage
+}
+
+func (h *connTestHandler) To() (pb.PeerEndpoint, error) {
+	return h.endpoint, nil
+}
+
+func (h *connTestHandler) Identity() string {
+	return h.identity
+}
+
+func (h *connTestHandler) Outbound() bool {
+	return h.outbound
+}
+
+func (h *connTestHandler) Evict(reason *pb.DisconnectMessage) {
+	h.evicted = reason
+}
+
+func newConnTestHandler(name string, typ pb.PeerEndpoint_Type, outbound bool) *connTestHandler {
+	return &connTestHandler{endpoint: pb.PeerEndpoint{ID: &pb.PeerID{Name: name}, Address: name + ":30303", Type: typ}, identity: pkiIDIdentity + name, outbound: outbound}
+}
+
+func TestConnectionLimits(t *testing.T) {
+	for _, key := range []string{"peer.connections.inbound.nonValidators", "peer.connections.inbound.validators", "peer.connections.outbound.nonValidators"} {
+		defer viper.Set(key, viper.GetInt(key))
+	}
+	defer viper.Set("peer.connections.evictionBackoff", viper.GetDuration("peer.connections.evictionBackoff"))
+	viper.Set("peer.connections.inbound.nonValidators", 2)
+	viper.Set("peer.connections.inbound.validators", 0)
+	viper.Set("peer.connections.outbound.nonValidators", 0)
+	viper.Set("peer.connections.evictionBackoff", time.Minute)
+
+	p := &PeerImpl{handlerMap: &handlerMap{m: make(map[pb.PeerID]MessageHandler)}, discovery: newDiscoveryStore(false), gossip: newBlockGossip()}
+	a := newConnTestHandler("nvp1", pb.PeerEndpoint_NON_VALIDATOR, false)
+	b := newConnTestHandler("nvp2", pb.PeerEndpoint_NON_VALIDATOR, false)
+	c := newConnTestHandler("nvp3", pb.PeerEndpoint_NON_VALIDATOR, false)
+	for _, h := range []*connTestHandler{a, b} {
+		if err := p.RegisterHandler(h); err != nil {
+			t.Fatalf("Error registering %s: %s", h.endpoint.ID.Name, err)
+		}
+	}
+	if _, ok := p.RegisterHandler(c).(*ConnectionLimitError); !ok {
+		t.Fatalf("Expected nvp3 to be refused, the inbound quota is full of peers with a better reputation")
+	}
+	for _, h := range []*connTestHandler{
+		newConnTestHandler("nvp4", pb.PeerEndpoint_NON_VALIDATOR, true),
+		newConnTestHandler("vp1", pb.PeerEndpoint_VALIDATOR, false),
+	} {
+		if err := p.RegisterHandler(h); err != nil {
+			t.Fatalf("Expected %s to be registered in its own quota: %s", h.endpoint.ID.Name, err)
+		}
+	}
+
+	// Reconnecting earns no reputation
+	for i := 0; i < 3; i++ {
+		if _, ok := p.RegisterHandler(c).(*ConnectionLimitError); !ok {
+			t.Fatalf("Expected nvp3 to be refused however often it reconnects")
+		}
+	}
+
+	// Once nvp2 misbehaved, nvp3 has a better reputation and takes its place
+	p.discovery.protocolError(b.identity)
+	if err := p.RegisterHandler(c); err != nil {
+		t.Fatalf("Expected nvp3 to evict nvp2: %s", err)
+	}
+	if b.evicted == nil || b.evicted.Reason != pb.DisconnectMessage_TOO_MANY_PEERS {
+		t.Fatalf("Expected nvp2 to be evicted, got %v", b.evicted)
+	}
+	if a.evicted != nil {
+		t.Fatalf("Expected nvp1 to stay connected")
+	}
+	if _, ok := p.handlerMap.m[*b.endpoint.ID]; ok || len(p.handlerMap.m) != 4 {
+		t.Fatalf("Expected nvp2 to be removed, registered %v", p.handlerMap.m)
+	}
+
+	// The evicted peer cannot come straight back, even with room to spare
+	b2 := newConnTestHandler("nvp2", pb.PeerEndpoint_NON_VALIDATOR, true)
+	if _, ok := p.RegisterHandler(b2).(*ConnectionLimitError); !ok {
+		t.Fatalf("Expected the evicted nvp2 to be refused during the backoff")
+	}
+	p.discovery.evicted[b.identity] = time.Now()
+
+	// The chat of the evicted handler ends later, and must not deregister a
+	// new chat with the same peer
+	if err := p.RegisterHandler(b2); err != nil {
+		t.Fatalf("Error registering the new chat with nvp2: %s", err)
+	}
+	if err := p.DeregisterHandler(b); err == nil {
+		t.Fatalf("Expected the evicted handler not to be deregistered again")
+	}
+	if p.handlerMap.m[*b.endpoint.ID] != b2 {
+		t.Fatalf("Expected the new chat with nvp2 to stay registered")
+	}
+}
+
+func TestHandlerKeepAlive(t *testing.T) {
+	a, _, streamA := newTestHandler(t, "vp1", true)
+	b, _, streamB := newTestHandler(t, "vp2", false)
+	defer a.Stop()
+	defer b.Stop()
+	if err := deliver(b, streamA.take()); err != nil {
+		t.Fatalf("vp2 failed handling the hello of vp1: %s", err)
+	}
+	if err := deliver(a, streamB.take()); err != nil {
+		t.Fatalf("vp1 failed handling the hello of vp2: %s", err)
+	}
+
+	// A quiet peer is pinged, and answers
+	atomic.StoreInt64(&a.lastReceived, time.Now().Add(-time.Minute).UnixNano())
+	if a.keepAlive(30*time.Second, 90*time.Second) {
+		t.Fatalf("Expected the chat to stay open")
+	}
+	ping := streamA.take()
+	if len(ping) != 1 || ping[0].Type != pb.OpenchainMessage_DISC_PING {
+		t.Fatalf("Expected a ping to be sent, sent %v", ping)
+	}
+	if err := deliver(b, ping); err != nil {
+		t.Fatalf("vp2 failed handling the ping: %s", err)
+	}
+	pong := streamB.take()
+	if len(pong) != 1 || pong[0].Type != pb.OpenchainMessage_DISC_PONG {
+		t.Fatalf("Expected the ping to be answered, sent %v", pong)
+	}
+	if err := deliver(a, pong); err != nil {
+		t.Fatalf("vp1 failed handling the answer to its ping: %s", err)
+	}
+	if a.keepAlive(30*time.Second, 90*time.Second) || len(streamA.take()) != 0 {
+		t.Fatalf("Expected no ping to a peer which just answered")
+	}
+
+	// A peer silent for longer than the timeout is dropped
+	atomic.StoreInt64(&a.lastReceived, time.Now().Add(-2*time.Minute).UnixNano())
+	if !a.keepAlive(30*time.Second, 90*time.Second) {
+		t.Fatalf("Expected the chat with the silent peer to be closed")
+	}
+	select {
+	case <-a.Closed():
+	default:
+		t.Fatalf("Expected the handler to be closed")
+	}
+}
+
+func TestConnectionLimitsIdentity(t *testing.T) {
+	defer viper.Set("peer.connections.inbound.nonValidators", viper.GetInt("peer.connections.inbound.nonValidators"))
+	defer viper.Set("peer.connections.evictionBackoff", viper.GetDuration("peer.connections.evictionBackoff"))
+	viper.Set("peer.connections.inbound.nonValidators", 1)
+	viper.Set("peer.connections.evictionBackoff", time.Minute)
+
+	p := &PeerImpl{handlerMap: &handlerMap{m: make(map[pb.PeerID]MessageHandler)}, discovery: newDiscoveryStore(false), gossip: newBlockGossip()}
+	honest := newConnTestHandler("nvp1", pb.PeerEndpoint_NON_VALIDATOR, false)
+	p.discovery.adjustIdentity(honest.identity, 10)
+	victim := newConnTestHandler("nvp2", pb.PeerEndpoint_NON_VALIDATOR, false)
+	if err := p.RegisterHandler(victim); err != nil {
+		t.Fatalf("Error registering nvp2: %s", err)
+	}
+
+	// Claiming the address of a reputable peer earns none of its reputation
+	impostor := newConnTestHandler("nvp3", pb.PeerEndpoint_NON_VALIDATOR, false)
+	impostor.endpoint.Address = honest.endpoint.Address
+	if _, ok := p.RegisterHandler(impostor).(*ConnectionLimitError); !ok || victim.evicted != nil {
+		t.Fatalf("Expected the impostor to be refused")
+	}
+
+	// A peer without identity cannot evict any, whatever it claims
+	anonymous := newConnTestHandler("nvp1", pb.PeerEndpoint_NON_VALIDATOR, false)
+	anonymous.identity = ""
+	if _, ok := p.RegisterHandler(anonymous).(*ConnectionLimitError); !ok || victim.evicted != nil {
+		t.Fatalf("Expected the peer without identity to be refused")
+	}
+
+	if err := p.RegisterHandler(honest); err != nil || victim.evicted == nil {
+		t.Fatalf("Expected nvp1 to evict nvp2: %v", err)
+	}
+	if !p.discovery.isEvicted(victim.identity) {
+		t.Fatalf("Expected nvp2 to be kept out")
+	}
+}
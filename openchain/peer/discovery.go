@@ -0,0 +1,627 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+	"github.com/tecbot/gorocksdb"
+	"golang.org/x/net/context"
+
+	gp "google/protobuf"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/db"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+const discoveryKeyPrefix = "discovery.peer."
+
+// Reputation changes, the reputation of a peer stays within
+// [minReputation, maxReputation] so that it can always recover. Connecting
+// earns nothing, or a peer could raise its reputation by reconnecting over
+// and over; staying connected earns reputationUptime per uptimePeriod.
+const (
+	reputationUptime        = 1
+	reputationFailedConnect = -1
+	reputationProtocolError = -5
+	minReputation           = -100
+	maxReputation           = 100
+	uptimePeriod            = time.Hour
+)
+
+// Prefixes of the identities under which the reputation of connected peers
+// is kept. The address a peer claims in its hello proves nothing, so a peer
+// is known by its pkiID once it is authenticated, or else by the address
+// this peer dialed.
+const (
+	pkiIDIdentity   = "pkiID:"
+	addressIdentity = "address:"
+)
+
+// discoveryStore records the peers this peer has discovered, by address,
+// and how connecting to them went. With persist set, the records are kept
+// in the local DB, so that they survive a restart. Peers advertise any
+// endpoints they like, so the store keeps at most peer.discovery.maxPeers
+// records, evicting the worst by reputation and then by age, and forgets
+// the peers not heard of for peer.discovery.maxAge.
+//
+// The reputation of a peer known by a dialed address is the one of the
+// record for that address. The reputation of an authenticated peer is kept
+// by pkiID, in memory only. Peers evicted for a peer with a better
+// reputation are refused, and not dialed, for
+// peer.connections.evictionBackoff.
+type discoveryStore struct {
+	sync.Mutex
+	persist    bool
+	max        int           // 0 for no limit
+	maxAge     time.Duration // 0 for no limit
+	backoff    time.Duration // 0 lets evicted peers straight back
+	peers      map[string]*pb.DiscoveredPeer
+	dialing    map[string]bool
+	identities map[string]int64     // reputation by pkiID identity
+	since      map[string]time.Time // connection time by identity
+	evicted    map[string]time.Time // end of the backoff by identity
+}
+
+func newDiscoveryStore(persist bool) *discoveryStore {
+	return &discoveryStore{
+		persist:    persist,
+		max:        viper.GetInt("peer.discovery.maxPeers"),
+		maxAge:     viper.GetDuration("peer.discovery.maxAge"),
+		backoff:    viper.GetDuration("peer.connections.evictionBackoff"),
+		peers:      make(map[string]*pb.DiscoveredPeer),
+		dialing:    make(map[string]bool),
+		identities: make(map[string]int64),
+		since:      make(map[string]time.Time),
+		evicted:    make(map[string]time.Time),
+	}
+}
+
+// load reads the peers recorded by a previous run from the local DB
+func (ds *discoveryStore) load() error {
+	if !ds.persist {
+		return nil
+	}
+	ds.Lock()
+	defer ds.Unlock()
+
+	it := db.GetDBHandle().GetPersistCFIterator()
+	defer it.Close()
+	prefix := []byte(discoveryKeyPrefix)
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key.Data(), prefix) {
+			key.Free()
+			break
+		}
+		value := it.Value()
+		dp := &pb.DiscoveredPeer{}
+		err := proto.Unmarshal(value.Data(), dp)
+		key.Free()
+		value.Free()
+		if err != nil {
+			peerLogger.Warning("Ignoring discovered peer which could not be unmarshaled: %s", err)
+			continue
+		}
+		if dp.Endpoint == nil || dp.Endpoint.Address == "" {
+			continue
+		}
+		dp.Connected = false
+		ds.peers[dp.Endpoint.Address] = dp
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	ds.pruneLocked()
+	peerLogger.Debug("Loaded %d discovered peers", len(ds.peers))
+	return nil
+}
+
+// get returns the record for a peer, creating it if needed, which evicts
+// the worst record if the store is full. The caller must hold the lock.
+func (ds *discoveryStore) get(address string) *pb.DiscoveredPeer {
+	dp, ok := ds.peers[address]
+	if !ok {
+		if ds.full() {
+			if victim := ds.worst(); victim != nil {
+				ds.remove(victim)
+			}
+		}
+		dp = &pb.DiscoveredPeer{Endpoint: &pb.PeerEndpoint{Address: address}, Discovered: toTimestamp(time.Now())}
+		ds.peers[address] = dp
+	}
+	return dp
+}
+
+// full reports whether a new record would exceed the size of the store. The
+// caller must hold the lock.
+func (ds *discoveryStore) full() bool {
+	return ds.max > 0 && len(ds.peers) >= ds.max
+}
+
+// worst returns the record to evict first, or nil if every peer is
+// connected or being dialed. The caller must hold the lock.
+func (ds *discoveryStore) worst() *pb.DiscoveredPeer {
+	var victim *pb.DiscoveredPeer
+	for address, dp := range ds.peers {
+		if dp.Connected || ds.dialing[address] {
+			continue
+		}
+		if victim == nil || ranksBelow(dp, victim) {
+			victim = dp
+		}
+	}
+	return victim
+}
+
+// remove forgets a peer. The caller must hold the lock.
+func (ds *discoveryStore) remove(dp *pb.DiscoveredPeer) {
+	peerLogger.Debug("Forgetting discovered peer %s with reputation %d", dp.Endpoint.Address, dp.Reputation)
+	delete(ds.peers, dp.Endpoint.Address)
+	if !ds.persist {
+		return
+	}
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	if err := openchainDB.DB.DeleteCF(opt, openchainDB.PersistCF, []byte(discoveryKeyPrefix+dp.Endpoint.Address)); err != nil {
+		peerLogger.Error("Could not delete discovered peer %s: %s", dp.Endpoint.Address, err)
+	}
+}
+
+// prune forgets the peers not heard of for maxAge, and the worst peers
+// beyond max
+func (ds *discoveryStore) prune() {
+	ds.Lock()
+	defer ds.Unlock()
+	ds.pruneLocked()
+}
+
+func (ds *discoveryStore) pruneLocked() {
+	if ds.maxAge > 0 {
+		expired := time.Now().Add(-ds.maxAge)
+		for address, dp := range ds.peers {
+			if !dp.Connected && !ds.dialing[address] && lastHeardOf(dp).Before(expired) {
+				ds.remove(dp)
+			}
+		}
+	}
+	for ds.max > 0 && len(ds.peers) > ds.max {
+		victim := ds.worst()
+		if victim == nil {
+			break
+		}
+		ds.remove(victim)
+	}
+}
+
+// lastHeardOf returns when a peer was last connected, or discovered if that
+// was later
+func lastHeardOf(dp *pb.DiscoveredPeer) time.Time {
+	var last time.Time
+	for _, ts := range []*gp.Timestamp{dp.LastSeen, dp.Discovered} {
+		if ts == nil {
+			continue
+		}
+		if t := time.Unix(ts.Seconds, int64(ts.Nanos)); t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// ranksBelow reports whether a is to be evicted before b: it has a worse
+// reputation, or the same one and was heard of less recently
+func ranksBelow(a, b *pb.DiscoveredPeer) bool {
+	if a.Reputation != b.Reputation {
+		return a.Reputation < b.Reputation
+	}
+	return lastHeardOf(a).Before(lastHeardOf(b))
+}
+
+// store writes the record of a peer to the local DB. The caller must hold
+// the lock.
+func (ds *discoveryStore) store(dp *pb.DiscoveredPeer) {
+	if !ds.persist {
+		return
+	}
+	value, err := proto.Marshal(dp)
+	if err != nil {
+		peerLogger.Error("Could not marshal discovered peer %s: %s", dp.Endpoint.Address, err)
+		return
+	}
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	if err := openchainDB.DB.PutCF(opt, openchainDB.PersistCF, []byte(discoveryKeyPrefix+dp.Endpoint.Address), value); err != nil {
+		peerLogger.Error("Could not store discovered peer %s: %s", dp.Endpoint.Address, err)
+	}
+}
+
+func (ds *discoveryStore) adjust(dp *pb.DiscoveredPeer, delta int64) {
+	dp.Reputation = clampReputation(dp.Reputation + delta)
+}
+
+func clampReputation(reputation int64) int64 {
+	if reputation < minReputation {
+		return minReputation
+	} else if reputation > maxReputation {
+		return maxReputation
+	}
+	return reputation
+}
+
+// dialedAddress returns the address of an identity of a peer known by the
+// address this peer dialed, or "" for any other identity
+func dialedAddress(identity string) string {
+	if !strings.HasPrefix(identity, addressIdentity) {
+		return ""
+	}
+	return strings.TrimPrefix(identity, addressIdentity)
+}
+
+// adjustIdentity changes the reputation of the peer with identity. The
+// caller must hold the lock.
+func (ds *discoveryStore) adjustIdentity(identity string, delta int64) {
+	if address := dialedAddress(identity); address != "" {
+		dp := ds.get(address)
+		ds.adjust(dp, delta)
+		ds.store(dp)
+		return
+	}
+	ds.identities[identity] = clampReputation(ds.identities[identity] + delta)
+}
+
+// discovered records a peer another peer told us about. When the store is
+// full, the peer only replaces a record which ranks below a new one.
+func (ds *discoveryStore) discovered(endpoint *pb.PeerEndpoint) {
+	if endpoint == nil || endpoint.Address == "" {
+		return
+	}
+	ds.Lock()
+	defer ds.Unlock()
+	_, known := ds.peers[endpoint.Address]
+	if !known && ds.full() {
+		victim := ds.worst()
+		if victim == nil || !ranksBelow(victim, &pb.DiscoveredPeer{Discovered: toTimestamp(time.Now())}) {
+			peerLogger.Debug("Not recording discovered peer %s, the discovery store is full", endpoint.Address)
+			return
+		}
+		ds.remove(victim)
+	}
+	dp := ds.get(endpoint.Address)
+	if known && proto.Equal(dp.Endpoint, endpoint) {
+		return
+	}
+	dp.Endpoint = endpoint
+	ds.store(dp)
+}
+
+// connected records that a connection to a peer with identity, "" if it
+// has none, was established
+func (ds *discoveryStore) connected(endpoint *pb.PeerEndpoint, identity string) {
+	if endpoint == nil || endpoint.Address == "" {
+		return
+	}
+	ds.Lock()
+	defer ds.Unlock()
+	if identity != "" {
+		ds.since[identity] = time.Now()
+	}
+	dp := ds.get(endpoint.Address)
+	dp.Endpoint = endpoint
+	dp.Connected = true
+	dp.Connects++
+	dp.LastSeen = toTimestamp(time.Now())
+	ds.store(dp)
+}
+
+// disconnected records that the connection to a peer with identity ended,
+// and rewards the peer for the time it stayed connected
+func (ds *discoveryStore) disconnected(endpoint *pb.PeerEndpoint, identity string) {
+	if endpoint == nil || endpoint.Address == "" {
+		return
+	}
+	ds.Lock()
+	defer ds.Unlock()
+	if since, ok := ds.since[identity]; ok {
+		delete(ds.since, identity)
+		if periods := int64(time.Since(since) / uptimePeriod); periods > 0 {
+			ds.adjustIdentity(identity, periods*reputationUptime)
+		}
+	}
+	dp := ds.get(endpoint.Address)
+	dp.Connected = false
+	dp.LastSeen = toTimestamp(time.Now())
+	ds.store(dp)
+}
+
+// connectFailed records a failed attempt to connect to a peer
+func (ds *discoveryStore) connectFailed(address string) {
+	ds.Lock()
+	defer ds.Unlock()
+	dp := ds.get(address)
+	dp.FailedConnects++
+	ds.adjust(dp, reputationFailedConnect)
+	ds.store(dp)
+}
+
+// protocolError records that the peer with identity sent a message we
+// could not handle. A peer without identity cannot be held to account.
+func (ds *discoveryStore) protocolError(identity string) {
+	if identity == "" {
+		return
+	}
+	ds.Lock()
+	defer ds.Unlock()
+	if address := dialedAddress(identity); address != "" {
+		ds.get(address).ProtocolErrors++
+	}
+	ds.adjustIdentity(identity, reputationProtocolError)
+}
+
+// evict records that the peer with identity was evicted, which keeps it out
+// for the backoff
+func (ds *discoveryStore) evict(identity string) {
+	if identity == "" || ds.backoff <= 0 {
+		return
+	}
+	ds.Lock()
+	defer ds.Unlock()
+	ds.evicted[identity] = time.Now().Add(ds.backoff)
+}
+
+// isEvicted reports whether the peer with identity was evicted less than
+// the backoff ago
+func (ds *discoveryStore) isEvicted(identity string) bool {
+	ds.Lock()
+	defer ds.Unlock()
+	return ds.isEvictedLocked(identity)
+}
+
+// isEvictedLocked is isEvicted for a caller holding the lock
+func (ds *discoveryStore) isEvictedLocked(identity string) bool {
+	until, ok := ds.evicted[identity]
+	if ok && !time.Now().Before(until) {
+		delete(ds.evicted, identity)
+		return false
+	}
+	return ok
+}
+
+// dialable reports whether the peer at address is recorded, not connected
+// and not recently evicted
+func (ds *discoveryStore) dialable(address string) bool {
+	ds.Lock()
+	defer ds.Unlock()
+	dp, ok := ds.peers[address]
+	return ok && !dp.Connected && !ds.isEvictedLocked(addressIdentity+address)
+}
+
+// reputation returns the reputation of the peer with identity, 0 if unknown
+func (ds *discoveryStore) reputation(identity string) int64 {
+	ds.Lock()
+	defer ds.Unlock()
+	if address := dialedAddress(identity); address != "" {
+		if dp, ok := ds.peers[address]; ok {
+			return dp.Reputation
+		}
+		return 0
+	}
+	return ds.identities[identity]
+}
+
+// endpointType returns the type of the peer at address, UNDEFINED if unknown
+func (ds *discoveryStore) endpointType(address string) pb.PeerEndpoint_Type {
+	ds.Lock()
+	defer ds.Unlock()
+	if dp, ok := ds.peers[address]; ok && dp.Endpoint != nil {
+		return dp.Endpoint.Type
+	}
+	return pb.PeerEndpoint_UNDEFINED
+}
+
+// startDialing marks a peer as being dialed, it returns false if it is
+// already
+func (ds *discoveryStore) startDialing(address string) bool {
+	ds.Lock()
+	defer ds.Unlock()
+	if ds.dialing[address] {
+		return false
+	}
+	ds.dialing[address] = true
+	return true
+}
+
+func (ds *discoveryStore) doneDialing(address string) {
+	ds.Lock()
+	defer ds.Unlock()
+	delete(ds.dialing, address)
+}
+
+// candidates returns the addresses of up to max peers to reconnect to, best
+// reputation first. Connected peers, peers being dialed, recently evicted
+// peers and the addresses in exclude are left out. A negative max means no
+// limit.
+func (ds *discoveryStore) candidates(exclude map[string]bool, max int) []string {
+	ds.Lock()
+	defer ds.Unlock()
+	var peers []*pb.DiscoveredPeer
+	for address, dp := range ds.peers {
+		if dp.Connected || ds.dialing[address] || exclude[address] || ds.isEvictedLocked(addressIdentity+address) {
+			continue
+		}
+		peers = append(peers, dp)
+	}
+	sort.Sort(byReputation(peers))
+	if max >= 0 && len(peers) > max {
+		peers = peers[:max]
+	}
+	addresses := make([]string, len(peers))
+	for i, dp := range peers {
+		addresses[i] = dp.Endpoint.Address
+	}
+	return addresses
+}
+
+// status returns a copy of the records, sorted by address
+func (ds *discoveryStore) status() []*pb.DiscoveredPeer {
+	ds.Lock()
+	defer ds.Unlock()
+	peers := make([]*pb.DiscoveredPeer, 0, len(ds.peers))
+	for _, dp := range ds.peers {
+		peers = append(peers, proto.Clone(dp).(*pb.DiscoveredPeer))
+	}
+	sort.Sort(discoveredByAddress(peers))
+	return peers
+}
+
+type byReputation []*pb.DiscoveredPeer
+
+func (b byReputation) Len() int      { return len(b) }
+func (b byReputation) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byReputation) Less(i, j int) bool {
+	if b[i].Reputation != b[j].Reputation {
+		return b[i].Reputation > b[j].Reputation
+	}
+	return b[i].Endpoint.Address < b[j].Endpoint.Address
+}
+
+type discoveredByAddress []*pb.DiscoveredPeer
+
+func (d discoveredByAddress) Len() int      { return len(d) }
+func (d discoveredByAddress) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d discoveredByAddress) Less(i, j int) bool {
+	return d[i].Endpoint.Address < d[j].Endpoint.Address
+}
+
+// GetDiscoveredPeers returns what this peer knows about the peers it has
+// discovered
+func (p *PeerImpl) GetDiscoveredPeers() []*pb.DiscoveredPeer {
+	return p.discovery.status()
+}
+
+// touchPeer makes a single attempt to connect to the peer at address, which
+// the caller has marked with startDialing. Once connected, the chat goes on
+// in the background.
+func (p *PeerImpl) touchPeer(address string) {
+	defer p.discovery.doneDialing(address)
+	if !p.canDial(address) {
+		peerLogger.Debug("Not touching peer address %s, the outbound connections are at their limit", address)
+		return
+	}
+	peerLogger.Debug("Touching peer address: %s", address)
+	conn, err := NewPeerClientConnectionWithAddress(address)
+	if err != nil {
+		peerLogger.Debug("Error creating connection to peer address=%s:  %s", address, err)
+		p.discovery.connectFailed(address)
+		return
+	}
+	ctx := withDialedAddress(context.Background(), address)
+	stream, err := pb.NewPeerClient(conn).Chat(ctx)
+	if err != nil {
+		peerLogger.Debug("Error establishing chat with peer address=%s:  %s", address, err)
+		p.discovery.connectFailed(address)
+		conn.Close()
+		return
+	}
+	go func() {
+		p.handleChat(ctx, stream, true)
+		stream.CloseSend()
+		conn.Close()
+	}()
+}
+
+// chatWithDiscoveredPeer chats with a peer another peer told us about, which
+// the caller has marked with startDialing. Like chatWithPeer it retries and
+// reconnects, but only while the peer is recorded, not connected, and fits
+// in the outbound quota of its type.
+func (p *PeerImpl) chatWithDiscoveredPeer(address string) {
+	defer p.discovery.doneDialing(address)
+	p.retryChat(address, func() bool {
+		return p.discovery.dialable(address) && p.canDial(address)
+	})
+}
+
+// touchPeers reconnects to the known peers we are not connected to every
+// peer.discovery.touchPeriod seconds, starting right away so that the peers
+// found by a previous run are reached again after a restart. Up to
+// peer.discovery.touchMaxNodes peers are tried, best reputation first, by
+// peer.discovery.workers workers.
+func (p *PeerImpl) touchPeers() {
+	period := time.Duration(viper.GetInt("peer.discovery.touchPeriod")) * time.Second
+	if period <= 0 {
+		peerLogger.Debug("Not reconnecting to discovered peers")
+		return
+	}
+	workers := viper.GetInt("peer.discovery.workers")
+	if workers < 1 {
+		workers = 1
+	} else if maxWorkers := viper.GetInt("peer.discovery.maxWorkers"); maxWorkers > 0 && workers > maxWorkers {
+		workers = maxWorkers
+	}
+	for {
+		p.touchKnownPeers(workers, viper.GetInt("peer.discovery.touchMaxNodes"))
+		time.Sleep(period)
+	}
+}
+
+func (p *PeerImpl) touchKnownPeers(workers int, max int) {
+	p.discovery.prune()
+	exclude := make(map[string]bool)
+	if address, err := GetLocalAddress(); err == nil {
+		exclude[address] = true
+	}
+	for _, msgHandler := range p.cloneHandlerMap(pb.PeerEndpoint_UNDEFINED) {
+		if endpoint, err := msgHandler.To(); err == nil {
+			exclude[endpoint.Address] = true
+		}
+	}
+	addresses := p.discovery.candidates(exclude, max)
+	if len(addresses) == 0 {
+		return
+	}
+	peerLogger.Debug("Touching %d discovered peers", len(addresses))
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for address := range work {
+				if p.discovery.startDialing(address) {
+					p.touchPeer(address)
+				}
+			}
+		}()
+	}
+	for _, address := range addresses {
+		work <- address
+	}
+	close(work)
+	wg.Wait()
+}
@@ -0,0 +1,238 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tecbot/gorocksdb"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/db"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+func TestDiscoveryStoreCandidates(t *testing.T) {
+	ds := newDiscoveryStore(false)
+	for i := 0; i < 4; i++ {
+		ds.discovered(&pb.PeerEndpoint{ID: &pb.PeerID{Name: fmt.Sprintf("vp%d", i)}, Address: fmt.Sprintf("vp%d:30303", i)})
+	}
+	vp1 := &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}, Address: "vp1:30303"}
+	vp1Identity := addressIdentity + vp1.Address
+	ds.connected(vp1, vp1Identity)
+	ds.since[vp1Identity] = time.Now().Add(-2 * uptimePeriod)
+	ds.disconnected(vp1, vp1Identity)
+	ds.connectFailed("vp2:30303")
+	ds.protocolError(addressIdentity + "vp3:30303")
+
+	expected := []string{"vp1:30303", "vp0:30303", "vp2:30303", "vp3:30303"}
+	if candidates := ds.candidates(nil, -1); !reflect.DeepEqual(candidates, expected) {
+		t.Fatalf("Expected candidates %v, got %v", expected, candidates)
+	}
+	if candidates := ds.candidates(map[string]bool{"vp1:30303": true}, 2); !reflect.DeepEqual(candidates, expected[1:3]) {
+		t.Fatalf("Expected candidates %v, got %v", expected[1:3], candidates)
+	}
+
+	ds.connected(vp1, vp1Identity)
+	if !ds.startDialing("vp0:30303") || ds.startDialing("vp0:30303") {
+		t.Fatalf("Expected a peer to be dialed only once at a time")
+	}
+	if candidates := ds.candidates(nil, -1); !reflect.DeepEqual(candidates, expected[2:]) {
+		t.Fatalf("Expected connected and dialed peers to be left out, got %v", candidates)
+	}
+	ds.doneDialing("vp0:30303")
+
+	status := ds.status()
+	if len(status) != 4 {
+		t.Fatalf("Expected 4 discovered peers, got %d", len(status))
+	}
+	if s := status[1]; s.Reputation != 2*reputationUptime || s.Connects != 2 || !s.Connected || s.LastSeen == nil {
+		t.Fatalf("Unexpected record for vp1: %v", s)
+	}
+	if s := status[2]; s.Reputation != reputationFailedConnect || s.FailedConnects != 1 || s.LastSeen != nil {
+		t.Fatalf("Unexpected record for vp2: %v", s)
+	}
+	if s := status[3]; s.Reputation != reputationProtocolError || s.ProtocolErrors != 1 {
+		t.Fatalf("Unexpected record for vp3: %v", s)
+	}
+
+	for i := 0; i < 50; i++ {
+		ds.protocolError(addressIdentity + "vp3:30303")
+	}
+	if s := ds.status()[3]; s.Reputation != minReputation {
+		t.Fatalf("Expected reputation of vp3 to bottom out at %d, got %d", minReputation, s.Reputation)
+	}
+
+	// Peers evicted for a better one are not dialed during the backoff
+	ds.backoff = time.Minute
+	ds.evict(addressIdentity + "vp0:30303")
+	if candidates := ds.candidates(nil, -1); !reflect.DeepEqual(candidates, expected[2:]) || ds.dialable("vp0:30303") {
+		t.Fatalf("Expected the evicted vp0 to be left out, got %v", candidates)
+	}
+	ds.evicted[addressIdentity+"vp0:30303"] = time.Now()
+	if !ds.dialable("vp0:30303") {
+		t.Fatalf("Expected vp0 to be dialable after the backoff")
+	}
+}
+
+func TestDiscoveryStoreIdentities(t *testing.T) {
+	ds := newDiscoveryStore(false)
+	claimed := &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}, Address: "vp1:30303"}
+	ds.discovered(claimed)
+
+	// An authenticated peer is known by its pkiID, whatever address it claims
+	identity := pkiIDIdentity + "0102"
+	ds.connected(claimed, identity)
+	ds.protocolError(identity)
+	ds.disconnected(claimed, identity)
+	if reputation := ds.reputation(identity); reputation != reputationProtocolError {
+		t.Fatalf("Expected the pkiID to lose %d reputation, has %d", -reputationProtocolError, reputation)
+	}
+	if reputation := ds.reputation(addressIdentity + claimed.Address); reputation != 0 {
+		t.Fatalf("Expected the claimed address to keep its reputation, has %d", reputation)
+	}
+
+	// Reconnecting earns nothing, staying connected does
+	for i := 0; i < 3; i++ {
+		ds.connected(claimed, identity)
+		ds.disconnected(claimed, identity)
+	}
+	if reputation := ds.reputation(identity); reputation != reputationProtocolError {
+		t.Fatalf("Expected reconnects to earn no reputation, has %d", reputation)
+	}
+	ds.connected(claimed, identity)
+	ds.since[identity] = time.Now().Add(-3 * uptimePeriod)
+	ds.disconnected(claimed, identity)
+	if reputation := ds.reputation(identity); reputation != reputationProtocolError+3*reputationUptime {
+		t.Fatalf("Expected %d reputation for 3 periods connected, has %d", 3*reputationUptime, reputation)
+	}
+
+	// A peer without identity is not held to account
+	ds.protocolError("")
+	if reputation := ds.reputation(""); reputation != 0 {
+		t.Fatalf("Expected no reputation without identity, has %d", reputation)
+	}
+}
+
+func TestDiscoveryStorePersist(t *testing.T) {
+	ds := newDiscoveryStore(true)
+	endpoint := &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp9"}, Address: "discovery-test:30303", Type: pb.PeerEndpoint_VALIDATOR}
+	identity := addressIdentity + endpoint.Address
+	ds.connected(endpoint, identity)
+	ds.since[identity] = time.Now().Add(-uptimePeriod)
+	ds.disconnected(endpoint, identity)
+	defer func() {
+		openchainDB := db.GetDBHandle()
+		opt := gorocksdb.NewDefaultWriteOptions()
+		defer opt.Destroy()
+		openchainDB.DB.DeleteCF(opt, openchainDB.PersistCF, []byte(discoveryKeyPrefix+endpoint.Address))
+	}()
+
+	restarted := newDiscoveryStore(true)
+	if err := restarted.load(); err != nil {
+		t.Fatalf("Failed to load discovered peers: %s", err)
+	}
+	var found *pb.DiscoveredPeer
+	for _, dp := range restarted.status() {
+		if dp.Endpoint.Address == endpoint.Address {
+			found = dp
+		}
+	}
+	if found == nil {
+		t.Fatalf("Expected discovered peer to survive a restart")
+	}
+	if found.Connected || found.Connects != 1 || found.Reputation != reputationUptime || found.Endpoint.ID.Name != "vp9" {
+		t.Fatalf("Unexpected record after restart: %v", found)
+	}
+}
+
+func isRecorded(ds *discoveryStore, address string) bool {
+	ds.Lock()
+	defer ds.Unlock()
+	_, ok := ds.peers[address]
+	return ok
+}
+
+func TestDiscoveryStoreCap(t *testing.T) {
+	ds := newDiscoveryStore(false)
+	ds.max = 3
+	endpoint := func(i int) *pb.PeerEndpoint {
+		return &pb.PeerEndpoint{ID: &pb.PeerID{Name: fmt.Sprintf("vp%d", i)}, Address: fmt.Sprintf("vp%d:30303", i)}
+	}
+	ds.connected(endpoint(0), addressIdentity+"vp0:30303")
+	ds.since[addressIdentity+"vp0:30303"] = time.Now().Add(-uptimePeriod)
+	ds.disconnected(endpoint(0), addressIdentity+"vp0:30303")
+	ds.discovered(endpoint(1))
+	ds.discovered(endpoint(2))
+	ds.connectFailed("vp2:30303")
+	ds.peers["vp1:30303"].Discovered = toTimestamp(time.Now().Add(-time.Minute))
+
+	// vp2 failed to connect, so an advertised peer replaces it
+	ds.discovered(endpoint(3))
+	if isRecorded(ds, "vp2:30303") || !isRecorded(ds, "vp3:30303") || len(ds.status()) != 3 {
+		t.Fatalf("Expected vp2 to be evicted for vp3, got %v", ds.status())
+	}
+
+	// vp1 is older than vp3 with the same reputation
+	ds.discovered(endpoint(4))
+	if isRecorded(ds, "vp1:30303") || !isRecorded(ds, "vp4:30303") {
+		t.Fatalf("Expected vp1, heard of least recently, to be evicted for vp4, got %v", ds.status())
+	}
+
+	// Peers we connected to, or are connected to, are not evicted for advertised peers
+	ds.connected(endpoint(3), "")
+	ds.connected(endpoint(4), "")
+	ds.discovered(endpoint(5))
+	if isRecorded(ds, "vp5:30303") || len(ds.status()) != 3 {
+		t.Fatalf("Expected advertised vp5 not to evict better peers, got %v", ds.status())
+	}
+
+	// A peer connecting is recorded anyhow, at the expense of the worst peer not connected
+	ds.connected(endpoint(6), "")
+	if isRecorded(ds, "vp0:30303") || !isRecorded(ds, "vp6:30303") || len(ds.status()) != 3 {
+		t.Fatalf("Expected vp0 to be evicted for connected vp6, got %v", ds.status())
+	}
+}
+
+func TestDiscoveryStoreExpiry(t *testing.T) {
+	ds := newDiscoveryStore(false)
+	ds.maxAge = time.Hour
+	ds.discovered(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp0"}, Address: "vp0:30303"})
+	ds.discovered(&pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}, Address: "vp1:30303"})
+	vp2 := &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp2"}, Address: "vp2:30303"}
+	ds.connected(vp2, "")
+	ds.disconnected(vp2, "")
+
+	old := toTimestamp(time.Now().Add(-2 * time.Hour))
+	ds.peers["vp0:30303"].Discovered = old
+	ds.peers["vp2:30303"].Discovered = old
+	ds.prune()
+	if isRecorded(ds, "vp0:30303") || !isRecorded(ds, "vp1:30303") || !isRecorded(ds, "vp2:30303") {
+		t.Fatalf("Expected only vp0 to expire, got %v", ds.status())
+	}
+
+	ds.peers["vp2:30303"].LastSeen = old
+	ds.prune()
+	if isRecorded(ds, "vp2:30303") {
+		t.Fatalf("Expected vp2, not seen for long, to expire")
+	}
+}
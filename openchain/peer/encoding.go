@@ -0,0 +1,225 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// compressionGzip is the only compression algorithm peers speak so far
+const compressionGzip = "gzip"
+
+// compressions returns the compression algorithms we compress with, by
+// preference. We decompress all of them anyway.
+func compressions() []string {
+	if !viper.GetBool("peer.compression.enabled") {
+		return nil
+	}
+	return []string{compressionGzip}
+}
+
+// maxMessageSize returns the size above which a reassembled or decompressed
+// payload is refused
+func maxMessageSize() int {
+	return viper.GetInt("peer.chunking.maxMessageSize")
+}
+
+func compress(algorithm string, payload []byte) ([]byte, error) {
+	if algorithm != compressionGzip {
+		return nil, fmt.Errorf("Unsupported compression %q", algorithm)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(payload); err != nil {
+		return nil, fmt.Errorf("Error compressing payload: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("Error compressing payload: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(algorithm string, payload []byte) ([]byte, error) {
+	if algorithm != compressionGzip {
+		return nil, fmt.Errorf("Unsupported compression %q", algorithm)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("Error decompressing payload: %s", err)
+	}
+	defer r.Close()
+	var reader io.Reader = r
+	if max := maxMessageSize(); max > 0 {
+		reader = io.LimitReader(r, int64(max)+1)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Error decompressing payload: %s", err)
+	}
+	if max := maxMessageSize(); max > 0 && len(data) > max {
+		return nil, fmt.Errorf("Decompressed payload exceeds %d bytes", max)
+	}
+	return data, nil
+}
+
+// negotiateEncoding picks how we encode the messages we send to the peer,
+// from what it said it decodes in its hello
+func (d *Handler) negotiateEncoding(helloMessage *pb.HelloMessage) {
+	d.chatMutex.Lock()
+	defer d.chatMutex.Unlock()
+	d.compression = ""
+	for _, offered := range helloMessage.Compressions {
+		for _, supported := range compressions() {
+			if offered == supported && d.compression == "" {
+				d.compression = offered
+			}
+		}
+	}
+	d.chunking = helloMessage.Chunking
+	peerLogger.Debug("Sending to %s with compression %q, chunking %v", helloMessage.PeerEndpoint, d.compression, d.chunking)
+}
+
+// encodeMessage compresses the payload of msg with the compression agreed
+// with the peer, if that makes it smaller, and splits it in chunks of
+// peer.chunking.size if the peer reassembles them. msg itself is left alone,
+// as it may be broadcast to other peers. Must be called with chatMutex held.
+func (d *Handler) encodeMessage(msg *pb.OpenchainMessage) ([]*pb.OpenchainMessage, error) {
+	if d.compression != "" && len(msg.Payload) >= viper.GetInt("peer.compression.minSize") {
+		payload, err := compress(d.compression, msg.Payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) < len(msg.Payload) {
+			compressed := *msg
+			compressed.Payload = payload
+			compressed.Compression = d.compression
+			msg = &compressed
+		}
+	}
+	size := viper.GetInt("peer.chunking.size")
+	if !d.chunking || size <= 0 || len(msg.Payload) <= size {
+		return []*pb.OpenchainMessage{msg}, nil
+	}
+	d.chunkID++
+	count := (len(msg.Payload) + size - 1) / size
+	chunks := make([]*pb.OpenchainMessage, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg.Payload) {
+			end = len(msg.Payload)
+		}
+		chunk := &pb.OpenchainMessage{
+			Type:    msg.Type,
+			Payload: msg.Payload[i*size : end],
+			Chunk:   &pb.MessageChunk{Id: d.chunkID, Index: uint32(i), Count: uint32(count)},
+		}
+		if i == 0 {
+			chunk.Timestamp, chunk.Signature, chunk.Compression = msg.Timestamp, msg.Signature, msg.Compression
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// messageDecoder reassembles the chunked messages received on a stream, and
+// decompresses their payloads. It is used by the goroutine receiving from
+// the stream only.
+type messageDecoder struct {
+	pending *pb.OpenchainMessage
+	payload []byte
+}
+
+// decode returns msg as it was before it was encoded for the stream, or nil
+// if msg is a chunk of a message whose other chunks are yet to be received
+func (m *messageDecoder) decode(msg *pb.OpenchainMessage) (*pb.OpenchainMessage, error) {
+	if msg.Chunk != nil {
+		assembled, err := m.reassemble(msg)
+		if err != nil || assembled == nil {
+			return nil, err
+		}
+		msg = assembled
+	}
+	if msg.Compression == "" {
+		return msg, nil
+	}
+	payload, err := decompress(msg.Compression, msg.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding %s: %s", msg.Type, err)
+	}
+	decompressed := *msg
+	decompressed.Payload = payload
+	decompressed.Compression = ""
+	return &decompressed, nil
+}
+
+func (m *messageDecoder) reassemble(msg *pb.OpenchainMessage) (*pb.OpenchainMessage, error) {
+	chunk := msg.Chunk
+	if chunk.Index == 0 {
+		if m.pending != nil {
+			previous := m.pending.Chunk.Id
+			m.reset()
+			return nil, fmt.Errorf("Received the first chunk of message %d before the last chunk of message %d", chunk.Id, previous)
+		}
+		if chunk.Count < 2 {
+			return nil, fmt.Errorf("Received message %d in %d chunks", chunk.Id, chunk.Count)
+		}
+		pending := *msg
+		pending.Payload = nil
+		m.pending = &pending
+	} else if m.pending == nil || chunk.Id != m.pending.Chunk.Id || chunk.Index != m.pending.Chunk.Index+1 || chunk.Count != m.pending.Chunk.Count {
+		m.reset()
+		return nil, fmt.Errorf("Received chunk %d of message %d out of order", chunk.Index, chunk.Id)
+	} else {
+		m.pending.Chunk = chunk
+	}
+	m.payload = append(m.payload, msg.Payload...)
+	if max := maxMessageSize(); max > 0 && len(m.payload) > max {
+		id := chunk.Id
+		m.reset()
+		return nil, fmt.Errorf("Chunked message %d exceeds %d bytes", id, max)
+	}
+	if chunk.Index+1 < chunk.Count {
+		return nil, nil
+	}
+	assembled := m.pending
+	assembled.Payload = m.payload
+	assembled.Chunk = nil
+	m.reset()
+	return assembled, nil
+}
+
+func (m *messageDecoder) reset() {
+	m.pending = nil
+	m.payload = nil
+}
+
+// DecodeMessage returns msg as the peer sent it before it was encoded for
+// the stream, or nil if msg is a chunk of a message still being received
+func (d *Handler) DecodeMessage(msg *pb.OpenchainMessage) (*pb.OpenchainMessage, error) {
+	return d.decoder.decode(msg)
+}
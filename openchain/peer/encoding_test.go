@@ -0,0 +1,127 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/util"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// sendEncoded has d send msg, and returns what it sent to the stream
+func sendEncoded(t *testing.T, d *Handler, msg *pb.OpenchainMessage) []*pb.OpenchainMessage {
+	if err := d.SendMessage(msg); err != nil {
+		t.Fatalf("Error sending message: %s", err)
+	}
+	return d.ChatStream.(*testStream).take()
+}
+
+func TestEncodeDecodeMessage(t *testing.T) {
+	for _, key := range []string{"security.enabled", "peer.compression.enabled", "peer.compression.minSize", "peer.chunking.size", "peer.chunking.maxMessageSize"} {
+		defer viper.Set(key, viper.Get(key))
+	}
+	viper.Set("security.enabled", false)
+	viper.Set("peer.compression.enabled", true)
+	viper.Set("peer.compression.minSize", 10)
+	viper.Set("peer.chunking.size", 300)
+	viper.Set("peer.chunking.maxMessageSize", 2000)
+
+	d := &Handler{ChatStream: &testStream{}}
+	d.negotiateEncoding(&pb.HelloMessage{Compressions: []string{"deflate", compressionGzip}, Chunking: true})
+	if d.compression != compressionGzip || !d.chunking {
+		t.Fatalf("Expected gzip and chunking to be negotiated, got %q and %v", d.compression, d.chunking)
+	}
+
+	// A compressible payload is compressed below the chunk size
+	compressible := &pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_BLOCKS, Payload: bytes.Repeat([]byte("block"), 200), Timestamp: util.CreateUtcTimestamp()}
+	sent := sendEncoded(t, d, compressible)
+	if len(sent) != 1 || sent[0].Compression != compressionGzip || len(sent[0].Payload) >= len(compressible.Payload) {
+		t.Fatalf("Expected the payload to be compressed, sent %d messages", len(sent))
+	}
+	if compressible.Compression != "" {
+		t.Fatalf("Expected the message being sent to be left alone")
+	}
+	decoder := &messageDecoder{}
+	if decoded, err := decoder.decode(sent[0]); err != nil || !proto.Equal(decoded, compressible) {
+		t.Fatalf("Expected the compressed message to be decoded as sent: %v", err)
+	}
+
+	// An incompressible payload is sent as it is, in chunks
+	random := make([]byte, 1000)
+	rand.Read(random)
+	large := &pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_STATE_DELTAS, Payload: random, Timestamp: util.CreateUtcTimestamp(), Signature: []byte("signature")}
+	sent = sendEncoded(t, d, large)
+	if len(sent) != 4 || sent[0].Compression != "" {
+		t.Fatalf("Expected 4 uncompressed chunks, sent %d", len(sent))
+	}
+	for i, chunk := range sent {
+		decoded, err := decoder.decode(chunk)
+		if err != nil {
+			t.Fatalf("Error decoding chunk %d: %s", i, err)
+		}
+		if i < len(sent)-1 && decoded != nil {
+			t.Fatalf("Expected no message before the last chunk, got one after chunk %d", i)
+		}
+		if i == len(sent)-1 && !proto.Equal(decoded, large) {
+			t.Fatalf("Expected the chunks to be reassembled as sent")
+		}
+	}
+
+	// Chunks out of order, and messages above the limit are refused
+	sent = sendEncoded(t, d, large)
+	if _, err := decoder.decode(sent[1]); err == nil {
+		t.Fatalf("Expected a chunk without the previous ones to be refused")
+	}
+	viper.Set("peer.chunking.maxMessageSize", 500)
+	var err error
+	for _, chunk := range sent {
+		if _, err = decoder.decode(chunk); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Fatalf("Expected a message above the limit to be refused")
+	}
+	viper.Set("peer.chunking.maxMessageSize", 2000)
+	if _, err := decoder.decode(sendEncoded(t, d, compressible)[0]); err != nil {
+		t.Fatalf("Expected the decoder to recover after a refused message: %s", err)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	defer viper.Set("peer.compression.enabled", viper.Get("peer.compression.enabled"))
+	viper.Set("peer.compression.enabled", false)
+
+	d := &Handler{ChatStream: &testStream{}}
+	d.negotiateEncoding(&pb.HelloMessage{Compressions: []string{compressionGzip}})
+	if d.compression != "" || d.chunking {
+		t.Fatalf("Expected neither compression nor chunking, got %q and %v", d.compression, d.chunking)
+	}
+	msg := &pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_BLOCKS, Payload: bytes.Repeat([]byte("block"), 1000000)}
+	if sent := sendEncoded(t, d, msg); len(sent) != 1 || sent[0] != msg {
+		t.Fatalf("Expected the message to be sent as it is to a peer which said nothing")
+	}
+}
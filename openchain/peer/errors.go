@@ -31,7 +31,7 @@ type DuplicateHandlerError struct {
 }
 
 func (d *DuplicateHandlerError) Error() string {
-	return fmt.Sprintf("Duplicate Handler error: %s", d.To)
+	return fmt.Sprintf("Duplicate Handler error: %v", d.To)
 }
 
 func newDuplicateHandlerError(msgHandler MessageHandler) error {
@@ -41,3 +41,37 @@ func newDuplicateHandlerError(msgHandler MessageHandler) error {
 	}
 	return &DuplicateHandlerError{To: to}
 }
+
+// DisconnectError is returned by a MessageHandler when the chat with a peer
+// has to end, because a DISC_DISCONNECT was sent to or received from it
+type DisconnectError struct {
+	Reason *pb.DisconnectMessage
+	Remote bool // the peer disconnected from us
+}
+
+func (d *DisconnectError) Error() string {
+	if d.Remote {
+		return fmt.Sprintf("Peer disconnected: %s: %s", d.Reason.Reason, d.Reason.Detail)
+	}
+	return fmt.Sprintf("Disconnecting peer: %s: %s", d.Reason.Reason, d.Reason.Detail)
+}
+
+// Permanent returns whether the peer can never be on our network, in which
+// case reconnecting to it will not help
+func (d *DisconnectError) Permanent() bool {
+	switch d.Reason.Reason {
+	case pb.DisconnectMessage_NETWORK_MISMATCH, pb.DisconnectMessage_GENESIS_MISMATCH, pb.DisconnectMessage_VERSION_MISMATCH:
+		return true
+	}
+	return false
+}
+
+// ConnectionLimitError is returned when registering a handler would exceed
+// the quota of connections for its direction and type of peer
+type ConnectionLimitError struct {
+	Detail string
+}
+
+func (c *ConnectionLimitError) Error() string {
+	return c.Detail
+}
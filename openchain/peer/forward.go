@@ -0,0 +1,234 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	gp "google/protobuf"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// validatorHealth records how forwarding transactions to a validator went
+type validatorHealth struct {
+	address             string
+	forwarded           uint64
+	failed              uint64
+	consecutiveFailures uint64
+	lastSuccess         time.Time
+	lastFailure         time.Time
+	lastError           string
+}
+
+// forwarder tracks the health of the validators a non-validating peer
+// forwards transactions to, by address
+type forwarder struct {
+	sync.Mutex
+	health    map[string]*validatorHealth
+	send      func(address string, transaction *pb.Transaction) (*pb.Response, error) // sends a transaction to the validator at address
+	committed func(uuid string) bool                                                  // whether the transaction is on the chain
+}
+
+func newForwarder() *forwarder {
+	return &forwarder{health: make(map[string]*validatorHealth)}
+}
+
+func (fw *forwarder) get(address string) *validatorHealth {
+	h, ok := fw.health[address]
+	if !ok {
+		h = &validatorHealth{address: address}
+		fw.health[address] = h
+	}
+	return h
+}
+
+// record updates the health of a validator after forwarding to it
+func (fw *forwarder) record(address string, err error) {
+	fw.Lock()
+	defer fw.Unlock()
+	h := fw.get(address)
+	if err != nil {
+		h.failed++
+		h.consecutiveFailures++
+		h.lastFailure = time.Now()
+		h.lastError = err.Error()
+		return
+	}
+	h.forwarded++
+	h.consecutiveFailures = 0
+	h.lastSuccess = time.Now()
+}
+
+// order sorts addresses so that validators with fewer consecutive
+// failures come first
+func (fw *forwarder) order(addresses []string) {
+	fw.Lock()
+	defer fw.Unlock()
+	sort.Stable(byHealth{addresses, fw})
+}
+
+type byHealth struct {
+	addresses []string
+	fw        *forwarder
+}
+
+func (b byHealth) Len() int      { return len(b.addresses) }
+func (b byHealth) Swap(i, j int) { b.addresses[i], b.addresses[j] = b.addresses[j], b.addresses[i] }
+func (b byHealth) Less(i, j int) bool {
+	return b.fw.get(b.addresses[i]).consecutiveFailures < b.fw.get(b.addresses[j]).consecutiveFailures
+}
+
+// validatorAddresses returns the addresses of the root node and of the
+// validators this peer is connected to, healthiest first
+func (p *PeerImpl) validatorAddresses() []string {
+	var addresses []string
+	seen := make(map[string]bool)
+	add := func(address string) {
+		if address != "" && !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	add(getValidatorStreamAddress())
+	var connected []string
+	for _, handler := range p.cloneHandlerMap(pb.PeerEndpoint_VALIDATOR) {
+		if endpoint, err := handler.To(); err == nil {
+			connected = append(connected, endpoint.Address)
+		}
+	}
+	sort.Strings(connected)
+	for _, address := range connected {
+		add(address)
+	}
+	p.forwarder.order(addresses)
+	return addresses
+}
+
+// forwardTransaction sends a transaction to the healthiest validator,
+// failing over to the next one if a validator cannot be reached, for up to
+// peer.forwarding.attempts validators. It returns the response and the
+// address of the validator which accepted the transaction.
+func (p *PeerImpl) forwardTransaction(transaction *pb.Transaction) (*pb.Response, string) {
+	attempts := viper.GetInt("peer.forwarding.attempts")
+	var errs []string
+	for _, address := range p.validatorAddresses() {
+		if len(errs) >= attempts {
+			break
+		}
+		response, err := p.forwarder.send(address, transaction)
+		p.forwarder.record(address, err)
+		if err == nil {
+			return response, address
+		}
+		peerLogger.Warning("Failed forwarding transaction %s to validator %s: %s", transaction.Uuid, address, err)
+		errs = append(errs, err.Error())
+	}
+	if len(errs) == 0 {
+		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte("No validator to forward the transaction to")}, ""
+	}
+	return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Failed forwarding transaction %s: %v", transaction.Uuid, errs))}, ""
+}
+
+// broadcastTransaction sends a transaction to n validators other than the
+// one at address exclude, so that a faulty validator cannot hold it back
+func (p *PeerImpl) broadcastTransaction(transaction *pb.Transaction, n int, exclude string) {
+	var wg sync.WaitGroup
+	for _, address := range p.validatorAddresses() {
+		if n == 0 {
+			break
+		}
+		if address == exclude {
+			continue
+		}
+		n--
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			_, err := p.forwarder.send(address, transaction)
+			p.forwarder.record(address, err)
+			if err != nil {
+				peerLogger.Warning("Failed broadcasting transaction %s to validator %s: %s", transaction.Uuid, address, err)
+			}
+		}(address)
+	}
+	wg.Wait()
+}
+
+// rebroadcastUnlessCommitted sends a forwarded transaction to f+1 more
+// validators if it is not on the chain after peer.forwarding.rebroadcast,
+// in case the validator at address accepted, but then held it back
+func (p *PeerImpl) rebroadcastUnlessCommitted(transaction *pb.Transaction, address string) {
+	time.Sleep(viper.GetDuration("peer.forwarding.rebroadcast"))
+	if p.forwarder.committed(transaction.Uuid) {
+		return
+	}
+	n := p.replyFaults() + 1
+	peerLogger.Warning("Transaction %s not committed yet, sending it to %d more validators", transaction.Uuid, n)
+	p.broadcastTransaction(transaction, n, address)
+}
+
+// isCommitted returns whether the transaction with the given uuid is on the
+// chain of this peer
+func (p *PeerImpl) isCommitted(uuid string) bool {
+	p.ledgerWrapper.RLock()
+	defer p.ledgerWrapper.RUnlock()
+	_, err := p.ledgerWrapper.ledger.GetTransactionByUUID(uuid)
+	return err == nil
+}
+
+func toTimestamp(t time.Time) *gp.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return &gp.Timestamp{Seconds: t.Unix(), Nanos: int32(t.Nanosecond())}
+}
+
+// GetForwardingStatus reports the health of the validators this peer
+// forwarded transactions to
+func (p *PeerImpl) GetForwardingStatus() *pb.ForwardingStatus {
+	p.forwarder.Lock()
+	defer p.forwarder.Unlock()
+	status := &pb.ForwardingStatus{}
+	for _, h := range p.forwarder.health {
+		status.Validators = append(status.Validators, &pb.ValidatorHealth{
+			Address:             h.address,
+			Forwarded:           h.forwarded,
+			Failed:              h.failed,
+			ConsecutiveFailures: h.consecutiveFailures,
+			LastSuccess:         toTimestamp(h.lastSuccess),
+			LastFailure:         toTimestamp(h.lastFailure),
+			LastError:           h.lastError,
+		})
+	}
+	sort.Sort(validatorsByAddress(status.Validators))
+	return status
+}
+
+type validatorsByAddress []*pb.ValidatorHealth
+
+func (v validatorsByAddress) Len() int           { return len(v) }
+func (v validatorsByAddress) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v validatorsByAddress) Less(i, j int) bool { return v[i].Address < v[j].Address }
@@ -0,0 +1,158 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+func TestForwarderOrder(t *testing.T) {
+	p := &PeerImpl{forwarder: newForwarder()}
+	p.forwarder.record("vp0:30303", fmt.Errorf("connection refused"))
+	p.forwarder.record("vp0:30303", fmt.Errorf("connection refused"))
+	p.forwarder.record("vp1:30303", fmt.Errorf("timeout"))
+	p.forwarder.record("vp2:30303", nil)
+
+	addresses := []string{"vp0:30303", "vp1:30303", "vp2:30303", "vp3:30303"}
+	p.forwarder.order(addresses)
+	expected := []string{"vp2:30303", "vp3:30303", "vp1:30303", "vp0:30303"}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("Expected order %v, got %v", expected, addresses)
+	}
+
+	p.forwarder.record("vp0:30303", nil)
+	status := p.GetForwardingStatus()
+	if len(status.Validators) != 4 {
+		t.Fatalf("Expected health of 4 validators, got %d", len(status.Validators))
+	}
+	vp0 := status.Validators[0]
+	if vp0.Address != "vp0:30303" || vp0.Forwarded != 1 || vp0.Failed != 2 || vp0.ConsecutiveFailures != 0 {
+		t.Fatalf("Unexpected health for vp0: %v", vp0)
+	}
+	if vp0.LastError != "connection refused" || vp0.LastSuccess == nil || vp0.LastFailure == nil {
+		t.Fatalf("Unexpected health for vp0: %v", vp0)
+	}
+	if vp3 := status.Validators[3]; vp3.Forwarded != 0 || vp3.LastSuccess != nil {
+		t.Fatalf("Unexpected health for vp3: %v", vp3)
+	}
+}
+
+// forwardTestKeys are the settings the forwarding tests override
+var forwardTestKeys = []string{"peer.validator.enabled", "peer.discovery.rootnode", "peer.forwarding.attempts", "peer.forwarding.rebroadcast", "peer.replies.f"}
+
+// newForwardTestPeer returns a non-validating peer with the root node vp0
+// and connections to the validators vp1 to vp3, which records the addresses
+// transactions are sent to, and fails sending to the addresses in down
+func newForwardTestPeer(down ...string) (*PeerImpl, func() []string) {
+	viper.Set("peer.validator.enabled", false)
+	viper.Set("peer.discovery.rootnode", "vp0:30303")
+	viper.Set("peer.forwarding.attempts", 3)
+	viper.Set("peer.forwarding.rebroadcast", 0)
+	viper.Set("peer.replies.f", "")
+
+	p := &PeerImpl{handlerMap: &handlerMap{m: make(map[pb.PeerID]MessageHandler)}, discovery: newDiscoveryStore(false), forwarder: newForwarder()}
+	for _, name := range []string{"vp1", "vp2", "vp3"} {
+		h := newConnTestHandler(name, pb.PeerEndpoint_VALIDATOR, true)
+		p.handlerMap.m[*h.endpoint.ID] = h
+	}
+	var lock sync.Mutex
+	var sent []string
+	p.forwarder.send = func(address string, transaction *pb.Transaction) (*pb.Response, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		sent = append(sent, address)
+		for _, d := range down {
+			if address == d {
+				return nil, fmt.Errorf("connection refused")
+			}
+		}
+		return &pb.Response{Status: pb.Response_SUCCESS, Msg: []byte(transaction.Uuid)}, nil
+	}
+	p.forwarder.committed = func(uuid string) bool { return false }
+	return p, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), sent...)
+	}
+}
+
+func TestForwarderFailover(t *testing.T) {
+	for _, key := range forwardTestKeys {
+		defer viper.Set(key, viper.Get(key))
+	}
+	p, sent := newForwardTestPeer("vp0:30303", "vp1:30303")
+
+	response, address := p.forwardTransaction(&pb.Transaction{Uuid: "tx1"})
+	if response.Status != pb.Response_SUCCESS || address != "vp2:30303" {
+		t.Fatalf("Expected vp2 to accept the transaction, got %s from %q", response.Status, address)
+	}
+	if expected := []string{"vp0:30303", "vp1:30303", "vp2:30303"}; !reflect.DeepEqual(sent(), expected) {
+		t.Fatalf("Expected the transaction to be sent to %v, got %v", expected, sent())
+	}
+
+	// the failed validators are tried last from now on
+	response, address = p.forwardTransaction(&pb.Transaction{Uuid: "tx2"})
+	if response.Status != pb.Response_SUCCESS || address != "vp2:30303" {
+		t.Fatalf("Expected vp2 to accept the transaction, got %s from %q", response.Status, address)
+	}
+	health := p.forwarder.get("vp0:30303")
+	if health.failed != 1 || health.consecutiveFailures != 1 {
+		t.Fatalf("Expected one failure of vp0, got %+v", health)
+	}
+
+	p, _ = newForwardTestPeer("vp0:30303", "vp1:30303", "vp2:30303", "vp3:30303")
+	response, address = p.forwardTransaction(&pb.Transaction{Uuid: "tx3"})
+	if response.Status != pb.Response_FAILURE || address != "" {
+		t.Fatalf("Expected forwarding to fail after peer.forwarding.attempts validators, got %s from %q", response.Status, address)
+	}
+	if health := p.forwarder.get("vp3:30303"); health.failed != 0 {
+		t.Fatalf("Expected vp3 not to be tried, got %+v", health)
+	}
+}
+
+func TestForwarderRebroadcast(t *testing.T) {
+	for _, key := range forwardTestKeys {
+		defer viper.Set(key, viper.Get(key))
+	}
+	// with one faulty validator, the transaction goes to two more
+	p, sent := newForwardTestPeer()
+	viper.Set("peer.replies.f", "1")
+	p.rebroadcastUnlessCommitted(&pb.Transaction{Uuid: "tx1"}, "vp0:30303")
+	addresses := sent()
+	sort.Strings(addresses)
+	if expected := []string{"vp1:30303", "vp2:30303"}; !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("Expected the transaction to be rebroadcast to %v, got %v", expected, addresses)
+	}
+
+	p, sent = newForwardTestPeer()
+	p.forwarder.committed = func(uuid string) bool { return uuid == "tx1" }
+	p.rebroadcastUnlessCommitted(&pb.Transaction{Uuid: "tx1"}, "vp0:30303")
+	if len(sent()) != 0 {
+		t.Fatalf("Expected a committed transaction not to be rebroadcast, got %v", sent())
+	}
+}
@@ -0,0 +1,498 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	"github.com/hyperledger-incubator/obc-peer/openchain/util"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// gossipLedger is the part of the ledger the block gossip reads the head of
+// the chain from and appends pulled blocks to
+type gossipLedger interface {
+	GetBlockchainInfo() (*pb.BlockchainInfo, error)
+	ApplyStateDelta(id interface{}, delta *statemgmt.StateDelta) error
+	GetTempStateHash() ([]byte, error)
+	CommitStateDelta(id interface{}) error
+	RollbackStateDelta(id interface{}) error
+	PutRawBlock(block *pb.Block, blockNumber uint64) error
+}
+
+// invalidBlocksError is returned when pulled blocks fail verification, as
+// opposed to failing to arrive
+type invalidBlocksError struct {
+	reason string
+}
+
+func (e *invalidBlocksError) Error() string {
+	return e.reason
+}
+
+func newInvalidBlocksError(format string, args ...interface{}) error {
+	return &invalidBlocksError{reason: fmt.Sprintf(format, args...)}
+}
+
+// blockGossip disseminates the blocks committed by the validators among the
+// non-validating peers. A non-validator announces the head of its chain to a
+// few random non-validators whenever the chain grows, and periodically for
+// anti-entropy. A peer which learns of a longer chain pulls the missing
+// blocks from the announcer, one pull at a time, but only up to a block
+// whose hash a validator confirmed: the hash a validator sent with
+// SYNC_BLOCK_ADDED, or else the hash of the block a validator serves.
+type blockGossip struct {
+	sync.Mutex
+	pulling   bool
+	heads     map[pb.PeerID]*pb.BlockchainInfo
+	confirmed *pb.BlockchainInfo
+}
+
+func newBlockGossip() *blockGossip {
+	return &blockGossip{heads: make(map[pb.PeerID]*pb.BlockchainInfo)}
+}
+
+// announced records the head of the chain of a peer
+func (g *blockGossip) announced(id *pb.PeerID, head *pb.BlockchainInfo) {
+	g.Lock()
+	defer g.Unlock()
+	g.heads[*id] = head
+}
+
+// forget drops the head of a peer, e.g. when it disconnected or sent blocks
+// which failed verification
+func (g *blockGossip) forget(id *pb.PeerID) {
+	g.Lock()
+	defer g.Unlock()
+	delete(g.heads, *id)
+}
+
+// tallest returns the peer which announced the longest chain, if it is
+// longer than height
+func (g *blockGossip) tallest(height uint64) (*pb.PeerID, *pb.BlockchainInfo) {
+	g.Lock()
+	defer g.Unlock()
+	var id *pb.PeerID
+	var head *pb.BlockchainInfo
+	for key, h := range g.heads {
+		if h.Height > height && (head == nil || h.Height > head.Height) {
+			k := key
+			id, head = &k, h
+		}
+	}
+	return id, head
+}
+
+// confirm records the head of the chain of a validator, if it is longer than
+// the one recorded
+func (g *blockGossip) confirm(head *pb.BlockchainInfo) {
+	g.Lock()
+	defer g.Unlock()
+	if g.confirmed == nil || head.Height > g.confirmed.Height {
+		g.confirmed = head
+	}
+}
+
+// confirmedHead returns the head a validator confirmed, if it is longer than
+// height and at most max blocks longer
+func (g *blockGossip) confirmedHead(height uint64, max uint64) *pb.BlockchainInfo {
+	g.Lock()
+	defer g.Unlock()
+	if g.confirmed == nil || g.confirmed.Height <= height || g.confirmed.Height > height+max {
+		return nil
+	}
+	return g.confirmed
+}
+
+// startPull returns false if a pull is already running
+func (g *blockGossip) startPull() bool {
+	g.Lock()
+	defer g.Unlock()
+	if g.pulling {
+		return false
+	}
+	g.pulling = true
+	return true
+}
+
+func (g *blockGossip) donePull() {
+	g.Lock()
+	defer g.Unlock()
+	g.pulling = false
+}
+
+// withoutLightPeers returns the handlers of handlers which are not of light
+// peers
+func withoutLightPeers(handlers map[pb.PeerID]MessageHandler) map[pb.PeerID]MessageHandler {
+	filtered := make(map[pb.PeerID]MessageHandler)
+	for key, handler := range handlers {
+		if endpoint, err := handler.To(); err == nil && !endpoint.Light {
+			filtered[key] = handler
+		}
+	}
+	return filtered
+}
+
+// pickGossipTargets returns at most n handlers from handlers other than the
+// one of exclude, picked at random
+func pickGossipTargets(handlers map[pb.PeerID]MessageHandler, exclude *pb.PeerID, n int) map[pb.PeerID]MessageHandler {
+	var keys []pb.PeerID
+	for key := range handlers {
+		if exclude == nil || key != *exclude {
+			keys = append(keys, key)
+		}
+	}
+	targets := make(map[pb.PeerID]MessageHandler)
+	for _, i := range rand.Perm(len(keys)) {
+		if len(targets) >= n {
+			break
+		}
+		targets[keys[i]] = handlers[keys[i]]
+	}
+	return targets
+}
+
+// pullBlocks fetches the blocks following the top of the local chain up to
+// head from remote. head must have been confirmed by a validator. All of the
+// blocks must link to the local chain and up to head by hash before any is
+// appended, an empty chain starting with the genesis block configured in
+// peer.genesisHash, and each block is appended only if applying its state
+// delta yields the state hash in the block. It returns the number of blocks
+// appended. lock guards the ledger.
+func pullBlocks(l gossipLedger, lock sync.Locker, remote RemoteLedger, head *pb.BlockchainInfo, timeout time.Duration) (uint64, error) {
+	if head.CurrentBlockHash == nil {
+		return 0, fmt.Errorf("No hash confirmed for block %d", head.Height-1)
+	}
+	lock.Lock()
+	local, err := l.GetBlockchainInfo()
+	lock.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("Error getting the head of the chain: %s", err)
+	}
+	if head.Height <= local.Height {
+		return 0, nil
+	}
+	syncRange := &pb.SyncBlockRange{Start: local.Height, End: head.Height - 1}
+	var genesisHash []byte
+	if syncRange.Start == 0 {
+		if genesisHash, err = configuredGenesisHash(); err != nil {
+			return 0, err
+		}
+		if len(genesisHash) == 0 {
+			return 0, fmt.Errorf("No genesis hash configured in peer.genesisHash to check block 0 against")
+		}
+	}
+
+	blocksChan, err := remote.RequestBlocks(syncRange)
+	if err != nil {
+		return 0, fmt.Errorf("Error requesting blocks %d-%d: %s", syncRange.Start, syncRange.End, err)
+	}
+	blocks, err := receiveBlocks(blocksChan, syncRange, timeout)
+	if err != nil {
+		return 0, err
+	}
+	previous := local.CurrentBlockHash
+	for i, block := range blocks {
+		if !bytes.Equal(block.PreviousBlockHash, previous) {
+			return 0, newInvalidBlocksError("Block %d does not link to block %d", syncRange.Start+uint64(i), syncRange.Start+uint64(i)-1)
+		}
+		if previous, err = block.GetHash(); err != nil {
+			return 0, newInvalidBlocksError("Error hashing block %d: %s", syncRange.Start+uint64(i), err)
+		}
+		if syncRange.Start+uint64(i) == 0 && !bytes.Equal(previous, genesisHash) {
+			return 0, newInvalidBlocksError("Block 0 is not the genesis block configured in peer.genesisHash")
+		}
+	}
+	if !bytes.Equal(previous, head.CurrentBlockHash) {
+		return 0, newInvalidBlocksError("Block %d does not match the confirmed head of the chain", syncRange.End)
+	}
+
+	deltasChan, err := remote.RequestStateDeltas(syncRange)
+	if err != nil {
+		return 0, fmt.Errorf("Error requesting state deltas %d-%d: %s", syncRange.Start, syncRange.End, err)
+	}
+	var appended uint64
+	for i, block := range blocks {
+		blockNumber := syncRange.Start + uint64(i)
+		delta, err := receiveStateDelta(deltasChan, blockNumber, timeout)
+		if err != nil {
+			return appended, err
+		}
+		lock.Lock()
+		err = appendBlock(l, blockNumber, block, delta)
+		lock.Unlock()
+		if err != nil {
+			return appended, err
+		}
+		appended++
+	}
+	return appended, nil
+}
+
+func receiveBlocks(blocksChan <-chan *pb.SyncBlocks, syncRange *pb.SyncBlockRange, timeout time.Duration) ([]*pb.Block, error) {
+	var blocks []*pb.Block
+	for uint64(len(blocks)) <= syncRange.End-syncRange.Start {
+		next := syncRange.Start + uint64(len(blocks))
+		select {
+		case syncBlocks, ok := <-blocksChan:
+			if !ok {
+				return nil, fmt.Errorf("Block stream closed before block %d", next)
+			}
+			if syncBlocks.Range == nil || syncBlocks.Range.Start != next {
+				return nil, newInvalidBlocksError("Expected block %d, got %v", next, syncBlocks.Range)
+			}
+			blocks = append(blocks, syncBlocks.Blocks...)
+		case <-time.After(timeout):
+			return nil, fmt.Errorf("Timed out waiting for block %d", next)
+		}
+	}
+	return blocks, nil
+}
+
+func receiveStateDelta(deltasChan <-chan *pb.SyncStateDeltas, blockNumber uint64, timeout time.Duration) (*statemgmt.StateDelta, error) {
+	select {
+	case syncStateDeltas, ok := <-deltasChan:
+		if !ok {
+			return nil, fmt.Errorf("State delta stream closed before block %d", blockNumber)
+		}
+		if syncStateDeltas.Range == nil || syncStateDeltas.Range.Start != blockNumber || len(syncStateDeltas.Deltas) != 1 {
+			return nil, newInvalidBlocksError("Expected the state delta of block %d, got %v", blockNumber, syncStateDeltas.Range)
+		}
+		delta := statemgmt.NewStateDelta()
+		if err := delta.Unmarshal(syncStateDeltas.Deltas[0]); err != nil {
+			return nil, newInvalidBlocksError("Error unmarshalling the state delta of block %d: %s", blockNumber, err)
+		}
+		return delta, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("Timed out waiting for the state delta of block %d", blockNumber)
+	}
+}
+
+// appendBlock applies the state delta of a block and appends the block to
+// the chain, if the resulting state hash is the one in the block
+func appendBlock(l gossipLedger, blockNumber uint64, block *pb.Block, delta *statemgmt.StateDelta) error {
+	if err := l.ApplyStateDelta(blockNumber, delta); err != nil {
+		return fmt.Errorf("Error applying the state delta of block %d: %s", blockNumber, err)
+	}
+	stateHash, err := l.GetTempStateHash()
+	if err != nil {
+		l.RollbackStateDelta(blockNumber)
+		return fmt.Errorf("Error computing the state hash of block %d: %s", blockNumber, err)
+	}
+	if !bytes.Equal(stateHash, block.StateHash) {
+		l.RollbackStateDelta(blockNumber)
+		return newInvalidBlocksError("The state delta of block %d yields state hash %x instead of %x", blockNumber, stateHash, block.StateHash)
+	}
+	if err := l.CommitStateDelta(blockNumber); err != nil {
+		return fmt.Errorf("Error committing the state delta of block %d: %s", blockNumber, err)
+	}
+	if err := l.PutRawBlock(block, blockNumber); err != nil {
+		return fmt.Errorf("Error appending block %d: %s", blockNumber, err)
+	}
+	return nil
+}
+
+// gossipEnabled reports whether this peer takes part in the block gossip,
+// validators do not as they commit blocks through consensus, nor do light
+// peers as they hold no blocks
+func gossipEnabled() bool {
+	return viper.GetBool("peer.gossip.enabled") && !viper.GetBool("peer.validator.enabled") && !lightEnabled()
+}
+
+// chainHead returns the head of the local chain
+func (p *PeerImpl) chainHead() (*pb.BlockchainInfo, error) {
+	p.ledgerWrapper.RLock()
+	defer p.ledgerWrapper.RUnlock()
+	return p.ledgerWrapper.ledger.GetBlockchainInfo()
+}
+
+// BlockHeadReceived is called when a peer announced the head of its chain.
+// A longer chain is pulled from the peer, and a non-validator with a
+// shorter one is told our head so that it can pull from us. The head of a
+// validator confirms the hash of its top block. A light peer syncs the
+// headers of a longer chain instead.
+func (p *PeerImpl) BlockHeadReceived(head *pb.BlockchainInfo, from *pb.PeerEndpoint) error {
+	if p.light != nil {
+		if head.Height > p.light.height() {
+			p.gossip.announced(from.ID, head)
+			go p.syncLightHeaders()
+		}
+		return nil
+	}
+	if !gossipEnabled() {
+		return nil
+	}
+	local, err := p.chainHead()
+	if err != nil {
+		return fmt.Errorf("Error getting the head of the chain: %s", err)
+	}
+	if from.Type == pb.PeerEndpoint_VALIDATOR && head.CurrentBlockHash != nil {
+		p.gossip.confirm(head)
+	}
+	if head.Height > local.Height {
+		p.gossip.announced(from.ID, head)
+		go p.pullBlocks()
+	} else if head.Height < local.Height && from.Type == pb.PeerEndpoint_NON_VALIDATOR {
+		p.gossip.announced(from.ID, head)
+		p.pushHead(local, map[pb.PeerID]MessageHandler{*from.ID: p.handlerFor(from.ID)})
+	}
+	return nil
+}
+
+func (p *PeerImpl) handlerFor(id *pb.PeerID) MessageHandler {
+	p.handlerMap.RLock()
+	defer p.handlerMap.RUnlock()
+	return p.handlerMap.m[*id]
+}
+
+// pushHead announces the head of the local chain to handlers, but for those
+// whose peers are too old to take announcements
+func (p *PeerImpl) pushHead(head *pb.BlockchainInfo, handlers map[pb.PeerID]MessageHandler) {
+	payload, err := proto.Marshal(head)
+	if err != nil {
+		peerLogger.Error("Error marshalling the head of the chain: %s", err)
+		return
+	}
+	msg := &pb.OpenchainMessage{Type: pb.OpenchainMessage_GOSSIP_BLOCK_HEADER, Payload: payload, Timestamp: util.CreateUtcTimestamp()}
+	for _, handler := range speakingHandlers(handlers, pb.OpenchainMessage_GOSSIP_BLOCK_HEADER) {
+		if err := handler.SendMessage(msg); err != nil {
+			peerLogger.Debug("Error announcing block %d: %s", head.Height-1, err)
+		}
+	}
+}
+
+// relayHead announces the head of the local chain to peer.gossip.fanout
+// random non-validators other than exclude, which take announcements
+func (p *PeerImpl) relayHead(exclude *pb.PeerID) {
+	head, err := p.chainHead()
+	if err != nil {
+		peerLogger.Error("Error getting the head of the chain: %s", err)
+		return
+	}
+	handlers := speakingHandlers(p.cloneHandlerMap(pb.PeerEndpoint_NON_VALIDATOR), pb.OpenchainMessage_GOSSIP_BLOCK_HEADER)
+	p.pushHead(head, pickGossipTargets(handlers, exclude, viper.GetInt("peer.gossip.fanout")))
+}
+
+// confirmedHead returns a head at most max blocks above height and at most
+// as high as head, whose hash a validator confirmed. Unless a validator
+// announced one, the top block is fetched from a connected validator.
+func (p *PeerImpl) confirmedHead(height uint64, head *pb.BlockchainInfo, max uint64) (*pb.BlockchainInfo, error) {
+	if max < 1 {
+		max = 1
+	}
+	if confirmed := p.gossip.confirmedHead(height, max); confirmed != nil && confirmed.Height <= head.Height {
+		return confirmed, nil
+	}
+	top := head.Height - 1
+	if top-height >= max {
+		top = height + max - 1
+	}
+	for id := range pickGossipTargets(p.cloneHandlerMap(pb.PeerEndpoint_VALIDATOR), nil, 1) {
+		validator, err := p.GetRemoteLedger(&id)
+		if err != nil {
+			return nil, err
+		}
+		syncRange := &pb.SyncBlockRange{Start: top, End: top}
+		blocksChan, err := validator.RequestBlocks(syncRange)
+		if err != nil {
+			return nil, fmt.Errorf("Error requesting block %d from validator %s: %s", top, id.Name, err)
+		}
+		blocks, err := receiveBlocks(blocksChan, syncRange, viper.GetDuration("peer.gossip.timeout"))
+		if err != nil {
+			return nil, fmt.Errorf("Error receiving block %d from validator %s: %s", top, id.Name, err)
+		}
+		hash, err := blocks[0].GetHash()
+		if err != nil {
+			return nil, fmt.Errorf("Error hashing block %d: %s", top, err)
+		}
+		return &pb.BlockchainInfo{Height: top + 1, CurrentBlockHash: hash, PreviousBlockHash: blocks[0].PreviousBlockHash}, nil
+	}
+	return nil, fmt.Errorf("No validator connected to confirm block %d", top)
+}
+
+// pullBlocks pulls blocks from the peer with the longest chain, as long as
+// there is one longer than the local chain
+func (p *PeerImpl) pullBlocks() {
+	if !p.gossip.startPull() {
+		return
+	}
+	defer p.gossip.donePull()
+	for {
+		local, err := p.chainHead()
+		if err != nil {
+			peerLogger.Error("Error getting the head of the chain: %s", err)
+			return
+		}
+		id, head := p.gossip.tallest(local.Height)
+		if id == nil {
+			return
+		}
+		remote, err := p.GetRemoteLedger(id)
+		if err != nil {
+			p.gossip.forget(id)
+			continue
+		}
+		confirmed, err := p.confirmedHead(local.Height, head, uint64(viper.GetInt("peer.gossip.maxPull")))
+		if err != nil {
+			peerLogger.Warning("Not pulling blocks from %s: %s", id, err)
+			return
+		}
+		appended, err := pullBlocks(p.ledgerWrapper.ledger, p.ledgerWrapper, remote, confirmed, viper.GetDuration("peer.gossip.timeout"))
+		if appended > 0 {
+			peerLogger.Debug("Appended %d blocks pulled from %s", appended, id)
+			p.relayHead(id)
+		}
+		if err == nil && appended == 0 {
+			p.gossip.forget(id)
+		} else if err != nil {
+			peerLogger.Warning("Failed pulling blocks from %s: %s", id, err)
+			p.gossip.forget(id)
+			if _, ok := err.(*invalidBlocksError); ok {
+				if handler := p.handlerFor(id); handler != nil {
+					p.protocolError(handler)
+				}
+			}
+		}
+	}
+}
+
+// gossipBlocks periodically announces the head of the local chain to a few
+// non-validators, and catches up with the longest chain announced, so that
+// peers which missed an announcement do not fall behind
+func (p *PeerImpl) gossipBlocks() {
+	period := viper.GetDuration("peer.gossip.period")
+	if period <= 0 {
+		peerLogger.Debug("Not gossiping the head of the chain periodically")
+		return
+	}
+	for {
+		time.Sleep(period)
+		p.relayHead(nil)
+		go p.pullBlocks()
+	}
+}
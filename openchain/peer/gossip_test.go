@@ -0,0 +1,401 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// gossipTestLedger is an in memory chain whose state hash chains the hashes
+// of the applied state deltas
+type gossipTestLedger struct {
+	blocks  []*pb.Block
+	deltas  []*statemgmt.StateDelta
+	state   []byte
+	pending []byte
+}
+
+func nextStateHash(state []byte, delta *statemgmt.StateDelta) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, state...), delta.ComputeCryptoHash()...))
+	return hash[:]
+}
+
+func newGossipTestLedger(height int) *gossipTestLedger {
+	l := &gossipTestLedger{}
+	for len(l.blocks) < height {
+		delta := statemgmt.NewStateDelta()
+		delta.Set("chaincode", fmt.Sprintf("key%d", len(l.blocks)), []byte("value"), nil)
+		var previous []byte
+		if len(l.blocks) > 0 {
+			previous, _ = l.blocks[len(l.blocks)-1].GetHash()
+		}
+		l.state = nextStateHash(l.state, delta)
+		l.blocks = append(l.blocks, &pb.Block{Version: pb.BlockVersion, PreviousBlockHash: previous, StateHash: l.state})
+		l.deltas = append(l.deltas, delta)
+	}
+	return l
+}
+
+// prefix returns a copy of the first height blocks of the chain
+func (l *gossipTestLedger) prefix(height int) *gossipTestLedger {
+	prefix := &gossipTestLedger{
+		blocks: append([]*pb.Block{}, l.blocks[:height]...),
+		deltas: append([]*statemgmt.StateDelta{}, l.deltas[:height]...),
+	}
+	if height > 0 {
+		prefix.state = l.blocks[height-1].StateHash
+	}
+	return prefix
+}
+
+func (l *gossipTestLedger) GetBlockchainInfo() (*pb.BlockchainInfo, error) {
+	if len(l.blocks) == 0 {
+		return &pb.BlockchainInfo{Height: 0}, nil
+	}
+	top := l.blocks[len(l.blocks)-1]
+	hash, err := top.GetHash()
+	return &pb.BlockchainInfo{Height: uint64(len(l.blocks)), CurrentBlockHash: hash, PreviousBlockHash: top.PreviousBlockHash}, err
+}
+
+func (l *gossipTestLedger) ApplyStateDelta(id interface{}, delta *statemgmt.StateDelta) error {
+	if l.pending != nil {
+		return fmt.Errorf("A state delta is already applied")
+	}
+	l.pending = nextStateHash(l.state, delta)
+	return nil
+}
+
+func (l *gossipTestLedger) GetTempStateHash() ([]byte, error) {
+	if l.pending != nil {
+		return l.pending, nil
+	}
+	return l.state, nil
+}
+
+func (l *gossipTestLedger) CommitStateDelta(id interface{}) error {
+	l.state, l.pending = l.pending, nil
+	return nil
+}
+
+func (l *gossipTestLedger) RollbackStateDelta(id interface{}) error {
+	l.pending = nil
+	return nil
+}
+
+func (l *gossipTestLedger) PutRawBlock(block *pb.Block, blockNumber uint64) error {
+	if blockNumber != uint64(len(l.blocks)) {
+		return fmt.Errorf("Expected block %d, got %d", len(l.blocks), blockNumber)
+	}
+	l.blocks = append(l.blocks, block)
+	return nil
+}
+
+// gossipTestRemote serves the blocks and state deltas of a chain, the
+// deltas as modified by delta
+type gossipTestRemote struct {
+	RemoteLedger
+	source *gossipTestLedger
+	delta  func(blockNumber uint64, delta *statemgmt.StateDelta) *statemgmt.StateDelta
+	silent bool
+}
+
+func (r *gossipTestRemote) RequestBlocks(syncRange *pb.SyncBlockRange) (<-chan *pb.SyncBlocks, error) {
+	ch := make(chan *pb.SyncBlocks, syncRange.End-syncRange.Start+1)
+	for i := syncRange.Start; i <= syncRange.End && !r.silent; i++ {
+		ch <- &pb.SyncBlocks{Range: &pb.SyncBlockRange{Start: i, End: i}, Blocks: []*pb.Block{r.source.blocks[i]}}
+	}
+	return ch, nil
+}
+
+func (r *gossipTestRemote) RequestStateDeltas(syncRange *pb.SyncBlockRange) (<-chan *pb.SyncStateDeltas, error) {
+	ch := make(chan *pb.SyncStateDeltas, syncRange.End-syncRange.Start+1)
+	for i := syncRange.Start; i <= syncRange.End && !r.silent; i++ {
+		delta := r.source.deltas[i]
+		if r.delta != nil {
+			delta = r.delta(i, delta)
+		}
+		ch <- &pb.SyncStateDeltas{Range: &pb.SyncBlockRange{Start: i, End: i}, Deltas: [][]byte{delta.Marshal()}}
+	}
+	return ch, nil
+}
+
+func TestGossipPullBlocks(t *testing.T) {
+	source := newGossipTestLedger(10)
+	head, _ := source.GetBlockchainInfo()
+	local := source.prefix(3)
+	remote := &gossipTestRemote{source: source}
+
+	for _, c := range []struct{ height, expected int }{{7, 4}, {10, 3}, {10, 0}} {
+		confirmed, _ := source.prefix(c.height).GetBlockchainInfo()
+		appended, err := pullBlocks(local, &sync.Mutex{}, remote, confirmed, time.Second)
+		if err != nil {
+			t.Fatalf("Error pulling blocks: %s", err)
+		}
+		if appended != uint64(c.expected) {
+			t.Fatalf("Expected %d blocks to be appended, got %d", c.expected, appended)
+		}
+	}
+	info, _ := local.GetBlockchainInfo()
+	if info.Height != head.Height || !bytes.Equal(info.CurrentBlockHash, head.CurrentBlockHash) || !bytes.Equal(local.state, source.state) {
+		t.Fatalf("Expected the chain to be caught up with %v, got %v", head, info)
+	}
+}
+
+func TestGossipPullEmptyChain(t *testing.T) {
+	defer viper.Set("peer.genesisHash", viper.GetString("peer.genesisHash"))
+	source := newGossipTestLedger(5)
+	head, _ := source.GetBlockchainInfo()
+	genesisHash, _ := source.blocks[0].GetHash()
+
+	for _, c := range []struct {
+		genesisHash string
+		invalid     bool
+	}{
+		{"", false},
+		{hex.EncodeToString([]byte("another genesis")), true},
+	} {
+		viper.Set("peer.genesisHash", c.genesisHash)
+		local := source.prefix(0)
+		appended, err := pullBlocks(local, &sync.Mutex{}, &gossipTestRemote{source: source}, head, time.Second)
+		if _, invalid := err.(*invalidBlocksError); err == nil || invalid != c.invalid {
+			t.Fatalf("Expected block 0 to be refused without the configured genesis hash %q, invalid %v, got %v", c.genesisHash, c.invalid, err)
+		}
+		if appended != 0 || len(local.blocks) != 0 {
+			t.Fatalf("Expected no block to be appended without the configured genesis block")
+		}
+	}
+
+	viper.Set("peer.genesisHash", hex.EncodeToString(genesisHash))
+	local := source.prefix(0)
+	appended, err := pullBlocks(local, &sync.Mutex{}, &gossipTestRemote{source: source}, head, time.Second)
+	if err != nil {
+		t.Fatalf("Error pulling blocks: %s", err)
+	}
+	if appended != 5 || !bytes.Equal(local.state, source.state) {
+		t.Fatalf("Expected an empty chain to pull all 5 blocks, got %d", appended)
+	}
+}
+
+func TestGossipPullRequiresConfirmedHead(t *testing.T) {
+	source := newGossipTestLedger(5)
+	local := source.prefix(3)
+	head := &pb.BlockchainInfo{Height: 5}
+
+	if _, err := pullBlocks(local, &sync.Mutex{}, &gossipTestRemote{source: source}, head, time.Second); err == nil {
+		t.Fatalf("Expected a head without a confirmed hash not to be pulled")
+	}
+	if len(local.blocks) != 3 {
+		t.Fatalf("Expected no block to be appended")
+	}
+}
+
+func TestGossipPullRejectsUnlinkedBlock(t *testing.T) {
+	source := newGossipTestLedger(10)
+	local := source.prefix(3)
+	forged := *source.blocks[6]
+	forged.PreviousBlockHash = []byte("forged")
+	head, _ := source.GetBlockchainInfo()
+	source.blocks[6] = &forged
+
+	appended, err := pullBlocks(local, &sync.Mutex{}, &gossipTestRemote{source: source}, head, time.Second)
+	if _, ok := err.(*invalidBlocksError); !ok {
+		t.Fatalf("Expected the blocks to fail verification, got %v", err)
+	}
+	if appended != 0 || len(local.blocks) != 3 {
+		t.Fatalf("Expected no block to be appended before all are verified, got %d", len(local.blocks)-3)
+	}
+}
+
+func TestGossipPullRejectsBadStateDelta(t *testing.T) {
+	source := newGossipTestLedger(10)
+	local := source.prefix(3)
+	head, _ := source.GetBlockchainInfo()
+	remote := &gossipTestRemote{source: source, delta: func(blockNumber uint64, delta *statemgmt.StateDelta) *statemgmt.StateDelta {
+		if blockNumber != 5 {
+			return delta
+		}
+		forged := statemgmt.NewStateDelta()
+		forged.Set("chaincode", "key5", []byte("forged"), nil)
+		return forged
+	}}
+
+	appended, err := pullBlocks(local, &sync.Mutex{}, remote, head, time.Second)
+	if _, ok := err.(*invalidBlocksError); !ok {
+		t.Fatalf("Expected the state delta to fail verification, got %v", err)
+	}
+	if appended != 2 || len(local.blocks) != 5 {
+		t.Fatalf("Expected the blocks before the forged delta to be appended, got %d", appended)
+	}
+	if local.pending != nil || !bytes.Equal(local.state, source.blocks[4].StateHash) {
+		t.Fatalf("Expected the forged state delta to be rolled back")
+	}
+}
+
+func TestGossipPullRejectsMismatchedHead(t *testing.T) {
+	source := newGossipTestLedger(5)
+	local := source.prefix(3)
+	head := &pb.BlockchainInfo{Height: 5, CurrentBlockHash: []byte("another chain")}
+
+	if _, err := pullBlocks(local, &sync.Mutex{}, &gossipTestRemote{source: source}, head, time.Second); err == nil {
+		t.Fatalf("Expected blocks not leading to the announced head to be rejected")
+	}
+	if len(local.blocks) != 3 {
+		t.Fatalf("Expected no block to be appended")
+	}
+}
+
+func TestGossipPullTimeout(t *testing.T) {
+	source := newGossipTestLedger(5)
+	local := source.prefix(3)
+	head, _ := source.GetBlockchainInfo()
+
+	_, err := pullBlocks(local, &sync.Mutex{}, &gossipTestRemote{source: source, silent: true}, head, 10*time.Millisecond)
+	if err == nil {
+		t.Fatalf("Expected the pull to time out")
+	}
+	if _, ok := err.(*invalidBlocksError); ok {
+		t.Fatalf("Expected a timeout not to count as invalid blocks")
+	}
+}
+
+func TestPickGossipTargets(t *testing.T) {
+	handlers := make(map[pb.PeerID]MessageHandler)
+	for i := 0; i < 10; i++ {
+		handlers[pb.PeerID{Name: fmt.Sprintf("nvp%d", i)}] = nil
+	}
+	exclude := &pb.PeerID{Name: "nvp0"}
+	for _, n := range []int{3, 20} {
+		targets := pickGossipTargets(handlers, exclude, n)
+		expected := n
+		if expected > 9 {
+			expected = 9
+		}
+		if len(targets) != expected {
+			t.Fatalf("Expected %d targets, got %d", expected, len(targets))
+		}
+		if _, ok := targets[*exclude]; ok {
+			t.Fatalf("Expected %s to be excluded", exclude.Name)
+		}
+	}
+}
+
+func TestWithoutLightPeers(t *testing.T) {
+	handlers := make(map[pb.PeerID]MessageHandler)
+	for i, light := range []bool{false, true, false} {
+		h := newConnTestHandler(fmt.Sprintf("nvp%d", i), pb.PeerEndpoint_NON_VALIDATOR, false)
+		h.endpoint.Light = light
+		handlers[*h.endpoint.ID] = h
+	}
+	filtered := withoutLightPeers(handlers)
+	if _, ok := filtered[pb.PeerID{Name: "nvp1"}]; ok || len(filtered) != 2 {
+		t.Fatalf("Expected the light peer nvp1 to be left out, got %v", filtered)
+	}
+}
+
+func TestBlockGossipHeads(t *testing.T) {
+	g := newBlockGossip()
+	g.announced(&pb.PeerID{Name: "nvp0"}, &pb.BlockchainInfo{Height: 5})
+	g.announced(&pb.PeerID{Name: "nvp1"}, &pb.BlockchainInfo{Height: 8})
+	g.announced(&pb.PeerID{Name: "nvp2"}, &pb.BlockchainInfo{Height: 3})
+
+	if id, head := g.tallest(4); id == nil || id.Name != "nvp1" || head.Height != 8 {
+		t.Fatalf("Expected nvp1 to have the longest chain, got %v", id)
+	}
+	g.forget(&pb.PeerID{Name: "nvp1"})
+	if id, _ := g.tallest(4); id == nil || id.Name != "nvp0" {
+		t.Fatalf("Expected nvp0 to have the longest chain, got %v", id)
+	}
+	if id, _ := g.tallest(5); id != nil {
+		t.Fatalf("Expected no chain longer than 5, got %v", id)
+	}
+
+	if g.confirmedHead(4, 10) != nil {
+		t.Fatalf("Expected no confirmed head before a validator announced one")
+	}
+	g.confirm(&pb.BlockchainInfo{Height: 8, CurrentBlockHash: []byte("hash 7")})
+	g.confirm(&pb.BlockchainInfo{Height: 6, CurrentBlockHash: []byte("hash 5")})
+	if confirmed := g.confirmedHead(4, 10); confirmed == nil || confirmed.Height != 8 {
+		t.Fatalf("Expected the longest confirmed head, got %v", confirmed)
+	}
+	if g.confirmedHead(4, 3) != nil || g.confirmedHead(8, 10) != nil {
+		t.Fatalf("Expected no confirmed head beyond the pull nor below the chain")
+	}
+
+	if !g.startPull() || g.startPull() {
+		t.Fatalf("Expected one pull at a time")
+	}
+	g.donePull()
+	if !g.startPull() {
+		t.Fatalf("Expected a pull to start after the previous one is done")
+	}
+}
+
+func TestHandlerBlockAdded(t *testing.T) {
+	blockState := &pb.BlockState{Block: &pb.Block{PreviousBlockHash: []byte("hash 4")}, BlockNumber: 5, BlockHash: []byte("hash 5")}
+	payload, _ := proto.Marshal(blockState)
+	msg := &pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_BLOCK_ADDED, Payload: payload}
+
+	d, coord, _ := newTestHandler(t, "nvp1", false)
+	defer d.Stop()
+	if err := d.HandleMessage(mustHello(t, "nvp2")); err != nil {
+		t.Fatalf("Error handling the hello of nvp2: %s", err)
+	}
+	if err := d.HandleMessage(msg); err == nil || len(coord.heads) != 0 {
+		t.Fatalf("Expected a block announced by a non-validator to be refused")
+	}
+
+	// Without security nor an allow list, vp1 cannot prove it is a
+	// validator, and is only trusted when unproven validators are
+	defer viper.Set("peer.validators.unproven", viper.Get("peer.validators.unproven"))
+	viper.Set("peer.validators.unproven", "downgrade")
+	d, coord, _ = newTestHandler(t, "nvp1", false)
+	defer d.Stop()
+	if err := d.HandleMessage(mustHello(t, "vp1")); err != nil {
+		t.Fatalf("Error handling the hello of vp1: %s", err)
+	}
+	if err := d.HandleMessage(msg); err == nil || len(coord.heads) != 0 {
+		t.Fatalf("Expected a block announced by an unproven validator to be refused")
+	}
+
+	viper.Set("peer.validators.unproven", "trust")
+	d, coord, _ = newTestHandler(t, "nvp1", false)
+	defer d.Stop()
+	if err := d.HandleMessage(mustHello(t, "vp1")); err != nil {
+		t.Fatalf("Error handling the hello of vp1: %s", err)
+	}
+	if err := d.HandleMessage(msg); err != nil {
+		t.Fatalf("Error handling the block announced by vp1: %s", err)
+	}
+	if len(coord.heads) != 1 || coord.heads[0].Height != 6 || !bytes.Equal(coord.heads[0].CurrentBlockHash, blockState.BlockHash) {
+		t.Fatalf("Expected the head announced by vp1 to carry the hash of its block, got %v", coord.heads)
+	}
+}
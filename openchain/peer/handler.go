@@ -20,6 +20,7 @@ under the License.
 package peer
 
 import (
+	"bytes"
 	"fmt"
 	"sync"
 	"time"
@@ -42,10 +43,26 @@ type Handler struct {
 	FSM                           *fsm.FSM
 	initiatedStream               bool // Was the stream initiated within this Peer
 	registered                    bool
-	syncBlocksMutex               sync.Mutex
-	syncBlocks                    chan *pb.SyncBlocks
+	protocolVersion               string // negotiated in the hello exchange
+	nonce                         []byte // challenge sent to the peer in our hello
+	remoteNonce                   []byte // challenge received in the hello of the peer
+	authenticated                 bool   // the peer answered our challenge
+	syncCredits                   *syncCredits
+	syncBlocksRequestHandler      *syncBlocksRequestHandler
 	snapshotRequestHandler        *syncStateSnapshotRequestHandler
+	chunkRequestHandler           *syncStateChunkRequestHandler
+	chunkSnapshots                *pinnedSnapshots // the state snapshots the peer syncs chunks of
 	syncStateDeltasRequestHandler *syncStateDeltasHandler
+	headersRequestHandler         *syncBlockHeadersRequestHandler
+	txProofRequestHandler         *syncTransactionProofRequestHandler
+	certRequestHandler            *syncCheckpointCertificateRequestHandler
+	lastReceived                  int64 // unix nanoseconds, accessed atomically
+	closed                        chan struct{}
+	closeOnce                     sync.Once
+	compression                   string // used on the messages we send, negotiated in the hello exchange
+	chunking                      bool   // the peer reassembles chunked messages
+	chunkID                       uint64
+	decoder                       messageDecoder
 }
 
 // NewPeerHandler returns a new Peer handler
@@ -58,13 +75,30 @@ func NewPeerHandler(coord MessageHandlerCoordinator, stream ChatStream, initiate
 		Coordinator:     coord,
 	}
 	d.doneChan = make(chan struct{})
+	d.closed = make(chan struct{})
+	d.touch()
 
+	d.syncCredits = newSyncCredits()
+	d.syncBlocksRequestHandler = newSyncBlocksRequestHandler()
 	d.snapshotRequestHandler = newSyncStateSnapshotRequestHandler()
+	d.chunkRequestHandler = newSyncStateChunkRequestHandler()
+	d.chunkSnapshots = newPinnedSnapshots(func() (chunkSnapshot, error) {
+		snapshot, err := coord.GetStateSnapshot()
+		if err != nil {
+			return nil, err
+		}
+		return snapshot, nil
+	}, viper.GetDuration("peer.sync.state.chunks.pinTimeout"))
 	d.syncStateDeltasRequestHandler = newSyncStateDeltasHandler()
+	d.headersRequestHandler = newSyncBlockHeadersRequestHandler()
+	d.txProofRequestHandler = newSyncTransactionProofRequestHandler()
+	d.certRequestHandler = newSyncCheckpointCertificateRequestHandler()
 	d.FSM = fsm.NewFSM(
 		"created",
 		fsm.Events{
 			{Name: pb.OpenchainMessage_DISC_HELLO.String(), Src: []string{"created"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_DISC_DISCONNECT.String(), Src: []string{"created", "established"}, Dst: "disconnected"},
+			{Name: pb.OpenchainMessage_DISC_AUTH.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.OpenchainMessage_DISC_GET_PEERS.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.OpenchainMessage_DISC_PEERS.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.OpenchainMessage_SYNC_BLOCK_ADDED.String(), Src: []string{"established"}, Dst: "established"},
@@ -72,12 +106,27 @@ func NewPeerHandler(coord MessageHandlerCoordinator, stream ChatStream, initiate
 			{Name: pb.OpenchainMessage_SYNC_BLOCKS.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.OpenchainMessage_SYNC_STATE_GET_SNAPSHOT.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.OpenchainMessage_SYNC_STATE_SNAPSHOT.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_SYNC_STATE_GET_CHUNK.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_SYNC_STATE_CHUNK.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.OpenchainMessage_SYNC_STATE_GET_DELTAS.String(), Src: []string{"established"}, Dst: "established"},
 			{Name: pb.OpenchainMessage_SYNC_STATE_DELTAS.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_SYNC_CREDIT.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_GOSSIP_BLOCK_HEADER.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_SYNC_GET_BLOCK_HEADERS.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_SYNC_BLOCK_HEADERS.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_SYNC_GET_TRANSACTION_PROOF.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_SYNC_TRANSACTION_PROOF.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_SYNC_GET_CHECKPOINT_CERTIFICATE.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_SYNC_CHECKPOINT_CERTIFICATE.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_DISC_PING.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_DISC_PONG.String(), Src: []string{"established"}, Dst: "established"},
+			{Name: pb.OpenchainMessage_CHAIN_REPLY.String(), Src: []string{"established"}, Dst: "established"},
 		},
 		fsm.Callbacks{
 			"enter_state":                                                    func(e *fsm.Event) { d.enterState(e) },
 			"before_" + pb.OpenchainMessage_DISC_HELLO.String():              func(e *fsm.Event) { d.beforeHello(e) },
+			"before_" + pb.OpenchainMessage_DISC_DISCONNECT.String():         func(e *fsm.Event) { d.beforeDisconnect(e) },
+			"before_" + pb.OpenchainMessage_DISC_AUTH.String():               func(e *fsm.Event) { d.beforeAuth(e) },
 			"before_" + pb.OpenchainMessage_DISC_GET_PEERS.String():          func(e *fsm.Event) { d.beforeGetPeers(e) },
 			"before_" + pb.OpenchainMessage_DISC_PEERS.String():              func(e *fsm.Event) { d.beforePeers(e) },
 			"before_" + pb.OpenchainMessage_SYNC_BLOCK_ADDED.String():        func(e *fsm.Event) { d.beforeBlockAdded(e) },
@@ -85,19 +134,27 @@ func NewPeerHandler(coord MessageHandlerCoordinator, stream ChatStream, initiate
 			"before_" + pb.OpenchainMessage_SYNC_BLOCKS.String():             func(e *fsm.Event) { d.beforeSyncBlocks(e) },
 			"before_" + pb.OpenchainMessage_SYNC_STATE_GET_SNAPSHOT.String(): func(e *fsm.Event) { d.beforeSyncStateGetSnapshot(e) },
 			"before_" + pb.OpenchainMessage_SYNC_STATE_SNAPSHOT.String():     func(e *fsm.Event) { d.beforeSyncStateSnapshot(e) },
+			"before_" + pb.OpenchainMessage_SYNC_STATE_GET_CHUNK.String():    func(e *fsm.Event) { d.beforeSyncStateGetChunk(e) },
+			"before_" + pb.OpenchainMessage_SYNC_STATE_CHUNK.String():        func(e *fsm.Event) { d.beforeSyncStateChunk(e) },
 			"before_" + pb.OpenchainMessage_SYNC_STATE_GET_DELTAS.String():   func(e *fsm.Event) { d.beforeSyncStateGetDeltas(e) },
 			"before_" + pb.OpenchainMessage_SYNC_STATE_DELTAS.String():       func(e *fsm.Event) { d.beforeSyncStateDeltas(e) },
+			"before_" + pb.OpenchainMessage_SYNC_CREDIT.String():             func(e *fsm.Event) { d.beforeSyncCredit(e) },
+			"before_" + pb.OpenchainMessage_GOSSIP_BLOCK_HEADER.String():     func(e *fsm.Event) { d.beforeGossipBlockHeader(e) },
+			"before_" + pb.OpenchainMessage_SYNC_GET_BLOCK_HEADERS.String():  func(e *fsm.Event) { d.beforeSyncGetBlockHeaders(e) },
+			"before_" + pb.OpenchainMessage_SYNC_BLOCK_HEADERS.String():      func(e *fsm.Event) { d.beforeSyncBlockHeaders(e) },
+			"before_" + pb.OpenchainMessage_SYNC_GET_TRANSACTION_PROOF.String(): func(e *fsm.Event) { d.beforeSyncGetTransactionProof(e) },
+			"before_" + pb.OpenchainMessage_SYNC_TRANSACTION_PROOF.String():  func(e *fsm.Event) { d.beforeSyncTransactionProof(e) },
+			"before_" + pb.OpenchainMessage_SYNC_GET_CHECKPOINT_CERTIFICATE.String(): func(e *fsm.Event) { d.beforeSyncGetCheckpointCertificate(e) },
+			"before_" + pb.OpenchainMessage_SYNC_CHECKPOINT_CERTIFICATE.String():     func(e *fsm.Event) { d.beforeSyncCheckpointCertificate(e) },
+			"before_" + pb.OpenchainMessage_DISC_PING.String():               func(e *fsm.Event) { d.beforePing(e) },
+			"before_" + pb.OpenchainMessage_CHAIN_REPLY.String():             func(e *fsm.Event) { d.beforeReply(e) },
 		},
 	)
 
 	// If the stream was initiated from this Peer, send an Initial HELLO message
 	if d.initiatedStream {
 		// Send intiial Hello
-		helloMessage, err := d.Coordinator.NewOpenchainDiscoveryHello()
-		if err != nil {
-			return nil, fmt.Errorf("Error getting new HelloMessage: %s", err)
-		}
-		if err := d.SendMessage(helloMessage); err != nil {
+		if err := d.sendHello(); err != nil {
 			return nil, fmt.Errorf("Error creating new Peer Handler, error returned sending %s: %s", pb.OpenchainMessage_DISC_HELLO, err)
 		}
 	}
@@ -114,7 +171,7 @@ func (d *Handler) deregister() error {
 	if d.registered {
 		err = d.Coordinator.DeregisterHandler(d)
 		//doneChan is created and waiting for registered handlers only
-		d.doneChan <- struct{}{}
+		close(d.doneChan)
 		d.registered = false
 	}
 	return err
@@ -130,6 +187,7 @@ func (d *Handler) To() (pb.PeerEndpoint, error) {
 
 // Stop stops this handler, which will trigger the Deregister from the MessageHandlerCoordinator.
 func (d *Handler) Stop() error {
+	d.stopSync()
 	// Deregister the handler
 	err := d.deregister()
 	if err != nil {
@@ -159,36 +217,172 @@ func (d *Handler) beforeHello(e *fsm.Event) {
 
 	// If security enabled, need to verify the signature on the hello message
 	if viper.GetBool("security.enabled") {
-		if err := d.Coordinator.GetSecHelper().Verify(helloMessage.PeerEndpoint.PkiID, msg.Signature, msg.Payload); err != nil {
+		if err := d.verifyPeerSignature(msg.Signature, msg.Payload); err != nil {
 			e.Cancel(fmt.Errorf("Error Verifying signature for received HelloMessage: %s", err))
 			return
 		}
 		peerLogger.Debug("Verified signature for %s", e.Event)
 	}
 
+	if reason := d.checkHello(helloMessage); reason != nil {
+		e.Cancel(d.disconnect(reason))
+		return
+	}
+	d.negotiateEncoding(helloMessage)
+
 	if d.initiatedStream == false {
 		// Did NOT intitiate the stream, need to send back HELLO
 		peerLogger.Debug("Received %s, sending back %s", e.Event, pb.OpenchainMessage_DISC_HELLO.String())
 		// Send back out PeerID information in a Hello
-		helloMessage, err := d.Coordinator.NewOpenchainDiscoveryHello()
-		if err != nil {
-			e.Cancel(fmt.Errorf("Error getting new HelloMessage: %s", err))
+		if err := d.sendHello(); err != nil {
+			e.Cancel(fmt.Errorf("Error sending response to %s:  %s", e.Event, err))
 			return
 		}
-		if err := d.SendMessage(helloMessage); err != nil {
-			e.Cancel(fmt.Errorf("Error sending response to %s:  %s", e.Event, err))
+	}
+
+	// If security enabled, the peer is registered once it answered our challenge
+	if viper.GetBool("security.enabled") {
+		if len(helloMessage.Nonce) != authNonceSize {
+			e.Cancel(d.disconnect(&pb.DisconnectMessage{
+				Reason: pb.DisconnectMessage_AUTHENTICATION_FAILED,
+				Detail: fmt.Sprintf("expected a challenge of %d bytes, got %d bytes", authNonceSize, len(helloMessage.Nonce)),
+			}))
 			return
 		}
+		d.remoteNonce = helloMessage.Nonce
+		if err := d.sendAuth(helloMessage.Nonce); err != nil {
+			e.Cancel(err)
+		}
+		return
 	}
-	// Register
-	err = d.Coordinator.RegisterHandler(d)
+	if err := d.register(); err != nil {
+		e.Cancel(err)
+	}
+}
+
+// sendHello sends our HelloMessage to the peer, and remembers the challenge
+// it contains
+func (d *Handler) sendHello() error {
+	msg, err := d.Coordinator.NewOpenchainDiscoveryHello()
 	if err != nil {
-		e.Cancel(fmt.Errorf("Error registering Handler: %s", err))
-	} else {
-		// Registered successfully
-		d.registered = true
-		go d.start()
+		return fmt.Errorf("Error getting new HelloMessage: %s", err)
+	}
+	helloMessage := &pb.HelloMessage{}
+	if err := proto.Unmarshal(msg.Payload, helloMessage); err != nil {
+		return fmt.Errorf("Error unmarshalling HelloMessage: %s", err)
+	}
+	d.nonce = helloMessage.Nonce
+	return d.SendMessage(msg)
+}
+
+// register registers the handler with the Coordinator and starts it
+func (d *Handler) register() error {
+	if reason := d.checkValidator(); reason != nil {
+		return d.disconnect(reason)
+	}
+	if err := d.Coordinator.RegisterHandler(d); err != nil {
+		if _, ok := err.(*ConnectionLimitError); ok {
+			return d.disconnect(&pb.DisconnectMessage{Reason: pb.DisconnectMessage_TOO_MANY_PEERS, Detail: err.Error()})
+		}
+		return fmt.Errorf("Error registering Handler: %s", err)
+	}
+	// Registered successfully
+	d.registered = true
+	go d.start()
+	return nil
+}
+
+// checkHello checks that the peer is on our network, started from our
+// genesis block and speaks a compatible protocol version, which becomes the
+// version of the chat. Otherwise it returns why the peer has to be
+// disconnected.
+func (d *Handler) checkHello(helloMessage *pb.HelloMessage) *pb.DisconnectMessage {
+	if networkID := viper.GetString("peer.networkId"); helloMessage.NetworkID != networkID {
+		return &pb.DisconnectMessage{
+			Reason: pb.DisconnectMessage_NETWORK_MISMATCH,
+			Detail: fmt.Sprintf("peer is on network %q, we are on network %q", helloMessage.NetworkID, networkID),
+		}
+	}
+	genesisHash, err := d.genesisHash()
+	if err != nil {
+		peerLogger.Error(fmt.Sprintf("Could not determine our genesis block: %s", err))
+	}
+	if len(genesisHash) != 0 && len(helloMessage.GenesisHash) == 0 {
+		return &pb.DisconnectMessage{
+			Reason: pb.DisconnectMessage_GENESIS_MISMATCH,
+			Detail: fmt.Sprintf("peer did not say which genesis block it has, we have %x", genesisHash),
+		}
+	}
+	if len(genesisHash) != 0 && !bytes.Equal(genesisHash, helloMessage.GenesisHash) {
+		return &pb.DisconnectMessage{
+			Reason: pb.DisconnectMessage_GENESIS_MISMATCH,
+			Detail: fmt.Sprintf("peer has genesis block %x, we have %x", helloMessage.GenesisHash, genesisHash),
+		}
+	}
+	version, err := negotiateProtocolVersion(viper.GetString("peer.version"), helloMessage.ProtocolVersion)
+	if err != nil {
+		return &pb.DisconnectMessage{Reason: pb.DisconnectMessage_VERSION_MISMATCH, Detail: err.Error()}
+	}
+	d.protocolVersion = version
+	peerLogger.Debug("Speaking protocol version %s with %s", version, helloMessage.PeerEndpoint)
+	return nil
+}
+
+// genesisHash returns the hash of our genesis block, or else the configured
+// peer.genesisHash of the network, nil if there is neither
+func (d *Handler) genesisHash() ([]byte, error) {
+	if genesis, err := d.Coordinator.GetBlockByNumber(0); err == nil && genesis != nil {
+		return genesis.GetHash()
+	}
+	return configuredGenesisHash()
+}
+
+// disconnect tells the peer why we end the chat with it
+func (d *Handler) disconnect(reason *pb.DisconnectMessage) error {
+	peerLogger.Warning("Disconnecting peer %s: %s: %s", d.ToPeerEndpoint, reason.Reason, reason.Detail)
+	data, err := proto.Marshal(reason)
+	if err != nil {
+		return fmt.Errorf("Error marshalling DisconnectMessage: %s", err)
 	}
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_DISC_DISCONNECT, Payload: data}); err != nil {
+		peerLogger.Error(fmt.Sprintf("Error sending %s: %s", pb.OpenchainMessage_DISC_DISCONNECT, err))
+	}
+	return &DisconnectError{Reason: reason}
+}
+
+func (d *Handler) beforeDisconnect(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	reason := &pb.DisconnectMessage{}
+	if err := proto.Unmarshal(msg.Payload, reason); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling DisconnectMessage: %s", err))
+		return
+	}
+	e.Cancel(&DisconnectError{Reason: reason, Remote: true})
+}
+
+// ProtocolVersion returns the protocol version negotiated with the peer, or
+// the empty string before the hello exchange completed
+func (d *Handler) ProtocolVersion() string {
+	return d.protocolVersion
+}
+
+// speaks reports whether the protocol version negotiated with the peer is
+// at least version
+func (d *Handler) speaks(version string) bool {
+	return speaksProtocolVersion(d.protocolVersion, version)
+}
+
+// checkMessageVersion returns an error if msg is of a type the protocol
+// version negotiated with the peer does not have
+func (d *Handler) checkMessageVersion(msg *pb.OpenchainMessage) error {
+	if version := messageVersions[msg.Type]; !d.speaks(version) {
+		return fmt.Errorf("Peer %s speaks protocol version %q, %s messages need version %s", d.ToPeerEndpoint, d.protocolVersion, msg.Type, version)
+	}
+	return nil
 }
 
 func (d *Handler) beforeGetPeers(e *fsm.Event) {
@@ -241,8 +435,61 @@ func (d *Handler) beforeBlockAdded(e *fsm.Event) {
 		e.Cancel(fmt.Errorf("Received unexpected message type"))
 		return
 	}
-	// Add the block and any delta state to the ledger
-	_ = msg
+	blockState := &pb.BlockState{}
+	if err := proto.Unmarshal(msg.Payload, blockState); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling BlockState: %s", err))
+		return
+	}
+	if blockState.Block == nil {
+		e.Cancel(fmt.Errorf("Received BlockState without a block"))
+		return
+	}
+	if d.ToPeerEndpoint.Type != pb.PeerEndpoint_VALIDATOR {
+		e.Cancel(fmt.Errorf("Received %s from %s, which is not a validator", e.Event, d.ToPeerEndpoint.ID))
+		return
+	}
+	// The transactions of the block come without payloads, so the block
+	// itself cannot be appended. It announces the new head of the chain of
+	// the validator, which the gossip then pulls in full and checks against
+	// the hash of the block.
+	head := &pb.BlockchainInfo{Height: blockState.BlockNumber + 1, CurrentBlockHash: blockState.BlockHash, PreviousBlockHash: blockState.Block.PreviousBlockHash}
+	if err := d.Coordinator.BlockHeadReceived(head, d.ToPeerEndpoint); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeGossipBlockHeader(e *fsm.Event) {
+	peerLogger.Debug("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	head := &pb.BlockchainInfo{}
+	if err := proto.Unmarshal(msg.Payload, head); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling BlockchainInfo: %s", err))
+		return
+	}
+	if err := d.Coordinator.BlockHeadReceived(head, d.ToPeerEndpoint); err != nil {
+		e.Cancel(err)
+	}
+}
+
+func (d *Handler) beforeReply(e *fsm.Event) {
+	peerLogger.Debug("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	reply := &pb.TransactionReply{}
+	if err := proto.Unmarshal(msg.Payload, reply); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling TransactionReply: %s", err))
+		return
+	}
+	if err := d.Coordinator.ReplyReceived(reply, d.ToPeerEndpoint); err != nil {
+		e.Cancel(err)
+	}
 }
 
 func (d *Handler) when(stateToCheck string) bool {
@@ -252,11 +499,26 @@ func (d *Handler) when(stateToCheck string) bool {
 // HandleMessage handles the Openchain messages for the Peer.
 func (d *Handler) HandleMessage(msg *pb.OpenchainMessage) error {
 	peerLogger.Debug("Handling OpenchainMessage of type: %s ", msg.Type)
+	d.touch()
+	if err := d.checkMessageVersion(msg); err != nil {
+		return err
+	}
 	if d.FSM.Cannot(msg.Type.String()) {
 		return fmt.Errorf("Peer FSM cannot handle message (%s) with payload size (%d) while in state: %s", msg.Type.String(), len(msg.Payload), d.FSM.Current())
 	}
+	if !d.Authenticated() && msg.Type != pb.OpenchainMessage_DISC_HELLO && msg.Type != pb.OpenchainMessage_DISC_AUTH && msg.Type != pb.OpenchainMessage_DISC_DISCONNECT {
+		return fmt.Errorf("Peer %s is not authenticated, cannot handle message (%s)", d.ToPeerEndpoint, msg.Type.String())
+	}
+	if err := d.VerifyMessage(msg); err != nil {
+		return err
+	}
 	err := d.FSM.Event(msg.Type.String(), msg)
 	if err != nil {
+		if canceled, ok := err.(*fsm.CanceledError); ok {
+			if disconnect, ok := canceled.Err.(*DisconnectError); ok {
+				return disconnect
+			}
+		}
 		if _, ok := err.(*fsm.NoTransitionError); !ok {
 			// Only allow NoTransitionError's, all others are considered true error.
 			return fmt.Errorf("Peer FSM failed while handling message (%s): current state: %s, error: %s", msg.Type.String(), d.FSM.Current(), err)
@@ -270,12 +532,25 @@ func (d *Handler) HandleMessage(msg *pb.OpenchainMessage) error {
 func (d *Handler) SendMessage(msg *pb.OpenchainMessage) error {
 	//make sure Sends are serialized. Also make sure everyone uses SendMessage
 	//instead of calling Send directly on the grpc stream
+	if err := d.checkMessageVersion(msg); err != nil {
+		return err
+	}
+	msg, err := d.signMessage(msg)
+	if err != nil {
+		return err
+	}
 	d.chatMutex.Lock()
 	defer d.chatMutex.Unlock()
-	peerLogger.Debug("Sending message to stream of type: %s ", msg.Type)
-	err := d.ChatStream.Send(msg)
+	msgs, err := d.encodeMessage(msg)
 	if err != nil {
-		return fmt.Errorf("Error Sending message through ChatStream: %s", err)
+		return fmt.Errorf("Error encoding message for ChatStream: %s", err)
+	}
+	peerLogger.Debug("Sending message to stream of type: %s ", msg.Type)
+	// The chunks of a message go back to back, the peer reassembles them in order
+	for _, encoded := range msgs {
+		if err := d.ChatStream.Send(encoded); err != nil {
+			return fmt.Errorf("Error Sending message through ChatStream: %s", err)
+		}
 	}
 	return nil
 }
@@ -284,9 +559,20 @@ func (d *Handler) SendMessage(msg *pb.OpenchainMessage) error {
 func (d *Handler) start() error {
 	discPeriod := viper.GetDuration("peer.discovery.period")
 	tickChan := time.NewTicker(discPeriod).C
+	var keepAliveChan <-chan time.Time
+	keepAliveInterval := viper.GetDuration("peer.keepalive.interval")
+	if keepAliveInterval > 0 {
+		keepAliveTicker := time.NewTicker(keepAliveInterval)
+		defer keepAliveTicker.Stop()
+		keepAliveChan = keepAliveTicker.C
+	}
 	peerLogger.Debug("Starting Peer discovery service")
 	for {
 		select {
+		case <-keepAliveChan:
+			if d.keepAlive(keepAliveInterval, viper.GetDuration("peer.keepalive.timeout")) {
+				return nil
+			}
 		case <-tickChan:
 			if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_DISC_GET_PEERS}); err != nil {
 				peerLogger.Error(fmt.Sprintf("Error sending %s during handler discovery tick: %s", pb.OpenchainMessage_DISC_GET_PEERS, err))
@@ -354,16 +640,13 @@ func (d *Handler) start() error {
 // RequestBlocks get the blocks from the other PeerEndpoint based upon supplied SyncBlockRange, will provide them through the returned channel.
 // this will also stop writing any received blocks to channels created from Prior calls to RequestBlocks(..)
 func (d *Handler) RequestBlocks(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.SyncBlocks, error) {
-	d.syncBlocksMutex.Lock()
-	defer d.syncBlocksMutex.Unlock()
-
-	if d.syncBlocks != nil {
-		// close the previous one
-		close(d.syncBlocks)
-	}
-	d.syncBlocks = make(chan *pb.SyncBlocks, viper.GetInt("peer.sync.blocks.channelSize"))
+	d.syncBlocksRequestHandler.Lock()
+	defer d.syncBlocksRequestHandler.Unlock()
+	// Reset the handler
+	d.syncBlocksRequestHandler.reset()
 
 	// Marshal the SyncBlockRange as the payload
+	syncBlockRange = d.syncBlocksRequestHandler.createRequest(syncBlockRange)
 	syncBlockRangeBytes, err := proto.Marshal(syncBlockRange)
 	if err != nil {
 		return nil, fmt.Errorf("Error marshaling syncBlockRange during GetBlocks: %s", err)
@@ -372,7 +655,7 @@ func (d *Handler) RequestBlocks(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.S
 	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_GET_BLOCKS, Payload: syncBlockRangeBytes}); err != nil {
 		return nil, fmt.Errorf("Error sending %s during GetBlocks: %s", pb.OpenchainMessage_SYNC_GET_BLOCKS, err)
 	}
-	return d.syncBlocks, nil
+	return d.syncBlocksRequestHandler.start(d.syncCreditGranter(pb.OpenchainMessage_SYNC_BLOCKS, syncBlockRange.CorrelationId)), nil
 }
 
 func (d *Handler) beforeSyncGetBlocks(e *fsm.Event) {
@@ -390,7 +673,7 @@ func (d *Handler) beforeSyncGetBlocks(e *fsm.Event) {
 		return
 	}
 
-	go d.sendBlocks(syncBlockRange)
+	go d.sendBlocks(syncBlockRange, d.syncCredits.open(pb.OpenchainMessage_SYNC_BLOCKS, syncBlockRange.CorrelationId))
 }
 
 func (d *Handler) beforeSyncBlocks(e *fsm.Event) {
@@ -408,24 +691,25 @@ func (d *Handler) beforeSyncBlocks(e *fsm.Event) {
 		return
 	}
 
+	d.syncBlocksRequestHandler.Lock()
+	defer d.syncBlocksRequestHandler.Unlock()
+	// Make sure the correlationID matches
+	if !d.syncBlocksRequestHandler.shouldHandle(syncBlocks) {
+		peerLogger.Warning("Ignoring SyncBlocks message as it does not match current correlationId = %d", d.syncBlocksRequestHandler.correlationID)
+		return
+	}
 	peerLogger.Debug("Sending block onto channel for start = %d and end = %d", syncBlocks.Range.Start, syncBlocks.Range.End)
-
-	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
-	defer func() {
-		if x := recover(); x != nil {
-			peerLogger.Error(fmt.Sprintf("Error sending syncBlocks to channel: %v", x))
-		}
-	}()
-	// Use non-blocking send, will WARN if missed message.
-	select {
-	case d.syncBlocks <- syncBlocks:
-	default:
-		peerLogger.Warning("Did NOT send SyncBlocks message to channel for range: %d - %d", syncBlocks.Range.Start, syncBlocks.Range.End)
+	if !d.syncBlocksRequestHandler.relay.put(syncBlocks) {
+		// The sender exceeded its credits, the stream is incomplete and must be discarded
+		d.syncBlocksRequestHandler.reset()
+		e.Cancel(fmt.Errorf("Peer sent SyncBlocks for range %d - %d without credits, discarding the stream", syncBlocks.Range.Start, syncBlocks.Range.End))
 	}
 }
 
-// sendBlocks sends the blocks based upon the supplied SyncBlockRange over the stream.
-func (d *Handler) sendBlocks(syncBlockRange *pb.SyncBlockRange) {
+// sendBlocks sends the blocks based upon the supplied SyncBlockRange over the stream,
+// as the requestor grants credits.
+func (d *Handler) sendBlocks(syncBlockRange *pb.SyncBlockRange, window *syncWindow) {
+	defer d.syncCredits.finish(window)
 	peerLogger.Debug("Sending blocks %d-%d", syncBlockRange.Start, syncBlockRange.End)
 	var blockNums []uint64
 	if syncBlockRange.Start > syncBlockRange.End {
@@ -449,13 +733,13 @@ func (d *Handler) sendBlocks(syncBlockRange *pb.SyncBlockRange) {
 			break
 		}
 		// Encode a SyncBlocks into the payload
-		syncBlocks := &pb.SyncBlocks{Range: &pb.SyncBlockRange{Start: currBlockNum, End: currBlockNum}, Blocks: []*pb.Block{block}}
+		syncBlocks := &pb.SyncBlocks{Range: &pb.SyncBlockRange{Start: currBlockNum, End: currBlockNum, CorrelationId: syncBlockRange.CorrelationId}, Blocks: []*pb.Block{block}}
 		syncBlocksBytes, err := proto.Marshal(syncBlocks)
 		if err != nil {
 			peerLogger.Error(fmt.Sprintf("Error marshalling syncBlocks for BlockNum = %d: %s", currBlockNum, err))
 			break
 		}
-		if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_BLOCKS, Payload: syncBlocksBytes}); err != nil {
+		if err := d.sendSyncMessage(window, &pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_BLOCKS, Payload: syncBlocksBytes}); err != nil {
 			peerLogger.Error(fmt.Sprintf("Error sending blockNum %d: %s", currBlockNum, err))
 			break
 		}
@@ -488,7 +772,7 @@ func (d *Handler) RequestStateSnapshot() (<-chan *pb.SyncStateSnapshot, error) {
 		return nil, fmt.Errorf("Error sending %s during GetStateSnapshot: %s", pb.OpenchainMessage_SYNC_STATE_GET_SNAPSHOT, err)
 	}
 
-	return d.snapshotRequestHandler.channel, nil
+	return d.snapshotRequestHandler.start(d.syncCreditGranter(pb.OpenchainMessage_SYNC_STATE_SNAPSHOT, syncStateSnapshotRequest.CorrelationId)), nil
 }
 
 // beforeSyncStateGetSnapshot triggers the sending of State Snapshot deltas to remote Peer.
@@ -508,7 +792,7 @@ func (d *Handler) beforeSyncStateGetSnapshot(e *fsm.Event) {
 	}
 
 	// Start a separate go FUNC to send the State snapshot
-	go d.sendStateSnapshot(syncStateSnapshotRequest)
+	go d.sendStateSnapshot(syncStateSnapshotRequest, d.syncCredits.open(pb.OpenchainMessage_SYNC_STATE_SNAPSHOT, syncStateSnapshotRequest.CorrelationId))
 }
 
 // beforeSyncStateSnapshot will write the State Snapshot deltas to the respective channel.
@@ -527,33 +811,24 @@ func (d *Handler) beforeSyncStateSnapshot(e *fsm.Event) {
 		return
 	}
 
-	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
-	defer func() {
-		if x := recover(); x != nil {
-			peerLogger.Error(fmt.Sprintf("Error sending syncStateSnapshot to channel: %v", x))
-		}
-	}()
-	// Use non-blocking send, will WARN and close channel if missed message.
 	d.snapshotRequestHandler.Lock()
 	defer d.snapshotRequestHandler.Unlock()
 	// Make sure the correlationID matches
-	if d.snapshotRequestHandler.shouldHandle(syncStateSnapshot) {
-		select {
-		case d.snapshotRequestHandler.channel <- syncStateSnapshot:
-		default:
-			// Was not able to write to the channel, in which case the Snapshot stream is incomplete, and must be discarded, closing the channel
-			// without sending the terminating message which would have had an empty byte slice.
-			peerLogger.Warning("Did NOT send SyncStateSnapshot message to channel for correlationId = %d, sequence = %d, closing channel as the message has been discarded", syncStateSnapshot.Request.CorrelationId, syncStateSnapshot.Sequence)
-			d.snapshotRequestHandler.reset()
-		}
-	} else {
+	if !d.snapshotRequestHandler.shouldHandle(syncStateSnapshot) {
 		//Ignore the message, does not match the current correlationId
-		peerLogger.Warning("Ignoring SyncStateSnapshot message with correlationId = %d, sequence = %d, as current correlationId = %d", syncStateSnapshot.Request.CorrelationId, syncStateSnapshot.Sequence, d.snapshotRequestHandler.correlationID)
+		peerLogger.Warning("Ignoring SyncStateSnapshot message with sequence = %d, as current correlationId = %d", syncStateSnapshot.Sequence, d.snapshotRequestHandler.correlationID)
+		return
+	}
+	if !d.snapshotRequestHandler.relay.put(syncStateSnapshot) {
+		// The sender exceeded its credits, the Snapshot stream is incomplete and must be discarded
+		d.snapshotRequestHandler.reset()
+		e.Cancel(fmt.Errorf("Peer sent SyncStateSnapshot with correlationId = %d, sequence = %d without credits, discarding the stream", syncStateSnapshot.Request.CorrelationId, syncStateSnapshot.Sequence))
 	}
 }
 
-// sendBlocks sends the blocks based upon the supplied SyncBlockRange over the stream.
-func (d *Handler) sendStateSnapshot(syncStateSnapshotRequest *pb.SyncStateSnapshotRequest) {
+// sendStateSnapshot sends the state snapshot over the stream, as the requestor grants credits.
+func (d *Handler) sendStateSnapshot(syncStateSnapshotRequest *pb.SyncStateSnapshotRequest, window *syncWindow) {
+	defer d.syncCredits.finish(window)
 	peerLogger.Debug("Sending state snapshot with correlationId = %d", syncStateSnapshotRequest.CorrelationId)
 
 	snapshot, err := d.Coordinator.GetStateSnapshot()
@@ -583,9 +858,9 @@ func (d *Handler) sendStateSnapshot(syncStateSnapshotRequest *pb.SyncStateSnapsh
 			peerLogger.Error(fmt.Sprintf("Error marshalling syncStateSnapsot for BlockNum = %d: %s", currBlockNumber, err))
 			break
 		}
-		if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_STATE_SNAPSHOT, Payload: syncStateSnapshotBytes}); err != nil {
+		if err := d.sendSyncMessage(window, &pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_STATE_SNAPSHOT, Payload: syncStateSnapshotBytes}); err != nil {
 			peerLogger.Error(fmt.Sprintf("Error sending syncStateSnapsot for BlockNum = %d: %s", currBlockNumber, err))
-			break
+			return
 		}
 	}
 
@@ -596,13 +871,407 @@ func (d *Handler) sendStateSnapshot(syncStateSnapshotRequest *pb.SyncStateSnapsh
 		peerLogger.Error(fmt.Sprintf("Error marshalling terminating syncStateSnapsot message for correlationId = %d, BlockNum = %d: %s", syncStateSnapshotRequest.CorrelationId, currBlockNumber, err))
 		return
 	}
-	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_STATE_SNAPSHOT, Payload: syncStateSnapshotBytes}); err != nil {
+	if err := d.sendSyncMessage(window, &pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_STATE_SNAPSHOT, Payload: syncStateSnapshotBytes}); err != nil {
 		peerLogger.Error(fmt.Sprintf("Error sending terminating syncStateSnapsot for correlationId = %d, BlockNum = %d: %s", syncStateSnapshotRequest.CorrelationId, currBlockNumber, err))
 		return
 	}
 
 }
 
+// ----------------------------------------------------------------------------
+//
+//  State sync Chunk functionality
+//
+//
+// ----------------------------------------------------------------------------
+
+// RequestStateChunk requests a chunk of the state from the other PeerEndpoint, which will be provided through the returned channel.
+// If stateHash is set, the chunk is only sent if the state of the other PeerEndpoint has that hash.
+// This will also stop writing any received syncStateChunk to channels created from prior calls to RequestStateChunk()
+func (d *Handler) RequestStateChunk(chunk uint64, stateHash []byte) (<-chan *pb.SyncStateChunk, error) {
+	d.chunkRequestHandler.Lock()
+	defer d.chunkRequestHandler.Unlock()
+	// Reset the handler
+	d.chunkRequestHandler.reset()
+
+	syncStateChunkRequest := d.chunkRequestHandler.createRequest(chunk, stateHash)
+	syncStateChunkRequestBytes, err := proto.Marshal(syncStateChunkRequest)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling syncStateChunkRequest during RequestStateChunk: %s", err)
+	}
+	peerLogger.Debug("Sending %s with syncStateChunkRequest = %s", pb.OpenchainMessage_SYNC_STATE_GET_CHUNK.String(), syncStateChunkRequest)
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_STATE_GET_CHUNK, Payload: syncStateChunkRequestBytes}); err != nil {
+		return nil, fmt.Errorf("Error sending %s during RequestStateChunk: %s", pb.OpenchainMessage_SYNC_STATE_GET_CHUNK, err)
+	}
+
+	return d.chunkRequestHandler.channel, nil
+}
+
+// beforeSyncStateGetChunk triggers the sending of a State chunk to remote Peer.
+func (d *Handler) beforeSyncStateGetChunk(e *fsm.Event) {
+	peerLogger.Debug("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	syncStateChunkRequest := &pb.SyncStateChunkRequest{}
+	err := proto.Unmarshal(msg.Payload, syncStateChunkRequest)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncStateChunkRequest in beforeSyncStateGetChunk: %s", err))
+		return
+	}
+
+	// Start a separate go FUNC to send the State chunk
+	go d.sendStateChunk(syncStateChunkRequest)
+}
+
+// beforeSyncStateChunk will write the State chunk to the respective channel.
+func (d *Handler) beforeSyncStateChunk(e *fsm.Event) {
+	peerLogger.Debug("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	syncStateChunk := &pb.SyncStateChunk{}
+	err := proto.Unmarshal(msg.Payload, syncStateChunk)
+	if err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling syncStateChunk in beforeSyncStateChunk: %s", err))
+		return
+	}
+
+	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
+	defer func() {
+		if x := recover(); x != nil {
+			peerLogger.Error(fmt.Sprintf("Error sending syncStateChunk to channel: %v", x))
+		}
+	}()
+	d.chunkRequestHandler.Lock()
+	defer d.chunkRequestHandler.Unlock()
+	// Make sure the correlationID matches
+	if d.chunkRequestHandler.shouldHandle(syncStateChunk) {
+		select {
+		case d.chunkRequestHandler.channel <- syncStateChunk:
+		default:
+			peerLogger.Warning("Did NOT send SyncStateChunk message to channel for correlationId = %d, chunk = %d, as a response was already received", syncStateChunk.Request.CorrelationId, syncStateChunk.Request.Chunk)
+		}
+	} else {
+		//Ignore the message, does not match the current correlationId
+		peerLogger.Warning("Ignoring SyncStateChunk message as it does not match current correlationId = %d", d.chunkRequestHandler.correlationID)
+	}
+}
+
+// sendStateChunk sends the state chunk requested by the supplied SyncStateChunkRequest over the stream.
+func (d *Handler) sendStateChunk(syncStateChunkRequest *pb.SyncStateChunkRequest) {
+	peerLogger.Debug("Sending state chunk %d with correlationId = %d", syncStateChunkRequest.Chunk, syncStateChunkRequest.CorrelationId)
+
+	// The requestor fetches every chunk of its target from the same snapshot,
+	// although the state moves on meanwhile
+	snapshot, err := d.chunkSnapshots.acquire(syncStateChunkRequest.StateHash)
+	if err != nil {
+		peerLogger.Error(fmt.Sprintf("Error getting snapshot: %s", err))
+		return
+	}
+	defer d.chunkSnapshots.release(snapshot)
+
+	syncStateChunk := &pb.SyncStateChunk{Request: syncStateChunkRequest, BlockNumber: snapshot.GetBlockNumber(), StateHash: snapshot.stateHash}
+	if syncStateChunk.NumChunks, err = snapshot.GetNumChunks(); err != nil {
+		peerLogger.Error(fmt.Sprintf("Error getting number of state chunks: %s", err))
+		return
+	}
+
+	// If the state has moved on, only tell the requestor what it has moved on to
+	if len(syncStateChunkRequest.StateHash) == 0 || bytes.Equal(syncStateChunkRequest.StateHash, syncStateChunk.StateHash) {
+		delta, proof, err := snapshot.GetChunk(syncStateChunkRequest.Chunk)
+		if err != nil {
+			peerLogger.Error(fmt.Sprintf("Error getting state chunk %d for BlockNum = %d: %s", syncStateChunkRequest.Chunk, syncStateChunk.BlockNumber, err))
+			return
+		}
+		syncStateChunk.Delta = delta.Marshal()
+		syncStateChunk.Proof = proof
+	}
+
+	syncStateChunkBytes, err := proto.Marshal(syncStateChunk)
+	if err != nil {
+		peerLogger.Error(fmt.Sprintf("Error marshalling syncStateChunk for BlockNum = %d: %s", syncStateChunk.BlockNumber, err))
+		return
+	}
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_STATE_CHUNK, Payload: syncStateChunkBytes}); err != nil {
+		peerLogger.Error(fmt.Sprintf("Error sending syncStateChunk for BlockNum = %d: %s", syncStateChunk.BlockNumber, err))
+	}
+}
+
+// ----------------------------------------------------------------------------
+//
+//  Block headers and transaction proofs functionality, for light peers
+//
+//
+// ----------------------------------------------------------------------------
+
+// RequestBlockHeaders requests the headers of the blocks in syncBlockRange
+// from the other PeerEndpoint, which answers with as many of them as it has,
+// up to peer.sync.headers.maxPerMessage, through the returned channel.
+// This will also stop writing the response to prior calls to
+// RequestBlockHeaders to their channels.
+func (d *Handler) RequestBlockHeaders(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.SyncBlockHeaders, error) {
+	d.headersRequestHandler.Lock()
+	defer d.headersRequestHandler.Unlock()
+	// Reset the handler
+	d.headersRequestHandler.reset()
+
+	request := d.headersRequestHandler.createRequest(syncBlockRange)
+	requestBytes, err := proto.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling syncBlockRange during RequestBlockHeaders: %s", err)
+	}
+	peerLogger.Debug("Sending %s with syncBlockRange = %s", pb.OpenchainMessage_SYNC_GET_BLOCK_HEADERS, request)
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_GET_BLOCK_HEADERS, Payload: requestBytes}); err != nil {
+		return nil, fmt.Errorf("Error sending %s during RequestBlockHeaders: %s", pb.OpenchainMessage_SYNC_GET_BLOCK_HEADERS, err)
+	}
+	return d.headersRequestHandler.channel, nil
+}
+
+// beforeSyncGetBlockHeaders triggers the sending of block headers to the remote Peer.
+func (d *Handler) beforeSyncGetBlockHeaders(e *fsm.Event) {
+	peerLogger.Debug("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	syncBlockRange := &pb.SyncBlockRange{}
+	if err := proto.Unmarshal(msg.Payload, syncBlockRange); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncBlockRange in beforeSyncGetBlockHeaders: %s", err))
+		return
+	}
+	go d.sendBlockHeaders(syncBlockRange)
+}
+
+// beforeSyncBlockHeaders will write the block headers to the channel of the request.
+func (d *Handler) beforeSyncBlockHeaders(e *fsm.Event) {
+	peerLogger.Debug("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	syncBlockHeaders := &pb.SyncBlockHeaders{}
+	if err := proto.Unmarshal(msg.Payload, syncBlockHeaders); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncBlockHeaders in beforeSyncBlockHeaders: %s", err))
+		return
+	}
+	d.headersRequestHandler.Lock()
+	defer d.headersRequestHandler.Unlock()
+	if d.headersRequestHandler.shouldHandle(syncBlockHeaders) {
+		select {
+		case d.headersRequestHandler.channel <- syncBlockHeaders:
+		default:
+			peerLogger.Warning("Did NOT send SyncBlockHeaders message to channel for correlationId = %d, as a response was already received", syncBlockHeaders.Range.CorrelationId)
+		}
+	} else {
+		peerLogger.Warning("Ignoring SyncBlockHeaders message with range = %v, as it does not match the current request", syncBlockHeaders.Range)
+	}
+}
+
+func (d *Handler) sendBlockHeaders(syncBlockRange *pb.SyncBlockRange) {
+	peerLogger.Debug("Sending block headers %d-%d", syncBlockRange.Start, syncBlockRange.End)
+	max := viper.GetInt("peer.sync.headers.maxPerMessage")
+	syncBlockHeaders := &pb.SyncBlockHeaders{Range: &pb.SyncBlockRange{Start: syncBlockRange.Start, End: syncBlockRange.Start, CorrelationId: syncBlockRange.CorrelationId}}
+	for blockNumber := syncBlockRange.Start; blockNumber <= syncBlockRange.End && len(syncBlockHeaders.Headers) < max; blockNumber++ {
+		// Stops at the top of the chain
+		block, err := d.Coordinator.GetBlockByNumber(blockNumber)
+		if err != nil {
+			break
+		}
+		header, err := block.GetHeader()
+		if err != nil {
+			peerLogger.Error(fmt.Sprintf("Error getting the header of blockNum %d: %s", blockNumber, err))
+			break
+		}
+		syncBlockHeaders.Headers = append(syncBlockHeaders.Headers, header)
+		syncBlockHeaders.Range.End = blockNumber
+	}
+	syncBlockHeadersBytes, err := proto.Marshal(syncBlockHeaders)
+	if err != nil {
+		peerLogger.Error(fmt.Sprintf("Error marshalling syncBlockHeaders for blocks %d-%d: %s", syncBlockRange.Start, syncBlockRange.End, err))
+		return
+	}
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_BLOCK_HEADERS, Payload: syncBlockHeadersBytes}); err != nil {
+		peerLogger.Error(fmt.Sprintf("Error sending syncBlockHeaders for blocks %d-%d: %s", syncBlockRange.Start, syncBlockRange.End, err))
+	}
+}
+
+// RequestTransactionProof requests the transaction with uuid from the other
+// PeerEndpoint, along with the proof that it is in the block it was committed
+// in, which is provided through the returned channel.
+// This will also stop writing the response to prior calls to
+// RequestTransactionProof to their channels.
+func (d *Handler) RequestTransactionProof(uuid string) (<-chan *pb.TransactionProof, error) {
+	d.txProofRequestHandler.Lock()
+	defer d.txProofRequestHandler.Unlock()
+	// Reset the handler
+	d.txProofRequestHandler.reset()
+
+	request := d.txProofRequestHandler.createRequest(uuid)
+	requestBytes, err := proto.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling transactionProofRequest during RequestTransactionProof: %s", err)
+	}
+	peerLogger.Debug("Sending %s with transactionProofRequest = %s", pb.OpenchainMessage_SYNC_GET_TRANSACTION_PROOF, request)
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_GET_TRANSACTION_PROOF, Payload: requestBytes}); err != nil {
+		return nil, fmt.Errorf("Error sending %s during RequestTransactionProof: %s", pb.OpenchainMessage_SYNC_GET_TRANSACTION_PROOF, err)
+	}
+	return d.txProofRequestHandler.channel, nil
+}
+
+// beforeSyncGetTransactionProof triggers the sending of a transaction proof to the remote Peer.
+func (d *Handler) beforeSyncGetTransactionProof(e *fsm.Event) {
+	peerLogger.Debug("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.TransactionProofRequest{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling TransactionProofRequest in beforeSyncGetTransactionProof: %s", err))
+		return
+	}
+	go d.sendTransactionProof(request)
+}
+
+// beforeSyncTransactionProof will write the transaction proof to the channel of the request.
+func (d *Handler) beforeSyncTransactionProof(e *fsm.Event) {
+	peerLogger.Debug("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	transactionProof := &pb.TransactionProof{}
+	if err := proto.Unmarshal(msg.Payload, transactionProof); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling TransactionProof in beforeSyncTransactionProof: %s", err))
+		return
+	}
+	d.txProofRequestHandler.Lock()
+	defer d.txProofRequestHandler.Unlock()
+	if d.txProofRequestHandler.shouldHandle(transactionProof) {
+		select {
+		case d.txProofRequestHandler.channel <- transactionProof:
+		default:
+			peerLogger.Warning("Did NOT send TransactionProof message to channel for correlationId = %d, as a response was already received", transactionProof.Request.CorrelationId)
+		}
+	} else {
+		peerLogger.Warning("Ignoring TransactionProof message with request = %v, as it does not match the current request", transactionProof.Request)
+	}
+}
+
+func (d *Handler) sendTransactionProof(request *pb.TransactionProofRequest) {
+	peerLogger.Debug("Sending the proof of transaction %s with correlationId = %d", request.Uuid, request.CorrelationId)
+	transactionProof, err := d.Coordinator.GetTransactionProof(request.Uuid)
+	if err != nil {
+		// Tell the requestor the transaction is not known
+		peerLogger.Debug("No proof of transaction %s: %s", request.Uuid, err)
+		transactionProof = &pb.TransactionProof{}
+	}
+	transactionProof.Request = request
+	transactionProofBytes, err := proto.Marshal(transactionProof)
+	if err != nil {
+		peerLogger.Error(fmt.Sprintf("Error marshalling the proof of transaction %s: %s", request.Uuid, err))
+		return
+	}
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_TRANSACTION_PROOF, Payload: transactionProofBytes}); err != nil {
+		peerLogger.Error(fmt.Sprintf("Error sending the proof of transaction %s: %s", request.Uuid, err))
+	}
+}
+
+// RequestCheckpointCertificate requests the latest stable checkpoint
+// certificate of the other PeerEndpoint, which is provided through the
+// returned channel.
+// This will also stop writing the response to prior calls to
+// RequestCheckpointCertificate to their channels.
+func (d *Handler) RequestCheckpointCertificate() (<-chan *pb.SyncCheckpointCertificate, error) {
+	d.certRequestHandler.Lock()
+	defer d.certRequestHandler.Unlock()
+	// Reset the handler
+	d.certRequestHandler.reset()
+
+	request := d.certRequestHandler.createRequest()
+	requestBytes, err := proto.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling checkpointCertificateRequest during RequestCheckpointCertificate: %s", err)
+	}
+	peerLogger.Debug("Sending %s with checkpointCertificateRequest = %s", pb.OpenchainMessage_SYNC_GET_CHECKPOINT_CERTIFICATE, request)
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_GET_CHECKPOINT_CERTIFICATE, Payload: requestBytes}); err != nil {
+		return nil, fmt.Errorf("Error sending %s during RequestCheckpointCertificate: %s", pb.OpenchainMessage_SYNC_GET_CHECKPOINT_CERTIFICATE, err)
+	}
+	return d.certRequestHandler.channel, nil
+}
+
+// beforeSyncGetCheckpointCertificate triggers the sending of the latest
+// checkpoint certificate to the remote Peer.
+func (d *Handler) beforeSyncGetCheckpointCertificate(e *fsm.Event) {
+	peerLogger.Debug("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	request := &pb.CheckpointCertificateRequest{}
+	if err := proto.Unmarshal(msg.Payload, request); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling CheckpointCertificateRequest in beforeSyncGetCheckpointCertificate: %s", err))
+		return
+	}
+	go d.sendCheckpointCertificate(request)
+}
+
+// beforeSyncCheckpointCertificate will write the checkpoint certificate to the channel of the request.
+func (d *Handler) beforeSyncCheckpointCertificate(e *fsm.Event) {
+	peerLogger.Debug("Received message: %s", e.Event)
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	syncCert := &pb.SyncCheckpointCertificate{}
+	if err := proto.Unmarshal(msg.Payload, syncCert); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncCheckpointCertificate in beforeSyncCheckpointCertificate: %s", err))
+		return
+	}
+	d.certRequestHandler.Lock()
+	defer d.certRequestHandler.Unlock()
+	if d.certRequestHandler.shouldHandle(syncCert) {
+		select {
+		case d.certRequestHandler.channel <- syncCert:
+		default:
+			peerLogger.Warning("Did NOT send SyncCheckpointCertificate message to channel for correlationId = %d, as a response was already received", syncCert.Request.CorrelationId)
+		}
+	} else {
+		peerLogger.Warning("Ignoring SyncCheckpointCertificate message with request = %v, as it does not match the current request", syncCert.Request)
+	}
+}
+
+func (d *Handler) sendCheckpointCertificate(request *pb.CheckpointCertificateRequest) {
+	peerLogger.Debug("Sending the latest checkpoint certificate with correlationId = %d", request.CorrelationId)
+	syncCert := &pb.SyncCheckpointCertificate{Request: request}
+	cert, err := d.Coordinator.GetLatestCheckpointCertificate()
+	if err != nil {
+		// Tell the requestor there is no certificate
+		peerLogger.Debug("No checkpoint certificate: %s", err)
+	} else {
+		syncCert.Certificate = cert
+	}
+	syncCertBytes, err := proto.Marshal(syncCert)
+	if err != nil {
+		peerLogger.Error(fmt.Sprintf("Error marshalling the latest checkpoint certificate: %s", err))
+		return
+	}
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_CHECKPOINT_CERTIFICATE, Payload: syncCertBytes}); err != nil {
+		peerLogger.Error(fmt.Sprintf("Error sending the latest checkpoint certificate: %s", err))
+	}
+}
+
 // ----------------------------------------------------------------------------
 //
 //  State sync Deltas functionality
@@ -629,7 +1298,7 @@ func (d *Handler) RequestStateDeltas(syncBlockRange *pb.SyncBlockRange) (<-chan
 		return nil, fmt.Errorf("Error sending %s during RequestStateDeltas: %s", pb.OpenchainMessage_SYNC_STATE_GET_DELTAS, err)
 	}
 
-	return d.syncStateDeltasRequestHandler.channel, nil
+	return d.syncStateDeltasRequestHandler.start(d.syncCreditGranter(pb.OpenchainMessage_SYNC_STATE_DELTAS, syncStateDeltasRequest.Range.CorrelationId)), nil
 }
 
 // beforeSyncStateGetDeltas triggers the sending of Get SyncStateDeltas to remote Peer.
@@ -649,11 +1318,13 @@ func (d *Handler) beforeSyncStateGetDeltas(e *fsm.Event) {
 	}
 
 	// Start a separate go FUNC to send the State Deltas
-	go d.sendStateDeltas(syncStateDeltasRequest)
+	go d.sendStateDeltas(syncStateDeltasRequest, d.syncCredits.open(pb.OpenchainMessage_SYNC_STATE_DELTAS, syncStateDeltasRequest.Range.CorrelationId))
 }
 
-// sendBlocks sends the blocks based upon the supplied SyncBlockRange over the stream.
-func (d *Handler) sendStateDeltas(syncStateDeltasRequest *pb.SyncStateDeltasRequest) {
+// sendStateDeltas sends the state deltas for the requested block range over the stream,
+// as the requestor grants credits.
+func (d *Handler) sendStateDeltas(syncStateDeltasRequest *pb.SyncStateDeltasRequest, window *syncWindow) {
+	defer d.syncCredits.finish(window)
 	peerLogger.Debug("Sending state deltas for block range %d-%d", syncStateDeltasRequest.Range.Start, syncStateDeltasRequest.Range.End)
 	var blockNums []uint64
 	syncBlockRange := syncStateDeltasRequest.Range
@@ -678,13 +1349,13 @@ func (d *Handler) sendStateDeltas(syncStateDeltasRequest *pb.SyncStateDeltasRequ
 		}
 		// Encode a SyncStateDeltas into the payload
 		stateDeltaBytes := stateDelta.Marshal()
-		syncStateDeltas := &pb.SyncStateDeltas{Range: &pb.SyncBlockRange{Start: currBlockNum, End: currBlockNum}, Deltas: [][]byte{stateDeltaBytes}}
+		syncStateDeltas := &pb.SyncStateDeltas{Range: &pb.SyncBlockRange{Start: currBlockNum, End: currBlockNum, CorrelationId: syncBlockRange.CorrelationId}, Deltas: [][]byte{stateDeltaBytes}}
 		syncStateDeltasBytes, err := proto.Marshal(syncStateDeltas)
 		if err != nil {
 			peerLogger.Error(fmt.Sprintf("Error marshalling syncStateDeltas for BlockNum = %d: %s", currBlockNum, err))
 			break
 		}
-		if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_STATE_DELTAS, Payload: syncStateDeltasBytes}); err != nil {
+		if err := d.sendSyncMessage(window, &pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_STATE_DELTAS, Payload: syncStateDeltasBytes}); err != nil {
 			peerLogger.Error(fmt.Sprintf("Error sending stateDeltas for blockNum %d: %s", currBlockNum, err))
 			break
 		}
@@ -705,24 +1376,91 @@ func (d *Handler) beforeSyncStateDeltas(e *fsm.Event) {
 		e.Cancel(fmt.Errorf("Error unmarshalling SyncStateDeltas in beforeSyncStateDeltas: %s", err))
 		return
 	}
-	peerLogger.Debug("Sending state delta onto channel for start = %d and end = %d", syncStateDeltas.Range.Start, syncStateDeltas.Range.End)
-
-	// Send the message onto the channel, allow for the fact that channel may be closed on send attempt.
-	defer func() {
-		if x := recover(); x != nil {
-			peerLogger.Error(fmt.Sprintf("Error sending syncStateDeltas to channel: %v", x))
-		}
-	}()
 
-	// Use non-blocking send, will WARN and close channel if missed message.
 	d.syncStateDeltasRequestHandler.Lock()
 	defer d.syncStateDeltasRequestHandler.Unlock()
-	select {
-	case d.syncStateDeltasRequestHandler.channel <- syncStateDeltas:
-	default:
-		// Was not able to write to the channel, in which case the SyncStateDeltasRequest stream is incomplete, and must be discarded, closing the channel
-		peerLogger.Warning("Did NOT send SyncStateDeltas message to channel for block range %d-%d, closing channel as the message has been discarded", syncStateDeltas.Range.Start, syncStateDeltas.Range.End)
+	// Make sure the correlationID matches
+	if !d.syncStateDeltasRequestHandler.shouldHandle(syncStateDeltas) {
+		peerLogger.Warning("Ignoring SyncStateDeltas message as it does not match current correlationId = %d", d.syncStateDeltasRequestHandler.correlationID)
+		return
+	}
+	peerLogger.Debug("Sending state delta onto channel for start = %d and end = %d", syncStateDeltas.Range.Start, syncStateDeltas.Range.End)
+	if !d.syncStateDeltasRequestHandler.relay.put(syncStateDeltas) {
+		// The sender exceeded its credits, the SyncStateDeltasRequest stream is incomplete and must be discarded
 		d.syncStateDeltasRequestHandler.reset()
+		e.Cancel(fmt.Errorf("Peer sent SyncStateDeltas for block range %d-%d without credits, discarding the stream", syncStateDeltas.Range.Start, syncStateDeltas.Range.End))
 	}
+}
+
+// ----------------------------------------------------------------------------
+//
+//  Sync flow control
+//
+//
+// ----------------------------------------------------------------------------
+
+// speaksSyncCredits reports whether the peer grants and honours credits for
+// the responses to sync requests
+func (d *Handler) speaksSyncCredits() bool {
+	return d.speaks(messageVersions[pb.OpenchainMessage_SYNC_CREDIT])
+}
 
+// syncCreditGranter returns the func granting the peer credits for the
+// responses of type msgType to our request with correlationID
+func (d *Handler) syncCreditGranter(msgType pb.OpenchainMessage_Type, correlationID uint64) func(uint64) {
+	if !d.speaksSyncCredits() {
+		return nil
+	}
+	return func(credits uint64) {
+		syncCreditBytes, err := proto.Marshal(&pb.SyncCredit{Type: msgType, CorrelationId: correlationID, Credits: credits})
+		if err != nil {
+			peerLogger.Error(fmt.Sprintf("Error marshalling SyncCredit for %s: %s", msgType, err))
+			return
+		}
+		if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_CREDIT, Payload: syncCreditBytes}); err != nil {
+			peerLogger.Error(fmt.Sprintf("Error sending %s for %s: %s", pb.OpenchainMessage_SYNC_CREDIT, msgType, err))
+		}
+	}
+}
+
+// beforeSyncCredit adds the credits granted by the peer to the window of its request
+func (d *Handler) beforeSyncCredit(e *fsm.Event) {
+	msg, ok := e.Args[0].(*pb.OpenchainMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	syncCredit := &pb.SyncCredit{}
+	if err := proto.Unmarshal(msg.Payload, syncCredit); err != nil {
+		e.Cancel(fmt.Errorf("Error unmarshalling SyncCredit in beforeSyncCredit: %s", err))
+		return
+	}
+	if !d.syncCredits.grant(syncCredit.Type, syncCredit.CorrelationId, syncCredit.Credits) {
+		peerLogger.Debug("Ignoring %d credits for %s with correlationId = %d, which is not being sent", syncCredit.Credits, syncCredit.Type, syncCredit.CorrelationId)
+	}
+}
+
+// sendSyncMessage sends msg once the requestor granted a credit for it, or
+// right away if the requestor is too old to grant credits
+func (d *Handler) sendSyncMessage(window *syncWindow, msg *pb.OpenchainMessage) error {
+	if !d.speaksSyncCredits() {
+		return d.SendMessage(msg)
+	}
+	if err := d.syncCredits.take(window, viper.GetDuration("peer.sync.creditTimeout")); err != nil {
+		return err
+	}
+	return d.SendMessage(msg)
+}
+
+// stopSync stops sending and receiving sync streams, when the chat with the peer ends
+func (d *Handler) stopSync() {
+	d.syncCredits.close()
+	for _, h := range []interface {
+		sync.Locker
+		reset()
+	}{d.syncBlocksRequestHandler, d.snapshotRequestHandler, d.syncStateDeltasRequestHandler, d.headersRequestHandler, d.txProofRequestHandler, d.chunkSnapshots} {
+		h.Lock()
+		h.reset()
+		h.Unlock()
+	}
 }
@@ -20,13 +20,239 @@ under the License.
 package peer
 
 import (
+	"bytes"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
 	pb "github.com/hyperledger-incubator/obc-peer/protos"
 )
 
+//-----------------------------------------------------------------------------
+//
+// Sync flow control
+//
+//-----------------------------------------------------------------------------
+
+// syncRelay relays the responses to a sync request to their consumer. The
+// sender is granted as many credits as the relay buffers responses, and the
+// credits are granted again as the consumer takes the responses, so that the
+// sender pauses for a slow consumer instead of the relay dropping responses.
+// A sender too old to know credits is not granted any, and the relay drops
+// the responses it has no room for, as peers did before credits.
+type syncRelay struct {
+	in       chan interface{}
+	done     chan struct{}
+	credited bool
+}
+
+// newSyncRelay grants the sender its initial credits and starts relaying the
+// responses with deliver, which returns false if done was closed before the
+// consumer took the response. grant is nil if the sender does not know
+// credits. finish is called once the relay stopped.
+func newSyncRelay(size int, deliver func(response interface{}, done <-chan struct{}) bool, grant func(credits uint64), finish func()) *syncRelay {
+	if size < 1 {
+		size = 1
+	}
+	r := &syncRelay{in: make(chan interface{}, size), done: make(chan struct{}), credited: grant != nil}
+	if grant == nil {
+		grant = func(uint64) {}
+	}
+	grant(uint64(size))
+	go func() {
+		defer finish()
+		// Grant credits in batches, rather than with a message per response
+		batch := uint64(size+1) / 2
+		var taken uint64
+		for {
+			select {
+			case response := <-r.in:
+				if !deliver(response, r.done) {
+					return
+				}
+				if taken++; taken >= batch {
+					grant(taken)
+					taken = 0
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// put hands the response to the relay, it returns false if the sender
+// exceeded its credits
+func (r *syncRelay) put(response interface{}) bool {
+	select {
+	case r.in <- response:
+		return true
+	default:
+		if !r.credited {
+			peerLogger.Warning("Dropping %T from a peer without credits, the consumer is too slow", response)
+			return true
+		}
+		return false
+	}
+}
+
+// stop stops relaying, the responses not taken yet are discarded
+func (r *syncRelay) stop() {
+	close(r.done)
+}
+
+// syncCredits holds the credits the peer granted for the responses to its
+// sync requests, by response message type. Only the latest request of a type
+// is served, a newer request supersedes the window of the previous one.
+type syncCredits struct {
+	sync.Mutex
+	windows map[pb.OpenchainMessage_Type]*syncWindow
+}
+
+type syncWindow struct {
+	msgType       pb.OpenchainMessage_Type
+	correlationID uint64
+	credits       uint64
+	granted       chan struct{} // signalled when credits are granted
+	done          chan struct{} // closed when the window is superseded or closed
+}
+
+func newSyncCredits() *syncCredits {
+	return &syncCredits{windows: make(map[pb.OpenchainMessage_Type]*syncWindow)}
+}
+
+// open opens the window for the responses of type msgType to the request
+// with correlationID, without any credits yet
+func (sc *syncCredits) open(msgType pb.OpenchainMessage_Type, correlationID uint64) *syncWindow {
+	sc.Lock()
+	defer sc.Unlock()
+	if w, ok := sc.windows[msgType]; ok {
+		close(w.done)
+	}
+	w := &syncWindow{msgType: msgType, correlationID: correlationID, granted: make(chan struct{}, 1), done: make(chan struct{})}
+	sc.windows[msgType] = w
+	return w
+}
+
+// grant adds credits to the window for msgType, it returns false if the
+// window does not serve the request with correlationID
+func (sc *syncCredits) grant(msgType pb.OpenchainMessage_Type, correlationID uint64, credits uint64) bool {
+	sc.Lock()
+	defer sc.Unlock()
+	w, ok := sc.windows[msgType]
+	if !ok || w.correlationID != correlationID {
+		return false
+	}
+	w.credits += credits
+	select {
+	case w.granted <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// take takes a credit from w, waiting up to timeout for the peer to grant
+// one. A zero timeout waits until the window is superseded or closed.
+func (sc *syncCredits) take(w *syncWindow, timeout time.Duration) error {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		select {
+		case <-w.done:
+			return fmt.Errorf("Request for %s with correlationId = %d was superseded", w.msgType, w.correlationID)
+		default:
+		}
+		sc.Lock()
+		if w.credits > 0 {
+			w.credits--
+			sc.Unlock()
+			return nil
+		}
+		sc.Unlock()
+		select {
+		case <-w.granted:
+		case <-w.done:
+		case <-expired:
+			return fmt.Errorf("No credits granted for %s with correlationId = %d within %s", w.msgType, w.correlationID, timeout)
+		}
+	}
+}
+
+// finish closes w once all the responses were sent
+func (sc *syncCredits) finish(w *syncWindow) {
+	sc.Lock()
+	defer sc.Unlock()
+	if sc.windows[w.msgType] == w {
+		delete(sc.windows, w.msgType)
+		close(w.done)
+	}
+}
+
+// close closes all windows, when the chat with the peer ends
+func (sc *syncCredits) close() {
+	sc.Lock()
+	defer sc.Unlock()
+	for msgType, w := range sc.windows {
+		delete(sc.windows, msgType)
+		close(w.done)
+	}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Sync Blocks Handler
+//
+//-----------------------------------------------------------------------------
+
+type syncBlocksRequestHandler struct {
+	sync.Mutex
+	correlationID uint64
+	relay         *syncRelay
+}
+
+func (srh *syncBlocksRequestHandler) reset() {
+	if srh.relay != nil {
+		srh.relay.stop()
+		srh.relay = nil
+	}
+	srh.correlationID++
+}
+
+func (srh *syncBlocksRequestHandler) shouldHandle(syncBlocks *pb.SyncBlocks) bool {
+	return srh.relay != nil && syncBlocks.Range != nil && syncBlocks.Range.CorrelationId == srh.correlationID
+}
+
+func (srh *syncBlocksRequestHandler) createRequest(syncBlockRange *pb.SyncBlockRange) *pb.SyncBlockRange {
+	return &pb.SyncBlockRange{Start: syncBlockRange.Start, End: syncBlockRange.End, CorrelationId: srh.correlationID}
+}
+
+// start relays the responses to the current request through the returned
+// channel, which is closed when the handler is reset
+func (srh *syncBlocksRequestHandler) start(grant func(uint64)) <-chan *pb.SyncBlocks {
+	channel := make(chan *pb.SyncBlocks)
+	srh.relay = newSyncRelay(viper.GetInt("peer.sync.blocks.channelSize"), func(response interface{}, done <-chan struct{}) bool {
+		select {
+		case channel <- response.(*pb.SyncBlocks):
+			return true
+		case <-done:
+			return false
+		}
+	}, grant, func() { close(channel) })
+	return channel
+}
+
+func newSyncBlocksRequestHandler() *syncBlocksRequestHandler {
+	return &syncBlocksRequestHandler{}
+}
+
 //-----------------------------------------------------------------------------
 //
 // Sync State Snapshot Handler
@@ -36,29 +262,186 @@ import (
 type syncStateSnapshotRequestHandler struct {
 	sync.Mutex
 	correlationID uint64
-	channel       chan *pb.SyncStateSnapshot
+	relay         *syncRelay
 }
 
 func (srh *syncStateSnapshotRequestHandler) reset() {
-	close(srh.channel)
-	srh.channel = makeStateSnapshotChannel()
+	if srh.relay != nil {
+		srh.relay.stop()
+		srh.relay = nil
+	}
 	srh.correlationID++
 }
 
 func (srh *syncStateSnapshotRequestHandler) shouldHandle(syncStateSnapshot *pb.SyncStateSnapshot) bool {
-	return syncStateSnapshot.Request.CorrelationId == srh.correlationID
+	return srh.relay != nil && syncStateSnapshot.Request != nil && syncStateSnapshot.Request.CorrelationId == srh.correlationID
 }
 
 func (srh *syncStateSnapshotRequestHandler) createRequest() *pb.SyncStateSnapshotRequest {
 	return &pb.SyncStateSnapshotRequest{CorrelationId: srh.correlationID}
 }
 
-func makeStateSnapshotChannel() chan *pb.SyncStateSnapshot {
-	return make(chan *pb.SyncStateSnapshot, viper.GetInt("peer.sync.state.snapshot.channelSize"))
+// start relays the responses to the current request through the returned
+// channel, which is closed when the handler is reset
+func (srh *syncStateSnapshotRequestHandler) start(grant func(uint64)) <-chan *pb.SyncStateSnapshot {
+	channel := make(chan *pb.SyncStateSnapshot)
+	srh.relay = newSyncRelay(viper.GetInt("peer.sync.state.snapshot.channelSize"), func(response interface{}, done <-chan struct{}) bool {
+		select {
+		case channel <- response.(*pb.SyncStateSnapshot):
+			return true
+		case <-done:
+			return false
+		}
+	}, grant, func() { close(channel) })
+	return channel
 }
 
 func newSyncStateSnapshotRequestHandler() *syncStateSnapshotRequestHandler {
-	return &syncStateSnapshotRequestHandler{channel: makeStateSnapshotChannel()}
+	return &syncStateSnapshotRequestHandler{}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Sync State Chunk Handler
+//
+//-----------------------------------------------------------------------------
+
+type syncStateChunkRequestHandler struct {
+	sync.Mutex
+	correlationID uint64
+	channel       chan *pb.SyncStateChunk
+}
+
+func (srh *syncStateChunkRequestHandler) reset() {
+	close(srh.channel)
+	srh.channel = makeStateChunkChannel()
+	srh.correlationID++
+}
+
+func (srh *syncStateChunkRequestHandler) shouldHandle(syncStateChunk *pb.SyncStateChunk) bool {
+	return syncStateChunk.Request != nil && syncStateChunk.Request.CorrelationId == srh.correlationID
+}
+
+func (srh *syncStateChunkRequestHandler) createRequest(chunk uint64, stateHash []byte) *pb.SyncStateChunkRequest {
+	return &pb.SyncStateChunkRequest{CorrelationId: srh.correlationID, Chunk: chunk, StateHash: stateHash}
+}
+
+func makeStateChunkChannel() chan *pb.SyncStateChunk {
+	// Each request is answered by a single message
+	return make(chan *pb.SyncStateChunk, 1)
+}
+
+func newSyncStateChunkRequestHandler() *syncStateChunkRequestHandler {
+	return &syncStateChunkRequestHandler{channel: makeStateChunkChannel()}
+}
+
+// chunkSnapshot is the part of a state snapshot which serves state chunks
+type chunkSnapshot interface {
+	GetBlockNumber() uint64
+	GetStateHash() ([]byte, error)
+	GetNumChunks() (uint64, error)
+	GetChunk(chunk uint64) (*statemgmt.StateDelta, []byte, error)
+	Release()
+}
+
+// pinnedSnapshots keeps the state snapshot the opposite Peer Endpoint syncs
+// in chunks, so that it can fetch every chunk of its target although the
+// state moves on meanwhile. The snapshot which serves a chunk request is
+// pinned, and released once it was not used for timeout, or another one is
+// pinned. Requests for the pinned state hash are served from the snapshot.
+type pinnedSnapshots struct {
+	sync.Mutex
+	take    func() (chunkSnapshot, error)
+	timeout time.Duration // 0 serves every request from the current state
+	pinned  *pinnedSnapshot
+}
+
+type pinnedSnapshot struct {
+	chunkSnapshot
+	stateHash []byte
+	users     int
+	lastUsed  time.Time
+	retired   bool // released once the last user is done
+}
+
+func newPinnedSnapshots(take func() (chunkSnapshot, error), timeout time.Duration) *pinnedSnapshots {
+	return &pinnedSnapshots{take: take, timeout: timeout}
+}
+
+// acquire returns the pinned snapshot if it has the given state hash, or
+// else a snapshot of the current state, which is pinned if it has the given
+// state hash or none was given. The snapshot must be released after use.
+func (ps *pinnedSnapshots) acquire(stateHash []byte) (*pinnedSnapshot, error) {
+	ps.Lock()
+	defer ps.Unlock()
+	if p := ps.pinned; nil != p && 0 < len(stateHash) && bytes.Equal(stateHash, p.stateHash) {
+		p.users++
+		p.lastUsed = time.Now()
+		return p, nil
+	}
+
+	snapshot, err := ps.take()
+	if nil != err {
+		return nil, err
+	}
+	hash, err := snapshot.GetStateHash()
+	if nil != err {
+		snapshot.Release()
+		return nil, err
+	}
+	p := &pinnedSnapshot{chunkSnapshot: snapshot, stateHash: hash, users: 1, lastUsed: time.Now(), retired: true}
+	if 0 < ps.timeout && (0 == len(stateHash) || bytes.Equal(stateHash, hash)) {
+		ps.retire(ps.pinned)
+		p.retired = false
+		ps.pinned = p
+		ps.expireAfter(p, ps.timeout)
+	}
+	return p, nil
+}
+
+// release returns a snapshot obtained from acquire
+func (ps *pinnedSnapshots) release(p *pinnedSnapshot) {
+	ps.Lock()
+	defer ps.Unlock()
+	p.users--
+	if p.retired && 0 == p.users {
+		p.Release()
+	}
+}
+
+// expireAfter retires the pinned snapshot once it was not used for timeout
+func (ps *pinnedSnapshots) expireAfter(p *pinnedSnapshot, after time.Duration) {
+	time.AfterFunc(after, func() {
+		ps.Lock()
+		defer ps.Unlock()
+		if ps.pinned != p {
+			return
+		}
+		if idle := time.Since(p.lastUsed); idle < ps.timeout {
+			ps.expireAfter(p, ps.timeout-idle)
+			return
+		}
+		ps.retire(p)
+		ps.pinned = nil
+	})
+}
+
+// retire releases the snapshot once it is not used anymore, the caller
+// holds the lock
+func (ps *pinnedSnapshots) retire(p *pinnedSnapshot) {
+	if nil == p || p.retired {
+		return
+	}
+	p.retired = true
+	if 0 == p.users {
+		p.Release()
+	}
+}
+
+// reset releases the pinned snapshot
+func (ps *pinnedSnapshots) reset() {
+	ps.retire(ps.pinned)
+	ps.pinned = nil
 }
 
 //-----------------------------------------------------------------------------
@@ -69,22 +452,134 @@ func newSyncStateSnapshotRequestHandler() *syncStateSnapshotRequestHandler {
 
 type syncStateDeltasHandler struct {
 	sync.Mutex
-	channel chan *pb.SyncStateDeltas
+	correlationID uint64
+	relay         *syncRelay
 }
 
 func (ssdh *syncStateDeltasHandler) reset() {
-	close(ssdh.channel)
-	ssdh.channel = makeSyncStateDeltasChannel()
+	if ssdh.relay != nil {
+		ssdh.relay.stop()
+		ssdh.relay = nil
+	}
+	ssdh.correlationID++
+}
+
+func (ssdh *syncStateDeltasHandler) shouldHandle(syncStateDeltas *pb.SyncStateDeltas) bool {
+	return ssdh.relay != nil && syncStateDeltas.Range != nil && syncStateDeltas.Range.CorrelationId == ssdh.correlationID
 }
 
 func (ssdh *syncStateDeltasHandler) createRequest(syncBlockRange *pb.SyncBlockRange) *pb.SyncStateDeltasRequest {
-	return &pb.SyncStateDeltasRequest{Range: syncBlockRange}
+	return &pb.SyncStateDeltasRequest{Range: &pb.SyncBlockRange{Start: syncBlockRange.Start, End: syncBlockRange.End, CorrelationId: ssdh.correlationID}}
 }
 
-func makeSyncStateDeltasChannel() chan *pb.SyncStateDeltas {
-	return make(chan *pb.SyncStateDeltas, viper.GetInt("peer.sync.state.deltas.channelSize"))
+// start relays the responses to the current request through the returned
+// channel, which is closed when the handler is reset
+func (ssdh *syncStateDeltasHandler) start(grant func(uint64)) <-chan *pb.SyncStateDeltas {
+	channel := make(chan *pb.SyncStateDeltas)
+	ssdh.relay = newSyncRelay(viper.GetInt("peer.sync.state.deltas.channelSize"), func(response interface{}, done <-chan struct{}) bool {
+		select {
+		case channel <- response.(*pb.SyncStateDeltas):
+			return true
+		case <-done:
+			return false
+		}
+	}, grant, func() { close(channel) })
+	return channel
 }
 
 func newSyncStateDeltasHandler() *syncStateDeltasHandler {
-	return &syncStateDeltasHandler{channel: makeSyncStateDeltasChannel()}
+	return &syncStateDeltasHandler{}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Sync Block Headers Handler
+//
+//-----------------------------------------------------------------------------
+
+type syncBlockHeadersRequestHandler struct {
+	sync.Mutex
+	correlationID uint64
+	channel       chan *pb.SyncBlockHeaders
+}
+
+func (sbhh *syncBlockHeadersRequestHandler) reset() {
+	close(sbhh.channel)
+	// Each request is answered by a single message
+	sbhh.channel = make(chan *pb.SyncBlockHeaders, 1)
+	sbhh.correlationID++
+}
+
+func (sbhh *syncBlockHeadersRequestHandler) shouldHandle(syncBlockHeaders *pb.SyncBlockHeaders) bool {
+	return syncBlockHeaders.Range != nil && syncBlockHeaders.Range.CorrelationId == sbhh.correlationID
+}
+
+func (sbhh *syncBlockHeadersRequestHandler) createRequest(syncBlockRange *pb.SyncBlockRange) *pb.SyncBlockRange {
+	return &pb.SyncBlockRange{Start: syncBlockRange.Start, End: syncBlockRange.End, CorrelationId: sbhh.correlationID}
+}
+
+func newSyncBlockHeadersRequestHandler() *syncBlockHeadersRequestHandler {
+	return &syncBlockHeadersRequestHandler{channel: make(chan *pb.SyncBlockHeaders, 1)}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Sync Transaction Proof Handler
+//
+//-----------------------------------------------------------------------------
+
+type syncTransactionProofRequestHandler struct {
+	sync.Mutex
+	correlationID uint64
+	channel       chan *pb.TransactionProof
+}
+
+func (stph *syncTransactionProofRequestHandler) reset() {
+	close(stph.channel)
+	// Each request is answered by a single message
+	stph.channel = make(chan *pb.TransactionProof, 1)
+	stph.correlationID++
+}
+
+func (stph *syncTransactionProofRequestHandler) shouldHandle(transactionProof *pb.TransactionProof) bool {
+	return transactionProof.Request != nil && transactionProof.Request.CorrelationId == stph.correlationID
+}
+
+func (stph *syncTransactionProofRequestHandler) createRequest(uuid string) *pb.TransactionProofRequest {
+	return &pb.TransactionProofRequest{CorrelationId: stph.correlationID, Uuid: uuid}
+}
+
+func newSyncTransactionProofRequestHandler() *syncTransactionProofRequestHandler {
+	return &syncTransactionProofRequestHandler{channel: make(chan *pb.TransactionProof, 1)}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Sync Checkpoint Certificate Handler
+//
+//-----------------------------------------------------------------------------
+
+type syncCheckpointCertificateRequestHandler struct {
+	sync.Mutex
+	correlationID uint64
+	channel       chan *pb.SyncCheckpointCertificate
+}
+
+func (scch *syncCheckpointCertificateRequestHandler) reset() {
+	close(scch.channel)
+	// Each request is answered by a single message
+	scch.channel = make(chan *pb.SyncCheckpointCertificate, 1)
+	scch.correlationID++
+}
+
+func (scch *syncCheckpointCertificateRequestHandler) shouldHandle(syncCert *pb.SyncCheckpointCertificate) bool {
+	return syncCert.Request != nil && syncCert.Request.CorrelationId == scch.correlationID
+}
+
+func (scch *syncCheckpointCertificateRequestHandler) createRequest() *pb.CheckpointCertificateRequest {
+	return &pb.CheckpointCertificateRequest{CorrelationId: scch.correlationID}
+}
+
+func newSyncCheckpointCertificateRequestHandler() *syncCheckpointCertificateRequestHandler {
+	return &syncCheckpointCertificateRequestHandler{channel: make(chan *pb.SyncCheckpointCertificate, 1)}
 }
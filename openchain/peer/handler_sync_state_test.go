@@ -0,0 +1,428 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// newSyncPair returns a requestor and a sender chatting with each other,
+// once they exchanged their hellos
+func newSyncPair(t *testing.T) (*Handler, *testStream, *Handler, *testStream) {
+	requestor, _, requestorStream := newTestHandler(t, "vp1", true)
+	sender, _, senderStream := newTestHandler(t, "vp2", false)
+	requestorStream.pipe(sender)
+	senderStream.pipe(requestor)
+	for deadline := time.Now().Add(5 * time.Second); requestor.ProtocolVersion() == "" || sender.ProtocolVersion() == ""; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the hellos")
+		}
+	}
+	return requestor, requestorStream, sender, senderStream
+}
+
+func TestSyncBlocksSlowConsumer(t *testing.T) {
+	defer viper.Set("peer.sync.blocks.channelSize", viper.GetInt("peer.sync.blocks.channelSize"))
+	viper.Set("peer.sync.blocks.channelSize", 4)
+
+	requestor, requestorStream, sender, senderStream := newSyncPair(t)
+	defer requestor.Stop()
+	defer sender.Stop()
+
+	const numBlocks = 500
+	syncBlocks, err := requestor.RequestBlocks(&pb.SyncBlockRange{Start: 0, End: numBlocks - 1})
+	if err != nil {
+		t.Fatalf("Error requesting blocks: %s", err)
+	}
+	for i := uint64(0); i < numBlocks; i++ {
+		select {
+		case blocks, ok := <-syncBlocks:
+			if !ok {
+				t.Fatalf("Channel closed after %d blocks", i)
+			}
+			if blocks.Range.Start != i {
+				t.Fatalf("Expected block %d, got block %d", i, blocks.Range.Start)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for block %d", i)
+		}
+		if sent := senderStream.count(pb.OpenchainMessage_SYNC_BLOCKS); sent > int(i)+1+4 {
+			t.Fatalf("Sender did not pause for the slow consumer: sent %d blocks while %d were consumed", sent, i+1)
+		}
+		if i%50 == 0 {
+			// Be a slow consumer every now and then
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if len(senderStream.errors) != 0 || len(requestorStream.errors) != 0 {
+		t.Fatalf("Unexpected errors handling messages: %v %v", senderStream.errors, requestorStream.errors)
+	}
+	if credits := requestorStream.count(pb.OpenchainMessage_SYNC_CREDIT); credits >= numBlocks {
+		t.Errorf("Expected credits to be granted in batches, got %d grants for %d blocks", credits, numBlocks)
+	}
+}
+
+func TestSyncStateDeltasSlowConsumer(t *testing.T) {
+	defer viper.Set("peer.sync.state.deltas.channelSize", viper.GetInt("peer.sync.state.deltas.channelSize"))
+	viper.Set("peer.sync.state.deltas.channelSize", 1)
+
+	requestor, _, sender, senderStream := newSyncPair(t)
+	defer requestor.Stop()
+	defer sender.Stop()
+
+	const numBlocks = 200
+	syncStateDeltas, err := requestor.RequestStateDeltas(&pb.SyncBlockRange{Start: 1, End: numBlocks})
+	if err != nil {
+		t.Fatalf("Error requesting state deltas: %s", err)
+	}
+	for i := uint64(1); i <= numBlocks; i++ {
+		time.Sleep(time.Millisecond)
+		select {
+		case deltas, ok := <-syncStateDeltas:
+			if !ok {
+				t.Fatalf("Channel closed after %d deltas", i-1)
+			}
+			if deltas.Range.Start != i || len(deltas.Deltas) != 1 {
+				t.Fatalf("Expected the delta of block %d, got %v", i, deltas.Range)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for the delta of block %d", i)
+		}
+		if sent := senderStream.count(pb.OpenchainMessage_SYNC_STATE_DELTAS); sent > int(i)+1 {
+			t.Fatalf("Sender did not pause for the slow consumer: sent %d deltas while %d were consumed", sent, i)
+		}
+	}
+}
+
+func TestSyncStateSnapshotSlowConsumer(t *testing.T) {
+	defer viper.Set("peer.sync.state.snapshot.channelSize", viper.GetInt("peer.sync.state.snapshot.channelSize"))
+	viper.Set("peer.sync.state.snapshot.channelSize", 1)
+
+	const numKeys = 200
+	l := ledger.InitTestLedger(t)
+	l.BeginTxBatch(1)
+	l.TxBegin("txUuid")
+	for i := 0; i < numKeys; i++ {
+		l.SetState("chaincode", fmt.Sprintf("key %03d", i), []byte("value"))
+	}
+	l.TxFinished("txUuid", true)
+	if err := l.CommitTxBatch(1, []*pb.Transaction{}, nil, []byte("proof")); err != nil {
+		t.Fatalf("Error committing the state: %s", err)
+	}
+
+	requestor, requestorStream, sender, senderStream := newSyncPair(t)
+	sender.Coordinator.(*testCoordinator).ledger = l
+	defer requestor.Stop()
+	defer sender.Stop()
+
+	syncStateSnapshot, err := requestor.RequestStateSnapshot()
+	if err != nil {
+		t.Fatalf("Error requesting the state snapshot: %s", err)
+	}
+	// The snapshot has a message per key, then a terminating one
+	for i := uint64(0); i <= numKeys; i++ {
+		time.Sleep(time.Millisecond)
+		select {
+		case snapshot, ok := <-syncStateSnapshot:
+			if !ok {
+				t.Fatalf("Channel closed after %d snapshot messages", i)
+			}
+			if snapshot.Sequence != i {
+				t.Fatalf("Expected snapshot message %d, got %d", i, snapshot.Sequence)
+			}
+			if terminating := len(snapshot.Delta) == 0; terminating != (i == numKeys) {
+				t.Fatalf("Expected snapshot message %d to be terminating: %v", i, i == numKeys)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for snapshot message %d", i)
+		}
+		if sent := senderStream.count(pb.OpenchainMessage_SYNC_STATE_SNAPSHOT); sent > int(i)+2 {
+			t.Fatalf("Sender did not pause for the slow consumer: sent %d snapshot messages while %d were consumed", sent, i+1)
+		}
+	}
+	if len(senderStream.errors) != 0 || len(requestorStream.errors) != 0 {
+		t.Fatalf("Unexpected errors handling messages: %v %v", senderStream.errors, requestorStream.errors)
+	}
+}
+
+func TestSyncWithoutCredits(t *testing.T) {
+	defer func(version string) { messageVersions[pb.OpenchainMessage_SYNC_CREDIT] = version }(messageVersions[pb.OpenchainMessage_SYNC_CREDIT])
+	messageVersions[pb.OpenchainMessage_SYNC_CREDIT] = "0.4.0"
+
+	// Peers speaking a protocol version without credits send right away
+	requestor, requestorStream, sender, _ := newSyncPair(t)
+	defer requestor.Stop()
+	defer sender.Stop()
+
+	const numBlocks = 10
+	syncBlocks, err := requestor.RequestBlocks(&pb.SyncBlockRange{Start: 0, End: numBlocks - 1})
+	if err != nil {
+		t.Fatalf("Error requesting blocks: %s", err)
+	}
+	for i := uint64(0); i < numBlocks; i++ {
+		select {
+		case blocks := <-syncBlocks:
+			if blocks == nil || blocks.Range.Start != i {
+				t.Fatalf("Expected block %d, got %v", i, blocks)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for block %d, the sender waited for credits", i)
+		}
+	}
+	if credits := requestorStream.count(pb.OpenchainMessage_SYNC_CREDIT); credits != 0 {
+		t.Fatalf("Expected no credits to be granted to a peer without credits, granted %d times", credits)
+	}
+}
+
+func TestSyncSupersededRequest(t *testing.T) {
+	requestor, _, sender, senderStream := newSyncPair(t)
+	defer requestor.Stop()
+	defer sender.Stop()
+
+	// Abandon the first request, the sender moves on to the second one
+	first, err := requestor.RequestBlocks(&pb.SyncBlockRange{Start: 0, End: 1000})
+	if err != nil {
+		t.Fatalf("Error requesting blocks: %s", err)
+	}
+	second, err := requestor.RequestBlocks(&pb.SyncBlockRange{Start: 5, End: 6})
+	if err != nil {
+		t.Fatalf("Error requesting blocks: %s", err)
+	}
+	if _, ok := <-first; ok {
+		// The first request may have been served a block before it was superseded
+		for range first {
+		}
+	}
+	for _, expected := range []uint64{5, 6} {
+		select {
+		case blocks := <-second:
+			if blocks == nil || blocks.Range.Start != expected {
+				t.Fatalf("Expected block %d, got %v", expected, blocks)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for block %d", expected)
+		}
+	}
+	if sent := senderStream.count(pb.OpenchainMessage_SYNC_BLOCKS); sent > 2+2*viper.GetInt("peer.sync.blocks.channelSize") {
+		t.Fatalf("Expected the sender to stop sending for the superseded request, sent %d blocks", sent)
+	}
+}
+
+func TestSyncCreditsExceeded(t *testing.T) {
+	defer viper.Set("peer.sync.blocks.channelSize", viper.GetInt("peer.sync.blocks.channelSize"))
+	viper.Set("peer.sync.blocks.channelSize", 2)
+
+	requestor, _, requestorStream := newTestHandler(t, "vp1", true)
+	defer requestor.Stop()
+	requestor.HandleMessage(mustHello(t, "vp2"))
+
+	syncBlocks, err := requestor.RequestBlocks(&pb.SyncBlockRange{Start: 0, End: 9})
+	if err != nil {
+		t.Fatalf("Error requesting blocks: %s", err)
+	}
+	correlationID := requestor.syncBlocksRequestHandler.correlationID
+	requestorStream.take()
+
+	// Nobody consumes the blocks, so a sender ignoring its credits overruns
+	// the relay, which buffers 2 blocks and hands a third to the consumer
+	var overrun error
+	for i := uint64(0); i < 4 && overrun == nil; i++ {
+		payload, _ := proto.Marshal(&pb.SyncBlocks{Range: &pb.SyncBlockRange{Start: i, End: i, CorrelationId: correlationID}})
+		overrun = requestor.HandleMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_SYNC_BLOCKS, Payload: payload})
+		time.Sleep(10 * time.Millisecond)
+	}
+	if overrun == nil {
+		t.Fatalf("Expected a sender exceeding its credits to be a protocol error")
+	}
+	select {
+	case <-syncBlocks:
+		for range syncBlocks {
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the overrun stream to be discarded")
+	}
+}
+
+func TestSyncCreditsTake(t *testing.T) {
+	sc := newSyncCredits()
+	w := sc.open(pb.OpenchainMessage_SYNC_BLOCKS, 1)
+	if err := sc.take(w, 10*time.Millisecond); err == nil {
+		t.Fatalf("Expected to time out without credits")
+	}
+	if sc.grant(pb.OpenchainMessage_SYNC_BLOCKS, 2, 1) {
+		t.Fatalf("Expected credits for another request to be refused")
+	}
+	go sc.grant(pb.OpenchainMessage_SYNC_BLOCKS, 1, 2)
+	for i := 0; i < 2; i++ {
+		if err := sc.take(w, time.Second); err != nil {
+			t.Fatalf("Expected granted credit %d: %s", i, err)
+		}
+	}
+
+	taken := make(chan error)
+	go func() { taken <- sc.take(w, 0) }()
+	sc.open(pb.OpenchainMessage_SYNC_BLOCKS, 2)
+	select {
+	case err := <-taken:
+		if err == nil {
+			t.Fatalf("Expected a superseded request to stop waiting for credits with an error")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a superseded request to stop waiting for credits")
+	}
+}
+
+// mustHello returns the hello of the peer with the given name
+func mustHello(t *testing.T, name string) *pb.OpenchainMessage {
+	hello, err := newTestCoordinator(name).NewOpenchainDiscoveryHello()
+	if err != nil {
+		t.Fatalf("Error creating hello: %s", err)
+	}
+	return hello
+}
+
+// fakeSnapshot is a state snapshot which counts its releases
+type fakeSnapshot struct {
+	hash     string
+	released int
+}
+
+func (s *fakeSnapshot) GetBlockNumber() uint64        { return 0 }
+func (s *fakeSnapshot) GetStateHash() ([]byte, error) { return []byte(s.hash), nil }
+func (s *fakeSnapshot) GetNumChunks() (uint64, error) { return 1, nil }
+func (s *fakeSnapshot) Release()                      { s.released++ }
+func (s *fakeSnapshot) GetChunk(uint64) (*statemgmt.StateDelta, []byte, error) {
+	return statemgmt.NewStateDelta(), nil, nil
+}
+
+// fakeState takes fakeSnapshots of a state which moves on
+type fakeState struct {
+	sync.Mutex
+	hash      string
+	snapshots []*fakeSnapshot
+}
+
+func (s *fakeState) take() (chunkSnapshot, error) {
+	s.Lock()
+	defer s.Unlock()
+	snapshot := &fakeSnapshot{hash: s.hash}
+	s.snapshots = append(s.snapshots, snapshot)
+	return snapshot, nil
+}
+
+func (s *fakeState) move(hash string) {
+	s.Lock()
+	defer s.Unlock()
+	s.hash = hash
+}
+
+func (s *fakeState) released(i int) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.snapshots[i].released
+}
+
+func TestPinnedSnapshots(t *testing.T) {
+	state := &fakeState{hash: "a"}
+	ps := newPinnedSnapshots(state.take, time.Hour)
+
+	first, _ := ps.acquire(nil)
+	ps.release(first)
+	if "a" != string(first.stateHash) || 0 != state.released(0) {
+		t.Fatalf("The snapshot serving the first chunk should have been pinned")
+	}
+
+	// The state moves on, but the requestor still gets chunks of its target
+	state.move("b")
+	p, _ := ps.acquire([]byte("a"))
+	if p != first || 1 != len(state.snapshots) {
+		t.Fatalf("A request for the pinned state hash should have been served from the pinned snapshot")
+	}
+
+	// A new sync pins the current state, the old snapshot is released once the last chunk of it was sent
+	next, _ := ps.acquire(nil)
+	if "b" != string(next.stateHash) || 0 != state.released(0) {
+		t.Fatalf("The pinned snapshot should not have been released while in use")
+	}
+	ps.release(p)
+	if 1 != state.released(0) {
+		t.Fatalf("The snapshot should have been released once it was not pinned nor in use, released %d times", state.released(0))
+	}
+	ps.release(next)
+
+	// A request for an unknown state hash is served from the current state without pinning it
+	other, _ := ps.acquire([]byte("c"))
+	ps.release(other)
+	if 1 != state.released(2) || next != ps.pinned {
+		t.Fatalf("A snapshot not having the requested state hash should have been released, not pinned")
+	}
+
+	ps.Lock()
+	ps.reset()
+	ps.Unlock()
+	if 1 != state.released(1) || nil != ps.pinned {
+		t.Fatalf("Resetting should have released the pinned snapshot")
+	}
+}
+
+func TestPinnedSnapshotsExpire(t *testing.T) {
+	state := &fakeState{hash: "a"}
+	ps := newPinnedSnapshots(state.take, 20*time.Millisecond)
+
+	p, _ := ps.acquire(nil)
+	ps.release(p)
+	time.Sleep(10 * time.Millisecond)
+	p, _ = ps.acquire([]byte("a"))
+	ps.release(p)
+	if 1 != len(state.snapshots) || 0 != state.released(0) {
+		t.Fatalf("The snapshot should have stayed pinned while in use")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if 1 != state.released(0) {
+		t.Fatalf("The idle snapshot should have been released")
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	if nil != ps.pinned {
+		t.Fatalf("The idle snapshot should not be pinned anymore")
+	}
+}
+
+func TestPinnedSnapshotsDisabled(t *testing.T) {
+	state := &fakeState{hash: "a"}
+	ps := newPinnedSnapshots(state.take, 0)
+
+	p, _ := ps.acquire(nil)
+	ps.release(p)
+	if 1 != state.released(0) || nil != ps.pinned {
+		t.Fatalf("Without a pin timeout every snapshot should have been released after use")
+	}
+}
@@ -0,0 +1,448 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/crypto"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt/state"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// testSecHelper signs by prefixing messages with its id. Ids starting with
+// "vp" belong to validators.
+type testSecHelper struct {
+	crypto.Peer
+	id []byte
+}
+
+func (s *testSecHelper) GetID() []byte {
+	return s.id
+}
+
+func (s *testSecHelper) Sign(msg []byte) ([]byte, error) {
+	return append(append([]byte{}, s.id...), msg...), nil
+}
+
+func (s *testSecHelper) Verify(vkID, signature, message []byte) error {
+	if !bytes.HasPrefix(vkID, []byte("vp")) {
+		return fmt.Errorf("not a validator")
+	}
+	return s.VerifyPeer(vkID, signature, message)
+}
+
+func (s *testSecHelper) VerifyPeer(vkID, signature, message []byte) error {
+	if !bytes.Equal(signature, append(append([]byte{}, vkID...), message...)) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// testCoordinator says hello as the peer with the given id and type, serves
+// blocks and state deltas for any block number, and the state of its ledger
+// if it has one. It records which handlers were registered and which heads
+// were announced.
+type testCoordinator struct {
+	MessageHandlerCoordinator
+	secHelper  *testSecHelper
+	typ        pb.PeerEndpoint_Type
+	ledger     *ledger.Ledger
+	registered []MessageHandler
+	heads      []*pb.BlockchainInfo
+}
+
+// newTestCoordinator returns the coordinator of a validator if id starts
+// with "vp", else of a non-validating peer
+func newTestCoordinator(id string) *testCoordinator {
+	typ := pb.PeerEndpoint_NON_VALIDATOR
+	if strings.HasPrefix(id, "vp") {
+		typ = pb.PeerEndpoint_VALIDATOR
+	}
+	return &testCoordinator{secHelper: &testSecHelper{id: []byte(id)}, typ: typ}
+}
+
+func (c *testCoordinator) GetSecHelper() crypto.Peer {
+	return c.secHelper
+}
+
+func (c *testCoordinator) GetBlockByNumber(blockNumber uint64) (*pb.Block, error) {
+	return pb.NewBlock(nil, []byte(fmt.Sprintf("block %d", blockNumber))), nil
+}
+
+func (c *testCoordinator) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
+	delta := statemgmt.NewStateDelta()
+	delta.Set("chaincode", fmt.Sprintf("key %d", blockNumber), []byte("value"), nil)
+	return delta, nil
+}
+
+func (c *testCoordinator) GetStateSnapshot() (*state.StateSnapshot, error) {
+	if c.ledger == nil {
+		return nil, fmt.Errorf("no state")
+	}
+	return c.ledger.GetStateSnapshot()
+}
+
+func (c *testCoordinator) GetPeers() (*pb.PeersMessage, error) {
+	return &pb.PeersMessage{}, nil
+}
+
+func (c *testCoordinator) PeersDiscovered(*pb.PeersMessage) error {
+	return nil
+}
+
+func (c *testCoordinator) BlockHeadReceived(head *pb.BlockchainInfo, from *pb.PeerEndpoint) error {
+	c.heads = append(c.heads, head)
+	return nil
+}
+
+func (c *testCoordinator) RegisterHandler(messageHandler MessageHandler) error {
+	c.registered = append(c.registered, messageHandler)
+	return nil
+}
+
+func (c *testCoordinator) DeregisterHandler(messageHandler MessageHandler) error {
+	return nil
+}
+
+func (c *testCoordinator) NewOpenchainDiscoveryHello() (*pb.OpenchainMessage, error) {
+	genesis, _ := c.GetBlockByNumber(0)
+	genesisHash, err := genesis.GetHash()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, authNonceSize)
+	rand.Read(nonce)
+	data, err := proto.Marshal(&pb.HelloMessage{
+		PeerEndpoint:    &pb.PeerEndpoint{ID: &pb.PeerID{Name: string(c.secHelper.id)}, Address: string(c.secHelper.id) + ":30303", Type: c.typ, PkiID: c.secHelper.id},
+		NetworkID:       viper.GetString("peer.networkId"),
+		GenesisHash:     genesisHash,
+		ProtocolVersion: viper.GetString("peer.version"),
+		Nonce:           nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	signature, _ := c.secHelper.Sign(data)
+	return &pb.OpenchainMessage{Type: pb.OpenchainMessage_DISC_HELLO, Payload: data, Signature: signature}, nil
+}
+
+// testStream records the messages sent through it and counts them by type.
+// Once piped, it hands them to the handler at the other end instead.
+type testStream struct {
+	sync.Mutex
+	sent   []*pb.OpenchainMessage
+	counts map[pb.OpenchainMessage_Type]int
+	out    chan *pb.OpenchainMessage
+	errors []error
+}
+
+func (s *testStream) Send(msg *pb.OpenchainMessage) error {
+	s.Lock()
+	if s.counts == nil {
+		s.counts = make(map[pb.OpenchainMessage_Type]int)
+	}
+	s.counts[msg.Type]++
+	out := s.out
+	if out == nil {
+		s.sent = append(s.sent, msg)
+	}
+	s.Unlock()
+	if out != nil {
+		out <- msg
+	}
+	return nil
+}
+
+func (s *testStream) Recv() (*pb.OpenchainMessage, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (s *testStream) take() []*pb.OpenchainMessage {
+	s.Lock()
+	defer s.Unlock()
+	sent := s.sent
+	s.sent = nil
+	return sent
+}
+
+func (s *testStream) count(msgType pb.OpenchainMessage_Type) int {
+	s.Lock()
+	defer s.Unlock()
+	return s.counts[msgType]
+}
+
+// pipe hands the messages sent so far and from now on to the handler to
+func (s *testStream) pipe(to *Handler) {
+	out := make(chan *pb.OpenchainMessage, 1000)
+	s.Lock()
+	for _, msg := range s.sent {
+		out <- msg
+	}
+	s.sent = nil
+	s.out = out
+	s.Unlock()
+	go func() {
+		for msg := range out {
+			if err := to.HandleMessage(msg); err != nil {
+				s.Lock()
+				s.errors = append(s.errors, err)
+				s.Unlock()
+			}
+		}
+	}()
+}
+
+// queueStream receives the queued messages, then EOF
+type queueStream struct {
+	testStream
+	queue []*pb.OpenchainMessage
+}
+
+func (s *queueStream) Recv() (*pb.OpenchainMessage, error) {
+	if len(s.queue) == 0 {
+		return nil, io.EOF
+	}
+	msg := s.queue[0]
+	s.queue = s.queue[1:]
+	return msg, nil
+}
+
+func newTestHandler(t *testing.T, id string, initiatedStream bool) (*Handler, *testCoordinator, *testStream) {
+	return newTestHandlerFor(t, newTestCoordinator(id), initiatedStream)
+}
+
+func newTestHandlerFor(t *testing.T, coord *testCoordinator, initiatedStream bool) (*Handler, *testCoordinator, *testStream) {
+	stream := &testStream{}
+	handler, err := NewPeerHandler(coord, stream, initiatedStream, nil)
+	if err != nil {
+		t.Fatalf("Error creating handler for %s: %s", coord.secHelper.id, err)
+	}
+	return handler.(*Handler), coord, stream
+}
+
+// genesisCoordinator only knows the genesis block
+type genesisCoordinator struct {
+	MessageHandlerCoordinator
+	genesis *pb.Block
+}
+
+func (c *genesisCoordinator) GetBlockByNumber(blockNumber uint64) (*pb.Block, error) {
+	return c.genesis, nil
+}
+
+func TestHandlerCheckHello(t *testing.T) {
+	defer viper.Set("peer.networkId", viper.GetString("peer.networkId"))
+	defer viper.Set("peer.version", viper.GetString("peer.version"))
+	viper.Set("peer.networkId", "test")
+	viper.Set("peer.version", "1.3.0")
+
+	genesis := pb.NewBlock(nil, []byte("genesis"))
+	genesisHash, _ := genesis.GetHash()
+	d := &Handler{Coordinator: &genesisCoordinator{genesis: genesis}}
+	hello := func(networkID string, genesisHash []byte, version string) *pb.HelloMessage {
+		return &pb.HelloMessage{
+			PeerEndpoint:    &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}},
+			NetworkID:       networkID,
+			GenesisHash:     genesisHash,
+			ProtocolVersion: version,
+		}
+	}
+
+	if reason := d.checkHello(hello("test", genesisHash, "1.5.2")); reason != nil {
+		t.Fatalf("Expected hello to be accepted, got %s: %s", reason.Reason, reason.Detail)
+	}
+	if d.ProtocolVersion() != "1.3.0" {
+		t.Fatalf("Expected protocol version 1.3.0, got %s", d.ProtocolVersion())
+	}
+
+	for _, c := range []struct {
+		hello  *pb.HelloMessage
+		reason pb.DisconnectMessage_Reason
+	}{
+		{hello("staging", genesisHash, "1.3.0"), pb.DisconnectMessage_NETWORK_MISMATCH},
+		{hello("test", []byte("other genesis"), "1.3.0"), pb.DisconnectMessage_GENESIS_MISMATCH},
+		{hello("test", nil, "1.3.0"), pb.DisconnectMessage_GENESIS_MISMATCH},
+		{hello("test", genesisHash, "2.0.0"), pb.DisconnectMessage_VERSION_MISMATCH},
+		{hello("test", genesisHash, ""), pb.DisconnectMessage_VERSION_MISMATCH},
+	} {
+		reason := d.checkHello(c.hello)
+		if reason == nil {
+			t.Errorf("Expected hello %v to be rejected with %s", c.hello, c.reason)
+		} else if reason.Reason != c.reason {
+			t.Errorf("Expected hello %v to be rejected with %s, got %s: %s", c.hello, c.reason, reason.Reason, reason.Detail)
+		}
+	}
+
+	// Peers which do not hash block headers keep talking, in their version
+	viper.Set("peer.version", "0.3.0")
+	if reason := d.checkHello(hello("test", genesisHash, "0.2.0")); reason != nil {
+		t.Fatalf("Expected a hello of a minor version before ours to be accepted, got %s: %s", reason.Reason, reason.Detail)
+	}
+	if d.ProtocolVersion() != "0.2.0" {
+		t.Fatalf("Expected protocol version 0.2.0, got %s", d.ProtocolVersion())
+	}
+}
+
+func TestHandlerCheckHelloWithoutChain(t *testing.T) {
+	defer viper.Set("peer.networkId", viper.GetString("peer.networkId"))
+	defer viper.Set("peer.genesisHash", viper.GetString("peer.genesisHash"))
+	viper.Set("peer.networkId", "test")
+	viper.Set("peer.genesisHash", "")
+
+	genesisHash, _ := pb.NewBlock(nil, []byte("genesis")).GetHash()
+	d := &Handler{Coordinator: &genesisCoordinator{}}
+	hello := &pb.HelloMessage{
+		PeerEndpoint:    &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}},
+		NetworkID:       "test",
+		ProtocolVersion: viper.GetString("peer.version"),
+	}
+	if reason := d.checkHello(hello); reason != nil {
+		t.Fatalf("Expected peers without a chain nor a configured genesis hash to talk, got %s: %s", reason.Reason, reason.Detail)
+	}
+
+	viper.Set("peer.genesisHash", hex.EncodeToString(genesisHash))
+	if reason := d.checkHello(hello); reason == nil || reason.Reason != pb.DisconnectMessage_GENESIS_MISMATCH {
+		t.Fatalf("Expected a hello without a genesis hash to be rejected once the genesis hash is configured, got %v", reason)
+	}
+	hello.GenesisHash = genesisHash
+	if reason := d.checkHello(hello); reason != nil {
+		t.Fatalf("Expected a hello with the configured genesis hash to be accepted, got %s: %s", reason.Reason, reason.Detail)
+	}
+}
+
+func TestHandlerMessageVersions(t *testing.T) {
+	ping := &pb.OpenchainMessage{Type: pb.OpenchainMessage_DISC_PING}
+	d := &Handler{ToPeerEndpoint: &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp1"}}, protocolVersion: "0.2.1"}
+	if err := d.checkMessageVersion(ping); err == nil {
+		t.Fatalf("Expected a message introduced in a later protocol version to be refused")
+	}
+	if err := d.checkMessageVersion(&pb.OpenchainMessage{Type: pb.OpenchainMessage_DISC_HELLO}); err != nil {
+		t.Fatalf("Expected a message in every protocol version to be allowed: %s", err)
+	}
+	if d.keepAlive(time.Nanosecond, time.Nanosecond) {
+		t.Fatalf("Expected a peer which cannot answer pings not to be timed out")
+	}
+	handlers := map[pb.PeerID]MessageHandler{*d.ToPeerEndpoint.ID: d}
+	if len(speakingHandlers(handlers, pb.OpenchainMessage_GOSSIP_BLOCK_HEADER)) != 0 {
+		t.Fatalf("Expected a peer of protocol version 0.2.1 not to take block announcements")
+	}
+	d.protocolVersion = "0.3.0"
+	if err := d.checkMessageVersion(ping); err != nil {
+		t.Fatalf("Expected a message of the negotiated protocol version to be allowed: %s", err)
+	}
+	if len(speakingHandlers(handlers, pb.OpenchainMessage_GOSSIP_BLOCK_HEADER)) != 1 {
+		t.Fatalf("Expected a peer of protocol version 0.3.0 to take block announcements")
+	}
+}
+
+// chatTestHandler fails to handle any message with err
+type chatTestHandler struct {
+	*connTestHandler
+	err error
+}
+
+func (h *chatTestHandler) HandleMessage(msg *pb.OpenchainMessage) error {
+	return h.err
+}
+
+func (h *chatTestHandler) Stop() error {
+	return nil
+}
+
+// onceStream receives a single message
+type onceStream struct {
+	received bool
+}
+
+func (s *onceStream) Send(msg *pb.OpenchainMessage) error {
+	return nil
+}
+
+func (s *onceStream) Recv() (*pb.OpenchainMessage, error) {
+	if s.received {
+		return nil, io.EOF
+	}
+	s.received = true
+	return &pb.OpenchainMessage{Type: pb.OpenchainMessage_DISC_DISCONNECT}, nil
+}
+
+func TestNextChatRetryDelay(t *testing.T) {
+	disconnect := func(reason pb.DisconnectMessage_Reason) error {
+		return &DisconnectError{Reason: &pb.DisconnectMessage{Reason: reason}, Remote: true}
+	}
+	for i, c := range []struct {
+		delay  time.Duration
+		err    error
+		next   time.Duration
+		giveUp bool
+	}{
+		{chatRetryDelay, disconnect(pb.DisconnectMessage_NETWORK_MISMATCH), 0, true},
+		{chatRetryDelay, disconnect(pb.DisconnectMessage_GENESIS_MISMATCH), 0, true},
+		{chatRetryDelay, disconnect(pb.DisconnectMessage_VERSION_MISMATCH), 0, true},
+		{chatRetryDelay, disconnect(pb.DisconnectMessage_AUTHENTICATION_FAILED), 2 * chatRetryDelay, false},
+		{chatRetryDelay, disconnect(pb.DisconnectMessage_TOO_MANY_PEERS), 2 * chatRetryDelay, false},
+		{chatRetryDelay, disconnect(pb.DisconnectMessage_UNDEFINED), 2 * chatRetryDelay, false},
+		{chatRetryDelayMax, disconnect(pb.DisconnectMessage_TOO_MANY_PEERS), chatRetryDelayMax, false},
+		{chatRetryDelayMax, io.EOF, chatRetryDelay, false},
+		{chatRetryDelayMax, nil, chatRetryDelay, false},
+	} {
+		next, giveUp := nextChatRetryDelay(c.delay, c.err)
+		if giveUp != c.giveUp || (!giveUp && next != c.next) {
+			t.Errorf("Case %d: expected to wait %v or give up %v after %v, got %v and %v", i, c.next, c.giveUp, c.err, next, giveUp)
+		}
+	}
+}
+
+func TestChatDisconnectPenalty(t *testing.T) {
+	for i, c := range []struct {
+		err       error
+		penalized bool
+	}{
+		{&DisconnectError{Reason: &pb.DisconnectMessage{Reason: pb.DisconnectMessage_NETWORK_MISMATCH}, Remote: true}, false},
+		{&DisconnectError{Reason: &pb.DisconnectMessage{Reason: pb.DisconnectMessage_TOO_MANY_PEERS}}, false},
+		{&DisconnectError{Reason: &pb.DisconnectMessage{Reason: pb.DisconnectMessage_NETWORK_MISMATCH}}, true},
+		{fmt.Errorf("garbled message"), true},
+	} {
+		p := &PeerImpl{handlerMap: &handlerMap{m: make(map[pb.PeerID]MessageHandler)}, discovery: newDiscoveryStore(false)}
+		handler := &chatTestHandler{connTestHandler: newConnTestHandler("vp1", pb.PeerEndpoint_VALIDATOR, false), err: c.err}
+		p.handlerFactory = func(MessageHandlerCoordinator, ChatStream, bool, MessageHandler) (MessageHandler, error) {
+			return handler, nil
+		}
+		p.handleChat(context.Background(), &onceStream{}, false)
+		if penalized := p.discovery.reputation(handler.identity) < 0; penalized != c.penalized {
+			t.Errorf("Case %d: expected the peer penalized %v for %s, was %v", i, c.penalized, c.err, penalized)
+		}
+	}
+}
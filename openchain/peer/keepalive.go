@@ -0,0 +1,144 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/looplab/fsm"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// The vendored gRPC has no keepalive of its own, so the TCP connections
+// under the gRPC streams send keepalive probes, which detect peers whose
+// host went away. The handlers ping the peers which went quiet, which
+// detects peers which are up but no longer serve the chat.
+
+// keepAliveDialer dials peers with TCP keepalive probes sent every period
+func keepAliveDialer(period time.Duration) func(string, time.Duration) (net.Conn, error) {
+	return func(address string, timeout time.Duration) (net.Conn, error) {
+		dialer := &net.Dialer{Timeout: timeout, KeepAlive: period}
+		return dialer.Dial("tcp", address)
+	}
+}
+
+type keepAliveListener struct {
+	net.Listener
+	period time.Duration
+}
+
+func (l *keepAliveListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(true)
+		tcpConn.SetKeepAlivePeriod(l.period)
+	}
+	return conn, nil
+}
+
+// NewKeepAliveListener returns a listener whose accepted TCP connections
+// send keepalive probes every peer.keepalive.tcpPeriod, or lis itself if
+// the period is not set
+func NewKeepAliveListener(lis net.Listener) net.Listener {
+	period := viper.GetDuration("peer.keepalive.tcpPeriod")
+	if period <= 0 {
+		return lis
+	}
+	return &keepAliveListener{Listener: lis, period: period}
+}
+
+// touch records that a message was received from the peer
+func (d *Handler) touch() {
+	atomic.StoreInt64(&d.lastReceived, time.Now().UnixNano())
+}
+
+// idle returns how long ago the last message was received from the peer
+func (d *Handler) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&d.lastReceived)))
+}
+
+// beforePing answers a ping of the peer
+func (d *Handler) beforePing(e *fsm.Event) {
+	if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_DISC_PONG}); err != nil {
+		e.Cancel(fmt.Errorf("Error sending %s: %s", pb.OpenchainMessage_DISC_PONG, err))
+	}
+}
+
+// keepAlive pings the peer if it sent nothing for interval, and closes the
+// chat if it sent nothing, answers to pings included, for timeout. It
+// returns whether the chat was closed. A peer too old to answer pings is
+// left to the TCP keepalive.
+func (d *Handler) keepAlive(interval time.Duration, timeout time.Duration) bool {
+	if !d.speaks(messageVersions[pb.OpenchainMessage_DISC_PING]) {
+		return false
+	}
+	idle := d.idle()
+	if timeout > 0 && idle >= timeout {
+		peerLogger.Warning("Peer %s sent nothing for %s, closing the chat", d.ToPeerEndpoint, idle)
+		d.close()
+		return true
+	}
+	if idle >= interval {
+		if err := d.SendMessage(&pb.OpenchainMessage{Type: pb.OpenchainMessage_DISC_PING}); err != nil {
+			peerLogger.Debug("Error sending %s to %s: %s", pb.OpenchainMessage_DISC_PING, d.ToPeerEndpoint, err)
+		}
+	}
+	return false
+}
+
+// Closed returns a channel which is closed when the chat with the peer has
+// to end, because the peer stopped responding or was evicted
+func (d *Handler) Closed() <-chan struct{} {
+	return d.closed
+}
+
+func (d *Handler) close() {
+	d.closeOnce.Do(func() { close(d.closed) })
+}
+
+// Evict ends the chat with the peer, telling it why
+func (d *Handler) Evict(reason *pb.DisconnectMessage) {
+	sent := make(chan struct{})
+	go func() {
+		d.disconnect(reason)
+		close(sent)
+	}()
+	go func() {
+		// A stuck peer may never take the message
+		select {
+		case <-sent:
+		case <-time.After(defaultTimeout):
+		}
+		d.close()
+	}()
+}
+
+// Outbound reports whether this Peer dialed the peer
+func (d *Handler) Outbound() bool {
+	return d.initiatedStream
+}
@@ -0,0 +1,721 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+	"github.com/tecbot/gorocksdb"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/db"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger"
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+const lightHeaderKeyPrefix = "light.header."
+
+var lightCertificateKey = []byte("light.certificate")
+
+// CheckpointVerifier checks that a stable checkpoint certificate carries at
+// least quorum checkpoints for its block, each from a distinct replica and
+// with a signature accepted by verify. The consensus plugin which produces
+// the certificates provides it, see PeerImpl.SetCheckpointVerifier.
+type CheckpointVerifier func(cert *pb.CheckpointCertificate, quorum int, verify func(replicaID uint64, signature []byte, payload []byte) error) error
+
+var checkpointVerifier CheckpointVerifier
+
+// lightEnabled reports whether this peer runs in light mode, in which it
+// syncs only the block headers, and answers queries with data fetched from
+// full peers and verified against the headers. Validators hold the full
+// chain and state.
+func lightEnabled() bool {
+	return viper.GetBool("peer.light.enabled") && !viper.GetBool("peer.validator.enabled")
+}
+
+// lightStateVerifier is the part of the ledger which locates a key in the
+// state chunks and verifies chunks, both of which work on an empty ledger
+type lightStateVerifier interface {
+	GetStateChunkForKey(chaincodeID string, key string) (uint64, error)
+	VerifyStateChunk(chunk uint64, delta *statemgmt.StateDelta, proof []byte, stateHash []byte) error
+}
+
+// lightChain holds the block headers of a light peer. Each header must link
+// to the hash of the previous one, and the genesis header to genesisHash.
+// Headers are only appended up to a block of a verified checkpoint
+// certificate, the latest of which is kept in certificate. With persist set,
+// the headers and the certificate are kept in the local DB, so that they
+// survive a restart.
+type lightChain struct {
+	sync.RWMutex
+	persist     bool
+	genesisHash []byte
+	headers     []*pb.BlockHeader
+	hashes      [][]byte
+	certificate *pb.CheckpointCertificate
+	// fetch serializes the queries to full peers, as a new request to a
+	// peer abandons the response to the previous one
+	fetch sync.Mutex
+}
+
+func newLightChain(persist bool, genesisHash []byte) *lightChain {
+	return &lightChain{persist: persist, genesisHash: genesisHash}
+}
+
+func lightHeaderKey(blockNumber uint64) []byte {
+	key := make([]byte, len(lightHeaderKeyPrefix)+8)
+	copy(key, lightHeaderKeyPrefix)
+	binary.BigEndian.PutUint64(key[len(lightHeaderKeyPrefix):], blockNumber)
+	return key
+}
+
+// load reads the headers synced by a previous run from the local DB, up to
+// the first one missing or not linking to its predecessor
+func (c *lightChain) load() error {
+	if !c.persist {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	it := db.GetDBHandle().GetPersistCFIterator()
+	defer it.Close()
+	prefix := []byte(lightHeaderKeyPrefix)
+	for it.Seek(prefix); it.Valid(); it.Next() {
+		key := it.Key()
+		if !bytes.HasPrefix(key.Data(), prefix) {
+			key.Free()
+			break
+		}
+		value := it.Value()
+		header := &pb.BlockHeader{}
+		err := proto.Unmarshal(value.Data(), header)
+		matches := bytes.Equal(key.Data(), lightHeaderKey(uint64(len(c.headers))))
+		key.Free()
+		value.Free()
+		if err != nil || !matches {
+			peerLogger.Warning("Ignoring the block headers from %d on, which could not be loaded", len(c.headers))
+			break
+		}
+		hash, err := c.link(uint64(len(c.headers)), header, c.topHash())
+		if err != nil {
+			peerLogger.Warning("Ignoring the block headers from %d on: %s", len(c.headers), err)
+			break
+		}
+		c.headers = append(c.headers, header)
+		c.hashes = append(c.hashes, hash)
+	}
+	peerLogger.Debug("Loaded %d block headers", len(c.headers))
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	certBytes, err := db.GetDBHandle().GetFromPersistCF(lightCertificateKey)
+	if err != nil || certBytes == nil {
+		return err
+	}
+	cert := &pb.CheckpointCertificate{}
+	if err := proto.Unmarshal(certBytes, cert); err != nil {
+		return fmt.Errorf("Error unmarshalling the checkpoint certificate: %s", err)
+	}
+	if cert.BlockNumber < uint64(len(c.hashes)) && bytes.Equal(c.hashes[cert.BlockNumber], cert.BlockHash) {
+		c.certificate = cert
+	}
+	return nil
+}
+
+// link checks that header, the header of blockNumber, links to previousHash
+// and returns its hash
+func (c *lightChain) link(blockNumber uint64, header *pb.BlockHeader, previousHash []byte) ([]byte, error) {
+	hash, err := header.GetHash()
+	if err != nil {
+		return nil, err
+	}
+	if blockNumber == 0 {
+		if !bytes.Equal(hash, c.genesisHash) {
+			return nil, fmt.Errorf("The genesis block header has hash %x instead of %x", hash, c.genesisHash)
+		}
+	} else if !bytes.Equal(header.PreviousBlockHash, previousHash) {
+		return nil, fmt.Errorf("The header of block %d does not link to the hash of block %d", blockNumber, blockNumber-1)
+	}
+	return hash, nil
+}
+
+// topHash returns the hash of the last header. The caller must hold the lock.
+func (c *lightChain) topHash() []byte {
+	if len(c.hashes) == 0 {
+		return nil
+	}
+	return c.hashes[len(c.hashes)-1]
+}
+
+// height returns the number of headers
+func (c *lightChain) height() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+	return uint64(len(c.headers))
+}
+
+// header returns the header of blockNumber, or ledger.ErrOutOfBounds if it
+// has not been synced
+func (c *lightChain) header(blockNumber uint64) (*pb.BlockHeader, []byte, error) {
+	c.RLock()
+	defer c.RUnlock()
+	if blockNumber >= uint64(len(c.headers)) {
+		return nil, nil, ledger.ErrOutOfBounds
+	}
+	return c.headers[blockNumber], c.hashes[blockNumber], nil
+}
+
+// info returns the head of the light chain
+func (c *lightChain) info() *pb.BlockchainInfo {
+	c.RLock()
+	defer c.RUnlock()
+	info := &pb.BlockchainInfo{Height: uint64(len(c.headers)), CurrentBlockHash: c.topHash()}
+	if len(c.headers) > 0 {
+		info.PreviousBlockHash = c.headers[len(c.headers)-1].PreviousBlockHash
+	}
+	return info
+}
+
+// appendHeaders appends the headers of the blocks from start on, if they
+// follow the last header and link to each other. Either all of them are
+// appended or none.
+func (c *lightChain) appendHeaders(start uint64, headers []*pb.BlockHeader) error {
+	c.Lock()
+	defer c.Unlock()
+	if start != uint64(len(c.headers)) {
+		return fmt.Errorf("Expected the header of block %d, got %d", len(c.headers), start)
+	}
+	hashes := make([][]byte, len(headers))
+	previousHash := c.topHash()
+	for i, header := range headers {
+		hash, err := c.link(start+uint64(i), header, previousHash)
+		if err != nil {
+			return err
+		}
+		hashes[i] = hash
+		previousHash = hash
+	}
+	for i, header := range headers {
+		c.store(start+uint64(i), header)
+	}
+	c.headers = append(c.headers, headers...)
+	c.hashes = append(c.hashes, hashes...)
+	return nil
+}
+
+// store writes a header to the local DB. The caller must hold the lock.
+func (c *lightChain) store(blockNumber uint64, header *pb.BlockHeader) {
+	if !c.persist {
+		return
+	}
+	value, err := proto.Marshal(header)
+	if err != nil {
+		peerLogger.Error("Could not marshal the header of block %d: %s", blockNumber, err)
+		return
+	}
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	if err := openchainDB.DB.PutCF(opt, openchainDB.PersistCF, lightHeaderKey(blockNumber), value); err != nil {
+		peerLogger.Error("Could not store the header of block %d: %s", blockNumber, err)
+	}
+}
+
+// certify records cert as the latest checkpoint certificate, if its block is
+// a header of the chain and later than the block of the current one
+func (c *lightChain) certify(cert *pb.CheckpointCertificate) error {
+	c.Lock()
+	defer c.Unlock()
+	if cert.BlockNumber >= uint64(len(c.hashes)) || !bytes.Equal(c.hashes[cert.BlockNumber], cert.BlockHash) {
+		return fmt.Errorf("The checkpoint certificate of block %d does not match the block header", cert.BlockNumber)
+	}
+	if c.certificate != nil && c.certificate.BlockNumber >= cert.BlockNumber {
+		return nil
+	}
+	c.certificate = cert
+	if !c.persist {
+		return nil
+	}
+	value, err := proto.Marshal(cert)
+	if err != nil {
+		peerLogger.Error("Could not marshal the checkpoint certificate of block %d: %s", cert.BlockNumber, err)
+		return nil
+	}
+	openchainDB := db.GetDBHandle()
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	if err := openchainDB.DB.PutCF(opt, openchainDB.PersistCF, lightCertificateKey, value); err != nil {
+		peerLogger.Error("Could not store the checkpoint certificate of block %d: %s", cert.BlockNumber, err)
+	}
+	return nil
+}
+
+// latestCertificate returns the latest checkpoint certificate the chain is
+// anchored to, nil if there is none yet
+func (c *lightChain) latestCertificate() *pb.CheckpointCertificate {
+	c.RLock()
+	defer c.RUnlock()
+	return c.certificate
+}
+
+// syncHeaders requests the headers following the light chain from remote,
+// at most max at a time, up to the head, which must carry the hash of its
+// block as confirmed by the validators. The headers are only appended once
+// they reach the head and end with its hash.
+func syncHeaders(c *lightChain, remote HeadersRetriever, head *pb.BlockchainInfo, max uint64, timeout time.Duration) (uint64, error) {
+	if head == nil || len(head.CurrentBlockHash) == 0 {
+		return 0, fmt.Errorf("Not syncing block headers up to an unconfirmed head")
+	}
+	start := c.height()
+	if start >= head.Height {
+		return 0, nil
+	}
+	var synced []*pb.BlockHeader
+	for next := start; next < head.Height; next = start + uint64(len(synced)) {
+		end := next + max - 1
+		if end > head.Height-1 {
+			end = head.Height - 1
+		}
+		syncRange := &pb.SyncBlockRange{Start: next, End: end}
+		headersChan, err := remote.RequestBlockHeaders(syncRange)
+		if err != nil {
+			return 0, err
+		}
+		headers, err := receiveHeaders(headersChan, syncRange, timeout)
+		if err != nil {
+			return 0, err
+		}
+		if len(headers) == 0 {
+			return 0, fmt.Errorf("No header of block %d, below the confirmed head", next)
+		}
+		for i, header := range headers {
+			if header.Version < pb.BlockVersion {
+				// Not the fault of the remote peer, older blocks have no
+				// header of their own
+				return 0, fmt.Errorf("Block %d of version %d cannot be verified by its header", next+uint64(i), header.Version)
+			}
+		}
+		synced = append(synced, headers...)
+	}
+	hash, err := synced[len(synced)-1].GetHash()
+	if err != nil {
+		return 0, newInvalidBlocksError("%s", err)
+	}
+	if !bytes.Equal(hash, head.CurrentBlockHash) {
+		return 0, newInvalidBlocksError("The header of block %d does not have the confirmed hash", head.Height-1)
+	}
+	if err := c.appendHeaders(start, synced); err != nil {
+		return 0, newInvalidBlocksError("%s", err)
+	}
+	return uint64(len(synced)), nil
+}
+
+// requestCheckpointCertificate returns the latest checkpoint certificate of
+// remote, nil if it has none
+func requestCheckpointCertificate(remote HeadersRetriever, timeout time.Duration) (*pb.CheckpointCertificate, error) {
+	certChan, err := remote.RequestCheckpointCertificate()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case syncCert, ok := <-certChan:
+		if !ok {
+			return nil, fmt.Errorf("Checkpoint certificate stream closed")
+		}
+		return syncCert.Certificate, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("Timed out waiting for the checkpoint certificate")
+	}
+}
+
+func receiveHeaders(headersChan <-chan *pb.SyncBlockHeaders, syncRange *pb.SyncBlockRange, timeout time.Duration) ([]*pb.BlockHeader, error) {
+	select {
+	case syncBlockHeaders, ok := <-headersChan:
+		if !ok {
+			return nil, fmt.Errorf("Block header stream closed before block %d", syncRange.Start)
+		}
+		if syncBlockHeaders.Range == nil || syncBlockHeaders.Range.Start != syncRange.Start || uint64(len(syncBlockHeaders.Headers)) > syncRange.End-syncRange.Start+1 {
+			return nil, newInvalidBlocksError("Expected the headers of blocks %d-%d, got %v", syncRange.Start, syncRange.End, syncBlockHeaders.Range)
+		}
+		return syncBlockHeaders.Headers, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("Timed out waiting for the header of block %d", syncRange.Start)
+	}
+}
+
+// verifyBlock checks that block is the block of header
+func verifyBlock(hash []byte, block *pb.Block) error {
+	blockHash, err := block.GetHash()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(blockHash, hash) {
+		return fmt.Errorf("The block does not match its header")
+	}
+	return nil
+}
+
+// verifyTransactionProof checks that proof shows the transaction with uuid
+// is in the block of header, and returns the transaction
+func verifyTransactionProof(header *pb.BlockHeader, uuid string, proof *pb.TransactionProof) (*pb.Transaction, error) {
+	if proof.Transaction == nil || proof.Transaction.Uuid != uuid {
+		return nil, fmt.Errorf("The proof is not of transaction %s", uuid)
+	}
+	if err := pb.VerifyTransactionProof(header.TransactionsRoot, proof.Transaction, proof.Index, proof.Count, proof.Path); err != nil {
+		return nil, err
+	}
+	return proof.Transaction, nil
+}
+
+// verifyState checks that chunk is the chunk of the state with the state
+// hash of header which holds the key of the chaincode, and returns the value
+// of the key, nil if the verified chunk does not hold it
+func verifyState(v lightStateVerifier, header *pb.BlockHeader, chaincodeID string, key string, chunk *pb.SyncStateChunk) ([]byte, error) {
+	chunkNumber, err := v.GetStateChunkForKey(chaincodeID, key)
+	if err != nil {
+		return nil, err
+	}
+	if chunk.Request == nil || chunk.Request.Chunk != chunkNumber || !bytes.Equal(chunk.StateHash, header.StateHash) {
+		return nil, fmt.Errorf("Expected chunk %d of the state with hash %x", chunkNumber, header.StateHash)
+	}
+	delta := statemgmt.NewStateDelta()
+	if err := delta.Unmarshal(chunk.Delta); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling state chunk %d: %s", chunkNumber, err)
+	}
+	if err := v.VerifyStateChunk(chunkNumber, delta, chunk.Proof, header.StateHash); err != nil {
+		return nil, err
+	}
+	value := delta.Get(chaincodeID, key)
+	if value == nil || value.IsDelete() {
+		return nil, nil
+	}
+	return value.GetValue(), nil
+}
+
+// newLightChainFromConfig creates the light chain configured in peer.light,
+// starting with the genesis block of peer.genesisHash
+func newLightChainFromConfig() (*lightChain, error) {
+	genesisHash, err := configuredGenesisHash()
+	if err != nil {
+		return nil, err
+	}
+	if len(genesisHash) == 0 {
+		return nil, fmt.Errorf("Light mode needs the hash of the genesis block in peer.genesisHash")
+	}
+	c := newLightChain(viper.GetBool("peer.light.persist"), genesisHash)
+	if err := c.load(); err != nil {
+		peerLogger.Warning("Could not load the block headers: %s", err)
+	}
+	return c, nil
+}
+
+// fullPeers returns the connected peers which can answer light queries, the
+// validators first. Peers older than the light queries are left out.
+func (p *PeerImpl) fullPeers() []*pb.PeerID {
+	var ids []*pb.PeerID
+	for _, typ := range []pb.PeerEndpoint_Type{pb.PeerEndpoint_VALIDATOR, pb.PeerEndpoint_NON_VALIDATOR} {
+		for id := range speakingHandlers(p.cloneHandlerMap(typ), pb.OpenchainMessage_SYNC_GET_BLOCK_HEADERS) {
+			id := id
+			ids = append(ids, &id)
+		}
+	}
+	return ids
+}
+
+// SetCheckpointVerifier sets how a light peer verifies the checkpoint
+// certificates it anchors the block headers to. It must be called before the
+// peer is created. Without one, a light peer syncs no headers.
+func SetCheckpointVerifier(verifier CheckpointVerifier) {
+	checkpointVerifier = verifier
+}
+
+// verifyCheckpointCertificate checks that cert carries the checkpoints of
+// f+1 distinct validators, so that at least one correct validator vouches
+// for its block
+func (p *PeerImpl) verifyCheckpointCertificate(cert *pb.CheckpointCertificate) error {
+	if checkpointVerifier == nil {
+		return fmt.Errorf("No verifier for checkpoint certificates")
+	}
+	validators := make(map[uint64]*pb.PeerID)
+	for _, signed := range cert.Checkpoints {
+		validators[signed.ReplicaID] = signed.Validator
+	}
+	seen := make(map[string]bool)
+	return checkpointVerifier(cert, p.validatorFaults()+1, func(replicaID uint64, signature []byte, payload []byte) error {
+		validator := validators[replicaID]
+		if validator == nil {
+			return fmt.Errorf("No validator for replica %d", replicaID)
+		}
+		if seen[validator.Name] {
+			return fmt.Errorf("Validator %s signed several checkpoints", validator.Name)
+		}
+		seen[validator.Name] = true
+		return p.verifyValidatorSignature(validator, signature, payload)
+	})
+}
+
+// verifyValidatorSignature checks the signature of a connected validator.
+// Without security there is nothing to check.
+func (p *PeerImpl) verifyValidatorSignature(validator *pb.PeerID, signature []byte, payload []byte) error {
+	if !viper.GetBool("security.enabled") {
+		return nil
+	}
+	handler := p.handlerFor(validator)
+	if handler == nil {
+		return fmt.Errorf("Validator %s is not connected", validator.Name)
+	}
+	endpoint, err := handler.To()
+	if err != nil {
+		return err
+	}
+	if endpoint.Type != pb.PeerEndpoint_VALIDATOR {
+		return fmt.Errorf("Peer %s is not a validator", validator.Name)
+	}
+	return p.GetSecHelper().Verify(endpoint.PkiID, signature, payload)
+}
+
+// syncLightHeaders syncs the headers from the peers announcing a longer
+// chain than the light chain, the tallest first
+func (p *PeerImpl) syncLightHeaders() {
+	if !p.gossip.startPull() {
+		return
+	}
+	defer p.gossip.donePull()
+	for {
+		id, _ := p.gossip.tallest(p.light.height())
+		if id == nil {
+			return
+		}
+		p.syncLightHeadersFrom(id)
+		p.gossip.forget(id)
+	}
+}
+
+// syncLightHeadersFrom syncs the headers from the peer id up to the block of
+// its latest checkpoint certificate, once the certificate is verified
+func (p *PeerImpl) syncLightHeadersFrom(id *pb.PeerID) {
+	remote, err := p.GetRemoteLedger(id)
+	if err != nil {
+		return
+	}
+	timeout := viper.GetDuration("peer.light.timeout")
+	cert, err := requestCheckpointCertificate(remote, timeout)
+	if err != nil || cert == nil {
+		peerLogger.Debug("No checkpoint certificate from %s: %v", id, err)
+		return
+	}
+	if latest := p.light.latestCertificate(); latest != nil && latest.BlockNumber >= cert.BlockNumber {
+		return
+	}
+	if err := p.verifyCheckpointCertificate(cert); err != nil {
+		peerLogger.Warning("Could not verify the checkpoint certificate of block %d from %s: %s", cert.BlockNumber, id, err)
+		return
+	}
+	head := &pb.BlockchainInfo{Height: cert.BlockNumber + 1, CurrentBlockHash: cert.BlockHash}
+	appended, err := syncHeaders(p.light, remote, head, uint64(viper.GetInt("peer.sync.headers.maxPerMessage")), timeout)
+	if appended > 0 {
+		peerLogger.Debug("Appended %d block headers synced from %s", appended, id)
+	}
+	if err != nil {
+		peerLogger.Warning("Failed syncing block headers from %s: %s", id, err)
+		if _, ok := err.(*invalidBlocksError); ok {
+			if handler := p.handlerFor(id); handler != nil {
+				p.protocolError(handler)
+			}
+		}
+		return
+	}
+	if err := p.light.certify(cert); err != nil {
+		peerLogger.Warning("Failed anchoring the block headers synced from %s: %s", id, err)
+	}
+}
+
+// lightSync periodically syncs the headers from a random full peer, so that
+// a light peer which missed the announcements, or started when no block was
+// being committed, catches up
+func (p *PeerImpl) lightSync() {
+	period := viper.GetDuration("peer.light.period")
+	if period <= 0 {
+		peerLogger.Debug("Not syncing the block headers periodically")
+		return
+	}
+	for {
+		time.Sleep(period)
+		ids := p.fullPeers()
+		if len(ids) == 0 || !p.gossip.startPull() {
+			continue
+		}
+		p.syncLightHeadersFrom(ids[rand.Intn(len(ids))])
+		p.gossip.donePull()
+	}
+}
+
+// LightMode reports whether this peer runs in light mode
+func (p *PeerImpl) LightMode() bool {
+	return p.light != nil
+}
+
+// GetVerifiedBlockchainInfo returns the head of the headers synced in light
+// mode
+func (p *PeerImpl) GetVerifiedBlockchainInfo() (*pb.BlockchainInfo, error) {
+	return p.light.info(), nil
+}
+
+// GetVerifiedCheckpointCertificate returns the latest checkpoint certificate
+// the headers synced in light mode are anchored to, or
+// ledger.ErrResourceNotFound if there is none yet
+func (p *PeerImpl) GetVerifiedCheckpointCertificate() (*pb.CheckpointCertificate, error) {
+	cert := p.light.latestCertificate()
+	if cert == nil {
+		return nil, ledger.ErrResourceNotFound
+	}
+	return cert, nil
+}
+
+// GetVerifiedBlockByNumber returns a block fetched from a full peer, once
+// checked against its header
+func (p *PeerImpl) GetVerifiedBlockByNumber(blockNumber uint64) (*pb.Block, error) {
+	_, hash, err := p.light.header(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	p.light.fetch.Lock()
+	defer p.light.fetch.Unlock()
+	timeout := viper.GetDuration("peer.light.timeout")
+	for _, id := range p.fullPeers() {
+		remote, err := p.GetRemoteLedger(id)
+		if err != nil {
+			continue
+		}
+		syncRange := &pb.SyncBlockRange{Start: blockNumber, End: blockNumber}
+		blocksChan, err := remote.RequestBlocks(syncRange)
+		if err != nil {
+			continue
+		}
+		blocks, err := receiveBlocks(blocksChan, syncRange, timeout)
+		if err != nil || len(blocks) != 1 {
+			peerLogger.Debug("Could not fetch block %d from %s: %s", blockNumber, id, err)
+			continue
+		}
+		if err := verifyBlock(hash, blocks[0]); err != nil {
+			peerLogger.Warning("Block %d fetched from %s failed verification: %s", blockNumber, id, err)
+			continue
+		}
+		return blocks[0], nil
+	}
+	return nil, fmt.Errorf("No full peer provided block %d", blockNumber)
+}
+
+// GetVerifiedTransactionByUUID returns a transaction fetched from a full
+// peer, once checked against the header of its block. It returns
+// ledger.ErrResourceNotFound if no full peer knows the transaction.
+func (p *PeerImpl) GetVerifiedTransactionByUUID(txUUID string) (*pb.Transaction, error) {
+	p.light.fetch.Lock()
+	defer p.light.fetch.Unlock()
+	timeout := viper.GetDuration("peer.light.timeout")
+	var notVerified error
+	for _, id := range p.fullPeers() {
+		remote, err := p.GetRemoteLedger(id)
+		if err != nil {
+			continue
+		}
+		proofChan, err := remote.RequestTransactionProof(txUUID)
+		if err != nil {
+			continue
+		}
+		var proof *pb.TransactionProof
+		select {
+		case proof = <-proofChan:
+		case <-time.After(timeout):
+		}
+		if proof == nil || proof.Transaction == nil {
+			continue
+		}
+		header, _, err := p.light.header(proof.BlockNumber)
+		if err == nil {
+			var transaction *pb.Transaction
+			if transaction, err = verifyTransactionProof(header, txUUID, proof); err == nil {
+				return transaction, nil
+			}
+		}
+		peerLogger.Warning("Transaction %s fetched from %s failed verification: %s", txUUID, id, err)
+		notVerified = fmt.Errorf("Transaction %s could not be verified against block %d: %s", txUUID, proof.BlockNumber, err)
+	}
+	if notVerified != nil {
+		return nil, notVerified
+	}
+	return nil, ledger.ErrResourceNotFound
+}
+
+// GetVerifiedState returns the value of a key of a chaincode in the state of
+// the last synced header, fetched from a full peer which holds that state
+// and checked against the state hash of the header
+func (p *PeerImpl) GetVerifiedState(chaincodeID string, key string) ([]byte, error) {
+	height := p.light.height()
+	if height == 0 {
+		return nil, fmt.Errorf("No block headers synced")
+	}
+	header, _, err := p.light.header(height - 1)
+	if err != nil {
+		return nil, err
+	}
+	chunkNumber, err := p.ledgerWrapper.ledger.GetStateChunkForKey(chaincodeID, key)
+	if err != nil {
+		return nil, err
+	}
+	p.light.fetch.Lock()
+	defer p.light.fetch.Unlock()
+	timeout := viper.GetDuration("peer.light.timeout")
+	for _, id := range p.fullPeers() {
+		remote, err := p.GetRemoteLedger(id)
+		if err != nil {
+			continue
+		}
+		chunkChan, err := remote.RequestStateChunk(chunkNumber, header.StateHash)
+		if err != nil {
+			continue
+		}
+		var chunk *pb.SyncStateChunk
+		select {
+		case chunk = <-chunkChan:
+		case <-time.After(timeout):
+		}
+		if chunk == nil || !bytes.Equal(chunk.StateHash, header.StateHash) {
+			// The state of the peer is not the state of the header
+			continue
+		}
+		value, err := verifyState(p.ledgerWrapper.ledger, header, chaincodeID, key, chunk)
+		if err != nil {
+			peerLogger.Warning("State chunk %d fetched from %s failed verification: %s", chunkNumber, id, err)
+			continue
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("No full peer provided the state of block %d", height-1)
+}
@@ -0,0 +1,309 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger-incubator/obc-peer/openchain/ledger/statemgmt"
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+func lightTestHeaders(t *testing.T, source *gossipTestLedger) []*pb.BlockHeader {
+	headers := make([]*pb.BlockHeader, len(source.blocks))
+	for i, block := range source.blocks {
+		header, err := block.GetHeader()
+		if err != nil {
+			t.Fatalf("Error getting the header of block %d: %s", i, err)
+		}
+		headers[i] = header
+	}
+	return headers
+}
+
+// lightTestRemote serves at most max of the headers of a chain at a time,
+// and cert as its latest checkpoint certificate
+type lightTestRemote struct {
+	RemoteLedger
+	headers []*pb.BlockHeader
+	max     int
+	cert    *pb.CheckpointCertificate
+}
+
+func (r *lightTestRemote) RequestCheckpointCertificate() (<-chan *pb.SyncCheckpointCertificate, error) {
+	ch := make(chan *pb.SyncCheckpointCertificate, 1)
+	ch <- &pb.SyncCheckpointCertificate{Certificate: r.cert}
+	return ch, nil
+}
+
+func (r *lightTestRemote) RequestBlockHeaders(syncRange *pb.SyncBlockRange) (<-chan *pb.SyncBlockHeaders, error) {
+	ch := make(chan *pb.SyncBlockHeaders, 1)
+	response := &pb.SyncBlockHeaders{Range: &pb.SyncBlockRange{Start: syncRange.Start, End: syncRange.Start}}
+	for i := syncRange.Start; i <= syncRange.End && i < uint64(len(r.headers)) && len(response.Headers) < r.max; i++ {
+		response.Headers = append(response.Headers, r.headers[i])
+		response.Range.End = i
+	}
+	ch <- response
+	return ch, nil
+}
+
+func TestLightChainAppendHeaders(t *testing.T) {
+	headers := lightTestHeaders(t, newGossipTestLedger(6))
+	genesisHash, _ := headers[0].GetHash()
+
+	c := newLightChain(false, genesisHash)
+	if _, err := newLightChain(false, nil).link(0, headers[0], nil); err == nil {
+		t.Fatalf("Expected no genesis header to be accepted without a genesis hash")
+	}
+	if err := c.appendHeaders(1, headers[1:2]); err == nil {
+		t.Fatalf("Expected a header not following the chain to be rejected")
+	}
+	if err := c.appendHeaders(0, headers[:3]); err != nil {
+		t.Fatalf("Error appending headers: %s", err)
+	}
+	unlinked := []*pb.BlockHeader{headers[3], headers[5]}
+	if err := c.appendHeaders(3, unlinked); err == nil {
+		t.Fatalf("Expected unlinked headers to be rejected")
+	}
+	if c.height() != 3 {
+		t.Fatalf("Expected the rejected headers not to be appended, height is %d", c.height())
+	}
+	if err := c.appendHeaders(3, headers[3:]); err != nil {
+		t.Fatalf("Error appending headers: %s", err)
+	}
+	topHash, _ := headers[5].GetHash()
+	if info := c.info(); info.Height != 6 || !bytes.Equal(info.CurrentBlockHash, topHash) {
+		t.Fatalf("Unexpected head of the light chain: %v", info)
+	}
+	if _, _, err := c.header(6); err == nil {
+		t.Fatalf("Expected no header beyond the top of the chain")
+	}
+
+	other := lightTestHeaders(t, newGossipTestLedger(1))
+	other[0].ConsensusMetadata = []byte("another genesis")
+	if err := newLightChain(false, genesisHash).appendHeaders(0, other); err == nil {
+		t.Fatalf("Expected a genesis header with another hash to be rejected")
+	}
+}
+
+func TestLightSyncHeaders(t *testing.T) {
+	headers := lightTestHeaders(t, newGossipTestLedger(10))
+	genesisHash, _ := headers[0].GetHash()
+	remote := &lightTestRemote{headers: headers, max: 3}
+
+	c := newLightChain(false, genesisHash)
+	for _, height := range []uint64{7, 10} {
+		topHash, _ := headers[height-1].GetHash()
+		start := c.height()
+		appended, err := syncHeaders(c, remote, &pb.BlockchainInfo{Height: height, CurrentBlockHash: topHash}, 4, time.Second)
+		if err != nil || appended != height-start || c.height() != height {
+			t.Fatalf("Expected to sync the headers up to %d, synced %d: %v", height, appended, err)
+		}
+	}
+
+	// Only up to a head confirmed with its hash
+	if _, err := syncHeaders(newLightChain(false, genesisHash), remote, nil, 4, time.Second); err == nil {
+		t.Fatalf("Expected no headers to be synced without a head")
+	}
+	if _, err := syncHeaders(newLightChain(false, genesisHash), remote, &pb.BlockchainInfo{Height: 10}, 4, time.Second); err == nil {
+		t.Fatalf("Expected no headers to be synced up to a head without a hash")
+	}
+}
+
+func TestLightSyncHeadersRejectsMismatchedHead(t *testing.T) {
+	headers := lightTestHeaders(t, newGossipTestLedger(5))
+	genesisHash, _ := headers[0].GetHash()
+	c := newLightChain(false, genesisHash)
+	_, err := syncHeaders(c, &lightTestRemote{headers: headers, max: 2}, &pb.BlockchainInfo{Height: 5, CurrentBlockHash: []byte("other")}, 2, time.Second)
+	if _, ok := err.(*invalidBlocksError); !ok {
+		t.Fatalf("Expected the headers to be invalid, got %v", err)
+	}
+	if c.height() != 0 {
+		t.Fatalf("Expected no headers to be appended, height is %d", c.height())
+	}
+}
+
+// lightTestHandler is a full peer serving the headers of remote
+type lightTestHandler struct {
+	*connTestHandler
+	remote *lightTestRemote
+}
+
+func (h *lightTestHandler) RequestBlockHeaders(syncRange *pb.SyncBlockRange) (<-chan *pb.SyncBlockHeaders, error) {
+	return h.remote.RequestBlockHeaders(syncRange)
+}
+
+func (h *lightTestHandler) RequestCheckpointCertificate() (<-chan *pb.SyncCheckpointCertificate, error) {
+	return h.remote.RequestCheckpointCertificate()
+}
+
+// lightTestCheckpointVerifier accepts the certificates with quorum
+// checkpoints accepted by verify, the signature of which is the payload
+func lightTestCheckpointVerifier(cert *pb.CheckpointCertificate, quorum int, verify func(replicaID uint64, signature []byte, payload []byte) error) error {
+	for _, signed := range cert.Checkpoints {
+		if err := verify(signed.ReplicaID, signed.Signature, signed.Payload); err != nil {
+			return err
+		}
+	}
+	if len(cert.Checkpoints) < quorum {
+		return fmt.Errorf("Certificate holds %d checkpoints, needs %d", len(cert.Checkpoints), quorum)
+	}
+	return nil
+}
+
+func TestLightSyncAnchoredToCheckpoints(t *testing.T) {
+	defer SetCheckpointVerifier(checkpointVerifier)
+	SetCheckpointVerifier(lightTestCheckpointVerifier)
+	defer viper.Set("peer.validators.allowList", viper.GetStringSlice("peer.validators.allowList"))
+	var allowList []string
+	for i := 0; i < 4; i++ {
+		allowList = append(allowList, hex.EncodeToString([]byte(fmt.Sprintf("vp%d", i))))
+	}
+	viper.Set("peer.validators.allowList", allowList)
+
+	headers := lightTestHeaders(t, newGossipTestLedger(10))
+	genesisHash, _ := headers[0].GetHash()
+	remote := &lightTestRemote{headers: headers, max: 3}
+	p := &PeerImpl{handlerMap: &handlerMap{m: make(map[pb.PeerID]MessageHandler)}, discovery: newDiscoveryStore(false), gossip: newBlockGossip(), light: newLightChain(false, genesisHash)}
+	h := &lightTestHandler{connTestHandler: newConnTestHandler("nvp1", pb.PeerEndpoint_NON_VALIDATOR, false), remote: remote}
+	p.handlerMap.m[*h.endpoint.ID] = h
+
+	certify := func(blockNumber uint64, validators ...string) *pb.CheckpointCertificate {
+		hash, _ := headers[blockNumber].GetHash()
+		cert := &pb.CheckpointCertificate{BlockNumber: blockNumber, BlockHash: hash}
+		for i, name := range validators {
+			cert.Checkpoints = append(cert.Checkpoints, &pb.SignedCheckpoint{ReplicaID: uint64(i), Validator: &pb.PeerID{Name: name}})
+		}
+		return cert
+	}
+
+	// With 4 validators, f+1 = 2 distinct validators must sign
+	for _, cert := range []*pb.CheckpointCertificate{nil, certify(6, "vp0"), certify(6, "vp0", "vp0")} {
+		remote.cert = cert
+		p.syncLightHeadersFrom(h.endpoint.ID)
+		if p.light.height() != 0 {
+			t.Fatalf("Expected no headers to be synced without a verified certificate, height is %d", p.light.height())
+		}
+	}
+	if _, err := p.GetVerifiedCheckpointCertificate(); err == nil {
+		t.Fatalf("Expected no verified checkpoint certificate")
+	}
+
+	remote.cert = certify(6, "vp0", "vp1")
+	p.syncLightHeadersFrom(h.endpoint.ID)
+	if p.light.height() != 7 {
+		t.Fatalf("Expected the headers to be synced up to the certified block, height is %d", p.light.height())
+	}
+	if cert, err := p.GetVerifiedCheckpointCertificate(); err != nil || cert != remote.cert {
+		t.Fatalf("Expected the certificate the headers are anchored to, got %v: %v", cert, err)
+	}
+
+	// A certificate of a block other than the one served is refused
+	forged := certify(9, "vp0", "vp1")
+	forged.BlockHash = []byte("forged")
+	remote.cert = forged
+	p.syncLightHeadersFrom(h.endpoint.ID)
+	if p.light.height() != 7 {
+		t.Fatalf("Expected no headers to be synced up to another block, height is %d", p.light.height())
+	}
+}
+
+func TestLightVerifyBlockAndTransaction(t *testing.T) {
+	var transactions []*pb.Transaction
+	for i := 0; i < 5; i++ {
+		transactions = append(transactions, &pb.Transaction{Uuid: fmt.Sprintf("tx%d", i), Payload: []byte{byte(i)}})
+	}
+	block := pb.NewBlock(transactions, nil)
+	block.StateHash = []byte("state")
+	header, err := block.GetHeader()
+	if err != nil {
+		t.Fatalf("Error getting the block header: %s", err)
+	}
+	hash, _ := header.GetHash()
+
+	if err := verifyBlock(hash, block); err != nil {
+		t.Fatalf("Error verifying the block: %s", err)
+	}
+	tampered := pb.NewBlock(transactions[1:], nil)
+	tampered.StateHash = block.StateHash
+	if err := verifyBlock(hash, tampered); err == nil {
+		t.Fatalf("Expected a block with other transactions to fail verification")
+	}
+
+	path, err := block.GetTransactionProof(3)
+	if err != nil {
+		t.Fatalf("Error getting the transaction proof: %s", err)
+	}
+	proof := &pb.TransactionProof{Transaction: transactions[3], Index: 3, Count: 5, Path: path}
+	if tx, err := verifyTransactionProof(header, "tx3", proof); err != nil || tx != transactions[3] {
+		t.Fatalf("Error verifying the transaction proof: %v", err)
+	}
+	if _, err := verifyTransactionProof(header, "tx2", proof); err == nil {
+		t.Fatalf("Expected the proof of another transaction to fail verification")
+	}
+	proof.Transaction = &pb.Transaction{Uuid: "tx3", Payload: []byte("forged")}
+	if _, err := verifyTransactionProof(header, "tx3", proof); err == nil {
+		t.Fatalf("Expected a forged transaction to fail verification")
+	}
+}
+
+// lightTestVerifier holds every key in chunk 1, and accepts the chunks
+// whose proof is the state hash
+type lightTestVerifier struct{}
+
+func (v lightTestVerifier) GetStateChunkForKey(chaincodeID string, key string) (uint64, error) {
+	return 1, nil
+}
+
+func (v lightTestVerifier) VerifyStateChunk(chunk uint64, delta *statemgmt.StateDelta, proof []byte, stateHash []byte) error {
+	if !bytes.Equal(proof, stateHash) {
+		return fmt.Errorf("Bad proof")
+	}
+	return nil
+}
+
+func TestLightVerifyState(t *testing.T) {
+	header := &pb.BlockHeader{StateHash: []byte("state")}
+	delta := statemgmt.NewStateDelta()
+	delta.Set("chaincode", "a", []byte("value"), nil)
+	chunk := &pb.SyncStateChunk{Request: &pb.SyncStateChunkRequest{Chunk: 1}, StateHash: header.StateHash, Delta: delta.Marshal(), Proof: header.StateHash}
+
+	if value, err := verifyState(lightTestVerifier{}, header, "chaincode", "a", chunk); err != nil || string(value) != "value" {
+		t.Fatalf("Expected the verified value, got %q: %v", value, err)
+	}
+	if value, err := verifyState(lightTestVerifier{}, header, "chaincode", "b", chunk); err != nil || value != nil {
+		t.Fatalf("Expected a key missing from the verified chunk to have no value, got %q: %v", value, err)
+	}
+	chunk.Proof = []byte("other")
+	if _, err := verifyState(lightTestVerifier{}, header, "chaincode", "a", chunk); err == nil {
+		t.Fatalf("Expected a chunk with a bad proof to fail verification")
+	}
+	chunk.Proof = header.StateHash
+	chunk.Request.Chunk = 2
+	if _, err := verifyState(lightTestVerifier{}, header, "chaincode", "a", chunk); err == nil {
+		t.Fatalf("Expected another chunk to fail verification")
+	}
+}
@@ -20,6 +20,8 @@ under the License.
 package peer
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -61,18 +63,31 @@ type BlocksRetriever interface {
 // StateRetriever interface for retrieving state deltas, etc.
 type StateRetriever interface {
 	RequestStateSnapshot() (<-chan *pb.SyncStateSnapshot, error)
+	RequestStateChunk(chunk uint64, stateHash []byte) (<-chan *pb.SyncStateChunk, error)
 	RequestStateDeltas(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.SyncStateDeltas, error)
 }
 
+// HeadersRetriever interface for retrieving what light peers hold and verify
+// instead of blocks and state, the block headers and proofs of transactions,
+// and the checkpoint certificates the headers are anchored to
+type HeadersRetriever interface {
+	RequestBlockHeaders(syncBlockRange *pb.SyncBlockRange) (<-chan *pb.SyncBlockHeaders, error)
+	RequestTransactionProof(uuid string) (<-chan *pb.TransactionProof, error)
+	RequestCheckpointCertificate() (<-chan *pb.SyncCheckpointCertificate, error)
+}
+
 // RemoteLedger interface for retrieving remote ledger data.
 type RemoteLedger interface {
 	BlocksRetriever
 	StateRetriever
+	HeadersRetriever
 }
 
 // BlockChainAccessor interface for retreiving blocks by block number
 type BlockChainAccessor interface {
 	GetBlockByNumber(blockNumber uint64) (*pb.Block, error)
+	GetTransactionProof(txUUID string) (*pb.TransactionProof, error)
+	GetLatestCheckpointCertificate() (*pb.CheckpointCertificate, error)
 }
 
 // StateAccessor interface for retreiving blocks by block number
@@ -103,6 +118,8 @@ type MessageHandlerCoordinator interface {
 	GetPeers() (*pb.PeersMessage, error)
 	GetRemoteLedger(receiver *pb.PeerID) (RemoteLedger, error)
 	PeersDiscovered(*pb.PeersMessage) error
+	BlockHeadReceived(head *pb.BlockchainInfo, from *pb.PeerEndpoint) error
+	ReplyReceived(reply *pb.TransactionReply, from *pb.PeerEndpoint) error
 	ExecuteTransaction(transaction *pb.Transaction) *pb.Response
 }
 
@@ -171,7 +188,7 @@ func GetPeerEndpoint() (*pb.PeerEndpoint, error) {
 	} else {
 		peerType = pb.PeerEndpoint_NON_VALIDATOR
 	}
-	return &pb.PeerEndpoint{ID: &pb.PeerID{Name: viper.GetString("peer.id")}, Address: peerAddress, Type: peerType}, nil
+	return &pb.PeerEndpoint{ID: &pb.PeerID{Name: viper.GetString("peer.id")}, Address: peerAddress, Type: peerType, Light: lightEnabled()}, nil
 }
 
 // NewPeerClientConnectionWithAddress Returns a new grpc.ClientConn to the configured local PEER.
@@ -199,6 +216,9 @@ func NewPeerClientConnectionWithAddress(peerAddress string) (*grpc.ClientConn, e
 	}
 	opts = append(opts, grpc.WithTimeout(defaultTimeout))
 	opts = append(opts, grpc.WithBlock())
+	if period := viper.GetDuration("peer.keepalive.tcpPeriod"); period > 0 {
+		opts = append(opts, grpc.WithDialer(keepAliveDialer(period)))
+	}
 	conn, err := grpc.Dial(peerAddress, opts...)
 	if err != nil {
 		return nil, err
@@ -224,6 +244,11 @@ type PeerImpl struct {
 	handlerMap     *handlerMap
 	ledgerWrapper  *ledgerWrapper
 	secHelper      crypto.Peer
+	replies        *replyCollectors
+	forwarder      *forwarder
+	discovery      *discoveryStore
+	gossip         *blockGossip
+	light          *lightChain
 }
 
 // NewPeerWithHandler returns a Peer which uses the supplied handler factory function for creating new handlers on new Chat service invocations.
@@ -234,6 +259,12 @@ func NewPeerWithHandler(handlerFact HandlerFactory) (*PeerImpl, error) {
 	}
 	peer.handlerFactory = handlerFact
 	peer.handlerMap = &handlerMap{m: make(map[pb.PeerID]MessageHandler)}
+	peer.replies = newReplyCollectors()
+	peer.forwarder = newForwarder()
+	peer.forwarder.send = peer.sendTransactionToPeer
+	peer.forwarder.committed = peer.isCommitted
+	peer.discovery = newDiscoveryStore(viper.GetBool("peer.discovery.persist"))
+	peer.gossip = newBlockGossip()
 
 	// Install security object for peer
 	if viper.GetBool("security.enabled") {
@@ -268,7 +299,26 @@ func NewPeerWithHandler(handlerFact HandlerFactory) (*PeerImpl, error) {
 		return nil, fmt.Errorf("Error constructing NewPeerWithHandler: %s", err)
 	}
 	peer.ledgerWrapper = &ledgerWrapper{ledger: ledgerPtr}
+	if err := peer.checkGenesisConfig(); err != nil {
+		return nil, fmt.Errorf("Error constructing NewPeerWithHandler: %s", err)
+	}
+	checkValidatorConfig()
+	if err := peer.discovery.load(); err != nil {
+		peerLogger.Warning("Could not load the discovered peers: %s", err)
+	}
 	go peer.chatWithPeer(viper.GetString("peer.discovery.rootnode"))
+	if viper.GetBool("peer.discovery.enabled") {
+		go peer.touchPeers()
+	}
+	if gossipEnabled() {
+		go peer.gossipBlocks()
+	}
+	if lightEnabled() {
+		if peer.light, err = newLightChainFromConfig(); err != nil {
+			return nil, fmt.Errorf("Error constructing NewPeerWithHandler: %s", err)
+		}
+		go peer.lightSync()
+	}
 	return peer, nil
 }
 
@@ -316,9 +366,14 @@ func (p *PeerImpl) PeersDiscovered(peersMessage *pb.PeersMessage) error {
 		// Filter out THIS Peer's endpoint
 		if *getHandlerKeyFromPeerEndpoint(thisPeersEndpoint) == *getHandlerKeyFromPeerEndpoint(peerEndpoint) {
 			// NOOP
-		} else if _, ok := p.handlerMap.m[*getHandlerKeyFromPeerEndpoint(peerEndpoint)]; ok == false {
-			// Start chat with Peer
-			go p.chatWithPeer(peerEndpoint.Address)
+			continue
+		}
+		p.discovery.discovered(peerEndpoint)
+		if _, ok := p.handlerMap.m[*getHandlerKeyFromPeerEndpoint(peerEndpoint)]; ok == false && viper.GetBool("peer.discovery.enabled") {
+			// Start chat with Peer, unless we are connecting to it already
+			if p.discovery.startDialing(peerEndpoint.Address) {
+				go p.chatWithDiscoveredPeer(peerEndpoint.Address)
+			}
 		}
 	}
 	return nil
@@ -348,8 +403,14 @@ func (p *PeerImpl) RegisterHandler(messageHandler MessageHandler) error {
 		// Duplicate, return error
 		return newDuplicateHandlerError(messageHandler)
 	}
+	if err := p.makeRoom(messageHandler); err != nil {
+		return err
+	}
 	p.handlerMap.m[*key] = messageHandler
 	peerLogger.Debug("registered handler with key: %s", key)
+	if endpoint, err := messageHandler.To(); err == nil {
+		p.discovery.connected(&endpoint, handlerIdentity(messageHandler))
+	}
 	return nil
 }
 
@@ -361,15 +422,25 @@ func (p *PeerImpl) DeregisterHandler(messageHandler MessageHandler) error {
 	}
 	p.handlerMap.Lock()
 	defer p.handlerMap.Unlock()
-	if _, ok := p.handlerMap.m[*key]; !ok {
-		// Handler NOT found
+	if registered, ok := p.handlerMap.m[*key]; !ok || registered != messageHandler {
+		// Handler NOT found, or evicted and replaced by a new chat with the peer
 		return fmt.Errorf("Error deregistering handler, could not find handler with key: %s", key)
 	}
-	delete(p.handlerMap.m, *key)
+	p.removeHandler(*key, messageHandler)
 	peerLogger.Debug("Deregistered handler with key: %s", key)
 	return nil
 }
 
+// removeHandler removes a registered handler. The caller must hold the lock
+// of the handler map.
+func (p *PeerImpl) removeHandler(key pb.PeerID, messageHandler MessageHandler) {
+	delete(p.handlerMap.m, key)
+	if endpoint, err := messageHandler.To(); err == nil {
+		p.discovery.disconnected(&endpoint, handlerIdentity(messageHandler))
+		p.gossip.forget(endpoint.ID)
+	}
+}
+
 //clone the handler so as to avoid lock across SendMessage
 func (p *PeerImpl) cloneHandlerMap(typ pb.PeerEndpoint_Type) map[pb.PeerID]MessageHandler {
 	p.handlerMap.Lock()
@@ -393,12 +464,17 @@ func (p *PeerImpl) cloneHandlerMap(typ pb.PeerEndpoint_Type) map[pb.PeerID]Messa
 // Broadcast will broadcast to all registered PeerEndpoints if the type is PeerEndpoint_UNDEFINED
 func (p *PeerImpl) Broadcast(msg *pb.OpenchainMessage, typ pb.PeerEndpoint_Type) []error {
 	cloneMap := p.cloneHandlerMap(typ)
+	if msg.Type == pb.OpenchainMessage_SYNC_BLOCK_ADDED && typ == pb.PeerEndpoint_NON_VALIDATOR && viper.GetBool("peer.gossip.enabled") {
+		// The non-validators gossip new blocks among themselves, a few of
+		// them are enough to seed it. Light peers do not relay blocks.
+		cloneMap = pickGossipTargets(withoutLightPeers(cloneMap), nil, viper.GetInt("peer.gossip.fanout"))
+	}
 	var errorsFromHandlers []error
 	for _, msgHandler := range cloneMap {
 		err := msgHandler.SendMessage(msg)
 		if err != nil {
 			toPeerEndpoint, _ := msgHandler.To()
-			errorsFromHandlers = append(errorsFromHandlers, fmt.Errorf("Error broadcasting msg (%s) to PeerEndpoint (%s): %s", msg.Type, toPeerEndpoint, err))
+			errorsFromHandlers = append(errorsFromHandlers, fmt.Errorf("Error broadcasting msg (%s) to PeerEndpoint (%v): %s", msg.Type, toPeerEndpoint, err))
 		}
 	}
 	return errorsFromHandlers
@@ -413,53 +489,87 @@ func (p *PeerImpl) Unicast(msg *pb.OpenchainMessage, receiverHandle *pb.PeerID)
 	err := msgHandler.SendMessage(msg)
 	if err != nil {
 		toPeerEndpoint, _ := msgHandler.To()
-		return fmt.Errorf("Error unicasting msg (%s) to PeerEndpoint (%s): %s", msg.Type, toPeerEndpoint, err)
+		return fmt.Errorf("Error unicasting msg (%s) to PeerEndpoint (%v): %s", msg.Type, toPeerEndpoint, err)
 	}
 	return nil
 }
 
+// signForHello signs msg for the peer that sent the DISC_HELLO hello, as
+// the Handler would for the types in security.messages
+func (p *PeerImpl) signForHello(msg *pb.OpenchainMessage, hello *pb.OpenchainMessage) ([]byte, error) {
+	helloMessage := &pb.HelloMessage{}
+	if err := proto.Unmarshal(hello.Payload, helloMessage); err != nil {
+		return nil, fmt.Errorf("Error unmarshalling HelloMessage: %s", err)
+	}
+	data, err := messageSignaturePayload(msg, helloMessage.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return p.secHelper.Sign(data)
+}
+
 // SendTransactionsToPeer current temporary mechanism of forwarding transactions to the configured Validator.
 func (p *PeerImpl) SendTransactionsToPeer(peerAddress string, transaction *pb.Transaction) *pb.Response {
+	response, err := p.sendTransactionToPeer(peerAddress, transaction)
+	if err != nil {
+		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(err.Error())}
+	}
+	return response
+}
+
+// sendTransactionToPeer forwards a transaction to the validator at
+// peerAddress and returns its response. It returns an error if the validator
+// could not be reached, or did not respond within peer.forwarding.timeout.
+func (p *PeerImpl) sendTransactionToPeer(peerAddress string, transaction *pb.Transaction) (*pb.Response, error) {
 	conn, err := NewPeerClientConnectionWithAddress(peerAddress)
 	if err != nil {
-		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Error creating client to peer address=%s:  %s", peerAddress, err))}
+		return nil, fmt.Errorf("Error creating client to peer address=%s:  %s", peerAddress, err)
 	}
 	defer conn.Close()
 	serverClient := pb.NewPeerClient(conn)
 	stream, err := serverClient.Chat(context.Background())
 	if err != nil {
-		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Error opening chat stream to peer address=%s:  %s", peerAddress, err))}
+		return nil, fmt.Errorf("Error opening chat stream to peer address=%s:  %s", peerAddress, err)
 	}
 
 	peerLogger.Debug("Sending HELLO to Peer: %s", peerAddress)
 
 	helloMessage, err := p.NewOpenchainDiscoveryHello()
 	if err != nil {
-		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Unexpected error creating new HelloMessage (%s):  %s", peerAddress, err))}
+		return nil, fmt.Errorf("Unexpected error creating new HelloMessage (%s):  %s", peerAddress, err)
 	}
 	if err = stream.Send(helloMessage); err != nil {
 		stream.CloseSend()
-		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Error sending hello to peer address=%s:  %s", peerAddress, err))}
+		return nil, fmt.Errorf("Error sending hello to peer address=%s:  %s", peerAddress, err)
 	}
 
 	waitc := make(chan struct{})
 	var response *pb.Response
+	var streamErr error
 	go func() {
 		// Make sure to close the wait channel
 		defer close(waitc)
 		expectHello := true
+		// The peer may compress or chunk what it sends, as we said hello
+		decoder := &messageDecoder{}
 		for {
 			in, err := stream.Recv()
+			if err == nil {
+				in, err = decoder.decode(in)
+				if err == nil && in == nil {
+					continue
+				}
+			}
 			if err == io.EOF {
 				peerLogger.Debug("Received EOF")
 				// read done.
 				if response == nil {
-					response = &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Error sending transactions to peer address=%s, received EOF when expecting %s", peerAddress, pb.OpenchainMessage_DISC_HELLO))}
+					streamErr = fmt.Errorf("Error sending transactions to peer address=%s, received EOF when expecting %s", peerAddress, pb.OpenchainMessage_DISC_HELLO)
 				}
 				return
 			}
 			if err != nil {
-				response = &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Unexpected error receiving on stream from peer (%s):  %s", peerAddress, err))}
+				streamErr = fmt.Errorf("Unexpected error receiving on stream from peer (%s):  %s", peerAddress, err)
 				return
 			}
 			if in.Type == pb.OpenchainMessage_DISC_HELLO {
@@ -480,6 +590,13 @@ func (p *PeerImpl) SendTransactionsToPeer(peerAddress string, transaction *pb.Tr
 				}
 
 				msg := &pb.OpenchainMessage{Type: ttyp, Payload: payload, Timestamp: util.CreateUtcTimestamp()}
+				if messageNeedsSignature(ttyp) {
+					if msg.Signature, err = p.signForHello(msg, in); err != nil {
+						response = &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Error signing transaction to peer address=%s:  %s", peerAddress, err))}
+						stream.CloseSend()
+						return
+					}
+				}
 				peerLogger.Debug("Sending message %s with timestamp %v to Peer %s", msg.Type, msg.Timestamp, peerAddress)
 				if err = stream.Send(msg); err != nil {
 					peerLogger.Error(fmt.Sprintf("Error sending message %s with timestamp %v to Peer %s:  %s", msg.Type, msg.Timestamp, peerAddress, err))
@@ -500,15 +617,24 @@ func (p *PeerImpl) SendTransactionsToPeer(peerAddress string, transaction *pb.Tr
 					peerLogger.Error(fmt.Sprintf("Received unexpected %s message, will wait for EOF", in.Type))
 					stream.CloseSend()
 				}
+			} else if in.Type == pb.OpenchainMessage_DISC_DISCONNECT {
+				reason := &pb.DisconnectMessage{}
+				proto.Unmarshal(in.Payload, reason)
+				streamErr = fmt.Errorf("Peer address=%s refused the connection: %s", peerAddress, &DisconnectError{Reason: reason, Remote: true})
+				stream.CloseSend()
+				return
 			} else {
 				peerLogger.Debug("Got unexpected message %s, with bytes length = %d,  doing nothing", in.Type, len(in.Payload))
 			}
 		}
 	}()
 
-	//TODO Timeout handling
-	<-waitc
-	return response
+	select {
+	case <-waitc:
+	case <-time.After(viper.GetDuration("peer.forwarding.timeout")):
+		return nil, fmt.Errorf("Timed out waiting for a response from peer address=%s", peerAddress)
+	}
+	return response, streamErr
 }
 
 // SendTransactionsToPeer current temporary mechanism of forwarding transactions to the configured Validator
@@ -590,29 +716,73 @@ func (p *PeerImpl) chatWithPeer(peerAddress string) error {
 		peerLogger.Debug("Starting up the first peer")
 		return nil // nothing to do
 	}
+	return p.retryChat(peerAddress, nil)
+}
+
+const (
+	chatRetryDelay    = time.Second // between attempts to chat with a peer
+	chatRetryDelayMax = time.Minute // after the peer disconnected repeatedly
+)
+
+// retryChat chats with the peer at peerAddress, retrying and reconnecting
+// for as long as keep, if set, returns true. It gives up on a peer which is
+// not on our network, and backs off from one which disconnected for another
+// reason.
+func (p *PeerImpl) retryChat(peerAddress string, keep func() bool) error {
+	delay := chatRetryDelay
 	for {
-		time.Sleep(1 * time.Second)
+		time.Sleep(delay)
+		if keep != nil && !keep() {
+			peerLogger.Debug("No longer chatting with peer address: %s", peerAddress)
+			return nil
+		}
 		peerLogger.Debug("Initiating Chat with peer address: %s", peerAddress)
 		conn, err := NewPeerClientConnectionWithAddress(peerAddress)
 		if err != nil {
 			e := fmt.Errorf("Error creating connection to peer address=%s:  %s", peerAddress, err)
 			peerLogger.Error(e.Error())
+			p.discovery.connectFailed(peerAddress)
 			continue
 		}
 		serverClient := pb.NewPeerClient(conn)
-		ctx := context.Background()
+		ctx := withDialedAddress(context.Background(), peerAddress)
 		stream, err := serverClient.Chat(ctx)
 		if err != nil {
 			e := fmt.Errorf("Error establishing chat with peer address=%s:  %s", peerAddress, err)
 			peerLogger.Error(fmt.Sprintf("%s", e.Error()))
+			p.discovery.connectFailed(peerAddress)
 			continue
 		}
 		peerLogger.Debug("Established Chat with peer address: %s", peerAddress)
-		p.handleChat(ctx, stream, true)
+		err = p.handleChat(ctx, stream, true)
 		stream.CloseSend()
+		conn.Close()
+		var giveUp bool
+		if delay, giveUp = nextChatRetryDelay(delay, err); giveUp {
+			peerLogger.Error(fmt.Sprintf("Giving up on peer address=%s: %s", peerAddress, err))
+			return err
+		}
 	}
 }
 
+// nextChatRetryDelay returns how long to wait before chatting again with a
+// peer, after a chat which followed a wait of delay ended with err, and
+// whether to give up on the peer instead. The delay doubles up to
+// chatRetryDelayMax while the peer keeps disconnecting.
+func nextChatRetryDelay(delay time.Duration, err error) (time.Duration, bool) {
+	disconnect, ok := err.(*DisconnectError)
+	if !ok {
+		return chatRetryDelay, false
+	}
+	if disconnect.Permanent() {
+		return 0, true
+	}
+	if delay *= 2; delay > chatRetryDelayMax {
+		delay = chatRetryDelayMax
+	}
+	return delay, false
+}
+
 // Chat implementation of the the Chat bidi streaming RPC function
 func (p *PeerImpl) handleChat(ctx context.Context, stream ChatStream, initiatedStream bool) error {
 	deadline, ok := ctx.Deadline()
@@ -622,25 +792,93 @@ func (p *PeerImpl) handleChat(ctx context.Context, stream ChatStream, initiatedS
 		return fmt.Errorf("Error creating handler during handleChat initiation: %s", err)
 	}
 	defer handler.Stop()
-	for {
-		in, err := stream.Recv()
-		if err == io.EOF {
-			peerLogger.Debug("Received EOF, ending Chat")
-			return nil
+
+	// Receive in the background, so that the chat can also end when the
+	// handler is closed
+	received := make(chan *pb.OpenchainMessage)
+	failed := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				failed <- err
+				return
+			}
+			select {
+			case received <- in:
+			case <-done:
+				return
+			}
 		}
-		if err != nil {
+	}()
+	var closed <-chan struct{}
+	if closer, ok := handler.(interface {
+		Closed() <-chan struct{}
+	}); ok {
+		closed = closer.Closed()
+	}
+	decoder, _ := handler.(interface {
+		DecodeMessage(*pb.OpenchainMessage) (*pb.OpenchainMessage, error)
+	})
+
+	for {
+		select {
+		case <-closed:
+			peerLogger.Debug("Handler closed, ending Chat")
+			return fmt.Errorf("Chat closed by the handler")
+		case err := <-failed:
+			if err == io.EOF {
+				peerLogger.Debug("Received EOF, ending Chat")
+				return nil
+			}
 			e := fmt.Errorf("Error during Chat, stopping handler: %s", err)
 			peerLogger.Error(e.Error())
 			return e
+		case in := <-received:
+			var err error
+			if decoder != nil {
+				in, err = decoder.DecodeMessage(in)
+			}
+			if err == nil && in != nil {
+				err = handler.HandleMessage(in)
+			}
+			if err != nil {
+				peerLogger.Error(fmt.Sprintf("Error handling message: %s", err))
+				if disconnect, ok := err.(*DisconnectError); ok {
+					// Turning a peer away for lack of room is no fault of the
+					// peer, and neither is the peer ending the chat
+					if !disconnect.Remote && disconnect.Reason.Reason != pb.DisconnectMessage_TOO_MANY_PEERS {
+						p.protocolError(handler)
+					}
+					return err
+				}
+				p.protocolError(handler)
+				//return err
+			}
 		}
-		err = handler.HandleMessage(in)
-		if err != nil {
-			peerLogger.Error(fmt.Sprintf("Error handling message: %s", err))
-			//return err
-		}
 	}
 }
 
+// protocolError lowers the reputation of the identity of the peer behind
+// handler, unless the handler merely duplicates the registered handler for
+// that peer
+func (p *PeerImpl) protocolError(handler MessageHandler) {
+	endpoint, err := handler.To()
+	if err != nil {
+		return
+	}
+	identity := handlerIdentity(handler)
+	p.handlerMap.RLock()
+	registered, ok := p.handlerMap.m[*endpoint.ID]
+	p.handlerMap.RUnlock()
+	if ok && registered != handler && handlerIdentity(registered) == identity {
+		return
+	}
+	p.discovery.protocolError(identity)
+}
+
 // The address to stream requests to
 func getValidatorStreamAddress() string {
 	localaddr, _ := GetLocalAddress()
@@ -659,8 +897,14 @@ func (p *PeerImpl) ExecuteTransaction(transaction *pb.Transaction) *pb.Response
 	if viper.GetBool("peer.validator.enabled") { // send gRPC request to yourself
 		response = sendTransactionsToThisPeer(peerAddress, transaction)
 
+	} else if viper.GetBool("peer.replies.enabled") && transaction.Type != pb.Transaction_CHAINCODE_QUERY {
+		response = p.sendTransactionWithReplies(transaction)
 	} else {
-		response = p.SendTransactionsToPeer(peerAddress, transaction)
+		var address string
+		response, address = p.forwardTransaction(transaction)
+		if response.Status == pb.Response_SUCCESS && transaction.Type != pb.Transaction_CHAINCODE_QUERY {
+			go p.rebroadcastUnlessCommitted(transaction, address)
+		}
 	}
 
 	return response
@@ -688,7 +932,57 @@ func (p *PeerImpl) newHelloMessage() (*pb.HelloMessage, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error creating hello message, error getting block chain info: %s", err)
 	}
-	return &pb.HelloMessage{PeerEndpoint: endpoint, BlockchainInfo: blockChainInfo}, nil
+	helloMessage := &pb.HelloMessage{
+		PeerEndpoint:    endpoint,
+		BlockchainInfo:  blockChainInfo,
+		NetworkID:       viper.GetString("peer.networkId"),
+		ProtocolVersion: viper.GetString("peer.version"),
+		Compressions:    compressions(),
+		Chunking:        true,
+	}
+	if genesis, err := p.ledgerWrapper.ledger.GetBlockByNumber(0); err == nil {
+		if helloMessage.GenesisHash, err = genesis.GetHash(); err != nil {
+			return nil, fmt.Errorf("Error creating hello message, error hashing the genesis block: %s", err)
+		}
+	} else if helloMessage.GenesisHash, err = configuredGenesisHash(); err != nil {
+		return nil, fmt.Errorf("Error creating hello message: %s", err)
+	}
+	if viper.GetBool("security.enabled") {
+		helloMessage.Nonce = make([]byte, authNonceSize)
+		if _, err := rand.Read(helloMessage.Nonce); err != nil {
+			return nil, fmt.Errorf("Error creating hello message, error generating the challenge: %s", err)
+		}
+	}
+	return helloMessage, nil
+}
+
+// checkGenesisConfig warns if this peer can neither tell which network the
+// peers it connects to are on nor sync its blockchain, because it has no
+// genesis block and peer.genesisHash is not set. A validator makes its
+// genesis block on startup.
+func (p *PeerImpl) checkGenesisConfig() error {
+	genesisHash, err := configuredGenesisHash()
+	if err != nil {
+		return err
+	}
+	if len(genesisHash) != 0 || viper.GetBool("peer.validator.enabled") {
+		return nil
+	}
+	if genesis, err := p.ledgerWrapper.ledger.GetBlockByNumber(0); err == nil && genesis != nil {
+		return nil
+	}
+	peerLogger.Error("No blockchain and no peer.genesisHash: this peer cannot check that the peers it connects to are on its network, and will not sync blocks until peer.genesisHash is set to the hash of the genesis block of the network")
+	return nil
+}
+
+// configuredGenesisHash returns the hash of the genesis block of the network
+// set in peer.genesisHash, which a peer without a blockchain says it has
+func configuredGenesisHash() ([]byte, error) {
+	genesisHash, err := hex.DecodeString(viper.GetString("peer.genesisHash"))
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding peer.genesisHash: %s", err)
+	}
+	return genesisHash, nil
 }
 
 // GetBlockByNumber return a block by block number
@@ -698,6 +992,22 @@ func (p *PeerImpl) GetBlockByNumber(blockNumber uint64) (*pb.Block, error) {
 	return p.ledgerWrapper.ledger.GetBlockByNumber(blockNumber)
 }
 
+// GetTransactionProof returns a transaction along with the proof that it is in
+// the block it was committed in
+func (p *PeerImpl) GetTransactionProof(txUUID string) (*pb.TransactionProof, error) {
+	p.ledgerWrapper.RLock()
+	defer p.ledgerWrapper.RUnlock()
+	return p.ledgerWrapper.ledger.GetTransactionProof(txUUID)
+}
+
+// GetLatestCheckpointCertificate returns the latest stable checkpoint
+// certificate stored in the ledger
+func (p *PeerImpl) GetLatestCheckpointCertificate() (*pb.CheckpointCertificate, error) {
+	p.ledgerWrapper.RLock()
+	defer p.ledgerWrapper.RUnlock()
+	return p.ledgerWrapper.ledger.GetLatestCheckpointCertificate()
+}
+
 // GetStateSnapshot return the state snapshot
 func (p *PeerImpl) GetStateSnapshot() (*state.StateSnapshot, error) {
 	p.ledgerWrapper.RLock()
@@ -0,0 +1,260 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// ReplyCollector gathers the replies of validators to a single transaction.
+// It completes once f+1 distinct validators sent matching replies: as at
+// least one of them is correct, their outcome is the one the network agreed
+// on. Signatures must be verified before replies are added.
+type ReplyCollector struct {
+	sync.Mutex
+	uuid    string
+	quorum  int
+	replies map[pb.PeerID]*pb.TransactionReply
+	cert    []*pb.TransactionReply
+	done    chan struct{}
+}
+
+// NewReplyCollector returns a collector for the replies to transaction
+// uuid, tolerating f faulty validators
+func NewReplyCollector(uuid string, f int) *ReplyCollector {
+	return &ReplyCollector{
+		uuid:    uuid,
+		quorum:  f + 1,
+		replies: make(map[pb.PeerID]*pb.TransactionReply),
+		done:    make(chan struct{}),
+	}
+}
+
+// Add records the reply of a validator, replacing any earlier reply of the
+// same validator. It returns whether the collector is complete.
+func (c *ReplyCollector) Add(reply *pb.TransactionReply) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if reply.Uuid != c.uuid {
+		return false, fmt.Errorf("Reply is for transaction %s, not %s", reply.Uuid, c.uuid)
+	}
+	if reply.Replica == nil {
+		return false, fmt.Errorf("Reply to transaction %s does not name its replica", reply.Uuid)
+	}
+	if c.cert != nil {
+		return true, nil
+	}
+	c.replies[*reply.Replica] = reply
+
+	var matching []*pb.TransactionReply
+	for _, other := range c.replies {
+		if other.Matches(reply) {
+			matching = append(matching, other)
+		}
+	}
+	if len(matching) < c.quorum {
+		return false, nil
+	}
+	c.cert = matching
+	close(c.done)
+	return true, nil
+}
+
+// Done returns a channel which is closed once the collector is complete
+func (c *ReplyCollector) Done() <-chan struct{} {
+	return c.done
+}
+
+// Certificate returns the f+1 matching replies, or nil if the collector is
+// not complete yet
+func (c *ReplyCollector) Certificate() []*pb.TransactionReply {
+	c.Lock()
+	defer c.Unlock()
+	return c.cert
+}
+
+type replyCollectors struct {
+	sync.Mutex
+	m     map[string]*ReplyCollector
+	certs map[string]*pb.TransactionReplyCertificate // certificates of recently confirmed transactions
+	order []string                                   // uuids in certs, oldest first
+}
+
+func newReplyCollectors() *replyCollectors {
+	return &replyCollectors{
+		m:     make(map[string]*ReplyCollector),
+		certs: make(map[string]*pb.TransactionReplyCertificate),
+	}
+}
+
+// confirmed keeps the certificate of a confirmed transaction, for up to
+// peer.replies.cachesize transactions
+func (rc *replyCollectors) confirmed(uuid string, replies []*pb.TransactionReply) {
+	rc.Lock()
+	defer rc.Unlock()
+	if _, ok := rc.certs[uuid]; !ok {
+		rc.order = append(rc.order, uuid)
+	}
+	rc.certs[uuid] = &pb.TransactionReplyCertificate{Uuid: uuid, Replies: replies}
+	for len(rc.order) > viper.GetInt("peer.replies.cachesize") {
+		delete(rc.certs, rc.order[0])
+		rc.order = rc.order[1:]
+	}
+}
+
+// GetReplyCertificate returns the f+1 matching replies which confirmed the
+// outcome of a transaction this peer forwarded recently, or nil if there
+// are none
+func (p *PeerImpl) GetReplyCertificate(txUUID string) *pb.TransactionReplyCertificate {
+	p.replies.Lock()
+	defer p.replies.Unlock()
+	return p.replies.certs[txUUID]
+}
+
+// replyFaults returns the number of faulty validators to tolerate when
+// collecting replies: peer.replies.f if set, otherwise validatorFaults
+func (p *PeerImpl) replyFaults() int {
+	if value := viper.GetString("peer.replies.f"); value != "" {
+		f, err := strconv.Atoi(value)
+		if err == nil && f >= 0 {
+			return f
+		}
+		peerLogger.Warning("Ignoring invalid peer.replies.f %q", value)
+	}
+	return p.validatorFaults()
+}
+
+// validatorFaults returns the most faulty validators the network tolerates,
+// (N-1)/3 for N validators
+func (p *PeerImpl) validatorFaults() int {
+	n := len(validatorAllowList())
+	if n == 0 {
+		n = p.knownValidators()
+	}
+	if n == 0 {
+		return 0
+	}
+	return (n - 1) / 3
+}
+
+// knownValidators returns the number of distinct validators this peer is
+// connected to or discovered
+func (p *PeerImpl) knownValidators() int {
+	known := make(map[pb.PeerID]bool)
+	for id := range p.cloneHandlerMap(pb.PeerEndpoint_VALIDATOR) {
+		known[id] = true
+	}
+	for _, discovered := range p.GetDiscoveredPeers() {
+		if discovered.Endpoint != nil && discovered.Endpoint.ID != nil && discovered.Endpoint.Type == pb.PeerEndpoint_VALIDATOR {
+			known[*discovered.Endpoint.ID] = true
+		}
+	}
+	return len(known)
+}
+
+// ReplyReceived passes the reply a validator sent over its handler to the
+// collector waiting for it, if any
+func (p *PeerImpl) ReplyReceived(reply *pb.TransactionReply, from *pb.PeerEndpoint) error {
+	if from == nil || from.Type != pb.PeerEndpoint_VALIDATOR {
+		return fmt.Errorf("Received reply to transaction %s from a non-validator", reply.Uuid)
+	}
+	if reply.Replica == nil || *reply.Replica != *from.ID {
+		return fmt.Errorf("Received reply to transaction %s on behalf of another replica from %s", reply.Uuid, from.ID)
+	}
+	if p.secHelper != nil {
+		data, err := reply.SignedBytes()
+		if err != nil {
+			return err
+		}
+		if err = p.secHelper.Verify(from.PkiID, reply.Signature, data); err != nil {
+			return fmt.Errorf("Error verifying signature of reply to transaction %s from %s: %s", reply.Uuid, from.ID, err)
+		}
+	}
+
+	p.replies.Lock()
+	collector, ok := p.replies.m[reply.Uuid]
+	p.replies.Unlock()
+	if !ok {
+		peerLogger.Debug("Ignoring reply to transaction %s from %s, nobody is waiting for it", reply.Uuid, from.ID)
+		return nil
+	}
+	_, err := collector.Add(reply)
+	return err
+}
+
+// sendTransactionWithReplies forwards a transaction to a validator, and then
+// waits until f+1 validators confirmed its outcome. If the transaction is not
+// confirmed within peer.forwarding.rebroadcast, it is also sent to f+1 other
+// validators, as the validator which accepted it may be faulty.
+func (p *PeerImpl) sendTransactionWithReplies(transaction *pb.Transaction) *pb.Response {
+	f := p.replyFaults()
+	timeout := viper.GetDuration("peer.replies.timeout")
+	collector := NewReplyCollector(transaction.Uuid, f)
+
+	p.replies.Lock()
+	p.replies.m[transaction.Uuid] = collector
+	p.replies.Unlock()
+	defer func() {
+		p.replies.Lock()
+		delete(p.replies.m, transaction.Uuid)
+		p.replies.Unlock()
+	}()
+
+	payload, err := proto.Marshal(&pb.TransactionReplyRequest{Uuid: transaction.Uuid})
+	if err != nil {
+		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Error marshalling reply request: %s", err))}
+	}
+	// ask before forwarding, so that a fast commit does not depend on the
+	// validators still remembering the reply
+	if errs := p.Broadcast(&pb.OpenchainMessage{Type: pb.OpenchainMessage_CHAIN_REPLY_REQUEST, Payload: payload}, pb.PeerEndpoint_VALIDATOR); len(errs) > 0 {
+		peerLogger.Warning("Error requesting replies to transaction %s: %v", transaction.Uuid, errs)
+	}
+
+	deadline := time.After(timeout)
+	response, address := p.forwardTransaction(transaction)
+	if response.Status != pb.Response_SUCCESS {
+		return response
+	}
+
+	select {
+	case <-collector.Done():
+	case <-time.After(viper.GetDuration("peer.forwarding.rebroadcast")):
+		peerLogger.Warning("Transaction %s not confirmed yet, sending it to %d more validators", transaction.Uuid, f+1)
+		go p.broadcastTransaction(transaction, f+1, address)
+	}
+
+	select {
+	case <-collector.Done():
+		cert := collector.Certificate()
+		peerLogger.Debug("Transaction %s confirmed by %d validators", transaction.Uuid, len(cert))
+		p.replies.confirmed(transaction.Uuid, cert)
+		return response
+	case <-deadline:
+		return &pb.Response{Status: pb.Response_FAILURE, Msg: []byte(fmt.Sprintf("Transaction %s was not confirmed by %d validators within %s", transaction.Uuid, f+1, timeout))}
+	}
+}
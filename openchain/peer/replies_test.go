@@ -0,0 +1,114 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+func TestReplyCollector(t *testing.T) {
+	result := &pb.TransactionResult{Uuid: "tx1", Result: []byte("ok")}
+	reply := func(replica int, result *pb.TransactionResult) *pb.TransactionReply {
+		r, err := pb.NewTransactionReply(result, 1, &pb.PeerID{Name: fmt.Sprintf("vp%d", replica)})
+		if err != nil {
+			t.Fatalf("Could not create reply: %s", err)
+		}
+		return r
+	}
+
+	collector := NewReplyCollector("tx1", 1)
+	if done, err := collector.Add(reply(0, result)); done || err != nil {
+		t.Fatalf("Expected a single reply not to complete the collector, got %v, %v", done, err)
+	}
+	// a second reply from the same replica does not count
+	if done, _ := collector.Add(reply(0, result)); done {
+		t.Fatalf("Expected duplicate reply not to complete the collector")
+	}
+	// nor does a reply with a different outcome
+	if done, _ := collector.Add(reply(1, &pb.TransactionResult{Uuid: "tx1", ErrorCode: 1})); done {
+		t.Fatalf("Expected mismatching reply not to complete the collector")
+	}
+	if _, err := collector.Add(reply(2, &pb.TransactionResult{Uuid: "tx2"})); err == nil {
+		t.Fatalf("Expected reply to another transaction to be rejected")
+	}
+	if collector.Certificate() != nil {
+		t.Fatalf("Expected no certificate yet")
+	}
+
+	if done, err := collector.Add(reply(3, result)); !done || err != nil {
+		t.Fatalf("Expected f+1 matching replies to complete the collector, got %v, %v", done, err)
+	}
+	select {
+	case <-collector.Done():
+	default:
+		t.Fatalf("Expected done channel to be closed")
+	}
+	if cert := collector.Certificate(); len(cert) != 2 {
+		t.Fatalf("Expected certificate of 2 replies, got %v", cert)
+	}
+}
+
+func TestReplyFaults(t *testing.T) {
+	defer viper.Set("peer.replies.f", "")
+	defer viper.Set("peer.validators.allowList", []string{})
+
+	p := &PeerImpl{
+		handlerMap: &handlerMap{m: make(map[pb.PeerID]MessageHandler)},
+		discovery:  newDiscoveryStore(false),
+	}
+	for i := 0; i < 4; i++ {
+		p.discovery.discovered(&pb.PeerEndpoint{
+			ID:      &pb.PeerID{Name: fmt.Sprintf("vp%d", i)},
+			Address: fmt.Sprintf("10.0.0.%d:30303", i),
+			Type:    pb.PeerEndpoint_VALIDATOR,
+		})
+	}
+	p.discovery.discovered(&pb.PeerEndpoint{
+		ID:      &pb.PeerID{Name: "nvp"},
+		Address: "10.0.0.9:30303",
+		Type:    pb.PeerEndpoint_NON_VALIDATOR,
+	})
+
+	viper.Set("peer.replies.f", "")
+	viper.Set("peer.validators.allowList", []string{})
+	if f := p.replyFaults(); f != 1 {
+		t.Errorf("Expected 4 known validators to tolerate 1 fault, got %d", f)
+	}
+
+	var allowList []string
+	for i := 0; i < 7; i++ {
+		allowList = append(allowList, hex.EncodeToString([]byte(fmt.Sprintf("vp%d", i))))
+	}
+	viper.Set("peer.validators.allowList", allowList)
+	if f := p.replyFaults(); f != 2 {
+		t.Errorf("Expected 7 allowed validators to tolerate 2 faults, got %d", f)
+	}
+
+	viper.Set("peer.replies.f", "0")
+	if f := p.replyFaults(); f != 0 {
+		t.Errorf("Expected the configured number of faults, got %d", f)
+	}
+}
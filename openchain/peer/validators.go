@@ -0,0 +1,114 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// validatorAllowList returns the hashes of the enrollment certificates of
+// the peers allowed to act as validators, from peer.validators.allowList, or
+// nil if any peer proving the validator role may act as one
+func validatorAllowList() map[string]bool {
+	entries := viper.GetStringSlice("peer.validators.allowList")
+	if len(entries) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		pkiID, err := hex.DecodeString(strings.TrimSpace(entry))
+		if err != nil || len(pkiID) == 0 {
+			peerLogger.Warning("Ignoring invalid entry %q of peer.validators.allowList: %v", entry, err)
+			continue
+		}
+		allowed[string(pkiID)] = true
+	}
+	return allowed
+}
+
+// validatorsProvable reports whether a peer can prove that it is a
+// validator: by holding a certificate on peer.validators.allowList or,
+// without one, by answering our challenge with an enrollment certificate of
+// the validator role, which needs security. Without either, peers saying
+// they are validators are only trusted with peer.validators.unproven: trust.
+func validatorsProvable() bool {
+	return validatorAllowList() != nil || viper.GetBool("security.enabled")
+}
+
+// provenValidator returns whether the peer proved it is allowed to act as a
+// validator, which it can only do by answering our challenge with the key of
+// an allowed enrollment certificate or, without an allow list, of a
+// certificate of the validator role (see verifyPeerSignature)
+func (d *Handler) provenValidator(allowed map[string]bool) bool {
+	if allowed == nil {
+		return d.authenticated
+	}
+	return d.authenticated && allowed[string(d.ToPeerEndpoint.PkiID)]
+}
+
+// checkValidator treats a peer saying it is a validator as a non-validator,
+// or returns why it has to be disconnected per peer.validators.unproven,
+// unless it proved it is allowed to act as one
+func (d *Handler) checkValidator() *pb.DisconnectMessage {
+	if d.ToPeerEndpoint == nil || d.ToPeerEndpoint.Type != pb.PeerEndpoint_VALIDATOR {
+		return nil
+	}
+	if d.provenValidator(validatorAllowList()) {
+		return nil
+	}
+	unproven := viper.GetString("peer.validators.unproven")
+	var detail string
+	switch {
+	case !validatorsProvable():
+		if unproven == "trust" {
+			return nil
+		}
+		detail = "neither security nor peer.validators.allowList is enabled, so the peer cannot prove it is a validator"
+	case !d.authenticated:
+		detail = "peer did not prove its enrollment certificate"
+	default:
+		detail = fmt.Sprintf("peer with pkiID %x is not an allowed validator", d.ToPeerEndpoint.PkiID)
+	}
+	if unproven == "refuse" {
+		return &pb.DisconnectMessage{Reason: pb.DisconnectMessage_UNPROVEN_VALIDATOR, Detail: detail}
+	}
+	peerLogger.Warning("Treating peer %s as a non-validator: %s", d.ToPeerEndpoint.ID, detail)
+	d.ToPeerEndpoint.Type = pb.PeerEndpoint_NON_VALIDATOR
+	return nil
+}
+
+// checkValidatorConfig warns on startup if peers cannot prove that they are
+// validators, in which case they are either all trusted or none is
+func checkValidatorConfig() {
+	if validatorsProvable() {
+		return
+	}
+	if viper.GetString("peer.validators.unproven") == "trust" {
+		peerLogger.Error("Neither security nor peer.validators.allowList is enabled and peer.validators.unproven is trust: any peer saying it is a validator takes part in consensus and vouches for blocks and replies, which is only safe on a development network")
+		return
+	}
+	peerLogger.Error("Neither security nor peer.validators.allowList is enabled: no peer can prove it is a validator, so none is treated as one and this peer neither runs consensus with nor syncs from other validators")
+}
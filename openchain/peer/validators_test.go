@@ -0,0 +1,151 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// validatorHandshake has the validators vp1 and vp2 say hello, and answer
+// the challenge of each other with security enabled. It returns the handlers
+// of vp1 and vp2 for their chat, and the first error of the handshake.
+func validatorHandshake(t *testing.T) (*Handler, *testCoordinator, *Handler, *testCoordinator, error) {
+	a, coordA, streamA := newTestHandler(t, "vp1", true)
+	b, coordB, streamB := newTestHandler(t, "vp2", false)
+	coordA.typ, coordB.typ = pb.PeerEndpoint_VALIDATOR, pb.PeerEndpoint_VALIDATOR
+	// The hello of vp1 was sent before its type was set
+	streamA.take()
+	if err := a.sendHello(); err != nil {
+		t.Fatalf("Error sending the hello of vp1: %s", err)
+	}
+	for _, step := range []struct {
+		d      *Handler
+		stream *testStream
+	}{{b, streamA}, {a, streamB}, {b, streamA}} {
+		if err := deliver(step.d, step.stream.take()); err != nil {
+			return a, coordA, b, coordB, err
+		}
+	}
+	return a, coordA, b, coordB, nil
+}
+
+func TestValidatorAllowList(t *testing.T) {
+	for _, key := range []string{"security.enabled", "peer.validators.allowList", "peer.validators.unproven"} {
+		defer viper.Set(key, viper.Get(key))
+	}
+	viper.Set("security.enabled", true)
+	viper.Set("peer.validators.allowList", []string{hex.EncodeToString([]byte("vp1")), "not hex"})
+	viper.Set("peer.validators.unproven", "downgrade")
+
+	a, coordA, b, coordB, err := validatorHandshake(t)
+	if err != nil {
+		t.Fatalf("Error in the handshake: %s", err)
+	}
+	defer a.Stop()
+	defer b.Stop()
+	if len(coordA.registered) != 1 || len(coordB.registered) != 1 {
+		t.Fatalf("Expected both peers to be registered")
+	}
+	if to, _ := b.To(); to.Type != pb.PeerEndpoint_VALIDATOR {
+		t.Fatalf("Expected the allowed vp1 to be a validator, got %s", to.Type)
+	}
+	if to, _ := a.To(); to.Type != pb.PeerEndpoint_NON_VALIDATOR {
+		t.Fatalf("Expected vp2, which is not allowed, to be downgraded, got %s", to.Type)
+	}
+
+	viper.Set("peer.validators.unproven", "refuse")
+	c, coordC, d, _, err := validatorHandshake(t)
+	defer c.Stop()
+	defer d.Stop()
+	if disconnect, ok := err.(*DisconnectError); !ok || disconnect.Reason.Reason != pb.DisconnectMessage_UNPROVEN_VALIDATOR {
+		t.Fatalf("Expected vp2 to be refused, got %v", err)
+	}
+	if len(coordC.registered) != 0 {
+		t.Fatalf("Expected the refused vp2 not to be registered")
+	}
+}
+
+func TestValidatorAllowListWithoutSecurity(t *testing.T) {
+	for _, key := range []string{"security.enabled", "peer.validators.allowList", "peer.validators.unproven"} {
+		defer viper.Set(key, viper.Get(key))
+	}
+	viper.Set("security.enabled", false)
+	viper.Set("peer.validators.unproven", "downgrade")
+
+	// Without an allow list nor security, no peer can prove it is a
+	// validator, unless peers are trusted explicitly
+	viper.Set("peer.validators.allowList", []string{})
+	d := &Handler{ToPeerEndpoint: &pb.PeerEndpoint{Type: pb.PeerEndpoint_VALIDATOR, PkiID: []byte("vp1")}}
+	if reason := d.checkValidator(); reason != nil || d.ToPeerEndpoint.Type != pb.PeerEndpoint_NON_VALIDATOR {
+		t.Fatalf("Expected a peer saying it is a validator to be downgraded without an allow list nor security")
+	}
+	viper.Set("peer.validators.unproven", "refuse")
+	d.ToPeerEndpoint.Type = pb.PeerEndpoint_VALIDATOR
+	if reason := d.checkValidator(); reason == nil || reason.Reason != pb.DisconnectMessage_UNPROVEN_VALIDATOR {
+		t.Fatalf("Expected a peer saying it is a validator to be refused without an allow list nor security, got %v", reason)
+	}
+	viper.Set("peer.validators.unproven", "trust")
+	if reason := d.checkValidator(); reason != nil || d.ToPeerEndpoint.Type != pb.PeerEndpoint_VALIDATOR {
+		t.Fatalf("Expected a peer saying it is a validator to be trusted when unproven peers are")
+	}
+
+	// Without security, no peer can prove it holds an allowed certificate,
+	// which trusting unproven peers does not change
+	viper.Set("peer.validators.allowList", []string{hex.EncodeToString([]byte("vp1"))})
+	if reason := d.checkValidator(); reason != nil || d.ToPeerEndpoint.Type != pb.PeerEndpoint_NON_VALIDATOR {
+		t.Fatalf("Expected the unauthenticated vp1 to be downgraded")
+	}
+}
+
+func TestValidatorRoleWithoutAllowList(t *testing.T) {
+	for _, key := range []string{"security.enabled", "peer.validators.allowList", "peer.validators.unproven"} {
+		defer viper.Set(key, viper.Get(key))
+	}
+	viper.Set("security.enabled", true)
+	viper.Set("peer.validators.allowList", []string{})
+	viper.Set("peer.validators.unproven", "downgrade")
+
+	// The validators prove their role by answering the challenge
+	a, coordA, b, coordB, err := validatorHandshake(t)
+	if err != nil {
+		t.Fatalf("Error in the handshake: %s", err)
+	}
+	defer a.Stop()
+	defer b.Stop()
+	if len(coordA.registered) != 1 || len(coordB.registered) != 1 {
+		t.Fatalf("Expected both peers to be registered")
+	}
+	for _, d := range []*Handler{a, b} {
+		if to, _ := d.To(); to.Type != pb.PeerEndpoint_VALIDATOR {
+			t.Fatalf("Expected %s to be a validator, got %s", to.ID, to.Type)
+		}
+	}
+
+	// A peer which did not answer the challenge proved nothing
+	d := &Handler{ToPeerEndpoint: &pb.PeerEndpoint{ID: &pb.PeerID{Name: "vp3"}, Type: pb.PeerEndpoint_VALIDATOR, PkiID: []byte("vp3")}}
+	if reason := d.checkValidator(); reason != nil || d.ToPeerEndpoint.Type != pb.PeerEndpoint_NON_VALIDATOR {
+		t.Fatalf("Expected the unauthenticated vp3 to be downgraded")
+	}
+}
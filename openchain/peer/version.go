@@ -0,0 +1,159 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "github.com/hyperledger-incubator/obc-peer/protos"
+)
+
+// messageVersions are the protocol versions which introduced message types.
+// Messages of these types are only exchanged with a peer once the protocol
+// version negotiated with it is at least as high, so that peers can be
+// upgraded one at a time. The types not listed are in every version.
+var messageVersions = map[pb.OpenchainMessage_Type]string{
+	pb.OpenchainMessage_SYNC_CREDIT:                     "0.2.0",
+	pb.OpenchainMessage_GOSSIP_BLOCK_HEADER:             "0.3.0",
+	pb.OpenchainMessage_SYNC_GET_BLOCK_HEADERS:          "0.3.0",
+	pb.OpenchainMessage_SYNC_BLOCK_HEADERS:              "0.3.0",
+	pb.OpenchainMessage_SYNC_GET_TRANSACTION_PROOF:      "0.3.0",
+	pb.OpenchainMessage_SYNC_TRANSACTION_PROOF:          "0.3.0",
+	pb.OpenchainMessage_DISC_PING:                       "0.3.0",
+	pb.OpenchainMessage_DISC_PONG:                       "0.3.0",
+	pb.OpenchainMessage_SYNC_GET_CHECKPOINT_CERTIFICATE: "0.3.0",
+	pb.OpenchainMessage_SYNC_CHECKPOINT_CERTIFICATE:     "0.3.0",
+}
+
+// protocolVersion is a semver version of the peer protocol, see
+// http://semver.org/. Pre-release and build suffixes are ignored.
+type protocolVersion struct {
+	major, minor, patch uint64
+}
+
+func parseProtocolVersion(version string) (protocolVersion, error) {
+	v := protocolVersion{}
+	core := version
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("protocol version %q is not of the form MAJOR.MINOR.PATCH", version)
+	}
+	numbers := []*uint64{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("protocol version %q is not of the form MAJOR.MINOR.PATCH", version)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+func (v protocolVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// compatible tells whether peers speaking v and other can talk to each
+// other: they need the same major version. Within it, versions only add to
+// the protocol, which the peers then use as far as both speak it.
+func (v protocolVersion) compatible(other protocolVersion) bool {
+	return v.major == other.major
+}
+
+func (v protocolVersion) less(other protocolVersion) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+	if v.minor != other.minor {
+		return v.minor < other.minor
+	}
+	return v.patch < other.patch
+}
+
+// negotiateProtocolVersion returns the highest protocol version both peers
+// speak. A peer speaks every compatible version up to its own, so this is
+// the lower of the two versions.
+func negotiateProtocolVersion(local string, remote string) (string, error) {
+	localVersion, err := parseProtocolVersion(local)
+	if err != nil {
+		return "", err
+	}
+	remoteVersion, err := parseProtocolVersion(remote)
+	if err != nil {
+		return "", err
+	}
+	if !localVersion.compatible(remoteVersion) {
+		return "", fmt.Errorf("protocol version %s is not compatible with ours, %s", remoteVersion, localVersion)
+	}
+	if remoteVersion.less(localVersion) {
+		return remoteVersion.String(), nil
+	}
+	return localVersion.String(), nil
+}
+
+// speaksProtocolVersion reports whether a peer with the negotiated protocol
+// version speaks version, which is the case when version is empty
+func speaksProtocolVersion(negotiated string, version string) bool {
+	if version == "" {
+		return true
+	}
+	negotiatedVersion, err := parseProtocolVersion(negotiated)
+	if err != nil {
+		return false
+	}
+	required, err := parseProtocolVersion(version)
+	if err != nil {
+		return false
+	}
+	return negotiatedVersion.compatible(required) && !negotiatedVersion.less(required)
+}
+
+// protocolVersioned is implemented by handlers which negotiate a protocol
+// version with their peer
+type protocolVersioned interface {
+	ProtocolVersion() string
+}
+
+// handlerSpeaks reports whether the peer of handler takes messages of type
+// msgType. Handlers which negotiate no protocol version take every type.
+func handlerSpeaks(handler MessageHandler, msgType pb.OpenchainMessage_Type) bool {
+	versioned, ok := handler.(protocolVersioned)
+	if !ok {
+		return true
+	}
+	return speaksProtocolVersion(versioned.ProtocolVersion(), messageVersions[msgType])
+}
+
+// speakingHandlers returns the handlers whose peers take messages of type
+// msgType
+func speakingHandlers(handlers map[pb.PeerID]MessageHandler, msgType pb.OpenchainMessage_Type) map[pb.PeerID]MessageHandler {
+	speaking := make(map[pb.PeerID]MessageHandler)
+	for id, handler := range handlers {
+		if handler != nil && handlerSpeaks(handler, msgType) {
+			speaking[id] = handler
+		}
+	}
+	return speaking
+}
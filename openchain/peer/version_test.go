@@ -0,0 +1,54 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package peer
+
+import "testing"
+
+func TestNegotiateProtocolVersion(t *testing.T) {
+	for _, c := range []struct {
+		local, remote, negotiated string
+	}{
+		{"1.2.0", "1.2.0", "1.2.0"},
+		{"1.2.0", "1.4.1", "1.2.0"},
+		{"1.4.1", "1.2.0", "1.2.0"},
+		{"1.10.0", "1.9.3", "1.9.3"},
+		{"0.1.0", "0.1.5-rc1", "0.1.0"},
+		{"2.0.0+build7", "2.0.1", "2.0.0"},
+		{"0.1.0", "0.2.0", "0.1.0"},
+		{"0.3.2", "0.2.0", "0.2.0"},
+		{"1.0.0", "2.0.0", ""},
+		{"1.0.0", "", ""},
+		{"1.0.0", "1.0", ""},
+		{"1.0.0", "1.x.0", ""},
+	} {
+		negotiated, err := negotiateProtocolVersion(c.local, c.remote)
+		if c.negotiated == "" {
+			if err == nil {
+				t.Errorf("Expected %q and %q not to be compatible, negotiated %s", c.local, c.remote, negotiated)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed negotiating %q and %q: %s", c.local, c.remote, err)
+		} else if negotiated != c.negotiated {
+			t.Errorf("Expected %q and %q to negotiate %s, got %s", c.local, c.remote, c.negotiated, negotiated)
+		}
+	}
+}
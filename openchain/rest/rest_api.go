@@ -48,11 +48,13 @@ import (
 var restLogger = logging.MustGetLogger("rest")
 
 // serverOpenchain is a variable that holds the pointer to the
-// underlying ServerOpenchain object. serverDevops is a variable that holds
-// the pointer to the underlying Devops object. This is necessary due to
-// how the gocraft/web package implements context initialization.
+// underlying ServerOpenchain object. serverDevops and serverAdmin are
+// variables that hold the pointers to the underlying Devops and ServerAdmin
+// objects. This is necessary due to how the gocraft/web package implements
+// context initialization.
 var serverOpenchain *oc.ServerOpenchain
 var serverDevops *oc.Devops
+var serverAdmin *oc.ServerAdmin
 
 // ServerOpenchainREST defines the Openchain REST service object. It exposes
 // the methods available on the ServerOpenchain service and the Devops service
@@ -60,6 +62,7 @@ var serverDevops *oc.Devops
 type ServerOpenchainREST struct {
 	server *oc.ServerOpenchain
 	devops *oc.Devops
+	admin  *oc.ServerAdmin
 }
 
 // restResult defines the structure of the REST interface JSON response.
@@ -69,10 +72,12 @@ type restResult struct {
 }
 
 // SetOpenchainServer is a middleware function that sets the pointer to the
-// underlying ServerOpenchain object and the undeflying Devops object.
+// underlying ServerOpenchain object and the undeflying Devops and ServerAdmin
+// objects.
 func (s *ServerOpenchainREST) SetOpenchainServer(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
 	s.server = serverOpenchain
 	s.devops = serverDevops
+	s.admin = serverAdmin
 
 	next(rw, req)
 }
@@ -564,6 +569,31 @@ func (s *ServerOpenchainREST) GetBlockByNumber(rw web.ResponseWriter, req *web.R
 	}
 }
 
+// GetLatestCheckpointCertificate returns the most recent stable checkpoint
+// certificate, which light clients use to verify the chain head.
+func (s *ServerOpenchainREST) GetLatestCheckpointCertificate(rw web.ResponseWriter, req *web.Request) {
+	// Retrieve the certificate from the ledger
+	cert, err := s.server.GetLatestCheckpointCertificate(context.Background(), &google_protobuf.Empty{})
+
+	// Check for error
+	if err != nil {
+		// Failure
+		switch err {
+		case oc.ErrNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(rw, "{\"Error\": \"No stable checkpoint certificate is stored yet.\"}")
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "{\"Error\": \"%s\"}", err)
+		}
+	} else {
+		// Success
+		rw.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(rw)
+		encoder.Encode(cert)
+	}
+}
+
 // GetTransactionByUUID returns a transaction matching the specified UUID
 func (s *ServerOpenchainREST) GetTransactionByUUID(rw web.ResponseWriter, req *web.Request) {
 	// Parse out the transaction UUID
@@ -592,6 +622,59 @@ func (s *ServerOpenchainREST) GetTransactionByUUID(rw web.ResponseWriter, req *w
 	}
 }
 
+// GetTransactionResult returns the outcome of the transaction matching the
+// specified UUID, including why it was rejected or failed to execute
+func (s *ServerOpenchainREST) GetTransactionResult(rw web.ResponseWriter, req *web.Request) {
+	// Parse out the transaction UUID
+	txUUID := req.PathParams["uuid"]
+
+	// Retrieve the result of the transaction matching the UUID
+	result, err := s.server.GetTransactionResult(context.Background(), txUUID)
+
+	// Check for Error
+	if err != nil {
+		switch err {
+		case oc.ErrNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(rw, "{\"Error\": \"No result of transaction %s is found.\"}", txUUID)
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "{\"Error\": \"Error retrieving result of transaction %s: %s.\"}", txUUID, err)
+			restLogger.Error(fmt.Sprintf("{\"Error\": \"Error retrieving result of transaction %s: %s.\"}", txUUID, err))
+		}
+	} else {
+		rw.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(rw)
+		encoder.Encode(result)
+	}
+}
+
+// GetTransactionReplies returns the f+1 matching replies of validators which
+// confirmed the outcome of a transaction this peer forwarded
+func (s *ServerOpenchainREST) GetTransactionReplies(rw web.ResponseWriter, req *web.Request) {
+	// Parse out the transaction UUID
+	txUUID := req.PathParams["uuid"]
+
+	// Retrieve the reply certificate of the transaction matching the UUID
+	cert, err := s.server.GetTransactionReplies(context.Background(), txUUID)
+
+	// Check for Error
+	if err != nil {
+		switch err {
+		case oc.ErrNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(rw, "{\"Error\": \"No replies confirming transaction %s are found.\"}", txUUID)
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(rw, "{\"Error\": \"Error retrieving replies to transaction %s: %s.\"}", txUUID, err)
+		}
+	} else {
+		rw.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(rw)
+		encoder.Encode(cert)
+	}
+}
+
 // Deploy first builds the chaincode package and subsequently deploys it to the
 // blockchain.
 func (s *ServerOpenchainREST) Deploy(rw web.ResponseWriter, req *web.Request) {
@@ -1031,6 +1114,46 @@ func (s *ServerOpenchainREST) GetPeers(rw web.ResponseWriter, req *web.Request)
 	}
 }
 
+// GetConsensusStatus returns the internal state of the consensus plugin of
+// the target peer, e.g. the current view and watermarks when running PBFT.
+func (s *ServerOpenchainREST) GetConsensusStatus(rw web.ResponseWriter, req *web.Request) {
+	status, err := s.admin.GetConsensusStatus(context.Background(), &google_protobuf.Empty{})
+
+	encoder := json.NewEncoder(rw)
+
+	// Check for error
+	if err != nil {
+		// Failure
+		rw.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(rw, "{\"Error\": \"%s\"}", err)
+		restLogger.Error(fmt.Sprintf("{\"Error\": \"Querying consensus status -- %s\"}", err))
+	} else {
+		// Success
+		rw.WriteHeader(http.StatusOK)
+		encoder.Encode(status)
+	}
+}
+
+// GetForwardingStatus returns the health of the validators the target
+// non-validating peer forwards transactions to.
+func (s *ServerOpenchainREST) GetForwardingStatus(rw web.ResponseWriter, req *web.Request) {
+	status, err := s.admin.GetForwardingStatus(context.Background(), &google_protobuf.Empty{})
+
+	encoder := json.NewEncoder(rw)
+
+	// Check for error
+	if err != nil {
+		// Failure
+		rw.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(rw, "{\"Error\": \"%s\"}", err)
+		restLogger.Error(fmt.Sprintf("{\"Error\": \"Querying forwarding status -- %s\"}", err))
+	} else {
+		// Success
+		rw.WriteHeader(http.StatusOK)
+		encoder.Encode(status)
+	}
+}
+
 // NotFound returns a custom landing page when a given openchain end point
 // had not been defined.
 func (s *ServerOpenchainREST) NotFound(rw web.ResponseWriter, r *web.Request) {
@@ -1040,14 +1163,15 @@ func (s *ServerOpenchainREST) NotFound(rw web.ResponseWriter, r *web.Request) {
 
 // StartOpenchainRESTServer initializes the REST service and adds the required
 // middleware and routes.
-func StartOpenchainRESTServer(server *oc.ServerOpenchain, devops *oc.Devops) {
+func StartOpenchainRESTServer(server *oc.ServerOpenchain, devops *oc.Devops, admin *oc.ServerAdmin) {
 	// Initialize the REST service object
 	restLogger.Info("Initializing the REST service...")
 	router := web.New(ServerOpenchainREST{})
 
-	// Record the pointer to the underlying ServerOpenchain and Devops objects.
+	// Record the pointer to the underlying ServerOpenchain, Devops and ServerAdmin objects.
 	serverOpenchain = server
 	serverDevops = devops
+	serverAdmin = admin
 
 	// Add middleware
 	router.Middleware((*ServerOpenchainREST).SetOpenchainServer)
@@ -1062,14 +1186,19 @@ func StartOpenchainRESTServer(server *oc.ServerOpenchain, devops *oc.Devops) {
 
 	router.Get("/chain", (*ServerOpenchainREST).GetBlockchainInfo)
 	router.Get("/chain/blocks/:id", (*ServerOpenchainREST).GetBlockByNumber)
+	router.Get("/chain/checkpoint", (*ServerOpenchainREST).GetLatestCheckpointCertificate)
 
 	router.Post("/devops/deploy", (*ServerOpenchainREST).Deploy)
 	router.Post("/devops/invoke", (*ServerOpenchainREST).Invoke)
 	router.Post("/devops/query", (*ServerOpenchainREST).Query)
 
 	router.Get("/transactions/:uuid", (*ServerOpenchainREST).GetTransactionByUUID)
+	router.Get("/transactions/:uuid/result", (*ServerOpenchainREST).GetTransactionResult)
+	router.Get("/transactions/:uuid/replies", (*ServerOpenchainREST).GetTransactionReplies)
 
 	router.Get("/network/peers", (*ServerOpenchainREST).GetPeers)
+	router.Get("/network/consensus", (*ServerOpenchainREST).GetConsensusStatus)
+	router.Get("/network/forwarding", (*ServerOpenchainREST).GetForwardingStatus)
 
 	// Add not found page
 	router.NotFound((*ServerOpenchainREST).NotFound)
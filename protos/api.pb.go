@@ -8,6 +8,7 @@ Package protos is a generated protocol buffer package.
 It is generated from these files:
 	api.proto
 	chaincode.proto
+	consensus.proto
 	devops.proto
 	events.proto
 	openchain.proto
@@ -31,6 +32,34 @@ It has these top-level messages:
 	RangeQueryStateClose
 	RangeQueryStateKeyValue
 	RangeQueryStateResponse
+	ConsensusRecvMsgRequest
+	ConsensusNetworkInfo
+	ConsensusNetworkHandles
+	ConsensusBroadcastRequest
+	ConsensusUnicastRequest
+	ConsensusSignRequest
+	ConsensusSignature
+	ConsensusVerifyRequest
+	ConsensusBatchID
+	ConsensusExecTxsRequest
+	ConsensusRejectTxsRequest
+	ConsensusCommitRequest
+	ConsensusStateHash
+	ConsensusStateDelta
+	ConsensusPutBlockRequest
+	ConsensusRemoteRequest
+	ConsensusStateKey
+	ConsensusStateEntry
+	ConsensusStateSet
+	ConsensusStatus
+	NoopsStatus
+	PbftStatus
+	PbftBatchStatus
+	PbftCheckpointCertificate
+	PbftViewChangeCertificate
+	StateTransferStatus
+	StateTransferPeerErrors
+	StateTransferPeers
 	Secret
 	BuildResult
 	Interest
@@ -41,23 +70,43 @@ It has these top-level messages:
 	TransactionBlock
 	TransactionResult
 	Block
+	BlockHeader
 	BlockchainInfo
+	CheckpointCertificate
+	SignedCheckpoint
 	NonHashData
 	PeerAddress
 	PeerID
 	PeerEndpoint
 	PeersMessage
+	DiscoveredPeer
 	HelloMessage
+	DisconnectMessage
 	OpenchainMessage
+	MessageChunk
 	Response
+	TransactionReplyRequest
+	TransactionReply
+	TransactionReplyCertificate
 	BlockState
 	SyncBlockRange
 	SyncBlocks
 	SyncStateSnapshotRequest
 	SyncStateSnapshot
+	SyncStateChunkRequest
+	SyncStateChunk
 	SyncStateDeltasRequest
 	SyncStateDeltas
+	SyncBlockHeaders
+	TransactionProofRequest
+	CheckpointCertificateRequest
+	SyncCheckpointCertificate
+	TransactionProof
+	SyncCredit
 	ServerStatus
+	ByzantineBehaviors
+	ForwardingStatus
+	ValidatorHealth
 */
 package protos
 
@@ -110,6 +159,9 @@ type OpenchainClient interface {
 	// GetBlockCount returns the current number of blocks in the blockchain data
 	// structure.
 	GetBlockCount(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*BlockCount, error)
+	// GetLatestCheckpointCertificate returns the most recent stable checkpoint
+	// certificate, which light clients use to verify the chain head.
+	GetLatestCheckpointCertificate(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*CheckpointCertificate, error)
 }
 
 type openchainClient struct {
@@ -147,6 +199,15 @@ func (c *openchainClient) GetBlockCount(ctx context.Context, in *google_protobuf
 	return out, nil
 }
 
+func (c *openchainClient) GetLatestCheckpointCertificate(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*CheckpointCertificate, error) {
+	out := new(CheckpointCertificate)
+	err := grpc.Invoke(ctx, "/protos.Openchain/GetLatestCheckpointCertificate", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Openchain service
 
 type OpenchainServer interface {
@@ -159,6 +220,9 @@ type OpenchainServer interface {
 	// GetBlockCount returns the current number of blocks in the blockchain data
 	// structure.
 	GetBlockCount(context.Context, *google_protobuf1.Empty) (*BlockCount, error)
+	// GetLatestCheckpointCertificate returns the most recent stable checkpoint
+	// certificate, which light clients use to verify the chain head.
+	GetLatestCheckpointCertificate(context.Context, *google_protobuf1.Empty) (*CheckpointCertificate, error)
 }
 
 func RegisterOpenchainServer(s *grpc.Server, srv OpenchainServer) {
@@ -201,6 +265,18 @@ func _Openchain_GetBlockCount_Handler(srv interface{}, ctx context.Context, dec
 	return out, nil
 }
 
+func _Openchain_GetLatestCheckpointCertificate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(OpenchainServer).GetLatestCheckpointCertificate(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 var _Openchain_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protos.Openchain",
 	HandlerType: (*OpenchainServer)(nil),
@@ -217,6 +293,10 @@ var _Openchain_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetBlockCount",
 			Handler:    _Openchain_GetBlockCount_Handler,
 		},
+		{
+			MethodName: "GetLatestCheckpointCertificate",
+			Handler:    _Openchain_GetLatestCheckpointCertificate_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{},
 }
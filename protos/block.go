@@ -21,6 +21,7 @@ package protos
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger-incubator/obc-peer/openchain/util"
@@ -53,18 +54,90 @@ func (block *Block) Bytes() ([]byte, error) {
 	return data, nil
 }
 
+// BlockVersion is the version of the blocks created by NewBlock. Blocks of
+// this version are hashed over their header, so that a chain of headers can
+// be verified without the transactions. Blocks of version 0, which the ledger
+// creates before the height the network switches to header hashing at, are
+// hashed over the whole block, so that existing chains stay linked.
+const BlockVersion uint32 = 1
+
 // NewBlock creates a new Block given the input parameters.
 func NewBlock(transactions []*Transaction, metadata []byte) *Block {
 	block := new(Block)
+	block.Version = BlockVersion
 	block.Transactions = transactions
 	block.ConsensusMetadata = metadata
 	return block
 }
 
-// GetHash returns the hash of this block.
+// GetHeader returns the header of this block, which its hash is computed
+// over.
+func (block *Block) GetHeader() (*BlockHeader, error) {
+	root, err := ComputeTransactionsRoot(block.Transactions)
+	if err != nil {
+		return nil, fmt.Errorf("Could not compute the transactions root of block: %s", err)
+	}
+	resultsHash, err := ComputeTransactionResultsHash(block.GetNonHashData().GetTransactionResults())
+	if err != nil {
+		return nil, fmt.Errorf("Could not compute the transaction results hash of block: %s", err)
+	}
+	return &BlockHeader{
+		Version:                block.Version,
+		Timestamp:              block.Timestamp,
+		TransactionsRoot:       root,
+		StateHash:              block.StateHash,
+		PreviousBlockHash:      block.PreviousBlockHash,
+		ConsensusMetadata:      block.ConsensusMetadata,
+		TransactionResultsHash: resultsHash,
+	}, nil
+}
+
+// ComputeTransactionResultsHash returns the hash the header of a block
+// commits to its transaction results with, nil if there are none. Only the
+// uuid and the error code of each result are hashed, in the order of their
+// uuids, as the error string and the order of the results may differ
+// between validators.
+func ComputeTransactionResultsHash(results []*TransactionResult) ([]byte, error) {
+	if len(results) == 0 {
+		return nil, nil
+	}
+	sorted := make([]*TransactionResult, len(results))
+	copy(sorted, results)
+	sort.Sort(resultsByUUID(sorted))
+	var data []byte
+	for _, result := range sorted {
+		resultBytes, err := proto.Marshal(&TransactionResult{Uuid: result.Uuid, ErrorCode: result.ErrorCode})
+		if err != nil {
+			return nil, fmt.Errorf("Could not marshal transaction result: %s", err)
+		}
+		data = append(data, util.ComputeCryptoHash(resultBytes)...)
+	}
+	return util.ComputeCryptoHash(data), nil
+}
+
+type resultsByUUID []*TransactionResult
+
+func (r resultsByUUID) Len() int           { return len(r) }
+func (r resultsByUUID) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r resultsByUUID) Less(i, j int) bool { return r[i].Uuid < r[j].Uuid }
+
+// GetHash returns the hash of this block, which is the hash of its header
+// from BlockVersion on. The non-hash data is left out, but for the uuids
+// and error codes of the transaction results the header commits to.
 func (block *Block) GetHash() ([]byte, error) {
+	if block.Version < BlockVersion {
+		return block.getLegacyHash()
+	}
+	header, err := block.GetHeader()
+	if err != nil {
+		return nil, fmt.Errorf("Could not calculate hash of block: %s", err)
+	}
+	return header.GetHash()
+}
 
-	// copy the block and remove the non-hash data
+// getLegacyHash returns the hash of a block of version 0, which is the hash
+// of the whole block without the non-hash data
+func (block *Block) getLegacyHash() ([]byte, error) {
 	blockBytes, err := block.Bytes()
 	if err != nil {
 		return nil, fmt.Errorf("Could not calculate hash of block: %s", err)
@@ -74,14 +147,24 @@ func (block *Block) GetHash() ([]byte, error) {
 		return nil, fmt.Errorf("Could not calculate hash of block: %s", err)
 	}
 	blockCopy.NonHashData = nil
-
-	// Hash the block
 	data, err := proto.Marshal(blockCopy)
 	if err != nil {
 		return nil, fmt.Errorf("Could not calculate hash of block: %s", err)
 	}
-	hash := util.ComputeCryptoHash(data)
-	return hash, nil
+	return util.ComputeCryptoHash(data), nil
+}
+
+// GetHash returns the hash of this header, which is the hash of its block.
+// The headers of blocks older than BlockVersion have no hash of their own.
+func (header *BlockHeader) GetHash() ([]byte, error) {
+	if header.Version < BlockVersion {
+		return nil, fmt.Errorf("Block of version %d is not hashed over its header", header.Version)
+	}
+	data, err := proto.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("Could not calculate hash of block header: %s", err)
+	}
+	return util.ComputeCryptoHash(data), nil
 }
 
 // GetStateHash returns the stateHash stored in this block. The stateHash
@@ -91,3 +91,40 @@ func TestBlockNonHashData(t *testing.T) {
 		t.Fatalf("Expected time2 and block2 times to be equal, but there were not")
 	}
 }
+
+func TestBlockTransactionResultsHash(t *testing.T) {
+	hash := func(results ...*TransactionResult) []byte {
+		block := NewBlock(nil, nil)
+		block.NonHashData = &NonHashData{TransactionResults: results}
+		h, err := block.GetHash()
+		if err != nil {
+			t.Fatalf("Error generating block hash: %s", err)
+		}
+		return h
+	}
+	failed := &TransactionResult{Uuid: "tx1", ErrorCode: 1, Error: "chaincode failed on vp1"}
+	rejected := &TransactionResult{Uuid: "tx2", ErrorCode: 2, Error: "duplicate transaction"}
+	reference := hash(failed, rejected)
+
+	// The error strings and the order of the results are not committed to
+	if !bytes.Equal(reference, hash(rejected, &TransactionResult{Uuid: "tx1", ErrorCode: 1, Error: "chaincode failed on vp2"})) {
+		t.Fatalf("Expected the block hash not to depend on error strings or the order of the results")
+	}
+
+	// The outcome of each transaction is
+	if bytes.Equal(reference, hash(&TransactionResult{Uuid: "tx1", ErrorCode: 2}, rejected)) {
+		t.Fatalf("Expected the block hash to depend on the error codes")
+	}
+	if bytes.Equal(reference, hash(failed)) {
+		t.Fatalf("Expected the block hash to depend on which transactions have results")
+	}
+
+	// Blocks of version 0 keep their hash over the block without non-hash data
+	legacy := NewBlock(nil, nil)
+	legacy.Version = 0
+	before, _ := legacy.GetHash()
+	legacy.NonHashData = &NonHashData{TransactionResults: []*TransactionResult{failed}}
+	if after, _ := legacy.GetHash(); !bytes.Equal(before, after) {
+		t.Fatalf("Expected the hash of a block of version 0 not to depend on its results")
+	}
+}
@@ -0,0 +1,1603 @@
+// Code generated by protoc-gen-go.
+// source: consensus.proto
+// DO NOT EDIT!
+
+package protos
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import google_protobuf1 "google/protobuf"
+import google_protobuf "google/protobuf"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type StateTransferStatus_Phase int32
+
+const (
+	StateTransferStatus_IDLE               StateTransferStatus_Phase = 0
+	StateTransferStatus_WAITING_FOR_TARGET StateTransferStatus_Phase = 1
+	StateTransferStatus_SYNCING_BLOCKS     StateTransferStatus_Phase = 2
+	StateTransferStatus_SYNCING_STATE      StateTransferStatus_Phase = 3
+	StateTransferStatus_PLAYING_DELTAS     StateTransferStatus_Phase = 4
+)
+
+var StateTransferStatus_Phase_name = map[int32]string{
+	0: "IDLE",
+	1: "WAITING_FOR_TARGET",
+	2: "SYNCING_BLOCKS",
+	3: "SYNCING_STATE",
+	4: "PLAYING_DELTAS",
+}
+var StateTransferStatus_Phase_value = map[string]int32{
+	"IDLE":               0,
+	"WAITING_FOR_TARGET": 1,
+	"SYNCING_BLOCKS":     2,
+	"SYNCING_STATE":      3,
+	"PLAYING_DELTAS":     4,
+}
+
+func (x StateTransferStatus_Phase) String() string {
+	return proto.EnumName(StateTransferStatus_Phase_name, int32(x))
+}
+
+type ConsensusRecvMsgRequest struct {
+	Msg          *OpenchainMessage `protobuf:"bytes,1,opt,name=msg" json:"msg,omitempty"`
+	SenderHandle *PeerID           `protobuf:"bytes,2,opt,name=senderHandle" json:"senderHandle,omitempty"`
+}
+
+func (m *ConsensusRecvMsgRequest) Reset()         { *m = ConsensusRecvMsgRequest{} }
+func (m *ConsensusRecvMsgRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsensusRecvMsgRequest) ProtoMessage()    {}
+
+func (m *ConsensusRecvMsgRequest) GetMsg() *OpenchainMessage {
+	if m != nil {
+		return m.Msg
+	}
+	return nil
+}
+
+func (m *ConsensusRecvMsgRequest) GetSenderHandle() *PeerID {
+	if m != nil {
+		return m.SenderHandle
+	}
+	return nil
+}
+
+type ConsensusNetworkInfo struct {
+	Self    *PeerEndpoint   `protobuf:"bytes,1,opt,name=self" json:"self,omitempty"`
+	Network []*PeerEndpoint `protobuf:"bytes,2,rep,name=network" json:"network,omitempty"`
+}
+
+func (m *ConsensusNetworkInfo) Reset()         { *m = ConsensusNetworkInfo{} }
+func (m *ConsensusNetworkInfo) String() string { return proto.CompactTextString(m) }
+func (*ConsensusNetworkInfo) ProtoMessage()    {}
+
+func (m *ConsensusNetworkInfo) GetSelf() *PeerEndpoint {
+	if m != nil {
+		return m.Self
+	}
+	return nil
+}
+
+func (m *ConsensusNetworkInfo) GetNetwork() []*PeerEndpoint {
+	if m != nil {
+		return m.Network
+	}
+	return nil
+}
+
+type ConsensusNetworkHandles struct {
+	Self    *PeerID   `protobuf:"bytes,1,opt,name=self" json:"self,omitempty"`
+	Network []*PeerID `protobuf:"bytes,2,rep,name=network" json:"network,omitempty"`
+}
+
+func (m *ConsensusNetworkHandles) Reset()         { *m = ConsensusNetworkHandles{} }
+func (m *ConsensusNetworkHandles) String() string { return proto.CompactTextString(m) }
+func (*ConsensusNetworkHandles) ProtoMessage()    {}
+
+func (m *ConsensusNetworkHandles) GetSelf() *PeerID {
+	if m != nil {
+		return m.Self
+	}
+	return nil
+}
+
+func (m *ConsensusNetworkHandles) GetNetwork() []*PeerID {
+	if m != nil {
+		return m.Network
+	}
+	return nil
+}
+
+type ConsensusBroadcastRequest struct {
+	Msg      *OpenchainMessage `protobuf:"bytes,1,opt,name=msg" json:"msg,omitempty"`
+	PeerType PeerEndpoint_Type `protobuf:"varint,2,opt,name=peerType,enum=protos.PeerEndpoint_Type" json:"peerType,omitempty"`
+}
+
+func (m *ConsensusBroadcastRequest) Reset()         { *m = ConsensusBroadcastRequest{} }
+func (m *ConsensusBroadcastRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsensusBroadcastRequest) ProtoMessage()    {}
+
+func (m *ConsensusBroadcastRequest) GetMsg() *OpenchainMessage {
+	if m != nil {
+		return m.Msg
+	}
+	return nil
+}
+
+type ConsensusUnicastRequest struct {
+	Msg            *OpenchainMessage `protobuf:"bytes,1,opt,name=msg" json:"msg,omitempty"`
+	ReceiverHandle *PeerID           `protobuf:"bytes,2,opt,name=receiverHandle" json:"receiverHandle,omitempty"`
+}
+
+func (m *ConsensusUnicastRequest) Reset()         { *m = ConsensusUnicastRequest{} }
+func (m *ConsensusUnicastRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsensusUnicastRequest) ProtoMessage()    {}
+
+func (m *ConsensusUnicastRequest) GetMsg() *OpenchainMessage {
+	if m != nil {
+		return m.Msg
+	}
+	return nil
+}
+
+func (m *ConsensusUnicastRequest) GetReceiverHandle() *PeerID {
+	if m != nil {
+		return m.ReceiverHandle
+	}
+	return nil
+}
+
+type ConsensusSignRequest struct {
+	Msg []byte `protobuf:"bytes,1,opt,name=msg,proto3" json:"msg,omitempty"`
+}
+
+func (m *ConsensusSignRequest) Reset()         { *m = ConsensusSignRequest{} }
+func (m *ConsensusSignRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsensusSignRequest) ProtoMessage()    {}
+
+type ConsensusSignature struct {
+	Signature []byte `protobuf:"bytes,1,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *ConsensusSignature) Reset()         { *m = ConsensusSignature{} }
+func (m *ConsensusSignature) String() string { return proto.CompactTextString(m) }
+func (*ConsensusSignature) ProtoMessage()    {}
+
+type ConsensusVerifyRequest struct {
+	PeerID    *PeerID `protobuf:"bytes,1,opt,name=peerID" json:"peerID,omitempty"`
+	Signature []byte  `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+	Message   []byte  `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (m *ConsensusVerifyRequest) Reset()         { *m = ConsensusVerifyRequest{} }
+func (m *ConsensusVerifyRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsensusVerifyRequest) ProtoMessage()    {}
+
+func (m *ConsensusVerifyRequest) GetPeerID() *PeerID {
+	if m != nil {
+		return m.PeerID
+	}
+	return nil
+}
+
+type ConsensusBatchID struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *ConsensusBatchID) Reset()         { *m = ConsensusBatchID{} }
+func (m *ConsensusBatchID) String() string { return proto.CompactTextString(m) }
+func (*ConsensusBatchID) ProtoMessage()    {}
+
+type ConsensusExecTxsRequest struct {
+	Id           string         `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Transactions []*Transaction `protobuf:"bytes,2,rep,name=transactions" json:"transactions,omitempty"`
+}
+
+func (m *ConsensusExecTxsRequest) Reset()         { *m = ConsensusExecTxsRequest{} }
+func (m *ConsensusExecTxsRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsensusExecTxsRequest) ProtoMessage()    {}
+
+func (m *ConsensusExecTxsRequest) GetTransactions() []*Transaction {
+	if m != nil {
+		return m.Transactions
+	}
+	return nil
+}
+
+type ConsensusRejectTxsRequest struct {
+	Id      string               `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Results []*TransactionResult `protobuf:"bytes,2,rep,name=results" json:"results,omitempty"`
+}
+
+func (m *ConsensusRejectTxsRequest) Reset()         { *m = ConsensusRejectTxsRequest{} }
+func (m *ConsensusRejectTxsRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsensusRejectTxsRequest) ProtoMessage()    {}
+
+func (m *ConsensusRejectTxsRequest) GetResults() []*TransactionResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
+type ConsensusCommitRequest struct {
+	Id       string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Metadata []byte `protobuf:"bytes,2,opt,name=metadata,proto3" json:"metadata,omitempty"`
+}
+
+func (m *ConsensusCommitRequest) Reset()         { *m = ConsensusCommitRequest{} }
+func (m *ConsensusCommitRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsensusCommitRequest) ProtoMessage()    {}
+
+type ConsensusStateHash struct {
+	Hash []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+}
+
+func (m *ConsensusStateHash) Reset()         { *m = ConsensusStateHash{} }
+func (m *ConsensusStateHash) String() string { return proto.CompactTextString(m) }
+func (*ConsensusStateHash) ProtoMessage()    {}
+
+// ConsensusStateDelta carries a marshalled statemgmt.StateDelta. The id is
+// only set when applying a delta to the ledger.
+type ConsensusStateDelta struct {
+	Id    string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Delta []byte `protobuf:"bytes,2,opt,name=delta,proto3" json:"delta,omitempty"`
+}
+
+func (m *ConsensusStateDelta) Reset()         { *m = ConsensusStateDelta{} }
+func (m *ConsensusStateDelta) String() string { return proto.CompactTextString(m) }
+func (*ConsensusStateDelta) ProtoMessage()    {}
+
+type ConsensusPutBlockRequest struct {
+	BlockNumber uint64 `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Block       *Block `protobuf:"bytes,2,opt,name=block" json:"block,omitempty"`
+}
+
+func (m *ConsensusPutBlockRequest) Reset()         { *m = ConsensusPutBlockRequest{} }
+func (m *ConsensusPutBlockRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsensusPutBlockRequest) ProtoMessage()    {}
+
+func (m *ConsensusPutBlockRequest) GetBlock() *Block {
+	if m != nil {
+		return m.Block
+	}
+	return nil
+}
+
+// ConsensusRemoteRequest identifies the replica to stream from. The range is
+// ignored when requesting a state snapshot.
+type ConsensusRemoteRequest struct {
+	ReplicaID *PeerID         `protobuf:"bytes,1,opt,name=replicaID" json:"replicaID,omitempty"`
+	Range     *SyncBlockRange `protobuf:"bytes,2,opt,name=range" json:"range,omitempty"`
+}
+
+func (m *ConsensusRemoteRequest) Reset()         { *m = ConsensusRemoteRequest{} }
+func (m *ConsensusRemoteRequest) String() string { return proto.CompactTextString(m) }
+func (*ConsensusRemoteRequest) ProtoMessage()    {}
+
+func (m *ConsensusRemoteRequest) GetReplicaID() *PeerID {
+	if m != nil {
+		return m.ReplicaID
+	}
+	return nil
+}
+
+func (m *ConsensusRemoteRequest) GetRange() *SyncBlockRange {
+	if m != nil {
+		return m.Range
+	}
+	return nil
+}
+
+// ConsensusStateKey names consenter state in the local DB of the peer, or
+// the prefix of the keys to read with ReadStateSet
+type ConsensusStateKey struct {
+	Key string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+}
+
+func (m *ConsensusStateKey) Reset()         { *m = ConsensusStateKey{} }
+func (m *ConsensusStateKey) String() string { return proto.CompactTextString(m) }
+func (*ConsensusStateKey) ProtoMessage()    {}
+
+// ConsensusStateEntry is a key,value pair of consenter state. ReadState
+// leaves the value empty if the key is not present.
+type ConsensusStateEntry struct {
+	Key   string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Value []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *ConsensusStateEntry) Reset()         { *m = ConsensusStateEntry{} }
+func (m *ConsensusStateEntry) String() string { return proto.CompactTextString(m) }
+func (*ConsensusStateEntry) ProtoMessage()    {}
+
+type ConsensusStateSet struct {
+	Entries []*ConsensusStateEntry `protobuf:"bytes,1,rep,name=entries" json:"entries,omitempty"`
+}
+
+func (m *ConsensusStateSet) Reset()         { *m = ConsensusStateSet{} }
+func (m *ConsensusStateSet) String() string { return proto.CompactTextString(m) }
+func (*ConsensusStateSet) ProtoMessage()    {}
+
+func (m *ConsensusStateSet) GetEntries() []*ConsensusStateEntry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+// ConsensusStatus is a snapshot of the internal state of a consensus plugin,
+// used to diagnose stalled networks. Plugin specific details are only set
+// for the plugin in use.
+type ConsensusStatus struct {
+	Plugin string       `protobuf:"bytes,1,opt,name=plugin" json:"plugin,omitempty"`
+	Pbft   *PbftStatus  `protobuf:"bytes,2,opt,name=pbft" json:"pbft,omitempty"`
+	Noops  *NoopsStatus `protobuf:"bytes,3,opt,name=noops" json:"noops,omitempty"`
+}
+
+func (m *ConsensusStatus) Reset()         { *m = ConsensusStatus{} }
+func (m *ConsensusStatus) String() string { return proto.CompactTextString(m) }
+func (*ConsensusStatus) ProtoMessage()    {}
+
+func (m *ConsensusStatus) GetPbft() *PbftStatus {
+	if m != nil {
+		return m.Pbft
+	}
+	return nil
+}
+
+func (m *ConsensusStatus) GetNoops() *NoopsStatus {
+	if m != nil {
+		return m.Noops
+	}
+	return nil
+}
+
+type NoopsStatus struct {
+	PendingTransactions  uint64 `protobuf:"varint,1,opt,name=pendingTransactions" json:"pendingTransactions,omitempty"`
+	PendingBytes         uint64 `protobuf:"varint,2,opt,name=pendingBytes" json:"pendingBytes,omitempty"`
+	RejectedTransactions uint64 `protobuf:"varint,3,opt,name=rejectedTransactions" json:"rejectedTransactions,omitempty"`
+}
+
+func (m *NoopsStatus) Reset()         { *m = NoopsStatus{} }
+func (m *NoopsStatus) String() string { return proto.CompactTextString(m) }
+func (*NoopsStatus) ProtoMessage()    {}
+
+type PbftStatus struct {
+	Mode                string                       `protobuf:"bytes,1,opt,name=mode" json:"mode,omitempty"`
+	ReplicaID           uint64                       `protobuf:"varint,2,opt,name=replicaID" json:"replicaID,omitempty"`
+	N                   uint64                       `protobuf:"varint,3,opt,name=N" json:"N,omitempty"`
+	F                   uint64                       `protobuf:"varint,4,opt,name=f" json:"f,omitempty"`
+	View                uint64                       `protobuf:"varint,5,opt,name=view" json:"view,omitempty"`
+	Primary             uint64                       `protobuf:"varint,6,opt,name=primary" json:"primary,omitempty"`
+	ActiveView          bool                         `protobuf:"varint,7,opt,name=activeView" json:"activeView,omitempty"`
+	SeqNo               uint64                       `protobuf:"varint,8,opt,name=seqNo" json:"seqNo,omitempty"`
+	LowWatermark        uint64                       `protobuf:"varint,9,opt,name=lowWatermark" json:"lowWatermark,omitempty"`
+	HighWatermark       uint64                       `protobuf:"varint,10,opt,name=highWatermark" json:"highWatermark,omitempty"`
+	LastExec            uint64                       `protobuf:"varint,11,opt,name=lastExec" json:"lastExec,omitempty"`
+	OutstandingRequests uint64                       `protobuf:"varint,12,opt,name=outstandingRequests" json:"outstandingRequests,omitempty"`
+	Checkpoints         []*PbftCheckpointCertificate `protobuf:"bytes,13,rep,name=checkpoints" json:"checkpoints,omitempty"`
+	ViewChanges         []*PbftViewChangeCertificate `protobuf:"bytes,14,rep,name=viewChanges" json:"viewChanges,omitempty"`
+	NewViewTimerActive  bool                         `protobuf:"varint,15,opt,name=newViewTimerActive" json:"newViewTimerActive,omitempty"`
+	Byzantine           []string                     `protobuf:"bytes,16,rep,name=byzantine" json:"byzantine,omitempty"`
+	Batch               *PbftBatchStatus             `protobuf:"bytes,17,opt,name=batch" json:"batch,omitempty"`
+	LastCommitted       uint64                       `protobuf:"varint,18,opt,name=lastCommitted" json:"lastCommitted,omitempty"`
+}
+
+func (m *PbftStatus) Reset()         { *m = PbftStatus{} }
+func (m *PbftStatus) String() string { return proto.CompactTextString(m) }
+func (*PbftStatus) ProtoMessage()    {}
+
+func (m *PbftStatus) GetCheckpoints() []*PbftCheckpointCertificate {
+	if m != nil {
+		return m.Checkpoints
+	}
+	return nil
+}
+
+func (m *PbftStatus) GetViewChanges() []*PbftViewChangeCertificate {
+	if m != nil {
+		return m.ViewChanges
+	}
+	return nil
+}
+
+func (m *PbftStatus) GetBatch() *PbftBatchStatus {
+	if m != nil {
+		return m.Batch
+	}
+	return nil
+}
+
+// PbftBatchStatus reports the requests the primary collected for the next
+// batch in "batch" mode, the observed time between requests, and how many
+// batches were sent for each reason.
+type PbftBatchStatus struct {
+	PendingRequests   uint64 `protobuf:"varint,1,opt,name=pendingRequests" json:"pendingRequests,omitempty"`
+	PendingBytes      uint64 `protobuf:"varint,2,opt,name=pendingBytes" json:"pendingBytes,omitempty"`
+	InterArrivalNanos uint64 `protobuf:"varint,3,opt,name=interArrivalNanos" json:"interArrivalNanos,omitempty"`
+	SizeCuts          uint64 `protobuf:"varint,4,opt,name=sizeCuts" json:"sizeCuts,omitempty"`
+	ByteCuts          uint64 `protobuf:"varint,5,opt,name=byteCuts" json:"byteCuts,omitempty"`
+	TimeoutCuts       uint64 `protobuf:"varint,6,opt,name=timeoutCuts" json:"timeoutCuts,omitempty"`
+	RateCuts          uint64 `protobuf:"varint,7,opt,name=rateCuts" json:"rateCuts,omitempty"`
+}
+
+func (m *PbftBatchStatus) Reset()         { *m = PbftBatchStatus{} }
+func (m *PbftBatchStatus) String() string { return proto.CompactTextString(m) }
+func (*PbftBatchStatus) ProtoMessage()    {}
+
+// PbftCheckpointCertificate lists the replicas which sent a matching
+// checkpoint message.
+type PbftCheckpointCertificate struct {
+	SequenceNumber uint64   `protobuf:"varint,1,opt,name=sequenceNumber" json:"sequenceNumber,omitempty"`
+	BlockNumber    uint64   `protobuf:"varint,2,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	BlockHash      string   `protobuf:"bytes,3,opt,name=blockHash" json:"blockHash,omitempty"`
+	Replicas       []uint64 `protobuf:"varint,4,rep,name=replicas" json:"replicas,omitempty"`
+}
+
+func (m *PbftCheckpointCertificate) Reset()         { *m = PbftCheckpointCertificate{} }
+func (m *PbftCheckpointCertificate) String() string { return proto.CompactTextString(m) }
+func (*PbftCheckpointCertificate) ProtoMessage()    {}
+
+// PbftViewChangeCertificate lists the replicas which sent a view-change
+// message for a view, and whether a new-view was sent or received for it.
+type PbftViewChangeCertificate struct {
+	View     uint64   `protobuf:"varint,1,opt,name=view" json:"view,omitempty"`
+	Replicas []uint64 `protobuf:"varint,2,rep,name=replicas" json:"replicas,omitempty"`
+	NewView  bool     `protobuf:"varint,3,opt,name=newView" json:"newView,omitempty"`
+}
+
+func (m *PbftViewChangeCertificate) Reset()         { *m = PbftViewChangeCertificate{} }
+func (m *PbftViewChangeCertificate) String() string { return proto.CompactTextString(m) }
+func (*PbftViewChangeCertificate) ProtoMessage()    {}
+
+// StateTransferStatus reports how the state transfer of a validating peer
+// progresses. Counters cover the current transfer only. The remaining time
+// is estimated from the rate at which blocks, state chunks and state deltas
+// were retrieved so far, and is zero when unknown.
+type StateTransferStatus struct {
+	Phase                   StateTransferStatus_Phase  `protobuf:"varint,1,opt,name=phase,enum=protos.StateTransferStatus_Phase" json:"phase,omitempty"`
+	Paused                  bool                       `protobuf:"varint,2,opt,name=paused" json:"paused,omitempty"`
+	TargetBlock             uint64                     `protobuf:"varint,3,opt,name=targetBlock" json:"targetBlock,omitempty"`
+	BlocksFetched           uint64                     `protobuf:"varint,4,opt,name=blocksFetched" json:"blocksFetched,omitempty"`
+	BlocksToFetch           uint64                     `protobuf:"varint,5,opt,name=blocksToFetch" json:"blocksToFetch,omitempty"`
+	StateChunksApplied      uint64                     `protobuf:"varint,6,opt,name=stateChunksApplied" json:"stateChunksApplied,omitempty"`
+	StateChunks             uint64                     `protobuf:"varint,7,opt,name=stateChunks" json:"stateChunks,omitempty"`
+	DeltasApplied           uint64                     `protobuf:"varint,8,opt,name=deltasApplied" json:"deltasApplied,omitempty"`
+	DeltasToApply           uint64                     `protobuf:"varint,9,opt,name=deltasToApply" json:"deltasToApply,omitempty"`
+	StateBytesApplied       uint64                     `protobuf:"varint,10,opt,name=stateBytesApplied" json:"stateBytesApplied,omitempty"`
+	SourcePeer              *PeerID                    `protobuf:"bytes,11,opt,name=sourcePeer" json:"sourcePeer,omitempty"`
+	PeerErrors              []*StateTransferPeerErrors `protobuf:"bytes,12,rep,name=peerErrors" json:"peerErrors,omitempty"`
+	PinnedPeers             []*PeerID                  `protobuf:"bytes,13,rep,name=pinnedPeers" json:"pinnedPeers,omitempty"`
+	Started                 *google_protobuf.Timestamp `protobuf:"bytes,14,opt,name=started" json:"started,omitempty"`
+	EstimatedRemainingNanos uint64                     `protobuf:"varint,15,opt,name=estimatedRemainingNanos" json:"estimatedRemainingNanos,omitempty"`
+}
+
+func (m *StateTransferStatus) Reset()         { *m = StateTransferStatus{} }
+func (m *StateTransferStatus) String() string { return proto.CompactTextString(m) }
+func (*StateTransferStatus) ProtoMessage()    {}
+
+func (m *StateTransferStatus) GetSourcePeer() *PeerID {
+	if m != nil {
+		return m.SourcePeer
+	}
+	return nil
+}
+
+func (m *StateTransferStatus) GetPeerErrors() []*StateTransferPeerErrors {
+	if m != nil {
+		return m.PeerErrors
+	}
+	return nil
+}
+
+func (m *StateTransferStatus) GetPinnedPeers() []*PeerID {
+	if m != nil {
+		return m.PinnedPeers
+	}
+	return nil
+}
+
+func (m *StateTransferStatus) GetStarted() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Started
+	}
+	return nil
+}
+
+type StateTransferPeerErrors struct {
+	Peer      *PeerID `protobuf:"bytes,1,opt,name=peer" json:"peer,omitempty"`
+	Errors    uint64  `protobuf:"varint,2,opt,name=errors" json:"errors,omitempty"`
+	LastError string  `protobuf:"bytes,3,opt,name=lastError" json:"lastError,omitempty"`
+}
+
+func (m *StateTransferPeerErrors) Reset()         { *m = StateTransferPeerErrors{} }
+func (m *StateTransferPeerErrors) String() string { return proto.CompactTextString(m) }
+func (*StateTransferPeerErrors) ProtoMessage()    {}
+
+func (m *StateTransferPeerErrors) GetPeer() *PeerID {
+	if m != nil {
+		return m.Peer
+	}
+	return nil
+}
+
+// StateTransferPeers restricts state transfer to the given peers, an empty
+// list lets it use any peer again.
+type StateTransferPeers struct {
+	Peers []*PeerID `protobuf:"bytes,1,rep,name=peers" json:"peers,omitempty"`
+}
+
+func (m *StateTransferPeers) Reset()         { *m = StateTransferPeers{} }
+func (m *StateTransferPeers) String() string { return proto.CompactTextString(m) }
+func (*StateTransferPeers) ProtoMessage()    {}
+
+func (m *StateTransferPeers) GetPeers() []*PeerID {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("protos.StateTransferStatus_Phase", StateTransferStatus_Phase_name, StateTransferStatus_Phase_value)
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Client API for ExternalConsenter service
+
+type ExternalConsenterClient interface {
+	// RecvMsg hands a CHAIN_TRANSACTION or CONSENSUS message to the plugin.
+	RecvMsg(ctx context.Context, in *ConsensusRecvMsgRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	// GetStatus reports the internal state of the plugin.
+	GetStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusStatus, error)
+}
+
+type externalConsenterClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewExternalConsenterClient(cc *grpc.ClientConn) ExternalConsenterClient {
+	return &externalConsenterClient{cc}
+}
+
+func (c *externalConsenterClient) RecvMsg(ctx context.Context, in *ConsensusRecvMsgRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ExternalConsenter/RecvMsg", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *externalConsenterClient) GetStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusStatus, error) {
+	out := new(ConsensusStatus)
+	err := grpc.Invoke(ctx, "/protos.ExternalConsenter/GetStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for ExternalConsenter service
+
+type ExternalConsenterServer interface {
+	// RecvMsg hands a CHAIN_TRANSACTION or CONSENSUS message to the plugin.
+	RecvMsg(context.Context, *ConsensusRecvMsgRequest) (*google_protobuf1.Empty, error)
+	// GetStatus reports the internal state of the plugin.
+	GetStatus(context.Context, *google_protobuf1.Empty) (*ConsensusStatus, error)
+}
+
+func RegisterExternalConsenterServer(s *grpc.Server, srv ExternalConsenterServer) {
+	s.RegisterService(&_ExternalConsenter_serviceDesc, srv)
+}
+
+func _ExternalConsenter_RecvMsg_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusRecvMsgRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ExternalConsenterServer).RecvMsg(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ExternalConsenter_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ExternalConsenterServer).GetStatus(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _ExternalConsenter_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "protos.ExternalConsenter",
+	HandlerType: (*ExternalConsenterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RecvMsg",
+			Handler:    _ExternalConsenter_RecvMsg_Handler,
+		},
+		{
+			MethodName: "GetStatus",
+			Handler:    _ExternalConsenter_GetStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// Client API for ConsensusStack service
+
+type ConsensusStackClient interface {
+	// Inquirer
+	GetNetworkInfo(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusNetworkInfo, error)
+	GetNetworkHandles(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusNetworkHandles, error)
+	// Communicator
+	Broadcast(ctx context.Context, in *ConsensusBroadcastRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	Unicast(ctx context.Context, in *ConsensusUnicastRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	// SecurityUtils
+	Sign(ctx context.Context, in *ConsensusSignRequest, opts ...grpc.CallOption) (*ConsensusSignature, error)
+	Verify(ctx context.Context, in *ConsensusVerifyRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	// Executor
+	BeginTxBatch(ctx context.Context, in *ConsensusBatchID, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	ExecTxs(ctx context.Context, in *ConsensusExecTxsRequest, opts ...grpc.CallOption) (*ConsensusStateHash, error)
+	RejectTxs(ctx context.Context, in *ConsensusRejectTxsRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	CommitTxBatch(ctx context.Context, in *ConsensusCommitRequest, opts ...grpc.CallOption) (*Block, error)
+	RollbackTxBatch(ctx context.Context, in *ConsensusBatchID, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	PreviewCommitTxBatch(ctx context.Context, in *ConsensusCommitRequest, opts ...grpc.CallOption) (*Block, error)
+	// ReadOnlyLedger
+	GetBlock(ctx context.Context, in *BlockNumber, opts ...grpc.CallOption) (*Block, error)
+	GetCurrentStateHash(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusStateHash, error)
+	GetBlockchainSize(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*BlockCount, error)
+	GetStateDelta(ctx context.Context, in *BlockNumber, opts ...grpc.CallOption) (*ConsensusStateDelta, error)
+	// UtilLedger
+	HashBlock(ctx context.Context, in *Block, opts ...grpc.CallOption) (*ConsensusStateHash, error)
+	VerifyBlockchain(ctx context.Context, in *SyncBlockRange, opts ...grpc.CallOption) (*BlockNumber, error)
+	// WritableLedger
+	PutBlock(ctx context.Context, in *ConsensusPutBlockRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	ApplyStateDelta(ctx context.Context, in *ConsensusStateDelta, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	CommitStateDelta(ctx context.Context, in *ConsensusBatchID, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	RollbackStateDelta(ctx context.Context, in *ConsensusBatchID, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	EmptyState(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	// RemoteLedgers
+	GetRemoteBlocks(ctx context.Context, in *ConsensusRemoteRequest, opts ...grpc.CallOption) (ConsensusStack_GetRemoteBlocksClient, error)
+	GetRemoteStateSnapshot(ctx context.Context, in *ConsensusRemoteRequest, opts ...grpc.CallOption) (ConsensusStack_GetRemoteStateSnapshotClient, error)
+	GetRemoteStateDeltas(ctx context.Context, in *ConsensusRemoteRequest, opts ...grpc.CallOption) (ConsensusStack_GetRemoteStateDeltasClient, error)
+	// StatePersistor
+	StoreState(ctx context.Context, in *ConsensusStateEntry, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+	ReadState(ctx context.Context, in *ConsensusStateKey, opts ...grpc.CallOption) (*ConsensusStateEntry, error)
+	ReadStateSet(ctx context.Context, in *ConsensusStateKey, opts ...grpc.CallOption) (*ConsensusStateSet, error)
+	DelState(ctx context.Context, in *ConsensusStateKey, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
+}
+
+type consensusStackClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewConsensusStackClient(cc *grpc.ClientConn) ConsensusStackClient {
+	return &consensusStackClient{cc}
+}
+
+func (c *consensusStackClient) GetNetworkInfo(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusNetworkInfo, error) {
+	out := new(ConsensusNetworkInfo)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/GetNetworkInfo", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) GetNetworkHandles(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusNetworkHandles, error) {
+	out := new(ConsensusNetworkHandles)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/GetNetworkHandles", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) Broadcast(ctx context.Context, in *ConsensusBroadcastRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/Broadcast", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) Unicast(ctx context.Context, in *ConsensusUnicastRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/Unicast", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) Sign(ctx context.Context, in *ConsensusSignRequest, opts ...grpc.CallOption) (*ConsensusSignature, error) {
+	out := new(ConsensusSignature)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/Sign", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) Verify(ctx context.Context, in *ConsensusVerifyRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/Verify", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) BeginTxBatch(ctx context.Context, in *ConsensusBatchID, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/BeginTxBatch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) ExecTxs(ctx context.Context, in *ConsensusExecTxsRequest, opts ...grpc.CallOption) (*ConsensusStateHash, error) {
+	out := new(ConsensusStateHash)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/ExecTxs", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) RejectTxs(ctx context.Context, in *ConsensusRejectTxsRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/RejectTxs", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) CommitTxBatch(ctx context.Context, in *ConsensusCommitRequest, opts ...grpc.CallOption) (*Block, error) {
+	out := new(Block)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/CommitTxBatch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) RollbackTxBatch(ctx context.Context, in *ConsensusBatchID, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/RollbackTxBatch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) PreviewCommitTxBatch(ctx context.Context, in *ConsensusCommitRequest, opts ...grpc.CallOption) (*Block, error) {
+	out := new(Block)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/PreviewCommitTxBatch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) GetBlock(ctx context.Context, in *BlockNumber, opts ...grpc.CallOption) (*Block, error) {
+	out := new(Block)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/GetBlock", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) GetCurrentStateHash(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusStateHash, error) {
+	out := new(ConsensusStateHash)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/GetCurrentStateHash", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) GetBlockchainSize(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*BlockCount, error) {
+	out := new(BlockCount)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/GetBlockchainSize", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) GetStateDelta(ctx context.Context, in *BlockNumber, opts ...grpc.CallOption) (*ConsensusStateDelta, error) {
+	out := new(ConsensusStateDelta)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/GetStateDelta", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) HashBlock(ctx context.Context, in *Block, opts ...grpc.CallOption) (*ConsensusStateHash, error) {
+	out := new(ConsensusStateHash)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/HashBlock", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) VerifyBlockchain(ctx context.Context, in *SyncBlockRange, opts ...grpc.CallOption) (*BlockNumber, error) {
+	out := new(BlockNumber)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/VerifyBlockchain", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) PutBlock(ctx context.Context, in *ConsensusPutBlockRequest, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/PutBlock", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) ApplyStateDelta(ctx context.Context, in *ConsensusStateDelta, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/ApplyStateDelta", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) CommitStateDelta(ctx context.Context, in *ConsensusBatchID, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/CommitStateDelta", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) RollbackStateDelta(ctx context.Context, in *ConsensusBatchID, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/RollbackStateDelta", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) EmptyState(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/EmptyState", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) GetRemoteBlocks(ctx context.Context, in *ConsensusRemoteRequest, opts ...grpc.CallOption) (ConsensusStack_GetRemoteBlocksClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_ConsensusStack_serviceDesc.Streams[0], c.cc, "/protos.ConsensusStack/GetRemoteBlocks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &consensusStackGetRemoteBlocksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ConsensusStack_GetRemoteBlocksClient interface {
+	Recv() (*SyncBlocks, error)
+	grpc.ClientStream
+}
+
+type consensusStackGetRemoteBlocksClient struct {
+	grpc.ClientStream
+}
+
+func (x *consensusStackGetRemoteBlocksClient) Recv() (*SyncBlocks, error) {
+	m := new(SyncBlocks)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *consensusStackClient) GetRemoteStateSnapshot(ctx context.Context, in *ConsensusRemoteRequest, opts ...grpc.CallOption) (ConsensusStack_GetRemoteStateSnapshotClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_ConsensusStack_serviceDesc.Streams[1], c.cc, "/protos.ConsensusStack/GetRemoteStateSnapshot", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &consensusStackGetRemoteStateSnapshotClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ConsensusStack_GetRemoteStateSnapshotClient interface {
+	Recv() (*SyncStateSnapshot, error)
+	grpc.ClientStream
+}
+
+type consensusStackGetRemoteStateSnapshotClient struct {
+	grpc.ClientStream
+}
+
+func (x *consensusStackGetRemoteStateSnapshotClient) Recv() (*SyncStateSnapshot, error) {
+	m := new(SyncStateSnapshot)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *consensusStackClient) GetRemoteStateDeltas(ctx context.Context, in *ConsensusRemoteRequest, opts ...grpc.CallOption) (ConsensusStack_GetRemoteStateDeltasClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_ConsensusStack_serviceDesc.Streams[2], c.cc, "/protos.ConsensusStack/GetRemoteStateDeltas", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &consensusStackGetRemoteStateDeltasClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ConsensusStack_GetRemoteStateDeltasClient interface {
+	Recv() (*SyncStateDeltas, error)
+	grpc.ClientStream
+}
+
+type consensusStackGetRemoteStateDeltasClient struct {
+	grpc.ClientStream
+}
+
+func (x *consensusStackGetRemoteStateDeltasClient) Recv() (*SyncStateDeltas, error) {
+	m := new(SyncStateDeltas)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *consensusStackClient) StoreState(ctx context.Context, in *ConsensusStateEntry, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/StoreState", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) ReadState(ctx context.Context, in *ConsensusStateKey, opts ...grpc.CallOption) (*ConsensusStateEntry, error) {
+	out := new(ConsensusStateEntry)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/ReadState", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) ReadStateSet(ctx context.Context, in *ConsensusStateKey, opts ...grpc.CallOption) (*ConsensusStateSet, error) {
+	out := new(ConsensusStateSet)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/ReadStateSet", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *consensusStackClient) DelState(ctx context.Context, in *ConsensusStateKey, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.ConsensusStack/DelState", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for ConsensusStack service
+
+type ConsensusStackServer interface {
+	// Inquirer
+	GetNetworkInfo(context.Context, *google_protobuf1.Empty) (*ConsensusNetworkInfo, error)
+	GetNetworkHandles(context.Context, *google_protobuf1.Empty) (*ConsensusNetworkHandles, error)
+	// Communicator
+	Broadcast(context.Context, *ConsensusBroadcastRequest) (*google_protobuf1.Empty, error)
+	Unicast(context.Context, *ConsensusUnicastRequest) (*google_protobuf1.Empty, error)
+	// SecurityUtils
+	Sign(context.Context, *ConsensusSignRequest) (*ConsensusSignature, error)
+	Verify(context.Context, *ConsensusVerifyRequest) (*google_protobuf1.Empty, error)
+	// Executor
+	BeginTxBatch(context.Context, *ConsensusBatchID) (*google_protobuf1.Empty, error)
+	ExecTxs(context.Context, *ConsensusExecTxsRequest) (*ConsensusStateHash, error)
+	RejectTxs(context.Context, *ConsensusRejectTxsRequest) (*google_protobuf1.Empty, error)
+	CommitTxBatch(context.Context, *ConsensusCommitRequest) (*Block, error)
+	RollbackTxBatch(context.Context, *ConsensusBatchID) (*google_protobuf1.Empty, error)
+	PreviewCommitTxBatch(context.Context, *ConsensusCommitRequest) (*Block, error)
+	// ReadOnlyLedger
+	GetBlock(context.Context, *BlockNumber) (*Block, error)
+	GetCurrentStateHash(context.Context, *google_protobuf1.Empty) (*ConsensusStateHash, error)
+	GetBlockchainSize(context.Context, *google_protobuf1.Empty) (*BlockCount, error)
+	GetStateDelta(context.Context, *BlockNumber) (*ConsensusStateDelta, error)
+	// UtilLedger
+	HashBlock(context.Context, *Block) (*ConsensusStateHash, error)
+	VerifyBlockchain(context.Context, *SyncBlockRange) (*BlockNumber, error)
+	// WritableLedger
+	PutBlock(context.Context, *ConsensusPutBlockRequest) (*google_protobuf1.Empty, error)
+	ApplyStateDelta(context.Context, *ConsensusStateDelta) (*google_protobuf1.Empty, error)
+	CommitStateDelta(context.Context, *ConsensusBatchID) (*google_protobuf1.Empty, error)
+	RollbackStateDelta(context.Context, *ConsensusBatchID) (*google_protobuf1.Empty, error)
+	EmptyState(context.Context, *google_protobuf1.Empty) (*google_protobuf1.Empty, error)
+	// RemoteLedgers
+	GetRemoteBlocks(*ConsensusRemoteRequest, ConsensusStack_GetRemoteBlocksServer) error
+	GetRemoteStateSnapshot(*ConsensusRemoteRequest, ConsensusStack_GetRemoteStateSnapshotServer) error
+	GetRemoteStateDeltas(*ConsensusRemoteRequest, ConsensusStack_GetRemoteStateDeltasServer) error
+	// StatePersistor
+	StoreState(context.Context, *ConsensusStateEntry) (*google_protobuf1.Empty, error)
+	ReadState(context.Context, *ConsensusStateKey) (*ConsensusStateEntry, error)
+	ReadStateSet(context.Context, *ConsensusStateKey) (*ConsensusStateSet, error)
+	DelState(context.Context, *ConsensusStateKey) (*google_protobuf1.Empty, error)
+}
+
+func RegisterConsensusStackServer(s *grpc.Server, srv ConsensusStackServer) {
+	s.RegisterService(&_ConsensusStack_serviceDesc, srv)
+}
+
+func _ConsensusStack_GetNetworkInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).GetNetworkInfo(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_GetNetworkHandles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).GetNetworkHandles(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_Broadcast_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusBroadcastRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).Broadcast(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_Unicast_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusUnicastRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).Unicast(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_Sign_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusSignRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).Sign(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusVerifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).Verify(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_BeginTxBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusBatchID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).BeginTxBatch(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_ExecTxs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusExecTxsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).ExecTxs(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_RejectTxs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusRejectTxsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).RejectTxs(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_CommitTxBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusCommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).CommitTxBatch(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_RollbackTxBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusBatchID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).RollbackTxBatch(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_PreviewCommitTxBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusCommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).PreviewCommitTxBatch(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_GetBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(BlockNumber)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).GetBlock(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_GetCurrentStateHash_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).GetCurrentStateHash(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_GetBlockchainSize_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).GetBlockchainSize(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_GetStateDelta_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(BlockNumber)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).GetStateDelta(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_HashBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(Block)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).HashBlock(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_VerifyBlockchain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(SyncBlockRange)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).VerifyBlockchain(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_PutBlock_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusPutBlockRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).PutBlock(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_ApplyStateDelta_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusStateDelta)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).ApplyStateDelta(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_CommitStateDelta_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusBatchID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).CommitStateDelta(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_RollbackStateDelta_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusBatchID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).RollbackStateDelta(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_EmptyState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).EmptyState(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_GetRemoteBlocks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ConsensusRemoteRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConsensusStackServer).GetRemoteBlocks(m, &consensusStackGetRemoteBlocksServer{stream})
+}
+
+type ConsensusStack_GetRemoteBlocksServer interface {
+	Send(*SyncBlocks) error
+	grpc.ServerStream
+}
+
+type consensusStackGetRemoteBlocksServer struct {
+	grpc.ServerStream
+}
+
+func (x *consensusStackGetRemoteBlocksServer) Send(m *SyncBlocks) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ConsensusStack_GetRemoteStateSnapshot_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ConsensusRemoteRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConsensusStackServer).GetRemoteStateSnapshot(m, &consensusStackGetRemoteStateSnapshotServer{stream})
+}
+
+type ConsensusStack_GetRemoteStateSnapshotServer interface {
+	Send(*SyncStateSnapshot) error
+	grpc.ServerStream
+}
+
+type consensusStackGetRemoteStateSnapshotServer struct {
+	grpc.ServerStream
+}
+
+func (x *consensusStackGetRemoteStateSnapshotServer) Send(m *SyncStateSnapshot) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ConsensusStack_GetRemoteStateDeltas_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ConsensusRemoteRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ConsensusStackServer).GetRemoteStateDeltas(m, &consensusStackGetRemoteStateDeltasServer{stream})
+}
+
+type ConsensusStack_GetRemoteStateDeltasServer interface {
+	Send(*SyncStateDeltas) error
+	grpc.ServerStream
+}
+
+type consensusStackGetRemoteStateDeltasServer struct {
+	grpc.ServerStream
+}
+
+func (x *consensusStackGetRemoteStateDeltasServer) Send(m *SyncStateDeltas) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ConsensusStack_StoreState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusStateEntry)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).StoreState(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_ReadState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusStateKey)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).ReadState(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_ReadStateSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusStateKey)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).ReadStateSet(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _ConsensusStack_DelState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusStateKey)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(ConsensusStackServer).DelState(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+var _ConsensusStack_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "protos.ConsensusStack",
+	HandlerType: (*ConsensusStackServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetNetworkInfo",
+			Handler:    _ConsensusStack_GetNetworkInfo_Handler,
+		},
+		{
+			MethodName: "GetNetworkHandles",
+			Handler:    _ConsensusStack_GetNetworkHandles_Handler,
+		},
+		{
+			MethodName: "Broadcast",
+			Handler:    _ConsensusStack_Broadcast_Handler,
+		},
+		{
+			MethodName: "Unicast",
+			Handler:    _ConsensusStack_Unicast_Handler,
+		},
+		{
+			MethodName: "Sign",
+			Handler:    _ConsensusStack_Sign_Handler,
+		},
+		{
+			MethodName: "Verify",
+			Handler:    _ConsensusStack_Verify_Handler,
+		},
+		{
+			MethodName: "BeginTxBatch",
+			Handler:    _ConsensusStack_BeginTxBatch_Handler,
+		},
+		{
+			MethodName: "ExecTxs",
+			Handler:    _ConsensusStack_ExecTxs_Handler,
+		},
+		{
+			MethodName: "RejectTxs",
+			Handler:    _ConsensusStack_RejectTxs_Handler,
+		},
+		{
+			MethodName: "CommitTxBatch",
+			Handler:    _ConsensusStack_CommitTxBatch_Handler,
+		},
+		{
+			MethodName: "RollbackTxBatch",
+			Handler:    _ConsensusStack_RollbackTxBatch_Handler,
+		},
+		{
+			MethodName: "PreviewCommitTxBatch",
+			Handler:    _ConsensusStack_PreviewCommitTxBatch_Handler,
+		},
+		{
+			MethodName: "GetBlock",
+			Handler:    _ConsensusStack_GetBlock_Handler,
+		},
+		{
+			MethodName: "GetCurrentStateHash",
+			Handler:    _ConsensusStack_GetCurrentStateHash_Handler,
+		},
+		{
+			MethodName: "GetBlockchainSize",
+			Handler:    _ConsensusStack_GetBlockchainSize_Handler,
+		},
+		{
+			MethodName: "GetStateDelta",
+			Handler:    _ConsensusStack_GetStateDelta_Handler,
+		},
+		{
+			MethodName: "HashBlock",
+			Handler:    _ConsensusStack_HashBlock_Handler,
+		},
+		{
+			MethodName: "VerifyBlockchain",
+			Handler:    _ConsensusStack_VerifyBlockchain_Handler,
+		},
+		{
+			MethodName: "PutBlock",
+			Handler:    _ConsensusStack_PutBlock_Handler,
+		},
+		{
+			MethodName: "ApplyStateDelta",
+			Handler:    _ConsensusStack_ApplyStateDelta_Handler,
+		},
+		{
+			MethodName: "CommitStateDelta",
+			Handler:    _ConsensusStack_CommitStateDelta_Handler,
+		},
+		{
+			MethodName: "RollbackStateDelta",
+			Handler:    _ConsensusStack_RollbackStateDelta_Handler,
+		},
+		{
+			MethodName: "EmptyState",
+			Handler:    _ConsensusStack_EmptyState_Handler,
+		},
+		{
+			MethodName: "StoreState",
+			Handler:    _ConsensusStack_StoreState_Handler,
+		},
+		{
+			MethodName: "ReadState",
+			Handler:    _ConsensusStack_ReadState_Handler,
+		},
+		{
+			MethodName: "ReadStateSet",
+			Handler:    _ConsensusStack_ReadStateSet_Handler,
+		},
+		{
+			MethodName: "DelState",
+			Handler:    _ConsensusStack_DelState_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetRemoteBlocks",
+			Handler:       _ConsensusStack_GetRemoteBlocks_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetRemoteStateSnapshot",
+			Handler:       _ConsensusStack_GetRemoteStateSnapshot_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetRemoteStateDeltas",
+			Handler:       _ConsensusStack_GetRemoteStateDeltas_Handler,
+			ServerStreams: true,
+		},
+	},
+}
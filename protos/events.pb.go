@@ -93,6 +93,7 @@ type OpenchainEvent struct {
 	//	*OpenchainEvent_Register
 	//	*OpenchainEvent_Block
 	//	*OpenchainEvent_Generic
+	//	*OpenchainEvent_StateTransfer
 	Event isOpenchainEvent_Event `protobuf_oneof:"Event"`
 }
 
@@ -113,10 +114,14 @@ type OpenchainEvent_Block struct {
 type OpenchainEvent_Generic struct {
 	Generic *Generic `protobuf:"bytes,3,opt,name=generic,oneof"`
 }
+type OpenchainEvent_StateTransfer struct {
+	StateTransfer *StateTransferStatus `protobuf:"bytes,4,opt,name=stateTransfer,oneof"`
+}
 
-func (*OpenchainEvent_Register) isOpenchainEvent_Event() {}
-func (*OpenchainEvent_Block) isOpenchainEvent_Event()    {}
-func (*OpenchainEvent_Generic) isOpenchainEvent_Event()  {}
+func (*OpenchainEvent_Register) isOpenchainEvent_Event()      {}
+func (*OpenchainEvent_Block) isOpenchainEvent_Event()         {}
+func (*OpenchainEvent_Generic) isOpenchainEvent_Event()       {}
+func (*OpenchainEvent_StateTransfer) isOpenchainEvent_Event() {}
 
 func (m *OpenchainEvent) GetEvent() isOpenchainEvent_Event {
 	if m != nil {
@@ -146,12 +151,20 @@ func (m *OpenchainEvent) GetGeneric() *Generic {
 	return nil
 }
 
+func (m *OpenchainEvent) GetStateTransfer() *StateTransferStatus {
+	if x, ok := m.GetEvent().(*OpenchainEvent_StateTransfer); ok {
+		return x.StateTransfer
+	}
+	return nil
+}
+
 // XXX_OneofFuncs is for the internal use of the proto package.
 func (*OpenchainEvent) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
 	return _OpenchainEvent_OneofMarshaler, _OpenchainEvent_OneofUnmarshaler, []interface{}{
 		(*OpenchainEvent_Register)(nil),
 		(*OpenchainEvent_Block)(nil),
 		(*OpenchainEvent_Generic)(nil),
+		(*OpenchainEvent_StateTransfer)(nil),
 	}
 }
 
@@ -174,6 +187,11 @@ func _OpenchainEvent_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
 		if err := b.EncodeMessage(x.Generic); err != nil {
 			return err
 		}
+	case *OpenchainEvent_StateTransfer:
+		b.EncodeVarint(4<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.StateTransfer); err != nil {
+			return err
+		}
 	case nil:
 	default:
 		return fmt.Errorf("OpenchainEvent.Event has unexpected type %T", x)
@@ -208,6 +226,14 @@ func _OpenchainEvent_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto
 		err := b.DecodeMessage(msg)
 		m.Event = &OpenchainEvent_Generic{msg}
 		return true, err
+	case 4: // Event.stateTransfer
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(StateTransferStatus)
+		err := b.DecodeMessage(msg)
+		m.Event = &OpenchainEvent_StateTransfer{msg}
+		return true, err
 	default:
 		return false, nil
 	}
@@ -74,28 +74,78 @@ func (x PeerEndpoint_Type) String() string {
 	return proto.EnumName(PeerEndpoint_Type_name, int32(x))
 }
 
+type DisconnectMessage_Reason int32
+
+const (
+	DisconnectMessage_UNDEFINED             DisconnectMessage_Reason = 0
+	DisconnectMessage_NETWORK_MISMATCH      DisconnectMessage_Reason = 1
+	DisconnectMessage_GENESIS_MISMATCH      DisconnectMessage_Reason = 2
+	DisconnectMessage_VERSION_MISMATCH      DisconnectMessage_Reason = 3
+	DisconnectMessage_AUTHENTICATION_FAILED DisconnectMessage_Reason = 4
+	DisconnectMessage_TOO_MANY_PEERS        DisconnectMessage_Reason = 5
+	DisconnectMessage_UNPROVEN_VALIDATOR    DisconnectMessage_Reason = 6
+)
+
+var DisconnectMessage_Reason_name = map[int32]string{
+	0: "UNDEFINED",
+	1: "NETWORK_MISMATCH",
+	2: "GENESIS_MISMATCH",
+	3: "VERSION_MISMATCH",
+	4: "AUTHENTICATION_FAILED",
+	5: "TOO_MANY_PEERS",
+	6: "UNPROVEN_VALIDATOR",
+}
+var DisconnectMessage_Reason_value = map[string]int32{
+	"UNDEFINED":             0,
+	"NETWORK_MISMATCH":      1,
+	"GENESIS_MISMATCH":      2,
+	"VERSION_MISMATCH":      3,
+	"AUTHENTICATION_FAILED": 4,
+	"TOO_MANY_PEERS":        5,
+	"UNPROVEN_VALIDATOR":    6,
+}
+
+func (x DisconnectMessage_Reason) String() string {
+	return proto.EnumName(DisconnectMessage_Reason_name, int32(x))
+}
+
 type OpenchainMessage_Type int32
 
 const (
-	OpenchainMessage_UNDEFINED               OpenchainMessage_Type = 0
-	OpenchainMessage_DISC_HELLO              OpenchainMessage_Type = 1
-	OpenchainMessage_DISC_DISCONNECT         OpenchainMessage_Type = 2
-	OpenchainMessage_DISC_GET_PEERS          OpenchainMessage_Type = 3
-	OpenchainMessage_DISC_PEERS              OpenchainMessage_Type = 4
-	OpenchainMessage_DISC_NEWMSG             OpenchainMessage_Type = 5
-	OpenchainMessage_CHAIN_STATUS            OpenchainMessage_Type = 6
-	OpenchainMessage_CHAIN_TRANSACTION       OpenchainMessage_Type = 7
-	OpenchainMessage_CHAIN_GET_TRANSACTIONS  OpenchainMessage_Type = 8
-	OpenchainMessage_CHAIN_QUERY             OpenchainMessage_Type = 9
-	OpenchainMessage_SYNC_GET_BLOCKS         OpenchainMessage_Type = 11
-	OpenchainMessage_SYNC_BLOCKS             OpenchainMessage_Type = 12
-	OpenchainMessage_SYNC_BLOCK_ADDED        OpenchainMessage_Type = 13
-	OpenchainMessage_SYNC_STATE_GET_SNAPSHOT OpenchainMessage_Type = 14
-	OpenchainMessage_SYNC_STATE_SNAPSHOT     OpenchainMessage_Type = 15
-	OpenchainMessage_SYNC_STATE_GET_DELTAS   OpenchainMessage_Type = 16
-	OpenchainMessage_SYNC_STATE_DELTAS       OpenchainMessage_Type = 17
-	OpenchainMessage_RESPONSE                OpenchainMessage_Type = 20
-	OpenchainMessage_CONSENSUS               OpenchainMessage_Type = 21
+	OpenchainMessage_UNDEFINED                       OpenchainMessage_Type = 0
+	OpenchainMessage_DISC_HELLO                      OpenchainMessage_Type = 1
+	OpenchainMessage_DISC_DISCONNECT                 OpenchainMessage_Type = 2
+	OpenchainMessage_DISC_GET_PEERS                  OpenchainMessage_Type = 3
+	OpenchainMessage_DISC_PEERS                      OpenchainMessage_Type = 4
+	OpenchainMessage_DISC_NEWMSG                     OpenchainMessage_Type = 5
+	OpenchainMessage_CHAIN_STATUS                    OpenchainMessage_Type = 6
+	OpenchainMessage_CHAIN_TRANSACTION               OpenchainMessage_Type = 7
+	OpenchainMessage_CHAIN_GET_TRANSACTIONS          OpenchainMessage_Type = 8
+	OpenchainMessage_CHAIN_QUERY                     OpenchainMessage_Type = 9
+	OpenchainMessage_SYNC_GET_BLOCKS                 OpenchainMessage_Type = 11
+	OpenchainMessage_SYNC_BLOCKS                     OpenchainMessage_Type = 12
+	OpenchainMessage_SYNC_BLOCK_ADDED                OpenchainMessage_Type = 13
+	OpenchainMessage_SYNC_STATE_GET_SNAPSHOT         OpenchainMessage_Type = 14
+	OpenchainMessage_SYNC_STATE_SNAPSHOT             OpenchainMessage_Type = 15
+	OpenchainMessage_SYNC_STATE_GET_DELTAS           OpenchainMessage_Type = 16
+	OpenchainMessage_SYNC_STATE_DELTAS               OpenchainMessage_Type = 17
+	OpenchainMessage_SYNC_STATE_GET_CHUNK            OpenchainMessage_Type = 18
+	OpenchainMessage_SYNC_STATE_CHUNK                OpenchainMessage_Type = 19
+	OpenchainMessage_RESPONSE                        OpenchainMessage_Type = 20
+	OpenchainMessage_CONSENSUS                       OpenchainMessage_Type = 21
+	OpenchainMessage_CHAIN_REPLY_REQUEST             OpenchainMessage_Type = 22
+	OpenchainMessage_CHAIN_REPLY                     OpenchainMessage_Type = 23
+	OpenchainMessage_DISC_AUTH                       OpenchainMessage_Type = 24
+	OpenchainMessage_SYNC_CREDIT                     OpenchainMessage_Type = 25
+	OpenchainMessage_GOSSIP_BLOCK_HEADER             OpenchainMessage_Type = 26
+	OpenchainMessage_SYNC_GET_BLOCK_HEADERS          OpenchainMessage_Type = 27
+	OpenchainMessage_SYNC_BLOCK_HEADERS              OpenchainMessage_Type = 28
+	OpenchainMessage_SYNC_GET_TRANSACTION_PROOF      OpenchainMessage_Type = 29
+	OpenchainMessage_SYNC_TRANSACTION_PROOF          OpenchainMessage_Type = 30
+	OpenchainMessage_DISC_PING                       OpenchainMessage_Type = 31
+	OpenchainMessage_DISC_PONG                       OpenchainMessage_Type = 32
+	OpenchainMessage_SYNC_GET_CHECKPOINT_CERTIFICATE OpenchainMessage_Type = 33
+	OpenchainMessage_SYNC_CHECKPOINT_CERTIFICATE     OpenchainMessage_Type = 34
 )
 
 var OpenchainMessage_Type_name = map[int32]string{
@@ -116,29 +166,59 @@ var OpenchainMessage_Type_name = map[int32]string{
 	15: "SYNC_STATE_SNAPSHOT",
 	16: "SYNC_STATE_GET_DELTAS",
 	17: "SYNC_STATE_DELTAS",
+	18: "SYNC_STATE_GET_CHUNK",
+	19: "SYNC_STATE_CHUNK",
 	20: "RESPONSE",
 	21: "CONSENSUS",
+	22: "CHAIN_REPLY_REQUEST",
+	23: "CHAIN_REPLY",
+	24: "DISC_AUTH",
+	25: "SYNC_CREDIT",
+	26: "GOSSIP_BLOCK_HEADER",
+	27: "SYNC_GET_BLOCK_HEADERS",
+	28: "SYNC_BLOCK_HEADERS",
+	29: "SYNC_GET_TRANSACTION_PROOF",
+	30: "SYNC_TRANSACTION_PROOF",
+	31: "DISC_PING",
+	32: "DISC_PONG",
+	33: "SYNC_GET_CHECKPOINT_CERTIFICATE",
+	34: "SYNC_CHECKPOINT_CERTIFICATE",
 }
 var OpenchainMessage_Type_value = map[string]int32{
-	"UNDEFINED":               0,
-	"DISC_HELLO":              1,
-	"DISC_DISCONNECT":         2,
-	"DISC_GET_PEERS":          3,
-	"DISC_PEERS":              4,
-	"DISC_NEWMSG":             5,
-	"CHAIN_STATUS":            6,
-	"CHAIN_TRANSACTION":       7,
-	"CHAIN_GET_TRANSACTIONS":  8,
-	"CHAIN_QUERY":             9,
-	"SYNC_GET_BLOCKS":         11,
-	"SYNC_BLOCKS":             12,
-	"SYNC_BLOCK_ADDED":        13,
-	"SYNC_STATE_GET_SNAPSHOT": 14,
-	"SYNC_STATE_SNAPSHOT":     15,
-	"SYNC_STATE_GET_DELTAS":   16,
-	"SYNC_STATE_DELTAS":       17,
-	"RESPONSE":                20,
-	"CONSENSUS":               21,
+	"UNDEFINED":                       0,
+	"DISC_HELLO":                      1,
+	"DISC_DISCONNECT":                 2,
+	"DISC_GET_PEERS":                  3,
+	"DISC_PEERS":                      4,
+	"DISC_NEWMSG":                     5,
+	"CHAIN_STATUS":                    6,
+	"CHAIN_TRANSACTION":               7,
+	"CHAIN_GET_TRANSACTIONS":          8,
+	"CHAIN_QUERY":                     9,
+	"SYNC_GET_BLOCKS":                 11,
+	"SYNC_BLOCKS":                     12,
+	"SYNC_BLOCK_ADDED":                13,
+	"SYNC_STATE_GET_SNAPSHOT":         14,
+	"SYNC_STATE_SNAPSHOT":             15,
+	"SYNC_STATE_GET_DELTAS":           16,
+	"SYNC_STATE_DELTAS":               17,
+	"SYNC_STATE_GET_CHUNK":            18,
+	"SYNC_STATE_CHUNK":                19,
+	"RESPONSE":                        20,
+	"CONSENSUS":                       21,
+	"CHAIN_REPLY_REQUEST":             22,
+	"CHAIN_REPLY":                     23,
+	"DISC_AUTH":                       24,
+	"SYNC_CREDIT":                     25,
+	"GOSSIP_BLOCK_HEADER":             26,
+	"SYNC_GET_BLOCK_HEADERS":          27,
+	"SYNC_BLOCK_HEADERS":              28,
+	"SYNC_GET_TRANSACTION_PROOF":      29,
+	"SYNC_TRANSACTION_PROOF":          30,
+	"DISC_PING":                       31,
+	"DISC_PONG":                       32,
+	"SYNC_GET_CHECKPOINT_CERTIFICATE": 33,
+	"SYNC_CHECKPOINT_CERTIFICATE":     34,
 }
 
 func (x OpenchainMessage_Type) String() string {
@@ -221,7 +301,9 @@ func (m *TransactionBlock) GetTransactions() []*Transaction {
 // uuid - The unique identifier of this transaction.
 // result - The return value of the transaction.
 // errorCode - An error code. 5xx will be logged as a failure in the dashboard.
-// error - An error string for logging an issue.
+// The same on every validator, so it is committed to by the block hash.
+// error - An error string for logging an issue. It may differ between
+// validators, so it is not authoritative.
 type TransactionResult struct {
 	Uuid      string `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
 	Result    []byte `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"`
@@ -234,7 +316,9 @@ func (m *TransactionResult) String() string { return proto.CompactTextString(m)
 func (*TransactionResult) ProtoMessage()    {}
 
 // Block carries The data that describes a block in the blockchain.
-// version - Version used to track any protocol changes.
+// version - Version used to track any protocol changes. Blocks of version 1
+// on are hashed over their BlockHeader, blocks of version 0 over all their
+// fields but nonHashData.
 // timestamp - The time at which the block or transaction order
 // was proposed. This may not be used by all consensus modules.
 // transactions - The ordered list of transactions in the block.
@@ -280,8 +364,38 @@ func (m *Block) GetNonHashData() *NonHashData {
 	return nil
 }
 
+// BlockHeader holds the fields of a block which the hash of the block is
+// computed over. The transactions are represented by transactionsRoot, the
+// root of a Merkle tree over the transactions, so that a chain of headers can
+// be verified without the transactions, and a transaction can be proven to be
+// in a block by its path in the tree. transactionResultsHash commits to the
+// uuid and errorCode of the transaction results of the block, which are kept
+// in its nonHashData.
+type BlockHeader struct {
+	Version                uint32                     `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	Timestamp              *google_protobuf.Timestamp `protobuf:"bytes,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	TransactionsRoot       []byte                     `protobuf:"bytes,3,opt,name=transactionsRoot,proto3" json:"transactionsRoot,omitempty"`
+	StateHash              []byte                     `protobuf:"bytes,4,opt,name=stateHash,proto3" json:"stateHash,omitempty"`
+	PreviousBlockHash      []byte                     `protobuf:"bytes,5,opt,name=previousBlockHash,proto3" json:"previousBlockHash,omitempty"`
+	ConsensusMetadata      []byte                     `protobuf:"bytes,6,opt,name=consensusMetadata,proto3" json:"consensusMetadata,omitempty"`
+	TransactionResultsHash []byte                     `protobuf:"bytes,7,opt,name=transactionResultsHash,proto3" json:"transactionResultsHash,omitempty"`
+}
+
+func (m *BlockHeader) Reset()         { *m = BlockHeader{} }
+func (m *BlockHeader) String() string { return proto.CompactTextString(m) }
+func (*BlockHeader) ProtoMessage()    {}
+
+func (m *BlockHeader) GetTimestamp() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
 // Contains information about the blockchain ledger such as height, current
-// block hash, and previous block hash.
+// block hash, and previous block hash. It is also the payload of
+// OpenchainMessage.GOSSIP_BLOCK_HEADER, by which NVPs announce the head of
+// their chain to each other.
 type BlockchainInfo struct {
 	Height            uint64 `protobuf:"varint,1,opt,name=height" json:"height,omitempty"`
 	CurrentBlockHash  []byte `protobuf:"bytes,2,opt,name=currentBlockHash,proto3" json:"currentBlockHash,omitempty"`
@@ -292,11 +406,57 @@ func (m *BlockchainInfo) Reset()         { *m = BlockchainInfo{} }
 func (m *BlockchainInfo) String() string { return proto.CompactTextString(m) }
 func (*BlockchainInfo) ProtoMessage()    {}
 
+// CheckpointCertificate proves that a block was stable under consensus: it
+// carries the signed checkpoint messages of at least 2f+1 validators which
+// agree on the block number and hash at a given sequence number. A client
+// which knows the validator set can verify the certificate and then trust
+// the block (and, through it, stateHash) without running consensus itself.
+type CheckpointCertificate struct {
+	BlockNumber    uint64              `protobuf:"varint,1,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	BlockHash      []byte              `protobuf:"bytes,2,opt,name=blockHash,proto3" json:"blockHash,omitempty"`
+	StateHash      []byte              `protobuf:"bytes,3,opt,name=stateHash,proto3" json:"stateHash,omitempty"`
+	SequenceNumber uint64              `protobuf:"varint,4,opt,name=sequenceNumber" json:"sequenceNumber,omitempty"`
+	Checkpoints    []*SignedCheckpoint `protobuf:"bytes,5,rep,name=checkpoints" json:"checkpoints,omitempty"`
+}
+
+func (m *CheckpointCertificate) Reset()         { *m = CheckpointCertificate{} }
+func (m *CheckpointCertificate) String() string { return proto.CompactTextString(m) }
+func (*CheckpointCertificate) ProtoMessage()    {}
+
+func (m *CheckpointCertificate) GetCheckpoints() []*SignedCheckpoint {
+	if m != nil {
+		return m.Checkpoints
+	}
+	return nil
+}
+
+// SignedCheckpoint is a single validator's checkpoint as it was sent over
+// the wire. payload holds the exact bytes that were signed.
+type SignedCheckpoint struct {
+	ReplicaID uint64  `protobuf:"varint,1,opt,name=replicaID" json:"replicaID,omitempty"`
+	Validator *PeerID `protobuf:"bytes,2,opt,name=validator" json:"validator,omitempty"`
+	Payload   []byte  `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Signature []byte  `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *SignedCheckpoint) Reset()         { *m = SignedCheckpoint{} }
+func (m *SignedCheckpoint) String() string { return proto.CompactTextString(m) }
+func (*SignedCheckpoint) ProtoMessage()    {}
+
+func (m *SignedCheckpoint) GetValidator() *PeerID {
+	if m != nil {
+		return m.Validator
+	}
+	return nil
+}
+
 // NonHashData is data that is recorded on the block, but not included in
 // the block hash when verifying the blockchain.
 // localLedgerCommitTimestamp - The time at which the block was added
 // to the ledger on the local peer.
-// transactionResults - The results of transactions.
+// transactionResults - The results of transactions. From BlockVersion on,
+// the block hash commits to their uuid and errorCode through the
+// transactionResultsHash of the header, but not to their error string.
 type NonHashData struct {
 	LocalLedgerCommitTimestamp *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=localLedgerCommitTimestamp" json:"localLedgerCommitTimestamp,omitempty"`
 	TransactionResults         []*TransactionResult       `protobuf:"bytes,2,rep,name=transactionResults" json:"transactionResults,omitempty"`
@@ -342,6 +502,9 @@ type PeerEndpoint struct {
 	Address string            `protobuf:"bytes,2,opt,name=address" json:"address,omitempty"`
 	Type    PeerEndpoint_Type `protobuf:"varint,3,opt,name=type,enum=protos.PeerEndpoint_Type" json:"type,omitempty"`
 	PkiID   []byte            `protobuf:"bytes,4,opt,name=pkiID,proto3" json:"pkiID,omitempty"`
+	// light is set by a light peer, which keeps the block headers only and
+	// does not relay blocks.
+	Light bool `protobuf:"varint,5,opt,name=light" json:"light,omitempty"`
 }
 
 func (m *PeerEndpoint) Reset()         { *m = PeerEndpoint{} }
@@ -357,6 +520,9 @@ func (m *PeerEndpoint) GetID() *PeerID {
 
 type PeersMessage struct {
 	Peers []*PeerEndpoint `protobuf:"bytes,1,rep,name=peers" json:"peers,omitempty"`
+	// Known peers from the discovery store, with their reputation. Only
+	// filled in for API clients, never sent to other peers.
+	Discovered []*DiscoveredPeer `protobuf:"bytes,2,rep,name=discovered" json:"discovered,omitempty"`
 }
 
 func (m *PeersMessage) Reset()         { *m = PeersMessage{} }
@@ -370,9 +536,69 @@ func (m *PeersMessage) GetPeers() []*PeerEndpoint {
 	return nil
 }
 
+func (m *PeersMessage) GetDiscovered() []*DiscoveredPeer {
+	if m != nil {
+		return m.Discovered
+	}
+	return nil
+}
+
+// DiscoveredPeer is what a peer remembers about another peer it discovered.
+// reputation goes up with each successful connection, and down with each
+// failed connection attempt and protocol error. discovered is when the peer
+// was first heard of.
+type DiscoveredPeer struct {
+	Endpoint       *PeerEndpoint              `protobuf:"bytes,1,opt,name=endpoint" json:"endpoint,omitempty"`
+	LastSeen       *google_protobuf.Timestamp `protobuf:"bytes,2,opt,name=lastSeen" json:"lastSeen,omitempty"`
+	Reputation     int64                      `protobuf:"varint,3,opt,name=reputation" json:"reputation,omitempty"`
+	Connects       uint64                     `protobuf:"varint,4,opt,name=connects" json:"connects,omitempty"`
+	FailedConnects uint64                     `protobuf:"varint,5,opt,name=failedConnects" json:"failedConnects,omitempty"`
+	ProtocolErrors uint64                     `protobuf:"varint,6,opt,name=protocolErrors" json:"protocolErrors,omitempty"`
+	Connected      bool                       `protobuf:"varint,7,opt,name=connected" json:"connected,omitempty"`
+	Discovered     *google_protobuf.Timestamp `protobuf:"bytes,8,opt,name=discovered" json:"discovered,omitempty"`
+}
+
+func (m *DiscoveredPeer) Reset()         { *m = DiscoveredPeer{} }
+func (m *DiscoveredPeer) String() string { return proto.CompactTextString(m) }
+func (*DiscoveredPeer) ProtoMessage()    {}
+
+func (m *DiscoveredPeer) GetEndpoint() *PeerEndpoint {
+	if m != nil {
+		return m.Endpoint
+	}
+	return nil
+}
+
+func (m *DiscoveredPeer) GetLastSeen() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.LastSeen
+	}
+	return nil
+}
+
+func (m *DiscoveredPeer) GetDiscovered() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Discovered
+	}
+	return nil
+}
+
+// HelloMessage opens the chat between two peers. They only talk if they are
+// on the same network, started from the same genesis block, and speak
+// compatible semver protocol versions.
+// When security is enabled, nonce is the challenge the peer has to answer
+// with a DISC_AUTH before the chat goes on.
 type HelloMessage struct {
-	PeerEndpoint   *PeerEndpoint   `protobuf:"bytes,1,opt,name=peerEndpoint" json:"peerEndpoint,omitempty"`
-	BlockchainInfo *BlockchainInfo `protobuf:"bytes,2,opt,name=blockchainInfo" json:"blockchainInfo,omitempty"`
+	PeerEndpoint    *PeerEndpoint   `protobuf:"bytes,1,opt,name=peerEndpoint" json:"peerEndpoint,omitempty"`
+	BlockchainInfo  *BlockchainInfo `protobuf:"bytes,2,opt,name=blockchainInfo" json:"blockchainInfo,omitempty"`
+	NetworkID       string          `protobuf:"bytes,3,opt,name=networkID" json:"networkID,omitempty"`
+	GenesisHash     []byte          `protobuf:"bytes,4,opt,name=genesisHash,proto3" json:"genesisHash,omitempty"`
+	ProtocolVersion string          `protobuf:"bytes,5,opt,name=protocolVersion" json:"protocolVersion,omitempty"`
+	Nonce           []byte          `protobuf:"bytes,6,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	// Compression algorithms the peer decompresses, by preference, and
+	// whether it reassembles chunked messages.
+	Compressions []string `protobuf:"bytes,7,rep,name=compressions" json:"compressions,omitempty"`
+	Chunking     bool     `protobuf:"varint,8,opt,name=chunking" json:"chunking,omitempty"`
 }
 
 func (m *HelloMessage) Reset()         { *m = HelloMessage{} }
@@ -393,11 +619,26 @@ func (m *HelloMessage) GetBlockchainInfo() *BlockchainInfo {
 	return nil
 }
 
+// DisconnectMessage is the payload of DISC_DISCONNECT, it tells a peer why
+// we end the chat with it.
+type DisconnectMessage struct {
+	Reason DisconnectMessage_Reason `protobuf:"varint,1,opt,name=reason,enum=protos.DisconnectMessage_Reason" json:"reason,omitempty"`
+	Detail string                   `protobuf:"bytes,2,opt,name=detail" json:"detail,omitempty"`
+}
+
+func (m *DisconnectMessage) Reset()         { *m = DisconnectMessage{} }
+func (m *DisconnectMessage) String() string { return proto.CompactTextString(m) }
+func (*DisconnectMessage) ProtoMessage()    {}
+
 type OpenchainMessage struct {
 	Type      OpenchainMessage_Type      `protobuf:"varint,1,opt,name=type,enum=protos.OpenchainMessage_Type" json:"type,omitempty"`
 	Timestamp *google_protobuf.Timestamp `protobuf:"bytes,2,opt,name=timestamp" json:"timestamp,omitempty"`
 	Payload   []byte                     `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
 	Signature []byte                     `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	// Algorithm the payload is compressed with, empty if it is not.
+	Compression string `protobuf:"bytes,5,opt,name=compression" json:"compression,omitempty"`
+	// Set if the payload is a chunk of the payload of a larger message.
+	Chunk *MessageChunk `protobuf:"bytes,6,opt,name=chunk" json:"chunk,omitempty"`
 }
 
 func (m *OpenchainMessage) Reset()         { *m = OpenchainMessage{} }
@@ -411,6 +652,26 @@ func (m *OpenchainMessage) GetTimestamp() *google_protobuf.Timestamp {
 	return nil
 }
 
+func (m *OpenchainMessage) GetChunk() *MessageChunk {
+	if m != nil {
+		return m.Chunk
+	}
+	return nil
+}
+
+// MessageChunk locates a chunk in a message split for the stream. The
+// chunks of a message are sent in order and back to back, the first one
+// carries the timestamp, signature and compression of the message.
+type MessageChunk struct {
+	Id    uint64 `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	Index uint32 `protobuf:"varint,2,opt,name=index" json:"index,omitempty"`
+	Count uint32 `protobuf:"varint,3,opt,name=count" json:"count,omitempty"`
+}
+
+func (m *MessageChunk) Reset()         { *m = MessageChunk{} }
+func (m *MessageChunk) String() string { return proto.CompactTextString(m) }
+func (*MessageChunk) ProtoMessage()    {}
+
 type Response struct {
 	Status Response_StatusCode `protobuf:"varint,1,opt,name=status,enum=protos.Response_StatusCode" json:"status,omitempty"`
 	Msg    []byte              `protobuf:"bytes,2,opt,name=msg,proto3" json:"msg,omitempty"`
@@ -420,14 +681,71 @@ func (m *Response) Reset()         { *m = Response{} }
 func (m *Response) String() string { return proto.CompactTextString(m) }
 func (*Response) ProtoMessage()    {}
 
+// TransactionReplyRequest is the payload of OpenchainMessage.CHAIN_REPLY_REQUEST.
+// It asks a validator to send a TransactionReply once the transaction with
+// the given uuid has been committed.
+type TransactionReplyRequest struct {
+	Uuid string `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
+}
+
+func (m *TransactionReplyRequest) Reset()         { *m = TransactionReplyRequest{} }
+func (m *TransactionReplyRequest) String() string { return proto.CompactTextString(m) }
+func (*TransactionReplyRequest) ProtoMessage()    {}
+
+// TransactionReply is the payload of OpenchainMessage.CHAIN_REPLY. The
+// replica signs it after committing the transaction with the given uuid in
+// block blockNumber, resultHash being the hash of the TransactionResult. As at
+// most f validators are faulty, f+1 matching replies from distinct validators
+// confirm the outcome of the transaction.
+type TransactionReply struct {
+	Uuid        string  `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
+	ResultHash  []byte  `protobuf:"bytes,2,opt,name=resultHash,proto3" json:"resultHash,omitempty"`
+	BlockNumber uint64  `protobuf:"varint,3,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Replica     *PeerID `protobuf:"bytes,4,opt,name=replica" json:"replica,omitempty"`
+	Signature   []byte  `protobuf:"bytes,5,opt,name=signature,proto3" json:"signature,omitempty"`
+}
+
+func (m *TransactionReply) Reset()         { *m = TransactionReply{} }
+func (m *TransactionReply) String() string { return proto.CompactTextString(m) }
+func (*TransactionReply) ProtoMessage()    {}
+
+func (m *TransactionReply) GetReplica() *PeerID {
+	if m != nil {
+		return m.Replica
+	}
+	return nil
+}
+
+// TransactionReplyCertificate holds the f+1 matching replies which confirmed
+// the outcome of the transaction with the given uuid to a non-validating peer.
+type TransactionReplyCertificate struct {
+	Uuid    string              `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
+	Replies []*TransactionReply `protobuf:"bytes,2,rep,name=replies" json:"replies,omitempty"`
+}
+
+func (m *TransactionReplyCertificate) Reset()         { *m = TransactionReplyCertificate{} }
+func (m *TransactionReplyCertificate) String() string { return proto.CompactTextString(m) }
+func (*TransactionReplyCertificate) ProtoMessage()    {}
+
+func (m *TransactionReplyCertificate) GetReplies() []*TransactionReply {
+	if m != nil {
+		return m.Replies
+	}
+	return nil
+}
+
 // BlockState is the payload of OpenchainMessage.SYNC_BLOCK_ADDED. When a VP
 // commits a new block to the ledger, it will notify its connected NVPs of the
 // block and the delta state. The NVP may call the ledger APIs to apply the
 // block and the delta state to its ledger if the block's previousBlockHash
-// equals to the NVP's current block hash
+// equals to the NVP's current block hash. blockNumber is the number of the
+// block on the chain of the VP. The block comes without the payloads of its
+// transactions, blockHash is the hash of the full block.
 type BlockState struct {
-	Block      *Block `protobuf:"bytes,1,opt,name=block" json:"block,omitempty"`
-	StateDelta []byte `protobuf:"bytes,2,opt,name=stateDelta,proto3" json:"stateDelta,omitempty"`
+	Block       *Block `protobuf:"bytes,1,opt,name=block" json:"block,omitempty"`
+	StateDelta  []byte `protobuf:"bytes,2,opt,name=stateDelta,proto3" json:"stateDelta,omitempty"`
+	BlockNumber uint64 `protobuf:"varint,3,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	BlockHash   []byte `protobuf:"bytes,4,opt,name=blockHash,proto3" json:"blockHash,omitempty"`
 }
 
 func (m *BlockState) Reset()         { *m = BlockState{} }
@@ -447,8 +765,9 @@ func (m *BlockState) GetBlock() *Block {
 // example, if start=3 and end=5, the order of blocks will be 3, 4, 5.
 // If start=5 and end=3, the order will be 5, 4, 3.
 type SyncBlockRange struct {
-	Start uint64 `protobuf:"varint,1,opt,name=start" json:"start,omitempty"`
-	End   uint64 `protobuf:"varint,2,opt,name=end" json:"end,omitempty"`
+	Start         uint64 `protobuf:"varint,1,opt,name=start" json:"start,omitempty"`
+	End           uint64 `protobuf:"varint,2,opt,name=end" json:"end,omitempty"`
+	CorrelationId uint64 `protobuf:"varint,3,opt,name=correlationId" json:"correlationId,omitempty"`
 }
 
 func (m *SyncBlockRange) Reset()         { *m = SyncBlockRange{} }
@@ -511,6 +830,45 @@ func (m *SyncStateSnapshot) GetRequest() *SyncStateSnapshotRequest {
 	return nil
 }
 
+// SyncStateChunkRequest is the payload of OpenchainMessage.SYNC_STATE_GET_CHUNK.
+// chunk is the index of the requested piece of the state. If stateHash is set,
+// the chunk is only sent if the current state of the peer has that hash,
+// otherwise the response carries only the block number and hash of the state
+// the peer has moved on to.
+type SyncStateChunkRequest struct {
+	CorrelationId uint64 `protobuf:"varint,1,opt,name=correlationId" json:"correlationId,omitempty"`
+	Chunk         uint64 `protobuf:"varint,2,opt,name=chunk" json:"chunk,omitempty"`
+	StateHash     []byte `protobuf:"bytes,3,opt,name=stateHash,proto3" json:"stateHash,omitempty"`
+}
+
+func (m *SyncStateChunkRequest) Reset()         { *m = SyncStateChunkRequest{} }
+func (m *SyncStateChunkRequest) String() string { return proto.CompactTextString(m) }
+func (*SyncStateChunkRequest) ProtoMessage()    {}
+
+// SyncStateChunk is the payload of OpenchainMessage.SYNC_STATE_CHUNK, which is
+// a response to OpenchainMessage.SYNC_STATE_GET_CHUNK. The delta holds the
+// key-values of the chunk, and the proof links them to stateHash, the hash of
+// the state at blockNumber, so that each chunk can be verified on its own.
+type SyncStateChunk struct {
+	Request     *SyncStateChunkRequest `protobuf:"bytes,1,opt,name=request" json:"request,omitempty"`
+	BlockNumber uint64                 `protobuf:"varint,2,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	StateHash   []byte                 `protobuf:"bytes,3,opt,name=stateHash,proto3" json:"stateHash,omitempty"`
+	NumChunks   uint64                 `protobuf:"varint,4,opt,name=numChunks" json:"numChunks,omitempty"`
+	Delta       []byte                 `protobuf:"bytes,5,opt,name=delta,proto3" json:"delta,omitempty"`
+	Proof       []byte                 `protobuf:"bytes,6,opt,name=proof,proto3" json:"proof,omitempty"`
+}
+
+func (m *SyncStateChunk) Reset()         { *m = SyncStateChunk{} }
+func (m *SyncStateChunk) String() string { return proto.CompactTextString(m) }
+func (*SyncStateChunk) ProtoMessage()    {}
+
+func (m *SyncStateChunk) GetRequest() *SyncStateChunkRequest {
+	if m != nil {
+		return m.Request
+	}
+	return nil
+}
+
 // SyncStateRequest is the payload of OpenchainMessage.SYNC_GET_STATE.
 // blockNumber indicates the block number for the delta which is being
 // requested. If no payload is included with SYNC_GET_STATE, it represents
@@ -548,9 +906,133 @@ func (m *SyncStateDeltas) GetRange() *SyncBlockRange {
 	return nil
 }
 
+// SyncBlockHeaders is the payload of OpenchainMessage.SYNC_BLOCK_HEADERS, the
+// response to OpenchainMessage.SYNC_GET_BLOCK_HEADERS, which carries a
+// SyncBlockRange. The headers are those of the blocks from range.start on,
+// up to range.end or as many as the peer sends in one response.
+type SyncBlockHeaders struct {
+	Range   *SyncBlockRange `protobuf:"bytes,1,opt,name=range" json:"range,omitempty"`
+	Headers []*BlockHeader  `protobuf:"bytes,2,rep,name=headers" json:"headers,omitempty"`
+}
+
+func (m *SyncBlockHeaders) Reset()         { *m = SyncBlockHeaders{} }
+func (m *SyncBlockHeaders) String() string { return proto.CompactTextString(m) }
+func (*SyncBlockHeaders) ProtoMessage()    {}
+
+func (m *SyncBlockHeaders) GetRange() *SyncBlockRange {
+	if m != nil {
+		return m.Range
+	}
+	return nil
+}
+
+func (m *SyncBlockHeaders) GetHeaders() []*BlockHeader {
+	if m != nil {
+		return m.Headers
+	}
+	return nil
+}
+
+// TransactionProofRequest is the payload of
+// OpenchainMessage.SYNC_GET_TRANSACTION_PROOF.
+type TransactionProofRequest struct {
+	CorrelationId uint64 `protobuf:"varint,1,opt,name=correlationId" json:"correlationId,omitempty"`
+	Uuid          string `protobuf:"bytes,2,opt,name=uuid" json:"uuid,omitempty"`
+}
+
+func (m *TransactionProofRequest) Reset()         { *m = TransactionProofRequest{} }
+func (m *TransactionProofRequest) String() string { return proto.CompactTextString(m) }
+func (*TransactionProofRequest) ProtoMessage()    {}
+
+// CheckpointCertificateRequest is the payload of
+// OpenchainMessage.SYNC_GET_CHECKPOINT_CERTIFICATE, by which a light peer
+// asks a full peer for its latest stable checkpoint certificate.
+type CheckpointCertificateRequest struct {
+	CorrelationId uint64 `protobuf:"varint,1,opt,name=correlationId" json:"correlationId,omitempty"`
+}
+
+func (m *CheckpointCertificateRequest) Reset()         { *m = CheckpointCertificateRequest{} }
+func (m *CheckpointCertificateRequest) String() string { return proto.CompactTextString(m) }
+func (*CheckpointCertificateRequest) ProtoMessage()    {}
+
+// SyncCheckpointCertificate is the payload of
+// OpenchainMessage.SYNC_CHECKPOINT_CERTIFICATE, the response to
+// OpenchainMessage.SYNC_GET_CHECKPOINT_CERTIFICATE. The certificate is
+// missing if the peer has none.
+type SyncCheckpointCertificate struct {
+	Request     *CheckpointCertificateRequest `protobuf:"bytes,1,opt,name=request" json:"request,omitempty"`
+	Certificate *CheckpointCertificate        `protobuf:"bytes,2,opt,name=certificate" json:"certificate,omitempty"`
+}
+
+func (m *SyncCheckpointCertificate) Reset()         { *m = SyncCheckpointCertificate{} }
+func (m *SyncCheckpointCertificate) String() string { return proto.CompactTextString(m) }
+func (*SyncCheckpointCertificate) ProtoMessage()    {}
+
+func (m *SyncCheckpointCertificate) GetRequest() *CheckpointCertificateRequest {
+	if m != nil {
+		return m.Request
+	}
+	return nil
+}
+
+func (m *SyncCheckpointCertificate) GetCertificate() *CheckpointCertificate {
+	if m != nil {
+		return m.Certificate
+	}
+	return nil
+}
+
+// TransactionProof is the payload of OpenchainMessage.SYNC_TRANSACTION_PROOF,
+// the response to OpenchainMessage.SYNC_GET_TRANSACTION_PROOF. It proves that
+// transaction is transaction index of the count transactions in block
+// blockNumber, path holding the hashes of the siblings on the way from the
+// transaction up to the transactionsRoot of the block. The transaction is
+// missing if the peer does not know it.
+type TransactionProof struct {
+	Request     *TransactionProofRequest `protobuf:"bytes,1,opt,name=request" json:"request,omitempty"`
+	BlockNumber uint64                   `protobuf:"varint,2,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Transaction *Transaction             `protobuf:"bytes,3,opt,name=transaction" json:"transaction,omitempty"`
+	Index       uint64                   `protobuf:"varint,4,opt,name=index" json:"index,omitempty"`
+	Count       uint64                   `protobuf:"varint,5,opt,name=count" json:"count,omitempty"`
+	Path        [][]byte                 `protobuf:"bytes,6,rep,name=path,proto3" json:"path,omitempty"`
+}
+
+func (m *TransactionProof) Reset()         { *m = TransactionProof{} }
+func (m *TransactionProof) String() string { return proto.CompactTextString(m) }
+func (*TransactionProof) ProtoMessage()    {}
+
+func (m *TransactionProof) GetRequest() *TransactionProofRequest {
+	if m != nil {
+		return m.Request
+	}
+	return nil
+}
+
+func (m *TransactionProof) GetTransaction() *Transaction {
+	if m != nil {
+		return m.Transaction
+	}
+	return nil
+}
+
+// SyncCredit is the payload of OpenchainMessage.SYNC_CREDIT. The requestor of
+// a sync stream grants the sender credits to send that many more messages of
+// type for the request with correlationId. The sender pauses when it runs out
+// of credits, so that a slow requestor does not have to drop messages.
+type SyncCredit struct {
+	Type          OpenchainMessage_Type `protobuf:"varint,1,opt,name=type,enum=protos.OpenchainMessage_Type" json:"type,omitempty"`
+	CorrelationId uint64                `protobuf:"varint,2,opt,name=correlationId" json:"correlationId,omitempty"`
+	Credits       uint64                `protobuf:"varint,3,opt,name=credits" json:"credits,omitempty"`
+}
+
+func (m *SyncCredit) Reset()         { *m = SyncCredit{} }
+func (m *SyncCredit) String() string { return proto.CompactTextString(m) }
+func (*SyncCredit) ProtoMessage()    {}
+
 func init() {
 	proto.RegisterEnum("protos.Transaction_Type", Transaction_Type_name, Transaction_Type_value)
 	proto.RegisterEnum("protos.PeerEndpoint_Type", PeerEndpoint_Type_name, PeerEndpoint_Type_value)
+	proto.RegisterEnum("protos.DisconnectMessage_Reason", DisconnectMessage_Reason_name, DisconnectMessage_Reason_value)
 	proto.RegisterEnum("protos.OpenchainMessage_Type", OpenchainMessage_Type_name, OpenchainMessage_Type_value)
 	proto.RegisterEnum("protos.Response_StatusCode", Response_StatusCode_name, Response_StatusCode_value)
 }
@@ -0,0 +1,68 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package protos
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-incubator/obc-peer/openchain/util"
+)
+
+// NewTransactionReply creates the unsigned reply of replica to the
+// transaction with the given result, committed in block blockNumber. The
+// error message is left out of the result hash, as it need not be the same
+// on every replica; the error code is.
+func NewTransactionReply(result *TransactionResult, blockNumber uint64, replica *PeerID) (*TransactionReply, error) {
+	data, err := proto.Marshal(&TransactionResult{
+		Uuid:      result.Uuid,
+		Result:    result.Result,
+		ErrorCode: result.ErrorCode,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal transaction result: %s", err)
+	}
+	return &TransactionReply{
+		Uuid:        result.Uuid,
+		ResultHash:  util.ComputeCryptoHash(data),
+		BlockNumber: blockNumber,
+		Replica:     replica,
+	}, nil
+}
+
+// SignedBytes returns the bytes of this reply covered by its signature.
+func (reply *TransactionReply) SignedBytes() ([]byte, error) {
+	unsigned := *reply
+	unsigned.Signature = nil
+	data, err := proto.Marshal(&unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal transaction reply: %s", err)
+	}
+	return data, nil
+}
+
+// Matches returns whether other reports the same outcome of the same
+// transaction as this reply, regardless of the replica which sent it.
+func (reply *TransactionReply) Matches(other *TransactionReply) bool {
+	return reply.Uuid == other.Uuid &&
+		reply.BlockNumber == other.BlockNumber &&
+		bytes.Equal(reply.ResultHash, other.ResultHash)
+}
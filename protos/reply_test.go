@@ -0,0 +1,63 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package protos
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTransactionReply(t *testing.T) {
+	result := &TransactionResult{Uuid: "tx1", Result: []byte("42")}
+	a, err := NewTransactionReply(result, 3, &PeerID{Name: "vp0"})
+	if err != nil {
+		t.Fatalf("Could not create reply: %s", err)
+	}
+	b, _ := NewTransactionReply(result, 3, &PeerID{Name: "vp1"})
+	if !a.Matches(b) {
+		t.Errorf("Expected replies of different replicas to the same result to match")
+	}
+
+	c, _ := NewTransactionReply(&TransactionResult{Uuid: "tx1", ErrorCode: 1, Error: "failed"}, 3, &PeerID{Name: "vp2"})
+	if a.Matches(c) {
+		t.Errorf("Expected replies to different results not to match")
+	}
+	e, _ := NewTransactionReply(&TransactionResult{Uuid: "tx1", ErrorCode: 1, Error: "failed differently"}, 3, &PeerID{Name: "vp3"})
+	if !c.Matches(e) {
+		t.Errorf("Expected replies to results with the same error code to match, whatever the error message")
+	}
+	d, _ := NewTransactionReply(result, 4, &PeerID{Name: "vp3"})
+	if a.Matches(d) {
+		t.Errorf("Expected replies for different blocks not to match")
+	}
+
+	unsigned, err := a.SignedBytes()
+	if err != nil {
+		t.Fatalf("Could not marshal reply: %s", err)
+	}
+	a.Signature = []byte("signature")
+	signed, _ := a.SignedBytes()
+	if !bytes.Equal(unsigned, signed) {
+		t.Errorf("Expected signed bytes not to cover the signature")
+	}
+	if a.Signature == nil {
+		t.Errorf("Expected SignedBytes to leave the signature in place")
+	}
+}
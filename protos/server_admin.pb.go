@@ -8,6 +8,7 @@ import proto "github.com/golang/protobuf/proto"
 import fmt "fmt"
 import math "math"
 import google_protobuf1 "google/protobuf"
+import google_protobuf "google/protobuf"
 
 import (
 	context "golang.org/x/net/context"
@@ -59,6 +60,60 @@ func (m *ServerStatus) Reset()         { *m = ServerStatus{} }
 func (m *ServerStatus) String() string { return proto.CompactTextString(m) }
 func (*ServerStatus) ProtoMessage()    {}
 
+type ByzantineBehaviors struct {
+	Behaviors []string `protobuf:"bytes,1,rep,name=behaviors" json:"behaviors,omitempty"`
+}
+
+func (m *ByzantineBehaviors) Reset()         { *m = ByzantineBehaviors{} }
+func (m *ByzantineBehaviors) String() string { return proto.CompactTextString(m) }
+func (*ByzantineBehaviors) ProtoMessage()    {}
+
+// ForwardingStatus reports, for each validator a non-validating peer
+// forwarded transactions to, how forwarding went. consecutiveFailures is
+// reset by the first transaction the validator accepts again.
+type ForwardingStatus struct {
+	Validators []*ValidatorHealth `protobuf:"bytes,1,rep,name=validators" json:"validators,omitempty"`
+}
+
+func (m *ForwardingStatus) Reset()         { *m = ForwardingStatus{} }
+func (m *ForwardingStatus) String() string { return proto.CompactTextString(m) }
+func (*ForwardingStatus) ProtoMessage()    {}
+
+func (m *ForwardingStatus) GetValidators() []*ValidatorHealth {
+	if m != nil {
+		return m.Validators
+	}
+	return nil
+}
+
+type ValidatorHealth struct {
+	Address             string                     `protobuf:"bytes,1,opt,name=address" json:"address,omitempty"`
+	Forwarded           uint64                     `protobuf:"varint,2,opt,name=forwarded" json:"forwarded,omitempty"`
+	Failed              uint64                     `protobuf:"varint,3,opt,name=failed" json:"failed,omitempty"`
+	ConsecutiveFailures uint64                     `protobuf:"varint,4,opt,name=consecutiveFailures" json:"consecutiveFailures,omitempty"`
+	LastSuccess         *google_protobuf.Timestamp `protobuf:"bytes,5,opt,name=lastSuccess" json:"lastSuccess,omitempty"`
+	LastFailure         *google_protobuf.Timestamp `protobuf:"bytes,6,opt,name=lastFailure" json:"lastFailure,omitempty"`
+	LastError           string                     `protobuf:"bytes,7,opt,name=lastError" json:"lastError,omitempty"`
+}
+
+func (m *ValidatorHealth) Reset()         { *m = ValidatorHealth{} }
+func (m *ValidatorHealth) String() string { return proto.CompactTextString(m) }
+func (*ValidatorHealth) ProtoMessage()    {}
+
+func (m *ValidatorHealth) GetLastSuccess() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.LastSuccess
+	}
+	return nil
+}
+
+func (m *ValidatorHealth) GetLastFailure() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.LastFailure
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("protos.ServerStatus_StatusCode", ServerStatus_StatusCode_name, ServerStatus_StatusCode_value)
 }
@@ -74,6 +129,23 @@ type AdminClient interface {
 	GetStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ServerStatus, error)
 	StartServer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ServerStatus, error)
 	StopServer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ServerStatus, error)
+	// Return or replace the byzantine behaviors of a validating peer; only
+	// meant for reproducing adversarial scenarios on test networks.
+	GetByzantine(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ByzantineBehaviors, error)
+	SetByzantine(ctx context.Context, in *ByzantineBehaviors, opts ...grpc.CallOption) (*ByzantineBehaviors, error)
+	// Return the internal state of the consensus plugin of a validating peer.
+	GetConsensusStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusStatus, error)
+	// Return the health of the validators a non-validating peer forwards
+	// transactions to.
+	GetForwardingStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ForwardingStatus, error)
+	// Report and steer the state transfer of a validating peer. A paused
+	// transfer makes no requests until resumed. A cancelled transfer gives
+	// up on its target, and waits for consensus to supply a new one.
+	GetStateTransferStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*StateTransferStatus, error)
+	PauseStateTransfer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*StateTransferStatus, error)
+	ResumeStateTransfer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*StateTransferStatus, error)
+	CancelStateTransfer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*StateTransferStatus, error)
+	PinStateTransferPeers(ctx context.Context, in *StateTransferPeers, opts ...grpc.CallOption) (*StateTransferStatus, error)
 }
 
 type adminClient struct {
@@ -111,6 +183,87 @@ func (c *adminClient) StopServer(ctx context.Context, in *google_protobuf1.Empty
 	return out, nil
 }
 
+func (c *adminClient) GetByzantine(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ByzantineBehaviors, error) {
+	out := new(ByzantineBehaviors)
+	err := grpc.Invoke(ctx, "/protos.Admin/GetByzantine", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetByzantine(ctx context.Context, in *ByzantineBehaviors, opts ...grpc.CallOption) (*ByzantineBehaviors, error) {
+	out := new(ByzantineBehaviors)
+	err := grpc.Invoke(ctx, "/protos.Admin/SetByzantine", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetConsensusStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusStatus, error) {
+	out := new(ConsensusStatus)
+	err := grpc.Invoke(ctx, "/protos.Admin/GetConsensusStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetForwardingStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ForwardingStatus, error) {
+	out := new(ForwardingStatus)
+	err := grpc.Invoke(ctx, "/protos.Admin/GetForwardingStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetStateTransferStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*StateTransferStatus, error) {
+	out := new(StateTransferStatus)
+	err := grpc.Invoke(ctx, "/protos.Admin/GetStateTransferStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) PauseStateTransfer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*StateTransferStatus, error) {
+	out := new(StateTransferStatus)
+	err := grpc.Invoke(ctx, "/protos.Admin/PauseStateTransfer", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ResumeStateTransfer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*StateTransferStatus, error) {
+	out := new(StateTransferStatus)
+	err := grpc.Invoke(ctx, "/protos.Admin/ResumeStateTransfer", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) CancelStateTransfer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*StateTransferStatus, error) {
+	out := new(StateTransferStatus)
+	err := grpc.Invoke(ctx, "/protos.Admin/CancelStateTransfer", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) PinStateTransferPeers(ctx context.Context, in *StateTransferPeers, opts ...grpc.CallOption) (*StateTransferStatus, error) {
+	out := new(StateTransferStatus)
+	err := grpc.Invoke(ctx, "/protos.Admin/PinStateTransferPeers", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Admin service
 
 type AdminServer interface {
@@ -118,6 +271,23 @@ type AdminServer interface {
 	GetStatus(context.Context, *google_protobuf1.Empty) (*ServerStatus, error)
 	StartServer(context.Context, *google_protobuf1.Empty) (*ServerStatus, error)
 	StopServer(context.Context, *google_protobuf1.Empty) (*ServerStatus, error)
+	// Return or replace the byzantine behaviors of a validating peer; only
+	// meant for reproducing adversarial scenarios on test networks.
+	GetByzantine(context.Context, *google_protobuf1.Empty) (*ByzantineBehaviors, error)
+	SetByzantine(context.Context, *ByzantineBehaviors) (*ByzantineBehaviors, error)
+	// Return the internal state of the consensus plugin of a validating peer.
+	GetConsensusStatus(context.Context, *google_protobuf1.Empty) (*ConsensusStatus, error)
+	// Return the health of the validators a non-validating peer forwards
+	// transactions to.
+	GetForwardingStatus(context.Context, *google_protobuf1.Empty) (*ForwardingStatus, error)
+	// Report and steer the state transfer of a validating peer. A paused
+	// transfer makes no requests until resumed. A cancelled transfer gives
+	// up on its target, and waits for consensus to supply a new one.
+	GetStateTransferStatus(context.Context, *google_protobuf1.Empty) (*StateTransferStatus, error)
+	PauseStateTransfer(context.Context, *google_protobuf1.Empty) (*StateTransferStatus, error)
+	ResumeStateTransfer(context.Context, *google_protobuf1.Empty) (*StateTransferStatus, error)
+	CancelStateTransfer(context.Context, *google_protobuf1.Empty) (*StateTransferStatus, error)
+	PinStateTransferPeers(context.Context, *StateTransferPeers) (*StateTransferStatus, error)
 }
 
 func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
@@ -160,6 +330,114 @@ func _Admin_StopServer_Handler(srv interface{}, ctx context.Context, dec func(in
 	return out, nil
 }
 
+func _Admin_GetByzantine_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).GetByzantine(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_SetByzantine_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ByzantineBehaviors)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).SetByzantine(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_GetConsensusStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).GetConsensusStatus(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_GetForwardingStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).GetForwardingStatus(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_GetStateTransferStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).GetStateTransferStatus(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_PauseStateTransfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).PauseStateTransfer(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_ResumeStateTransfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).ResumeStateTransfer(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_CancelStateTransfer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).CancelStateTransfer(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_PinStateTransferPeers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(StateTransferPeers)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).PinStateTransferPeers(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 var _Admin_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protos.Admin",
 	HandlerType: (*AdminServer)(nil),
@@ -176,6 +454,42 @@ var _Admin_serviceDesc = grpc.ServiceDesc{
 			MethodName: "StopServer",
 			Handler:    _Admin_StopServer_Handler,
 		},
+		{
+			MethodName: "GetByzantine",
+			Handler:    _Admin_GetByzantine_Handler,
+		},
+		{
+			MethodName: "SetByzantine",
+			Handler:    _Admin_SetByzantine_Handler,
+		},
+		{
+			MethodName: "GetConsensusStatus",
+			Handler:    _Admin_GetConsensusStatus_Handler,
+		},
+		{
+			MethodName: "GetForwardingStatus",
+			Handler:    _Admin_GetForwardingStatus_Handler,
+		},
+		{
+			MethodName: "GetStateTransferStatus",
+			Handler:    _Admin_GetStateTransferStatus_Handler,
+		},
+		{
+			MethodName: "PauseStateTransfer",
+			Handler:    _Admin_PauseStateTransfer_Handler,
+		},
+		{
+			MethodName: "ResumeStateTransfer",
+			Handler:    _Admin_ResumeStateTransfer_Handler,
+		},
+		{
+			MethodName: "CancelStateTransfer",
+			Handler:    _Admin_CancelStateTransfer_Handler,
+		},
+		{
+			MethodName: "PinStateTransferPeers",
+			Handler:    _Admin_PinStateTransferPeers_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{},
 }
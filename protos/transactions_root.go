@@ -0,0 +1,146 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package protos
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-incubator/obc-peer/openchain/util"
+)
+
+// The transactions root of a block is the root of a Merkle tree whose leaves
+// are the hashes of the transactions in order. Each level pairs up the hashes
+// of the level below, and an unpaired last hash moves up a level as it is.
+// Leaves and inner nodes are hashed with different prefixes, so that a node
+// cannot pass for a transaction.
+const (
+	transactionLeafPrefix = 0
+	transactionNodePrefix = 1
+)
+
+func transactionLeafHash(transaction *Transaction) ([]byte, error) {
+	data, err := proto.Marshal(transaction)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshal transaction: %s", err)
+	}
+	return util.ComputeCryptoHash(append([]byte{transactionLeafPrefix}, data...)), nil
+}
+
+func transactionNodeHash(left, right []byte) []byte {
+	data := append([]byte{transactionNodePrefix}, left...)
+	return util.ComputeCryptoHash(append(data, right...))
+}
+
+func transactionLeafHashes(transactions []*Transaction) ([][]byte, error) {
+	hashes := make([][]byte, len(transactions))
+	for i, transaction := range transactions {
+		hash, err := transactionLeafHash(transaction)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hash
+	}
+	return hashes, nil
+}
+
+func nextTransactionLevel(hashes [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(hashes)+1)/2)
+	for i := 0; i < len(hashes); i += 2 {
+		if i+1 == len(hashes) {
+			next = append(next, hashes[i])
+		} else {
+			next = append(next, transactionNodeHash(hashes[i], hashes[i+1]))
+		}
+	}
+	return next
+}
+
+// ComputeTransactionsRoot returns the root of the Merkle tree over the
+// transactions, nil if there are none
+func ComputeTransactionsRoot(transactions []*Transaction) ([]byte, error) {
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+	hashes, err := transactionLeafHashes(transactions)
+	if err != nil {
+		return nil, err
+	}
+	for len(hashes) > 1 {
+		hashes = nextTransactionLevel(hashes)
+	}
+	return hashes[0], nil
+}
+
+// GetTransactionProof returns the path from transaction index of the block
+// up to its transactions root, for VerifyTransactionProof
+func (block *Block) GetTransactionProof(index uint64) ([][]byte, error) {
+	if index >= uint64(len(block.Transactions)) {
+		return nil, fmt.Errorf("Block has no transaction %d", index)
+	}
+	hashes, err := transactionLeafHashes(block.Transactions)
+	if err != nil {
+		return nil, err
+	}
+	var path [][]byte
+	for len(hashes) > 1 {
+		if sibling := index ^ 1; sibling < uint64(len(hashes)) {
+			path = append(path, hashes[sibling])
+		}
+		hashes = nextTransactionLevel(hashes)
+		index /= 2
+	}
+	return path, nil
+}
+
+// VerifyTransactionProof checks that transaction is transaction index of
+// count transactions with the given transactions root, path being the proof
+// returned by Block.GetTransactionProof
+func VerifyTransactionProof(root []byte, transaction *Transaction, index uint64, count uint64, path [][]byte) error {
+	if index >= count {
+		return fmt.Errorf("Transaction %d is out of the %d transactions", index, count)
+	}
+	hash, err := transactionLeafHash(transaction)
+	if err != nil {
+		return err
+	}
+	for ; count > 1; count = (count + 1) / 2 {
+		if index%2 == 1 || index+1 < count {
+			if len(path) == 0 {
+				return fmt.Errorf("Proof for transaction %d is too short", index)
+			}
+			if index%2 == 1 {
+				hash = transactionNodeHash(path[0], hash)
+			} else {
+				hash = transactionNodeHash(hash, path[0])
+			}
+			path = path[1:]
+		}
+		index /= 2
+	}
+	if len(path) != 0 {
+		return fmt.Errorf("Proof has %d hashes too many", len(path))
+	}
+	if !bytes.Equal(hash, root) {
+		return fmt.Errorf("Proof leads to transactions root %x, expected %x", hash, root)
+	}
+	return nil
+}
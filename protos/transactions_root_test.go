@@ -0,0 +1,117 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package protos
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger-incubator/obc-peer/openchain/util"
+)
+
+func newRootTestTransactions(count int) []*Transaction {
+	var transactions []*Transaction
+	for i := 0; i < count; i++ {
+		transactions = append(transactions, &Transaction{Type: Transaction_CHAINCODE_EXECUTE, Uuid: fmt.Sprintf("tx%d", i)})
+	}
+	return transactions
+}
+
+func TestTransactionProofs(t *testing.T) {
+	for count := 1; count <= 9; count++ {
+		block := NewBlock(newRootTestTransactions(count), nil)
+		root, err := ComputeTransactionsRoot(block.Transactions)
+		if err != nil {
+			t.Fatalf("Error computing the transactions root: %s", err)
+		}
+		for i := range block.Transactions {
+			index := uint64(i)
+			path, err := block.GetTransactionProof(index)
+			if err != nil {
+				t.Fatalf("Error getting the proof of transaction %d of %d: %s", i, count, err)
+			}
+			if err := VerifyTransactionProof(root, block.Transactions[i], index, uint64(count), path); err != nil {
+				t.Fatalf("Expected the proof of transaction %d of %d to verify: %s", i, count, err)
+			}
+			other := &Transaction{Uuid: "other"}
+			if err := VerifyTransactionProof(root, other, index, uint64(count), path); err == nil {
+				t.Fatalf("Expected the proof of transaction %d of %d not to verify another transaction", i, count)
+			}
+			if count > 1 {
+				if err := VerifyTransactionProof(root, block.Transactions[i], (index+1)%uint64(count), uint64(count), path); err == nil {
+					t.Fatalf("Expected the proof of transaction %d of %d not to verify at another index", i, count)
+				}
+				if err := VerifyTransactionProof(root, block.Transactions[i], index, uint64(count), path[1:]); err == nil {
+					t.Fatalf("Expected a truncated proof of transaction %d of %d not to verify", i, count)
+				}
+			}
+		}
+	}
+	if root, err := ComputeTransactionsRoot(nil); err != nil || root != nil {
+		t.Fatalf("Expected no transactions to have no root, got %x", root)
+	}
+}
+
+func TestBlockHashIsHeaderHash(t *testing.T) {
+	block := NewBlock(newRootTestTransactions(3), []byte("metadata"))
+	block.StateHash = []byte("state")
+	block.NonHashData = &NonHashData{}
+	header, err := block.GetHeader()
+	if err != nil {
+		t.Fatalf("Error getting the block header: %s", err)
+	}
+	blockHash, _ := block.GetHash()
+	headerHash, _ := header.GetHash()
+	if !bytes.Equal(blockHash, headerHash) {
+		t.Fatalf("Expected the block hash %x to be the header hash %x", blockHash, headerHash)
+	}
+
+	block.Transactions[1].Uuid = "forged"
+	if forgedHash, _ := block.GetHash(); bytes.Equal(forgedHash, blockHash) {
+		t.Fatalf("Expected the block hash to cover the transactions")
+	}
+}
+
+func TestLegacyBlockHash(t *testing.T) {
+	block := NewBlock(newRootTestTransactions(3), []byte("metadata"))
+	block.Version = 0
+	block.StateHash = []byte("state")
+	data, err := proto.Marshal(block)
+	if err != nil {
+		t.Fatalf("Error marshalling the block: %s", err)
+	}
+	block.NonHashData = &NonHashData{LocalLedgerCommitTimestamp: util.CreateUtcTimestamp()}
+	blockHash, err := block.GetHash()
+	if err != nil {
+		t.Fatalf("Error hashing the block: %s", err)
+	}
+	if !bytes.Equal(blockHash, util.ComputeCryptoHash(data)) {
+		t.Fatalf("Expected a block of version 0 to keep its hash over the whole block")
+	}
+	header, err := block.GetHeader()
+	if err != nil {
+		t.Fatalf("Error getting the block header: %s", err)
+	}
+	if _, err := header.GetHash(); err == nil {
+		t.Fatalf("Expected the header of a block of version 0 to have no hash")
+	}
+}